@@ -0,0 +1,53 @@
+// p2-api-server serves pod, replication controller and daemon set status
+// records and rolling updates over HTTP, with consul-style blocking queries.
+// See pkg/statusapi for the endpoints.
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/statusapi"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/rollstore"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/version"
+)
+
+var (
+	port     = kingpin.Flag("port", "Port to serve the status API on").Default("3100").Int()
+	logLevel = kingpin.Flag("log", "Logging level to display").String()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	_, opts, labeler := flags.ParseWithConsulOptions()
+
+	logger := logging.NewLogger(logrus.Fields{})
+	if *logLevel != "" {
+		lv, err := logrus.ParseLevel(*logLevel)
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{"level": *logLevel}).
+				Fatalln("Could not parse log level")
+		}
+		logger.Logger.Level = lv
+	}
+
+	client := consul.NewConsulClient(opts)
+	server := statusapi.NewServer(
+		statusstore.NewConsul(client),
+		rollstore.NewConsul(client, labeler, &logger),
+		logger,
+	)
+
+	logger.WithField("port", *port).Infoln("Serving status API")
+	err := http.ListenAndServe(fmt.Sprintf(":%d", *port), server.Handler())
+	if err != nil {
+		logger.WithError(err).Fatalln("Status API server crashed")
+	}
+}
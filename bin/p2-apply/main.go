@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/apply"
+	"github.com/square/p2/pkg/cli"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/scheduler"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/dsstore"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/store/consul/rollstore"
+)
+
+const helpMessage = `
+p2-apply makes the pod clusters, replication controllers, daemon sets and
+labels in consul match a bundle of YAML documents, showing the plan and asking
+for confirmation before changing anything. Objects not described by the bundle
+are left alone.
+
+Replication controllers whose manifest, node selector, pod labels or allocation
+strategy changed are rolled to a new replication controller by a rolling update
+that follows their rolling_update policy. Replica count changes are made with a
+check-and-set, and labels are set in a single transaction.
+
+Manifests rendered from overlays or vars lose any signature the files they are
+rendered from had. Pass --sign to clearsign them with gpg.
+
+EXAMPLE DOCUMENTS
+
+kind: labels
+type: node
+id: node1.example.com
+labels:
+  role: web
+---
+kind: pod_cluster
+pod_id: web
+availability_zone: us-west-2a
+cluster_name: production
+allocation_strategy: dynamic_strategy
+annotations:
+  owner: web-team
+---
+kind: replication_controller
+manifest: web.yaml
+overlays: [production.yaml]
+vars: {az: us-west-2a}
+availability_zone: us-west-2a
+cluster_name: production
+allocation_strategy: dynamic_strategy
+node_selector: role=web
+replicas: 10
+rolling_update:
+  minimum_replicas: 8
+  roll_delay: 30s
+---
+kind: daemon_set
+manifest: agent.yaml
+cluster_name: production
+node_selector: role=web
+min_health: 1
+timeout: 10m
+`
+
+var (
+	bundle = kingpin.Flag("file", "A YAML file or a directory of YAML files describing the desired state").Short('f').Required().ExistingFileOrDir()
+	yes    = kingpin.Flag("yes", "Apply the plan without asking for confirmation").Short('y').Bool()
+	sign   = kingpin.Flag("sign", "Clearsign the manifests rendered from overlays or vars with gpg").Bool()
+	gpgKey = kingpin.Flag("gpg-key", "The gpg key to sign rendered manifests with. Defaults to gpg's default key").String()
+)
+
+func main() {
+	kingpin.CommandLine.Help = helpMessage
+	_, opts, applicator := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	logger := logging.NewLogger(logrus.Fields{})
+
+	docs, err := apply.ReadDocuments(*bundle)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// the rc and roll stores use transactions, which need a labeler that
+	// accesses consul directly
+	labeler := labels.NewConsulApplicator(client, 0, 0)
+	rcStore := rcstore.NewConsul(client, labeler, 3)
+	applier := apply.NewApplier(
+		pcstore.NewConsul(client, labeler, labels.DefaultAggregationRate, labeler, &logger),
+		rcStore,
+		rollstore.NewConsul(client, labeler, &logger),
+		dsstore.NewConsul(client, 3, &logger),
+		labeler,
+		scheduler.NewApplicatorScheduler(applicator),
+		client.KV(),
+		*sign,
+		*gpgKey,
+	)
+
+	changes, err := applier.Plan(docs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not plan changes: %s\n", err)
+		os.Exit(1)
+	}
+	if len(changes) == 0 {
+		fmt.Println("Nothing to change")
+		return
+	}
+	fmt.Println("Plan:")
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if !*yes && !cli.Confirm() {
+		fmt.Println("Aborted")
+		os.Exit(1)
+	}
+
+	session, _, err := consul.NewConsulStore(client).NewSession(fmt.Sprintf("p2-apply-%s-%s", currentUserName(), time.Now().Format("2006-01-02-15-04-05")), nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not create session: %s\n", err)
+		os.Exit(1)
+	}
+	err = applier.Apply(changes, session)
+	_ = session.Destroy()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println("Applied")
+}
+
+func currentUserName() string {
+	username := "unknown user"
+	if user, err := user.Current(); err == nil {
+		username = user.Username
+	}
+	return username
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/audit/shipper"
+	ds_fields "github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/logging"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/version"
+)
+
+const helpMessage = `
+p2-audit archives and searches the audit log.
+
+The ship command drains the audit log records kept in Consul into one or more
+sinks: a JSONL file that is rotated as it grows, a sqlite database and an HTTP
+webhook receiving each batch of records as a JSON array. Records are deleted
+from Consul only once every sink has stored them, so a record may be delivered
+more than once but is never lost. Each record carries its ID so duplicates can
+be recognized.
+
+The query command searches the records archived in a JSONL file or a sqlite
+database. --since and --until accept either a time in RFC3339 format or a
+duration, meaning that long ago.
+
+EXAMPLES
+
+$ p2-audit ship --sqlite /var/lib/p2-audit/audit.db --jsonl /var/log/p2-audit/audit.jsonl
+
+$ p2-audit query --sqlite /var/lib/p2-audit/audit.db --event-type DAEMON_SET_MODIFIED --user alice --since 168h
+`
+
+const (
+	CmdShip  = "ship"
+	CmdQuery = "query"
+)
+
+var (
+	cmdShip        = kingpin.Command(CmdShip, "Drain the audit log in Consul into sinks")
+	shipJSONL      = cmdShip.Flag("jsonl", "Append records to this JSONL file").String()
+	jsonlMaxBytes  = cmdShip.Flag("jsonl-max-bytes", "Rotate the JSONL file once it would grow past this size. 0 disables rotation").Default("104857600").Int64()
+	jsonlBackups   = cmdShip.Flag("jsonl-backups", "How many rotated JSONL files to keep").Default("10").Int()
+	shipSQLite     = cmdShip.Flag("sqlite", "Store records in this sqlite database").String()
+	webhooks       = cmdShip.Flag("webhook", "Post records to this URL. Can be specified multiple times").Strings()
+	webhookTimeout = cmdShip.Flag("webhook-timeout", "How long to wait for a webhook to respond").Default("30s").Duration()
+	interval       = cmdShip.Flag("interval", "How often to ship records").Default("1m").Duration()
+	once           = cmdShip.Flag("once", "Ship the records currently in Consul and exit").Bool()
+	cmdQuery       = kingpin.Command(CmdQuery, "Search archived audit log records")
+	queryJSONL     = cmdQuery.Flag("jsonl", "Search this JSONL file and its rotated backups").String()
+	querySQLite    = cmdQuery.Flag("sqlite", "Search this sqlite database").ExistingFile()
+	eventTypes     = cmdQuery.Flag("event-type", "Only show records of this event type. Can be specified multiple times").Strings()
+	user           = cmdQuery.Flag("user", "Only show records of actions by this user").String()
+	rcID           = cmdQuery.Flag("rc-id", "Only show rolling update and retargeting records about this RC").String()
+	dsID           = cmdQuery.Flag("ds-id", "Only show records about this daemon set").String()
+	since          = cmdQuery.Flag("since", "Only show records from this time on").String()
+	until          = cmdQuery.Flag("until", "Only show records from before this time").String()
+	outputFormat   = cmdQuery.Flag("format", "Output format").Default("text").Enum("text", "json")
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	kingpin.CommandLine.Help = helpMessage
+	cmd, consulOpts, _ := flags.ParseWithConsulOptions()
+	logger := logging.DefaultLogger
+
+	switch cmd {
+	case CmdShip:
+		sinks := openSinks(logger)
+		defer func() {
+			for _, sink := range sinks {
+				_ = sink.Close()
+			}
+		}()
+
+		client := consul.NewConsulClient(consulOpts)
+		source := shipper.NewConsulSource(auditlogstore.NewConsulStore(client.KV()), client.KV())
+		s := shipper.NewShipper(source, sinks, logger)
+		if *once {
+			shipped, err := s.Ship()
+			if err != nil {
+				logger.WithError(err).Errorln("Could not ship audit log records")
+				os.Exit(1)
+			}
+			fmt.Printf("Shipped %d audit log records\n", shipped)
+			return
+		}
+
+		quitCh := make(chan struct{})
+		go func() {
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			<-signals
+			close(quitCh)
+		}()
+		s.Run(*interval, quitCh)
+	case CmdQuery:
+		if (*queryJSONL == "") == (*querySQLite == "") {
+			fatalf("Exactly one of --jsonl and --sqlite must be given")
+		}
+		filter, err := buildFilter(time.Now())
+		if err != nil {
+			fatalf("%s", err)
+		}
+
+		var records []shipper.Record
+		if *queryJSONL != "" {
+			records, err = shipper.ReadJSONL(*queryJSONL, filter)
+		} else {
+			var sink shipper.SQLiteSink
+			sink, err = shipper.NewSQLiteSink(*querySQLite, logger)
+			if err == nil {
+				records, err = sink.Query(filter)
+				_ = sink.Close()
+			}
+		}
+		if err != nil {
+			fatalf("Could not query audit log records: %s", err)
+		}
+
+		if *outputFormat == "json" {
+			err = writeJSON(os.Stdout, records)
+		} else {
+			err = writeRecords(os.Stdout, records)
+		}
+		if err != nil {
+			fatalf("Could not write audit log records: %s", err)
+		}
+	}
+}
+
+func openSinks(logger logging.Logger) []shipper.Sink {
+	var sinks []shipper.Sink
+	if *shipJSONL != "" {
+		sink, err := shipper.NewJSONLSink(*shipJSONL, *jsonlMaxBytes, *jsonlBackups)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if *shipSQLite != "" {
+		sink, err := shipper.NewSQLiteSink(*shipSQLite, logger)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	httpClient := &http.Client{Timeout: *webhookTimeout}
+	for _, url := range *webhooks {
+		sinks = append(sinks, shipper.NewWebhookSink(url, httpClient))
+	}
+	if len(sinks) == 0 {
+		fatalf("At least one of --jsonl, --sqlite and --webhook must be given")
+	}
+	return sinks
+}
+
+func buildFilter(now time.Time) (shipper.Filter, error) {
+	filter := shipper.Filter{
+		User: *user,
+		RCID: rc_fields.ID(*rcID),
+		DSID: ds_fields.ID(*dsID),
+	}
+	for _, eventType := range *eventTypes {
+		filter.EventTypes = append(filter.EventTypes, audit.EventType(eventType))
+	}
+
+	var err error
+	if *since != "" {
+		filter.Since, err = parseTime(*since, now)
+		if err != nil {
+			return shipper.Filter{}, fmt.Errorf("Invalid --since: %s", err)
+		}
+	}
+	if *until != "" {
+		filter.Until, err = parseTime(*until, now)
+		if err != nil {
+			return shipper.Filter{}, fmt.Errorf("Invalid --until: %s", err)
+		}
+	}
+	return filter, nil
+}
+
+// parseTime accepts an RFC3339 time or a duration meaning that long before now
+func parseTime(s string, now time.Time) (time.Time, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC3339 time nor a duration", s)
+	}
+	return t, nil
+}
+
+func writeRecords(out io.Writer, records []shipper.Record) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tEVENT\tUSER\tRC\tDS\tID")
+	for _, record := range records {
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.Timestamp.Format(time.RFC3339),
+			record.EventType,
+			orDash(record.User()),
+			orDash(record.RCID().String()),
+			orDash(record.DSID().String()),
+			record.ID,
+		)
+	}
+	return w.Flush()
+}
+
+// writeJSON writes a record per line, in the same format as the JSONL sink
+func writeJSON(out io.Writer, records []shipper.Record) error {
+	encoder := json.NewEncoder(out)
+	for _, record := range records {
+		err := encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
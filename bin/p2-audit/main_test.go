@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	parsed, err := parseTime("24h", now)
+	if err != nil {
+		t.Fatalf("Could not parse a duration: %s", err)
+	}
+	if !parsed.Equal(now.Add(-24 * time.Hour)) {
+		t.Errorf("expected a day before %s but got %s", now, parsed)
+	}
+
+	parsed, err = parseTime("2016-12-31T00:00:00Z", now)
+	if err != nil {
+		t.Fatalf("Could not parse a time: %s", err)
+	}
+	if !parsed.Equal(time.Date(2016, 12, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong time parsed: %s", parsed)
+	}
+
+	_, err = parseTime("yesterday", now)
+	if err == nil {
+		t.Error("expected an error parsing neither a time nor a duration")
+	}
+}
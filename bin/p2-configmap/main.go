@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/configmapstore"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	CmdSet      = "set"
+	CmdGet      = "get"
+	CmdList     = "list"
+	CmdVersions = "versions"
+	CmdDelete   = "delete"
+)
+
+var (
+	cmdSet     = kingpin.Command(CmdSet, "Store the contents of a YAML file as the current version of a config map")
+	setName    = cmdSet.Arg("name", "The name of the config map").Required().String()
+	setFile    = cmdSet.Arg("file", "A YAML file holding a map of config").Required().ExistingFile()
+	cmdGet     = kingpin.Command(CmdGet, "Print a config map")
+	getName    = cmdGet.Arg("name", "The name of the config map").Required().String()
+	getSHA     = cmdGet.Flag("sha", "The version to print. Defaults to the current version").String()
+	cmdList    = kingpin.Command(CmdList, "List config maps and their current versions")
+	cmdVersion = kingpin.Command(CmdVersions, "List the stored versions of a config map")
+	verName    = cmdVersion.Arg("name", "The name of the config map").Required().String()
+	cmdDelete  = kingpin.Command(CmdDelete, "Delete a config map and all of its versions")
+	delName    = cmdDelete.Arg("name", "The name of the config map").Required().String()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	store := configmapstore.NewConsul(client.KV())
+
+	switch cmd {
+	case CmdSet:
+		contents, err := ioutil.ReadFile(*setFile)
+		if err != nil {
+			fatalf("Could not read %s: %s", *setFile, err)
+		}
+		data := make(map[interface{}]interface{})
+		err = yaml.Unmarshal(contents, &data)
+		if err != nil {
+			fatalf("Could not parse %s as a YAML map: %s", *setFile, err)
+		}
+		configMap, err := store.Set(*setName, data)
+		if err != nil {
+			fatalf("Could not set config map %s: %s", *setName, err)
+		}
+		fmt.Println(configMap.SHA)
+	case CmdGet:
+		configMap, err := store.Get(*getName, *getSHA)
+		if err != nil {
+			fatalf("Could not get config map %s: %s", *getName, err)
+		}
+		out, err := yaml.Marshal(configMap.Data)
+		if err != nil {
+			fatalf("Could not marshal config map %s: %s", *getName, err)
+		}
+		fmt.Print(string(out))
+	case CmdList:
+		current, err := store.CurrentSHAs()
+		if err != nil {
+			fatalf("Could not list config maps: %s", err)
+		}
+		names := make([]string, 0, len(current))
+		for name := range current {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tCURRENT SHA")
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\n", name, current[name])
+		}
+		w.Flush()
+	case CmdVersions:
+		current, err := store.Current(*verName)
+		if err != nil {
+			fatalf("Could not get config map %s: %s", *verName, err)
+		}
+		shas, err := store.Versions(*verName)
+		if err != nil {
+			fatalf("Could not list versions of config map %s: %s", *verName, err)
+		}
+		for _, sha := range shas {
+			if sha == current {
+				fmt.Printf("%s (current)\n", sha)
+			} else {
+				fmt.Println(sha)
+			}
+		}
+	case CmdDelete:
+		err := store.Delete(*delName)
+		if err != nil {
+			fatalf("Could not delete config map %s: %s", *delName, err)
+		}
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/drift"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/supervisor"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+var (
+	nodeName    = kingpin.Flag("node", "The node to audit. Defaults to this host's name; p2-drift must run on the node it audits.").String()
+	podRoot     = kingpin.Flag("pod-root", "The preparer's pod root").Default(pods.DefaultPath).String()
+	format      = kingpin.Flag("format", "Output format").Default("text").Enum("text", "json")
+	failOnDrift = kingpin.Flag("fail-on-drift", "Exit with status 2 if any drift is found").Bool()
+	superType   = kingpin.Flag("supervisor", "The process supervisor the preparer runs pods under").Default(supervisor.DefaultType).Enum(supervisor.RunitType, supervisor.SystemdType)
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	_, opts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	store := consul.NewConsulStore(client)
+
+	if *nodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("Could not determine hostname, pass --node: %s", err)
+		}
+		*nodeName = hostname
+	}
+
+	sup, err := supervisor.Config{Type: *superType}.Supervisor()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	auditor := drift.NewAuditor(types.NodeName(*nodeName), *podRoot, store)
+	auditor.Supervisor = sup
+	report, err := auditor.Audit()
+	if err != nil {
+		log.Fatalf("Could not audit %s: %s", *nodeName, err)
+	}
+
+	switch *format {
+	case "json":
+		bytes, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			log.Fatalf("Could not marshal report: %s", err)
+		}
+		fmt.Println(string(bytes))
+	case "text":
+		if len(report.Drift) == 0 {
+			fmt.Printf("No drift found on %s (%d pods checked)\n", report.Node, report.PodsSeen)
+			break
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "POD\tKIND\tLAUNCHABLE\tSERVICE\tEXPECTED\tACTUAL\tMESSAGE")
+		for _, d := range report.Drift {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.PodID, d.Kind, d.LaunchableID, d.Service, d.Expected, d.Actual, d.Message)
+		}
+		w.Flush()
+	}
+
+	if *failOnDrift && len(report.Drift) > 0 {
+		os.Exit(2)
+	}
+}
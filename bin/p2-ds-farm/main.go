@@ -8,15 +8,21 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/hashicorp/consul/api"
+	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/configmap"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/configmapstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/dsstore"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/nodestore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/daemonsetstatus"
+	"github.com/square/p2/pkg/util/stream"
 
 	ds_farm "github.com/square/p2/pkg/ds"
 
@@ -25,6 +31,8 @@ import (
 
 var (
 	useCachePodMatches = kingpin.Flag("use-cached-pod-matches", "If enabled, create a local cache of the pod label tree and match against that instead of querying on all pod selector queries").Bool()
+	excludeDeadNodes   = kingpin.Flag("exclude-dead-nodes", "If enabled, nodes whose preparer has stopped heartbeating to the node registry are treated as ineligible").Bool()
+	alertingConfig     = kingpin.Flag("alerting-config", "A YAML file describing where to route alerts, see alerting.Config").ExistingFile()
 )
 
 // SessionName returns a node identifier for use when creating Consul sessions.
@@ -51,6 +59,22 @@ func main() {
 	rawStatusStore := statusstore.NewConsul(client)
 	statusStore := daemonsetstatus.NewConsul(rawStatusStore, ds_farm.DaemonSetStatusNamespace)
 
+	var nodeRegistry scheduler.NodeRegistry
+	if *excludeDeadNodes {
+		nodeRegistry = nodestore.NewConsul(client.KV())
+	}
+
+	alerter := alerting.NewNop()
+	if *alertingConfig != "" {
+		config, err := alerting.LoadConfig(*alertingConfig)
+		if err == nil {
+			alerter, err = config.Alerter(nil)
+		}
+		if err != nil {
+			logger.WithError(err).Fatalln("Unable to initialize alerter")
+		}
+	}
+
 	sessions := make(chan string)
 	go consulutil.SessionManager(api.SessionEntry{
 		Name:      SessionName(),
@@ -58,6 +82,7 @@ func main() {
 		Behavior:  api.SessionBehaviorDelete,
 		TTL:       "15s",
 	}, client, sessions, quitCh, logger)
+	pub := stream.NewStringValuePublisher(sessions, "")
 
 	dsf := ds_farm.NewFarm(
 		consulStore,
@@ -67,18 +92,29 @@ func main() {
 		statusStore,
 		labeler,
 		labels.NewConsulApplicator(client, 0, 1*time.Minute),
-		sessions,
+		pub.Subscribe().Chan(),
 		logger,
-		nil,
+		alerter,
 		&healthChecker,
 		1*time.Second,
 		false,
 		*useCachePodMatches,
 		1*time.Second,
 		ds_farm.DefaultRetryInterval,
+		nodeRegistry,
 		ds_farm.DSFarmConfig{},
 	)
 
+	// Keep daemon sets that follow config maps on their current versions.
+	// Only the instance holding the follower lock does so
+	go configmap.NewFollower(
+		configmapstore.NewConsul(client.KV()),
+		nil,
+		dsStore,
+		configmap.DefaultFollowInterval,
+		logger,
+	).RunLocked("daemon_sets", pub.Subscribe().Chan(), consulStore, quitCh)
+
 	go func() {
 		// clear lock immediately on ctrl-C
 		signals := make(chan os.Signal, 1)
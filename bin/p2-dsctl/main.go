@@ -13,11 +13,13 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/square/p2/pkg/cli"
+	"github.com/square/p2/pkg/dryrun"
 	"github.com/square/p2/pkg/ds"
 	ds_fields "github.com/square/p2/pkg/ds/fields"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/render"
 	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/dsstore"
@@ -56,6 +58,7 @@ var (
 	createName       = cmdCreate.Flag("name", "The cluster name (ie. staging, production)").Required().String()
 	createTimeout    = cmdCreate.Flag("timeout", "Non-zero timeout for replicating hosts. e.g. 1m2s for 1 minute and 2 seconds").Required().Duration()
 	createEverywhere = cmdCreate.Flag("everywhere", "Sets selector to match everything regardless of its value").Bool()
+	createRender     = render.AddFlags(cmdCreate)
 
 	cmdGet = kingpin.Command(CmdGet, "Show a daemon set.")
 	getID  = cmdGet.Arg("id", "The uuid for the daemon set").Required().String()
@@ -82,6 +85,8 @@ var (
 	updateName          = cmdUpdate.Flag("name", "The cluster name (ie. staging, production)").String()
 	updateTimeout       = cmdUpdate.Flag("timeout", "Non-zero timeout for replicating hosts. e.g. 1m2s for 1 minute and 2 seconds").Default(TimeoutNotSpecified.String()).Duration()
 	updateEverywhere    = cmdUpdate.Flag("everywhere", "Sets selector to match everything regardless of its value").Bool()
+	updateRender        = render.AddFlags(cmdUpdate)
+	updateDry           = dryrun.AddFlags(cmdUpdate)
 
 	cmdTestSelector = kingpin.Command(CmdTestSelector, `
 		This will output the hosts that match the selector,
@@ -107,7 +112,7 @@ func main() {
 		}
 		name := ds_fields.ClusterName(*createName)
 
-		manifest, err := manifest.FromPath(*createManifest)
+		manifest, err := render.Load(*createManifest, createRender.Options())
 		if err != nil {
 			log.Fatalf("%s", err)
 		}
@@ -241,6 +246,17 @@ func main() {
 	case CmdUpdate:
 		id := ds_fields.ID(*updateID)
 
+		// the manifest is rendered before the mutator runs since the
+		// mutator may be retried, and signing may prompt for a passphrase
+		var newManifest manifest.Manifest
+		if *updateManifest != "" {
+			var err error
+			newManifest, err = render.Load(*updateManifest, updateRender.Options())
+			if err != nil {
+				log.Fatalf("%s", err)
+			}
+		}
+
 		mutator := func(ds ds_fields.DaemonSet) (ds_fields.DaemonSet, error) {
 			changed := false
 			if *updateMinHealth != "" {
@@ -270,12 +286,8 @@ func main() {
 					ds.Timeout = *updateTimeout
 				}
 			}
-			if *updateManifest != "" {
-				manifest, err := manifest.FromPath(*updateManifest)
-				if err != nil {
-					return ds, util.Errorf("%s", err)
-				}
-
+			if newManifest != nil {
+				manifest := newManifest
 				if manifest.ID() != ds.PodID {
 					return ds, util.Errorf("Manifest ID of %s does not match daemon set's pod ID (%s)", manifest.ID(), ds.PodID)
 				}
@@ -300,7 +312,15 @@ func main() {
 				} else if selectorString == "" {
 					return ds, util.Errorf("Explicit everything selector not allowed, please use the --everwhere flag")
 				}
-				selector, err := parseNodeSelectorWithPrompt(ds.NodeSelector, selectorString, applicator)
+				// the dry run reports the nodes the selector adds and
+				// removes instead of asking to confirm them
+				parse := parseNodeSelectorWithPrompt
+				if updateDry.DryRun() {
+					parse = func(_ klabels.Selector, selectorString string, _ labels.ApplicatorWithoutWatches) (klabels.Selector, error) {
+						return parseNodeSelector(selectorString)
+					}
+				}
+				selector, err := parse(ds.NodeSelector, selectorString, applicator)
 				if err != nil {
 					return ds, util.Errorf("Error occurred: %v", err)
 				}
@@ -314,7 +334,7 @@ func main() {
 				return ds, util.Errorf("No changes were made")
 			}
 
-			if updateSelectorGiven || *updateMinHealth != "" {
+			if (updateSelectorGiven || *updateMinHealth != "") && !updateDry.DryRun() {
 				if err := confirmMinheathForSelector(ds.MinHealth, ds.NodeSelector, applicator); err != nil {
 					return ds, util.Errorf("Error occurred: %v", err)
 				}
@@ -323,6 +343,26 @@ func main() {
 			return ds, nil
 		}
 
+		if updateDry.DryRun() {
+			oldDS, newDS, err := dsstore.MutateDSDryRun(id, mutator)
+			if err != nil {
+				log.Fatalf("Daemon set update would fail: %v", err)
+			}
+			nodes, err := dryrun.DaemonSetNodes(scheduler.NewApplicatorScheduler(applicator), oldDS, newDS)
+			if err != nil {
+				log.Fatalf("Could not find the nodes of the daemon set: %v", err)
+			}
+			policy, err := updateDry.Policy()
+			if err != nil {
+				log.Fatalf("Could not load the deploy policy: %v", err)
+			}
+			err = dryrun.NewReport(oldDS.Manifest, newDS.Manifest, nodes, policy, logger).Write(os.Stdout)
+			if err != nil {
+				log.Fatalf("Could not write dry run report: %v", err)
+			}
+			return
+		}
+
 		_, err := dsstore.MutateDS(id, mutator)
 		if err != nil {
 			log.Fatalf("err: %v", err)
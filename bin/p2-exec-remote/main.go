@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/preparer"
+	netutil "github.com/square/p2/pkg/util/net"
+	"github.com/square/p2/pkg/version"
+)
+
+const helpMessage = `
+p2-exec-remote runs a command in a pod on another node, through the status
+server of that node's preparer. The command runs as the pod's user, with the
+pod's and launchable's environment, in the launchable's directory and cgroup.
+Its input and output are connected to p2-exec-remote's, and p2-exec-remote exits
+with its exit code.
+
+Commands are sent over TLS to the preparer's status_tls_port, authenticated
+by the client certificate given with --tls-cert-file. The certificate must be
+signed by the preparer's CA and its common name must be one of the preparer's
+exec_users. Every session is written to the audit log under that name.
+
+EXAMPLES
+
+$ p2-exec-remote --node aws1.example.com --status-port 8443 --tls-cert-file me.crt --tls-key-file me.key web -- ls -l
+
+$ echo 'SELECT 1;' | p2-exec-remote --node aws1.example.com --status-port 8443 --tls-cert-file me.crt --tls-key-file me.key --launchable db web -- bin/console
+`
+
+var (
+	node         = kingpin.Flag("node", "The node the pod runs on").Required().String()
+	statusPort   = kingpin.Flag("status-port", "The port the preparer's TLS status server listens on").Required().Int()
+	caFile       = kingpin.Flag("tls-ca-file", "File containing the x509 PEM-encoded CA that signed the preparer's certificate").ExistingFile()
+	certFile     = kingpin.Flag("tls-cert-file", "File containing the x509 PEM-encoded client certificate to authenticate with").Required().ExistingFile()
+	keyFile      = kingpin.Flag("tls-key-file", "File containing the x509 PEM-encoded private key of the client certificate").Required().ExistingFile()
+	podUniqueKey = kingpin.Flag("pod-unique-key", "The unique key of the pod, for pods that have one").String()
+	launchable   = kingpin.Flag("launchable", "The launchable to run the command in. Required if the pod has more than one").String()
+	podID        = kingpin.Arg("pod", "The ID of the pod to run the command in").Required().String()
+	command      = kingpin.Arg("command", "The command to run and its arguments").Required().Strings()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	kingpin.CommandLine.Help = helpMessage
+	kingpin.Parse()
+
+	tlsConfig, err := netutil.GetTLSConfig(*certFile, *keyFile, *caFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not load TLS config: %s\n", err)
+		os.Exit(1)
+	}
+
+	query := url.Values{}
+	query.Set("pod", *podID)
+	if *podUniqueKey != "" {
+		query.Set("pod_unique_key", *podUniqueKey)
+	}
+	if *launchable != "" {
+		query.Set("launchable", *launchable)
+	}
+	query["command"] = *command
+
+	address := fmt.Sprintf("%s:%d", *node, *statusPort)
+	exitCode, err := preparer.RemoteExec(address, query, tlsConfig, os.Stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not run command on %s: %s\n", *node, err)
+		os.Exit(1)
+	}
+	os.Exit(exitCode)
+}
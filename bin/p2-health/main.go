@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/health/history"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+const helpMessage = `
+p2-health reports on the health of pods.
+
+The history command summarizes the changes in health of a pod on every node it
+runs on: how often it flapped, how long it spent in each health and what its
+last critical check reported. The history is read from the status server of
+each node's preparer, which must be configured with a health_history.
+
+EXAMPLES
+
+$ p2-health history web --status-port 8080 --since 6h
+
+$ p2-health history web --status-port 8080 --node node1.example.com --transitions
+`
+
+const CmdHistory = "history"
+
+var (
+	cmdHistory  = kingpin.Command(CmdHistory, "Summarize the health history of a pod on the nodes it runs on")
+	historyPod  = cmdHistory.Arg("pod", "The ID of the pod").Required().String()
+	since       = cmdHistory.Flag("since", "How far back to look").Default("24h").Duration()
+	nodes       = cmdHistory.Flag("node", "Only report on this node. Can be specified multiple times").Strings()
+	transitions = cmdHistory.Flag("transitions", "Also print every change in health").Bool()
+	statusPort  = cmdHistory.Flag("status-port", "The port the preparers' status servers listen on").Required().Int()
+	timeout     = cmdHistory.Flag("timeout", "How long to wait for each node's preparer").Default("10s").Duration()
+)
+
+// nodeHistory is the health history of a pod on one node
+type nodeHistory struct {
+	node        types.NodeName
+	transitions []history.Transition
+	err         error
+}
+
+func main() {
+	kingpin.Version(version.VERSION)
+	kingpin.CommandLine.Help = helpMessage
+	cmd, consulOpts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(consulOpts)
+
+	switch cmd {
+	case CmdHistory:
+		podID := types.PodID(*historyPod)
+		reality, _, err := consul.NewConsulStore(client).AllPods(consul.REALITY_TREE)
+		if err != nil {
+			fatalf("Could not read the reality tree: %s", err)
+		}
+		podNodes := filterNodes(realityNodes(reality, podID), *nodes)
+		if len(podNodes) == 0 {
+			fatalf("%s does not run on any nodes", podID)
+		}
+
+		now := time.Now()
+		histories := fetchHistories(podNodes, podID, now.Add(-*since))
+		writeHistories(os.Stdout, histories, now, *transitions)
+		for _, h := range histories {
+			if h.err != nil {
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// realityNodes returns the nodes a pod runs on according to the reality tree,
+// in order
+func realityNodes(reality []consul.ManifestResult, podID types.PodID) []types.NodeName {
+	nodeSet := types.NewNodeSet()
+	for _, result := range reality {
+		if result.Manifest.ID() == podID {
+			nodeSet.InsertNode(result.PodLocation.Node)
+		}
+	}
+	return nodeSet.ListNodes()
+}
+
+func filterNodes(podNodes []types.NodeName, only []string) []types.NodeName {
+	if len(only) == 0 {
+		return podNodes
+	}
+	var filtered []types.NodeName
+	for _, node := range podNodes {
+		for _, name := range only {
+			if node.String() == name {
+				filtered = append(filtered, node)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// fetchHistories reads the pod's health history from each node's preparer
+// concurrently. The histories are in the order of the nodes.
+func fetchHistories(podNodes []types.NodeName, podID types.PodID, sinceTime time.Time) []nodeHistory {
+	httpClient := &http.Client{Timeout: *timeout}
+	histories := make([]nodeHistory, len(podNodes))
+	var wg sync.WaitGroup
+	for i, node := range podNodes {
+		wg.Add(1)
+		go func(i int, node types.NodeName) {
+			defer wg.Done()
+			transitions, err := fetchHistory(httpClient, node, podID, sinceTime)
+			histories[i] = nodeHistory{node: node, transitions: transitions, err: err}
+		}(i, node)
+	}
+	wg.Wait()
+	return histories
+}
+
+func fetchHistory(httpClient *http.Client, node types.NodeName, podID types.PodID, sinceTime time.Time) ([]history.Transition, error) {
+	query := url.Values{}
+	query.Set("pod", podID.String())
+	query.Set("since", sinceTime.Format(time.RFC3339Nano))
+	historyURL := url.URL{
+		Scheme:   "http",
+		Host:     fmt.Sprintf("%s:%d", node, *statusPort),
+		Path:     "/_health_history",
+		RawQuery: query.Encode(),
+	}
+
+	resp, err := httpClient.Get(historyURL.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("the preparer does not keep a health history")
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var transitions []history.Transition
+	err = json.NewDecoder(resp.Body).Decode(&transitions)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode health history: %s", err)
+	}
+	return transitions, nil
+}
+
+// writeHistories prints a line per node and service summarizing its history,
+// followed by the transitions themselves if requested.
+func writeHistories(out io.Writer, histories []nodeHistory, now time.Time, withTransitions bool) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tSERVICE\tHEALTH\tFLAPS\tTIME IN STATE\tLAST CRITICAL")
+	totalFlaps := 0
+	for _, h := range histories {
+		if h.err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\terror: %s\n", h.node, h.err)
+			continue
+		}
+		summaries := history.Summarize(h.transitions, now)
+		if len(summaries) == 0 {
+			fmt.Fprintf(w, "%s\t-\t-\t0\t-\tno changes in health\n", h.node)
+		}
+		for _, summary := range summaries {
+			totalFlaps += summary.Flaps
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%d\t%s\t%s\n",
+				h.node,
+				summary.Service,
+				summary.Current,
+				summary.Flaps,
+				formatTimeInState(summary.TimeInState),
+				formatLastCritical(summary),
+			)
+		}
+	}
+	w.Flush()
+	fmt.Fprintf(out, "%d flaps across %d nodes\n", totalFlaps, len(histories))
+
+	if !withTransitions {
+		return
+	}
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tNODE\tSERVICE\tCHANGE\tOUTPUT")
+	for _, h := range histories {
+		for _, transition := range h.transitions {
+			previous := transition.Previous
+			if previous == "" {
+				previous = "-"
+			}
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%s -> %s\t%s\n",
+				transition.Time.Format(time.RFC3339),
+				h.node,
+				transition.Service,
+				previous,
+				transition.Status,
+				oneLine(transition.Output),
+			)
+		}
+	}
+	w.Flush()
+}
+
+// formatTimeInState lists the time spent in each health, healthiest first
+func formatTimeInState(timeInState map[health.HealthState]time.Duration) string {
+	var states []health.HealthState
+	for state := range timeInState {
+		states = append(states, state)
+	}
+	sort.Sort(sort.Reverse(byHealth(states)))
+
+	parts := make([]string, 0, len(states))
+	for _, state := range states {
+		d := timeInState[state] / time.Second * time.Second
+		parts = append(parts, fmt.Sprintf("%s %s", state, d))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatLastCritical(summary history.Summary) string {
+	if summary.LastCriticalTime.IsZero() {
+		return "-"
+	}
+	output := oneLine(summary.LastCriticalOutput)
+	if output == "" {
+		output = "no output"
+	}
+	return fmt.Sprintf("%s: %s", summary.LastCriticalTime.Format(time.RFC3339), output)
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+type byHealth []health.HealthState
+
+func (b byHealth) Len() int           { return len(b) }
+func (b byHealth) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byHealth) Less(i, j int) bool { return health.Compare(b[i], b[j]) < 0 }
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
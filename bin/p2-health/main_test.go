@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/health/history"
+)
+
+func TestWriteHistories(t *testing.T) {
+	start := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	histories := []nodeHistory{
+		{
+			node: "node1",
+			transitions: []history.Transition{
+				{Service: "web", Status: health.Passing, Time: start},
+				{Service: "web", Previous: health.Passing, Status: health.Critical, Output: "dial tcp:\nconnection refused", Time: start.Add(10 * time.Minute)},
+				{Service: "web", Previous: health.Critical, Status: health.Passing, Time: start.Add(12 * time.Minute)},
+			},
+		},
+		{node: "node2"},
+		{node: "node3", err: fmt.Errorf("connection refused")},
+	}
+
+	var out bytes.Buffer
+	writeHistories(&out, histories, start.Add(time.Hour), true)
+	for _, expected := range []string{
+		"passing 58m0s, critical 2m0s",
+		"2017-01-02T03:14:05Z: dial tcp: connection refused",
+		"no changes in health",
+		"error: connection refused",
+		"2 flaps across 3 nodes",
+		"passing -> critical",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in the output:\n%s", expected, out.String())
+		}
+	}
+}
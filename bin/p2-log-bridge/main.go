@@ -9,6 +9,7 @@ import (
 
 	"github.com/square/p2/pkg/logbridge"
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/version"
 	"golang.org/x/sys/unix"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -16,6 +17,8 @@ import (
 
 var (
 	durableLogger = kingpin.Arg("exec", "An executable that logbridge will log to without dropping messages. If a write to STDIN of this program blocks, logbridge will block.").Required().String()
+	bufferDir     = kingpin.Flag("buffer-dir", "The directory in which lines are buffered until they have been shipped, for pods that ship their logs. Relative to the working directory of the log agent.").Default("main/buffer").String()
+	drainTimeout  = kingpin.Flag("drain-timeout", "How long to keep shipping buffered lines after STDIN is closed. Lines that aren't shipped by then are shipped the next time logbridge starts.").Default("10s").Duration()
 )
 
 func main() {
@@ -56,7 +59,12 @@ func main() {
 
 		lb := logbridge.NewLogBridge(r, durableWriter, lossyWriter, logger, 1024, 4096, nil, "log_lines", "log_bytes", "dropped_lines", "throttled_ms")
 
-		lb.Tee()
+		if shipper := newShipper(logger); shipper != nil {
+			lb.Ship(shipper)
+			shipper.Close(*drainTimeout)
+		} else {
+			lb.Tee()
+		}
 		logging.DefaultLogger.NoFields().Infoln("logbridge Tee returned. Shutting down subordinate log command.")
 		durablePipe.Close()
 	}(os.Stdin, durablePipe, os.Stdout, logging.DefaultLogger)
@@ -65,6 +73,34 @@ func main() {
 	wg.Wait()
 }
 
+// newShipper returns a shipper for the logs of pods whose manifest has a
+// log_shipping section, or nil if the pod doesn't ship its logs. Logs are
+// still written to the durable logger if the shipper can't be created.
+func newShipper(logger logging.Logger) *logbridge.Shipper {
+	configPath := os.Getenv(pods.LogShippingConfigPathEnvVar)
+	if configPath == "" {
+		return nil
+	}
+
+	config, err := logbridge.LoadConfig(configPath)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not load log shipping config, logs will not be shipped")
+		return nil
+	}
+	metadata := logbridge.Metadata{
+		Node:         os.Getenv(pods.NodeEnvVar),
+		PodID:        os.Getenv(pods.PodIDEnvVar),
+		PodUniqueKey: os.Getenv(pods.PodUniqueKeyEnvVar),
+		LaunchableID: os.Getenv(pods.LaunchableIDEnvVar),
+	}
+	shipper, err := logbridge.NewShipper(config, metadata, *bufferDir, logger)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not start shipping logs")
+		return nil
+	}
+	return shipper
+}
+
 // In environments where svlogd is used, the pipe that becomes STDIN of this
 // program can be non-blocking. Go's File implementation does not play well
 // with non-blocking pipes, in particular it does not recover from an EAGAIN
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	pcfields "github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/preparer"
+	"github.com/square/p2/pkg/rc"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/podstore"
+	"github.com/square/p2/pkg/types"
+	netutil "github.com/square/p2/pkg/util/net"
+	"github.com/square/p2/pkg/version"
+)
+
+const helpMessage = `
+p2-logs prints the logs of a pod's launchables from every node it runs on,
+prefixing each line with the node it came from. The pod is given by its ID, in
+which case the nodes are found in the reality tree, or by the replication
+controller or pod cluster that manages it, in which case they are found by the
+pods' labels.
+
+Logs are read over TLS from the status server on each node's status_tls_port.
+The preparers must be configured with a logs_token_file containing the same
+token as --logs-token-file, and their certificates must be signed by the CA in
+--status-ca-file, or by a system CA if it isn't given.
+
+EXAMPLES
+
+$ p2-logs --status-port 8443 --status-ca-file ca.pem --logs-token-file token --pod web -n 100
+
+$ p2-logs --status-port 8443 --status-ca-file ca.pem --logs-token-file token --rc 3f2a... --since 10m -f
+`
+
+var (
+	podID      = kingpin.Flag("pod", "The ID of the pod whose logs to print").String()
+	rcID       = kingpin.Flag("rc", "The ID of a replication controller whose pods' logs to print").String()
+	pcID       = kingpin.Flag("pc", "The ID of a pod cluster whose pods' logs to print").String()
+	nodes      = kingpin.Flag("node", "Only print logs from this node. Can be specified multiple times").Strings()
+	launchable = kingpin.Flag("launchable", "Only print logs of this launchable").String()
+	entryPoint = kingpin.Flag("entry-point", "Only print logs of this entry point, e.g. bin/launch").String()
+	tail       = kingpin.Flag("tail", "The number of lines to print from each node, or -1 for all of them").Short('n').Default("10").Int()
+	since      = kingpin.Flag("since", "Only print lines logged since this long ago, e.g. 10m, or since this RFC3339 time").String()
+	follow     = kingpin.Flag("follow", "Keep printing new lines as they are logged").Short('f').Bool()
+	timestamps = kingpin.Flag("timestamps", "Print the time each line was logged").Short('t').Bool()
+	statusPort = kingpin.Flag("status-port", "The port the preparers' TLS status servers listen on").Required().Int()
+	statusCA   = kingpin.Flag("status-ca-file", "File containing the x509 PEM-encoded CA that signed the preparers' certificates").ExistingFile()
+	tokenFile  = kingpin.Flag("logs-token-file", "The file containing the token the preparers require to serve logs").Required().ExistingFile()
+)
+
+// target is a pod on a node whose logs are printed
+type target struct {
+	node      types.NodeName
+	podID     types.PodID
+	uniqueKey types.PodUniqueKey
+}
+
+func main() {
+	kingpin.Version(version.VERSION)
+	kingpin.CommandLine.Help = helpMessage
+	_, consulOpts, labeler := flags.ParseWithConsulOptions()
+	logger := logging.NewLogger(logrus.Fields{})
+
+	sinceTime, err := parseSince(*since, time.Now())
+	if err != nil {
+		logger.WithError(err).Fatalln("Invalid --since")
+	}
+	tokenBytes, err := ioutil.ReadFile(*tokenFile)
+	if err != nil {
+		logger.WithError(err).Fatalln("Could not read logs token file")
+	}
+	token := strings.TrimSpace(string(tokenBytes))
+	tlsConfig, err := netutil.GetTLSConfig("", "", *statusCA)
+	if err != nil {
+		logger.WithError(err).Fatalln("Could not load --status-ca-file")
+	}
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	client := consul.NewConsulClient(consulOpts)
+	var targets []target
+	switch {
+	case *podID != "" && *rcID == "" && *pcID == "":
+		var reality []consul.ManifestResult
+		reality, _, err = consul.NewConsulStore(client).AllPods(consul.REALITY_TREE)
+		targets = podTargets(reality, types.PodID(*podID))
+	case *rcID != "" && *podID == "" && *pcID == "":
+		selector := klabels.Everything().Add(rc.RCIDLabel, klabels.EqualsOperator, []string{*rcID})
+		targets, err = labeledTargets(labeler, podstore.NewConsul(client.KV()), selector)
+	case *pcID != "" && *podID == "" && *rcID == "":
+		pcStore := pcstore.NewConsul(client, labeler, labels.DefaultAggregationRate, labels.NewConsulApplicator(client, 0, 0), &logger)
+		var pc pcfields.PodCluster
+		pc, err = pcStore.Get(pcfields.ID(*pcID))
+		if err == nil {
+			targets, err = labeledTargets(labeler, podstore.NewConsul(client.KV()), pc.PodSelector)
+		}
+	default:
+		logger.NoFields().Fatalln("Exactly one of --pod, --rc or --pc must be given")
+	}
+	if err != nil {
+		logger.WithError(err).Fatalln("Could not find the nodes the pod runs on")
+	}
+	targets = filterNodes(targets, *nodes)
+	if len(targets) == 0 {
+		logger.NoFields().Fatalln("The pod does not run on any nodes")
+	}
+
+	query := url.Values{}
+	query.Set("tail", strconv.Itoa(*tail))
+	if !sinceTime.IsZero() {
+		query.Set("since", sinceTime.Format(time.RFC3339Nano))
+	}
+	if *follow {
+		query.Set("follow", "true")
+	}
+	if *launchable != "" {
+		query.Set("launchable", *launchable)
+	}
+	if *entryPoint != "" {
+		query.Set("entry_point", *entryPoint)
+	}
+
+	out := newPrinter(os.Stdout, targets, *timestamps)
+	var wg sync.WaitGroup
+	failed := make(chan struct{}, len(targets))
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			err := streamLogs(httpClient, t, query, token, out)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", t.node, err)
+				failed <- struct{}{}
+			}
+		}(t)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseSince parses either a duration before now or an RFC3339 time. An
+// empty value returns the zero time.
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	d, err := time.ParseDuration(since)
+	if err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration nor an RFC3339 time", since)
+	}
+	return t, nil
+}
+
+// podTargets finds the nodes a pod runs on in the reality tree.
+func podTargets(reality []consul.ManifestResult, podID types.PodID) []target {
+	var targets []target
+	for _, result := range reality {
+		if result.Manifest.ID() != podID {
+			continue
+		}
+		targets = append(targets, target{
+			node:      result.PodLocation.Node,
+			podID:     podID,
+			uniqueKey: result.PodUniqueKey,
+		})
+	}
+	return targets
+}
+
+type podReader interface {
+	ReadPod(key types.PodUniqueKey) (podstore.Pod, error)
+}
+
+// labeledTargets finds the pods matching a selector by their labels.
+func labeledTargets(labeler labels.ApplicatorWithoutWatches, pods podReader, selector klabels.Selector) ([]target, error) {
+	matches, err := labeler.GetMatches(selector, labels.POD)
+	if err != nil {
+		return nil, err
+	}
+	var targets []target
+	for _, match := range matches {
+		// pods with a unique key are labeled by the key alone, and their
+		// node and ID are in the pod store
+		if uniqueKey, err := types.ToPodUniqueKey(match.ID); err == nil {
+			pod, err := pods.ReadPod(uniqueKey)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, target{node: pod.Node, podID: pod.Manifest.ID(), uniqueKey: uniqueKey})
+			continue
+		}
+		node, podID, err := labels.NodeAndPodIDFromPodLabel(match)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target{node: node, podID: podID})
+	}
+	return targets, nil
+}
+
+func filterNodes(targets []target, nodes []string) []target {
+	if len(nodes) == 0 {
+		return targets
+	}
+	var filtered []target
+	for _, t := range targets {
+		for _, node := range nodes {
+			if t.node.String() == node {
+				filtered = append(filtered, t)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// streamLogs prints the logs served by a node's preparer until they end.
+func streamLogs(client *http.Client, t target, query url.Values, token string, out *printer) error {
+	podQuery := url.Values{}
+	for key, values := range query {
+		podQuery[key] = values
+	}
+	podQuery.Set("pod", t.podID.String())
+	if t.uniqueKey != "" {
+		podQuery.Set("pod_unique_key", t.uniqueKey.String())
+	}
+	logsURL := url.URL{
+		Scheme:   "https",
+		Host:     fmt.Sprintf("%s:%d", t.node, *statusPort),
+		Path:     "/_logs",
+		RawQuery: podQuery.Encode(),
+	}
+
+	req, err := http.NewRequest("GET", logsURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var line preparer.LogLine
+		err = decoder.Decode(&line)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		out.print(t.node, line)
+	}
+}
+
+// printer writes the lines of many nodes to one writer, prefixing each line
+// with its node, launchable and entry point.
+type printer struct {
+	mu         sync.Mutex
+	out        io.Writer
+	width      int
+	timestamps bool
+}
+
+func newPrinter(out io.Writer, targets []target, timestamps bool) *printer {
+	width := 0
+	for _, t := range targets {
+		if len(t.node) > width {
+			width = len(t.node)
+		}
+	}
+	return &printer{out: out, width: width, timestamps: timestamps}
+}
+
+func (p *printer) print(node types.NodeName, line preparer.LogLine) {
+	prefix := fmt.Sprintf("%-*s %s %s", p.width, node, line.LaunchableID, line.EntryPoint)
+	if p.timestamps {
+		prefix += " " + line.Time.Format(time.RFC3339Nano)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.out, "%s | %s\n", prefix, line.Line)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/preparer"
+	"github.com/square/p2/pkg/store/consul/podstore"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	testCases := []struct {
+		since    string
+		expected time.Time
+	}{
+		{"", time.Time{}},
+		{"10m", now.Add(-10 * time.Minute)},
+		{"2017-01-01T00:00:00Z", time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, testCase := range testCases {
+		since, err := parseSince(testCase.since, now)
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", testCase.since, err)
+		} else if !since.Equal(testCase.expected) {
+			t.Errorf("%q: expected %s, got %s", testCase.since, testCase.expected, since)
+		}
+	}
+
+	_, err := parseSince("yesterday", now)
+	if err == nil {
+		t.Errorf("expected an error for an invalid since")
+	}
+}
+
+func TestPrinterAlignsNodes(t *testing.T) {
+	var out bytes.Buffer
+	p := newPrinter(&out, []target{{node: "a"}, {node: "node2"}}, false)
+	p.print("a", preparer.LogLine{LaunchableID: "app", EntryPoint: "bin/launch", Line: "hello"})
+	p.print(types.NodeName("node2"), preparer.LogLine{LaunchableID: "app", EntryPoint: "bin/launch", Line: "world"})
+
+	expected := "a     app bin/launch | hello\nnode2 app bin/launch | world\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+type fakePodReader map[types.PodUniqueKey]podstore.Pod
+
+func (f fakePodReader) ReadPod(key types.PodUniqueKey) (podstore.Pod, error) {
+	return f[key], nil
+}
+
+func TestLabeledTargetsKeepUniqueKeys(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	uniqueKey := types.NewPodUUID()
+	pods := fakePodReader{uniqueKey: {Manifest: builder.GetManifest(), Node: "node2"}}
+
+	labeler := labels.NewFakeApplicator()
+	err := labeler.SetLabel(labels.POD, labels.MakePodLabelKey("node1", "web"), "app", "web")
+	if err != nil {
+		t.Fatalf("Could not set label: %s", err)
+	}
+	err = labeler.SetLabel(labels.POD, uniqueKey.String(), "app", "web")
+	if err != nil {
+		t.Fatalf("Could not set label: %s", err)
+	}
+
+	selector := klabels.Everything().Add("app", klabels.EqualsOperator, []string{"web"})
+	targets, err := labeledTargets(labeler, pods, selector)
+	if err != nil {
+		t.Fatalf("Could not find targets: %s", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 targets but got %d", len(targets))
+	}
+	found := make(map[types.NodeName]target)
+	for _, target := range targets {
+		found[target.node] = target
+	}
+	if legacy := found["node1"]; legacy.podID != "web" || legacy.uniqueKey != "" {
+		t.Errorf("wrong target for the legacy pod: %+v", legacy)
+	}
+	if uuidPod := found["node2"]; uuidPod.podID != "web" || uuidPod.uniqueKey != uniqueKey {
+		t.Errorf("wrong target for the pod with a unique key: %+v", uuidPod)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/nodestore"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/size"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	CmdList = "list"
+)
+
+var (
+	cmdList    = kingpin.Command(CmdList, "List nodes known to the node registry or that have published an inventory")
+	listFilter = cmdList.Flag("filter", `Only show nodes matching the filter. Filters have the form <field><op><value>,
+where op is one of =, !=, < or >. < and > compare numerically when possible
+(byte counts like 10G are accepted), and lexically otherwise. Fields are the
+dotted JSON keys shown by --format json, e.g. version, alive, labels.az,
+inventory.config.pod_root, inventory.hooks, inventory.pods.id or
+inventory.free_disk. A field that holds a list matches if any element matches.
+Pass multiple --filter switches to require all of them.
+
+Example:
+    p2-node list --filter inventory.pods.id=my-app --filter inventory.free_disk<10G
+`).Short('f').Strings()
+	listFormat = cmdList.Flag("format", "Output format").Default("table").Enum("table", "json")
+)
+
+// nodeInfo joins a node's registry record with the inventory its preparer
+// publishes to the status store. Either may be missing.
+type nodeInfo struct {
+	Name          types.NodeName      `json:"name"`
+	Registered    bool                `json:"registered"`
+	Alive         bool                `json:"alive"`
+	Version       string              `json:"version,omitempty"`
+	OS            string              `json:"os,omitempty"`
+	OSVersion     string              `json:"os_version,omitempty"`
+	Capacity      *nodestore.Capacity `json:"capacity,omitempty"`
+	Labels        map[string]string   `json:"labels,omitempty"`
+	LastHeartbeat *time.Time          `json:"last_heartbeat,omitempty"`
+	Inventory     *nodestatus.Status  `json:"inventory,omitempty"`
+}
+
+func main() {
+	kingpin.Version(version.VERSION)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+
+	switch cmd {
+	case CmdList:
+		filters := make([]filter, 0, len(*listFilter))
+		for _, f := range *listFilter {
+			parsed, err := parseFilter(f)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			filters = append(filters, parsed)
+		}
+
+		nodes, err := nodestore.NewConsul(client.KV()).List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not list registered nodes: %s\n", err)
+			os.Exit(1)
+		}
+		inventories, err := nodestatus.NewConsul(statusstore.NewConsul(client), consul.PreparerPodStatusNamespace).List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not list node inventories: %s\n", err)
+			os.Exit(1)
+		}
+
+		var matching []nodeInfo
+		for _, info := range joinNodes(nodes, inventories) {
+			ok, err := matchesAll(info, filters)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Could not filter node %s: %s\n", info.Name, err)
+				os.Exit(1)
+			}
+			if ok {
+				matching = append(matching, info)
+			}
+		}
+
+		switch *listFormat {
+		case "json":
+			if matching == nil {
+				matching = []nodeInfo{}
+			}
+			bytes, err := json.MarshalIndent(matching, "", "    ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Could not marshal nodes: %s\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(bytes))
+		case "table":
+			printTable(matching)
+		}
+	}
+}
+
+func joinNodes(nodes []nodestore.Node, inventories map[types.NodeName]nodestatus.Status) []nodeInfo {
+	infos := make(map[types.NodeName]*nodeInfo)
+	for _, node := range nodes {
+		node := node
+		infos[node.Name] = &nodeInfo{
+			Name:          node.Name,
+			Registered:    true,
+			Alive:         node.Alive,
+			Version:       node.Version,
+			OS:            string(node.OS),
+			OSVersion:     string(node.OSVersion),
+			Capacity:      &node.Capacity,
+			Labels:        node.Labels,
+			LastHeartbeat: &node.LastHeartbeat,
+		}
+	}
+	for name, inventory := range inventories {
+		inventory := inventory
+		info, ok := infos[name]
+		if !ok {
+			info = &nodeInfo{Name: name, Version: inventory.Version}
+			infos[name] = info
+		}
+		info.Inventory = &inventory
+	}
+
+	ret := make([]nodeInfo, 0, len(infos))
+	for _, info := range infos {
+		ret = append(ret, *info)
+	}
+	sort.Sort(byName(ret))
+	return ret
+}
+
+type byName []nodeInfo
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Less(i, j int) bool { return b[i].Name < b[j].Name }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+func printTable(nodes []nodeInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tSTATE\tVERSION\tOS\tPODS\tHOOKS\tFREE DISK\tPOD ROOT")
+	for _, node := range nodes {
+		state := "unregistered"
+		if node.Registered {
+			state = "dead"
+			if node.Alive {
+				state = "alive"
+			}
+		}
+		osName := strings.TrimSpace(node.OS + " " + node.OSVersion)
+		pods, hooks, freeDisk, podRoot := "-", "-", "-", "-"
+		if node.Inventory != nil {
+			pods = strconv.Itoa(len(node.Inventory.Pods))
+			hooks = strconv.Itoa(len(node.Inventory.Hooks))
+			freeDisk = node.Inventory.FreeDisk.String()
+			podRoot = node.Inventory.Config.PodRoot
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", node.Name, state, node.Version, osName, pods, hooks, freeDisk, podRoot)
+	}
+	w.Flush()
+}
+
+type filter struct {
+	field string
+	op    string
+	value string
+}
+
+// parseFilter splits a filter like "labels.az=us-west-1a" at the first
+// operator it contains.
+func parseFilter(s string) (filter, error) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '!':
+			if i+1 < len(s) && s[i+1] == '=' {
+				return newFilter(s[:i], "!=", s[i+2:])
+			}
+		case '=', '<', '>':
+			return newFilter(s[:i], s[i:i+1], s[i+1:])
+		}
+	}
+	return filter{}, fmt.Errorf("Filter %q has no operator, expected one of =, !=, < or >", s)
+}
+
+func newFilter(field string, op string, value string) (filter, error) {
+	if field == "" {
+		return filter{}, fmt.Errorf("Filter with operator %s has no field", op)
+	}
+	return filter{field: field, op: op, value: value}, nil
+}
+
+func matchesAll(info nodeInfo, filters []filter) (bool, error) {
+	if len(filters) == 0 {
+		return true, nil
+	}
+
+	bytes, err := json.Marshal(info)
+	if err != nil {
+		return false, err
+	}
+	var generic interface{}
+	err = json.Unmarshal(bytes, &generic)
+	if err != nil {
+		return false, err
+	}
+	fields := make(map[string][]string)
+	flatten("", generic, fields)
+
+	for _, f := range filters {
+		if !f.matches(fields[f.field]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// flatten collects the leaf values of a decoded JSON document by dotted
+// key. Elements of arrays share their parent's key.
+func flatten(prefix string, value interface{}, out map[string][]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flatten(key, child, out)
+		}
+	case []interface{}:
+		for _, child := range v {
+			flatten(prefix, child, out)
+		}
+	case float64:
+		out[prefix] = append(out[prefix], strconv.FormatFloat(v, 'f', -1, 64))
+	case nil:
+	default:
+		out[prefix] = append(out[prefix], fmt.Sprint(v))
+	}
+}
+
+// matches returns true if any of the values satisfies the filter. != is the
+// exception: it requires that none of the values equal the filter's value,
+// so that "pods.id!=foo" means "doesn't run foo".
+func (f filter) matches(values []string) bool {
+	if f.op == "!=" {
+		for _, value := range values {
+			if value == f.value {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, value := range values {
+		switch f.op {
+		case "=":
+			if value == f.value {
+				return true
+			}
+		case "<":
+			if compare(value, f.value) < 0 {
+				return true
+			}
+		case ">":
+			if compare(value, f.value) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compare(value string, target string) int {
+	v, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		t, err := strconv.ParseFloat(target, 64)
+		if err != nil {
+			var byteCount size.ByteCount
+			byteCount, err = size.Parse(target)
+			t = float64(byteCount)
+		}
+		if err == nil {
+			switch {
+			case v < t:
+				return -1
+			case v > t:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	switch {
+	case value < target:
+		return -1
+	case value > target:
+		return 1
+	default:
+		return 0
+	}
+}
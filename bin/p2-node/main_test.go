@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+)
+
+func TestParseFilter(t *testing.T) {
+	testCases := []struct {
+		filter  string
+		field   string
+		op      string
+		value   string
+		invalid bool
+	}{
+		{"labels.az=us-west-1a", "labels.az", "=", "us-west-1a", false},
+		{"version!=1.2.3", "version", "!=", "1.2.3", false},
+		{"inventory.free_disk<10G", "inventory.free_disk", "<", "10G", false},
+		{"capacity.cpus>4", "capacity.cpus", ">", "4", false},
+		{"labels.expr=a=b", "labels.expr", "=", "a=b", false},
+		{"alive", "", "", "", true},
+		{"=foo", "", "", "", true},
+	}
+
+	for i, testCase := range testCases {
+		f, err := parseFilter(testCase.filter)
+		if testCase.invalid {
+			if err == nil {
+				t.Errorf("Test Case: %d, Expected an error parsing %q", i, testCase.filter)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test Case: %d, Unexpected error parsing %q: %s", i, testCase.filter, err)
+			continue
+		}
+		if f.field != testCase.field || f.op != testCase.op || f.value != testCase.value {
+			t.Errorf("Test Case: %d, Expected: %s %s %s, Got: %s %s %s", i, testCase.field, testCase.op, testCase.value, f.field, f.op, f.value)
+		}
+	}
+}
+
+func TestMatchesAll(t *testing.T) {
+	info := nodeInfo{
+		Name:       "node1.example.com",
+		Registered: true,
+		Alive:      true,
+		Version:    "1.2.3",
+		Labels:     map[string]string{"az": "us-west-1a"},
+		Inventory: &nodestatus.Status{
+			Hooks: []string{"hookpod__a"},
+			Pods: []nodestatus.Pod{
+				{ID: "app1", ManifestSHA: "abc"},
+				{ID: "app2", ManifestSHA: "def"},
+			},
+			FreeDisk: 5 * 1024 * 1024 * 1024,
+		},
+	}
+
+	testCases := []struct {
+		filters     []string
+		expectation bool
+	}{
+		{[]string{}, true},
+		{[]string{"alive=true"}, true},
+		{[]string{"labels.az=us-west-1a"}, true},
+		{[]string{"labels.az=us-west-1b"}, false},
+		{[]string{"inventory.pods.id=app2"}, true},
+		{[]string{"inventory.pods.id!=app2"}, false},
+		{[]string{"inventory.pods.id!=app3"}, true},
+		{[]string{"inventory.hooks=hookpod__a"}, true},
+		{[]string{"inventory.free_disk<10G"}, true},
+		{[]string{"inventory.free_disk>10G"}, false},
+		{[]string{"inventory.free_disk>1073741824"}, true},
+		{[]string{"alive=true", "version=1.2.4"}, false},
+		{[]string{"no.such.field=x"}, false},
+	}
+
+	for i, testCase := range testCases {
+		var filters []filter
+		for _, s := range testCase.filters {
+			f, err := parseFilter(s)
+			if err != nil {
+				t.Fatalf("Test Case: %d, Unexpected error parsing %q: %s", i, s, err)
+			}
+			filters = append(filters, f)
+		}
+
+		matches, err := matchesAll(info, filters)
+		if err != nil {
+			t.Fatalf("Test Case: %d, Unexpected error: %s", i, err)
+		}
+		if matches != testCase.expectation {
+			t.Errorf("Test Case: %d, Expected: %v, Got: %v", i, testCase.expectation, matches)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 
@@ -11,6 +13,7 @@ import (
 
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/preparer"
+	netutil "github.com/square/p2/pkg/util/net"
 	"github.com/square/p2/pkg/util/param"
 	"github.com/square/p2/pkg/version"
 	"github.com/square/p2/pkg/watch"
@@ -44,6 +47,22 @@ func main() {
 		defer statusServer.Close()
 	}
 
+	// pod logs and exec are only served over TLS. Exec also requires
+	// knowing who the caller is, from their client certificate
+	var tlsStatusServer *preparer.StatusServer
+	if preparerConfig.StatusTLSPort != 0 {
+		tlsConfig, err := netutil.GetTLSConfig(preparerConfig.CertFile, preparerConfig.KeyFile, preparerConfig.CAFile)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not load the status server's TLS config")
+		}
+		tlsStatusServer, err = preparer.NewTLSStatusServer(preparerConfig.StatusTLSPort, tlsConfig, &logger)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not start TLS status server")
+		}
+		go tlsStatusServer.Serve()
+		defer tlsStatusServer.Close()
+	}
+
 	if preparerConfig.RequireFile != "" {
 		_, err := os.Stat(preparerConfig.RequireFile)
 		if os.IsNotExist(err) {
@@ -66,8 +85,8 @@ func main() {
 		"consul":      preparerConfig.ConsulAddress,
 		"hooks_dir":   preparerConfig.HooksDirectory,
 		"status_port": preparerConfig.StatusPort,
-		"auth_type":   preparerConfig.Auth["type"],
-		"keyring":     preparerConfig.Auth["keyring"],
+		"auth_type":   preparerConfig.Auth.Type,
+		"keyring":     preparerConfig.Auth.KeyringPath,
 		"version":     version.VERSION,
 	}).Infoln("Preparer started successfully")
 
@@ -81,6 +100,44 @@ func main() {
 	}
 	go prep.WatchForPodManifestsForNode(quitMainUpdate)
 
+	quitHeartbeat := make(chan struct{})
+	quitChans = append(quitChans, quitHeartbeat)
+	go prep.HeartbeatNode(quitHeartbeat)
+
+	quitInventory := make(chan struct{})
+	quitChans = append(quitChans, quitInventory)
+	go prep.ReportInventory(quitInventory)
+
+	quitSecrets := make(chan struct{})
+	quitChans = append(quitChans, quitSecrets)
+	go prep.RotateSecrets(quitSecrets)
+
+	// reload the safe subset of the config on SIGHUP or when the file
+	// changes
+	quitConfig := make(chan struct{})
+	quitChans = append(quitChans, quitConfig)
+	go prep.WatchConfig(configPath, quitConfig)
+
+	quitEvents := make(chan struct{})
+	quitChans = append(quitChans, quitEvents)
+	go prep.Events.Run(quitEvents)
+	if statusServer != nil {
+		statusServer.HandleEvents(prep.Events)
+		if prep.HealthHistory != nil {
+			statusServer.HandleHealthHistory(prep.HealthHistory)
+		}
+	}
+	if tlsStatusServer != nil {
+		// pod logs are only served to clients that present the configured
+		// token
+		if preparerConfig.LogsTokenFile != "" {
+			tlsStatusServer.HandleLogs(prep, readToken(logger, preparerConfig.LogsTokenFile))
+		}
+		if len(preparerConfig.ExecUsers) > 0 {
+			tlsStatusServer.HandleExec(prep, prep, preparerConfig.ExecUsers)
+		}
+	}
+
 	if prep.PodProcessReporter != nil {
 		quitPodProcessReporter := make(chan struct{})
 		quitChans = append(quitChans, quitPodProcessReporter)
@@ -90,11 +147,15 @@ func main() {
 	// Launch health checking watch. This watch tracks health of
 	// all pods on this host and writes the information to consul
 	quitMonitorPodHealth := make(chan struct{})
+	var healthRecorder watch.HealthRecorder
+	if prep.HealthHistory != nil {
+		healthRecorder = prep.HealthHistory
+	}
 	var wgHealth sync.WaitGroup
 	wgHealth.Add(1)
 	go func() {
 		defer wgHealth.Done()
-		watch.MonitorPodHealth(preparerConfig, &logger, quitMonitorPodHealth)
+		watch.MonitorPodHealth(preparerConfig, &logger, quitMonitorPodHealth, prep.RunHealthChangeHooks, healthRecorder)
 	}()
 
 	waitForTermination(logger, quitMainUpdate, quitChans)
@@ -107,6 +168,18 @@ func main() {
 	logger.NoFields().Infoln("Terminating")
 }
 
+func readToken(logger logging.Logger, path string) string {
+	tokenBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.WithError(err).Fatalln("Could not read token file")
+	}
+	token := strings.TrimSpace(string(tokenBytes))
+	if token == "" {
+		logger.WithField("path", path).Fatalln("Token file is empty")
+	}
+	return token
+}
+
 func waitForTermination(logger logging.Logger, quitMainUpdate chan struct{}, quitChans []chan struct{}) {
 	signalCh := make(chan os.Signal, 2)
 	signal.Notify(signalCh, syscall.SIGTERM, os.Interrupt)
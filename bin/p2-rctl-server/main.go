@@ -5,6 +5,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -15,6 +17,7 @@ import (
 	klabels "k8s.io/kubernetes/pkg/labels"
 
 	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/configmap"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/rc"
@@ -22,8 +25,10 @@ import (
 	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/configmapstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/nodestore"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/rollstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
@@ -36,6 +41,8 @@ import (
 var (
 	logLevel            = kingpin.Flag("log", "Logging level to display").String()
 	pagerdutyServiceKey = kingpin.Flag("pagerduty-service-key", "Pagerduty Service Key to use for alerting if provided").String()
+	alertingConfig      = kingpin.Flag("alerting-config", "A YAML file describing where to route alerts, see alerting.Config. May not be combined with --pagerduty-service-key").ExistingFile()
+	excludeDeadNodes    = kingpin.Flag("exclude-dead-nodes", "If enabled, nodes whose preparer has stopped heartbeating to the node registry are treated as ineligible, triggering node transfers for dynamic RCs").Bool()
 )
 
 // RetryCount defines the number of retries to attempt when accessing some storage
@@ -80,7 +87,19 @@ func main() {
 
 	rollStore := rollstore.NewConsul(client, labeler, nil)
 	healthChecker := checker.NewConsulHealthChecker(client)
-	sched := scheduler.NewApplicatorScheduler(labeler)
+	var sched scheduler.Scheduler = scheduler.NewApplicatorScheduler(labeler)
+	if *excludeDeadNodes {
+		sched = scheduler.NewLivenessScheduler(sched, nodestore.NewConsul(client.KV()))
+	}
+
+	quitCh := make(chan struct{})
+	go func() {
+		// release locks promptly when stopped
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		close(quitCh)
+	}()
 
 	// Start acquiring sessions
 	sessions := make(chan string)
@@ -89,10 +108,22 @@ func main() {
 		LockDelay: 5 * time.Second,
 		Behavior:  api.SessionBehaviorDelete,
 		TTL:       "15s",
-	}, client, sessions, nil, logger)
+	}, client, sessions, quitCh, logger)
 	pub := stream.NewStringValuePublisher(sessions, "")
 
 	alerter := alerting.NewNop()
+	if *pagerdutyServiceKey != "" && *alertingConfig != "" {
+		logger.NoFields().Fatalln("--pagerduty-service-key and --alerting-config may not be combined")
+	}
+	if *alertingConfig != "" {
+		config, err := alerting.LoadConfig(*alertingConfig)
+		if err == nil {
+			alerter, err = config.Alerter(httpClient)
+		}
+		if err != nil {
+			logger.WithError(err).Fatalln("Unable to initialize alerter")
+		}
+	}
 	if *pagerdutyServiceKey != "" {
 		var err error
 		// just use the same key for high and low urgency
@@ -107,6 +138,21 @@ func main() {
 
 	auditLogStore := auditlogstore.NewConsulStore(client.KV())
 
+	// Keep RCs that follow config maps on their current versions. Only
+	// the instance holding the follower lock does so
+	go configmap.NewFollower(
+		configmapstore.NewConsul(client.KV()),
+		&configmap.RCStores{
+			RCs:     rcStore,
+			Rolls:   rollStore,
+			Labeler: labeler,
+			Txner:   client.KV(),
+		},
+		nil,
+		configmap.DefaultFollowInterval,
+		logger,
+	).RunLocked("replication_controllers", pub.Subscribe().Chan(), consulStore, quitCh)
+
 	// Run the farms!
 	go rc.NewFarm(
 		consulStore,
@@ -125,7 +171,7 @@ func main() {
 		klabels.Everything(),
 		alerter,
 		1*time.Second,
-	).Start(nil)
+	).Start(quitCh)
 	roll.NewFarm(
 		roll.UpdateFactory{
 			Store:         consulStore,
@@ -143,5 +189,5 @@ func main() {
 		client.KV(),
 		roll.FarmConfig{},
 		alerter,
-	).Start(nil)
+	).Start(quitCh)
 }
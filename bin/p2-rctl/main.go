@@ -18,6 +18,7 @@ import (
 
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/cli"
+	"github.com/square/p2/pkg/dryrun"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
@@ -26,6 +27,7 @@ import (
 	"github.com/square/p2/pkg/rc"
 	"github.com/square/p2/pkg/rc/fields"
 	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/render"
 	"github.com/square/p2/pkg/roll"
 	roll_fields "github.com/square/p2/pkg/roll/fields"
 	"github.com/square/p2/pkg/store/consul"
@@ -34,6 +36,7 @@ import (
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/rollstore"
 	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/version"
 )
 
@@ -64,6 +67,7 @@ var (
 	createAvailabilityZone   = cmdCreate.Flag("availability-zone", "availability zone that RC should belong to").Short('a').Required().String()
 	createClusterName        = cmdCreate.Flag("cluster-name", "availability zone that RC should belong to").Short('c').Required().String()
 	createAllocationStrategy = cmdCreate.Flag("allocation-strategy", "determines how RC will allocate new nodes").Short('s').Required().String()
+	createRender             = render.AddFlags(cmdCreate)
 
 	cmdDelete   = kingpin.Command(cmdDeleteText, "Delete a replication controller")
 	deleteID    = cmdDelete.Arg("id", "replication controller uuid to delete").Required().String()
@@ -101,10 +105,13 @@ var (
 	schedupNewID = cmdSchedup.Flag("new", "new replication controller uuid").Required().Short('n').String()
 	schedupWant  = cmdSchedup.Flag("desired", "number of replicas desired").Required().Short('d').Int()
 	schedupNeed  = cmdSchedup.Flag("minimum", "minimum number of healthy replicas during update").Required().Short('m').Int()
+	schedupDry   = dryrun.AddFlags(cmdSchedup)
 
-	cmdUpdateManifest  = kingpin.Command(cmdUpdateManifestText, "DANGEROUS. Forcefully update the manifest for the given RC. Consider disabling the RC before invoking this command.")
+	cmdUpdateManifest  = kingpin.Command(cmdUpdateManifestText, "DANGEROUS. Forcefully update the manifest for the given RC. Consider disabling the RC before invoking this command, and previewing the update with --dry-run.")
 	updateManifestRCID = cmdUpdateManifest.Arg("id", "replication controller uuid to update").Required().String()
 	updateManifestPath = cmdUpdateManifest.Arg("manifest-path", "Path to a signed manifest").Required().String()
+	updateRender       = render.AddFlags(cmdUpdateManifest)
+	updateDry          = dryrun.AddFlags(cmdUpdateManifest)
 
 	cmdUpdateStrategy  = kingpin.Command(cmdUpdateStrategyText, "Forcefully update the allocation strategy in the manifest.")
 	updateStrategyRCID = cmdUpdateStrategy.Flag("id", "replication controller uuid to update").Required().String()
@@ -170,6 +177,7 @@ func main() {
 			*createPodLabels,
 			*createRCLabels,
 			rc_fields.Strategy(*createAllocationStrategy),
+			createRender.Options(),
 		)
 	case cmdDeleteText:
 		rctl.Delete(*deleteID, *deleteForce)
@@ -186,11 +194,11 @@ func main() {
 	case cmdRollText:
 		rctl.RollingUpdate(*rollOldID, *rollNewID, *rollWant, *rollNeed)
 	case cmdSchedupText:
-		rctl.ScheduleUpdate(*schedupOldID, *schedupNewID, *schedupWant, *schedupNeed, client.KV())
+		rctl.ScheduleUpdate(*schedupOldID, *schedupNewID, *schedupWant, *schedupNeed, client.KV(), schedupDry)
 	case cmdDeleteRollText:
 		rctl.DeleteRollingUpdate(*deleteRollID, client.KV())
 	case cmdUpdateManifestText:
-		rctl.UpdateManifest(fields.ID(*updateManifestRCID), *updateManifestPath)
+		rctl.UpdateManifest(fields.ID(*updateManifestRCID), *updateManifestPath, updateRender.Options(), updateDry)
 	case cmdUpdateStrategyText:
 		rctl.UpdateStrategy(fields.ID(*updateStrategyRCID), fields.Strategy(*updateStrategy))
 	}
@@ -229,12 +237,14 @@ type ReplicationControllerStore interface {
 	Delete(id fields.ID, force bool) error
 	Get(id fields.ID) (fields.RC, error)
 	UpdateManifest(id fields.ID, man manifest.Manifest) error
+	UpdateManifestDryRun(id fields.ID, man manifest.Manifest) (fields.RC, fields.RC, error)
 	UpdateStrategy(id fields.ID, strategy fields.Strategy) error
 }
 
 type RollingUpdateStore interface {
 	Delete(ctx context.Context, id roll_fields.ID) error
 	CreateRollingUpdateFromExistingRCs(ctx context.Context, u roll_fields.Update, newRCLabels klabels.Set, rollLabels klabels.Set) (roll_fields.Update, error)
+	CreateRollingUpdateFromExistingRCsDryRun(u roll_fields.Update) (rc_fields.RC, rc_fields.RC, error)
 }
 
 // rctl is a struct for the data structures shared between commands
@@ -262,8 +272,9 @@ func (r rctlParams) Create(
 	podLabels map[string]string,
 	rcLabels map[string]string,
 	allocationStrategy rc_fields.Strategy,
+	renderOpts render.Options,
 ) {
-	manifest, err := manifest.FromPath(manifestPath)
+	manifest, err := render.Load(manifestPath, renderOpts)
 	if err != nil {
 		r.logger.WithErrorAndFields(err, logrus.Fields{
 			"manifest": manifestPath,
@@ -453,17 +464,29 @@ LOOP:
 	}
 }
 
-func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, txner transaction.Txner) {
+func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, txner transaction.Txner, dryRun dryrun.Flags) {
+	update := roll_fields.Update{
+		OldRC:           rc_fields.ID(oldID),
+		NewRC:           rc_fields.ID(newID),
+		DesiredReplicas: want,
+		MinimumReplicas: need,
+	}
+	if dryRun.DryRun() {
+		oldRC, newRC, err := r.rls.CreateRollingUpdateFromExistingRCsDryRun(update)
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Rolling update would not be created")
+		}
+		nodes, err := r.currentNodes(oldRC.ID, newRC.ID)
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not find the nodes of the replication controllers")
+		}
+		r.writeDryRun(oldRC.Manifest, newRC.Manifest, nodes, dryRun)
+		return
+	}
+
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
-	_, err := r.rls.CreateRollingUpdateFromExistingRCs(
-		ctx,
-		roll_fields.Update{
-			OldRC:           rc_fields.ID(oldID),
-			NewRC:           rc_fields.ID(newID),
-			DesiredReplicas: want,
-			MinimumReplicas: need,
-		}, nil, nil)
+	_, err := r.rls.CreateRollingUpdateFromExistingRCs(ctx, update, nil, nil)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Could not create rolling update")
 	}
@@ -476,8 +499,26 @@ func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, txner tr
 	r.logger.WithField("id", newID).Infoln("Created new rolling update")
 }
 
-func (r rctlParams) UpdateManifest(id fields.ID, manifestPath string) {
-	man, err := manifest.FromPath(manifestPath)
+func (r rctlParams) UpdateManifest(id fields.ID, manifestPath string, renderOpts render.Options, dryRun dryrun.Flags) {
+	man, err := render.Load(manifestPath, renderOpts)
+	if err != nil {
+		r.logger.WithErrorAndFields(err, logrus.Fields{
+			"manifest": manifestPath,
+		}).Fatalln("Could not read pod manifest")
+	}
+
+	if dryRun.DryRun() {
+		oldRC, newRC, err := r.rcs.UpdateManifestDryRun(id, man)
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Manifest update would fail")
+		}
+		nodes, err := r.currentNodes(id)
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not find the nodes of the replication controller")
+		}
+		r.writeDryRun(oldRC.Manifest, newRC.Manifest, nodes, dryRun)
+		return
+	}
 
 	err = r.rcs.UpdateManifest(id, man)
 	if err != nil {
@@ -485,6 +526,36 @@ func (r rctlParams) UpdateManifest(id fields.ID, manifestPath string) {
 	}
 }
 
+// currentNodes returns the nodes the pods of the given replication controllers
+// are currently scheduled on
+func (r rctlParams) currentNodes(ids ...fields.ID) ([]types.NodeName, error) {
+	nodes := types.NewNodeSet()
+	for _, id := range ids {
+		pods, err := rc.CurrentPods(id, r.labeler)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range pods.Nodes() {
+			nodes.InsertNode(node)
+		}
+	}
+	return nodes.ListNodes(), nil
+}
+
+func (r rctlParams) writeDryRun(oldManifest manifest.Manifest, newManifest manifest.Manifest, nodes []types.NodeName, dryRun dryrun.Flags) {
+	policy, err := dryRun.Policy()
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not load the deploy policy")
+	}
+	if policy != nil {
+		defer policy.Close()
+	}
+	err = dryrun.NewReport(oldManifest, newManifest, nodes, policy, r.logger).Write(os.Stdout)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not write dry run report")
+	}
+}
+
 func (r rctlParams) UpdateStrategy(id fields.ID, strategy fields.Strategy) {
 	err := r.rcs.UpdateStrategy(id, strategy)
 	if err != nil {
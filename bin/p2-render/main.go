@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/render"
+	"github.com/square/p2/pkg/version"
+)
+
+const helpMessage = `
+p2-render renders a pod manifest out of a base manifest and overlays, e.g. one
+per cluster and one per availability zone, and prints it. The base manifest and
+overlays are templates executed with the variables given by --var. Maps such as
+launchables, env and config are merged key by key, a key set to null in an
+overlay is removed, lists of named items such as secrets are merged by name and
+any other value is replaced.
+
+p2-rctl create and update-manifest and p2-dsctl create and update accept the
+same flags, so a rendered manifest doesn't have to be written out first.
+
+EXAMPLES
+
+$ p2-render app.yaml --overlay clusters/prod.yaml --overlay azs/us-west-2a.yaml --var az=us-west-2a --sign > app-prod-us-west-2a.yaml
+`
+
+var (
+	base = kingpin.Arg("manifest", "The base manifest").Required().ExistingFile()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	kingpin.CommandLine.Help = helpMessage
+	renderFlags := render.AddFlags(kingpin.CommandLine)
+	kingpin.Parse()
+
+	opts := renderFlags.Options()
+	rendered, err := render.Render(*base, opts.Overlays, opts.Vars)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if opts.Sign {
+		rendered, err = render.Sign(rendered, opts.GPGKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	err = rendered.Write(os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
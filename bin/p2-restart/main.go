@@ -7,7 +7,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/square/p2/pkg/pods"
-	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/supervisor"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/version"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -24,9 +24,13 @@ $ p2-restart --pod-dir /custom/pod/home
 
 `)
 
-	nodeName = restart.Flag("node-name", "The name of this node (default: hostname)").String()
-	podDir   = restart.Flag("pod-dir", "The directory where the pod to be restarted is located. ").String()
-	podName  = restart.Arg("pod-name", fmt.Sprintf("The name of the pod to be restarted. Looks in the default pod home '%s' for the pod", pods.DefaultPath)).String()
+	nodeName  = restart.Flag("node-name", "The name of this node (default: hostname)").String()
+	podDir    = restart.Flag("pod-dir", "The directory where the pod to be restarted is located. ").String()
+	superType = restart.Flag("supervisor", "The process supervisor the preparer runs pods under").Default(supervisor.DefaultType).Enum(supervisor.RunitType, supervisor.SystemdType)
+	certFile  = restart.Flag("tls-cert-file", "The preparer's cert_file, presented to pods whose status checks require a client certificate").ExistingFile()
+	keyFile   = restart.Flag("tls-key-file", "The preparer's key_file").ExistingFile()
+	caFile    = restart.Flag("tls-ca-file", "The preparer's ca_file").ExistingFile()
+	podName   = restart.Arg("pod-name", fmt.Sprintf("The name of the pod to be restarted. Looks in the default pod home '%s' for the pod", pods.DefaultPath)).String()
 )
 
 func main() {
@@ -64,6 +68,14 @@ func main() {
 	if err != nil {
 		logger.NoFields().Fatalln(err)
 	}
+	pod.Supervisor, err = supervisor.Config{Type: *superType}.Supervisor()
+	if err != nil {
+		logger.NoFields().Fatalln(err)
+	}
+	pod.StatusClient, err = pods.NewStatusClient(*certFile, *keyFile, *caFile)
+	if err != nil {
+		logger.WithError(err).Fatalln("Could not build the client for the pod's status check")
+	}
 
 	manifest, err := pod.CurrentManifest()
 	if err != nil {
@@ -88,7 +100,7 @@ func main() {
 	}
 
 	for _, service := range services {
-		res, err := runit.DefaultSV.Stat(&service)
+		res, err := pod.Supervisor.Stat(&service)
 		if err != nil {
 			logger.WithErrorAndFields(err, logrus.Fields{"service": service.Name}).Fatalln("Could not stat service")
 		}
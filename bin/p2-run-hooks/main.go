@@ -46,7 +46,9 @@ func main() {
 		auditLogger = al
 	}
 
-	dir := hooks.NewContext(*hookDir, *podRoot, &logging.DefaultLogger, auditLogger)
+	// without access to the label store, hook pod selectors can only match
+	// the pod ID
+	dir := hooks.NewContext(*hookDir, *podRoot, &logging.DefaultLogger, auditLogger, nil)
 
 	hookType, err := hooks.AsHookType(*hookType)
 	if err != nil {
@@ -72,7 +74,7 @@ func main() {
 	}
 
 	log.Printf("About to run %s hooks for pod %s\n", hookType, pod.Home())
-	err = dir.RunHookType(hookType, pod, podManifest)
+	_, err = dir.RunHookType(hookType, pod, podManifest)
 	if err != nil {
 		log.Fatalln(err)
 	}
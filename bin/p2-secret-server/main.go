@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/secrets"
+	"github.com/square/p2/pkg/version"
+)
+
+const helpMessage = `
+p2-secret-server stands in for a secret service, e.g. on a development machine
+or in tests. It serves the secrets of an encrypted secrets directory, as read
+by the preparer's file secrets provider, to preparers configured with the http
+secrets provider.
+
+EXAMPLES
+
+$ p2-secret-server --directory /etc/p2/secrets --keyring /etc/p2/secrets.keyring --token-file token --address :8443
+
+with a preparer configured with
+
+preparer:
+  secrets:
+    provider: http
+    url: http://localhost:8443
+    token_file: token
+`
+
+var (
+	directory = kingpin.Flag("directory", "The directory of encrypted secrets to serve").Required().ExistingDir()
+	keyring   = kingpin.Flag("keyring", "The keyring holding the key the secrets are encrypted to").Required().ExistingFile()
+	tokenFile = kingpin.Flag("token-file", "A file containing the token clients must present. Secrets are served to anyone if omitted").ExistingFile()
+	address   = kingpin.Flag("address", "The address to listen on").Default("localhost:8443").String()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	kingpin.CommandLine.Help = helpMessage
+	kingpin.Parse()
+	logger := logging.DefaultLogger
+
+	provider, err := secrets.NewFileProvider(*directory, *keyring)
+	if err != nil {
+		logger.WithError(err).Fatalln("Could not read secrets")
+	}
+
+	var token string
+	if *tokenFile != "" {
+		tokenBytes, err := ioutil.ReadFile(*tokenFile)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not read token file")
+		}
+		token = strings.TrimSpace(string(tokenBytes))
+	} else {
+		logger.NoFields().Warnln("No token file given, secrets will be served to anyone")
+	}
+
+	logger.WithField("address", *address).Infoln("Serving secrets")
+	err = http.ListenAndServe(*address, secrets.Handler(provider, token))
+	if err != nil {
+		logger.WithError(err).Fatalln("Secret server crashed")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/supervisor"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 )
@@ -20,6 +21,10 @@ const helpMessage = `
 p2-shutdown is a command that is useful to gracefully shutdown pods on a host
 before doing maintenance. Ideally, these pods would be relocated to a different
 host but we live in a world where hosts are pets.
+
+Each pod is stopped according to the shutdown stanzas of its launchables: their
+pre-stop hooks are run, the pod is given time to drain, and then its processes
+are sent their stop signal and given their grace period to exit.
 `
 
 var (
@@ -28,6 +33,10 @@ var (
 	shutdownPods = kingpin.Flag("pods", "The list of pods to shutdown. Leave empty for all").Short('p').Strings()
 	excludePods  = kingpin.Flag("exclude-pods", "The list of pods to exclude from shutdown.").Short('e').Strings()
 	podRoot      = kingpin.Flag("pod-root", "The base directory for pods").Default(pods.DefaultPath).String()
+	superType    = kingpin.Flag("supervisor", "The process supervisor the preparer runs pods under").Default(supervisor.DefaultType).Enum(supervisor.RunitType, supervisor.SystemdType)
+	certFile     = kingpin.Flag("tls-cert-file", "The preparer's cert_file, presented to pods whose status checks require a client certificate").ExistingFile()
+	keyFile      = kingpin.Flag("tls-key-file", "The preparer's key_file").ExistingFile()
+	caFile       = kingpin.Flag("tls-ca-file", "The preparer's ca_file").ExistingFile()
 )
 
 func main() {
@@ -40,6 +49,15 @@ func main() {
 	}
 
 	node := types.NodeName(hostname)
+	podSupervisor, err := supervisor.Config{Type: *superType}.Supervisor()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	statusClient, err := pods.NewStatusClient(*certFile, *keyFile, *caFile)
+	if err != nil {
+		log.Fatalf("could not build the client for pods' status checks: %v", err)
+	}
+
 	consulStore := consul.NewConsulStore(client)
 	reality, _, err := consulStore.ListPods(consul.REALITY_TREE, node)
 	if err != nil {
@@ -61,6 +79,8 @@ func main() {
 	var haltWG sync.WaitGroup
 	for _, realityEntry := range reality {
 		pod := podFactory.NewLegacyPod(realityEntry.Manifest.ID())
+		pod.Supervisor = podSupervisor
+		pod.StatusClient = statusClient
 		if !shouldShutdownPod(pod.Id, podsToShutdown, podsToExclude) {
 			log.Printf("pod %s not in set of pods to shutdown, skipping", pod.Id)
 			continue
@@ -31,7 +31,7 @@ var (
 	watchReality  = kingpin.Flag("reality", "Watch the reality store instead of the intent store. False by default").Default("false").Bool()
 	hooks         = kingpin.Flag("hook", "Watch hooks.").Bool()
 	podClusters   = kingpin.Flag("pod-clusters", "Watch pod clusters and their labeled pods").Bool()
-	watchHealthF  = kingpin.Flag("health", "Watch health using ConsulHealthChecker").Bool()
+	watchHealthF  = kingpin.Flag("health", "Watch health using ConsulHealthChecker. A node's health is only written when its status changes, so the HTTP status, latency, error and output shown are those of the check that last changed it and may be stale").Bool()
 	healthService = kingpin.Arg("health-pod", "Pod to watch. Required if --health is passed").String()
 )
 
@@ -162,7 +162,7 @@ func watchHealth(service string, client consulutil.ConsulClient) {
 			}
 			sort.Sort(sortedHealthResults)
 			for _, r := range sortedHealthResults {
-				fmt.Printf("%s %s\n", r.Node.String(), r.Status)
+				fmt.Println(formatHealthResult(r))
 			}
 			fmt.Printf("\n")
 		case err := <-errCh:
@@ -175,6 +175,26 @@ func watchHealth(service string, client consulutil.ConsulClient) {
 	}
 }
 
+// formatHealthResult prints a node's health followed by the details of the
+// check that produced it, if it has any. That is the check that last changed
+// the node's status, not necessarily the latest one
+func formatHealthResult(r health.Result) string {
+	line := fmt.Sprintf("%s %s", r.Node.String(), r.Status)
+	if r.HTTPStatus != 0 {
+		line += fmt.Sprintf(" http=%d", r.HTTPStatus)
+	}
+	if r.Latency != 0 {
+		line += fmt.Sprintf(" latency=%s", r.Latency)
+	}
+	if r.Error != "" {
+		line += fmt.Sprintf(" error=%q", r.Error)
+	}
+	if r.Output != "" {
+		line += fmt.Sprintf(" output=%q", r.Output)
+	}
+	return line
+}
+
 type nodeHealthResults []health.Result
 
 func (hrs nodeHealthResults) Len() int {
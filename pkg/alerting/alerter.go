@@ -2,21 +2,35 @@ package alerting
 
 import (
 	"net/http"
+	"net/smtp"
+	"text/template"
 
 	"github.com/square/p2/pkg/util"
 )
 
-// Currently the Alerter interface only has a single implementation for PagerDuty. As a result,
-// AlertInfo has information that PagerDuty needs, and other integrations may not. As a result,
-// some information here may be ignored in future implementations.
+// AlertInfo describes an alert. It was modeled on what PagerDuty needs, so
+// some integrations may ignore some of its information.
 type AlertInfo struct {
 	Description string
 	// Used to dedup alerts so multiple alerts don't occur from the same problem
 	IncidentKey string
 	// Arbitrary JSON for alert triage
 	Details interface{}
+	// The labels of the RC, daemon set or pod cluster the alert is about,
+	// used to route it. See PodIDLabel and ComponentLabel
+	Labels map[string]string
 }
 
+const (
+	// PodIDLabel is set in AlertInfo.Labels to the ID of the pod an alert
+	// is about, if there is one
+	PodIDLabel = "pod_id"
+
+	// ComponentLabel is set in AlertInfo.Labels to the farm that raised an
+	// alert, e.g. "rc_farm"
+	ComponentLabel = "component"
+)
+
 type Alerter interface {
 	Alert(alertInfo AlertInfo, urgency Urgency) error
 }
@@ -44,3 +58,68 @@ func NewPagerduty(highUrgencyServiceKey string, lowUrgencyServiceKey string, cli
 func NewNop() Alerter {
 	return &nopAlerter{}
 }
+
+// NewWebhook returns an Alerter that posts alerts to a URL. The body is
+// rendered from bodyTemplate, a text/template executed with a WebhookData,
+// and must be JSON. The template's "json" function encodes a value as JSON.
+// If bodyTemplate is empty, DefaultWebhookTemplate is used.
+func NewWebhook(url string, bodyTemplate string, client Poster) (Alerter, error) {
+	if url == "" {
+		return nil, util.Errorf("a URL must be provided for webhook alerters")
+	}
+
+	if bodyTemplate == "" {
+		bodyTemplate = DefaultWebhookTemplate
+	}
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{"json": toJSON}).Parse(bodyTemplate)
+	if err != nil {
+		return nil, util.Errorf("invalid webhook body template: %s", err)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &webhookAlerter{
+		URL:      url,
+		Template: tmpl,
+		Client:   client,
+	}, nil
+}
+
+// NewSlack returns an Alerter that posts alerts to a Slack-compatible
+// incoming webhook.
+func NewSlack(webhookURL string, client Poster) (Alerter, error) {
+	if webhookURL == "" {
+		return nil, util.Errorf("a webhook URL must be provided for slack alerters")
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &slackAlerter{
+		WebhookURL: webhookURL,
+		Client:     client,
+	}, nil
+}
+
+// NewSMTP returns an Alerter that emails alerts.
+func NewSMTP(config SMTPConfig) (Alerter, error) {
+	if config.Addr == "" {
+		return nil, util.Errorf("a server address must be provided for smtp alerters")
+	}
+
+	if config.From == "" {
+		return nil, util.Errorf("a from address must be provided for smtp alerters")
+	}
+
+	if len(config.To) == 0 {
+		return nil, util.Errorf("at least one recipient must be provided for smtp alerters")
+	}
+
+	return &smtpAlerter{
+		Config:   config,
+		SendMail: smtp.SendMail,
+	}, nil
+}
@@ -0,0 +1,189 @@
+package alerting
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// The destination types of a DestinationConfig
+const (
+	PagerdutyType = "pagerduty"
+	WebhookType   = "webhook"
+	SlackType     = "slack"
+	SMTPType      = "smtp"
+)
+
+// Config describes where alerts are sent. For example:
+//
+//	destinations:
+//	  oncall:
+//	    type: pagerduty
+//	    high_urgency_service_key: abc
+//	    low_urgency_service_key: def
+//	  web-team:
+//	    type: slack
+//	    url: https://hooks.slack.com/services/...
+//	routes:
+//	- urgency: high_urgency
+//	  destinations: [oncall]
+//	- selector: pod_id=web
+//	  destinations: [web-team]
+//	default: [oncall]
+//	dedup_window: 10m
+type Config struct {
+	// The named places alerts can be sent
+	Destinations map[string]DestinationConfig `yaml:"destinations"`
+	// Every matching route's destinations receive an alert
+	Routes []RouteConfig `yaml:"routes,omitempty"`
+	// The destinations of alerts that match no route
+	Default []string `yaml:"default,omitempty"`
+	// Alerts of an incident are sent at most once per window, if set
+	DedupWindow time.Duration `yaml:"dedup_window,omitempty"`
+	// Incidents whose alerts are dropped for a while
+	Silences []SilenceConfig `yaml:"silences,omitempty"`
+}
+
+// DestinationConfig configures one alerter. Type is one of the *Type
+// constants, and only the fields of that type are used.
+type DestinationConfig struct {
+	Type string `yaml:"type"`
+
+	// pagerduty
+	HighUrgencyServiceKey string `yaml:"high_urgency_service_key,omitempty"`
+	LowUrgencyServiceKey  string `yaml:"low_urgency_service_key,omitempty"`
+
+	// webhook and slack
+	URL string `yaml:"url,omitempty"`
+	// webhook, see NewWebhook()
+	BodyTemplate string `yaml:"body_template,omitempty"`
+
+	// smtp
+	SMTPConfig `yaml:",inline"`
+}
+
+type RouteConfig struct {
+	// Only alerts of this urgency are routed, if set
+	Urgency Urgency `yaml:"urgency,omitempty"`
+	// Only alerts whose labels match this selector are routed, if set
+	Selector     string   `yaml:"selector,omitempty"`
+	Destinations []string `yaml:"destinations"`
+}
+
+type SilenceConfig struct {
+	IncidentKey string    `yaml:"incident_key"`
+	Until       time.Time `yaml:"until"`
+}
+
+// LoadConfig reads an alerting configuration from a YAML file.
+func LoadConfig(path string) (Config, error) {
+	configBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, util.Errorf("Could not read alerting config: %s", err)
+	}
+
+	var config Config
+	err = yaml.Unmarshal(configBytes, &config)
+	if err != nil {
+		return Config{}, util.Errorf("Could not parse alerting config %s: %s", path, err)
+	}
+	return config, nil
+}
+
+// Alerter builds the Alerter the configuration describes. client is used by
+// the destinations that make HTTP requests.
+func (c Config) Alerter(client *http.Client) (Alerter, error) {
+	// sorted so that errors are deterministic
+	names := make([]string, 0, len(c.Destinations))
+	for name := range c.Destinations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	destinations := make(map[string]Alerter)
+	for _, name := range names {
+		alerter, err := c.Destinations[name].alerter(client)
+		if err != nil {
+			return nil, util.Errorf("destination %s: %s", name, err)
+		}
+		destinations[name] = alerter
+	}
+
+	lookup := func(names []string) ([]Alerter, error) {
+		alerters := make([]Alerter, 0, len(names))
+		for _, name := range names {
+			alerter, ok := destinations[name]
+			if !ok {
+				return nil, util.Errorf("unknown destination %s", name)
+			}
+			alerters = append(alerters, alerter)
+		}
+		return alerters, nil
+	}
+
+	routes := make([]Route, 0, len(c.Routes))
+	for i, routeConfig := range c.Routes {
+		switch routeConfig.Urgency {
+		case "", HighUrgency, LowUrgency:
+		default:
+			return nil, util.Errorf("route %d: unknown urgency %s", i+1, routeConfig.Urgency)
+		}
+		route := Route{Urgency: routeConfig.Urgency}
+		if routeConfig.Selector != "" {
+			selector, err := klabels.Parse(routeConfig.Selector)
+			if err != nil {
+				return nil, util.Errorf("route %d: invalid selector %q: %s", i+1, routeConfig.Selector, err)
+			}
+			route.Selector = selector
+		}
+		alerters, err := lookup(routeConfig.Destinations)
+		if err != nil {
+			return nil, util.Errorf("route %d: %s", i+1, err)
+		}
+		route.Alerters = alerters
+		routes = append(routes, route)
+	}
+
+	fallback, err := lookup(c.Default)
+	if err != nil {
+		return nil, util.Errorf("default: %s", err)
+	}
+
+	alerter := NewRouter(routes, fallback...)
+	if c.DedupWindow <= 0 && len(c.Silences) == 0 {
+		return alerter, nil
+	}
+	deduper := NewDeduper(alerter, c.DedupWindow)
+	for _, silence := range c.Silences {
+		deduper.Silence(silence.IncidentKey, silence.Until)
+	}
+	return deduper, nil
+}
+
+func (d DestinationConfig) alerter(client *http.Client) (Alerter, error) {
+	switch d.Type {
+	case PagerdutyType:
+		return NewPagerduty(d.HighUrgencyServiceKey, d.LowUrgencyServiceKey, client)
+	case WebhookType:
+		return NewWebhook(d.URL, d.BodyTemplate, posterOrNil(client))
+	case SlackType:
+		return NewSlack(d.URL, posterOrNil(client))
+	case SMTPType:
+		return NewSMTP(d.SMTPConfig)
+	}
+	return nil, util.Errorf("unknown destination type %q", d.Type)
+}
+
+// posterOrNil avoids passing a nil *http.Client as a non-nil Poster
+func posterOrNil(client *http.Client) Poster {
+	if client == nil {
+		return nil
+	}
+	return client
+}
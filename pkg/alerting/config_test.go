@@ -0,0 +1,109 @@
+package alerting
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, dir string, config string) string {
+	path := filepath.Join(dir, "alerting.yaml")
+	err := ioutil.WriteFile(path, []byte(config), 0644)
+	if err != nil {
+		t.Fatalf("Could not write config: %s", err)
+	}
+	return path
+}
+
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alerting_config")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	oncall := newStandIn(t, http.StatusOK)
+	defer oncall.server.Close()
+	webTeam := newStandIn(t, http.StatusOK)
+	defer webTeam.server.Close()
+
+	path := writeConfig(t, dir, fmt.Sprintf(`
+destinations:
+  oncall:
+    type: webhook
+    url: %s
+  web-team:
+    type: slack
+    url: %s
+  email:
+    type: smtp
+    addr: localhost:25
+    from: p2@example.com
+    to: [team@example.com]
+routes:
+- urgency: high_urgency
+  destinations: [oncall]
+- selector: pod_id=web
+  destinations: [web-team]
+default: [oncall]
+dedup_window: 10m
+silences:
+- incident_key: silenced
+  until: %s
+`, oncall.server.URL, webTeam.server.URL, time.Now().Add(time.Hour).Format(time.RFC3339)))
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading config: %s", err)
+	}
+	if config.DedupWindow != 10*time.Minute {
+		t.Errorf("Expected a 10m dedup window, got %s", config.DedupWindow)
+	}
+	if config.Destinations["email"].To[0] != "team@example.com" {
+		t.Errorf("Expected the smtp config to be read, got %+v", config.Destinations["email"])
+	}
+
+	alerter, err := config.Alerter(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error building alerter: %s", err)
+	}
+
+	for _, alertInfo := range []AlertInfo{
+		{Description: "web", IncidentKey: "web", Labels: map[string]string{PodIDLabel: "web"}},
+		{Description: "web again", IncidentKey: "web", Labels: map[string]string{PodIDLabel: "web"}},
+		{Description: "db", IncidentKey: "db", Labels: map[string]string{PodIDLabel: "db"}},
+		{Description: "silenced", IncidentKey: "silenced"},
+	} {
+		err = alerter.Alert(alertInfo, LowUrgency)
+		if err != nil {
+			t.Fatalf("Unexpected error alerting: %s", err)
+		}
+	}
+
+	if len(webTeam.bodies) != 1 {
+		t.Errorf("Expected the web alert to be routed to the web team once, got %d", len(webTeam.bodies))
+	}
+	if len(oncall.bodies) != 1 {
+		t.Errorf("Expected only the db alert to fall back to oncall, got %d", len(oncall.bodies))
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, config := range []Config{
+		{Destinations: map[string]DestinationConfig{"x": {Type: "carrier_pigeon"}}},
+		{Destinations: map[string]DestinationConfig{"x": {Type: SlackType}}},
+		{Routes: []RouteConfig{{Destinations: []string{"missing"}}}},
+		{Routes: []RouteConfig{{Selector: "=", Destinations: nil}}},
+		{Routes: []RouteConfig{{Urgency: "medium"}}},
+		{Default: []string{"missing"}},
+	} {
+		_, err := config.Alerter(nil)
+		if err == nil {
+			t.Errorf("Expected an error building %+v", config)
+		}
+	}
+}
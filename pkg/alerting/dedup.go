@@ -0,0 +1,84 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+)
+
+// Deduper wraps an Alerter, dropping alerts whose IncidentKey was alerted on
+// within a window, or that were silenced. It is safe for concurrent use.
+type Deduper struct {
+	alerter Alerter
+	window  time.Duration
+
+	mu sync.Mutex
+	// When each incident was last delivered
+	lastSent map[string]time.Time
+	// When the silence of each incident ends
+	silences map[string]time.Time
+
+	// time.Now, replaced in tests
+	now func() time.Time
+}
+
+var _ Alerter = &Deduper{}
+
+// NewDeduper returns a Deduper that delivers at most one alert per incident
+// key every window. Failed deliveries don't count.
+func NewDeduper(alerter Alerter, window time.Duration) *Deduper {
+	return &Deduper{
+		alerter:  alerter,
+		window:   window,
+		lastSent: make(map[string]time.Time),
+		silences: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Silence drops the alerts of an incident until the passed time.
+func (d *Deduper) Silence(incidentKey string, until time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.silences[incidentKey] = until
+}
+
+func (d *Deduper) Alert(alertInfo AlertInfo, urgency Urgency) error {
+	if !d.shouldSend(alertInfo.IncidentKey) {
+		return nil
+	}
+
+	err := d.alerter.Alert(alertInfo, urgency)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastSent[alertInfo.IncidentKey] = d.now()
+	return nil
+}
+
+// shouldSend returns whether an incident is neither silenced nor alerted on
+// within the window, forgetting the silences and deliveries that ended
+func (d *Deduper) shouldSend(incidentKey string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for key, until := range d.silences {
+		if !now.Before(until) {
+			delete(d.silences, key)
+		}
+	}
+	for key, sent := range d.lastSent {
+		if now.Sub(sent) >= d.window {
+			delete(d.lastSent, key)
+		}
+	}
+
+	if _, ok := d.silences[incidentKey]; ok {
+		return false
+	}
+	_, ok := d.lastSent[incidentKey]
+	return !ok
+}
@@ -0,0 +1,68 @@
+package alerting
+
+import (
+	"strings"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// Route sends the alerts it matches to its alerters
+type Route struct {
+	// Only alerts of this urgency are matched. All urgencies are matched if
+	// empty
+	Urgency Urgency
+	// Only alerts whose labels match are matched. All alerts are matched if
+	// nil
+	Selector klabels.Selector
+	Alerters []Alerter
+}
+
+func (r Route) matches(alertInfo AlertInfo, urgency Urgency) bool {
+	if r.Urgency != "" && r.Urgency != urgency {
+		return false
+	}
+	return r.Selector == nil || r.Selector.Matches(klabels.Set(alertInfo.Labels))
+}
+
+type routingAlerter struct {
+	Routes   []Route
+	Fallback []Alerter
+}
+
+var _ Alerter = &routingAlerter{}
+
+// NewRouter returns an Alerter that sends each alert to the alerters of every
+// route that matches it, or to the fallback alerters if none does.
+func NewRouter(routes []Route, fallback ...Alerter) Alerter {
+	return &routingAlerter{
+		Routes:   routes,
+		Fallback: fallback,
+	}
+}
+
+// Alert sends the alert to every matching alerter, even if some fail. The
+// errors of those that failed are combined.
+func (r *routingAlerter) Alert(alertInfo AlertInfo, urgency Urgency) error {
+	var alerters []Alerter
+	for _, route := range r.Routes {
+		if route.matches(alertInfo, urgency) {
+			alerters = append(alerters, route.Alerters...)
+		}
+	}
+	if len(alerters) == 0 {
+		alerters = r.Fallback
+	}
+
+	var errs []string
+	for _, alerter := range alerters {
+		if err := alerter.Alert(alertInfo, urgency); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return util.Errorf("%d of %d alerters failed to deliver alert %s: %s", len(errs), len(alerters), alertInfo.IncidentKey, strings.Join(errs, "; "))
+	}
+	return nil
+}
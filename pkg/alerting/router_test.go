@@ -0,0 +1,123 @@
+package alerting
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+type fakeAlerter struct {
+	alerts []AlertInfo
+	err    error
+}
+
+func (f *fakeAlerter) Alert(alertInfo AlertInfo, urgency Urgency) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.alerts = append(f.alerts, alertInfo)
+	return nil
+}
+
+func TestRouter(t *testing.T) {
+	oncall := &fakeAlerter{}
+	webTeam := &fakeAlerter{}
+	fallback := &fakeAlerter{}
+	webSelector, _ := klabels.Parse("pod_id=web")
+	router := NewRouter([]Route{
+		{Urgency: HighUrgency, Alerters: []Alerter{oncall}},
+		{Selector: webSelector, Alerters: []Alerter{webTeam}},
+	}, fallback)
+
+	web := AlertInfo{IncidentKey: "web", Labels: map[string]string{PodIDLabel: "web"}}
+	db := AlertInfo{IncidentKey: "db", Labels: map[string]string{PodIDLabel: "db"}}
+	for _, alert := range []struct {
+		info    AlertInfo
+		urgency Urgency
+	}{
+		{web, HighUrgency},
+		{web, LowUrgency},
+		{db, HighUrgency},
+		{db, LowUrgency},
+	} {
+		err := router.Alert(alert.info, alert.urgency)
+		if err != nil {
+			t.Fatalf("Unexpected error routing alert: %s", err)
+		}
+	}
+
+	if len(oncall.alerts) != 2 {
+		t.Errorf("Expected both high urgency alerts to be routed to oncall, got %d", len(oncall.alerts))
+	}
+	if len(webTeam.alerts) != 2 || webTeam.alerts[0].IncidentKey != "web" || webTeam.alerts[1].IncidentKey != "web" {
+		t.Errorf("Expected both web alerts to be routed to the web team, got %v", webTeam.alerts)
+	}
+	if len(fallback.alerts) != 1 || fallback.alerts[0].IncidentKey != "db" {
+		t.Errorf("Expected only the low urgency db alert to fall back, got %v", fallback.alerts)
+	}
+}
+
+func TestRouterDeliversDespiteFailures(t *testing.T) {
+	failing := &fakeAlerter{err: fmt.Errorf("unreachable")}
+	working := &fakeAlerter{}
+	router := NewRouter([]Route{{Alerters: []Alerter{failing, working}}})
+
+	err := router.Alert(AlertInfo{IncidentKey: "key"}, LowUrgency)
+	if err == nil {
+		t.Errorf("Expected the failure to be returned")
+	}
+	if len(working.alerts) != 1 {
+		t.Errorf("Expected the alert to be delivered by the working alerter")
+	}
+}
+
+func TestDeduper(t *testing.T) {
+	alerter := &fakeAlerter{}
+	deduper := NewDeduper(alerter, 10*time.Minute)
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	deduper.now = func() time.Time { return now }
+
+	alert := func(key string) {
+		err := deduper.Alert(AlertInfo{IncidentKey: key}, LowUrgency)
+		if err != nil {
+			t.Fatalf("Unexpected error alerting: %s", err)
+		}
+	}
+
+	alert("a")
+	alert("a")
+	alert("b")
+	if len(alerter.alerts) != 2 {
+		t.Fatalf("Expected the repeated alert to be dropped, got %v", alerter.alerts)
+	}
+
+	now = now.Add(10 * time.Minute)
+	alert("a")
+	if len(alerter.alerts) != 3 {
+		t.Fatalf("Expected the alert to be delivered after the window, got %v", alerter.alerts)
+	}
+
+	deduper.Silence("c", now.Add(time.Hour))
+	alert("c")
+	if len(alerter.alerts) != 3 {
+		t.Fatalf("Expected the silenced alert to be dropped, got %v", alerter.alerts)
+	}
+	now = now.Add(time.Hour)
+	alert("c")
+	if len(alerter.alerts) != 4 {
+		t.Fatalf("Expected the alert to be delivered after the silence, got %v", alerter.alerts)
+	}
+
+	alerter.err = fmt.Errorf("unreachable")
+	err := deduper.Alert(AlertInfo{IncidentKey: "d"}, LowUrgency)
+	if err == nil {
+		t.Fatalf("Expected the delivery failure to be returned")
+	}
+	alerter.err = nil
+	alert("d")
+	if len(alerter.alerts) != 5 {
+		t.Fatalf("Expected a failed delivery not to count, got %v", alerter.alerts)
+	}
+}
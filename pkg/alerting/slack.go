@@ -0,0 +1,72 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/square/p2/pkg/util"
+)
+
+type slackAlerter struct {
+	Client     Poster
+	WebhookURL string
+}
+
+var _ Alerter = &slackAlerter{}
+
+// The subset of the incoming webhook message format that is used
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func (s *slackAlerter) Alert(alertInfo AlertInfo, urgency Urgency) error {
+	text, err := slackText(alertInfo, urgency)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(slackMessage{Text: text})
+	if err != nil {
+		return util.Errorf("Unable to marshal alert as JSON: %s", err)
+	}
+
+	return postJSON(s.Client, s.WebhookURL, body, "slack")
+}
+
+// slackText formats an alert as a message, with its details as a code block
+func slackText(alertInfo AlertInfo, urgency Urgency) (string, error) {
+	lines := []string{
+		fmt.Sprintf("*[%s]* %s", urgencyName(urgency), alertInfo.Description),
+		fmt.Sprintf("Incident: `%s`", alertInfo.IncidentKey),
+	}
+
+	if len(alertInfo.Labels) > 0 {
+		lines = append(lines, "Labels: "+formatLabels(alertInfo.Labels))
+	}
+
+	if alertInfo.Details != nil {
+		details, err := json.MarshalIndent(alertInfo.Details, "", "  ")
+		if err != nil {
+			return "", util.Errorf("Unable to marshal alert details as JSON: %s", err)
+		}
+		lines = append(lines, "```"+string(details)+"```")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// urgencyName returns a readable name for an urgency, e.g. "high urgency"
+func urgencyName(urgency Urgency) string {
+	return strings.Replace(string(urgency), "_", " ", -1)
+}
+
+// formatLabels lists labels as key=value pairs ordered by key
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
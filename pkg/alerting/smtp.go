@@ -0,0 +1,83 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// SMTPConfig configures how alerts are emailed
+type SMTPConfig struct {
+	// The host:port of the SMTP server
+	Addr string   `yaml:"addr"`
+	From string   `yaml:"from"`
+	To   []string `yaml:"to"`
+
+	// If set, the server is authenticated to with PLAIN auth
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+type smtpAlerter struct {
+	Config SMTPConfig
+
+	// smtp.SendMail, replaced in tests
+	SendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+var _ Alerter = &smtpAlerter{}
+
+func (s *smtpAlerter) Alert(alertInfo AlertInfo, urgency Urgency) error {
+	msg, err := s.message(alertInfo, urgency)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Config.Username != "" {
+		host, _, err := net.SplitHostPort(s.Config.Addr)
+		if err != nil {
+			return util.Errorf("Invalid smtp server address %s: %s", s.Config.Addr, err)
+		}
+		auth = smtp.PlainAuth("", s.Config.Username, s.Config.Password, host)
+	}
+
+	err = s.SendMail(s.Config.Addr, auth, s.Config.From, s.Config.To, msg)
+	if err != nil {
+		return util.Errorf("Unable to email alert %s: %s", alertInfo.IncidentKey, err)
+	}
+	return nil
+}
+
+// message formats an alert as a plain text email
+func (s *smtpAlerter) message(alertInfo AlertInfo, urgency Urgency) ([]byte, error) {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.Config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.Config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [p2 %s] %s\r\n", urgencyName(urgency), oneLine(alertInfo.Description))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\n", alertInfo.Description)
+	fmt.Fprintf(&msg, "Incident: %s\r\n", alertInfo.IncidentKey)
+	if len(alertInfo.Labels) > 0 {
+		fmt.Fprintf(&msg, "Labels: %s\r\n", formatLabels(alertInfo.Labels))
+	}
+	if alertInfo.Details != nil {
+		details, err := json.MarshalIndent(alertInfo.Details, "", "  ")
+		if err != nil {
+			return nil, util.Errorf("Unable to marshal alert details as JSON: %s", err)
+		}
+		fmt.Fprintf(&msg, "\r\n%s\r\n", strings.Replace(string(details), "\n", "\r\n", -1))
+	}
+	return msg.Bytes(), nil
+}
+
+// oneLine keeps headers from being broken by descriptions with newlines
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,56 @@
+package alerting
+
+import (
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestSMTP(t *testing.T) {
+	_, err := NewSMTP(SMTPConfig{Addr: "localhost:25", From: "p2@example.com"})
+	if err == nil {
+		t.Errorf("Expected an error creating an smtp alerter without recipients")
+	}
+
+	alerter, err := NewSMTP(SMTPConfig{
+		Addr:     "mail.example.com:587",
+		From:     "p2@example.com",
+		To:       []string{"oncall@example.com", "team@example.com"},
+		Username: "p2",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating smtp alerter: %s", err)
+	}
+
+	var sentAddr string
+	var sentAuth smtp.Auth
+	var sentTo []string
+	var sentMsg string
+	alerter.(*smtpAlerter).SendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sentAddr, sentAuth, sentTo, sentMsg = addr, a, to, string(msg)
+		return nil
+	}
+
+	alertInfo := testAlertInfo()
+	alertInfo.Description = "a fake error\nhappened"
+	err = alerter.Alert(alertInfo, LowUrgency)
+	if err != nil {
+		t.Fatalf("Unexpected error sending alert: %s", err)
+	}
+
+	if sentAddr != "mail.example.com:587" || sentAuth == nil || len(sentTo) != 2 {
+		t.Errorf("Unexpected delivery to %s with auth %v to %v", sentAddr, sentAuth, sentTo)
+	}
+	for _, expected := range []string{
+		"To: oncall@example.com, team@example.com\r\n",
+		"Subject: [p2 low urgency] a fake error happened\r\n",
+		"Incident: incident_key\r\n",
+		"Labels: pod_id=web\r\n",
+		`"host": "host.com"`,
+	} {
+		if !strings.Contains(sentMsg, expected) {
+			t.Errorf("Expected %q in the message:\n%s", expected, sentMsg)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"text/template"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultWebhookTemplate renders every field of the alert as a JSON object
+const DefaultWebhookTemplate = `{"description": {{json .Description}}, "incident_key": {{json .IncidentKey}}, "urgency": {{json .Urgency}}, "labels": {{json .Labels}}, "details": {{json .Details}}}`
+
+type webhookAlerter struct {
+	Client   Poster
+	URL      string
+	Template *template.Template
+}
+
+var _ Alerter = &webhookAlerter{}
+
+// WebhookData is what webhook body templates are executed with
+type WebhookData struct {
+	Description string
+	IncidentKey string
+	Details     interface{}
+	Labels      map[string]string
+	Urgency     Urgency
+}
+
+func (w *webhookAlerter) Alert(alertInfo AlertInfo, urgency Urgency) error {
+	var body bytes.Buffer
+	err := w.Template.Execute(&body, WebhookData{
+		Description: alertInfo.Description,
+		IncidentKey: alertInfo.IncidentKey,
+		Details:     alertInfo.Details,
+		Labels:      alertInfo.Labels,
+		Urgency:     urgency,
+	})
+	if err != nil {
+		return util.Errorf("Unable to render webhook body for alert %s: %s", alertInfo.IncidentKey, err)
+	}
+
+	var parsed interface{}
+	if err = json.Unmarshal(body.Bytes(), &parsed); err != nil {
+		return util.Errorf("Webhook body for alert %s is not JSON: %s", alertInfo.IncidentKey, err)
+	}
+
+	return postJSON(w.Client, w.URL, body.Bytes(), "webhook")
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// postJSON posts a JSON body and returns an error if the response isn't a
+// success. name identifies the destination in errors.
+func postJSON(client Poster, uri string, body []byte, name string) error {
+	resp, err := client.Post(uri, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return util.Errorf("Unable to post alert to %s: %s", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	respBytes, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return util.Errorf("%d response from %s: %s", resp.StatusCode, name, string(respBytes))
+}
@@ -0,0 +1,160 @@
+package alerting
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// standIn records the bodies posted to it and responds with status
+type standIn struct {
+	server *httptest.Server
+	bodies [][]byte
+}
+
+func newStandIn(t *testing.T, status int) *standIn {
+	s := &standIn{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON body, got content type %q", r.Header.Get("Content-Type"))
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Could not read request body: %s", err)
+		}
+		s.bodies = append(s.bodies, body)
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func testAlertInfo() AlertInfo {
+	return AlertInfo{
+		Description: "a fake error happened",
+		IncidentKey: "incident_key",
+		Details: struct {
+			Host string `json:"host"`
+		}{"host.com"},
+		Labels: map[string]string{PodIDLabel: "web"},
+	}
+}
+
+func TestWebhookDefaultTemplate(t *testing.T) {
+	standIn := newStandIn(t, http.StatusOK)
+	defer standIn.server.Close()
+
+	alerter, err := NewWebhook(standIn.server.URL, "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating webhook alerter: %s", err)
+	}
+
+	err = alerter.Alert(testAlertInfo(), HighUrgency)
+	if err != nil {
+		t.Fatalf("Unexpected error sending alert: %s", err)
+	}
+
+	if len(standIn.bodies) != 1 {
+		t.Fatalf("Expected one alert to be posted, got %d", len(standIn.bodies))
+	}
+	var body struct {
+		Description string            `json:"description"`
+		IncidentKey string            `json:"incident_key"`
+		Urgency     Urgency           `json:"urgency"`
+		Labels      map[string]string `json:"labels"`
+		Details     map[string]string `json:"details"`
+	}
+	err = json.Unmarshal(standIn.bodies[0], &body)
+	if err != nil {
+		t.Fatalf("Posted body was not JSON: %s", err)
+	}
+	if body.Description != "a fake error happened" || body.IncidentKey != "incident_key" || body.Urgency != HighUrgency {
+		t.Errorf("Unexpected body: %s", standIn.bodies[0])
+	}
+	if body.Labels[PodIDLabel] != "web" || body.Details["host"] != "host.com" {
+		t.Errorf("Expected the labels and details in the body: %s", standIn.bodies[0])
+	}
+}
+
+func TestWebhookCustomTemplate(t *testing.T) {
+	standIn := newStandIn(t, http.StatusAccepted)
+	defer standIn.server.Close()
+
+	alerter, err := NewWebhook(standIn.server.URL, `{"summary": {{json .Description}}, "pod": {{json (index .Labels "pod_id")}}}`, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating webhook alerter: %s", err)
+	}
+
+	err = alerter.Alert(testAlertInfo(), LowUrgency)
+	if err != nil {
+		t.Fatalf("Unexpected error sending alert: %s", err)
+	}
+	if string(standIn.bodies[0]) != `{"summary": "a fake error happened", "pod": "web"}` {
+		t.Errorf("Unexpected body: %s", standIn.bodies[0])
+	}
+
+	alerter, err = NewWebhook(standIn.server.URL, `{"summary": {{.Description}}}`, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating webhook alerter: %s", err)
+	}
+	err = alerter.Alert(testAlertInfo(), LowUrgency)
+	if err == nil {
+		t.Errorf("Expected an error for a template that doesn't render JSON")
+	}
+	if len(standIn.bodies) != 1 {
+		t.Errorf("A body that isn't JSON shouldn't be posted")
+	}
+
+	_, err = NewWebhook(standIn.server.URL, `{{`, nil)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid template")
+	}
+}
+
+func TestWebhookErrorResponse(t *testing.T) {
+	standIn := newStandIn(t, http.StatusInternalServerError)
+	defer standIn.server.Close()
+
+	alerter, err := NewWebhook(standIn.server.URL, "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating webhook alerter: %s", err)
+	}
+
+	err = alerter.Alert(testAlertInfo(), HighUrgency)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Expected an error mentioning the status, got %v", err)
+	}
+}
+
+func TestSlack(t *testing.T) {
+	standIn := newStandIn(t, http.StatusOK)
+	defer standIn.server.Close()
+
+	_, err := NewSlack("", nil)
+	if err == nil {
+		t.Errorf("Expected an error creating a slack alerter without a URL")
+	}
+
+	alerter, err := NewSlack(standIn.server.URL, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating slack alerter: %s", err)
+	}
+
+	err = alerter.Alert(testAlertInfo(), HighUrgency)
+	if err != nil {
+		t.Fatalf("Unexpected error sending alert: %s", err)
+	}
+
+	var message slackMessage
+	err = json.Unmarshal(standIn.bodies[0], &message)
+	if err != nil {
+		t.Fatalf("Posted body was not JSON: %s", err)
+	}
+	for _, expected := range []string{"*[high urgency]* a fake error happened", "`incident_key`", "pod_id=web", `"host": "host.com"`} {
+		if !strings.Contains(message.Text, expected) {
+			t.Errorf("Expected %q in the message:\n%s", expected, message.Text)
+		}
+	}
+}
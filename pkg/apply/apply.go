@@ -0,0 +1,673 @@
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/ds"
+	ds_fields "github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	pc_fields "github.com/square/p2/pkg/pc/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/render"
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type PCStore interface {
+	FindWhereLabeled(podID types.PodID, availabilityZone pc_fields.AvailabilityZone, clusterName pc_fields.ClusterName) ([]pc_fields.PodCluster, error)
+	Create(podID types.PodID, availabilityZone pc_fields.AvailabilityZone, clusterName pc_fields.ClusterName, podSelector klabels.Selector, annotations pc_fields.Annotations, allocationStrategy rc_fields.Strategy, session pcstore.Session) (pc_fields.PodCluster, error)
+	MutatePC(id pc_fields.ID, mutator func(pc_fields.PodCluster) (pc_fields.PodCluster, error)) (pc_fields.PodCluster, error)
+}
+
+type RCStore interface {
+	FindWhereLabeled(podID types.PodID, availabilityZone pc_fields.AvailabilityZone, clusterName pc_fields.ClusterName) ([]rc_fields.RC, error)
+	Create(manifest manifest.Manifest, nodeSelector klabels.Selector, availabilityZone pc_fields.AvailabilityZone, clusterName pc_fields.ClusterName, podLabels klabels.Set, additionalLabels klabels.Set, allocationStrategy rc_fields.Strategy) (rc_fields.RC, error)
+	SetDesiredReplicas(id rc_fields.ID, n int) error
+	CASDesiredReplicas(id rc_fields.ID, expected int, n int) error
+}
+
+type RollStore interface {
+	CreateRollingUpdateFromOneExistingRCWithID(
+		ctx context.Context,
+		oldRCID rc_fields.ID,
+		desiredReplicas int,
+		minimumReplicas int,
+		leaveOld bool,
+		rollDelay time.Duration,
+		availabilityZone pc_fields.AvailabilityZone,
+		clusterName pc_fields.ClusterName,
+		newRCManifest manifest.Manifest,
+		newRCNodeSelector klabels.Selector,
+		newRCPodLabels klabels.Set,
+		newRCLabels klabels.Set,
+		rollLabels klabels.Set,
+		newAllocationStrategy rc_fields.Strategy,
+	) (roll_fields.Update, error)
+}
+
+type DSStore interface {
+	ds.DaemonSetStore
+	Create(ctx context.Context, manifest manifest.Manifest, minHealth int, name ds_fields.ClusterName, nodeSelector klabels.Selector, podID types.PodID, timeout time.Duration) (ds_fields.DaemonSet, error)
+	MutateDS(id ds_fields.ID, mutator func(ds_fields.DaemonSet) (ds_fields.DaemonSet, error)) (ds_fields.DaemonSet, error)
+}
+
+type Labeler interface {
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+	SetLabelsTxn(ctx context.Context, labelType labels.Type, id string, labels map[string]string) error
+}
+
+// Change is one step of a plan.
+type Change interface {
+	// String describes the change, e.g. for showing the plan before it is
+	// applied
+	String() string
+	apply(a Applier) error
+}
+
+// Applier plans and applies the changes that make consul match a bundle of
+// documents (see ReadDocuments). Changes use the mechanism that is safe for
+// them: manifest changes to replication controllers are rolled out by a
+// rolling update, replica counts are changed with a check-and-set, and labels
+// are set in a single transaction.
+//
+// Objects that exist in consul but are not described by the bundle are left
+// alone.
+type Applier struct {
+	pcStore   PCStore
+	rcStore   RCStore
+	rollStore RollStore
+	dsStore   DSStore
+	labeler   Labeler
+	scheduler ds.Scheduler
+	txner     transaction.Txner
+
+	// whether rendered manifests are clearsigned, and with which gpg key
+	sign   bool
+	gpgKey string
+
+	// set by Apply
+	session pcstore.Session
+}
+
+func NewApplier(
+	pcStore PCStore,
+	rcStore RCStore,
+	rollStore RollStore,
+	dsStore DSStore,
+	labeler Labeler,
+	scheduler ds.Scheduler,
+	txner transaction.Txner,
+	sign bool,
+	gpgKey string,
+) Applier {
+	return Applier{
+		pcStore:   pcStore,
+		rcStore:   rcStore,
+		rollStore: rollStore,
+		dsStore:   dsStore,
+		labeler:   labeler,
+		scheduler: scheduler,
+		txner:     txner,
+		sign:      sign,
+		gpgKey:    gpgKey,
+	}
+}
+
+// Plan returns the changes needed to apply docs, in the order they should be
+// applied: labels first, since selectors may depend on them, then pod
+// clusters, replication controllers and daemon sets.
+func (a Applier) Plan(docs []Document) ([]Change, error) {
+	var labelChanges []labelChange
+	var pcChanges, rcChanges, dsChanges []Change
+	for _, doc := range docs {
+		var change Change
+		var err error
+		switch doc.Kind {
+		case LabelsKind:
+			var lc *labelChange
+			lc, err = a.planLabels(doc)
+			if lc != nil {
+				labelChanges = append(labelChanges, *lc)
+			}
+		case PodClusterKind:
+			change, err = a.planPodCluster(doc)
+			if change != nil {
+				pcChanges = append(pcChanges, change)
+			}
+		case ReplicationControllerKind:
+			change, err = a.planRC(doc)
+			if change != nil {
+				rcChanges = append(rcChanges, change)
+			}
+		case DaemonSetKind:
+			change, err = a.planDaemonSet(doc)
+			if change != nil {
+				dsChanges = append(dsChanges, change)
+			}
+		}
+		if err != nil {
+			return nil, util.Errorf("%s: %s", doc.path, err)
+		}
+	}
+
+	var changes []Change
+	if len(labelChanges) > 0 {
+		changes = append(changes, labelsChange(labelChanges))
+	}
+	changes = append(changes, pcChanges...)
+	changes = append(changes, rcChanges...)
+	changes = append(changes, dsChanges...)
+	return changes, nil
+}
+
+// Apply applies changes in order, stopping at the first that fails. The
+// session is used to lock pod clusters while they are created.
+func (a Applier) Apply(changes []Change, session pcstore.Session) error {
+	a.session = session
+	for _, change := range changes {
+		err := change.apply(a)
+		if err != nil {
+			return util.Errorf("Could not apply %q: %s", change, err)
+		}
+	}
+	return nil
+}
+
+// Labels
+
+type labelChange struct {
+	labelType labels.Type
+	id        string
+	set       map[string]string
+	old       map[string]string
+}
+
+// labelsChange sets all labels in one transaction
+type labelsChange []labelChange
+
+func (a Applier) planLabels(doc Document) (*labelChange, error) {
+	labelType, err := labels.AsType(doc.LabelType)
+	if err != nil {
+		return nil, util.Errorf("invalid label type %q", doc.LabelType)
+	}
+	current, err := a.labeler.GetLabels(labelType, doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	change := labelChange{
+		labelType: labelType,
+		id:        doc.ID,
+		set:       make(map[string]string),
+		old:       make(map[string]string),
+	}
+	for key, value := range doc.Labels {
+		if old, ok := current.Labels[key]; !ok || old != value {
+			change.set[key] = value
+			change.old[key] = old
+		}
+	}
+	if len(change.set) == 0 {
+		return nil, nil
+	}
+	return &change, nil
+}
+
+func (c labelsChange) String() string {
+	lines := make([]string, 0, len(c))
+	for _, change := range c {
+		keys := make([]string, 0, len(change.set))
+		for key := range change.set {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			lines = append(lines, fmt.Sprintf("~ set label %s=%s on %s %s (was %q)", key, change.set[key], change.labelType, change.id, change.old[key]))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c labelsChange) apply(a Applier) error {
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	for _, change := range c {
+		err := a.labeler.SetLabelsTxn(ctx, change.labelType, change.id, change.set)
+		if err != nil {
+			return err
+		}
+	}
+	return transaction.MustCommit(ctx, a.txner)
+}
+
+// Pod clusters
+
+type podClusterChange struct {
+	existing    *pc_fields.PodCluster
+	podID       types.PodID
+	az          pc_fields.AvailabilityZone
+	name        pc_fields.ClusterName
+	selector    klabels.Selector
+	annotations pc_fields.Annotations
+	strategy    rc_fields.Strategy
+	diffs       []string
+}
+
+func (a Applier) planPodCluster(doc Document) (Change, error) {
+	change := podClusterChange{
+		podID:    types.PodID(doc.PodID),
+		az:       pc_fields.AvailabilityZone(doc.AvailabilityZone),
+		name:     pc_fields.ClusterName(doc.ClusterName),
+		strategy: rc_fields.Strategy(doc.AllocationStrategy),
+	}
+	if doc.PodSelector != "" {
+		selector, err := klabels.Parse(doc.PodSelector)
+		if err != nil {
+			return nil, util.Errorf("invalid pod_selector: %s", err)
+		}
+		change.selector = selector
+	} else {
+		change.selector = klabels.Everything().
+			Add(pc_fields.PodIDLabel, klabels.EqualsOperator, []string{doc.PodID}).
+			Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{doc.AvailabilityZone}).
+			Add(pc_fields.ClusterNameLabel, klabels.EqualsOperator, []string{doc.ClusterName})
+	}
+	annotations, err := jsonValue(doc.Annotations)
+	if err != nil {
+		return nil, util.Errorf("invalid annotations: %s", err)
+	}
+	change.annotations, _ = annotations.(map[string]interface{})
+
+	existing, err := a.pcStore.FindWhereLabeled(change.podID, change.az, change.name)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 1 {
+		return nil, util.Errorf("found %d pod clusters for %s", len(existing), change.describe())
+	}
+	if len(existing) == 0 {
+		return change, nil
+	}
+
+	pc := existing[0]
+	change.existing = &pc
+	if pc.PodSelector.String() != change.selector.String() {
+		change.diffs = append(change.diffs, fmt.Sprintf("pod selector %q -> %q", pc.PodSelector, change.selector))
+	}
+	if pc.AllocationStrategy != change.strategy {
+		change.diffs = append(change.diffs, fmt.Sprintf("allocation strategy %s -> %s", pc.AllocationStrategy, change.strategy))
+	}
+	existingAnnotations := pc.Annotations
+	if existingAnnotations == nil {
+		existingAnnotations = pc_fields.Annotations{}
+	}
+	equal, err := jsonEqual(existingAnnotations, change.annotations)
+	if err != nil {
+		return nil, err
+	}
+	if !equal {
+		change.diffs = append(change.diffs, "annotations")
+	}
+	if len(change.diffs) == 0 {
+		return nil, nil
+	}
+	return change, nil
+}
+
+func (c podClusterChange) describe() string {
+	return fmt.Sprintf("%s (%s/%s)", c.podID, c.az, c.name)
+}
+
+func (c podClusterChange) String() string {
+	if c.existing == nil {
+		return "+ create pod cluster " + c.describe()
+	}
+	return fmt.Sprintf("~ update pod cluster %s %s: %s", c.existing.ID, c.describe(), strings.Join(c.diffs, ", "))
+}
+
+func (c podClusterChange) apply(a Applier) error {
+	if c.existing == nil {
+		_, err := a.pcStore.Create(c.podID, c.az, c.name, c.selector, c.annotations, c.strategy, a.session)
+		return err
+	}
+	_, err := a.pcStore.MutatePC(c.existing.ID, func(pc pc_fields.PodCluster) (pc_fields.PodCluster, error) {
+		pc.PodSelector = c.selector
+		pc.AllocationStrategy = c.strategy
+		pc.Annotations = c.annotations
+		return pc, nil
+	})
+	return err
+}
+
+// Replication controllers
+
+type rcChange struct {
+	existing     *rc_fields.RC
+	manifest     manifest.Manifest
+	az           pc_fields.AvailabilityZone
+	name         pc_fields.ClusterName
+	nodeSelector klabels.Selector
+	podLabels    klabels.Set
+	strategy     rc_fields.Strategy
+	replicas     int
+	policy       *RollingUpdatePolicy
+	// whether the change needs a rolling update, rather than only a new
+	// replica count
+	roll  bool
+	diffs []string
+}
+
+func (a Applier) planRC(doc Document) (Change, error) {
+	podManifest, err := render.Load(doc.manifestPath(), doc.renderOptions(a.sign, a.gpgKey))
+	if err != nil {
+		return nil, err
+	}
+	nodeSelector, err := klabels.Parse(doc.NodeSelector)
+	if err != nil {
+		return nil, util.Errorf("invalid node_selector: %s", err)
+	}
+	podLabels := klabels.Set{}
+	for key, value := range doc.PodLabels {
+		podLabels[key] = value
+	}
+	podLabels[types.AvailabilityZoneLabel] = doc.AvailabilityZone
+	podLabels[types.ClusterNameLabel] = doc.ClusterName
+	change := rcChange{
+		manifest:     podManifest,
+		az:           pc_fields.AvailabilityZone(doc.AvailabilityZone),
+		name:         pc_fields.ClusterName(doc.ClusterName),
+		nodeSelector: nodeSelector,
+		podLabels:    podLabels,
+		strategy:     rc_fields.Strategy(doc.AllocationStrategy),
+		replicas:     doc.Replicas,
+		policy:       doc.RollingUpdate,
+	}
+
+	existing, err := a.rcStore.FindWhereLabeled(podManifest.ID(), change.az, change.name)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 1 {
+		return nil, util.Errorf("found %d replication controllers for %s, is a rolling update in progress?", len(existing), change.describe())
+	}
+	if len(existing) == 0 {
+		return change, nil
+	}
+
+	rc := existing[0]
+	change.existing = &rc
+	oldSHA, err := rc.Manifest.SHA()
+	if err != nil {
+		return nil, err
+	}
+	newSHA, err := podManifest.SHA()
+	if err != nil {
+		return nil, err
+	}
+	if oldSHA != newSHA {
+		change.diffs = append(change.diffs, fmt.Sprintf("manifest %s -> %s", shortSHA(oldSHA), shortSHA(newSHA)))
+	}
+	if rc.NodeSelector.String() != nodeSelector.String() {
+		change.diffs = append(change.diffs, fmt.Sprintf("node selector %q -> %q", rc.NodeSelector, nodeSelector))
+	}
+	if !reflect.DeepEqual(map[string]string(rc.PodLabels), map[string]string(podLabels)) {
+		change.diffs = append(change.diffs, fmt.Sprintf("pod labels %s -> %s", rc.PodLabels, podLabels))
+	}
+	if rc.AllocationStrategy != change.strategy {
+		change.diffs = append(change.diffs, fmt.Sprintf("allocation strategy %s -> %s", rc.AllocationStrategy, change.strategy))
+	}
+	change.roll = len(change.diffs) > 0
+	if change.roll && change.policy == nil {
+		return nil, util.Errorf("replication controller %s has changed but has no rolling_update policy", rc.ID)
+	}
+	if rc.ReplicasDesired != doc.Replicas {
+		change.diffs = append(change.diffs, fmt.Sprintf("replicas %d -> %d", rc.ReplicasDesired, doc.Replicas))
+	}
+	if len(change.diffs) == 0 {
+		return nil, nil
+	}
+	return change, nil
+}
+
+func (c rcChange) describe() string {
+	return fmt.Sprintf("%s (%s/%s)", c.manifest.ID(), c.az, c.name)
+}
+
+func (c rcChange) String() string {
+	if c.existing == nil {
+		return fmt.Sprintf("+ create replication controller %s with %d replicas", c.describe(), c.replicas)
+	}
+	if c.roll {
+		return fmt.Sprintf("~ roll replication controller %s %s to a new replication controller (minimum %d): %s", c.existing.ID, c.describe(), c.policy.MinimumReplicas, strings.Join(c.diffs, ", "))
+	}
+	return fmt.Sprintf("~ scale replication controller %s %s: %s", c.existing.ID, c.describe(), strings.Join(c.diffs, ", "))
+}
+
+func (c rcChange) apply(a Applier) error {
+	if c.existing == nil {
+		// Create modifies the pod labels it is given
+		podLabels := klabels.Set{}
+		for key, value := range c.podLabels {
+			podLabels[key] = value
+		}
+		rc, err := a.rcStore.Create(c.manifest, c.nodeSelector, c.az, c.name, podLabels, nil, c.strategy)
+		if err != nil {
+			return err
+		}
+		return a.rcStore.SetDesiredReplicas(rc.ID, c.replicas)
+	}
+
+	if !c.roll {
+		return a.rcStore.CASDesiredReplicas(c.existing.ID, c.existing.ReplicasDesired, c.replicas)
+	}
+
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	_, err := a.rollStore.CreateRollingUpdateFromOneExistingRCWithID(
+		ctx,
+		c.existing.ID,
+		c.replicas,
+		c.policy.MinimumReplicas,
+		c.policy.LeaveOld,
+		c.policy.RollDelay,
+		c.az,
+		c.name,
+		c.manifest,
+		c.nodeSelector,
+		c.podLabels,
+		nil,
+		nil,
+		c.strategy,
+	)
+	if err != nil {
+		return err
+	}
+	return transaction.MustCommit(ctx, a.txner)
+}
+
+// Daemon sets
+
+type daemonSetChange struct {
+	existing     *ds_fields.DaemonSet
+	manifest     manifest.Manifest
+	name         ds_fields.ClusterName
+	nodeSelector klabels.Selector
+	minHealth    int
+	timeout      time.Duration
+	diffs        []string
+}
+
+func (a Applier) planDaemonSet(doc Document) (Change, error) {
+	podManifest, err := render.Load(doc.manifestPath(), doc.renderOptions(a.sign, a.gpgKey))
+	if err != nil {
+		return nil, err
+	}
+	nodeSelector, err := klabels.Parse(doc.NodeSelector)
+	if err != nil {
+		return nil, util.Errorf("invalid node_selector: %s", err)
+	}
+	change := daemonSetChange{
+		manifest:     podManifest,
+		name:         ds_fields.ClusterName(doc.ClusterName),
+		nodeSelector: nodeSelector,
+		minHealth:    doc.MinHealth,
+		timeout:      doc.Timeout,
+	}
+
+	dss, err := a.dsStore.List()
+	if err != nil {
+		return nil, err
+	}
+	var existing []ds_fields.DaemonSet
+	for _, ds := range dss {
+		if ds.PodID == podManifest.ID() && ds.Name == change.name {
+			existing = append(existing, ds)
+		}
+	}
+	if len(existing) > 1 {
+		return nil, util.Errorf("found %d daemon sets for %s", len(existing), change.describe())
+	}
+	if len(existing) == 0 {
+		return change, nil
+	}
+
+	ds := existing[0]
+	change.existing = &ds
+	oldSHA, err := ds.Manifest.SHA()
+	if err != nil {
+		return nil, err
+	}
+	newSHA, err := podManifest.SHA()
+	if err != nil {
+		return nil, err
+	}
+	if oldSHA != newSHA {
+		change.diffs = append(change.diffs, fmt.Sprintf("manifest %s -> %s", shortSHA(oldSHA), shortSHA(newSHA)))
+	}
+	if ds.NodeSelector.String() != nodeSelector.String() {
+		change.diffs = append(change.diffs, fmt.Sprintf("node selector %q -> %q", ds.NodeSelector, nodeSelector))
+	}
+	if ds.MinHealth != doc.MinHealth {
+		change.diffs = append(change.diffs, fmt.Sprintf("min health %d -> %d", ds.MinHealth, doc.MinHealth))
+	}
+	if ds.Timeout != doc.Timeout {
+		change.diffs = append(change.diffs, fmt.Sprintf("timeout %s -> %s", ds.Timeout, doc.Timeout))
+	}
+	if len(change.diffs) == 0 {
+		return nil, nil
+	}
+	return change, nil
+}
+
+func (c daemonSetChange) describe() string {
+	return fmt.Sprintf("%s (%s)", c.manifest.ID(), c.name)
+}
+
+func (c daemonSetChange) String() string {
+	if c.existing == nil {
+		return "+ create daemon set " + c.describe()
+	}
+	return fmt.Sprintf("~ update daemon set %s %s: %s", c.existing.ID, c.describe(), strings.Join(c.diffs, ", "))
+}
+
+func (c daemonSetChange) apply(a Applier) error {
+	if c.existing == nil {
+		ctx, cancelFunc := transaction.New(context.Background())
+		defer cancelFunc()
+		newDS, err := a.dsStore.Create(ctx, c.manifest, c.minHealth, c.name, c.nodeSelector, c.manifest.ID(), c.timeout)
+		if err != nil {
+			return err
+		}
+		conflicting, contends, err := ds.DSContends(newDS, a.scheduler, a.dsStore)
+		if err != nil {
+			return util.Errorf("could not check for daemon set overlap: %s", err)
+		}
+		if contends {
+			return util.Errorf("daemon set %s contends with the node selector", conflicting.ID)
+		}
+		return transaction.MustCommit(ctx, a.txner)
+	}
+
+	_, err := a.dsStore.MutateDS(c.existing.ID, func(ds ds_fields.DaemonSet) (ds_fields.DaemonSet, error) {
+		ds.Manifest = c.manifest
+		ds.NodeSelector = c.nodeSelector
+		ds.MinHealth = c.minHealth
+		ds.Timeout = c.timeout
+		return ds, nil
+	})
+	return err
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// jsonValue converts a value decoded from YAML into one that can be encoded as
+// JSON, which doesn't allow maps with non-string keys
+func jsonValue(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			s, ok := key.(string)
+			if !ok {
+				return nil, util.Errorf("key %v is not a string", key)
+			}
+			c, err := jsonValue(v)
+			if err != nil {
+				return nil, err
+			}
+			converted[s] = c
+		}
+		return converted, nil
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			c, err := jsonValue(v)
+			if err != nil {
+				return nil, err
+			}
+			converted[key] = c
+		}
+		return converted, nil
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, v := range value {
+			c, err := jsonValue(v)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = c
+		}
+		return converted, nil
+	}
+	return value, nil
+}
+
+// jsonEqual compares values by their JSON encoding, since annotations read
+// back from consul have been through JSON
+func jsonEqual(a, b interface{}) (bool, error) {
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return string(aJSON) == string(bJSON), nil
+}
@@ -0,0 +1,280 @@
+package apply
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	ds_fields "github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	pc_fields "github.com/square/p2/pkg/pc/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/dsstore"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/types"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+type fakePCStore struct {
+	pcs []pc_fields.PodCluster
+}
+
+func (s *fakePCStore) FindWhereLabeled(podID types.PodID, az pc_fields.AvailabilityZone, name pc_fields.ClusterName) ([]pc_fields.PodCluster, error) {
+	var found []pc_fields.PodCluster
+	for _, pc := range s.pcs {
+		if pc.PodID == podID && pc.AvailabilityZone == az && pc.Name == name {
+			found = append(found, pc)
+		}
+	}
+	return found, nil
+}
+
+func (s *fakePCStore) Create(podID types.PodID, az pc_fields.AvailabilityZone, name pc_fields.ClusterName, selector klabels.Selector, annotations pc_fields.Annotations, strategy rc_fields.Strategy, session pcstore.Session) (pc_fields.PodCluster, error) {
+	pc := pc_fields.PodCluster{ID: "new", PodID: podID, AvailabilityZone: az, Name: name, PodSelector: selector, Annotations: annotations, AllocationStrategy: strategy}
+	s.pcs = append(s.pcs, pc)
+	return pc, nil
+}
+
+func (s *fakePCStore) MutatePC(id pc_fields.ID, mutator func(pc_fields.PodCluster) (pc_fields.PodCluster, error)) (pc_fields.PodCluster, error) {
+	return pc_fields.PodCluster{}, nil
+}
+
+type fakeRCStore struct {
+	rcs []rc_fields.RC
+	cas []int
+}
+
+func (s *fakeRCStore) FindWhereLabeled(podID types.PodID, az pc_fields.AvailabilityZone, name pc_fields.ClusterName) ([]rc_fields.RC, error) {
+	var found []rc_fields.RC
+	for _, rc := range s.rcs {
+		if rc.Manifest.ID() == podID && rc.PodLabels[types.AvailabilityZoneLabel] == az.String() && rc.PodLabels[types.ClusterNameLabel] == name.String() {
+			found = append(found, rc)
+		}
+	}
+	return found, nil
+}
+
+func (s *fakeRCStore) Create(m manifest.Manifest, nodeSelector klabels.Selector, az pc_fields.AvailabilityZone, name pc_fields.ClusterName, podLabels klabels.Set, additionalLabels klabels.Set, strategy rc_fields.Strategy) (rc_fields.RC, error) {
+	return rc_fields.RC{}, nil
+}
+
+func (s *fakeRCStore) SetDesiredReplicas(id rc_fields.ID, n int) error {
+	return nil
+}
+
+func (s *fakeRCStore) CASDesiredReplicas(id rc_fields.ID, expected int, n int) error {
+	s.cas = append(s.cas, expected, n)
+	return nil
+}
+
+type fakeRollStore struct{}
+
+func (fakeRollStore) CreateRollingUpdateFromOneExistingRCWithID(ctx context.Context, oldRCID rc_fields.ID, desiredReplicas int, minimumReplicas int, leaveOld bool, rollDelay time.Duration, az pc_fields.AvailabilityZone, name pc_fields.ClusterName, m manifest.Manifest, nodeSelector klabels.Selector, podLabels klabels.Set, rcLabels klabels.Set, rollLabels klabels.Set, strategy rc_fields.Strategy) (roll_fields.Update, error) {
+	return roll_fields.Update{}, nil
+}
+
+type fakeDSStore struct {
+	dss []ds_fields.DaemonSet
+}
+
+func (s *fakeDSStore) List() ([]ds_fields.DaemonSet, error) {
+	return s.dss, nil
+}
+
+func (s *fakeDSStore) Watch(quitCh <-chan struct{}) <-chan dsstore.WatchedDaemonSets {
+	return nil
+}
+
+func (s *fakeDSStore) Disable(id ds_fields.ID) (ds_fields.DaemonSet, error) {
+	return ds_fields.DaemonSet{}, nil
+}
+
+func (s *fakeDSStore) Create(ctx context.Context, m manifest.Manifest, minHealth int, name ds_fields.ClusterName, nodeSelector klabels.Selector, podID types.PodID, timeout time.Duration) (ds_fields.DaemonSet, error) {
+	return ds_fields.DaemonSet{}, nil
+}
+
+func (s *fakeDSStore) MutateDS(id ds_fields.ID, mutator func(ds_fields.DaemonSet) (ds_fields.DaemonSet, error)) (ds_fields.DaemonSet, error) {
+	return ds_fields.DaemonSet{}, nil
+}
+
+// txnLabeler applies labels immediately since the fake applicator doesn't
+// support transactions
+type txnLabeler struct {
+	labels.Applicator
+}
+
+func (l txnLabeler) SetLabelsTxn(ctx context.Context, labelType labels.Type, id string, set map[string]string) error {
+	return l.SetLabels(labelType, id, set)
+}
+
+const bundle = `kind: labels
+type: node
+id: node1
+labels:
+  role: web
+---
+kind: pod_cluster
+pod_id: web
+availability_zone: az1
+cluster_name: production
+allocation_strategy: dynamic_strategy
+---
+kind: replication_controller
+manifest: web.yaml
+availability_zone: az1
+cluster_name: production
+allocation_strategy: dynamic_strategy
+node_selector: role=web
+replicas: 3
+---
+kind: daemon_set
+manifest: agent.yaml
+cluster_name: production
+node_selector: role=web
+min_health: 1
+timeout: 10m
+`
+
+func writeBundle(t *testing.T) (string, manifest.Manifest) {
+	dir, err := ioutil.TempDir("", "apply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"bundle.yaml": bundle,
+		"web.yaml":    "id: web\n",
+		"agent.yaml":  "id: agent\n",
+	}
+	for name, contents := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	web, err := manifest.FromPath(filepath.Join(dir, "web.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, web
+}
+
+func TestPlanAndApply(t *testing.T) {
+	dir, web := writeBundle(t)
+	defer os.RemoveAll(dir)
+	docs, err := ReadDocuments(filepath.Join(dir, "bundle.yaml"))
+	Assert(t).IsNil(err, "unexpected error reading documents")
+	Assert(t).AreEqual(len(docs), 4, "wrong number of documents")
+
+	labeler := labels.NewFakeApplicator()
+	err = labeler.SetLabel(labels.NODE, "node1", "role", "db")
+	Assert(t).IsNil(err, "unexpected error setting label")
+	pcStore := &fakePCStore{pcs: []pc_fields.PodCluster{{
+		ID:                 "pc",
+		PodID:              "web",
+		AvailabilityZone:   "az1",
+		Name:               "production",
+		PodSelector:        klabels.Everything().Add(pc_fields.PodIDLabel, klabels.EqualsOperator, []string{"web"}).Add(pc_fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{"az1"}).Add(pc_fields.ClusterNameLabel, klabels.EqualsOperator, []string{"production"}),
+		AllocationStrategy: rc_fields.DynamicStrategy,
+	}}}
+	nodeSelector, _ := klabels.Parse("role=web")
+	rcStore := &fakeRCStore{rcs: []rc_fields.RC{{
+		ID:                 "rc",
+		Manifest:           web,
+		NodeSelector:       nodeSelector,
+		PodLabels:          klabels.Set{types.AvailabilityZoneLabel: "az1", types.ClusterNameLabel: "production"},
+		ReplicasDesired:    2,
+		AllocationStrategy: rc_fields.DynamicStrategy,
+	}}}
+	applier := NewApplier(pcStore, rcStore, fakeRollStore{}, &fakeDSStore{}, txnLabeler{labeler}, nil, consulutil.NewFakeClient().KV(), false, "")
+
+	changes, err := applier.Plan(docs)
+	Assert(t).IsNil(err, "unexpected error planning")
+	Assert(t).AreEqual(len(changes), 3, "expected label, replica and daemon set changes")
+	Assert(t).IsTrue(strings.HasPrefix(changes[0].String(), "~ set label role=web on node node1"), "wrong label change: "+changes[0].String())
+	Assert(t).IsTrue(strings.HasPrefix(changes[1].String(), "~ scale replication controller rc"), "wrong rc change: "+changes[1].String())
+	Assert(t).IsTrue(strings.HasPrefix(changes[2].String(), "+ create daemon set agent"), "wrong daemon set change: "+changes[2].String())
+
+	err = applier.Apply(changes[:2], nil)
+	Assert(t).IsNil(err, "unexpected error applying")
+	labeled, err := labeler.GetLabels(labels.NODE, "node1")
+	Assert(t).IsNil(err, "unexpected error getting labels")
+	Assert(t).AreEqual(labeled.Labels["role"], "web", "label was not set")
+	Assert(t).AreEqual(len(rcStore.cas), 2, "replicas should be changed with a CAS")
+	Assert(t).AreEqual(rcStore.cas[0], 2, "wrong expected replica count")
+	Assert(t).AreEqual(rcStore.cas[1], 3, "wrong replica count")
+}
+
+func TestPlanRequiresRollingUpdatePolicyForManifestChanges(t *testing.T) {
+	dir, _ := writeBundle(t)
+	defer os.RemoveAll(dir)
+	docs, err := ReadDocuments(filepath.Join(dir, "bundle.yaml"))
+	Assert(t).IsNil(err, "unexpected error reading documents")
+
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	builder.SetConfig(map[interface{}]interface{}{"old": true})
+	nodeSelector, _ := klabels.Parse("role=web")
+	rcStore := &fakeRCStore{rcs: []rc_fields.RC{{
+		ID:                 "rc",
+		Manifest:           builder.GetManifest(),
+		NodeSelector:       nodeSelector,
+		PodLabels:          klabels.Set{types.AvailabilityZoneLabel: "az1", types.ClusterNameLabel: "production"},
+		ReplicasDesired:    3,
+		AllocationStrategy: rc_fields.DynamicStrategy,
+	}}}
+	applier := NewApplier(&fakePCStore{}, rcStore, fakeRollStore{}, &fakeDSStore{}, labels.NewFakeApplicator(), nil, consulutil.NewFakeClient().KV(), false, "")
+
+	_, err = applier.Plan(docs)
+	Assert(t).IsNotNil(err, "expected an error planning a manifest change without a rolling update policy")
+
+	for i := range docs {
+		if docs[i].Kind == ReplicationControllerKind {
+			docs[i].RollingUpdate = &RollingUpdatePolicy{MinimumReplicas: 2}
+		}
+	}
+	changes, err := applier.Plan(docs)
+	Assert(t).IsNil(err, "unexpected error planning")
+	var rolls int
+	for _, change := range changes {
+		if strings.HasPrefix(change.String(), "~ roll replication controller rc") {
+			rolls++
+		}
+	}
+	Assert(t).AreEqual(rolls, 1, "expected the manifest change to be rolled out")
+}
+
+func TestRenderOptionsOnlySignRenderedManifests(t *testing.T) {
+	doc := Document{Manifest: "web.yaml", path: "/bundle/web.yaml"}
+	opts := doc.renderOptions(true, "deployer")
+	if opts.Sign {
+		t.Error("a manifest that isn't rendered should be used as read, keeping its signature")
+	}
+
+	doc.Overlays = []string{"production.yaml"}
+	opts = doc.renderOptions(true, "deployer")
+	if !opts.Sign || opts.GPGKey != "deployer" {
+		t.Errorf("expected a manifest rendered from overlays to be signed with the given key, got %+v", opts)
+	}
+	if len(opts.Overlays) != 1 || opts.Overlays[0] != "/bundle/production.yaml" {
+		t.Errorf("expected overlays to be relative to the document, got %v", opts.Overlays)
+	}
+
+	doc.Overlays = nil
+	doc.Vars = map[string]string{"az": "us-west-2a"}
+	if !doc.renderOptions(true, "").Sign {
+		t.Error("expected a manifest rendered from vars to be signed")
+	}
+	if doc.renderOptions(false, "").Sign {
+		t.Error("manifests shouldn't be signed unless asked to")
+	}
+}
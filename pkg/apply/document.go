@@ -0,0 +1,215 @@
+// Package apply reconciles the pod clusters, replication controllers, daemon
+// sets and labels stored in consul with a declarative description of them, as
+// done by p2-apply.
+package apply
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/render"
+	"github.com/square/p2/pkg/util"
+)
+
+// The kinds of documents a bundle may contain
+const (
+	PodClusterKind            = "pod_cluster"
+	ReplicationControllerKind = "replication_controller"
+	DaemonSetKind             = "daemon_set"
+	LabelsKind                = "labels"
+)
+
+// Document describes the desired state of one pod cluster, replication
+// controller, daemon set or set of labels. Which fields apply depends on Kind.
+type Document struct {
+	Kind string `yaml:"kind"`
+
+	// The manifest of replication controllers and daemon sets, relative to
+	// the document's file, and how it is rendered (see render.Load).
+	// Pod clusters are identified by the pod ID given by PodID
+	Manifest string            `yaml:"manifest,omitempty"`
+	Overlays []string          `yaml:"overlays,omitempty"`
+	Vars     map[string]string `yaml:"vars,omitempty"`
+
+	// Pod clusters and replication controllers are identified by their
+	// pod ID, availability zone and cluster name. Daemon sets are
+	// identified by their pod ID and cluster name
+	PodID            string `yaml:"pod_id,omitempty"`
+	AvailabilityZone string `yaml:"availability_zone,omitempty"`
+	ClusterName      string `yaml:"cluster_name,omitempty"`
+
+	// Pod clusters
+	PodSelector string                 `yaml:"pod_selector,omitempty"`
+	Annotations map[string]interface{} `yaml:"annotations,omitempty"`
+
+	// Pod clusters and replication controllers
+	AllocationStrategy string `yaml:"allocation_strategy,omitempty"`
+
+	// Replication controllers and daemon sets
+	NodeSelector string `yaml:"node_selector,omitempty"`
+
+	// Replication controllers
+	Replicas      int                  `yaml:"replicas,omitempty"`
+	PodLabels     map[string]string    `yaml:"pod_labels,omitempty"`
+	RollingUpdate *RollingUpdatePolicy `yaml:"rolling_update,omitempty"`
+
+	// Daemon sets
+	MinHealth int           `yaml:"min_health,omitempty"`
+	Timeout   time.Duration `yaml:"timeout,omitempty"`
+
+	// Labels
+	LabelType string            `yaml:"type,omitempty"`
+	ID        string            `yaml:"id,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+
+	// the file the document was read from
+	path string
+}
+
+// RollingUpdatePolicy controls the rolling update that applies a new manifest
+// to a replication controller.
+type RollingUpdatePolicy struct {
+	MinimumReplicas int           `yaml:"minimum_replicas"`
+	LeaveOld        bool          `yaml:"leave_old,omitempty"`
+	RollDelay       time.Duration `yaml:"roll_delay,omitempty"`
+}
+
+// renderOptions returns how the document's manifest is rendered. If sign is
+// true, manifests rendered from overlays or vars are clearsigned with gpgKey.
+// Other manifests are used as read, so that their signature is kept.
+func (d Document) renderOptions(sign bool, gpgKey string) render.Options {
+	overlays := make([]string, len(d.Overlays))
+	for i, overlay := range d.Overlays {
+		overlays[i] = d.relativePath(overlay)
+	}
+	rendered := len(overlays) > 0 || len(d.Vars) > 0
+	return render.Options{
+		Overlays: overlays,
+		Vars:     d.Vars,
+		Sign:     sign && rendered,
+		GPGKey:   gpgKey,
+	}
+}
+
+func (d Document) manifestPath() string {
+	return d.relativePath(d.Manifest)
+}
+
+func (d Document) relativePath(path string) string {
+	if filepath.IsAbs(path) || d.path == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(d.path), path)
+}
+
+// ReadDocuments reads the documents of the bundle at path, which is either a
+// YAML file or a directory whose .yaml and .yml files are read in lexical
+// order. A file may hold several documents separated by "---" lines.
+func ReadDocuments(path string) ([]Document, error) {
+	paths := []string{path}
+	infos, err := ioutil.ReadDir(path)
+	if err == nil {
+		paths = nil
+		for _, info := range infos {
+			ext := filepath.Ext(info.Name())
+			if info.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			paths = append(paths, filepath.Join(path, info.Name()))
+		}
+		sort.Strings(paths)
+	}
+
+	var docs []Document
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, util.Errorf("Could not read %s: %s", path, err)
+		}
+		for i, raw := range splitDocuments(contents) {
+			if len(bytes.TrimSpace(raw)) == 0 {
+				continue
+			}
+			var doc Document
+			err = yaml.Unmarshal(raw, &doc)
+			if err != nil {
+				return nil, util.Errorf("Could not parse document %d of %s: %s", i+1, path, err)
+			}
+			doc.path = path
+			err = doc.validate()
+			if err != nil {
+				return nil, util.Errorf("Invalid document %d of %s: %s", i+1, path, err)
+			}
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func splitDocuments(contents []byte) [][]byte {
+	var docs [][]byte
+	var current []byte
+	for _, line := range bytes.SplitAfter(contents, []byte("\n")) {
+		if strings.TrimRight(string(line), " \r\n") == "---" {
+			docs = append(docs, current)
+			current = nil
+			continue
+		}
+		current = append(current, line...)
+	}
+	return append(docs, current)
+}
+
+func (d Document) validate() error {
+	switch d.Kind {
+	case PodClusterKind:
+		if d.PodID == "" || d.AvailabilityZone == "" || d.ClusterName == "" {
+			return util.Errorf("pod clusters require pod_id, availability_zone and cluster_name")
+		}
+		if err := validStrategy(d.AllocationStrategy); err != nil {
+			return err
+		}
+	case ReplicationControllerKind:
+		if d.Manifest == "" || d.AvailabilityZone == "" || d.ClusterName == "" || d.NodeSelector == "" {
+			return util.Errorf("replication controllers require manifest, availability_zone, cluster_name and node_selector")
+		}
+		if err := validStrategy(d.AllocationStrategy); err != nil {
+			return err
+		}
+		if d.Replicas < 0 {
+			return util.Errorf("replicas must not be negative")
+		}
+		if d.RollingUpdate != nil && (d.RollingUpdate.MinimumReplicas < 0 || d.RollingUpdate.MinimumReplicas > d.Replicas) {
+			return util.Errorf("rolling_update.minimum_replicas must be between 0 and replicas")
+		}
+	case DaemonSetKind:
+		if d.Manifest == "" || d.ClusterName == "" || d.NodeSelector == "" {
+			return util.Errorf("daemon sets require manifest, cluster_name and node_selector")
+		}
+		if d.Timeout <= 0 {
+			return util.Errorf("daemon sets require a positive timeout")
+		}
+	case LabelsKind:
+		if d.LabelType == "" || d.ID == "" {
+			return util.Errorf("labels require type and id")
+		}
+	default:
+		return util.Errorf("unknown kind %q", d.Kind)
+	}
+	return nil
+}
+
+func validStrategy(strategy string) error {
+	switch rc_fields.Strategy(strategy) {
+	case rc_fields.StaticStrategy, rc_fields.DynamicStrategy:
+		return nil
+	}
+	return util.Errorf("allocation_strategy must be %s or %s", rc_fields.StaticStrategy, rc_fields.DynamicStrategy)
+}
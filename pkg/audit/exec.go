@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// ExecStartedEvent signifies that a user started running a command in
+	// a pod through the preparer.
+	ExecStartedEvent EventType = "EXEC_STARTED"
+
+	// ExecFinishedEvent signifies that a command started through the
+	// preparer exited or was killed because the user disconnected.
+	ExecFinishedEvent EventType = "EXEC_FINISHED"
+)
+
+// ExecDetails defines a JSON structure for the details of a remote exec
+// session. The exit code and duration are only set for ExecFinishedEvent.
+type ExecDetails struct {
+	Node         types.NodeName      `json:"node"`
+	PodID        types.PodID         `json:"pod_id"`
+	PodUniqueKey types.PodUniqueKey  `json:"pod_unique_key,omitempty"`
+	LaunchableID launch.LaunchableID `json:"launchable_id,omitempty"`
+	Command      []string            `json:"command"`
+
+	// User is the common name of the verified client certificate the
+	// session was started with, and RemoteAddr the address it connected
+	// from
+	User       string `json:"user"`
+	RemoteAddr string `json:"remote_addr"`
+
+	ExitCode *int          `json:"exit_code,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+func NewExecDetails(details ExecDetails) (json.RawMessage, error) {
+	detailBytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal exec event as json: %s", err)
+	}
+
+	return json.RawMessage(detailBytes), nil
+}
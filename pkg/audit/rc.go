@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	pc_fields "github.com/square/p2/pkg/pc/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 )
@@ -16,6 +17,7 @@ const (
 )
 
 type RCRetargetingDetails struct {
+	RCID             rc_fields.ID               `json:"rc_id"`
 	PodID            types.PodID                `json:"pod_id"`
 	AvailabilityZone pc_fields.AvailabilityZone `json:"availability_zone"`
 	ClusterName      pc_fields.ClusterName      `json:"cluster_name"`
@@ -23,12 +25,14 @@ type RCRetargetingDetails struct {
 }
 
 func NewRCRetargetingEventDetails(
+	rcID rc_fields.ID,
 	podID types.PodID,
 	az pc_fields.AvailabilityZone,
 	name pc_fields.ClusterName,
 	nodes []types.NodeName,
 ) (json.RawMessage, error) {
 	details := RCRetargetingDetails{
+		RCID:             rcID,
 		PodID:            podID,
 		AvailabilityZone: az,
 		ClusterName:      name,
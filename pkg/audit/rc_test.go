@@ -6,16 +6,18 @@ import (
 	"testing"
 
 	pc_fields "github.com/square/p2/pkg/pc/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/types"
 )
 
 func TestRCRetargetingEventDetails(t *testing.T) {
+	rcID := rc_fields.ID("some_rc_id")
 	podID := types.PodID("some_pod_id")
 	clusterName := pc_fields.ClusterName("some_cluster_name")
 	az := pc_fields.AvailabilityZone("some_availability_zone")
 	nodes := []types.NodeName{"node1", "node2"}
 
-	detailsJSON, err := NewRCRetargetingEventDetails(podID, az, clusterName, nodes)
+	detailsJSON, err := NewRCRetargetingEventDetails(rcID, podID, az, clusterName, nodes)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -26,6 +28,10 @@ func TestRCRetargetingEventDetails(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	if details.RCID != rcID {
+		t.Errorf("expected rc id to be %s but was %s", rcID, details.RCID)
+	}
+
 	if details.PodID != podID {
 		t.Errorf("expected pod id to be %s but was %s", podID, details.PodID)
 	}
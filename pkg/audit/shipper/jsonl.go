@@ -0,0 +1,203 @@
+package shipper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// JSONLSink appends records to a file, one JSON object per line. Once the file
+// would grow past maxBytes it is rotated to path.1, path.1 to path.2 and so on,
+// keeping maxBackups old files. A maxBytes of 0 disables rotation.
+type JSONLSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+var _ Sink = &JSONLSink{}
+var _ Querier = &JSONLSink{}
+
+func NewJSONLSink(path string, maxBytes int64, maxBackups int) (*JSONLSink, error) {
+	s := &JSONLSink{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxBackups: maxBackups,
+	}
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JSONLSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return util.Errorf("could not open %s: %s", s.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return util.Errorf("could not stat %s: %s", s.path, err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *JSONLSink) Write(records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return util.Errorf("could not marshal audit log record %s: %s", record.ID, err)
+		}
+		line = append(line, '\n')
+
+		if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+			err = s.rotate()
+			if err != nil {
+				return err
+			}
+		}
+
+		n, err := s.file.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return util.Errorf("could not write to %s: %s", s.path, err)
+		}
+	}
+
+	err := s.file.Sync()
+	if err != nil {
+		return util.Errorf("could not sync %s: %s", s.path, err)
+	}
+	return nil
+}
+
+// rotate shifts the backups along, dropping the oldest, and starts a new file
+func (s *JSONLSink) rotate() error {
+	err := s.file.Sync()
+	if err != nil {
+		return util.Errorf("could not sync %s: %s", s.path, err)
+	}
+	err = s.file.Close()
+	if err != nil {
+		return util.Errorf("could not close %s: %s", s.path, err)
+	}
+
+	if s.maxBackups > 0 {
+		for i := s.maxBackups - 1; i > 0; i-- {
+			err = os.Rename(backupPath(s.path, i), backupPath(s.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return util.Errorf("could not rotate %s: %s", backupPath(s.path, i), err)
+			}
+		}
+		err = os.Rename(s.path, backupPath(s.path, 1))
+	} else {
+		err = os.Remove(s.path)
+	}
+	if err != nil {
+		return util.Errorf("could not rotate %s: %s", s.path, err)
+	}
+
+	return s.open()
+}
+
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Query reads the records in the file and its backups. Records that were
+// shipped more than once are returned once.
+func (s *JSONLSink) Query(filter Filter) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ReadJSONL(s.path, filter)
+}
+
+// ReadJSONL returns the records matching filter in the file at path and its
+// rotated backups, oldest first. Duplicate records are returned once.
+func ReadJSONL(path string, filter Filter) ([]Record, error) {
+	paths, err := backupPaths(path)
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, path)
+
+	seen := make(map[string]bool)
+	var records []Record
+	for _, p := range paths {
+		file, err := os.Open(p)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, util.Errorf("could not open %s: %s", p, err)
+		}
+
+		decoder := json.NewDecoder(file)
+		for {
+			var record Record
+			err = decoder.Decode(&record)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				_ = file.Close()
+				return nil, util.Errorf("could not read audit log records from %s: %s", p, err)
+			}
+			if seen[record.ID.String()] || !filter.Matches(record) {
+				continue
+			}
+			seen[record.ID.String()] = true
+			records = append(records, record)
+		}
+		_ = file.Close()
+	}
+
+	sort.Stable(byTime(records))
+	return records, nil
+}
+
+func backupPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// backupPaths returns the rotated backups of path, oldest first
+func backupPaths(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, util.Errorf("could not list backups of %s: %s", path, err)
+	}
+
+	var numbers []int
+	for _, match := range matches {
+		i, err := strconv.Atoi(strings.TrimPrefix(match, path+"."))
+		if err == nil && i > 0 {
+			numbers = append(numbers, i)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+
+	paths := make([]string, len(numbers))
+	for j, i := range numbers {
+		paths[j] = backupPath(path, i)
+	}
+	return paths, nil
+}
@@ -0,0 +1,115 @@
+package shipper
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	ds_fields "github.com/square/p2/pkg/ds/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+)
+
+// Record is an audit log record along with the ID it had in Consul. The ID
+// lets sinks and their readers recognize records delivered more than once.
+type Record struct {
+	ID audit.ID `json:"id"`
+	audit.AuditLog
+}
+
+// commonDetails holds the fields shared by the details of several event
+// types that records can be searched by
+type commonDetails struct {
+	// Set by daemon set and exec events
+	User string `json:"user"`
+	// Set by rolling update creation events
+	Deployer string `json:"deployer"`
+	// Set by RC retargeting events
+	RCID string `json:"rc_id"`
+	// A rolling update's ID is that of the RC it is updating to
+	RollingUpdateID string `json:"rolling_update_id"`
+	DaemonSet       struct {
+		ID string `json:"id"`
+	} `json:"daemon_set"`
+}
+
+func (r Record) details() commonDetails {
+	var details commonDetails
+	if r.EventDetails != nil {
+		// records with details in an unexpected shape simply have no
+		// user, RC or DS
+		_ = json.Unmarshal(*r.EventDetails, &details)
+	}
+	return details
+}
+
+// User returns the user who caused the event, if the event type records one
+func (r Record) User() string {
+	details := r.details()
+	if details.User != "" {
+		return details.User
+	}
+	return details.Deployer
+}
+
+// RCID returns the ID of the RC the event is about, if the event type records
+// one. Rolling update events are about the RC being updated to.
+func (r Record) RCID() rc_fields.ID {
+	details := r.details()
+	if details.RCID != "" {
+		return rc_fields.ID(details.RCID)
+	}
+	return rc_fields.ID(details.RollingUpdateID)
+}
+
+// DSID returns the ID of the daemon set the event is about, if any
+func (r Record) DSID() ds_fields.ID {
+	return ds_fields.ID(r.details().DaemonSet.ID)
+}
+
+// Filter selects audit log records. Empty fields match every record.
+type Filter struct {
+	// Matches records of any of these event types
+	EventTypes []audit.EventType
+	User       string
+	RCID       rc_fields.ID
+	DSID       ds_fields.ID
+	// Matches records at or after Since and before Until
+	Since time.Time
+	Until time.Time
+}
+
+func (f Filter) Matches(r Record) bool {
+	if len(f.EventTypes) > 0 {
+		found := false
+		for _, eventType := range f.EventTypes {
+			if r.EventType == eventType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && r.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.Timestamp.Before(f.Until) {
+		return false
+	}
+	if f.User != "" && r.User() != f.User {
+		return false
+	}
+	if f.RCID != "" && r.RCID() != f.RCID {
+		return false
+	}
+	if f.DSID != "" && r.DSID() != f.DSID {
+		return false
+	}
+	return true
+}
+
+// Querier reads back the records a sink stored, oldest first.
+type Querier interface {
+	Query(filter Filter) ([]Record, error)
+}
@@ -0,0 +1,160 @@
+// Package shipper drains the audit log records written to Consul into sinks
+// that keep them for the long term, such as files, a sqlite database or an
+// HTTP endpoint. Records are only deleted from Consul once every sink has
+// accepted them, so each record is delivered at least once: a sink may see the
+// same record again if another sink or the deletion failed.
+package shipper
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/util"
+)
+
+// BatchSize is how many records are written to the sinks and deleted from the
+// source at a time. It matches the number of operations allowed in a consul
+// transaction.
+const BatchSize = 64
+
+// Source is where audit log records are drained from.
+type Source interface {
+	List() (map[audit.ID]audit.AuditLog, error)
+	// Delete removes records once they have been shipped. It is never
+	// passed more than BatchSize IDs.
+	Delete(ids []audit.ID) error
+}
+
+// Sink stores audit log records. Sinks must tolerate receiving a record they
+// have already stored.
+type Sink interface {
+	// Write stores records durably, returning only once they are safe.
+	Write(records []Record) error
+	Close() error
+}
+
+type consulSource struct {
+	store auditlogstore.ConsulStore
+	txner transaction.Txner
+}
+
+// NewConsulSource returns a Source reading the audit log records in store and
+// deleting them in a transaction.
+func NewConsulSource(store auditlogstore.ConsulStore, txner transaction.Txner) Source {
+	return consulSource{
+		store: store,
+		txner: txner,
+	}
+}
+
+func (c consulSource) List() (map[audit.ID]audit.AuditLog, error) {
+	return c.store.List()
+}
+
+func (c consulSource) Delete(ids []audit.ID) error {
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	for _, id := range ids {
+		err := c.store.Delete(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+	return transaction.MustCommit(ctx, c.txner)
+}
+
+type Shipper struct {
+	source Source
+	sinks  []Sink
+	logger logging.Logger
+}
+
+func NewShipper(source Source, sinks []Sink, logger logging.Logger) Shipper {
+	return Shipper{
+		source: source,
+		sinks:  sinks,
+		logger: logger,
+	}
+}
+
+// Ship drains the records currently in the source into every sink, oldest
+// first, and returns how many were shipped. Each batch is deleted from the
+// source only after all sinks have written it; a failure stops shipping and
+// leaves the failed batch in the source to be shipped again.
+func (s Shipper) Ship() (int, error) {
+	auditLogs, err := s.source.List()
+	if err != nil {
+		return 0, util.Errorf("could not list audit log records: %s", err)
+	}
+
+	records := make([]Record, 0, len(auditLogs))
+	for id, al := range auditLogs {
+		records = append(records, Record{ID: id, AuditLog: al})
+	}
+	sort.Sort(byTime(records))
+
+	shipped := 0
+	for len(records) > 0 {
+		batch := records
+		if len(batch) > BatchSize {
+			batch = batch[:BatchSize]
+		}
+		records = records[len(batch):]
+
+		for _, sink := range s.sinks {
+			err = sink.Write(batch)
+			if err != nil {
+				return shipped, util.Errorf("could not write audit log records: %s", err)
+			}
+		}
+
+		ids := make([]audit.ID, len(batch))
+		for i, record := range batch {
+			ids[i] = record.ID
+		}
+		err = s.source.Delete(ids)
+		if err != nil {
+			return shipped, util.Errorf("could not delete shipped audit log records: %s", err)
+		}
+		shipped += len(batch)
+	}
+	return shipped, nil
+}
+
+// Run ships records every interval until quit is closed.
+func (s Shipper) Run(interval time.Duration, quit <-chan struct{}) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-timer.C:
+		}
+
+		shipped, err := s.Ship()
+		if err != nil {
+			s.logger.WithError(err).Errorln("Could not ship audit log records")
+		}
+		if shipped > 0 {
+			s.logger.WithField("shipped", shipped).Infoln("Shipped audit log records")
+		}
+		timer.Reset(interval)
+	}
+}
+
+type byTime []Record
+
+func (b byTime) Len() int      { return len(b) }
+func (b byTime) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byTime) Less(i, j int) bool {
+	if b[i].Timestamp.Equal(b[j].Timestamp) {
+		return b[i].ID < b[j].ID
+	}
+	return b[i].Timestamp.Before(b[j].Timestamp)
+}
@@ -0,0 +1,225 @@
+package shipper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	ds_fields "github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pborman/uuid"
+)
+
+type fakeSource struct {
+	auditLogs map[audit.ID]audit.AuditLog
+	deleteErr error
+}
+
+func (f *fakeSource) List() (map[audit.ID]audit.AuditLog, error) {
+	ret := make(map[audit.ID]audit.AuditLog)
+	for id, al := range f.auditLogs {
+		ret[id] = al
+	}
+	return ret, nil
+}
+
+func (f *fakeSource) Delete(ids []audit.ID) error {
+	if f.deleteErr != nil {
+		return f.deleteErr
+	}
+	for _, id := range ids {
+		delete(f.auditLogs, id)
+	}
+	return nil
+}
+
+type fakeSink struct {
+	records []Record
+	err     error
+}
+
+func (f *fakeSink) Write(records []Record) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.records = append(f.records, records...)
+	return nil
+}
+
+func (f *fakeSink) Close() error { return nil }
+
+func testAuditLog(eventType audit.EventType, details string, timestamp time.Time) audit.AuditLog {
+	raw := json.RawMessage(details)
+	return audit.AuditLog{
+		EventType:     eventType,
+		EventDetails:  &raw,
+		Timestamp:     timestamp,
+		SchemaVersion: audit.SchemaVersion(audit.CurrentSchemaVersion),
+	}
+}
+
+func testSource(n int, start time.Time) *fakeSource {
+	source := &fakeSource{auditLogs: make(map[audit.ID]audit.AuditLog)}
+	for i := 0; i < n; i++ {
+		details := fmt.Sprintf(`{"daemon_set": {"id": "ds-%d"}, "user": "user-%d"}`, i, i%2)
+		source.auditLogs[audit.ID(uuid.New())] = testAuditLog(audit.DSModifiedEvent, details, start.Add(time.Duration(i)*time.Second))
+	}
+	return source
+}
+
+func TestShipWritesEverySinkInOrder(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := testSource(BatchSize+10, start)
+	sink1, sink2 := &fakeSink{}, &fakeSink{}
+
+	shipped, err := NewShipper(source, []Sink{sink1, sink2}, logging.TestLogger()).Ship()
+	if err != nil {
+		t.Fatalf("unexpected error shipping: %s", err)
+	}
+	if shipped != BatchSize+10 {
+		t.Errorf("expected %d records to be shipped but %d were", BatchSize+10, shipped)
+	}
+	if len(source.auditLogs) != 0 {
+		t.Errorf("expected shipped records to be deleted but %d remain", len(source.auditLogs))
+	}
+
+	for _, sink := range []*fakeSink{sink1, sink2} {
+		if len(sink.records) != BatchSize+10 {
+			t.Fatalf("expected the sink to get %d records but it got %d", BatchSize+10, len(sink.records))
+		}
+		for i, record := range sink.records {
+			if !record.Timestamp.Equal(start.Add(time.Duration(i) * time.Second)) {
+				t.Fatalf("expected records oldest first, but record %d was from %s", i, record.Timestamp)
+			}
+		}
+	}
+}
+
+func TestShipKeepsRecordsWhenASinkFails(t *testing.T) {
+	source := testSource(3, time.Now())
+	good, bad := &fakeSink{}, &fakeSink{err: errors.New("disk full")}
+	shipper := NewShipper(source, []Sink{good, bad}, logging.TestLogger())
+
+	_, err := shipper.Ship()
+	if err == nil {
+		t.Fatal("expected an error when a sink fails")
+	}
+	if len(source.auditLogs) != 3 {
+		t.Fatalf("expected no records to be deleted when a sink fails but %d remain", len(source.auditLogs))
+	}
+
+	// once the sink recovers everything is shipped again, so the sink
+	// that succeeded sees the records twice
+	bad.err = nil
+	shipped, err := shipper.Ship()
+	if err != nil {
+		t.Fatalf("unexpected error shipping: %s", err)
+	}
+	if shipped != 3 || len(bad.records) != 3 || len(good.records) != 6 {
+		t.Errorf("expected the records to be shipped again, shipped %d, sinks got %d and %d", shipped, len(good.records), len(bad.records))
+	}
+}
+
+func TestShipKeepsRecordsWhenDeleteFails(t *testing.T) {
+	source := testSource(3, time.Now())
+	source.deleteErr = errors.New("consul unavailable")
+	sink := &fakeSink{}
+
+	_, err := NewShipper(source, []Sink{sink}, logging.TestLogger()).Ship()
+	if err == nil {
+		t.Fatal("expected an error when deletion fails")
+	}
+	if len(source.auditLogs) != 3 || len(sink.records) != 3 {
+		t.Errorf("expected records to be written and kept, %d written and %d kept", len(sink.records), len(source.auditLogs))
+	}
+}
+
+// fakeTxner just records the operations it gets
+type fakeTxner struct {
+	ops api.KVTxnOps
+}
+
+func (f *fakeTxner) Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	f.ops = txn
+	return true, new(api.KVTxnResponse), new(api.QueryMeta), nil
+}
+
+func TestConsulSourceDeletesInATransaction(t *testing.T) {
+	txner := &fakeTxner{}
+	source := NewConsulSource(auditlogstore.NewConsulStore(nil), txner)
+
+	ids := []audit.ID{audit.ID(uuid.New()), audit.ID(uuid.New())}
+	err := source.Delete(ids)
+	if err != nil {
+		t.Fatalf("unexpected error deleting: %s", err)
+	}
+	if len(txner.ops) != 2 {
+		t.Fatalf("expected a deletion per record but there were %d operations", len(txner.ops))
+	}
+	for _, op := range txner.ops {
+		if op.Verb != api.KVDelete {
+			t.Errorf("expected a delete but got %s", op.Verb)
+		}
+	}
+
+	err = source.Delete([]audit.ID{"not-a-uuid"})
+	if err == nil {
+		t.Error("expected an error deleting an invalid ID")
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	now := time.Now()
+	dsRecord := Record{
+		ID:       "1",
+		AuditLog: testAuditLog(audit.DSCreatedEvent, `{"daemon_set": {"id": "some-ds"}, "user": "alice"}`, now),
+	}
+	ruRecord := Record{
+		ID:       "2",
+		AuditLog: testAuditLog(audit.RUCreationEvent, `{"deployer": "bob", "rolling_update_id": "some-rc"}`, now),
+	}
+
+	if dsRecord.User() != "alice" || dsRecord.DSID() != ds_fields.ID("some-ds") || dsRecord.RCID() != "" {
+		t.Errorf("wrong fields for the daemon set record: %q %q %q", dsRecord.User(), dsRecord.DSID(), dsRecord.RCID())
+	}
+	if ruRecord.User() != "bob" || ruRecord.RCID() != "some-rc" {
+		t.Errorf("wrong fields for the rolling update record: %q %q", ruRecord.User(), ruRecord.RCID())
+	}
+	retargetRecord := Record{
+		ID:       "3",
+		AuditLog: testAuditLog(audit.RCRetargetingEvent, `{"rc_id": "some-rc", "nodes": ["node1"]}`, now),
+	}
+	if !(Filter{RCID: "some-rc"}).Matches(retargetRecord) {
+		t.Errorf("expected the RC filter to match the retargeting record, its RC was %q", retargetRecord.RCID())
+	}
+
+	tests := []struct {
+		filter   Filter
+		matchDS  bool
+		matchRU  bool
+		testName string
+	}{
+		{Filter{}, true, true, "empty filter"},
+		{Filter{EventTypes: []audit.EventType{audit.RUCreationEvent, audit.RUCompletionEvent}}, false, true, "event type"},
+		{Filter{User: "alice"}, true, false, "user"},
+		{Filter{RCID: "some-rc"}, false, true, "rc"},
+		{Filter{DSID: "some-ds"}, true, false, "ds"},
+		{Filter{Since: now}, true, true, "since"},
+		{Filter{Until: now}, false, false, "until"},
+		{Filter{Since: now.Add(-time.Hour), Until: now.Add(time.Hour)}, true, true, "time range"},
+	}
+	for _, test := range tests {
+		if test.filter.Matches(dsRecord) != test.matchDS {
+			t.Errorf("%s: expected a match of the daemon set record to be %t", test.testName, test.matchDS)
+		}
+		if test.filter.Matches(ruRecord) != test.matchRU {
+			t.Errorf("%s: expected a match of the rolling update record to be %t", test.testName, test.matchRU)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package shipper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/logging"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "audit_shipper_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func testRecords(start time.Time) []Record {
+	return []Record{
+		{ID: "a", AuditLog: testAuditLog(audit.DSCreatedEvent, `{"daemon_set": {"id": "some-ds"}, "user": "alice"}`, start)},
+		{ID: "b", AuditLog: testAuditLog(audit.RUCreationEvent, `{"deployer": "bob", "rolling_update_id": "some-rc"}`, start.Add(time.Minute))},
+		{ID: "c", AuditLog: testAuditLog(audit.DSDeletedEvent, `{"daemon_set": {"id": "some-ds"}, "user": "bob"}`, start.Add(2*time.Minute))},
+	}
+}
+
+func recordIDs(records []Record) []audit.ID {
+	ids := make([]audit.ID, len(records))
+	for i, record := range records {
+		ids[i] = record.ID
+	}
+	return ids
+}
+
+func assertIDs(t *testing.T, records []Record, expected ...audit.ID) {
+	ids := recordIDs(records)
+	if len(ids) != len(expected) {
+		t.Fatalf("expected records %v but got %v", expected, ids)
+	}
+	for i := range ids {
+		if ids[i] != expected[i] {
+			t.Fatalf("expected records %v but got %v", expected, ids)
+		}
+	}
+}
+
+func TestJSONLSinkRotates(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "audit.jsonl")
+
+	// small enough that every record starts a new file
+	sink, err := NewJSONLSink(path, 10, 1)
+	if err != nil {
+		t.Fatalf("Could not open sink: %s", err)
+	}
+	defer sink.Close()
+
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = sink.Write(testRecords(start))
+	if err != nil {
+		t.Fatalf("Could not write records: %s", err)
+	}
+
+	if _, err = os.Stat(path + ".1"); err != nil {
+		t.Errorf("expected a backup: %s", err)
+	}
+	if _, err = os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Errorf("expected only one backup to be kept")
+	}
+
+	records, err := sink.Query(Filter{})
+	if err != nil {
+		t.Fatalf("Could not read records: %s", err)
+	}
+	assertIDs(t, records, "b", "c")
+}
+
+func TestJSONLSinkQuery(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "audit.jsonl")
+
+	sink, err := NewJSONLSink(path, 0, 0)
+	if err != nil {
+		t.Fatalf("Could not open sink: %s", err)
+	}
+	defer sink.Close()
+
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := testRecords(start)
+	// the first record was shipped twice
+	err = sink.Write(records[:1])
+	if err != nil {
+		t.Fatalf("Could not write records: %s", err)
+	}
+	err = sink.Write(records)
+	if err != nil {
+		t.Fatalf("Could not write records: %s", err)
+	}
+
+	found, err := ReadJSONL(path, Filter{})
+	if err != nil {
+		t.Fatalf("Could not read records: %s", err)
+	}
+	assertIDs(t, found, "a", "b", "c")
+	if found[1].User() != "bob" || !found[1].Timestamp.Equal(start.Add(time.Minute)) {
+		t.Errorf("record didn't survive a round trip: %+v", found[1])
+	}
+
+	found, err = ReadJSONL(path, Filter{User: "bob", Since: start.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("Could not read records: %s", err)
+	}
+	assertIDs(t, found, "b", "c")
+}
+
+func TestSQLiteSink(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	sink, err := NewSQLiteSink(filepath.Join(dir, "audit.db"), logging.TestLogger())
+	if err != nil {
+		t.Fatalf("Could not open sink: %s", err)
+	}
+	defer sink.Close()
+
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := testRecords(start)
+	err = sink.Write(records[:2])
+	if err != nil {
+		t.Fatalf("Could not write records: %s", err)
+	}
+	// records shipped again are ignored
+	err = sink.Write(records)
+	if err != nil {
+		t.Fatalf("Could not write records: %s", err)
+	}
+
+	found, err := sink.Query(Filter{})
+	if err != nil {
+		t.Fatalf("Could not query records: %s", err)
+	}
+	assertIDs(t, found, "a", "b", "c")
+	if found[0].DSID() != "some-ds" || found[0].EventType != audit.DSCreatedEvent || !found[0].Timestamp.Equal(start) {
+		t.Errorf("record didn't survive a round trip: %+v", found[0])
+	}
+
+	tests := []struct {
+		filter   Filter
+		expected []audit.ID
+	}{
+		{Filter{EventTypes: []audit.EventType{audit.DSCreatedEvent, audit.DSDeletedEvent}}, []audit.ID{"a", "c"}},
+		{Filter{User: "bob"}, []audit.ID{"b", "c"}},
+		{Filter{RCID: "some-rc"}, []audit.ID{"b"}},
+		{Filter{DSID: "some-ds", User: "alice"}, []audit.ID{"a"}},
+		{Filter{Since: start.Add(time.Minute), Until: start.Add(2 * time.Minute)}, []audit.ID{"b"}},
+	}
+	for _, test := range tests {
+		found, err = sink.Query(test.filter)
+		if err != nil {
+			t.Fatalf("Could not query records: %s", err)
+		}
+		assertIDs(t, found, test.expected...)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received []Record
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := json.NewDecoder(r.Body).Decode(&received)
+		if err != nil {
+			t.Errorf("webhook body was not a list of records: %s", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, http.DefaultClient)
+	err := sink.Write(testRecords(time.Now()))
+	if err != nil {
+		t.Fatalf("Could not post records: %s", err)
+	}
+	assertIDs(t, received, "a", "b", "c")
+
+	status = http.StatusServiceUnavailable
+	err = sink.Write(testRecords(time.Now()))
+	if err == nil {
+		t.Error("expected an error when the webhook fails")
+	}
+}
@@ -0,0 +1,248 @@
+package shipper
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteSink stores records in a sqlite database, keyed by ID so that records
+// shipped more than once are only stored once. The user, RC and DS of each
+// record are kept in their own columns so they can be queried.
+type SQLiteSink struct {
+	db     *sql.DB
+	logger logging.Logger
+}
+
+var _ Sink = SQLiteSink{}
+var _ Querier = SQLiteSink{}
+
+// NewSQLiteSink opens the database at sqliteDBPath and runs any outstanding
+// migrations
+func NewSQLiteSink(sqliteDBPath string, logger logging.Logger) (SQLiteSink, error) {
+	db, err := sql.Open("sqlite3", sqliteDBPath)
+	if err != nil {
+		return SQLiteSink{}, util.Errorf("Could not open database: %s", err)
+	}
+
+	s := SQLiteSink{
+		db:     db,
+		logger: logger,
+	}
+	err = s.migrate()
+	if err != nil {
+		_ = db.Close()
+		return SQLiteSink{}, err
+	}
+	return s, nil
+}
+
+// Not considered a migration
+const (
+	getSchemaVersionQuery        = `select version from schema_version;`
+	updateSchemaVersionStatement = `update schema_version set version = ?;`
+
+	// This will always be run, and is idempotent
+	sqliteCreateSchemaVersionTable = `create table if not exists schema_version ( version integer );`
+
+	// This should only be run if no rows are returned when checking for the
+	// written schema_version, which should only happen if the schema
+	// version table was just created
+	sqliteInitializeSchemaVersionTable = `insert into schema_version(version) values ( 0 );`
+)
+
+var (
+	sqliteMigrations = []string{
+		`create table audit_logs (
+	    id text not null primary key,
+	    event_type text not null,
+	    date datetime not null,
+	    user text not null,
+	    rc_id text not null,
+	    ds_id text not null,
+	    schema_version integer not null,
+	    details text not null
+	);`,
+		"create index audit_log_date on audit_logs(date);",
+		"create index audit_log_event_type on audit_logs(event_type, date);",
+		// FUTURE MIGRATIONS GO HERE
+	}
+)
+
+func (s SQLiteSink) migrate() (err error) {
+	// idempotent
+	_, err = s.db.Exec(sqliteCreateSchemaVersionTable)
+	if err != nil {
+		return util.Errorf("Could not set up schema_version table: %s", err)
+	}
+
+	var lastSchemaVersion int64
+	err = s.db.QueryRow(getSchemaVersionQuery).Scan(&lastSchemaVersion)
+	switch {
+	case err == sql.ErrNoRows:
+		// We just created the table, insert a row with 0
+		_, err = s.db.Exec(sqliteInitializeSchemaVersionTable)
+		if err != nil {
+			return util.Errorf("Could not initialize schema_version table: %s", err)
+		}
+	case err != nil:
+		return util.Errorf("Error checking schema version: %s", err)
+	}
+
+	if lastSchemaVersion == int64(len(sqliteMigrations)) {
+		// we're caught up
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return util.Errorf("Could not start transaction for migrations: %s", err)
+	}
+
+	defer func() {
+		if err == nil {
+			// return the commit error by assigning to return variable
+			err = tx.Commit()
+		} else {
+			// return the original error not the rollback error
+			_ = tx.Rollback()
+		}
+	}()
+
+	for i := lastSchemaVersion; i < int64(len(sqliteMigrations)); i++ {
+		_, err = tx.Exec(sqliteMigrations[i])
+		if err != nil {
+			return util.Errorf("Could not apply migration %d: %s", i+1, err)
+		}
+	}
+
+	_, err = tx.Exec(updateSchemaVersionStatement, int64(len(sqliteMigrations)))
+	if err != nil {
+		s.logger.WithError(err).Errorln("Could not update schema_version table")
+	}
+
+	return err
+}
+
+func (s SQLiteSink) Write(records []Record) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return util.Errorf("Could not start transaction: %s", err)
+	}
+	defer func() {
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, record := range records {
+		details := ""
+		if record.EventDetails != nil {
+			details = string(*record.EventDetails)
+		}
+		_, err = tx.Exec(`insert or ignore into audit_logs(
+		    id,
+		    event_type,
+		    date,
+		    user,
+		    rc_id,
+		    ds_id,
+		    schema_version,
+		    details
+		  ) VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+			record.ID.String(),
+			record.EventType.String(),
+			record.Timestamp.UTC(),
+			record.User(),
+			record.RCID().String(),
+			record.DSID().String(),
+			record.SchemaVersion.Int(),
+			details,
+		)
+		if err != nil {
+			return util.Errorf("Couldn't insert audit log record %s into sqlite database: %s", record.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s SQLiteSink) Close() error {
+	return s.db.Close()
+}
+
+func (s SQLiteSink) Query(filter Filter) ([]Record, error) {
+	var where []string
+	var args []interface{}
+	if len(filter.EventTypes) > 0 {
+		placeholders := make([]string, len(filter.EventTypes))
+		for i, eventType := range filter.EventTypes {
+			placeholders[i] = "?"
+			args = append(args, eventType.String())
+		}
+		where = append(where, "event_type in ("+strings.Join(placeholders, ", ")+")")
+	}
+	if filter.User != "" {
+		where = append(where, "user = ?")
+		args = append(args, filter.User)
+	}
+	if filter.RCID != "" {
+		where = append(where, "rc_id = ?")
+		args = append(args, filter.RCID.String())
+	}
+	if filter.DSID != "" {
+		where = append(where, "ds_id = ?")
+		args = append(args, filter.DSID.String())
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "date >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "date < ?")
+		args = append(args, filter.Until.UTC())
+	}
+
+	query := "SELECT id, event_type, date, schema_version, details FROM audit_logs"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY date, id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, util.Errorf("Could not query for audit log records: %s", err)
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var id, eventType, details string
+		var date time.Time
+		var schemaVersion int
+		err = rows.Scan(&id, &eventType, &date, &schemaVersion, &details)
+		if err != nil {
+			return nil, util.Errorf("Could not scan row: %s", err)
+		}
+
+		raw := json.RawMessage(details)
+		records = append(records, Record{
+			ID: audit.ID(id),
+			AuditLog: audit.AuditLog{
+				EventType:     audit.EventType(eventType),
+				EventDetails:  &raw,
+				Timestamp:     date,
+				SchemaVersion: audit.SchemaVersion(schemaVersion),
+			},
+		})
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,52 @@
+package shipper
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// WebhookSink posts each batch of records to a URL as a JSON array. Any 2xx
+// response means the records were accepted. Receivers should use the record
+// IDs to discard records they have already seen.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+var _ Sink = WebhookSink{}
+
+func NewWebhookSink(url string, client *http.Client) WebhookSink {
+	return WebhookSink{
+		url:    url,
+		client: client,
+	}
+}
+
+func (w WebhookSink) Write(records []Record) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return util.Errorf("could not marshal audit log records: %s", err)
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return util.Errorf("could not post audit log records to %s: %s", w.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	respBytes, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return util.Errorf("%d response from %s: %s", resp.StatusCode, w.url, string(respBytes))
+}
+
+func (w WebhookSink) Close() error {
+	return nil
+}
@@ -0,0 +1,362 @@
+// Package configmap resolves the config maps that pod manifests reference into
+// the config their pods see, and keeps replication controllers and daemon
+// sets that follow a config map pinned to its current version.
+package configmap
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	dsfields "github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	pcfields "github.com/square/p2/pkg/pc/fields"
+	rcfields "github.com/square/p2/pkg/rc/fields"
+	rollfields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/configmapstore"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// How often the follower compares the config maps that replication
+// controllers and daemon sets follow against their current versions
+const DefaultFollowInterval = 30 * time.Second
+
+type Store interface {
+	Get(name string, sha string) (configmapstore.ConfigMap, error)
+	CurrentSHAs() (map[string]string, error)
+}
+
+// Resolver merges config maps into the config of pods.
+type Resolver struct {
+	store Store
+}
+
+func NewResolver(store Store) Resolver {
+	return Resolver{
+		store: store,
+	}
+}
+
+// Resolve returns the config of the manifest with the config maps it
+// references merged in. Config maps are merged in order, so later ones
+// override the keys of earlier ones, and the manifest's own config overrides
+// them all. The manifest is not modified.
+//
+// Signed manifests must pin every config map they reference to a SHA: an
+// unpinned reference resolves to whatever version is current, which the
+// signature doesn't cover.
+func (r Resolver) Resolve(podManifest manifest.Manifest) (map[interface{}]interface{}, error) {
+	refs := podManifest.GetConfigMaps()
+	if plaintext, _ := podManifest.SignatureData(); plaintext != nil {
+		for _, ref := range refs {
+			if ref.SHA == "" {
+				return nil, util.Errorf("%s is signed but does not pin config map %s to a SHA", podManifest.ID(), ref.Name)
+			}
+		}
+	}
+
+	resolved := make(map[interface{}]interface{})
+	for _, ref := range refs {
+		configMap, err := r.store.Get(ref.Name, ref.SHA)
+		if err != nil {
+			return nil, util.Errorf("Could not resolve config map %s: %s", ref.Name, err)
+		}
+		if ref.Key != "" {
+			resolved[ref.Key] = configMap.Data
+			continue
+		}
+		for key, value := range configMap.Data {
+			resolved[key] = value
+		}
+	}
+	for key, value := range podManifest.GetConfig() {
+		resolved[key] = value
+	}
+	return resolved, nil
+}
+
+// FollowCurrent returns the manifest with the config map references that have
+// Follow set pinned to the current SHAs, keyed by config map name, and whether
+// that changed the manifest. References to config maps that don't exist are
+// left alone.
+func FollowCurrent(podManifest manifest.Manifest, current map[string]string) (manifest.Manifest, bool) {
+	refs := podManifest.GetConfigMaps()
+	followed := make([]manifest.ConfigMapRef, len(refs))
+	changed := false
+	for i, ref := range refs {
+		followed[i] = ref
+		sha, ok := current[ref.Name]
+		if !ref.Follow || !ok || ref.SHA == sha {
+			continue
+		}
+		followed[i].SHA = sha
+		changed = true
+	}
+	if !changed {
+		return podManifest, false
+	}
+	builder := podManifest.GetBuilder()
+	builder.SetConfigMaps(followed)
+	return builder.GetManifest(), true
+}
+
+type RCStore interface {
+	List() ([]rcfields.RC, error)
+}
+
+type RollStore interface {
+	List() ([]rollfields.Update, error)
+	CreateRollingUpdateFromOneExistingRCWithID(
+		ctx context.Context,
+		oldRCID rcfields.ID,
+		desiredReplicas int,
+		minimumReplicas int,
+		leaveOld bool,
+		rollDelay time.Duration,
+		availabilityZone pcfields.AvailabilityZone,
+		clusterName pcfields.ClusterName,
+		newRCManifest manifest.Manifest,
+		newRCNodeSelector klabels.Selector,
+		newRCPodLabels klabels.Set,
+		newRCLabels klabels.Set,
+		rollLabels klabels.Set,
+		newAllocationStrategy rcfields.Strategy,
+	) (rollfields.Update, error)
+}
+
+type RCLabeler interface {
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+}
+
+// RCStores are what the follower needs to roll replication controllers to
+// new versions of their config maps.
+type RCStores struct {
+	RCs     RCStore
+	Rolls   RollStore
+	Labeler RCLabeler
+	Txner   transaction.Txner
+}
+
+type SessionStore interface {
+	NewUnmanagedSession(session, name string) consul.Session
+}
+
+type DSStore interface {
+	List() ([]dsfields.DaemonSet, error)
+	MutateDS(id dsfields.ID, mutator func(dsfields.DaemonSet) (dsfields.DaemonSet, error)) (dsfields.DaemonSet, error)
+}
+
+// Follower updates the manifests of replication controllers and daemon sets
+// whose config map references have Follow set whenever one of those config
+// maps changes. Replication controllers are replaced by a rolling update to a
+// new replication controller with the updated manifest, which replaces their
+// pods one at a time. Daemon sets roll the new manifest out node by node.
+//
+// Signed manifests are never updated, since that would discard their
+// signature: a signed manifest that follows a config map stays on the version
+// it was signed with, and a warning is logged every time it is found behind.
+// Re-sign and redeploy such manifests to move them to a new version.
+type Follower struct {
+	configMaps Store
+	// either may be nil, e.g. when only daemon sets are followed
+	rcStores *RCStores
+	dsStore  DSStore
+	interval time.Duration
+	logger   logging.Logger
+}
+
+func NewFollower(configMaps Store, rcStores *RCStores, dsStore DSStore, interval time.Duration, logger logging.Logger) *Follower {
+	if interval <= 0 {
+		interval = DefaultFollowInterval
+	}
+	return &Follower{
+		configMaps: configMaps,
+		rcStores:   rcStores,
+		dsStore:    dsStore,
+		interval:   interval,
+		logger:     logger,
+	}
+}
+
+// RunLocked follows config maps until quit is closed, but only while it holds
+// the lock of the followers called name. Only one of several instances of a
+// server that run a follower of the same name follows at a time; the others
+// wait for the lock. sessions supplies the Consul sessions to lock with.
+func (f *Follower) RunLocked(name string, sessions <-chan string, sessionStore SessionStore, quit <-chan struct{}) {
+	lockKey := path.Join(consul.LOCK_TREE, "config_map_follower", name)
+	consulutil.WithSession(quit, sessions, func(sessionQuit <-chan struct{}, sessionID string) {
+		session := sessionStore.NewUnmanagedSession(sessionID, "")
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for {
+			unlocker, err := session.Lock(lockKey)
+			if err == nil {
+				f.logger.WithField("lock", lockKey).Infoln("Acquired config map follower lock")
+				f.Run(sessionQuit)
+				_ = unlocker.Unlock()
+				return
+			}
+			if _, ok := err.(consul.AlreadyLockedError); !ok {
+				f.logger.WithError(err).Errorln("Could not lock config map follower")
+			}
+			select {
+			case <-sessionQuit:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// Run follows config maps until quit is closed.
+func (f *Follower) Run(quit <-chan struct{}) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		err := f.Follow()
+		if err != nil {
+			f.logger.WithError(err).Errorln("Could not follow config maps")
+		}
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Follow updates every replication controller and daemon set that follows a
+// config map whose current version it doesn't reference yet.
+func (f *Follower) Follow() error {
+	current, err := f.configMaps.CurrentSHAs()
+	if err != nil {
+		return err
+	}
+
+	if f.rcStores != nil {
+		err = f.followRCs(current)
+		if err != nil {
+			return err
+		}
+	}
+
+	if f.dsStore != nil {
+		dss, err := f.dsStore.List()
+		if err != nil {
+			return err
+		}
+		for _, ds := range dss {
+			if _, changed := f.follow(ds.Manifest, current); !changed {
+				continue
+			}
+			_, err = f.dsStore.MutateDS(ds.ID, func(ds dsfields.DaemonSet) (dsfields.DaemonSet, error) {
+				ds.Manifest, _ = f.follow(ds.Manifest, current)
+				return ds, nil
+			})
+			if err != nil {
+				f.logger.WithError(err).WithField("ds", ds.ID).Errorln("Could not update the config maps of daemon set")
+				continue
+			}
+			f.logger.WithField("ds", ds.ID).Infoln("Updated daemon set to the current versions of its config maps")
+		}
+	}
+	return nil
+}
+
+// followRCs starts a rolling update of every replication controller that
+// follows a config map that changed, unless it is already part of one.
+func (f *Follower) followRCs(current map[string]string) error {
+	rcs, err := f.rcStores.RCs.List()
+	if err != nil {
+		return err
+	}
+	updates, err := f.rcStores.Rolls.List()
+	if err != nil {
+		return err
+	}
+	updating := make(map[rcfields.ID]bool)
+	for _, update := range updates {
+		updating[update.OldRC] = true
+		updating[update.NewRC] = true
+	}
+
+	for _, rc := range rcs {
+		if updating[rc.ID] || rc.Disabled {
+			continue
+		}
+		followed, changed := f.follow(rc.Manifest, current)
+		if !changed {
+			continue
+		}
+		logger := f.logger.SubLogger(logrus.Fields{"rc": rc.ID})
+		update, err := f.rollRC(rc, followed)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not start a rolling update to the current versions of the replication controller's config maps")
+			continue
+		}
+		logger.WithField("new_rc", update.NewRC).Infoln("Started a rolling update to the current versions of the replication controller's config maps")
+	}
+	return nil
+}
+
+// rollRC creates a rolling update from rc to a new replication controller
+// that is identical except for its manifest
+func (f *Follower) rollRC(rc rcfields.RC, followed manifest.Manifest) (rollfields.Update, error) {
+	rcLabels, err := f.rcStores.Labeler.GetLabels(labels.RC, rc.ID.String())
+	if err != nil {
+		return rollfields.Update{}, err
+	}
+	minimum := rc.ReplicasDesired - 1
+	if minimum < 0 {
+		minimum = 0
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	update, err := f.rcStores.Rolls.CreateRollingUpdateFromOneExistingRCWithID(
+		ctx,
+		rc.ID,
+		rc.ReplicasDesired,
+		minimum,
+		false,
+		0,
+		pcfields.AvailabilityZone(rc.PodLabels[types.AvailabilityZoneLabel]),
+		pcfields.ClusterName(rc.PodLabels[types.ClusterNameLabel]),
+		followed,
+		rc.NodeSelector,
+		rc.PodLabels,
+		rcLabels.Labels,
+		nil,
+		rc.AllocationStrategy,
+	)
+	if err != nil {
+		return rollfields.Update{}, err
+	}
+	return update, transaction.MustCommit(ctx, f.rcStores.Txner)
+}
+
+func (f *Follower) follow(podManifest manifest.Manifest, current map[string]string) (manifest.Manifest, bool) {
+	if podManifest == nil {
+		return podManifest, false
+	}
+	followed, changed := FollowCurrent(podManifest, current)
+	if !changed {
+		return podManifest, false
+	}
+	if plaintext, _ := podManifest.SignatureData(); plaintext != nil {
+		f.logger.WithFields(logrus.Fields{
+			"pod": podManifest.ID(),
+		}).Warnln("Not updating the config maps of a signed manifest")
+		return podManifest, false
+	}
+	return followed, true
+}
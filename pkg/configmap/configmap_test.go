@@ -0,0 +1,240 @@
+package configmap
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	dsfields "github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	pcfields "github.com/square/p2/pkg/pc/fields"
+	rcfields "github.com/square/p2/pkg/rc/fields"
+	rollfields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul/configmapstore"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+type fakeRCStore struct {
+	rcs map[rcfields.ID]rcfields.RC
+}
+
+func (s *fakeRCStore) List() ([]rcfields.RC, error) {
+	var rcs []rcfields.RC
+	for _, rc := range s.rcs {
+		rcs = append(rcs, rc)
+	}
+	return rcs, nil
+}
+
+// fakeRollStore records the new RCs of the rolling updates it creates
+type fakeRollStore struct {
+	updates []rollfields.Update
+	newRCs  map[rcfields.ID]rcfields.RC
+	// the labels of the new RCs
+	rcLabels map[rcfields.ID]klabels.Set
+}
+
+func (s *fakeRollStore) List() ([]rollfields.Update, error) {
+	return s.updates, nil
+}
+
+func (s *fakeRollStore) CreateRollingUpdateFromOneExistingRCWithID(
+	ctx context.Context,
+	oldRCID rcfields.ID,
+	desiredReplicas int,
+	minimumReplicas int,
+	leaveOld bool,
+	rollDelay time.Duration,
+	availabilityZone pcfields.AvailabilityZone,
+	clusterName pcfields.ClusterName,
+	newRCManifest manifest.Manifest,
+	newRCNodeSelector klabels.Selector,
+	newRCPodLabels klabels.Set,
+	newRCLabels klabels.Set,
+	rollLabels klabels.Set,
+	newAllocationStrategy rcfields.Strategy,
+) (rollfields.Update, error) {
+	newRCID := rcfields.ID("new-" + oldRCID.String())
+	s.newRCs[newRCID] = rcfields.RC{
+		ID:                 newRCID,
+		Manifest:           newRCManifest,
+		NodeSelector:       newRCNodeSelector,
+		PodLabels:          newRCPodLabels,
+		AllocationStrategy: newAllocationStrategy,
+	}
+	s.rcLabels[newRCID] = newRCLabels
+	update := rollfields.Update{
+		OldRC:           oldRCID,
+		NewRC:           newRCID,
+		DesiredReplicas: desiredReplicas,
+		MinimumReplicas: minimumReplicas,
+		LeaveOld:        leaveOld,
+		RollDelay:       rollDelay,
+	}
+	s.updates = append(s.updates, update)
+	return update, nil
+}
+
+type fakeRCLabeler map[string]klabels.Set
+
+func (f fakeRCLabeler) GetLabels(labelType labels.Type, id string) (labels.Labeled, error) {
+	return labels.Labeled{LabelType: labelType, ID: id, Labels: f[id]}, nil
+}
+
+type fakeDSStore struct {
+	dss map[dsfields.ID]dsfields.DaemonSet
+}
+
+func (s *fakeDSStore) List() ([]dsfields.DaemonSet, error) {
+	var dss []dsfields.DaemonSet
+	for _, ds := range s.dss {
+		dss = append(dss, ds)
+	}
+	return dss, nil
+}
+
+func (s *fakeDSStore) MutateDS(id dsfields.ID, mutator func(dsfields.DaemonSet) (dsfields.DaemonSet, error)) (dsfields.DaemonSet, error) {
+	ds, err := mutator(s.dss[id])
+	if err != nil {
+		return dsfields.DaemonSet{}, err
+	}
+	s.dss[id] = ds
+	return ds, nil
+}
+
+func newStore() configmapstore.ConsulStore {
+	return configmapstore.NewConsul(consulutil.NewFakeClient().KV())
+}
+
+func manifestWithRefs(refs ...manifest.ConfigMapRef) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	builder.SetConfigMaps(refs)
+	return builder.GetManifest()
+}
+
+// signManifest returns the manifest clearsigned by a new key
+func signManifest(t *testing.T, podManifest manifest.Manifest) manifest.Manifest {
+	entity, err := openpgp.NewEntity("p2", "test", "p2@example.com", nil)
+	Assert(t).IsNil(err, "unexpected error creating signing key")
+	manifestBytes, err := podManifest.Marshal()
+	Assert(t).IsNil(err, "unexpected error marshaling manifest")
+
+	var buf bytes.Buffer
+	sigWriter, err := clearsign.Encode(&buf, entity.PrivateKey, nil)
+	Assert(t).IsNil(err, "unexpected error signing manifest")
+	_, err = sigWriter.Write(manifestBytes)
+	Assert(t).IsNil(err, "unexpected error signing manifest")
+	Assert(t).IsNil(sigWriter.Close(), "unexpected error signing manifest")
+
+	signed, err := manifest.FromBytes(buf.Bytes())
+	Assert(t).IsNil(err, "unexpected error parsing signed manifest")
+	return signed
+}
+
+func TestResolveMergesConfigMapsInOrder(t *testing.T) {
+	store := newStore()
+	first, err := store.Set("first", map[interface{}]interface{}{"a": 1, "b": 1})
+	Assert(t).IsNil(err, "unexpected error setting config map")
+	_, err = store.Set("second", map[interface{}]interface{}{"b": 2, "c": 2})
+	Assert(t).IsNil(err, "unexpected error setting config map")
+	// make a newer version of first current, which must not be used
+	_, err = store.Set("first", map[interface{}]interface{}{"a": 100})
+	Assert(t).IsNil(err, "unexpected error setting config map")
+	_, err = store.Set("nested", map[interface{}]interface{}{"host": "db"})
+	Assert(t).IsNil(err, "unexpected error setting config map")
+
+	refs := []manifest.ConfigMapRef{
+		{Name: "first", SHA: first.SHA},
+		{Name: "second"},
+		{Name: "nested", Key: "database"},
+	}
+	podManifest := manifestWithRefs(refs...)
+	builder := podManifest.GetBuilder()
+	err = builder.SetConfig(map[interface{}]interface{}{"c": 3})
+	Assert(t).IsNil(err, "unexpected error setting config")
+	podManifest = builder.GetManifest()
+	resolved, err := NewResolver(store).Resolve(podManifest)
+	Assert(t).IsNil(err, "unexpected error resolving config maps")
+
+	Assert(t).AreEqual(resolved["a"], 1, "pinned version of config map was not used")
+	Assert(t).AreEqual(resolved["b"], 2, "later config map should override earlier ones")
+	Assert(t).AreEqual(resolved["c"], 3, "pod config should override config maps")
+	nested, ok := resolved["database"].(map[interface{}]interface{})
+	Assert(t).IsTrue(ok, "config map with a key should be nested under it")
+	Assert(t).AreEqual(nested["host"], "db", "wrong nested config")
+	Assert(t).AreEqual(len(podManifest.GetConfig()), 1, "config should not be modified")
+
+	_, err = NewResolver(store).Resolve(manifestWithRefs(manifest.ConfigMapRef{Name: "missing"}))
+	Assert(t).IsNotNil(err, "expected an error resolving a missing config map")
+}
+
+func TestResolveRequiresSignedManifestsToPinConfigMaps(t *testing.T) {
+	store := newStore()
+	configMap, err := store.Set("db", map[interface{}]interface{}{"host": "db1"})
+	Assert(t).IsNil(err, "unexpected error setting config map")
+
+	unpinned := signManifest(t, manifestWithRefs(manifest.ConfigMapRef{Name: "db"}))
+	_, err = NewResolver(store).Resolve(unpinned)
+	Assert(t).IsNotNil(err, "expected a signed manifest with an unpinned config map to be rejected")
+
+	pinned := signManifest(t, manifestWithRefs(manifest.ConfigMapRef{Name: "db", SHA: configMap.SHA}))
+	resolved, err := NewResolver(store).Resolve(pinned)
+	Assert(t).IsNil(err, "unexpected error resolving a signed manifest with pinned config maps")
+	Assert(t).AreEqual(resolved["host"], "db1", "wrong config")
+}
+
+func TestFollowerPinsCurrentVersions(t *testing.T) {
+	store := newStore()
+	old, err := store.Set("shared", map[interface{}]interface{}{"a": 1})
+	Assert(t).IsNil(err, "unexpected error setting config map")
+	current, err := store.Set("shared", map[interface{}]interface{}{"a": 2})
+	Assert(t).IsNil(err, "unexpected error setting config map")
+
+	following := manifestWithRefs(manifest.ConfigMapRef{Name: "shared", SHA: old.SHA, Follow: true})
+	podLabels := klabels.Set{types.AvailabilityZoneLabel: "az1", types.ClusterNameLabel: "web"}
+	rcStore := &fakeRCStore{rcs: map[rcfields.ID]rcfields.RC{
+		"following": {ID: "following", Manifest: following, PodLabels: podLabels, ReplicasDesired: 3, NodeSelector: klabels.Everything()},
+		"pinned":    {ID: "pinned", Manifest: manifestWithRefs(manifest.ConfigMapRef{Name: "shared", SHA: old.SHA})},
+		"updating":  {ID: "updating", Manifest: following},
+	}}
+	rollStore := &fakeRollStore{
+		updates:  []rollfields.Update{{OldRC: "updating", NewRC: "other"}},
+		newRCs:   make(map[rcfields.ID]rcfields.RC),
+		rcLabels: make(map[rcfields.ID]klabels.Set),
+	}
+	rcStores := &RCStores{
+		RCs:     rcStore,
+		Rolls:   rollStore,
+		Labeler: fakeRCLabeler{"following": {"team": "web"}},
+		Txner:   consulutil.NewFakeClient().KV(),
+	}
+	dsStore := &fakeDSStore{dss: map[dsfields.ID]dsfields.DaemonSet{
+		"following": {ID: "following", Manifest: following},
+	}}
+
+	err = NewFollower(store, rcStores, dsStore, 0, logging.TestLogger()).Follow()
+	Assert(t).IsNil(err, "unexpected error following config maps")
+
+	Assert(t).AreEqual(len(rollStore.updates), 2, "expected a rolling update of only the following RC")
+	update := rollStore.updates[1]
+	Assert(t).AreEqual(update.OldRC, rcfields.ID("following"), "wrong RC was updated")
+	Assert(t).AreEqual(update.DesiredReplicas, 3, "the new RC should get the old one's replicas")
+	Assert(t).AreEqual(update.MinimumReplicas, 2, "expected pods to be replaced one at a time")
+	newRC := rollStore.newRCs[update.NewRC]
+	Assert(t).AreEqual(newRC.Manifest.GetConfigMaps()[0].SHA, current.SHA, "the new RC should use the current config map")
+	Assert(t).AreEqual(newRC.PodLabels[types.AvailabilityZoneLabel], "az1", "the new RC should keep the pod labels")
+	Assert(t).AreEqual(rollStore.rcLabels[update.NewRC]["team"], "web", "the new RC should keep the old one's labels")
+	Assert(t).AreEqual(rcStore.rcs["following"].Manifest.GetConfigMaps()[0].SHA, old.SHA, "the following RC should not be modified in place")
+	Assert(t).AreEqual(dsStore.dss["following"].Manifest.GetConfigMaps()[0].SHA, current.SHA, "following daemon set was not updated")
+}
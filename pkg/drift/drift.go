@@ -0,0 +1,345 @@
+// Package drift compares what p2 believes is deployed on a node with what is
+// actually there. p2-inspect only compares the intent and reality trees; the
+// Auditor additionally reads the pod homes on disk, asks the process supervisor about each
+// service and checks which launchable version is current, reporting every
+// discrepancy it finds.
+package drift
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/supervisor"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type Kind string
+
+const (
+	// The intent and reality trees disagree about a pod. This is expected
+	// while a deploy is in progress.
+	IntentMismatch Kind = "intent_mismatch"
+
+	// A pod is installed on disk but is not in the reality tree.
+	NotInReality Kind = "not_in_reality"
+
+	// A pod is in the reality tree but is not installed on disk.
+	NotOnDisk Kind = "not_on_disk"
+
+	// The current manifest on disk is not the one in the reality tree.
+	ManifestMismatch Kind = "manifest_mismatch"
+
+	// A launchable in the current manifest has not been installed.
+	LaunchableNotInstalled Kind = "launchable_not_installed"
+
+	// A launchable's "current" symlink points at a different version than
+	// the one in the current manifest.
+	LaunchableVersionMismatch Kind = "launchable_version_mismatch"
+
+	// A runit service for the pod is not running.
+	ServiceDown Kind = "service_down"
+)
+
+// Drift is a single discrepancy found on a node.
+type Drift struct {
+	Kind         Kind                `json:"kind"`
+	PodID        types.PodID         `json:"pod_id"`
+	LaunchableID launch.LaunchableID `json:"launchable_id,omitempty"`
+	Service      string              `json:"service,omitempty"`
+	Expected     string              `json:"expected,omitempty"`
+	Actual       string              `json:"actual,omitempty"`
+	Message      string              `json:"message,omitempty"`
+}
+
+// Report is the result of auditing one node.
+type Report struct {
+	Node     types.NodeName `json:"node"`
+	Time     time.Time      `json:"time"`
+	PodsSeen int            `json:"pods_seen"`
+	Drift    []Drift        `json:"drift"`
+}
+
+type ManifestLister interface {
+	ListPods(podPrefix consul.PodPrefix, nodeName types.NodeName) ([]consul.ManifestResult, time.Duration, error)
+}
+
+// Auditor inspects a single node. It must run on that node since it reads
+// the pod root and talks to the local process supervisor.
+type Auditor struct {
+	Node       types.NodeName
+	PodRoot    string
+	Store      ManifestLister
+	Supervisor supervisor.Supervisor
+}
+
+func NewAuditor(node types.NodeName, podRoot string, store ManifestLister) Auditor {
+	if podRoot == "" {
+		podRoot = pods.DefaultPath
+	}
+	return Auditor{
+		Node:       node,
+		PodRoot:    podRoot,
+		Store:      store,
+		Supervisor: supervisor.DefaultRunit,
+	}
+}
+
+// Audit collects every discrepancy between the intent tree, the reality tree
+// and the pods installed on this node. UUID pods are not audited since they
+// have no reality tree entry.
+func (a Auditor) Audit() (Report, error) {
+	report := Report{
+		Node:  a.Node,
+		Time:  time.Now(),
+		Drift: []Drift{},
+	}
+
+	intent, err := a.listLegacyPods(consul.INTENT_TREE)
+	if err != nil {
+		return Report{}, err
+	}
+	reality, err := a.listLegacyPods(consul.REALITY_TREE)
+	if err != nil {
+		return Report{}, err
+	}
+	installed, err := a.installedPods()
+	if err != nil {
+		return Report{}, err
+	}
+
+	podIDs := make(map[types.PodID]struct{})
+	for _, m := range []map[types.PodID]manifest.Manifest{intent, reality} {
+		for podID := range m {
+			podIDs[podID] = struct{}{}
+		}
+	}
+	for podID := range installed {
+		podIDs[podID] = struct{}{}
+	}
+	sorted := make([]string, 0, len(podIDs))
+	for podID := range podIDs {
+		sorted = append(sorted, podID.String())
+	}
+	sort.Strings(sorted)
+	report.PodsSeen = len(sorted)
+
+	for _, id := range sorted {
+		podID := types.PodID(id)
+		drift, err := a.auditPod(podID, intent[podID], reality[podID], installed[podID])
+		if err != nil {
+			return Report{}, err
+		}
+		report.Drift = append(report.Drift, drift...)
+	}
+
+	return report, nil
+}
+
+func (a Auditor) auditPod(podID types.PodID, intent manifest.Manifest, reality manifest.Manifest, pod *pods.Pod) ([]Drift, error) {
+	var drift []Drift
+
+	intentSHA, err := sha(intent)
+	if err != nil {
+		return nil, err
+	}
+	realitySHA, err := sha(reality)
+	if err != nil {
+		return nil, err
+	}
+	if intentSHA != realitySHA {
+		drift = append(drift, Drift{
+			Kind:     IntentMismatch,
+			PodID:    podID,
+			Expected: intentSHA,
+			Actual:   realitySHA,
+		})
+	}
+
+	if pod == nil {
+		if reality != nil {
+			drift = append(drift, Drift{
+				Kind:     NotOnDisk,
+				PodID:    podID,
+				Expected: realitySHA,
+			})
+		}
+		return drift, nil
+	}
+
+	current, err := pod.CurrentManifest()
+	if err != nil {
+		return nil, err
+	}
+	currentSHA, err := sha(current)
+	if err != nil {
+		return nil, err
+	}
+	if reality == nil {
+		drift = append(drift, Drift{
+			Kind:   NotInReality,
+			PodID:  podID,
+			Actual: currentSHA,
+		})
+	} else if currentSHA != realitySHA {
+		drift = append(drift, Drift{
+			Kind:     ManifestMismatch,
+			PodID:    podID,
+			Expected: realitySHA,
+			Actual:   currentSHA,
+		})
+	}
+
+	launchables, err := pod.Launchables(current)
+	if err != nil {
+		return nil, err
+	}
+	stanzas := current.GetLaunchableStanzas()
+	for _, launchable := range launchables {
+		supervised := stanzas[launchable.ID()].Role() != launch.RoleInit
+		drift = append(drift, a.auditLaunchable(podID, launchable, supervised)...)
+	}
+	return drift, nil
+}
+
+// currentDirLaunchable is implemented by launchables that keep a "current"
+// symlink to the active install, e.g. hoist launchables.
+type currentDirLaunchable interface {
+	CurrentDir() string
+}
+
+// auditLaunchable checks that the launchable is installed and current and, if
+// it is supervised, that its services are running. Init launchables exit once
+// they are done, so their services aren't expected to run.
+func (a Auditor) auditLaunchable(podID types.PodID, launchable launch.Launchable, supervised bool) []Drift {
+	expectedVersion := filepath.Base(launchable.InstallDir())
+	if !launchable.Installed() {
+		return []Drift{{
+			Kind:         LaunchableNotInstalled,
+			PodID:        podID,
+			LaunchableID: launchable.ID(),
+			Expected:     expectedVersion,
+		}}
+	}
+
+	var drift []Drift
+	if l, ok := launchable.(currentDirLaunchable); ok {
+		target, err := os.Readlink(l.CurrentDir())
+		actualVersion := filepath.Base(target)
+		if err != nil {
+			actualVersion = ""
+		}
+		if actualVersion != expectedVersion {
+			d := Drift{
+				Kind:         LaunchableVersionMismatch,
+				PodID:        podID,
+				LaunchableID: launchable.ID(),
+				Expected:     expectedVersion,
+				Actual:       actualVersion,
+			}
+			if err != nil {
+				d.Message = err.Error()
+			}
+			drift = append(drift, d)
+		}
+	}
+
+	if !supervised {
+		return drift
+	}
+
+	executables, err := launchable.Executables(a.Supervisor)
+	if err != nil {
+		return append(drift, Drift{
+			Kind:         ServiceDown,
+			PodID:        podID,
+			LaunchableID: launchable.ID(),
+			Message:      fmt.Sprintf("could not determine services: %s", err),
+		})
+	}
+	for _, executable := range executables {
+		service := executable.Service
+		stat, err := a.Supervisor.Stat(&service)
+		if err != nil {
+			drift = append(drift, Drift{
+				Kind:         ServiceDown,
+				PodID:        podID,
+				LaunchableID: launchable.ID(),
+				Service:      service.Name,
+				Expected:     runit.STATUS_RUN,
+				Message:      err.Error(),
+			})
+			continue
+		}
+		if stat.ChildStatus != runit.STATUS_RUN {
+			drift = append(drift, Drift{
+				Kind:         ServiceDown,
+				PodID:        podID,
+				LaunchableID: launchable.ID(),
+				Service:      service.Name,
+				Expected:     runit.STATUS_RUN,
+				Actual:       stat.ChildStatus,
+			})
+		}
+	}
+	return drift
+}
+
+func (a Auditor) listLegacyPods(podPrefix consul.PodPrefix) (map[types.PodID]manifest.Manifest, error) {
+	results, _, err := a.Store.ListPods(podPrefix, a.Node)
+	if err != nil {
+		return nil, util.Errorf("could not list %s pods for %s: %s", podPrefix, a.Node, err)
+	}
+
+	ret := make(map[types.PodID]manifest.Manifest)
+	for _, result := range results {
+		if result.PodUniqueKey != "" {
+			continue
+		}
+		ret[result.Manifest.ID()] = result.Manifest
+	}
+	return ret, nil
+}
+
+// installedPods returns the legacy pods under the pod root that have a
+// current manifest, keyed by pod ID.
+func (a Auditor) installedPods() (map[types.PodID]*pods.Pod, error) {
+	infos, err := ioutil.ReadDir(a.PodRoot)
+	if err != nil {
+		return nil, util.Errorf("could not read pod root %s: %s", a.PodRoot, err)
+	}
+
+	ret := make(map[types.PodID]*pods.Pod)
+	for _, info := range infos {
+		if !info.IsDir() || info.Name() == "hooks" {
+			continue
+		}
+		pod, err := pods.PodFromPodHome(a.Node, filepath.Join(a.PodRoot, info.Name()))
+		if err != nil {
+			// not every directory in the pod root is a pod
+			continue
+		}
+		if pod.UniqueKey() != "" {
+			continue
+		}
+		pod.Supervisor = a.Supervisor
+		ret[pod.Id] = pod
+	}
+	return ret, nil
+}
+
+func sha(m manifest.Manifest) (string, error) {
+	if m == nil {
+		return "", nil
+	}
+	return m.SHA()
+}
@@ -0,0 +1,249 @@
+package drift
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/supervisor"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeLister map[consul.PodPrefix][]manifest.Manifest
+
+func (f fakeLister) ListPods(podPrefix consul.PodPrefix, nodeName types.NodeName) ([]consul.ManifestResult, time.Duration, error) {
+	var results []consul.ManifestResult
+	for _, m := range f[podPrefix] {
+		results = append(results, consul.ManifestResult{
+			Manifest: m,
+			PodLocation: types.PodLocation{
+				Node:  nodeName,
+				PodID: m.ID(),
+			},
+		})
+	}
+	return results, 0, nil
+}
+
+// fakeSV reports every service as having the given status
+type fakeSV struct {
+	status string
+}
+
+func (f fakeSV) Start(*runit.Service) (string, error)                  { return "", nil }
+func (f fakeSV) Stop(*runit.Service, time.Duration) (string, error)    { return "", nil }
+func (f fakeSV) Restart(*runit.Service, time.Duration) (string, error) { return "", nil }
+func (f fakeSV) Once(*runit.Service) (string, error)                   { return "", nil }
+func (f fakeSV) Stat(*runit.Service) (*runit.StatResult, error) {
+	return &runit.StatResult{ChildStatus: f.status}, nil
+}
+
+func testManifest(t *testing.T, podID types.PodID, version launch.LaunchableVersionID) manifest.Manifest {
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := manifest.NewBuilder()
+	builder.SetID(podID)
+	builder.SetRunAsUser(currentUser.Username)
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"web": {
+			LaunchableType: "hoist",
+			Version:        launch.LaunchableVersion{ID: version},
+		},
+	})
+	return builder.GetManifest()
+}
+
+// installPod writes the pod's current manifest and, if install is true,
+// installs its launchable and makes it current
+func installPod(t *testing.T, podRoot string, m manifest.Manifest, install bool) {
+	pod := pods.NewFactory(podRoot, "node1", nil, "").NewLegacyPod(m.ID())
+	err := os.MkdirAll(pod.Home(), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pod.WriteCurrentManifest(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !install {
+		return
+	}
+
+	launchables, err := pod.Launchables(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, launchable := range launchables {
+		err = os.MkdirAll(filepath.Join(launchable.InstallDir(), "bin"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(launchable.InstallDir(), "bin", "launch"), []byte("#!/bin/sh\n"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = launchable.MakeCurrent()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	podRoot, err := ioutil.TempDir("", "drift_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(podRoot)
+
+	appV1 := testManifest(t, "app", "v1")
+	appV2 := testManifest(t, "app", "v2")
+	missing := testManifest(t, "missing", "v1")
+	stale := testManifest(t, "stale", "v1")
+
+	installPod(t, podRoot, appV1, true)
+	installPod(t, podRoot, stale, false)
+
+	auditor := NewAuditor("node1", podRoot, fakeLister{
+		consul.INTENT_TREE:  {appV2, missing},
+		consul.REALITY_TREE: {appV1, missing},
+	})
+	auditor.Supervisor = supervisor.NewRunit(runit.DefaultBuilder, fakeSV{status: runit.STATUS_DOWN})
+
+	report, err := auditor.Audit()
+	if err != nil {
+		t.Fatalf("Unexpected error auditing node: %s", err)
+	}
+	if report.PodsSeen != 3 {
+		t.Errorf("Expected 3 pods to be seen, got %d", report.PodsSeen)
+	}
+
+	found := make(map[types.PodID]map[Kind]Drift)
+	for _, d := range report.Drift {
+		if found[d.PodID] == nil {
+			found[d.PodID] = make(map[Kind]Drift)
+		}
+		found[d.PodID][d.Kind] = d
+	}
+
+	expected := map[types.PodID][]Kind{
+		"app":     {IntentMismatch, ServiceDown},
+		"missing": {NotOnDisk},
+		"stale":   {NotInReality, LaunchableNotInstalled},
+	}
+	for podID, kinds := range expected {
+		if len(found[podID]) != len(kinds) {
+			t.Errorf("Expected %d kinds of drift for %s, got %v", len(kinds), podID, found[podID])
+		}
+		for _, kind := range kinds {
+			if _, ok := found[podID][kind]; !ok {
+				t.Errorf("Expected %s drift for %s", kind, podID)
+			}
+		}
+	}
+
+	serviceDown := found["app"][ServiceDown]
+	if serviceDown.Service != "app__web__launch" || serviceDown.Actual != runit.STATUS_DOWN {
+		t.Errorf("Unexpected service drift: %+v", serviceDown)
+	}
+}
+
+func TestAuditDetectsVersionAndManifestMismatch(t *testing.T) {
+	podRoot, err := ioutil.TempDir("", "drift_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(podRoot)
+
+	appV1 := testManifest(t, "app", "v1")
+	appV2 := testManifest(t, "app", "v2")
+
+	// v1 is installed and current, then v2's manifest is written without
+	// its launchable being made current
+	installPod(t, podRoot, appV1, true)
+	pod := pods.NewFactory(podRoot, "node1", nil, "").NewLegacyPod("app")
+	_, err = pod.WriteCurrentManifest(appV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	launchables, err := pod.Launchables(appV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(launchables[0].InstallDir(), "bin"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auditor := NewAuditor("node1", podRoot, fakeLister{
+		consul.INTENT_TREE:  {appV1},
+		consul.REALITY_TREE: {appV1},
+	})
+	auditor.Supervisor = supervisor.NewRunit(runit.DefaultBuilder, fakeSV{status: runit.STATUS_RUN})
+
+	report, err := auditor.Audit()
+	if err != nil {
+		t.Fatalf("Unexpected error auditing node: %s", err)
+	}
+
+	kinds := make(map[Kind]Drift)
+	for _, d := range report.Drift {
+		kinds[d.Kind] = d
+	}
+	if _, ok := kinds[ManifestMismatch]; !ok {
+		t.Errorf("Expected a manifest mismatch, got %+v", report.Drift)
+	}
+	versionDrift, ok := kinds[LaunchableVersionMismatch]
+	if !ok {
+		t.Fatalf("Expected a launchable version mismatch, got %+v", report.Drift)
+	}
+	if versionDrift.Expected != "web_v2" || versionDrift.Actual != "web_v1" {
+		t.Errorf("Unexpected version drift: %+v", versionDrift)
+	}
+}
+
+func TestAuditIgnoresInitLaunchableServices(t *testing.T) {
+	podRoot, err := ioutil.TempDir("", "drift_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(podRoot)
+
+	builder := testManifest(t, "app", "v1").GetBuilder()
+	stanzas := builder.GetManifest().GetLaunchableStanzas()
+	stanzas["migrate"] = launch.LaunchableStanza{
+		LaunchableType: "hoist",
+		Version:        launch.LaunchableVersion{ID: "v1"},
+		Role_:          launch.RoleInit,
+	}
+	builder.SetLaunchables(stanzas)
+	app := builder.GetManifest()
+	installPod(t, podRoot, app, true)
+
+	auditor := NewAuditor("node1", podRoot, fakeLister{
+		consul.INTENT_TREE:  {app},
+		consul.REALITY_TREE: {app},
+	})
+	auditor.Supervisor = supervisor.NewRunit(runit.DefaultBuilder, fakeSV{status: runit.STATUS_DOWN})
+
+	report, err := auditor.Audit()
+	if err != nil {
+		t.Fatalf("Unexpected error auditing node: %s", err)
+	}
+	if len(report.Drift) != 1 {
+		t.Fatalf("Expected only the main launchable's service to be down, got %+v", report.Drift)
+	}
+	if report.Drift[0].Kind != ServiceDown || report.Drift[0].LaunchableID != "web" {
+		t.Errorf("Unexpected drift: %+v", report.Drift[0])
+	}
+}
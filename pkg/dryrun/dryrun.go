@@ -0,0 +1,167 @@
+// Package dryrun reports what a change to a replication controller, daemon set
+// or rolling update would do without making it: how the manifest changes,
+// which nodes are affected and whether the deploy policy would allow the new
+// manifest to run.
+package dryrun
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/constants"
+	ds_fields "github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// Report describes the effect of a change that was not made.
+type Report struct {
+	// The differences between the current and the new manifest
+	Changes []manifest.FieldChange
+	// The nodes whose pods would be changed
+	AffectedNodes []types.NodeName
+	// Whether the new manifest was checked against a deploy policy
+	AuthChecked bool
+	// Why the deploy policy would refuse to run the new manifest, nil if it
+	// would run it or if it wasn't checked
+	AuthError error
+}
+
+// NewReport builds the report of a change from oldManifest to newManifest
+// affecting the passed nodes. The new manifest is checked against policy
+// unless policy is nil.
+func NewReport(
+	oldManifest manifest.Manifest,
+	newManifest manifest.Manifest,
+	affectedNodes []types.NodeName,
+	policy auth.Policy,
+	logger logging.Logger,
+) Report {
+	report := Report{
+		Changes:       manifest.Diff(oldManifest, newManifest),
+		AffectedNodes: affectedNodes,
+	}
+	if policy != nil && newManifest != nil {
+		report.AuthChecked = true
+		report.AuthError = policy.AuthorizeApp(newManifest, logger)
+	}
+	return report
+}
+
+// Scheduler finds the nodes a daemon set's pods are scheduled on, see
+// ds.Scheduler
+type Scheduler interface {
+	EligibleNodes(manifest.Manifest, klabels.Selector) ([]types.NodeName, error)
+}
+
+// DaemonSetNodes returns the nodes affected by changing oldDS to newDS: the
+// nodes its pod would be scheduled on or unscheduled from because the node
+// selector changed, and, if the manifest changed, every node it would run on.
+func DaemonSetNodes(scheduler Scheduler, oldDS ds_fields.DaemonSet, newDS ds_fields.DaemonSet) ([]types.NodeName, error) {
+	oldNodes, err := scheduler.EligibleNodes(oldDS.Manifest, oldDS.NodeSelector)
+	if err != nil {
+		return nil, err
+	}
+	newNodes, err := scheduler.EligibleNodes(newDS.Manifest, newDS.NodeSelector)
+	if err != nil {
+		return nil, err
+	}
+	oldSet := types.NewNodeSet(oldNodes...)
+	newSet := types.NewNodeSet(newNodes...)
+
+	affected := oldSet.Difference(newSet)
+	for _, node := range newSet.Difference(oldSet).ListNodes() {
+		affected.InsertNode(node)
+	}
+	oldSHA, err := oldDS.Manifest.SHA()
+	if err != nil {
+		return nil, err
+	}
+	newSHA, err := newDS.Manifest.SHA()
+	if err != nil {
+		return nil, err
+	}
+	if oldSHA != newSHA {
+		for _, node := range newNodes {
+			affected.InsertNode(node)
+		}
+	}
+	return affected.ListNodes(), nil
+}
+
+// Write prints the report for humans.
+func (r Report) Write(w io.Writer) error {
+	_, err := fmt.Fprintln(w, "Manifest changes:")
+	if err != nil {
+		return err
+	}
+	if len(r.Changes) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, change := range r.Changes {
+		fmt.Fprintf(w, "  %s\n", change)
+	}
+
+	fmt.Fprintf(w, "Affected nodes (%d):\n", len(r.AffectedNodes))
+	for _, node := range r.AffectedNodes {
+		fmt.Fprintf(w, "  %s\n", node)
+	}
+
+	switch {
+	case !r.AuthChecked:
+		fmt.Fprintln(w, "Authorization: not checked")
+	case r.AuthError != nil:
+		fmt.Fprintf(w, "Authorization: refused: %s\n", r.AuthError)
+	default:
+		fmt.Fprintln(w, "Authorization: allowed")
+	}
+	_, err = fmt.Fprintln(w, "Dry run, nothing was changed")
+	return err
+}
+
+// Flags are the command line flags that request a dry run and configure the
+// deploy policy it checks manifests against.
+type Flags struct {
+	dryRun       *bool
+	keyring      *string
+	deployPolicy *string
+}
+
+// FlagAdder is implemented by both kingpin commands and applications.
+type FlagAdder interface {
+	Flag(name, help string) *kingpin.FlagClause
+}
+
+func AddFlags(cmd FlagAdder) Flags {
+	return Flags{
+		dryRun:       cmd.Flag("dry-run", "Report the manifest changes, affected nodes and authorization outcome without changing anything").Bool(),
+		keyring:      cmd.Flag("keyring", "With --dry-run, check the new manifest's signature against this keyring").String(),
+		deployPolicy: cmd.Flag("deploy-policy", "With --dry-run and --keyring, check the new manifest's signer against this deploy policy").String(),
+	}
+}
+
+func (f Flags) DryRun() bool {
+	return *f.dryRun
+}
+
+// Policy returns the deploy policy configured by the flags, or nil if no
+// keyring was passed. The policy is a user policy if a deploy policy was
+// passed, and a keyring policy otherwise, as configured on the preparer.
+func (f Flags) Policy() (auth.Policy, error) {
+	switch {
+	case *f.keyring == "" && *f.deployPolicy != "":
+		return nil, util.Errorf("--deploy-policy requires --keyring")
+	case *f.keyring == "":
+		return nil, nil
+	case *f.deployPolicy == "":
+		return auth.LoadKeyringPolicy(*f.keyring, nil)
+	}
+	return auth.NewUserPolicy(*f.keyring, *f.deployPolicy, constants.PreparerPodID, constants.PreparerPodID.String())
+}
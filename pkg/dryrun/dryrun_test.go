@@ -0,0 +1,76 @@
+package dryrun
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/auth"
+	ds_fields "github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+// fakeScheduler schedules pods on the nodes listed for their selector
+type fakeScheduler map[string][]types.NodeName
+
+func (s fakeScheduler) EligibleNodes(_ manifest.Manifest, selector klabels.Selector) ([]types.NodeName, error) {
+	return s[selector.String()], nil
+}
+
+func testDS(selector string, runAs string) ds_fields.DaemonSet {
+	builder := manifest.NewBuilder()
+	builder.SetID("agent")
+	builder.SetRunAsUser(runAs)
+	nodeSelector, _ := klabels.Parse(selector)
+	return ds_fields.DaemonSet{
+		ID:           "ds",
+		PodID:        "agent",
+		Manifest:     builder.GetManifest(),
+		NodeSelector: nodeSelector,
+	}
+}
+
+func TestDaemonSetNodes(t *testing.T) {
+	scheduler := fakeScheduler{
+		"role=web": {"node1", "node2"},
+		"role=db":  {"node2", "node3"},
+	}
+
+	nodes, err := DaemonSetNodes(scheduler, testDS("role=web", "agent"), testDS("role=web", "agent"))
+	Assert(t).IsNil(err, "unexpected error finding nodes")
+	Assert(t).AreEqual(len(nodes), 0, "an unchanged daemon set shouldn't affect any node")
+
+	nodes, err = DaemonSetNodes(scheduler, testDS("role=web", "agent"), testDS("role=db", "agent"))
+	Assert(t).IsNil(err, "unexpected error finding nodes")
+	Assert(t).IsTrue(types.NewNodeSet(nodes...).Equal(types.NewNodeSet("node1", "node3")), "expected the nodes added and removed by the selector")
+
+	nodes, err = DaemonSetNodes(scheduler, testDS("role=web", "agent"), testDS("role=db", "nobody"))
+	Assert(t).IsNil(err, "unexpected error finding nodes")
+	Assert(t).IsTrue(types.NewNodeSet(nodes...).Equal(types.NewNodeSet("node1", "node2", "node3")), "expected every node to be affected by a manifest change")
+}
+
+func TestReport(t *testing.T) {
+	oldDS := testDS("role=web", "agent")
+	newDS := testDS("role=web", "nobody")
+
+	report := NewReport(oldDS.Manifest, newDS.Manifest, []types.NodeName{"node1"}, auth.NullPolicy{}, logging.DefaultLogger)
+	Assert(t).AreEqual(len(report.Changes), 1, "expected a single change")
+	Assert(t).IsTrue(report.AuthChecked, "the manifest should have been checked")
+	Assert(t).IsNil(report.AuthError, "the null policy should allow the manifest")
+
+	var out bytes.Buffer
+	err := report.Write(&out)
+	Assert(t).IsNil(err, "unexpected error writing report")
+	Assert(t).IsTrue(strings.Contains(out.String(), "~ run_as: agent -> nobody"), "report is missing the change: "+out.String())
+	Assert(t).IsTrue(strings.Contains(out.String(), "Affected nodes (1):\n  node1\n"), "report is missing the nodes: "+out.String())
+	Assert(t).IsTrue(strings.Contains(out.String(), "Authorization: allowed"), "report is missing the authorization: "+out.String())
+
+	report = NewReport(oldDS.Manifest, newDS.Manifest, nil, nil, logging.DefaultLogger)
+	Assert(t).IsFalse(report.AuthChecked, "the manifest shouldn't be checked without a policy")
+}
@@ -17,7 +17,6 @@ import (
 	"github.com/square/p2/pkg/manifest"
 	p2metrics "github.com/square/p2/pkg/metrics"
 	"github.com/square/p2/pkg/replication"
-	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/dsstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
@@ -178,6 +177,7 @@ func New(
 	txner transaction.Txner,
 	applicator Labeler,
 	watcher LabelWatcher,
+	sched Scheduler,
 	labelsAggregationRate time.Duration,
 	logger logging.Logger,
 	healthChecker *checker.ConsulHealthChecker,
@@ -203,7 +203,7 @@ func New(
 		logger:                logger,
 		applicator:            applicator,
 		watcher:               watcher,
-		scheduler:             scheduler.NewApplicatorScheduler(applicator),
+		scheduler:             sched,
 		healthChecker:         healthChecker,
 		healthWatchDelay:      healthWatchDelay,
 		dsReplication:         nil,
@@ -15,6 +15,7 @@ import (
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul/consultest"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/dsstore"
@@ -218,6 +219,7 @@ func TestSchedule(t *testing.T) {
 		fixture.Client.KV(),
 		applicator,
 		applicator,
+		scheduler.NewApplicatorScheduler(applicator),
 		1*time.Nanosecond,
 		logging.DefaultLogger,
 		&happyHealthChecker,
@@ -483,6 +485,7 @@ func TestPublishToReplication(t *testing.T) {
 		fixture.Client.KV(),
 		applicator,
 		applicator,
+		scheduler.NewApplicatorScheduler(applicator),
 		1*time.Nanosecond,
 		logging.DefaultLogger,
 		&happyHealthChecker,
@@ -126,6 +126,7 @@ func NewFarm(
 	cachedPodMatch bool,
 	healthWatchDelay time.Duration,
 	dsRetryInterval time.Duration,
+	nodeRegistry scheduler.NodeRegistry,
 	farmConfig DSFarmConfig,
 ) *Farm {
 	if alerter == nil {
@@ -137,13 +138,20 @@ func NewFarm(
 		statusWritingInterval = DefaultStatusWritingInterval
 	}
 
+	// If a node registry is provided, daemon sets will treat nodes that
+	// stopped heartbeating as ineligible
+	var dsScheduler Scheduler = scheduler.NewApplicatorScheduler(labeler)
+	if nodeRegistry != nil {
+		dsScheduler = scheduler.NewLivenessScheduler(scheduler.NewApplicatorScheduler(labeler), nodeRegistry)
+	}
+
 	return &Farm{
 		store:                 store,
 		txner:                 txner,
 		dsStore:               dsStore,
 		dsLocker:              dsLocker,
 		statusStore:           statusStore,
-		scheduler:             scheduler.NewApplicatorScheduler(labeler),
+		scheduler:             dsScheduler,
 		labeler:               labeler,
 		watcher:               watcher,
 		sessions:              sessions,
@@ -503,6 +511,7 @@ func (dsf *Farm) raiseContentionAlert(oldDS ds_fields.DaemonSet, newDS ds_fields
 	if alertErr := dsf.alerter.Alert(alerting.AlertInfo{
 		Description: fmt.Sprintf("New ds '%v', contends with '%v'", oldDS.ID, newDS.ID),
 		IncidentKey: "preemptive_ds_contention",
+		Labels:      dsf.alertLabels(newDS),
 		Details: struct {
 			OldID           ds_fields.ID          `json:"old_id"`
 			OldName         ds_fields.ClusterName `json:"old_cluster_name"`
@@ -534,6 +543,48 @@ func (dsf *Farm) raiseContentionAlert(oldDS ds_fields.DaemonSet, newDS ds_fields
 	}
 }
 
+// alertLabels returns the labels to route alerts about a daemon set. Daemon
+// sets aren't labeled themselves, so these are its ID, pod ID and cluster
+// name along with the labels shared by every pod cluster with the same pod ID
+// and cluster name, e.g. the availability zone if there is only one
+func (dsf *Farm) alertLabels(dsFields ds_fields.DaemonSet) map[string]string {
+	alertLabels := map[string]string{
+		DSIDLabel:              dsFields.ID.String(),
+		alerting.PodIDLabel:    dsFields.PodID.String(),
+		types.ClusterNameLabel: dsFields.Name.String(),
+	}
+
+	selector := klabels.Everything().
+		Add(types.PodIDLabel, klabels.EqualsOperator, []string{dsFields.PodID.String()}).
+		Add(types.ClusterNameLabel, klabels.EqualsOperator, []string{dsFields.Name.String()})
+	podClusters, err := dsf.labeler.GetMatches(selector, labels.PC)
+	if err != nil {
+		dsf.logger.WithError(err).Warnln("Could not read the daemon set's pod cluster labels to route an alert")
+	}
+	for key, value := range sharedLabels(podClusters) {
+		alertLabels[key] = value
+	}
+	return alertLabels
+}
+
+func sharedLabels(labeled []labels.Labeled) klabels.Set {
+	if len(labeled) == 0 {
+		return nil
+	}
+	shared := klabels.Set{}
+	for key, value := range labeled[0].Labels {
+		shared[key] = value
+	}
+	for _, other := range labeled[1:] {
+		for key, value := range shared {
+			if !other.Labels.Has(key) || other.Labels.Get(key) != value {
+				delete(shared, key)
+			}
+		}
+	}
+	return shared
+}
+
 // Creates a functioning daemon set that will watch and write to the pod tree
 func (dsf *Farm) spawnDaemonSet(
 	ctx context.Context,
@@ -548,6 +599,7 @@ func (dsf *Farm) spawnDaemonSet(
 		dsf.txner,
 		dsf.labeler,
 		dsf.watcher,
+		dsf.scheduler,
 		dsf.labelsAggregationRate,
 		dsLogger,
 		dsf.healthChecker,
@@ -5,6 +5,7 @@ package ds
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -351,6 +352,19 @@ func TestContendSelectors(t *testing.T) {
 	Assert(t).IsNil(err, "Error disabling fifth daemon set")
 }
 
+func TestSharedLabels(t *testing.T) {
+	podClusters := []labels.Labeled{
+		{Labels: klabels.Set{"pod_id": "foo", "availability_zone": "west", "team": "infra"}},
+		{Labels: klabels.Set{"pod_id": "foo", "availability_zone": "east", "team": "infra"}},
+	}
+	shared := sharedLabels(podClusters)
+	Assert(t).IsTrue(reflect.DeepEqual(shared, klabels.Set{"pod_id": "foo", "team": "infra"}), "expected only the labels every pod cluster has")
+
+	shared = sharedLabels(podClusters[:1])
+	Assert(t).IsTrue(reflect.DeepEqual(shared, podClusters[0].Labels), "expected every label of a single pod cluster")
+	Assert(t).AreEqual(len(sharedLabels(nil)), 0, "expected no labels without pod clusters")
+}
+
 func TestFarmSchedule(t *testing.T) {
 	//
 	// Instantiate farm
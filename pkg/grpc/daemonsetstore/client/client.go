@@ -2,13 +2,17 @@ package client
 
 import (
 	"context"
+	"errors"
 
+	"github.com/square/p2/pkg/dryrun"
 	"github.com/square/p2/pkg/ds"
 	"github.com/square/p2/pkg/ds/fields"
 	"github.com/square/p2/pkg/grpc/daemonsetstore"
 	daemonsetstore_protos "github.com/square/p2/pkg/grpc/daemonsetstore/protos"
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/store/consul/dsstore"
+	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 
 	"google.golang.org/grpc"
@@ -59,6 +63,54 @@ func (c Client) Disable(id fields.ID) (fields.DaemonSet, error) {
 	return ds, nil
 }
 
+// UpdateManifestDryRun returns the daemon set as it would be with the given
+// manifest and a report of what the update would change, without changing it.
+func (c Client) UpdateManifestDryRun(id fields.ID, m manifest.Manifest) (fields.DaemonSet, dryrun.Report, error) {
+	manifestBytes, err := m.Marshal()
+	if err != nil {
+		return fields.DaemonSet{}, dryrun.Report{}, util.Errorf("could not marshal manifest: %s", err)
+	}
+
+	resp, err := c.client.UpdateDaemonSetManifestDryRun(context.Background(), &daemonsetstore_protos.UpdateDaemonSetManifestDryRunRequest{
+		DaemonSetId: id.String(),
+		Manifest:    string(manifestBytes),
+	})
+	if err != nil {
+		return fields.DaemonSet{}, dryrun.Report{}, util.Errorf("update daemon set manifest dry run grpc for %s failed: %s", id, err)
+	}
+
+	ds, err := daemonsetstore.ProtoDSToRawDS(resp.GetDaemonSet())
+	if err != nil {
+		return fields.DaemonSet{}, dryrun.Report{}, util.Errorf("could not convert from grpc proto type to DaemonSet: %s", err)
+	}
+
+	return ds, protoReportToReport(resp.GetDryRunReport()), nil
+}
+
+func protoReportToReport(reportProto *daemonsetstore_protos.DryRunReport) dryrun.Report {
+	if reportProto == nil {
+		return dryrun.Report{}
+	}
+
+	report := dryrun.Report{
+		AuthChecked: reportProto.GetAuthChecked(),
+	}
+	for _, change := range reportProto.GetChanges() {
+		report.Changes = append(report.Changes, manifest.FieldChange{
+			Field: change.GetField(),
+			Old:   change.GetOld(),
+			New:   change.GetNew(),
+		})
+	}
+	for _, node := range reportProto.GetAffectedNodes() {
+		report.AffectedNodes = append(report.AffectedNodes, types.NodeName(node))
+	}
+	if reportProto.GetAuthError() != "" {
+		report.AuthError = errors.New(reportProto.GetAuthError())
+	}
+	return report
+}
+
 // TODO: pass a context here instead of a <-chan struct{}. It's like this so it matches the consul
 // implementation
 func (c Client) Watch(quitCh <-chan struct{}) <-chan dsstore.WatchedDaemonSets {
@@ -3,8 +3,11 @@ package daemonsetstore
 import (
 	"time"
 
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/dryrun"
 	"github.com/square/p2/pkg/ds/fields"
 	daemonsetstore_protos "github.com/square/p2/pkg/grpc/daemonsetstore/protos"
+	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/store/consul/dsstore"
 	"github.com/square/p2/pkg/types"
@@ -20,15 +23,28 @@ type ConsulStore interface {
 	List() ([]fields.DaemonSet, error)
 	Disable(id fields.ID) (fields.DaemonSet, error)
 	Watch(quitCh <-chan struct{}) <-chan dsstore.WatchedDaemonSets
+	MutateDSDryRun(id fields.ID, mutator func(fields.DaemonSet) (fields.DaemonSet, error)) (fields.DaemonSet, fields.DaemonSet, error)
 }
 
 type Store struct {
 	consulStore ConsulStore
+
+	// Used to find the nodes affected by dry run updates
+	scheduler dryrun.Scheduler
+
+	// The deploy policy dry run updates check manifests against. Manifests
+	// aren't checked if it is nil
+	policy auth.Policy
+
+	logger logging.Logger
 }
 
-func NewServer(consulStore ConsulStore) Store {
+func NewServer(consulStore ConsulStore, scheduler dryrun.Scheduler, policy auth.Policy, logger logging.Logger) Store {
 	return Store{
 		consulStore: consulStore,
+		scheduler:   scheduler,
+		policy:      policy,
+		logger:      logger,
 	}
 }
 
@@ -100,6 +116,89 @@ func (s Store) WatchDaemonSets(_ *daemonsetstore_protos.WatchDaemonSetsRequest,
 	return nil
 }
 
+// UpdateDaemonSetManifestDryRun reports what setting the manifest of a daemon
+// set would change, without changing it.
+func (s Store) UpdateDaemonSetManifestDryRun(_ context.Context, req *daemonsetstore_protos.UpdateDaemonSetManifestDryRunRequest) (*daemonsetstore_protos.UpdateDaemonSetManifestDryRunResponse, error) {
+	id, err := fields.ToDaemonSetID(req.GetDaemonSetId())
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	newManifest, err := manifest.FromBytes([]byte(req.GetManifest()))
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "could not parse manifest: %s", err)
+	}
+
+	// the store wraps the mutator's errors, so remember whether the update
+	// would be refused to report it as such
+	var refused error
+	mutator := func(ds fields.DaemonSet) (fields.DaemonSet, error) {
+		if newManifest.ID() != ds.PodID {
+			refused = util.Errorf("manifest ID of %s does not match daemon set's pod ID (%s)", newManifest.ID(), ds.PodID)
+			return ds, refused
+		}
+		ds.Manifest = newManifest
+		return ds, nil
+	}
+
+	oldDS, newDS, err := s.consulStore.MutateDSDryRun(id, mutator)
+	if err != nil {
+		return nil, updateError(id, err, refused)
+	}
+
+	nodes, err := dryrun.DaemonSetNodes(s.scheduler, oldDS, newDS)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not find the nodes of daemon set %s: %s", id, err)
+	}
+
+	dsProto, err := RawDSToProtoDS(newDS)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "%s", err)
+	}
+	report := dryrun.NewReport(oldDS.Manifest, newDS.Manifest, nodes, s.policy, s.logger)
+	return &daemonsetstore_protos.UpdateDaemonSetManifestDryRunResponse{
+		DaemonSet:    dsProto,
+		DryRunReport: ReportToProto(report),
+	}, nil
+}
+
+func updateError(id fields.ID, err error, refused error) error {
+	switch {
+	case err == dsstore.NoDaemonSet:
+		return grpc.Errorf(codes.NotFound, "no daemon set with id %s was found", id)
+	case refused != nil:
+		return grpc.Errorf(codes.FailedPrecondition, "daemon set %s could not be updated: %s", id, refused)
+	}
+	return grpc.Errorf(codes.Unavailable, "could not check update of daemon set %s: %s", id, err)
+}
+
+func ReportToProto(report dryrun.Report) *daemonsetstore_protos.DryRunReport {
+	changes := make([]*daemonsetstore_protos.ManifestChange, len(report.Changes))
+	for i, change := range report.Changes {
+		changes[i] = &daemonsetstore_protos.ManifestChange{
+			Field: change.Field,
+			Old:   change.Old,
+			New:   change.New,
+		}
+	}
+
+	nodes := make([]string, len(report.AffectedNodes))
+	for i, node := range report.AffectedNodes {
+		nodes[i] = node.String()
+	}
+
+	var authError string
+	if report.AuthError != nil {
+		authError = report.AuthError.Error()
+	}
+	return &daemonsetstore_protos.DryRunReport{
+		Changes:       changes,
+		AffectedNodes: nodes,
+		AuthChecked:   report.AuthChecked,
+		AuthError:     authError,
+	}
+}
+
 func RawDSToProtoDS(rawDS fields.DaemonSet) (*daemonsetstore_protos.DaemonSet, error) {
 	manifest, err := rawDS.Manifest.Marshal()
 	if err != nil {
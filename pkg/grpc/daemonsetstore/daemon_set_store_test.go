@@ -32,7 +32,7 @@ func TestListDaemonSets(t *testing.T) {
 		t.Fatalf("could not seed daemon set store with a daemon set")
 	}
 
-	server := NewServer(dsStore)
+	server := NewServer(dsStore, nil, nil, logging.DefaultLogger)
 	resp, err := server.ListDaemonSets(context.Background(), &daemonsetstore_protos.ListDaemonSetsRequest{})
 	if err != nil {
 		t.Fatalf("error listing daemon sets: %s", err)
@@ -95,7 +95,7 @@ func TestDisableDaemonSet(t *testing.T) {
 		t.Fatal("daemon set already disabled")
 	}
 
-	server := NewServer(dsStore)
+	server := NewServer(dsStore, nil, nil, logging.DefaultLogger)
 	_, err = server.DisableDaemonSet(context.Background(), &daemonsetstore_protos.DisableDaemonSetRequest{
 		DaemonSetId: daemonSet.ID.String(),
 	})
@@ -117,7 +117,7 @@ func TestDisableDaemonSetInvalidArgument(t *testing.T) {
 	fixture := consulutil.NewFixture(t)
 	defer fixture.Stop()
 	dsStore := dsstore.NewConsul(fixture.Client, 0, &logging.DefaultLogger)
-	server := NewServer(dsStore)
+	server := NewServer(dsStore, nil, nil, logging.DefaultLogger)
 
 	_, err := server.DisableDaemonSet(context.Background(), &daemonsetstore_protos.DisableDaemonSetRequest{
 		DaemonSetId: "bad daemon set ID",
@@ -135,7 +135,7 @@ func TestDisableDaemonSetNotFound(t *testing.T) {
 	fixture := consulutil.NewFixture(t)
 	defer fixture.Stop()
 	dsStore := dsstore.NewConsul(fixture.Client, 0, &logging.DefaultLogger)
-	server := NewServer(dsStore)
+	server := NewServer(dsStore, nil, nil, logging.DefaultLogger)
 
 	_, err := server.DisableDaemonSet(context.Background(), &daemonsetstore_protos.DisableDaemonSetRequest{
 		DaemonSetId: uuid.New(),
@@ -149,6 +149,65 @@ func TestDisableDaemonSetNotFound(t *testing.T) {
 	}
 }
 
+type fakeScheduler []types.NodeName
+
+func (s fakeScheduler) EligibleNodes(_ manifest.Manifest, _ klabels.Selector) ([]types.NodeName, error) {
+	return s, nil
+}
+
+func TestUpdateDaemonSetManifestDryRun(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	dsStore := dsstore.NewConsul(fixture.Client, 0, &logging.DefaultLogger)
+	daemonSet, err := createADaemonSet(dsStore, fixture.Client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := validManifest().GetBuilder()
+	builder.SetRunAsUser("nobody")
+	newManifest, err := builder.GetManifest().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(dsStore, fakeScheduler{"node1", "node2"}, nil, logging.DefaultLogger)
+	resp, err := server.UpdateDaemonSetManifestDryRun(context.Background(), &daemonsetstore_protos.UpdateDaemonSetManifestDryRunRequest{
+		DaemonSetId: daemonSet.ID.String(),
+		Manifest:    string(newManifest),
+	})
+	if err != nil {
+		t.Fatalf("error doing a dry run of a daemon set update: %s", err)
+	}
+
+	report := resp.GetDryRunReport()
+	if len(report.Changes) != 1 || report.Changes[0].Field != "run_as" || report.Changes[0].New != "nobody" {
+		t.Errorf("expected the run_as change to be reported but the changes were %v", report.Changes)
+	}
+	if len(report.AffectedNodes) != 2 {
+		t.Errorf("expected 2 affected nodes but there were %d", len(report.AffectedNodes))
+	}
+	if report.AuthChecked {
+		t.Error("the manifest shouldn't have been checked without a deploy policy")
+	}
+
+	daemonSet, _, err = dsStore.Get(daemonSet.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if daemonSet.Manifest.RunAsUser() == "nobody" {
+		t.Error("a dry run shouldn't have changed the daemon set")
+	}
+
+	_, err = server.UpdateDaemonSetManifestDryRun(context.Background(), &daemonsetstore_protos.UpdateDaemonSetManifestDryRunRequest{
+		DaemonSetId: daemonSet.ID.String(),
+		Manifest:    "id: otherapp\n",
+	})
+	if grpc.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected a failed precondition error updating to a manifest with another pod ID but got %v", err)
+	}
+}
+
 type TestWatchDaemonSetsStream struct {
 	*testutil.FakeServerStream
 
@@ -174,6 +233,9 @@ func (fakeDaemonSetWatcher) List() ([]fields.DaemonSet, error) { panic("List() n
 func (fakeDaemonSetWatcher) Disable(id fields.ID) (fields.DaemonSet, error) {
 	panic("Disable() not implemented")
 }
+func (fakeDaemonSetWatcher) MutateDSDryRun(id fields.ID, mutator func(fields.DaemonSet) (fields.DaemonSet, error)) (fields.DaemonSet, fields.DaemonSet, error) {
+	panic("MutateDSDryRun() not implemented")
+}
 func (f fakeDaemonSetWatcher) Watch(quitCh <-chan struct{}) <-chan dsstore.WatchedDaemonSets {
 	out := make(chan dsstore.WatchedDaemonSets)
 	go func() {
@@ -198,7 +260,7 @@ func (f fakeDaemonSetWatcher) Watch(quitCh <-chan struct{}) <-chan dsstore.Watch
 
 func TestWatchDaemonSets(t *testing.T) {
 	resultCh := make(chan dsstore.WatchedDaemonSets)
-	server := NewServer(newFakeDSWatcher(resultCh))
+	server := NewServer(newFakeDSWatcher(resultCh), nil, nil, logging.DefaultLogger)
 
 	respCh := make(chan *daemonsetstore_protos.WatchDaemonSetsResponse)
 	ctx, cancelFunc := context.WithCancel(context.Background())
@@ -16,6 +16,10 @@ It has these top-level messages:
 	DisableDaemonSetResponse
 	WatchDaemonSetsRequest
 	WatchDaemonSetsResponse
+	UpdateDaemonSetManifestDryRunRequest
+	UpdateDaemonSetManifestDryRunResponse
+	DryRunReport
+	ManifestChange
 */
 package daemonsetstore
 
@@ -218,6 +222,129 @@ func (m *WatchDaemonSetsResponse) GetError() string {
 	return ""
 }
 
+type UpdateDaemonSetManifestDryRunRequest struct {
+	DaemonSetId string `protobuf:"bytes,1,opt,name=daemon_set_id,json=daemonSetId" json:"daemon_set_id,omitempty"`
+	Manifest    string `protobuf:"bytes,2,opt,name=manifest" json:"manifest,omitempty"`
+}
+
+func (m *UpdateDaemonSetManifestDryRunRequest) Reset()                    { *m = UpdateDaemonSetManifestDryRunRequest{} }
+func (m *UpdateDaemonSetManifestDryRunRequest) String() string            { return proto.CompactTextString(m) }
+func (*UpdateDaemonSetManifestDryRunRequest) ProtoMessage()               {}
+func (*UpdateDaemonSetManifestDryRunRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *UpdateDaemonSetManifestDryRunRequest) GetDaemonSetId() string {
+	if m != nil {
+		return m.DaemonSetId
+	}
+	return ""
+}
+
+func (m *UpdateDaemonSetManifestDryRunRequest) GetManifest() string {
+	if m != nil {
+		return m.Manifest
+	}
+	return ""
+}
+
+type UpdateDaemonSetManifestDryRunResponse struct {
+	// the daemon set as it would be after the update
+	DaemonSet    *DaemonSet    `protobuf:"bytes,1,opt,name=daemon_set,json=daemonSet" json:"daemon_set,omitempty"`
+	DryRunReport *DryRunReport `protobuf:"bytes,2,opt,name=dry_run_report,json=dryRunReport" json:"dry_run_report,omitempty"`
+}
+
+func (m *UpdateDaemonSetManifestDryRunResponse) Reset()                    { *m = UpdateDaemonSetManifestDryRunResponse{} }
+func (m *UpdateDaemonSetManifestDryRunResponse) String() string            { return proto.CompactTextString(m) }
+func (*UpdateDaemonSetManifestDryRunResponse) ProtoMessage()               {}
+func (*UpdateDaemonSetManifestDryRunResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *UpdateDaemonSetManifestDryRunResponse) GetDaemonSet() *DaemonSet {
+	if m != nil {
+		return m.DaemonSet
+	}
+	return nil
+}
+
+func (m *UpdateDaemonSetManifestDryRunResponse) GetDryRunReport() *DryRunReport {
+	if m != nil {
+		return m.DryRunReport
+	}
+	return nil
+}
+
+// models dryrun.Report
+type DryRunReport struct {
+	Changes       []*ManifestChange `protobuf:"bytes,1,rep,name=changes" json:"changes,omitempty"`
+	AffectedNodes []string          `protobuf:"bytes,2,rep,name=affected_nodes,json=affectedNodes" json:"affected_nodes,omitempty"`
+	AuthChecked   bool              `protobuf:"varint,3,opt,name=auth_checked,json=authChecked" json:"auth_checked,omitempty"`
+	AuthError     string            `protobuf:"bytes,4,opt,name=auth_error,json=authError" json:"auth_error,omitempty"`
+}
+
+func (m *DryRunReport) Reset()                    { *m = DryRunReport{} }
+func (m *DryRunReport) String() string            { return proto.CompactTextString(m) }
+func (*DryRunReport) ProtoMessage()               {}
+func (*DryRunReport) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *DryRunReport) GetChanges() []*ManifestChange {
+	if m != nil {
+		return m.Changes
+	}
+	return nil
+}
+
+func (m *DryRunReport) GetAffectedNodes() []string {
+	if m != nil {
+		return m.AffectedNodes
+	}
+	return nil
+}
+
+func (m *DryRunReport) GetAuthChecked() bool {
+	if m != nil {
+		return m.AuthChecked
+	}
+	return false
+}
+
+func (m *DryRunReport) GetAuthError() string {
+	if m != nil {
+		return m.AuthError
+	}
+	return ""
+}
+
+// models manifest.FieldChange
+type ManifestChange struct {
+	Field string `protobuf:"bytes,1,opt,name=field" json:"field,omitempty"`
+	Old   string `protobuf:"bytes,2,opt,name=old" json:"old,omitempty"`
+	New   string `protobuf:"bytes,3,opt,name=new" json:"new,omitempty"`
+}
+
+func (m *ManifestChange) Reset()                    { *m = ManifestChange{} }
+func (m *ManifestChange) String() string            { return proto.CompactTextString(m) }
+func (*ManifestChange) ProtoMessage()               {}
+func (*ManifestChange) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *ManifestChange) GetField() string {
+	if m != nil {
+		return m.Field
+	}
+	return ""
+}
+
+func (m *ManifestChange) GetOld() string {
+	if m != nil {
+		return m.Old
+	}
+	return ""
+}
+
+func (m *ManifestChange) GetNew() string {
+	if m != nil {
+		return m.New
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*DaemonSet)(nil), "daemonsetstore.DaemonSet")
 	proto.RegisterType((*ListDaemonSetsRequest)(nil), "daemonsetstore.ListDaemonSetsRequest")
@@ -226,6 +353,10 @@ func init() {
 	proto.RegisterType((*DisableDaemonSetResponse)(nil), "daemonsetstore.DisableDaemonSetResponse")
 	proto.RegisterType((*WatchDaemonSetsRequest)(nil), "daemonsetstore.WatchDaemonSetsRequest")
 	proto.RegisterType((*WatchDaemonSetsResponse)(nil), "daemonsetstore.WatchDaemonSetsResponse")
+	proto.RegisterType((*UpdateDaemonSetManifestDryRunRequest)(nil), "daemonsetstore.UpdateDaemonSetManifestDryRunRequest")
+	proto.RegisterType((*UpdateDaemonSetManifestDryRunResponse)(nil), "daemonsetstore.UpdateDaemonSetManifestDryRunResponse")
+	proto.RegisterType((*DryRunReport)(nil), "daemonsetstore.DryRunReport")
+	proto.RegisterType((*ManifestChange)(nil), "daemonsetstore.ManifestChange")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -242,6 +373,7 @@ type P2DaemonSetStoreClient interface {
 	ListDaemonSets(ctx context.Context, in *ListDaemonSetsRequest, opts ...grpc.CallOption) (*ListDaemonSetsResponse, error)
 	DisableDaemonSet(ctx context.Context, in *DisableDaemonSetRequest, opts ...grpc.CallOption) (*DisableDaemonSetResponse, error)
 	WatchDaemonSets(ctx context.Context, in *WatchDaemonSetsRequest, opts ...grpc.CallOption) (P2DaemonSetStore_WatchDaemonSetsClient, error)
+	UpdateDaemonSetManifestDryRun(ctx context.Context, in *UpdateDaemonSetManifestDryRunRequest, opts ...grpc.CallOption) (*UpdateDaemonSetManifestDryRunResponse, error)
 }
 
 type p2DaemonSetStoreClient struct {
@@ -302,12 +434,22 @@ func (x *p2DaemonSetStoreWatchDaemonSetsClient) Recv() (*WatchDaemonSetsResponse
 	return m, nil
 }
 
+func (c *p2DaemonSetStoreClient) UpdateDaemonSetManifestDryRun(ctx context.Context, in *UpdateDaemonSetManifestDryRunRequest, opts ...grpc.CallOption) (*UpdateDaemonSetManifestDryRunResponse, error) {
+	out := new(UpdateDaemonSetManifestDryRunResponse)
+	err := grpc.Invoke(ctx, "/daemonsetstore.P2DaemonSetStore/UpdateDaemonSetManifestDryRun", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for P2DaemonSetStore service
 
 type P2DaemonSetStoreServer interface {
 	ListDaemonSets(context.Context, *ListDaemonSetsRequest) (*ListDaemonSetsResponse, error)
 	DisableDaemonSet(context.Context, *DisableDaemonSetRequest) (*DisableDaemonSetResponse, error)
 	WatchDaemonSets(*WatchDaemonSetsRequest, P2DaemonSetStore_WatchDaemonSetsServer) error
+	UpdateDaemonSetManifestDryRun(context.Context, *UpdateDaemonSetManifestDryRunRequest) (*UpdateDaemonSetManifestDryRunResponse, error)
 }
 
 func RegisterP2DaemonSetStoreServer(s *grpc.Server, srv P2DaemonSetStoreServer) {
@@ -371,6 +513,24 @@ func (x *p2DaemonSetStoreWatchDaemonSetsServer) Send(m *WatchDaemonSetsResponse)
 	return x.ServerStream.SendMsg(m)
 }
 
+func _P2DaemonSetStore_UpdateDaemonSetManifestDryRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateDaemonSetManifestDryRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2DaemonSetStoreServer).UpdateDaemonSetManifestDryRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/daemonsetstore.P2DaemonSetStore/UpdateDaemonSetManifestDryRun",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2DaemonSetStoreServer).UpdateDaemonSetManifestDryRun(ctx, req.(*UpdateDaemonSetManifestDryRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _P2DaemonSetStore_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "daemonsetstore.P2DaemonSetStore",
 	HandlerType: (*P2DaemonSetStoreServer)(nil),
@@ -383,6 +543,10 @@ var _P2DaemonSetStore_serviceDesc = grpc.ServiceDesc{
 			MethodName: "DisableDaemonSet",
 			Handler:    _P2DaemonSetStore_DisableDaemonSet_Handler,
 		},
+		{
+			MethodName: "UpdateDaemonSetManifestDryRun",
+			Handler:    _P2DaemonSetStore_UpdateDaemonSetManifestDryRun_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -399,34 +563,46 @@ func init() {
 }
 
 var fileDescriptor0 = []byte{
-	// 454 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x84, 0x94, 0xcf, 0x6e, 0xd3, 0x40,
-	0x10, 0xc6, 0xb1, 0xd3, 0xfc, 0xf1, 0x84, 0x86, 0x6a, 0x44, 0x9b, 0x25, 0x12, 0x52, 0x64, 0x04,
-	0xf5, 0xa9, 0x41, 0xc9, 0x05, 0x21, 0x71, 0xeb, 0x81, 0x4a, 0x1c, 0x90, 0x53, 0x89, 0xa3, 0xe5,
-	0x66, 0xa7, 0xc9, 0x0a, 0xdb, 0x6b, 0xbc, 0x9b, 0x57, 0xe4, 0xc8, 0x13, 0xf0, 0x30, 0xc8, 0x6b,
-	0x67, 0xa3, 0xd8, 0x11, 0xbe, 0x65, 0xbe, 0xf9, 0x7e, 0x3b, 0xeb, 0x6f, 0x56, 0x81, 0x55, 0xfe,
-	0x73, 0xbb, 0xd8, 0x16, 0xf9, 0x66, 0xc1, 0x63, 0x4a, 0x65, 0xa6, 0x48, 0x2b, 0x2d, 0x0b, 0x5a,
-	0xe4, 0x85, 0xd4, 0x52, 0x35, 0xd4, 0x3b, 0xa3, 0xe2, 0xe4, 0x54, 0xf5, 0xff, 0x3a, 0xe0, 0xdd,
-	0x1b, 0x69, 0x4d, 0x1a, 0x27, 0xe0, 0x0a, 0xce, 0x9c, 0xb9, 0x13, 0x78, 0xa1, 0x2b, 0x38, 0xce,
-	0x60, 0xc4, 0x85, 0x8a, 0x9f, 0x12, 0xe2, 0xcc, 0x9d, 0x3b, 0xc1, 0x28, 0xb4, 0x75, 0xd9, 0x4b,
-	0xe3, 0x4c, 0x3c, 0x93, 0xd2, 0xac, 0x67, 0x08, 0x5b, 0xe3, 0x5b, 0x80, 0x54, 0x64, 0xd1, 0x8e,
-	0xe2, 0x44, 0xef, 0xd8, 0xc5, 0xdc, 0x09, 0x7a, 0xa1, 0x97, 0x8a, 0xec, 0xab, 0x11, 0x10, 0xe1,
-	0x22, 0x8b, 0x53, 0x62, 0x7d, 0x83, 0x99, 0xdf, 0xf8, 0x0e, 0x2e, 0x33, 0xc9, 0x29, 0x52, 0x94,
-	0xd0, 0x46, 0xcb, 0x82, 0x0d, 0x4c, 0xf3, 0x65, 0x29, 0xae, 0x6b, 0x0d, 0xaf, 0x61, 0x90, 0x4b,
-	0x1e, 0x09, 0xce, 0x86, 0xa6, 0xdb, 0xcf, 0x25, 0x7f, 0xe0, 0xc8, 0x60, 0xa8, 0x45, 0x4a, 0x72,
-	0xaf, 0xd9, 0xc8, 0xcc, 0x3a, 0x94, 0xfe, 0x14, 0xae, 0xbf, 0x09, 0xa5, 0xed, 0x17, 0xaa, 0x90,
-	0x7e, 0xed, 0x49, 0x69, 0xff, 0x11, 0x6e, 0x9a, 0x0d, 0x95, 0x97, 0xb9, 0xe0, 0x67, 0x18, 0x57,
-	0x19, 0x45, 0x65, 0x48, 0xcc, 0x99, 0xf7, 0x82, 0xf1, 0xf2, 0xcd, 0x5d, 0x23, 0x4d, 0x0b, 0x86,
-	0xc0, 0xed, 0x19, 0xfe, 0x17, 0x98, 0xde, 0x57, 0xf9, 0x1c, 0xfb, 0xd5, 0x40, 0xf4, 0xe1, 0xf2,
-	0x78, 0x6c, 0x64, 0x53, 0x1e, 0x5b, 0xfa, 0x81, 0xfb, 0x8f, 0xc0, 0xda, 0x78, 0x7d, 0xad, 0x4f,
-	0x00, 0x47, 0xde, 0xc0, 0xff, 0xbd, 0x95, 0x67, 0xcf, 0xf5, 0x19, 0xdc, 0xfc, 0x88, 0xf5, 0x66,
-	0xd7, 0x0e, 0xe1, 0x8f, 0x03, 0xd3, 0x56, 0xab, 0x9e, 0xb7, 0x82, 0xe1, 0xa6, 0xa0, 0x58, 0x13,
-	0xef, 0x8e, 0xe0, 0xe0, 0x2c, 0xa1, 0x7d, 0xce, 0x0d, 0xe4, 0x76, 0x42, 0xb5, 0xb3, 0x84, 0x38,
-	0x25, 0x54, 0x42, 0xbd, 0x4e, 0xa8, 0x76, 0xe2, 0x6b, 0xe8, 0x53, 0x51, 0xc8, 0xc2, 0x3c, 0x2e,
-	0x2f, 0xac, 0x8a, 0xe5, 0x6f, 0x17, 0xae, 0xbe, 0x2f, 0xad, 0x7d, 0x5d, 0xd2, 0x18, 0xc3, 0xe4,
-	0x74, 0xd5, 0xf8, 0xbe, 0x39, 0xe0, 0xec, 0x1b, 0x99, 0x7d, 0xe8, 0xb2, 0x55, 0x51, 0xf9, 0x2f,
-	0x70, 0x0b, 0x57, 0xcd, 0xc5, 0xe1, 0x6d, 0xeb, 0x2b, 0xce, 0xbf, 0x8c, 0x59, 0xd0, 0x6d, 0xb4,
-	0x83, 0x9e, 0xe1, 0x55, 0x63, 0x61, 0xd8, 0xba, 0xe5, 0xf9, 0x65, 0xcf, 0x6e, 0x3b, 0x7d, 0x87,
-	0x29, 0x1f, 0x9d, 0xa7, 0x81, 0xf9, 0xb7, 0x58, 0xfd, 0x0b, 0x00, 0x00, 0xff, 0xff, 0x7f, 0x24,
-	0x1b, 0x55, 0x64, 0x04, 0x00, 0x00,
+	// 652 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xa5, 0x55, 0xdb, 0x6e, 0xd3, 0x40,
+	0x10, 0xc5, 0x71, 0x6e, 0x9e, 0x24, 0x26, 0x5a, 0xd1, 0xc6, 0x44, 0x14, 0x81, 0x4b, 0x68, 0x9e,
+	0x1a, 0x94, 0x80, 0x84, 0x90, 0x78, 0xa1, 0x41, 0xa2, 0x08, 0x10, 0x72, 0x40, 0x3c, 0x5a, 0xae,
+	0x77, 0x1d, 0x5b, 0x4d, 0x6c, 0xe3, 0x8b, 0x50, 0x7f, 0x82, 0xbf, 0xe0, 0x03, 0xf8, 0x11, 0x5e,
+	0x79, 0xe1, 0x63, 0xd8, 0x5d, 0x5f, 0x92, 0xd8, 0x51, 0x4d, 0xc5, 0x9b, 0xe7, 0xcc, 0x9c, 0x9d,
+	0xd9, 0x39, 0x33, 0x6b, 0x98, 0xf9, 0x97, 0xcb, 0xc9, 0x32, 0xf0, 0xcd, 0x09, 0x36, 0xc8, 0xda,
+	0x73, 0x43, 0x12, 0x85, 0x91, 0x17, 0x90, 0x89, 0x1f, 0x78, 0x91, 0x17, 0x16, 0xd0, 0x53, 0x8e,
+	0x22, 0x79, 0x17, 0x55, 0xff, 0x08, 0x20, 0xcd, 0x39, 0xb4, 0x20, 0x11, 0x92, 0xa1, 0xe6, 0x60,
+	0x45, 0x78, 0x20, 0x8c, 0x25, 0x8d, 0x7e, 0xa1, 0x21, 0xb4, 0xb1, 0x13, 0x1a, 0x17, 0x2b, 0x82,
+	0x95, 0x1a, 0x45, 0xdb, 0x5a, 0x6e, 0x33, 0xdf, 0xda, 0x70, 0x1d, 0x8b, 0x84, 0x91, 0x22, 0x72,
+	0x46, 0x6e, 0xa3, 0x23, 0x80, 0xb5, 0xe3, 0xea, 0x36, 0x31, 0x56, 0x91, 0xad, 0xd4, 0xa9, 0x57,
+	0xd4, 0x24, 0x8a, 0xbc, 0xe1, 0x00, 0x42, 0x50, 0x77, 0x8d, 0x35, 0x51, 0x1a, 0x9c, 0xc6, 0xbf,
+	0xd1, 0x31, 0xf4, 0x5c, 0x0f, 0x13, 0x3d, 0x24, 0x2b, 0x62, 0xd2, 0xd2, 0x94, 0x26, 0x77, 0x76,
+	0x19, 0xb8, 0x48, 0x31, 0x74, 0x00, 0x4d, 0xdf, 0xc3, 0x3a, 0xad, 0xb1, 0xc5, 0xbd, 0x0d, 0x6a,
+	0x9d, 0x63, 0xa4, 0x40, 0x2b, 0x72, 0xd6, 0xc4, 0x8b, 0x23, 0xa5, 0xcd, 0x73, 0x65, 0xa6, 0x3a,
+	0x80, 0x83, 0x77, 0x4e, 0x18, 0xe5, 0x37, 0x0c, 0x35, 0xf2, 0x35, 0xa6, 0x15, 0xaa, 0x9f, 0xe0,
+	0xb0, 0xe8, 0x08, 0x7d, 0xd6, 0x17, 0xf4, 0x02, 0x3a, 0x49, 0x8f, 0x74, 0xd6, 0x24, 0xda, 0x0c,
+	0x71, 0xdc, 0x99, 0xde, 0x3d, 0x2d, 0x74, 0x33, 0x27, 0x6a, 0x80, 0xf3, 0x33, 0xd4, 0x97, 0x30,
+	0x98, 0x27, 0xfd, 0xd9, 0xf8, 0x93, 0x84, 0x48, 0x85, 0xde, 0xe6, 0x58, 0x3d, 0xef, 0x72, 0x27,
+	0x67, 0x9f, 0x63, 0x5a, 0x94, 0x52, 0xa6, 0xa7, 0x65, 0x3d, 0x07, 0xd8, 0xf0, 0x39, 0xf9, 0xda,
+	0xaa, 0xa4, 0xfc, 0x5c, 0x55, 0x81, 0xc3, 0x2f, 0x46, 0x64, 0xda, 0xe5, 0x26, 0xfc, 0x12, 0x60,
+	0x50, 0x72, 0xa5, 0xf9, 0x66, 0xd0, 0x32, 0x03, 0x62, 0x44, 0x04, 0x57, 0xb7, 0x20, 0x8b, 0x64,
+	0xa4, 0xd8, 0xc7, 0x9c, 0x54, 0xab, 0x24, 0xa5, 0x91, 0x8c, 0x84, 0xa9, 0xc0, 0x8c, 0x24, 0x56,
+	0x92, 0xd2, 0x48, 0x74, 0x07, 0x1a, 0x24, 0x08, 0xe8, 0x98, 0xd4, 0x93, 0x41, 0xe0, 0x86, 0x6a,
+	0xc1, 0xa3, 0xcf, 0xfc, 0xd4, 0x9c, 0xf1, 0x3e, 0x1d, 0xc9, 0x79, 0x70, 0xa5, 0xc5, 0xee, 0x0d,
+	0xc4, 0xd8, 0x99, 0xef, 0xda, 0xee, 0x7c, 0xab, 0x3f, 0x04, 0x18, 0x55, 0x24, 0xfa, 0x5f, 0xd9,
+	0xd0, 0x2b, 0x90, 0x71, 0x70, 0xa5, 0x07, 0xb1, 0xab, 0x07, 0xc4, 0xf7, 0x82, 0xa4, 0x8a, 0xce,
+	0xf4, 0x5e, 0x89, 0x9d, 0x66, 0x64, 0x31, 0x5a, 0x17, 0x6f, 0x59, 0xea, 0x4f, 0x01, 0xba, 0xdb,
+	0x6e, 0x5a, 0x4e, 0xcb, 0xb4, 0x0d, 0x77, 0x49, 0xb2, 0xc1, 0xbe, 0x5f, 0x3c, 0x2d, 0xbb, 0xc7,
+	0x19, 0x0f, 0xd3, 0xb2, 0x70, 0x34, 0x02, 0xd9, 0xb0, 0x2c, 0xba, 0x86, 0x04, 0xeb, 0x6c, 0x27,
+	0x43, 0xae, 0xb0, 0xa4, 0xf5, 0x32, 0xf4, 0x03, 0x03, 0xd1, 0x43, 0xe8, 0x1a, 0x71, 0x64, 0xeb,
+	0xa6, 0x4d, 0xcc, 0x4b, 0xae, 0x28, 0x7b, 0x35, 0x3a, 0x0c, 0x3b, 0x4b, 0x20, 0xf6, 0x38, 0xf0,
+	0x90, 0x6d, 0xfd, 0x24, 0x86, 0xbc, 0xe6, 0x1a, 0xbe, 0x05, 0x79, 0xb7, 0x06, 0xa6, 0xb5, 0xe5,
+	0x90, 0x55, 0xa6, 0x52, 0x62, 0xa0, 0x3e, 0x88, 0xde, 0x0a, 0xa7, 0xd2, 0xb0, 0x4f, 0x86, 0xb8,
+	0xe4, 0x5b, 0xfa, 0x18, 0xb1, 0xcf, 0xe9, 0x6f, 0x11, 0xfa, 0x1f, 0xa7, 0x79, 0x7b, 0x17, 0xec,
+	0x86, 0xc8, 0x00, 0x79, 0x77, 0xf5, 0xd1, 0xa8, 0xd8, 0x84, 0xbd, 0x6f, 0xc6, 0xf0, 0x71, 0x55,
+	0x58, 0xa2, 0xb9, 0x7a, 0x0b, 0x2d, 0xa1, 0x5f, 0x5c, 0x64, 0x74, 0x52, 0xd2, 0x6d, 0xff, 0x4b,
+	0x31, 0x1c, 0x57, 0x07, 0xe6, 0x89, 0x2c, 0xb8, 0x5d, 0x58, 0x60, 0x54, 0xaa, 0x72, 0xff, 0xf2,
+	0x0f, 0x4f, 0x2a, 0xe3, 0x92, 0x2c, 0x4f, 0x04, 0x9a, 0xe7, 0xbb, 0x00, 0x47, 0xd7, 0x0e, 0x3c,
+	0x7a, 0x5a, 0x3c, 0xee, 0x5f, 0x16, 0x71, 0xf8, 0xec, 0x86, 0xac, 0xec, 0xe2, 0x17, 0x4d, 0xfe,
+	0x3b, 0x9b, 0xfd, 0x05, 0xb9, 0xc2, 0xca, 0x2a, 0x05, 0x07, 0x00, 0x00,
 }
@@ -0,0 +1,185 @@
+// Code generated by protoc-gen-go.
+// source: pkg/grpc/rcstore/protos/rcstore.proto
+// DO NOT EDIT!
+
+/*
+Package rcstore is a generated protocol buffer package.
+
+It is generated from these files:
+	pkg/grpc/rcstore/protos/rcstore.proto
+
+It has these top-level messages:
+	UpdateManifestDryRunRequest
+	UpdateManifestDryRunResponse
+*/
+package rcstore
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import daemonsetstore "github.com/square/p2/pkg/grpc/daemonsetstore/protos"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type UpdateManifestDryRunRequest struct {
+	RcId     string `protobuf:"bytes,1,opt,name=rc_id,json=rcId" json:"rc_id,omitempty"`
+	Manifest string `protobuf:"bytes,2,opt,name=manifest" json:"manifest,omitempty"`
+}
+
+func (m *UpdateManifestDryRunRequest) Reset()                    { *m = UpdateManifestDryRunRequest{} }
+func (m *UpdateManifestDryRunRequest) String() string            { return proto.CompactTextString(m) }
+func (*UpdateManifestDryRunRequest) ProtoMessage()               {}
+func (*UpdateManifestDryRunRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *UpdateManifestDryRunRequest) GetRcId() string {
+	if m != nil {
+		return m.RcId
+	}
+	return ""
+}
+
+func (m *UpdateManifestDryRunRequest) GetManifest() string {
+	if m != nil {
+		return m.Manifest
+	}
+	return ""
+}
+
+type UpdateManifestDryRunResponse struct {
+	// the manifest the replication controller would have after the update
+	Manifest     string                       `protobuf:"bytes,1,opt,name=manifest" json:"manifest,omitempty"`
+	DryRunReport *daemonsetstore.DryRunReport `protobuf:"bytes,2,opt,name=dry_run_report,json=dryRunReport" json:"dry_run_report,omitempty"`
+}
+
+func (m *UpdateManifestDryRunResponse) Reset()                    { *m = UpdateManifestDryRunResponse{} }
+func (m *UpdateManifestDryRunResponse) String() string            { return proto.CompactTextString(m) }
+func (*UpdateManifestDryRunResponse) ProtoMessage()               {}
+func (*UpdateManifestDryRunResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *UpdateManifestDryRunResponse) GetManifest() string {
+	if m != nil {
+		return m.Manifest
+	}
+	return ""
+}
+
+func (m *UpdateManifestDryRunResponse) GetDryRunReport() *daemonsetstore.DryRunReport {
+	if m != nil {
+		return m.DryRunReport
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*UpdateManifestDryRunRequest)(nil), "rcstore.UpdateManifestDryRunRequest")
+	proto.RegisterType((*UpdateManifestDryRunResponse)(nil), "rcstore.UpdateManifestDryRunResponse")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for P2RCStore service
+
+type P2RCStoreClient interface {
+	UpdateManifestDryRun(ctx context.Context, in *UpdateManifestDryRunRequest, opts ...grpc.CallOption) (*UpdateManifestDryRunResponse, error)
+}
+
+type p2RCStoreClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewP2RCStoreClient(cc *grpc.ClientConn) P2RCStoreClient {
+	return &p2RCStoreClient{cc}
+}
+
+func (c *p2RCStoreClient) UpdateManifestDryRun(ctx context.Context, in *UpdateManifestDryRunRequest, opts ...grpc.CallOption) (*UpdateManifestDryRunResponse, error) {
+	out := new(UpdateManifestDryRunResponse)
+	err := grpc.Invoke(ctx, "/rcstore.P2RCStore/UpdateManifestDryRun", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for P2RCStore service
+
+type P2RCStoreServer interface {
+	UpdateManifestDryRun(context.Context, *UpdateManifestDryRunRequest) (*UpdateManifestDryRunResponse, error)
+}
+
+func RegisterP2RCStoreServer(s *grpc.Server, srv P2RCStoreServer) {
+	s.RegisterService(&_P2RCStore_serviceDesc, srv)
+}
+
+func _P2RCStore_UpdateManifestDryRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateManifestDryRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2RCStoreServer).UpdateManifestDryRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rcstore.P2RCStore/UpdateManifestDryRun",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2RCStoreServer).UpdateManifestDryRun(ctx, req.(*UpdateManifestDryRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _P2RCStore_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "rcstore.P2RCStore",
+	HandlerType: (*P2RCStoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "UpdateManifestDryRun",
+			Handler:    _P2RCStore_UpdateManifestDryRun_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pkg/grpc/rcstore/protos/rcstore.proto",
+}
+
+func init() {
+	proto.RegisterFile("pkg/grpc/rcstore/protos/rcstore.proto", fileDescriptor0)
+}
+
+var fileDescriptor0 = []byte{
+	// 225 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe3, 0x52, 0x2d, 0xc8, 0x4e, 0xd7,
+	0x4f, 0x2f, 0x2a, 0x48, 0xd6, 0x2f, 0x4a, 0x2e, 0x2e, 0xc9, 0x2f, 0x4a, 0xd5, 0x2f, 0x28, 0xca,
+	0x2f, 0xc9, 0x2f, 0x86, 0x71, 0xf5, 0xc0, 0x5c, 0x21, 0x76, 0x28, 0x57, 0xca, 0x18, 0xae, 0x3e,
+	0x25, 0x31, 0x35, 0x37, 0x3f, 0xaf, 0x38, 0xb5, 0x04, 0x45, 0x1b, 0xaa, 0x28, 0x44, 0xb7, 0x92,
+	0x1f, 0x97, 0x74, 0x68, 0x41, 0x4a, 0x62, 0x49, 0xaa, 0x6f, 0x62, 0x5e, 0x66, 0x5a, 0x6a, 0x71,
+	0x89, 0x4b, 0x51, 0x65, 0x50, 0x69, 0x5e, 0x50, 0x6a, 0x61, 0x29, 0x90, 0x23, 0x24, 0xcc, 0xc5,
+	0x5a, 0x94, 0x1c, 0x9f, 0x99, 0x22, 0xc1, 0xa8, 0xc0, 0xa8, 0xc1, 0x19, 0xc4, 0x52, 0x94, 0xec,
+	0x99, 0x22, 0x24, 0xc5, 0xc5, 0x91, 0x0b, 0x55, 0x2d, 0xc1, 0x04, 0x16, 0x87, 0xf3, 0x95, 0xea,
+	0xb8, 0x64, 0xb0, 0x9b, 0x57, 0x5c, 0x00, 0xb2, 0x1b, 0x45, 0x2f, 0x23, 0xaa, 0x5e, 0x21, 0x27,
+	0x2e, 0xbe, 0x94, 0xa2, 0xca, 0xf8, 0xa2, 0xd2, 0xbc, 0xf8, 0xa2, 0xd4, 0x82, 0xfc, 0x22, 0x88,
+	0xe9, 0xdc, 0x46, 0x32, 0x7a, 0x68, 0x4e, 0x87, 0x99, 0x09, 0x52, 0x13, 0xc4, 0x93, 0x82, 0xc4,
+	0x33, 0x2a, 0xe2, 0xe2, 0x0c, 0x30, 0x0a, 0x72, 0x0e, 0x06, 0xa9, 0x13, 0x4a, 0xe5, 0x12, 0xc1,
+	0xe6, 0x18, 0x21, 0x15, 0x3d, 0x58, 0x10, 0xe2, 0xf1, 0xbb, 0x94, 0x2a, 0x01, 0x55, 0x10, 0x1f,
+	0x29, 0x31, 0x24, 0xb1, 0x81, 0x83, 0xd2, 0x18, 0x00, 0x3b, 0xb9, 0x7f, 0xa8, 0xb1, 0x01, 0x00,
+	0x00,
+}
@@ -0,0 +1,84 @@
+package rcstore
+
+import (
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/dryrun"
+	"github.com/square/p2/pkg/grpc/daemonsetstore"
+	rcstore_protos "github.com/square/p2/pkg/grpc/rcstore/protos"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/rc"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+type ConsulStore interface {
+	UpdateManifestDryRun(id fields.ID, man manifest.Manifest) (fields.RC, fields.RC, error)
+}
+
+// Store serves dry runs of replication controller changes. It never writes
+// to the replication controllers themselves.
+type Store struct {
+	consulStore ConsulStore
+
+	// Used to find the nodes an RC's pods are scheduled on
+	labeler rc.LabelMatcher
+
+	// The deploy policy dry runs check manifests against. Manifests aren't
+	// checked if it is nil
+	policy auth.Policy
+
+	logger logging.Logger
+}
+
+func NewServer(consulStore ConsulStore, labeler rc.LabelMatcher, policy auth.Policy, logger logging.Logger) Store {
+	return Store{
+		consulStore: consulStore,
+		labeler:     labeler,
+		policy:      policy,
+		logger:      logger,
+	}
+}
+
+var _ rcstore_protos.P2RCStoreServer = Store{}
+
+// UpdateManifestDryRun reports what setting the manifest of a replication
+// controller would change, without changing it.
+func (s Store) UpdateManifestDryRun(_ context.Context, req *rcstore_protos.UpdateManifestDryRunRequest) (*rcstore_protos.UpdateManifestDryRunResponse, error) {
+	id, err := fields.ToRCID(req.GetRcId())
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	newManifest, err := manifest.FromBytes([]byte(req.GetManifest()))
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "could not parse manifest: %s", err)
+	}
+
+	oldRC, newRC, err := s.consulStore.UpdateManifestDryRun(id, newManifest)
+	switch {
+	case rcstore.IsNotExist(err):
+		return nil, grpc.Errorf(codes.NotFound, "no replication controller with id %s was found", id)
+	case err != nil:
+		return nil, grpc.Errorf(codes.Unavailable, "could not update replication controller %s: %s", id, err)
+	}
+
+	pods, err := rc.CurrentPods(id, s.labeler)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not find the nodes of replication controller %s: %s", id, err)
+	}
+
+	manifestBytes, err := newRC.Manifest.Marshal()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not marshal manifest: %s", err)
+	}
+	report := dryrun.NewReport(oldRC.Manifest, newRC.Manifest, pods.Nodes(), s.policy, s.logger)
+	return &rcstore_protos.UpdateManifestDryRunResponse{
+		Manifest:     string(manifestBytes),
+		DryRunReport: daemonsetstore.ReportToProto(report),
+	}, nil
+}
@@ -0,0 +1,95 @@
+// +build !race
+
+package rcstore
+
+import (
+	"context"
+	"testing"
+
+	rcstore_protos "github.com/square/p2/pkg/grpc/rcstore/protos"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/rc"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+
+	"github.com/pborman/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+func TestUpdateManifestDryRun(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+	rcStore := rcstore.NewConsul(fixture.Client, applicator, 0)
+
+	builder := manifest.NewBuilder()
+	builder.SetID("fooapp")
+	rcFields, err := rcStore.Create(builder.GetManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, fields.StaticStrategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range []string{"node1", "node2"} {
+		err = applicator.SetLabel(labels.POD, node+"/fooapp", rc.RCIDLabel, rcFields.ID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	builder.SetRunAsUser("nobody")
+	newManifest, err := builder.GetManifest().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(rcStore, applicator, nil, logging.DefaultLogger)
+	resp, err := server.UpdateManifestDryRun(context.Background(), &rcstore_protos.UpdateManifestDryRunRequest{
+		RcId:     rcFields.ID.String(),
+		Manifest: string(newManifest),
+	})
+	if err != nil {
+		t.Fatalf("error doing a dry run of a manifest update: %s", err)
+	}
+
+	report := resp.GetDryRunReport()
+	if len(report.Changes) != 1 || report.Changes[0].Field != "run_as" || report.Changes[0].New != "nobody" {
+		t.Errorf("expected the run_as change to be reported but the changes were %v", report.Changes)
+	}
+	if len(report.AffectedNodes) != 2 {
+		t.Errorf("expected 2 affected nodes but there were %d", len(report.AffectedNodes))
+	}
+	if report.AuthChecked {
+		t.Error("the manifest shouldn't have been checked without a deploy policy")
+	}
+	if resp.Manifest != string(newManifest) {
+		t.Errorf("expected the updated manifest to be %q but was %q", string(newManifest), resp.Manifest)
+	}
+
+	rcFields, err = rcStore.Get(rcFields.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcFields.Manifest.RunAsUser() == "nobody" {
+		t.Error("a dry run shouldn't have changed the replication controller")
+	}
+
+	_, err = server.UpdateManifestDryRun(context.Background(), &rcstore_protos.UpdateManifestDryRunRequest{
+		RcId:     uuid.New(),
+		Manifest: string(newManifest),
+	})
+	if grpc.Code(err) != codes.NotFound {
+		t.Errorf("expected a not found error for a missing replication controller but got %v", err)
+	}
+
+	_, err = server.UpdateManifestDryRun(context.Background(), &rcstore_protos.UpdateManifestDryRunRequest{
+		RcId:     "bad rc ID",
+		Manifest: string(newManifest),
+	})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected an invalid argument error for a malformed ID but got %v", err)
+	}
+}
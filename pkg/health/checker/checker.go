@@ -291,6 +291,11 @@ func consulWatchToResult(w consul.WatchResult) health.Result {
 		Node:    w.Node,
 		Service: w.Service,
 		Status:  health.ToHealthState(w.Status),
+
+		Output:     w.Output,
+		HTTPStatus: w.HTTPStatus,
+		Latency:    w.Latency,
+		Error:      w.Error,
 	}
 }
 
@@ -30,6 +30,10 @@ func TestService(t *testing.T) {
 		Node:    "node1",
 		Service: "slug",
 		Status:  "passing",
+
+		Output:     "OK",
+		HTTPStatus: 200,
+		Latency:    3 * time.Millisecond,
 	}
 	fakeStore := fakeConsulStore{
 		results: map[string]consul.WatchResult{"node1": result1},
@@ -46,6 +50,10 @@ func TestService(t *testing.T) {
 		Node:    "node1",
 		Service: "slug",
 		Status:  "passing",
+
+		Output:     "OK",
+		HTTPStatus: 200,
+		Latency:    3 * time.Millisecond,
 	}
 	Assert(t).AreEqual(results["node1"], expected, "Unexpected results calling Service()")
 }
@@ -1,6 +1,8 @@
 package health
 
 import (
+	"time"
+
 	"github.com/square/p2/pkg/types"
 )
 
@@ -10,6 +12,16 @@ type Result struct {
 	Node    types.NodeName
 	Service string
 	Status  HealthState
+
+	// What the check's response body started with
+	Output string
+	// The HTTP status of the check's response, 0 if there was none
+	HTTPStatus int
+	// How long the check took
+	Latency time.Duration
+	// Why the check failed without a response, or why the service is
+	// critical regardless of its response
+	Error string
 }
 
 // ResultList is a type alias that adds some extra methods that operate on the list.
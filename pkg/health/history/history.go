@@ -0,0 +1,372 @@
+// Package history keeps a bounded local record of the changes in health of
+// the services on a node, so that flapping services can be found after the
+// fact. Consul only holds the latest health of each service, and the health
+// manager reports services that flap as unknown.
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/sqlite"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// DefaultMaxTransitions is how many transitions are kept per service
+	// when the config doesn't say
+	DefaultMaxTransitions = 1000
+
+	// MaxOutputLength is how much of a check's output is kept with each
+	// transition
+	MaxOutputLength = 1024
+)
+
+// Config configures the health history kept by the preparer.
+type Config struct {
+	// Path to the sqlite database holding the history. The history is only
+	// kept if this is set.
+	SQLitePath string `yaml:"sqlite_path,omitempty"`
+
+	// How many transitions are kept per service. Older transitions are
+	// deleted. Defaults to DefaultMaxTransitions
+	MaxTransitions int `yaml:"max_transitions,omitempty"`
+}
+
+// Transition is a change in the health of a service on this node.
+type Transition struct {
+	// Determined automatically by sqlite (via AUTOINCREMENT)
+	ID int64 `json:"id"`
+
+	PodID   types.PodID `json:"pod_id"`
+	Service string      `json:"service"`
+	// The health before the transition, empty if the service had no
+	// recorded health
+	Previous health.HealthState `json:"previous"`
+	Status   health.HealthState `json:"status"`
+	// What the health check reported, e.g. an error or HTTP status
+	Output string    `json:"output,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+type Store interface {
+	// Closes the database connection
+	Close() error
+	// Runs any outstanding migrations
+	Migrate() error
+	// Inserts a transition
+	Insert(transition Transition) error
+	// Returns the latest transition of a service, or sql.ErrNoRows if it
+	// has none
+	LastTransition(service string) (Transition, error)
+	// Returns the transitions of a pod's services at or after since,
+	// oldest first
+	Transitions(podID types.PodID, since time.Time) ([]Transition, error)
+	// Deletes all but the latest keep transitions of a service
+	Prune(service string, keep int) error
+}
+
+type sqliteStore struct {
+	db     *sql.DB
+	logger logging.Logger
+}
+
+func NewSQLiteStore(sqliteDBPath string, logger logging.Logger) (Store, error) {
+	db, err := sql.Open("sqlite3", sqliteDBPath)
+	if err != nil {
+		return nil, util.Errorf("Could not open database: %s", err)
+	}
+
+	return sqliteStore{
+		db:     db,
+		logger: logger,
+	}, nil
+}
+
+var (
+	sqliteMigrations = []string{
+		`create table transitions (
+	    id integer not null primary key autoincrement,
+	    date datetime not null,
+	    pod_id text not null,
+	    service text not null,
+	    previous text not null,
+	    status text not null,
+	    output text not null
+	);`,
+		"create index transition_pod_date on transitions(pod_id, date);",
+		"create index transition_service on transitions(service);",
+		// FUTURE MIGRATIONS GO HERE
+	}
+)
+
+func (s sqliteStore) Migrate() error {
+	return sqlite.Migrate(s.db, "schema_version", sqliteMigrations)
+}
+
+func (s sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s sqliteStore) Insert(transition Transition) error {
+	_, err := s.db.Exec(`insert into transitions(
+		    date,
+		    pod_id,
+		    service,
+		    previous,
+		    status,
+		    output
+		  ) VALUES(?, ?, ?, ?, ?, ?)`,
+		transition.Time.UTC(),
+		transition.PodID.String(),
+		transition.Service,
+		string(transition.Previous),
+		string(transition.Status),
+		transition.Output,
+	)
+	if err != nil {
+		return util.Errorf("Couldn't insert health transition into sqlite database: %s", err)
+	}
+	return nil
+}
+
+func (s sqliteStore) LastTransition(service string) (Transition, error) {
+	row := s.db.QueryRow(`
+	    SELECT id, date, pod_id, service, previous, status, output
+	    FROM transitions
+	    WHERE service = ?
+	    ORDER BY id DESC LIMIT 1
+	    `, service)
+	return scanRow(row)
+}
+
+func (s sqliteStore) Transitions(podID types.PodID, since time.Time) ([]Transition, error) {
+	rows, err := s.db.Query(`
+	    SELECT id, date, pod_id, service, previous, status, output
+	    FROM transitions
+	    WHERE pod_id = ? AND date >= ?
+	    ORDER BY id
+	    `, podID.String(), since.UTC())
+	if err != nil {
+		return nil, util.Errorf("Could not query for health transitions: %s", err)
+	}
+	defer rows.Close()
+
+	var transitions []Transition
+	for rows.Next() {
+		transition, err := scanRow(rows)
+		if err != nil {
+			return nil, util.Errorf("Could not scan row: %s", err)
+		}
+		transitions = append(transitions, transition)
+	}
+	return transitions, rows.Err()
+}
+
+func (s sqliteStore) Prune(service string, keep int) error {
+	_, err := s.db.Exec(`
+	    DELETE
+	    FROM transitions
+	    WHERE service = ? AND id NOT IN (
+	      SELECT id FROM transitions WHERE service = ? ORDER BY id DESC LIMIT ?
+	    )
+	    `, service, service, keep)
+	return err
+}
+
+// Implemented by both *sql.Row and *sql.Rows
+type Scanner interface {
+	Scan(...interface{}) error
+}
+
+// Runs Scan() once on the passed Scanner and converts the result to a Transition
+func scanRow(scanner Scanner) (Transition, error) {
+	var id int64
+	var date time.Time
+	var podID, service, previous, status, output string
+
+	err := scanner.Scan(&id, &date, &podID, &service, &previous, &status, &output)
+	if err != nil {
+		return Transition{}, err
+	}
+
+	return Transition{
+		ID:       id,
+		PodID:    types.PodID(podID),
+		Service:  service,
+		Previous: health.HealthState(previous),
+		Status:   health.HealthState(status),
+		Output:   output,
+		Time:     date,
+	}, nil
+}
+
+// Recorder turns the results of health checks into transitions, recording a
+// transition whenever the health of a service differs from the last one
+// recorded. It is safe for concurrent use.
+type Recorder struct {
+	store          Store
+	maxTransitions int
+	logger         logging.Logger
+
+	mu sync.Mutex
+	// The last recorded health of each service, filled from the store the
+	// first time a service is seen so that restarts don't record spurious
+	// transitions
+	last map[string]health.HealthState
+}
+
+// NewRecorder returns a Recorder keeping at most maxTransitions transitions
+// per service in store, or DefaultMaxTransitions if maxTransitions isn't
+// positive.
+func NewRecorder(store Store, maxTransitions int, logger logging.Logger) *Recorder {
+	if maxTransitions <= 0 {
+		maxTransitions = DefaultMaxTransitions
+	}
+	return &Recorder{
+		store:          store,
+		maxTransitions: maxTransitions,
+		logger:         logger,
+		last:           make(map[string]health.HealthState),
+	}
+}
+
+// Record records a transition if the result's health differs from the last
+// recorded health of its service.
+func (r *Recorder) Record(result health.Result, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, ok := r.last[result.Service]
+	if !ok {
+		last, err := r.store.LastTransition(result.Service)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return util.Errorf("Could not read the last health transition of %s: %s", result.Service, err)
+		default:
+			previous = last.Status
+		}
+		r.last[result.Service] = previous
+	}
+	if previous == result.Status {
+		return nil
+	}
+
+	output := checkOutput(result)
+	if len(output) > MaxOutputLength {
+		output = output[:MaxOutputLength]
+	}
+	err := r.store.Insert(Transition{
+		PodID:    result.ID,
+		Service:  result.Service,
+		Previous: previous,
+		Status:   result.Status,
+		Output:   output,
+		Time:     now,
+	})
+	if err != nil {
+		return err
+	}
+	r.last[result.Service] = result.Status
+
+	err = r.store.Prune(result.Service, r.maxTransitions)
+	if err != nil {
+		r.logger.WithError(err).Warningln("Could not prune health transitions")
+	}
+	return nil
+}
+
+// checkOutput describes what a check reported: its error, HTTP status and
+// response body, whichever it has.
+func checkOutput(result health.Result) string {
+	var parts []string
+	if result.Error != "" {
+		parts = append(parts, result.Error)
+	}
+	if result.HTTPStatus != 0 {
+		parts = append(parts, fmt.Sprintf("HTTP %d", result.HTTPStatus))
+	}
+	if result.Output != "" {
+		parts = append(parts, result.Output)
+	}
+	return strings.Join(parts, ": ")
+}
+
+// Transitions returns the recorded transitions of a pod's services at or
+// after since, oldest first.
+func (r *Recorder) Transitions(podID types.PodID, since time.Time) ([]Transition, error) {
+	return r.store.Transitions(podID, since)
+}
+
+// Close closes the underlying store.
+func (r *Recorder) Close() error {
+	return r.store.Close()
+}
+
+// Summary describes the health history of a service over a period.
+type Summary struct {
+	Service string
+	// The health at the end of the period
+	Current health.HealthState
+	// How many times the health changed during the period
+	Flaps int
+	// How long the service spent in each health during the period. Time
+	// before the first transition of the period is not counted.
+	TimeInState map[health.HealthState]time.Duration
+	// What the last check to become critical reported, and when
+	LastCriticalOutput string
+	LastCriticalTime   time.Time
+}
+
+// Summarize summarizes the transitions of each service from the first of
+// them until now. The transitions must be ordered oldest first, as returned by
+// Transitions(). The summaries are ordered by service.
+func Summarize(transitions []Transition, now time.Time) []Summary {
+	byService := make(map[string][]Transition)
+	var services []string
+	for _, transition := range transitions {
+		if _, ok := byService[transition.Service]; !ok {
+			services = append(services, transition.Service)
+		}
+		byService[transition.Service] = append(byService[transition.Service], transition)
+	}
+	sort.Strings(services)
+
+	summaries := make([]Summary, 0, len(services))
+	for _, service := range services {
+		serviceTransitions := byService[service]
+		summary := Summary{
+			Service:     service,
+			TimeInState: make(map[health.HealthState]time.Duration),
+		}
+		for i, transition := range serviceTransitions {
+			end := now
+			if i+1 < len(serviceTransitions) {
+				end = serviceTransitions[i+1].Time
+			}
+			if end.After(transition.Time) {
+				summary.TimeInState[transition.Status] += end.Sub(transition.Time)
+			}
+			if transition.Previous != "" {
+				summary.Flaps++
+			}
+			if transition.Status == health.Critical {
+				summary.LastCriticalOutput = transition.Output
+				summary.LastCriticalTime = transition.Time
+			}
+			summary.Current = transition.Status
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
@@ -0,0 +1,140 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+func initStore(t *testing.T) (Store, string, func()) {
+	tempDir, err := ioutil.TempDir("", "health_history_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+
+	dbPath := filepath.Join(tempDir, "history.db")
+	store := openStore(t, dbPath)
+	return store, dbPath, func() {
+		store.Close()
+		os.RemoveAll(tempDir)
+	}
+}
+
+func openStore(t *testing.T, dbPath string) Store {
+	store, err := NewSQLiteStore(dbPath, logging.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Unable to open health history: %s", err)
+	}
+	err = store.Migrate()
+	if err != nil {
+		store.Close()
+		t.Fatalf("Unexpected error running migration: %s", err)
+	}
+	return store
+}
+
+func result(status health.HealthState, output string) health.Result {
+	return health.Result{ID: "web", Node: "node1", Service: "web", Status: status, Output: output}
+}
+
+func TestRecorderRecordsChanges(t *testing.T) {
+	store, dbPath, cleanup := initStore(t)
+	defer cleanup()
+
+	start := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	recorder := NewRecorder(store, 0, logging.DefaultLogger)
+	for i, status := range []health.HealthState{health.Passing, health.Passing, health.Critical, health.Critical, health.Passing} {
+		err := recorder.Record(result(status, string(status)), start.Add(time.Duration(i)*time.Minute))
+		Assert(t).IsNil(err, "unexpected error recording health")
+	}
+
+	transitions, err := recorder.Transitions("web", time.Time{})
+	Assert(t).IsNil(err, "unexpected error reading transitions")
+	Assert(t).AreEqual(len(transitions), 3, "expected only the changes in health to be recorded")
+	Assert(t).AreEqual(transitions[0].Previous, health.HealthState(""), "the first transition should have no previous health")
+	Assert(t).AreEqual(transitions[1].Previous, health.Passing, "wrong previous health")
+	Assert(t).AreEqual(transitions[1].Status, health.Critical, "wrong health")
+	Assert(t).IsTrue(transitions[1].Time.Equal(start.Add(2*time.Minute)), "wrong time: "+transitions[1].Time.String())
+
+	transitions, err = recorder.Transitions("web", start.Add(3*time.Minute))
+	Assert(t).IsNil(err, "unexpected error reading transitions")
+	Assert(t).AreEqual(len(transitions), 1, "expected only the transitions since the passed time")
+
+	// a restarted preparer shouldn't record the health it last recorded
+	store.Close()
+	store = openStore(t, dbPath)
+	defer store.Close()
+	recorder = NewRecorder(store, 0, logging.DefaultLogger)
+	err = recorder.Record(result(health.Passing, ""), start.Add(time.Hour))
+	Assert(t).IsNil(err, "unexpected error recording health")
+	transitions, err = recorder.Transitions("web", time.Time{})
+	Assert(t).IsNil(err, "unexpected error reading transitions")
+	Assert(t).AreEqual(len(transitions), 3, "an unchanged health shouldn't be recorded after a restart")
+}
+
+func TestRecorderRecordsCheckOutput(t *testing.T) {
+	store, _, cleanup := initStore(t)
+	defer cleanup()
+
+	recorder := NewRecorder(store, 0, logging.DefaultLogger)
+	critical := result(health.Critical, "database unreachable")
+	critical.HTTPStatus = 503
+	err := recorder.Record(critical, time.Now())
+	Assert(t).IsNil(err, "unexpected error recording health")
+
+	transitions, err := recorder.Transitions("web", time.Time{})
+	Assert(t).IsNil(err, "unexpected error reading transitions")
+	Assert(t).AreEqual(len(transitions), 1, "expected a transition")
+	Assert(t).AreEqual(transitions[0].Output, "HTTP 503: database unreachable", "wrong output")
+}
+
+func TestRecorderBoundsHistory(t *testing.T) {
+	store, _, cleanup := initStore(t)
+	defer cleanup()
+
+	start := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	recorder := NewRecorder(store, 2, logging.DefaultLogger)
+	statuses := []health.HealthState{health.Passing, health.Critical, health.Passing, health.Critical}
+	for i, status := range statuses {
+		err := recorder.Record(result(status, strings.Repeat("x", MaxOutputLength+1)), start.Add(time.Duration(i)*time.Minute))
+		Assert(t).IsNil(err, "unexpected error recording health")
+	}
+
+	transitions, err := recorder.Transitions("web", time.Time{})
+	Assert(t).IsNil(err, "unexpected error reading transitions")
+	Assert(t).AreEqual(len(transitions), 2, "expected only the latest transitions to be kept")
+	Assert(t).AreEqual(transitions[1].Status, health.Critical, "expected the latest transition to be kept")
+	Assert(t).AreEqual(len(transitions[1].Output), MaxOutputLength, "expected the output to be truncated")
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	transitions := []Transition{
+		{Service: "web", Status: health.Passing, Time: start},
+		{Service: "db", Status: health.Passing, Time: start},
+		{Service: "web", Previous: health.Passing, Status: health.Critical, Output: "connection refused", Time: start.Add(10 * time.Minute)},
+		{Service: "web", Previous: health.Critical, Status: health.Passing, Time: start.Add(12 * time.Minute)},
+	}
+
+	summaries := Summarize(transitions, start.Add(time.Hour))
+	Assert(t).AreEqual(len(summaries), 2, "expected a summary per service")
+	Assert(t).AreEqual(summaries[0].Service, "db", "summaries should be ordered by service")
+	Assert(t).AreEqual(summaries[0].Flaps, 0, "db never changed health")
+	Assert(t).AreEqual(summaries[0].TimeInState[health.Passing], time.Hour, "db was passing the whole time")
+
+	web := summaries[1]
+	Assert(t).AreEqual(web.Current, health.Passing, "wrong current health")
+	Assert(t).AreEqual(web.Flaps, 2, "wrong number of flaps")
+	Assert(t).AreEqual(web.TimeInState[health.Passing], 58*time.Minute, "wrong time passing")
+	Assert(t).AreEqual(web.TimeInState[health.Critical], 2*time.Minute, "wrong time critical")
+	Assert(t).AreEqual(web.LastCriticalOutput, "connection refused", "wrong critical output")
+	Assert(t).IsTrue(web.LastCriticalTime.Equal(start.Add(10*time.Minute)), "wrong critical time")
+}
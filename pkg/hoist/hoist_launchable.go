@@ -17,6 +17,7 @@ import (
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/p2exec"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/supervisor"
 	"github.com/square/p2/pkg/user"
 	"github.com/square/p2/pkg/util"
 )
@@ -48,6 +49,7 @@ type Launchable struct {
 	RequireFile      string                     // Do not run this launchable until this file exists
 	RestartTimeout   time.Duration              // How long to wait when restarting the services in this launchable.
 	RestartPolicy_   runit.RestartPolicy        // Dictates whether the launchable should be automatically restarted upon exit.
+	RestartBackoff_  *runit.Backoff             // If set, delays and limits restarts after failures.
 	SuppliedEnvVars  map[string]string          // A map of user-supplied environment variables to be exported for this launchable
 	Location         *url.URL                   // URL to download the artifact from
 	VerificationData auth.VerificationData      // Paths to files used to verify the artifact
@@ -108,8 +110,8 @@ func (hl *Launchable) Disable() error {
 	return nil
 }
 
-func (hl *Launchable) Stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
-	stopErr := hl.stop(serviceBuilder, sv)
+func (hl *Launchable) Stop(supervisor supervisor.Supervisor) error {
+	stopErr := hl.stop(supervisor)
 	// We still want to update the "last" symlink even if there was an
 	// error during stop()
 	makeLastErr := hl.makeLast()
@@ -124,8 +126,8 @@ func (hl *Launchable) Stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) er
 	return nil
 }
 
-func (hl *Launchable) Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
-	startErr := hl.start(serviceBuilder, sv)
+func (hl *Launchable) Launch(supervisor supervisor.Supervisor) error {
+	startErr := hl.start(supervisor)
 	if startErr != nil && !IsMissingEntryPoints(startErr) {
 		return launch.StartError{Inner: startErr}
 	}
@@ -162,6 +164,22 @@ func (hl *Launchable) PostActivate() (string, error) {
 	return output, nil
 }
 
+// CanReload returns whether the launchable provides a bin/reload script.
+func (hl *Launchable) CanReload() bool {
+	_, err := os.Stat(filepath.Join(hl.InstallDir(), "bin", "reload"))
+	return err == nil
+}
+
+// Reload runs the launchable's bin/reload script, which asks its processes to
+// reload the pod's config.
+func (hl *Launchable) Reload() (string, error) {
+	output, err := hl.InvokeBinScript("reload")
+	if err != nil {
+		return output, util.Errorf("Could not reload %s: %s", hl.ServiceId, err)
+	}
+	return output, nil
+}
+
 func (hl *Launchable) disable() (string, error) {
 	output, err := hl.InvokeBinScript("disable")
 
@@ -222,14 +240,14 @@ func (hl *Launchable) InvokeBinScript(script string) (string, error) {
 	return buffer.String(), nil
 }
 
-func (hl *Launchable) stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
-	executables, err := hl.Executables(serviceBuilder)
+func (hl *Launchable) stop(supervisor supervisor.Supervisor) error {
+	executables, err := hl.Executables(supervisor)
 	if err != nil {
 		return err
 	}
 
 	for _, executable := range executables {
-		_, err := sv.Stop(&executable.Service, hl.RestartTimeout)
+		_, err := supervisor.Stop(&executable.Service, hl.RestartTimeout)
 		if err != nil && err != runit.Killed {
 			// TODO: FAILURE SCENARIO (what should we do here?)
 			// 1) does `sv stop` ever exit nonzero?
@@ -240,26 +258,26 @@ func (hl *Launchable) stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) er
 	return nil
 }
 
-// Start will take a launchable and start every runit service associated with the launchable.
+// Start will take a launchable and start every service associated with the launchable.
 // All services will attempt to be started.
-func (hl *Launchable) start(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
-	executables, err := hl.Executables(serviceBuilder)
+func (hl *Launchable) start(supervisor supervisor.Supervisor) error {
+	executables, err := hl.Executables(supervisor)
 	if err != nil {
 		return err
 	}
 
 	for _, executable := range executables {
 		var err error
-		if hl.RestartPolicy_ == runit.RestartPolicyAlways {
-			_, err = sv.Restart(&executable.Service, hl.RestartTimeout)
+		if hl.RestartPolicy_.Restarts() {
+			_, err = supervisor.Restart(&executable.Service, hl.RestartTimeout)
 		} else {
-			_, err = sv.Once(&executable.Service)
+			_, err = supervisor.Once(&executable.Service)
 		}
 		if err != nil && err != runit.SuperviseOkMissing && err != runit.Killed {
 			return err
 		}
 
-		if _, err = sv.Restart(&executable.LogAgent, runit.DefaultTimeout); err != nil && err != runit.Killed {
+		if _, err = supervisor.Restart(&executable.LogAgent, runit.DefaultTimeout); err != nil && err != runit.Killed {
 			return err
 		}
 
@@ -295,7 +313,7 @@ func IsMissingEntryPoints(err error) bool {
 // slashes exchanged for double underscores):
 // /var/service/some-pod-<uuid>__some-launchable__bin__launch/
 func (hl *Launchable) Executables(
-	serviceBuilder *runit.ServiceBuilder,
+	supervisor supervisor.Supervisor,
 ) ([]launch.Executable, error) {
 	if !hl.Installed() {
 		return []launch.Executable{}, util.Errorf("%s is not installed", hl.ServiceId)
@@ -377,15 +395,9 @@ func (hl *Launchable) Executables(
 			executableMap[serviceName] = launch.Executable{
 				ServiceName:  entryPointName,
 				RelativePath: relativePath,
-				Service: runit.Service{
-					Path: filepath.Join(serviceBuilder.RunitRoot, serviceName),
-					Name: serviceName,
-				},
-				LogAgent: runit.Service{
-					Path: filepath.Join(serviceBuilder.RunitRoot, serviceName, "log"),
-					Name: serviceName + " logAgent",
-				},
-				Exec: execCmd,
+				Service:      supervisor.Service(serviceName),
+				LogAgent:     supervisor.LogAgent(serviceName),
+				Exec:         execCmd,
 			}
 		}
 	}
@@ -500,6 +512,10 @@ func (hl *Launchable) RestartPolicy() runit.RestartPolicy {
 	return hl.RestartPolicy_
 }
 
+func (hl *Launchable) RestartBackoff() *runit.Backoff {
+	return hl.RestartBackoff_
+}
+
 func (hl *Launchable) GetRestartTimeout() time.Duration {
 	return hl.RestartTimeout
 }
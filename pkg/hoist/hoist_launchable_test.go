@@ -8,6 +8,7 @@ import (
 
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/supervisor"
 	"gopkg.in/yaml.v2"
 
 	. "github.com/anthonybishopric/gotcha"
@@ -55,7 +56,7 @@ func TestInstallDirNoVersion(t *testing.T) {
 func TestMultipleExecutablesLegacy(t *testing.T) {
 	fakeLaunchable, sb := FakeHoistLaunchableForDirLegacyPod("multiple_script_test_hoist_launchable")
 	defer CleanupFakeLaunchable(fakeLaunchable, sb)
-	executables, err := fakeLaunchable.Executables(runit.DefaultBuilder)
+	executables, err := fakeLaunchable.Executables(supervisor.DefaultRunit)
 
 	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
 
@@ -68,7 +69,7 @@ func TestMultipleExecutablesLegacy(t *testing.T) {
 func TestMultipleExecutablesUUIDPod(t *testing.T) {
 	fakeLaunchable, sb := FakeHoistLaunchableForDirUUIDPod("multiple_script_test_hoist_launchable")
 	defer CleanupFakeLaunchable(fakeLaunchable, sb)
-	executables, err := fakeLaunchable.Executables(runit.DefaultBuilder)
+	executables, err := fakeLaunchable.Executables(supervisor.DefaultRunit)
 
 	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
 
@@ -85,7 +86,7 @@ func TestMultipleEntryPointsLegacy(t *testing.T) {
 	defer CleanupFakeLaunchable(fakeLaunchable, sb)
 
 	fakeLaunchable.EntryPoints.Paths = append(fakeLaunchable.EntryPoints.Paths, "bin/start")
-	executables, err := fakeLaunchable.Executables(runit.DefaultBuilder)
+	executables, err := fakeLaunchable.Executables(supervisor.DefaultRunit)
 
 	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
 
@@ -106,7 +107,7 @@ func TestMultipleEntryPointsUUIDPod(t *testing.T) {
 	defer CleanupFakeLaunchable(fakeLaunchable, sb)
 
 	fakeLaunchable.EntryPoints.Paths = append(fakeLaunchable.EntryPoints.Paths, "bin/start")
-	executables, err := fakeLaunchable.Executables(runit.DefaultBuilder)
+	executables, err := fakeLaunchable.Executables(supervisor.DefaultRunit)
 
 	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
 
@@ -126,7 +127,7 @@ func TestNonStandardEntryPointLegacy(t *testing.T) {
 	defer CleanupFakeLaunchable(fakeLaunchable, sb)
 
 	fakeLaunchable.EntryPoints.Paths = []string{"bin/start"}
-	executables, err := fakeLaunchable.Executables(runit.DefaultBuilder)
+	executables, err := fakeLaunchable.Executables(supervisor.DefaultRunit)
 
 	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
 
@@ -144,7 +145,7 @@ func TestNonStandardEntryPointUUIDPod(t *testing.T) {
 	defer CleanupFakeLaunchable(fakeLaunchable, sb)
 
 	fakeLaunchable.EntryPoints.Paths = []string{"bin/start"}
-	executables, err := fakeLaunchable.Executables(runit.DefaultBuilder)
+	executables, err := fakeLaunchable.Executables(supervisor.DefaultRunit)
 
 	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
 
@@ -162,7 +163,7 @@ func TestMissingExplicitEntryPointError(t *testing.T) {
 
 	fakeLaunchable.EntryPoints.Paths = []string{"bin/missing"}
 	fakeLaunchable.EntryPoints.Implicit = false
-	_, err := fakeLaunchable.Executables(runit.DefaultBuilder)
+	_, err := fakeLaunchable.Executables(supervisor.DefaultRunit)
 	Assert(t).IsNotNil(err, "expected an error if an explicitly enumerated entry point is missing")
 }
 
@@ -172,7 +173,7 @@ func TestErrorIfConflictingServiceNames(t *testing.T) {
 	defer CleanupFakeLaunchable(fakeLaunchable, sb)
 
 	fakeLaunchable.EntryPoints.Paths = []string{"bin/start", "bin/start2"}
-	executables, err := fakeLaunchable.Executables(runit.DefaultBuilder)
+	executables, err := fakeLaunchable.Executables(supervisor.DefaultRunit)
 
 	Assert(t).IsNotNil(err, "Expected naming collision error calling Executables()")
 	Assert(t).AreEqual(0, len(executables), "Found an unexpected number of runit services")
@@ -182,7 +183,7 @@ func TestSingleRunitServiceLegacy(t *testing.T) {
 	launchable, sb := FakeHoistLaunchableForDirLegacyPod("single_script_test_hoist_launchable")
 	defer CleanupFakeLaunchable(launchable, sb)
 	Assert(t).IsNil(launchable.MakeCurrent(), "Should have been made current")
-	executables, err := launchable.Executables(runit.DefaultBuilder)
+	executables, err := launchable.Executables(supervisor.DefaultRunit)
 	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
 
 	expectedServicePaths := []string{"/var/service/testPod__testLaunchable__script1"}
@@ -194,7 +195,7 @@ func TestSingleRunitServiceUUIDPod(t *testing.T) {
 	launchable, sb := FakeHoistLaunchableForDirUUIDPod("single_script_test_hoist_launchable")
 	defer CleanupFakeLaunchable(launchable, sb)
 	Assert(t).IsNil(launchable.MakeCurrent(), "Should have been made current")
-	executables, err := launchable.Executables(runit.DefaultBuilder)
+	executables, err := launchable.Executables(supervisor.DefaultRunit)
 	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
 
 	expectedServicePaths := []string{"/var/service/testPod__testLaunchable__bin__launch__script1"}
@@ -206,7 +207,7 @@ func TestLaunchExecutableOnlyRunitServiceLegacy(t *testing.T) {
 	launchable, sb := FakeHoistLaunchableForDirLegacyPod("launch_script_only_test_hoist_launchable")
 	defer CleanupFakeLaunchable(launchable, sb)
 	Assert(t).IsNil(launchable.MakeCurrent(), "Should have been made current")
-	executables, err := launchable.Executables(runit.DefaultBuilder)
+	executables, err := launchable.Executables(supervisor.DefaultRunit)
 	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
 
 	expectedServicePaths := []string{"/var/service/testPod__testLaunchable__launch"}
@@ -218,7 +219,7 @@ func TestLaunchExecutableOnlyRunitServiceUUIDPod(t *testing.T) {
 	launchable, sb := FakeHoistLaunchableForDirUUIDPod("launch_script_only_test_hoist_launchable")
 	defer CleanupFakeLaunchable(launchable, sb)
 	Assert(t).IsNil(launchable.MakeCurrent(), "Should have been made current")
-	executables, err := launchable.Executables(runit.DefaultBuilder)
+	executables, err := launchable.Executables(supervisor.DefaultRunit)
 	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
 
 	expectedServicePaths := []string{"/var/service/testPod__testLaunchable__bin__launch"}
@@ -325,7 +326,7 @@ func TestFailingStop(t *testing.T) {
 
 	sv := runit.ErringSV()
 
-	err := hl.stop(sb, sv)
+	err := hl.stop(supervisor.NewRunit(sb, sv))
 
 	Assert(t).IsNotNil(err, "Expected sv stop to fail for this test, but it didn't")
 }
@@ -335,7 +336,7 @@ func TestStart(t *testing.T) {
 	hl, sb := FakeHoistLaunchableForDirLegacyPod("multiple_script_test_hoist_launchable")
 	defer CleanupFakeLaunchable(hl, sb)
 	sv := runit.FakeSV()
-	executables, err := hl.Executables(sb)
+	executables, err := hl.Executables(supervisor.NewRunit(sb, sv))
 	outFilePath := path.Join(sb.ConfigRoot, "testPod__testLaunchable.yaml")
 
 	sbContentsMap := map[string]interface{}{
@@ -352,7 +353,7 @@ func TestStart(t *testing.T) {
 	defer f.Close()
 	f.Write(sbContents)
 
-	err = hl.start(sb, sv)
+	err = hl.start(supervisor.NewRunit(sb, sv))
 
 	Assert(t).IsNil(err, "Got an unexpected error when attempting to start runit services")
 
@@ -364,7 +365,7 @@ func TestFailingStart(t *testing.T) {
 	defer CleanupFakeLaunchable(hl, sb)
 
 	sv := runit.ErringSV()
-	executables, _ := hl.Executables(sb)
+	executables, _ := hl.Executables(supervisor.NewRunit(sb, sv))
 	outFilePath := path.Join(sb.ConfigRoot, "testPod__testLaunchable.yaml")
 
 	sbContentsMap := map[string]interface{}{
@@ -381,7 +382,7 @@ func TestFailingStart(t *testing.T) {
 	defer f.Close()
 	f.Write(sbContents)
 
-	err = hl.start(sb, sv)
+	err = hl.start(supervisor.NewRunit(sb, sv))
 	Assert(t).IsNotNil(err, "Expected an error starting runit services")
 }
 
@@ -391,7 +392,7 @@ func TestStop(t *testing.T) {
 	defer CleanupFakeLaunchable(hl, sb)
 
 	sv := runit.FakeSV()
-	err := hl.stop(sb, sv)
+	err := hl.stop(supervisor.NewRunit(sb, sv))
 
 	Assert(t).IsNil(err, "Got an unexpected error when attempting to stop runit services")
 }
@@ -430,7 +431,7 @@ func TestLaunchWithFailingEnable(t *testing.T) {
 	defer CleanupFakeLaunchable(hl, sb)
 
 	sv := runit.FakeSV()
-	err := hl.Launch(sb, sv)
+	err := hl.Launch(supervisor.NewRunit(sb, sv))
 	Assert(t).IsNotNil(err, "Expected error while launching")
 	_, ok := err.(launch.EnableError)
 	Assert(t).IsTrue(ok, fmt.Sprintf("Expected enable error to be returned, was %s", err))
@@ -444,7 +445,7 @@ func TestLaunchWithPassingEnable(t *testing.T) {
 	defer CleanupFakeLaunchable(hl, sb)
 
 	sv := runit.FakeSV()
-	err := hl.Launch(sb, sv)
+	err := hl.Launch(supervisor.NewRunit(sb, sv))
 	Assert(t).IsNil(err, "Expected launch to succeed")
 }
 
@@ -454,7 +455,7 @@ func TestStopWithFailure(t *testing.T) {
 	defer CleanupFakeLaunchable(hl, sb)
 
 	sv := runit.ErringSV()
-	err := hl.Stop(sb, sv)
+	err := hl.Stop(supervisor.NewRunit(sb, sv))
 	Assert(t).IsNotNil(err, "Expected error while halting")
 	_, ok := err.(launch.StopError)
 	Assert(t).IsTrue(ok, "Expected stop error to be returned")
@@ -466,7 +467,7 @@ func TestLaunchWithFailingStart(t *testing.T) {
 	defer CleanupFakeLaunchable(hl, sb)
 
 	sv := runit.ErringSV()
-	err := hl.Launch(sb, sv)
+	err := hl.Launch(supervisor.NewRunit(sb, sv))
 	Assert(t).IsNotNil(err, "Expected error while launching")
 	_, ok := err.(launch.StartError)
 	Assert(t).IsTrue(ok, "Expected start error to be returned")
@@ -484,7 +485,7 @@ func TestOnceIfRestartNever(t *testing.T) {
 	hl.RestartPolicy_ = runit.RestartPolicyNever
 
 	sv := runit.NewRecordingSV()
-	err := hl.Launch(sb, sv)
+	err := hl.Launch(supervisor.NewRunit(sb, sv))
 	Assert(t).IsNil(err, "Unexpected error when launching")
 	commands := sv.(*runit.RecordingSV).Commands
 	Assert(t).AreEqual(len(commands), 2, "expected 2 commands to be issued")
@@ -502,7 +503,7 @@ func TestRestartIfRestartAlways(t *testing.T) {
 	hl.RestartPolicy_ = runit.RestartPolicyAlways
 
 	sv := runit.NewRecordingSV()
-	err := hl.Launch(sb, sv)
+	err := hl.Launch(supervisor.NewRunit(sb, sv))
 	Assert(t).IsNil(err, "Unexpected error when launching")
 	Assert(t).AreEqual(sv.(*runit.RecordingSV).LastCommand(), "restart", "Expected 'restart' command to be used for a launchable with RestartPolicyAlways")
 }
@@ -514,7 +515,7 @@ func TestRestartServiceAndLogAgent(t *testing.T) {
 	sv := runit.NewRecordingSV()
 
 	hl.RestartPolicy_ = runit.RestartPolicyAlways
-	hl.start(sb, sv)
+	hl.start(supervisor.NewRunit(sb, sv))
 
 	commands := sv.(*runit.RecordingSV).Commands
 	Assert(t).AreEqual(len(commands), 2, "Expected 2 restart commands to be issued")
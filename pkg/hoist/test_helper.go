@@ -7,6 +7,7 @@ import (
 	"runtime"
 
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/supervisor"
 	"github.com/square/p2/pkg/util"
 )
 
@@ -47,7 +48,7 @@ func fakeHoistLaunchableForDir(dirName string, isUUIDPod bool) (*Launchable, *ru
 		RunitRoot: sbTemp,
 	}
 
-	executables, _ := launchable.Executables(sb)
+	executables, _ := launchable.Executables(supervisor.NewRunit(sb, runit.DefaultSV))
 	for _, exe := range executables {
 		_ = os.MkdirAll(exe.Service.Path, 0644)
 	}
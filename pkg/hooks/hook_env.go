@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/square/p2/pkg/config"
+	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/types"
@@ -28,6 +29,36 @@ func (h *HookEnv) Manifest() (manifest.Manifest, error) {
 	return manifest.FromPath(path)
 }
 
+// PreviousManifest returns the manifest the pod ran with before an
+// after_manifest_update event
+func (h *HookEnv) PreviousManifest() (manifest.Manifest, error) {
+	path := os.Getenv(HookedPreviousPodManifestEnvVar)
+	if path == "" {
+		return nil, util.Errorf("No previous manifest exported")
+	}
+	return manifest.FromPath(path)
+}
+
+// HealthState returns the health the pod changed to in an on_health_change
+// event
+func (h *HookEnv) HealthState() (health.HealthState, error) {
+	state := os.Getenv(HookedHealthStateEnvVar)
+	if state == "" {
+		return "", util.Errorf("No health state exported")
+	}
+	return health.ToHealthState(state), nil
+}
+
+// PreviousHealthState returns the health the pod changed from in an
+// on_health_change event
+func (h *HookEnv) PreviousHealthState() (health.HealthState, error) {
+	state := os.Getenv(HookedPreviousHealthStateEnvVar)
+	if state == "" {
+		return "", util.Errorf("No previous health state exported")
+	}
+	return health.ToHealthState(state), nil
+}
+
 func (h *HookEnv) PodID() (types.PodID, error) {
 	id := os.Getenv(HookedPodIDEnvVar)
 	if id == "" {
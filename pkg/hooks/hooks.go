@@ -7,104 +7,263 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
 )
 
-func NewContext(dirpath string, podRoot string, logger *logging.Logger, auditLogger AuditLogger) *hookContext {
+func NewContext(dirpath string, podRoot string, logger *logging.Logger, auditLogger AuditLogger, podLabeler PodLabeler) *hookContext {
 	return &hookContext{
 		dirpath:     dirpath,
 		podRoot:     podRoot,
 		logger:      logger,
 		auditLogger: auditLogger,
+		podLabeler:  podLabeler,
 	}
 }
 
-// runDirectory executes all executable files in a given directory path.
-func (h *hookContext) runDirectory(hookEnv *HookExecutionEnvironment) error {
+// runDirectory executes the hooks in a given directory path that apply to the
+// hook type. Executable files directly in the directory predate hook pod
+// directories and run for every hook type with the default spec. Every
+// subdirectory holds the scripts of one hook pod along with their specs.
+func (h *hookContext) runDirectory(hookEnv *HookExecutionEnvironment, hookType HookType, podLabels func() (klabels.Set, error)) ([]Result, error) {
 	entries, err := ioutil.ReadDir(h.dirpath)
 	if os.IsNotExist(err) {
 		h.logger.WithField("dir", h.dirpath).Debugln("Hooks not set up")
-		return nil
+		return nil, nil
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var results []Result
 	for _, f := range entries {
-		fullpath := path.Join(h.dirpath, f.Name())
-		hec := NewHookExecContext(fullpath, f.Name(), DefaultTimeout, *hookEnv, h.logger)
-		executable := (f.Mode() & 0111) != 0
-		if !executable {
-			h.auditLogger.LogFailure(hec, nil)
-			h.logger.WithField("path", fullpath).Warnln("Hook is not executable")
+		// hidden directories hold hook pods that are being installed
+		if strings.HasPrefix(f.Name(), ".") {
 			continue
 		}
+		fullpath := path.Join(h.dirpath, f.Name())
 		if f.IsDir() {
+			results = append(results, h.runHookPodDirectory(fullpath, hookEnv, hookType, podLabels)...)
 			continue
 		}
+		if result, ran := h.runHook(fullpath, f, HookSpec{}, hookEnv, hookType, podLabels); ran {
+			results = append(results, result)
+		}
+	}
+	return results, failureError(results)
+}
 
-		err := hec.RunWithTimeout()
-		if htErr, ok := err.(ErrHookTimeout); ok {
-			h.auditLogger.LogFailure(hec, err)
-			h.logger.WithErrorAndFields(htErr, logrus.Fields{
-				"path":      hec.Path,
-				"hook_name": hec.Name,
-				"timeout":   hec.Timeout,
-			}).Warnln(htErr.Error())
-			// we intentionally swallow timeout HookTimeoutErrors
+// runHookPodDirectory runs the scripts InstallHookScripts wrote for one hook
+// pod according to their specs
+func (h *hookContext) runHookPodDirectory(dir string, hookEnv *HookExecutionEnvironment, hookType HookType, podLabels func() (klabels.Set, error)) []Result {
+	specs := make(map[string]HookSpec)
+	specBytes, err := ioutil.ReadFile(path.Join(dir, hookSpecsFile))
+	if err == nil {
+		err = yaml.Unmarshal(specBytes, &specs)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		h.logger.WithErrorAndFields(err, logrus.Fields{
+			"dir": dir,
+		}).Errorln("Could not read hook specs, running the hooks with the default spec")
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		h.logger.WithErrorAndFields(err, logrus.Fields{
+			"dir": dir,
+		}).Errorln("Could not read hook pod directory")
+		return nil
+	}
+
+	var results []Result
+	for _, f := range entries {
+		if f.IsDir() || f.Name() == hookSpecsFile {
 			continue
-		} else if err != nil {
+		}
+		if result, ran := h.runHook(path.Join(dir, f.Name()), f, specs[f.Name()], hookEnv, hookType, podLabels); ran {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// runHook runs a single hook if its spec applies to the hook type and pod.
+// It returns false if the hook didn't run
+func (h *hookContext) runHook(fullpath string, f os.FileInfo, spec HookSpec, hookEnv *HookExecutionEnvironment, hookType HookType, podLabels func() (klabels.Set, error)) (Result, bool) {
+	if !spec.runsFor(hookType) {
+		return Result{}, false
+	}
+	hec := NewHookExecContext(fullpath, f.Name(), spec.timeout(), *hookEnv, h.logger)
+	result := Result{
+		Name:          f.Name(),
+		Event:         hookType,
+		FailurePolicy: spec.failurePolicy(),
+		Start:         time.Now(),
+	}
+
+	if spec.PodSelector != "" {
+		selector, err := klabels.Parse(spec.PodSelector)
+		var labelSet klabels.Set
+		if err == nil {
+			labelSet, err = podLabels()
+		}
+		if err != nil {
+			// a hook that can't be matched against the pod counts as
+			// failed, so that its failure policy still applies
 			h.auditLogger.LogFailure(hec, err)
 			h.logger.WithErrorAndFields(err, logrus.Fields{
 				"path":      hec.Path,
 				"hook_name": hec.Name,
-			}).Warningf("Unknown error in hook %s: %s", hec.Name, err)
-			continue
+			}).Warnln("Could not match hook pod selector")
+			result.Err = err
+			return result, true
+		}
+		if !selector.Matches(labelSet) {
+			return Result{}, false
 		}
+	}
+
+	executable := (f.Mode() & 0111) != 0
+	if !executable {
+		h.auditLogger.LogFailure(hec, nil)
+		h.logger.WithField("path", fullpath).Warnln("Hook is not executable")
+		return Result{}, false
+	}
+
+	err := hec.RunWithTimeout()
+	result.Duration = time.Since(result.Start)
+	result.Err = err
+	if htErr, ok := err.(ErrHookTimeout); ok {
+		h.auditLogger.LogFailure(hec, err)
+		h.logger.WithErrorAndFields(htErr, logrus.Fields{
+			"path":           hec.Path,
+			"hook_name":      hec.Name,
+			"timeout":        hec.Timeout,
+			"failure_policy": result.FailurePolicy,
+		}).Warnln(htErr.Error())
+	} else if err != nil {
+		h.auditLogger.LogFailure(hec, err)
+		h.logger.WithErrorAndFields(err, logrus.Fields{
+			"path":           hec.Path,
+			"hook_name":      hec.Name,
+			"failure_policy": result.FailurePolicy,
+		}).Warningf("Unknown error in hook %s: %s", hec.Name, err)
+	} else {
 		h.auditLogger.LogSuccess(hec)
 	}
-	return nil
+	return result, true
+}
+
+// podLabels returns a function returning the labels that hook pod selectors
+// are matched against: the pod's labels and its ID as the "pod_id" label.
+// They are looked up at most once, when a hook with a selector first needs
+// them.
+func (h *hookContext) podLabels(pod Pod, podID types.PodID) func() (klabels.Set, error) {
+	var labelSet klabels.Set
+	var err error
+	lookedUp := false
+	return func() (klabels.Set, error) {
+		if lookedUp {
+			return labelSet, err
+		}
+		lookedUp = true
+
+		labelSet = klabels.Set{}
+		if h.podLabeler != nil {
+			labelKey := pod.UniqueKey().String()
+			if labelKey == "" {
+				labelKey = labels.MakePodLabelKey(pod.Node(), podID)
+			}
+			var labeled labels.Labeled
+			labeled, err = h.podLabeler.GetLabels(labels.POD, labelKey)
+			if err != nil {
+				err = util.Errorf("could not look up labels of pod %s: %s", labelKey, err)
+				return labelSet, err
+			}
+			for key, value := range labeled.Labels {
+				labelSet[key] = value
+			}
+		}
+		labelSet[types.PodIDLabel] = podID.String()
+		return labelSet, nil
+	}
 }
 
 func (h *hookContext) Close() error {
 	return h.auditLogger.Close()
 }
 
-// RunWithTimeout runs the hook but returns a HookTimeoutError when it exceeds its timeout
+// RunWithTimeout runs the hook but returns a HookTimeoutError when it exceeds its timeout.
+// The hook is then sent SIGTERM, and SIGKILL if it hasn't exited by the end of
+// the grace period, without waiting for it to exit.
 //
 // Necessary because Run() hangs if the command double-forks without properly
 // re-opening its fd's and exec.Start() will dutifully wait on any unclosed fd
 //
 // NB: in the event of a timeout this will leak descriptors
 func (h *HookExecContext) RunWithTimeout() error {
-	finished := make(chan struct{})
+	cmd, hookOut := h.command()
+	err := cmd.Start()
+	if err != nil {
+		h.logResult(err, hookOut)
+		return err
+	}
+
+	finished := make(chan error, 1)
 	go func() {
-		h.Run()
-		close(finished)
+		finished <- cmd.Wait()
 	}()
 
 	select {
-	case <-finished:
+	case err := <-finished:
+		h.logResult(err, hookOut)
+		return err
 	case <-time.After(h.Timeout):
-		return ErrHookTimeout{*h}
 	}
 
-	return nil
+	_ = cmd.Process.Signal(syscall.SIGTERM)
+	go func() {
+		select {
+		case <-finished:
+		case <-time.After(killGracePeriod):
+			h.logger.WithField("path", h.Path).Warnf("Hook %s did not exit after SIGTERM, sending SIGKILL", h.Name)
+			_ = cmd.Process.Kill()
+		}
+	}()
+	return ErrHookTimeout{*h}
 }
 
-// Run executes the hook in the context of its environment and logs the output
-func (h *HookExecContext) Run() {
+// Run executes the hook in the context of its environment and logs the output.
+// It returns an error if the hook couldn't be started or exited unsuccessfully
+func (h *HookExecContext) Run() error {
+	cmd, hookOut := h.command()
+	err := cmd.Run()
+	h.logResult(err, hookOut)
+	return err
+}
+
+func (h *HookExecContext) command() (*exec.Cmd, *bytes.Buffer) {
 	h.logger.WithField("path", h.Path).Infof("Executing hook %s", h.Name)
 	cmd := exec.Command(h.Path)
 	hookOut := &bytes.Buffer{}
 	cmd.Stdout = hookOut
 	cmd.Stderr = hookOut
 	cmd.Env = h.env.Env()
-	err := cmd.Run()
+	return cmd, hookOut
+}
+
+func (h *HookExecContext) logResult(err error, hookOut *bytes.Buffer) {
 	if err != nil {
 		h.logger.WithErrorAndFields(err, logrus.Fields{
 			"path":   h.Path,
@@ -118,52 +277,85 @@ func (h *HookExecContext) Run() {
 	}
 }
 
-func (h *hookContext) runHooks(dirpath string, hType HookType, pod Pod, podManifest manifest.Manifest, logger logging.Logger) error {
+func (h *hookContext) runHooks(dirpath string, hType HookType, pod Pod, podManifest manifest.Manifest, details EventDetails, logger logging.Logger) ([]Result, error) {
 	configFileName, err := podManifest.ConfigFileName()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Write manifest to a file so hooks can read it.
-	tmpManifestFile, err := ioutil.TempFile("", fmt.Sprintf("%s-manifest.yaml", podManifest.ID()))
+	tmpManifestFile, err := writeTempManifest(podManifest)
 	if err != nil {
 		logger.WithErrorAndFields(err, logrus.Fields{
 			"dir": dirpath,
-		}).Warnln("Unable to open manifest file for hooks")
-		return err
+		}).Warnln("Unable to write manifest file for hooks")
+		return nil, err
 	}
-	defer os.Remove(tmpManifestFile.Name())
+	defer os.Remove(tmpManifestFile)
 
-	err = podManifest.Write(tmpManifestFile)
-	if err != nil {
-		logger.WithErrorAndFields(err, logrus.Fields{
-			"dir": dirpath,
-		}).Warnln("Unable to write manifest file for hooks")
-		return err
+	previousManifestFile := ""
+	if details.PreviousManifest != nil {
+		previousManifestFile, err = writeTempManifest(details.PreviousManifest)
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{
+				"dir": dirpath,
+			}).Warnln("Unable to write previous manifest file for hooks")
+			return nil, err
+		}
+		defer os.Remove(previousManifestFile)
 	}
 
 	hec := &HookExecutionEnvironment{
-		HookEnvVar:                path.Base(dirpath),
-		HookEventEnvVar:           hType.String(),
-		HookedNodeEnvVar:          pod.Node().String(),
-		HookedPodIDEnvVar:         podManifest.ID().String(),
-		HookedPodHomeEnvVar:       pod.Home(),
-		HookedPodManifestEnvVar:   tmpManifestFile.Name(),
-		HookedConfigPathEnvVar:    path.Join(pod.ConfigDir(), configFileName),
-		HookedEnvPathEnvVar:       pod.EnvDir(),
-		HookedConfigDirPathEnvVar: pod.ConfigDir(),
-		HookedSystemPodRootEnvVar: h.podRoot,
-		HookedPodUniqueKeyEnvVar:  pod.UniqueKey().String(),
-	}
-	return h.runDirectory(hec)
+		HookEnvVar:                      path.Base(dirpath),
+		HookEventEnvVar:                 hType.String(),
+		HookedNodeEnvVar:                pod.Node().String(),
+		HookedPodIDEnvVar:               podManifest.ID().String(),
+		HookedPodHomeEnvVar:             pod.Home(),
+		HookedPodManifestEnvVar:         tmpManifestFile,
+		HookedConfigPathEnvVar:          path.Join(pod.ConfigDir(), configFileName),
+		HookedEnvPathEnvVar:             pod.EnvDir(),
+		HookedConfigDirPathEnvVar:       pod.ConfigDir(),
+		HookedSystemPodRootEnvVar:       h.podRoot,
+		HookedPodUniqueKeyEnvVar:        pod.UniqueKey().String(),
+		HookedPreviousPodManifestEnvVar: previousManifestFile,
+		HookedHealthStateEnvVar:         string(details.HealthState),
+		HookedPreviousHealthStateEnvVar: string(details.PreviousHealthState),
+	}
+	return h.runDirectory(hec, hType, h.podLabels(pod, podManifest.ID()))
+}
+
+// writeTempManifest writes the manifest to a temporary file and returns its
+// path. The caller removes the file
+func writeTempManifest(podManifest manifest.Manifest) (string, error) {
+	file, err := ioutil.TempFile("", fmt.Sprintf("%s-manifest.yaml", podManifest.ID()))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	err = podManifest.Write(file)
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// RunHookType runs the hooks that apply to the hook type and pod and returns
+// their results. If hooks whose failure policy isn't IgnoreFailure failed,
+// the error is a FailureError.
+func (h *hookContext) RunHookType(hookType HookType, pod Pod, manifest manifest.Manifest) ([]Result, error) {
+	return h.RunHookTypeWithDetails(hookType, pod, manifest, EventDetails{})
 }
 
-func (h *hookContext) RunHookType(hookType HookType, pod Pod, manifest manifest.Manifest) error {
+// RunHookTypeWithDetails is RunHookType for events that expose what changed
+// to the hooks, such as AfterManifestUpdate and OnHealthChange
+func (h *hookContext) RunHookTypeWithDetails(hookType HookType, pod Pod, manifest manifest.Manifest, details EventDetails) ([]Result, error) {
 	logger := h.logger.SubLogger(logrus.Fields{
 		"pod":      manifest.ID(),
 		"pod_path": pod.Home(),
 		"event":    hookType.String(),
 	})
 	logger.NoFields().Infof("Running %s hooks", hookType.String())
-	return h.runHooks(h.dirpath, hookType, pod, manifest, logger)
+	return h.runHooks(h.dirpath, hookType, pod, manifest, details, logger)
 }
@@ -5,12 +5,14 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"bytes"
 
 	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
@@ -32,10 +34,10 @@ func TestExecutableHooksAreRun(t *testing.T) {
 	// So PodFromPodHome doesn't bail out, write a minimal current_manifest.yaml
 	ioutil.WriteFile(path.Join(podDir, "current_manifest.yaml"), []byte("id: my_hook"), 0755)
 
-	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&logging.DefaultLogger))
+	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&logging.DefaultLogger), nil)
 	pod, err := pods.PodFromPodHome("testNode", podDir)
 	Assert(t).IsNil(err, "the error should have been nil")
-	hooks.runHooks(tempDir, AfterInstall, pod, testManifest(), logging.DefaultLogger)
+	hooks.runHooks(tempDir, AfterInstall, pod, testManifest(), EventDetails{}, logging.DefaultLogger)
 
 	contents, err := ioutil.ReadFile(path.Join(tempDir, "output"))
 	Assert(t).IsNil(err, "the error should have been nil")
@@ -58,10 +60,10 @@ func TestNonExecutableHooksAreNotRun(t *testing.T) {
 	// So PodFromPodHome doesn't bail out, write a minimal current_manifest.yaml
 	ioutil.WriteFile(path.Join(podDir, "current_manifest.yaml"), []byte("id: my_hook"), 0755)
 
-	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&logging.DefaultLogger))
+	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&logging.DefaultLogger), nil)
 	pod, err := pods.PodFromPodHome("testNode", podDir)
 	Assert(t).IsNil(err, "the error should have been nil")
-	hooks.runHooks(tempDir, AfterInstall, pod, testManifest(), logging.DefaultLogger)
+	hooks.runHooks(tempDir, AfterInstall, pod, testManifest(), EventDetails{}, logging.DefaultLogger)
 
 	if _, err := os.Stat(path.Join(tempDir, "failed")); err == nil {
 		t.Fatal("`failed` file exists; non-executable hook ran but should not have run")
@@ -84,8 +86,8 @@ func TestDirectoriesDoNotBreakEverything(t *testing.T) {
 
 	pod, err := pods.PodFromPodHome("testNode", podDir)
 	Assert(t).IsNil(err, "the error should have been nil")
-	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&logging.DefaultLogger))
-	err = hooks.runHooks(tempDir, AfterInstall, pod, testManifest(), logging.DefaultLogger)
+	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&logging.DefaultLogger), nil)
+	_, err = hooks.runHooks(tempDir, AfterInstall, pod, testManifest(), EventDetails{}, logging.DefaultLogger)
 
 	Assert(t).IsNil(err, "Got an error when running a directory inside the hooks directory")
 }
@@ -119,6 +121,42 @@ func TestHookRunWithTimeout(t *testing.T) {
 	}
 }
 
+func TestHookIsKilledAfterTimeout(t *testing.T) {
+	defer func(grace time.Duration) { killGracePeriod = grace }(killGracePeriod)
+	killGracePeriod = 100 * time.Millisecond
+
+	tempDir, err := ioutil.TempDir("", "hook")
+	Assert(t).IsNil(err, "the error should have been nil")
+	defer os.RemoveAll(tempDir)
+	pidFile := filepath.Join(tempDir, "pid")
+
+	// the hook ignores SIGTERM, so only SIGKILL stops it
+	hookPath := filepath.Join(tempDir, "stubborn")
+	err = ioutil.WriteFile(hookPath, []byte("#!/bin/bash\ntrap '' TERM\necho $$ > "+pidFile+"\nexec sleep 30\n"), 0755)
+	Assert(t).IsNil(err, "could not write hook")
+
+	logger := logging.TestLogger()
+	hook := NewHookExecContext(hookPath, "stubborn", 200*time.Millisecond, HookExecutionEnvironment{}, &logger)
+	err = hook.RunWithTimeout()
+	_, ok := err.(ErrHookTimeout)
+	Assert(t).IsTrue(ok, "expected the hook to time out")
+
+	pidBytes, err := ioutil.ReadFile(pidFile)
+	Assert(t).IsNil(err, "could not read the hook's pid")
+	statPath := filepath.Join("/proc", strings.TrimSpace(string(pidBytes)), "stat")
+
+	// the hook is reaped once it is killed, or is a zombie until then
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		stat, err := ioutil.ReadFile(statPath)
+		if err != nil || strings.Fields(string(stat))[2] == "Z" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the hook to be killed after the grace period")
+		}
+	}
+}
+
 func TestHookAuditLogging(t *testing.T) {
 	tempDir, err := ioutil.TempDir("", "hook")
 	Assert(t).IsNil(err, "the error should have been nil")
@@ -139,10 +177,10 @@ func TestHookAuditLogging(t *testing.T) {
 	buf := &bytes.Buffer{}
 	auditLoggerLogger.Logger.Out = buf
 
-	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&auditLoggerLogger))
+	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&auditLoggerLogger), nil)
 	pod, err := pods.PodFromPodHome("testNode", podDir)
 	Assert(t).IsNil(err, "the error should have been nil")
-	hooks.runHooks(tempDir, AfterInstall, pod, testManifest(), logging.DefaultLogger)
+	hooks.runHooks(tempDir, AfterInstall, pod, testManifest(), EventDetails{}, logging.DefaultLogger)
 
 	Assert(t).IsTrue(len(buf.Bytes()) > 0, "Expected buf to capture audit logs.")
 
@@ -170,3 +208,104 @@ func tempFileWithContents(name string, contents []byte) (string, error) {
 
 	return path, nil
 }
+
+func TestHookPodDirectoriesFollowSpecs(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "hook")
+	Assert(t).IsNil(err, "the error should have been nil")
+	defer os.RemoveAll(tempDir)
+
+	podDir, err := ioutil.TempDir("", "pod")
+	defer os.RemoveAll(podDir)
+	Assert(t).IsNil(err, "the error should have been nil")
+	ioutil.WriteFile(path.Join(podDir, "current_manifest.yaml"), []byte("id: my_hook"), 0755)
+
+	hookPodDir := path.Join(tempDir, "hookpod")
+	Assert(t).IsNil(os.Mkdir(hookPodDir, 0755), "Should not have erred")
+	specs := `
+installing:
+  events: [before_install]
+blocking:
+  events: [after_install]
+  failure_policy: block_install
+aborting:
+  events: [after_install]
+  failure_policy: abort_launch
+other_pods:
+  pod_selector: pod_id=SomeOtherPod
+  failure_policy: block_install
+`
+	Assert(t).IsNil(ioutil.WriteFile(path.Join(hookPodDir, hookSpecsFile), []byte(specs), 0644), "Should not have erred")
+	for name, contents := range map[string]string{
+		"installing": "#!/bin/sh\necho $HOOK_EVENT >> $(dirname $0)/../output",
+		"blocking":   "#!/bin/sh\nexit 1",
+		"aborting":   "#!/bin/sh\nexit 1",
+		"other_pods": "#!/bin/sh\nexit 1",
+	} {
+		Assert(t).IsNil(ioutil.WriteFile(path.Join(hookPodDir, name), []byte(contents), 0755), "Should not have erred")
+	}
+
+	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&logging.DefaultLogger), nil)
+	pod, err := pods.PodFromPodHome("testNode", podDir)
+	Assert(t).IsNil(err, "the error should have been nil")
+
+	results, err := hooks.runHooks(tempDir, BeforeInstall, pod, testManifest(), EventDetails{}, logging.DefaultLogger)
+	Assert(t).IsNil(err, "expected no failed hooks before install")
+	Assert(t).AreEqual(len(results), 1, "expected only the before_install hook to run")
+	Assert(t).AreEqual(results[0].Name, "installing", "wrong hook ran")
+	contents, err := ioutil.ReadFile(path.Join(tempDir, "output"))
+	Assert(t).IsNil(err, "the error should have been nil")
+	Assert(t).AreEqual(string(contents), "before_install\n", "hook should output the hook event into output file")
+
+	results, err = hooks.runHooks(tempDir, AfterInstall, pod, testManifest(), EventDetails{}, logging.DefaultLogger)
+	Assert(t).AreEqual(len(results), 2, "expected the after_install hooks that select the pod to run")
+	failureErr, ok := err.(FailureError)
+	Assert(t).IsTrue(ok, "expected a FailureError")
+	Assert(t).AreEqual(failureErr.Policy, BlockInstall, "expected the strictest failure policy")
+	Assert(t).AreEqual(len(failureErr.Failed), 2, "expected both failed hooks to be reported")
+	Assert(t).AreEqual(FailurePolicyOf(err), BlockInstall, "wrong failure policy")
+}
+
+func TestHookSpecsValidate(t *testing.T) {
+	valid := HookSpec{
+		Events:        []HookType{BeforeInstall},
+		Timeout:       time.Second,
+		FailurePolicy: AbortLaunch,
+		PodSelector:   "pod_id in (a,b)",
+	}
+	Assert(t).IsNil(valid.Validate(), "expected the spec to be valid")
+	Assert(t).IsNotNil(HookSpec{Events: []HookType{"before_everything"}}.Validate(), "expected an unknown event to be rejected")
+	Assert(t).IsNotNil(HookSpec{FailurePolicy: "panic"}.Validate(), "expected an unknown failure policy to be rejected")
+	Assert(t).IsNotNil(HookSpec{PodSelector: "pod_id in in"}.Validate(), "expected an invalid selector to be rejected")
+}
+
+func TestEventDetailsAreExported(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "hook")
+	Assert(t).IsNil(err, "the error should have been nil")
+	defer os.RemoveAll(tempDir)
+
+	podDir, err := ioutil.TempDir("", "pod")
+	defer os.RemoveAll(podDir)
+	Assert(t).IsNil(err, "the error should have been nil")
+	ioutil.WriteFile(path.Join(podDir, "current_manifest.yaml"), []byte("id: my_hook"), 0755)
+
+	script := "#!/bin/sh\nhead -n1 $HOOKED_PREVIOUS_POD_MANIFEST > $(dirname $0)/output\necho $HOOKED_PREVIOUS_HEALTH_STATE $HOOKED_HEALTH_STATE >> $(dirname $0)/output"
+	Assert(t).IsNil(ioutil.WriteFile(path.Join(tempDir, "details"), []byte(script), 0755), "Should not have erred")
+
+	builder := manifest.NewBuilder()
+	builder.SetID("PreviousPod")
+	details := EventDetails{
+		PreviousManifest:    builder.GetManifest(),
+		HealthState:         health.Critical,
+		PreviousHealthState: health.Passing,
+	}
+
+	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&logging.DefaultLogger), nil)
+	pod, err := pods.PodFromPodHome("testNode", podDir)
+	Assert(t).IsNil(err, "the error should have been nil")
+	_, err = hooks.runHooks(tempDir, OnHealthChange, pod, testManifest(), details, logging.DefaultLogger)
+	Assert(t).IsNil(err, "the error should have been nil")
+
+	contents, err := ioutil.ReadFile(path.Join(tempDir, "output"))
+	Assert(t).IsNil(err, "the error should have been nil")
+	Assert(t).AreEqual(string(contents), "id: PreviousPod\npassing critical\n", "hook should have been given the event details")
+}
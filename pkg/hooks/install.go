@@ -2,29 +2,38 @@ package hooks
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	"github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
-	"github.com/square/p2/pkg/runit"
 	"github.com/square/p2/pkg/util"
 )
 
-// Populates the given directory with executor scripts for each launch script of
-// the given pod, which must be installed. Any orphaned executor scripts (from a
-// past install, but no longer present in this pod) will be cleaned out.
+// Populates a directory named after the given hook pod, which must be
+// installed, under the given directory with executor scripts for each launch
+// script of the pod and the specs declared for them in the pod's config. The
+// pod's previous scripts are replaced, so scripts no longer present in the pod
+// are cleaned out.
 func InstallHookScripts(dir string, hookPod *pods.Pod, manifest manifest.Manifest, logger logging.Logger) error {
-	err := os.MkdirAll(dir, 0755)
+	specs, err := HookSpecs(manifest)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0755)
 	if err != nil {
 		return err
 	}
 
-	// TODO: globbing based on the structure of the name is gross, each hook pod
-	// should have its own dir of scripts and running hooks should iterate over
-	// the directories
+	// Scripts installed by older preparers sit directly in dir, named after
+	// the pod. They would run alongside the new ones, so remove them.
 	rmPattern := filepath.Join(dir, fmt.Sprintf("%s__*", hookPod.Id))
 	matches, err := filepath.Glob(rmPattern)
 	if err != nil {
@@ -38,10 +47,25 @@ func InstallHookScripts(dir string, hookPod *pods.Pod, manifest manifest.Manifes
 		}
 	}
 
+	// The scripts are written to a hidden directory, which hooks aren't run
+	// from, and then swapped in for the pod's current directory
+	podDir := filepath.Join(dir, hookPod.Id.String())
+	stagingDir := filepath.Join(dir, fmt.Sprintf(".%s.installing", hookPod.Id))
+	err = os.RemoveAll(stagingDir)
+	if err != nil {
+		return err
+	}
+	err = os.Mkdir(stagingDir, 0755)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+
 	launchables, err := hookPod.Launchables(manifest)
 	if err != nil {
 		return err
 	}
+	scriptSpecs := make(map[string]HookSpec)
 	for _, launchable := range launchables {
 		if launchable.Type() != "hoist" {
 			logger.WithFields(logrus.Fields{
@@ -50,24 +74,21 @@ func InstallHookScripts(dir string, hookPod *pods.Pod, manifest manifest.Manifes
 			}).Errorln("hook disabled: unsupported launchable type")
 			continue
 		}
-		executables, err := launchable.Executables(runit.DefaultBuilder)
+		executables, err := launchable.Executables(hookPod.Supervisor)
 		if err != nil {
 			return err
 		}
 
 		for _, executable := range executables {
-			// Write a script to the event directory that executes the pod's executables
+			// Write a script to the pod's directory that executes the pod's executables
 			// with the correct environment for that pod.
-			scriptPath := filepath.Join(dir, executable.Service.Name)
-			file, err := os.OpenFile(scriptPath, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0744)
-			defer file.Close()
-			if err != nil {
-				logger.WithErrorAndFields(err, logrus.Fields{"script_path": scriptPath}).Errorln("Could not open new hook script")
-			}
-			err = executable.WriteExecutor(file)
+			scriptPath := filepath.Join(stagingDir, executable.Service.Name)
+			err = writeHookScript(scriptPath, executable)
 			if err != nil {
 				logger.WithErrorAndFields(err, logrus.Fields{"script_path": scriptPath}).Errorln("Could not write new hook script")
+				continue
 			}
+			scriptSpecs[executable.Service.Name] = specs[launchable.ID()]
 		}
 		// for convenience as we do with regular launchables, make these ones
 		// current under the launchable directory
@@ -77,5 +98,28 @@ func InstallHookScripts(dir string, hookPod *pods.Pod, manifest manifest.Manifes
 				Errorln("Could not set hook launchable to current")
 		}
 	}
-	return nil
+
+	specBytes, err := yaml.Marshal(scriptSpecs)
+	if err != nil {
+		return util.Errorf("could not marshal hook specs: %s", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(stagingDir, hookSpecsFile), specBytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(podDir)
+	if err != nil {
+		return err
+	}
+	return os.Rename(stagingDir, podDir)
+}
+
+func writeHookScript(scriptPath string, executable launch.Executable) error {
+	file, err := os.OpenFile(scriptPath, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0744)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return executable.WriteExecutor(file)
 }
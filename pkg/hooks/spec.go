@@ -0,0 +1,221 @@
+package hooks
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+// FailurePolicy decides what the preparer does with a pod when one of its
+// hooks fails or times out
+type FailurePolicy string
+
+func (f FailurePolicy) String() string {
+	return string(f)
+}
+
+const (
+	// IgnoreFailure hooks only have their failures logged and audited. This
+	// is the default
+	IgnoreFailure FailurePolicy = "ignore"
+
+	// BlockInstall hooks keep the pod from being installed when they fail
+	// before it is installed. After that they abort the launch like
+	// AbortLaunch hooks. The install is retried
+	BlockInstall FailurePolicy = "block_install"
+
+	// AbortLaunch hooks keep the pod from being launched when they fail before
+	// it is launched. The install and launch are retried
+	AbortLaunch FailurePolicy = "abort_launch"
+)
+
+// strictness orders failure policies so that the strictest policy of several
+// failed hooks can be applied
+func (f FailurePolicy) strictness() int {
+	switch f {
+	case BlockInstall:
+		return 2
+	case AbortLaunch:
+		return 1
+	}
+	return 0
+}
+
+// The key of a hook pod's config that declares its hooks
+const HookSpecsConfigKey = "hooks"
+
+// The file in each hook pod's directory that holds the specs of its hook
+// scripts, keyed by script name
+const hookSpecsFile = "hook_specs.yaml"
+
+// HookSpec declares when and how a hook runs. A hook pod declares a spec for
+// each of its launchables under the "hooks" key of its config, which applies
+// to every entry point of the launchable:
+//
+//	config:
+//	  hooks:
+//	    users:
+//	      events: [before_install]
+//	      timeout: 30s
+//	      failure_policy: block_install
+//	      pod_selector: pod_id notin (p2-preparer)
+//
+// Launchables without a spec run for every event with the default timeout
+// and their failures ignored.
+type HookSpec struct {
+	// The events the hook runs for. Runs for every event if empty
+	Events []HookType `yaml:"events,omitempty"`
+
+	// How long the hook may run before the preparer stops waiting for it
+	// and considers it failed. Defaults to DefaultTimeout
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// What happens to the pod when the hook fails. Defaults to IgnoreFailure
+	FailurePolicy FailurePolicy `yaml:"failure_policy,omitempty"`
+
+	// A label selector matched against the labels of the pod being deployed
+	// and a "pod_id" label holding its ID. Runs for every pod if empty
+	PodSelector string `yaml:"pod_selector,omitempty"`
+}
+
+// Validate returns an error if the spec can't be used
+func (s HookSpec) Validate() error {
+	for _, event := range s.Events {
+		_, err := AsHookType(event.String())
+		if err != nil {
+			return err
+		}
+	}
+	if s.Timeout < 0 {
+		return util.Errorf("hook timeout %s is negative", s.Timeout)
+	}
+	switch s.FailurePolicy {
+	case "", IgnoreFailure, BlockInstall, AbortLaunch:
+	default:
+		return util.Errorf("%q is not a valid hook failure policy", s.FailurePolicy)
+	}
+	_, err := klabels.Parse(s.PodSelector)
+	if err != nil {
+		return util.Errorf("invalid hook pod selector %q: %s", s.PodSelector, err)
+	}
+	return nil
+}
+
+func (s HookSpec) runsFor(hookType HookType) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, event := range s.Events {
+		if event == hookType {
+			return true
+		}
+	}
+	return false
+}
+
+func (s HookSpec) timeout() time.Duration {
+	if s.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return s.Timeout
+}
+
+func (s HookSpec) failurePolicy() FailurePolicy {
+	if s.FailurePolicy == "" {
+		return IgnoreFailure
+	}
+	return s.FailurePolicy
+}
+
+// HookSpecs reads the specs a hook pod's manifest declares for its
+// launchables
+func HookSpecs(hookManifest manifest.Manifest) (map[launch.LaunchableID]HookSpec, error) {
+	specs := make(map[launch.LaunchableID]HookSpec)
+	declared, ok := hookManifest.GetConfig()[HookSpecsConfigKey]
+	if !ok {
+		return specs, nil
+	}
+
+	// re-encode the config section to parse it into specs
+	encoded, err := yaml.Marshal(declared)
+	if err != nil {
+		return nil, util.Errorf("could not read hook specs of %s: %s", hookManifest.ID(), err)
+	}
+	err = yaml.Unmarshal(encoded, &specs)
+	if err != nil {
+		return nil, util.Errorf("could not read hook specs of %s: %s", hookManifest.ID(), err)
+	}
+
+	launchables := hookManifest.GetLaunchableStanzas()
+	for launchableID, spec := range specs {
+		if _, ok := launchables[launchableID]; !ok {
+			return nil, util.Errorf("hook spec for %s does not match a launchable of %s", launchableID, hookManifest.ID())
+		}
+		err = spec.Validate()
+		if err != nil {
+			return nil, util.Errorf("hook spec for %s of %s: %s", launchableID, hookManifest.ID(), err)
+		}
+	}
+	return specs, nil
+}
+
+// Result describes one run of a hook
+type Result struct {
+	Name          string
+	Event         HookType
+	FailurePolicy FailurePolicy
+	Start         time.Time
+	Duration      time.Duration
+	// nil if the hook succeeded
+	Err error
+}
+
+// FailureError is returned by RunHookType when hooks whose failure policy
+// isn't IgnoreFailure fail. Policy is the strictest policy of those hooks.
+type FailureError struct {
+	Policy FailurePolicy
+	Failed []Result
+}
+
+func (e FailureError) Error() string {
+	names := make([]string, 0, len(e.Failed))
+	for _, result := range e.Failed {
+		names = append(names, result.Name)
+	}
+	return fmt.Sprintf("%d hook(s) with failure policy %s failed: %v", len(e.Failed), e.Policy, names)
+}
+
+// FailurePolicyOf returns the failure policy the preparer should apply after
+// RunHookType returned err
+func FailurePolicyOf(err error) FailurePolicy {
+	if failureErr, ok := err.(FailureError); ok {
+		return failureErr.Policy
+	}
+	return IgnoreFailure
+}
+
+// failureError returns a FailureError for the results of hooks that failed
+// and don't ignore failures, or nil if there are none
+func failureError(results []Result) error {
+	var failed []Result
+	policy := IgnoreFailure
+	for _, result := range results {
+		if result.Err == nil || result.FailurePolicy == IgnoreFailure {
+			continue
+		}
+		failed = append(failed, result)
+		if result.FailurePolicy.strictness() > policy.strictness() {
+			policy = result.FailurePolicy
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return FailureError{Policy: policy, Failed: failed}
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/types"
 )
 
@@ -28,6 +31,17 @@ var (
 	AfterLaunch = HookType("after_launch")
 	// AfterAuth occurs conditionally when artifact authorization fails
 	AfterAuthFail = HookType("after_auth_fail")
+	// BeforeHalt occurs before a running pod is halted, whether it is being
+	// removed or replaced
+	BeforeHalt = HookType("before_halt")
+	// AfterHalt occurs after a running pod was halted
+	AfterHalt = HookType("after_halt")
+	// OnHealthChange occurs when the health of a pod changes between passing
+	// and critical
+	OnHealthChange = HookType("on_health_change")
+	// AfterManifestUpdate occurs after a pod was relaunched with a manifest
+	// that only differs from the previous one in its config
+	AfterManifestUpdate = HookType("after_manifest_update")
 )
 
 func AsHookType(value string) (HookType, error) {
@@ -44,6 +58,14 @@ func AsHookType(value string) (HookType, error) {
 		return AfterLaunch, nil
 	case AfterAuthFail.String():
 		return AfterAuthFail, nil
+	case BeforeHalt.String():
+		return BeforeHalt, nil
+	case AfterHalt.String():
+		return AfterHalt, nil
+	case OnHealthChange.String():
+		return OnHealthChange, nil
+	case AfterManifestUpdate.String():
+		return AfterManifestUpdate, nil
 	default:
 		return HookType(""), fmt.Errorf("%s is not a valid hook type", value)
 	}
@@ -65,9 +87,18 @@ const (
 	HookedSystemPodRootEnvVar = "HOOKED_SYSTEM_POD_ROOT"
 	HookedPodUniqueKeyEnvVar  = "HOOKED_POD_UNIQUE_KEY"
 
+	// only set for the events that have a previous manifest or health state
+	HookedPreviousPodManifestEnvVar = "HOOKED_PREVIOUS_POD_MANIFEST"
+	HookedHealthStateEnvVar         = "HOOKED_HEALTH_STATE"
+	HookedPreviousHealthStateEnvVar = "HOOKED_PREVIOUS_HEALTH_STATE"
+
 	DefaultTimeout = 120 * time.Second
 )
 
+// A hook that times out is sent SIGTERM, and SIGKILL if it is still running
+// once the grace period has passed
+var killGracePeriod = 30 * time.Second
+
 // Pod is the minimum set of functions needed for a hook to operate on a Pod
 type Pod interface {
 	ConfigDir() string
@@ -77,11 +108,19 @@ type Pod interface {
 	UniqueKey() types.PodUniqueKey
 }
 
+// PodLabeler looks up the labels of the pod hooks run for, so that hook pod
+// selectors can match them. labels.Applicator implements it
+type PodLabeler interface {
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+}
+
 type hookContext struct {
 	dirpath     string
 	podRoot     string
 	logger      *logging.Logger
 	auditLogger AuditLogger
+	// may be nil, in which case pod selectors only match the pod ID
+	podLabeler PodLabeler
 }
 
 // The set of environment variables exposed to the hook as it runs
@@ -97,7 +136,10 @@ type HookExecutionEnvironment struct {
 	HookedEnvPathEnvVar,
 	HookedConfigDirPathEnvVar,
 	HookedSystemPodRootEnvVar,
-	HookedPodUniqueKeyEnvVar string
+	HookedPodUniqueKeyEnvVar,
+	HookedPreviousPodManifestEnvVar,
+	HookedHealthStateEnvVar,
+	HookedPreviousHealthStateEnvVar string
 }
 
 // The set of UNIX environment variables for the hook's execution
@@ -114,9 +156,23 @@ func (hee *HookExecutionEnvironment) Env() []string {
 		fmt.Sprintf("%s=%s", HookedConfigDirPathEnvVar, hee.HookedConfigDirPathEnvVar),
 		fmt.Sprintf("%s=%s", HookedSystemPodRootEnvVar, hee.HookedSystemPodRootEnvVar),
 		fmt.Sprintf("%s=%s", HookedPodUniqueKeyEnvVar, hee.HookedPodUniqueKeyEnvVar),
+		fmt.Sprintf("%s=%s", HookedPreviousPodManifestEnvVar, hee.HookedPreviousPodManifestEnvVar),
+		fmt.Sprintf("%s=%s", HookedHealthStateEnvVar, hee.HookedHealthStateEnvVar),
+		fmt.Sprintf("%s=%s", HookedPreviousHealthStateEnvVar, hee.HookedPreviousHealthStateEnvVar),
 	}
 }
 
+// EventDetails describes what changed for the events that have a before and
+// an after. Fields that don't apply to the event are left empty
+type EventDetails struct {
+	// The manifest the pod ran with before an AfterManifestUpdate event
+	PreviousManifest manifest.Manifest
+
+	// The health states of the pod around an OnHealthChange event
+	HealthState         health.HealthState
+	PreviousHealthState health.HealthState
+}
+
 // AuditLogger defines a mechanism for logging hook success or failure to a store, such as a file or SQLite
 type AuditLogger interface {
 	// LogSuccess should be invoked on successful events.
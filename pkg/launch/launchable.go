@@ -10,6 +10,7 @@ import (
 
 	"github.com/square/p2/pkg/cgroups"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/supervisor"
 	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/util/size"
 )
@@ -49,8 +50,37 @@ type LaunchableStanza struct {
 	// "always".
 	RestartPolicy_ runit.RestartPolicy `yaml:"restart_policy,omitempty"`
 
+	// If present, restarts of failed processes are delayed exponentially,
+	// and a process that fails too often is marked failed instead of being
+	// restarted.
+	RestartBackoff_ *BackoffStanza `yaml:"restart_backoff,omitempty"`
+
+	// Describes how the launchable's processes are shut down. See
+	// ShutdownStanza.
+	Shutdown ShutdownStanza `yaml:"shutdown,omitempty"`
+
+	// The signal, e.g. "HUP", that asks the launchable's processes to
+	// reload the pod's config after an update that only changed the config
+	// or env. Hoist launchables may provide a bin/reload script instead.
+	// Launchables with neither are restarted by such updates.
+	ReloadSignal string `yaml:"reload_signal,omitempty"`
+
+	// One of "main" (the default), "init" or "sidecar". See Role.
+	Role_ Role `yaml:"role,omitempty"`
+
+	// The launchables that must be started before this one
+	StartsAfter []LaunchableID `yaml:"starts_after,omitempty"`
+
+	// The launchables that must not be stopped before this one
+	StopBefore []LaunchableID `yaml:"stop_before,omitempty"`
+
+	// For init launchables, how long they may run before they are killed
+	// and considered failed. Must be parseable by time.ParseDuration().
+	// Defaults to 10m
+	InitTimeout string `yaml:"init_timeout,omitempty"`
+
 	// Specifies which files or directories (relative to launchable root)
-	// should be launched under runit. Only launchables of type "hoist"
+	// should be launched under the process supervisor. Only launchables of type "hoist"
 	// make use of this field, and if empty, a default of ["bin/launch"]
 	// is used
 	EntryPoints []string `yaml:"entry_points,omitempty"`
@@ -81,6 +111,85 @@ func (l LaunchableStanza) RestartPolicy() runit.RestartPolicy {
 	return l.RestartPolicy_
 }
 
+// BackoffStanza configures runit.Backoff. Durations must be parseable by
+// time.ParseDuration().
+type BackoffStanza struct {
+	// The delay before the first restart after a failure. Defaults to 1s
+	Initial string `yaml:"initial,omitempty"`
+	// The longest delay between restarts. Defaults to 5m
+	Max string `yaml:"max,omitempty"`
+	// How many times the process may fail within Window before it is
+	// marked failed. When unspecified, the process is restarted forever.
+	MaxRestarts int `yaml:"max_restarts,omitempty"`
+	// How long failures are remembered. Defaults to 10m
+	Window string `yaml:"window,omitempty"`
+}
+
+const DefaultInitTimeout = 10 * time.Minute
+
+// GetInitTimeout returns how long an init launchable may run.
+func (l LaunchableStanza) GetInitTimeout() (time.Duration, error) {
+	if l.InitTimeout == "" {
+		return DefaultInitTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(l.InitTimeout)
+	if err != nil {
+		return 0, util.Errorf("invalid init_timeout %q: %s", l.InitTimeout, err)
+	}
+	return timeout, nil
+}
+
+const (
+	DefaultBackoffInitial = 1 * time.Second
+	DefaultBackoffMax     = 5 * time.Minute
+	DefaultBackoffWindow  = 10 * time.Minute
+)
+
+// RestartBackoff returns the configured backoff, or nil if restarts
+// should not be delayed.
+func (l LaunchableStanza) RestartBackoff() (*runit.Backoff, error) {
+	if l.RestartBackoff_ == nil {
+		return nil, nil
+	}
+
+	backoff := &runit.Backoff{
+		Initial:     DefaultBackoffInitial,
+		Max:         DefaultBackoffMax,
+		MaxRestarts: l.RestartBackoff_.MaxRestarts,
+		Window:      DefaultBackoffWindow,
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"initial", l.RestartBackoff_.Initial, &backoff.Initial},
+		{"max", l.RestartBackoff_.Max, &backoff.Max},
+		{"window", l.RestartBackoff_.Window, &backoff.Window},
+	} {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil {
+			return nil, util.Errorf("invalid restart_backoff %s %q: %s", field.name, field.value, err)
+		}
+		if d <= 0 {
+			return nil, util.Errorf("restart_backoff %s must be positive, was %s", field.name, field.value)
+		}
+		*field.dest = d
+	}
+
+	if backoff.MaxRestarts < 0 {
+		return nil, util.Errorf("restart_backoff max_restarts must not be negative, was %d", backoff.MaxRestarts)
+	}
+	if backoff.Max < backoff.Initial {
+		return nil, util.Errorf("restart_backoff max (%s) must not be less than initial (%s)", backoff.Max, backoff.Initial)
+	}
+	return backoff, nil
+}
+
 // Uses the assumption that all locations have a Path component ending in
 // /<launchable_id>_<version>.tar.gz, which is intended to be phased out in
 // favor of explicit launchable versions specified in pod manifests.
@@ -126,7 +235,7 @@ type Launchable interface {
 	// ServiceID returns a (host-wise) unique ID for this launchable.
 	// Unlike ID(), ServiceID() must be unique for all instances of a launchable
 	// on a single host, even if are multiple pods have the same launchable ID.
-	// This is because runit requires service names to be unique.
+	// This is because supervisors require service names to be unique.
 	// In practice this usually means this will return some concatenation of the
 	// pod ID and the launchable ID.
 	ServiceID() string
@@ -136,7 +245,7 @@ type Launchable interface {
 	// will be expressed as files
 	EnvDir() string
 	// Executables gets a list of the commands that are part of this launchable.
-	Executables(serviceBuilder *runit.ServiceBuilder) ([]Executable, error)
+	Executables(supervisor supervisor.Supervisor) ([]Executable, error)
 	// Installed returns true if this launchable is already installed.
 	Installed() bool
 	// Executes any necessary post-install steps to ready the launchable for launch
@@ -145,11 +254,11 @@ type Launchable interface {
 	// PostActive runs a Hoist-specific "post-activate" script in the launchable.
 	PostActivate() (string, error)
 	// Launch begins execution.
-	Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error
+	Launch(supervisor supervisor.Supervisor) error
 	// Disable allows a launchable to stop work and do cleanup prior to Stop
 	Disable() error
 	// Stop stops execution.
-	Stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error
+	Stop(supervisor supervisor.Supervisor) error
 	// MakeCurrent adjusts a "current" symlink for this launchable name to point to this
 	// launchable's version.
 	MakeCurrent() error
@@ -165,6 +274,10 @@ type Launchable interface {
 	EnvVars() map[string]string
 
 	RestartPolicy() runit.RestartPolicy
+
+	// RestartBackoff returns how restarts after failures are delayed and
+	// limited, or nil if they aren't
+	RestartBackoff() *runit.Backoff
 }
 
 // Executable describes a command and its arguments that should be executed to start a
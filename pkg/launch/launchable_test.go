@@ -1,7 +1,11 @@
 package launch
 
 import (
+	"syscall"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
 )
 
 func TestVersionFromLocation(t *testing.T) {
@@ -54,3 +58,117 @@ func TestVersionFromLocation(t *testing.T) {
 		}
 	}
 }
+
+func TestRestartBackoff(t *testing.T) {
+	var stanza LaunchableStanza
+	err := yaml.Unmarshal([]byte(`
+launchable_type: hoist
+restart_policy: on-failure
+restart_backoff:
+  max: 1m
+  max_restarts: 5
+`), &stanza)
+	if err != nil {
+		t.Fatalf("Could not parse stanza: %s", err)
+	}
+
+	backoff, err := stanza.RestartBackoff()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing backoff: %s", err)
+	}
+	if backoff.Initial != DefaultBackoffInitial || backoff.Window != DefaultBackoffWindow {
+		t.Errorf("Expected unset fields to use defaults, got %+v", backoff)
+	}
+	if backoff.Max != time.Minute || backoff.MaxRestarts != 5 {
+		t.Errorf("Expected configured fields to be used, got %+v", backoff)
+	}
+
+	for _, invalid := range []BackoffStanza{
+		{Initial: "soon"},
+		{Window: "-1m"},
+		{Initial: "2m", Max: "1m"},
+		{MaxRestarts: -1},
+	} {
+		stanza.RestartBackoff_ = &invalid
+		_, err = stanza.RestartBackoff()
+		if err == nil {
+			t.Errorf("Expected an error for invalid backoff %+v", invalid)
+		}
+	}
+
+	stanza.RestartBackoff_ = nil
+	backoff, err = stanza.RestartBackoff()
+	if err != nil || backoff != nil {
+		t.Errorf("Expected no backoff when none was configured, got %+v, %v", backoff, err)
+	}
+}
+
+func TestGetShutdown(t *testing.T) {
+	var stanza LaunchableStanza
+	err := yaml.Unmarshal([]byte(`
+launchable_type: hoist
+shutdown:
+  signal: sigint
+  grace_period: 2m
+  pre_stop:
+    exec: [bin/drain]
+    timeout: 10s
+  drain_timeout: 30s
+`), &stanza)
+	if err != nil {
+		t.Fatalf("Could not parse stanza: %s", err)
+	}
+
+	shutdown, err := stanza.GetShutdown()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing shutdown stanza: %s", err)
+	}
+	if shutdown.Signal != "INT" {
+		t.Errorf("Expected signal to be normalized to INT, got %s", shutdown.Signal)
+	}
+	if shutdown.GracePeriod != 2*time.Minute || shutdown.PreStopTimeout != 10*time.Second || shutdown.DrainTimeout != 30*time.Second {
+		t.Errorf("Expected configured durations to be used, got %+v", shutdown)
+	}
+	if len(shutdown.PreStopExec) != 1 || shutdown.PreStopExec[0] != "bin/drain" {
+		t.Errorf("Unexpected pre-stop command %v", shutdown.PreStopExec)
+	}
+
+	for _, invalid := range []ShutdownStanza{
+		{Signal: "KILL"},
+		{GracePeriod: "forever"},
+		{DrainTimeout: "-1s"},
+		{PreStop: PreStopStanza{Timeout: "1"}},
+	} {
+		stanza.Shutdown = invalid
+		_, err = stanza.GetShutdown()
+		if err == nil {
+			t.Errorf("Expected an error for invalid shutdown stanza %+v", invalid)
+		}
+	}
+
+	stanza.Shutdown = ShutdownStanza{}
+	shutdown, err = stanza.GetShutdown()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing empty shutdown stanza: %s", err)
+	}
+	if shutdown.Signal != DefaultStopSignal || shutdown.GracePeriod != 0 || shutdown.PreStopTimeout != DefaultPreStopTimeout {
+		t.Errorf("Expected defaults for an empty shutdown stanza, got %+v", shutdown)
+	}
+}
+
+func TestGetReloadSignal(t *testing.T) {
+	signal, err := LaunchableStanza{}.GetReloadSignal()
+	if err != nil || signal != 0 {
+		t.Errorf("Expected no reload signal by default, got %v, %v", signal, err)
+	}
+
+	signal, err = LaunchableStanza{ReloadSignal: "sighup"}.GetReloadSignal()
+	if err != nil || signal != syscall.SIGHUP {
+		t.Errorf("Expected SIGHUP, got %v, %v", signal, err)
+	}
+
+	_, err = LaunchableStanza{ReloadSignal: "KILL"}.GetReloadSignal()
+	if err == nil {
+		t.Errorf("Expected an error for an unsupported reload signal")
+	}
+}
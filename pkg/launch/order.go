@@ -0,0 +1,169 @@
+package launch
+
+import (
+	"sort"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// A launchable's role determines when it is started relative to the other
+// launchables in its pod.
+type Role string
+
+const (
+	// Main launchables run the pod's application. This is the default.
+	RoleMain Role = "main"
+
+	// Init launchables run to completion, one after the other, before any
+	// other launchable is started. If one of them fails, the rest of the pod
+	// is not started. They are not supervised and are never stopped.
+	RoleInit Role = "init"
+
+	// Sidecar launchables support the main launchables. They are started
+	// before and stopped after every main launchable.
+	RoleSidecar Role = "sidecar"
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleMain, RoleInit, RoleSidecar:
+		return true
+	}
+	return false
+}
+
+// rank orders roles for starting: init, then sidecars, then main launchables.
+func (r Role) rank() int {
+	switch r {
+	case RoleInit:
+		return 0
+	case RoleSidecar:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (l LaunchableStanza) Role() Role {
+	if l.Role_ == "" {
+		return RoleMain
+	}
+
+	return l.Role_
+}
+
+// StartOrder returns the IDs of the given launchables in the order they
+// should be started. Init launchables come first, then sidecars, then main
+// launchables, and every launchable comes after the ones listed in its
+// starts_after. Launchables that aren't otherwise ordered are sorted by ID.
+func StartOrder(stanzas map[LaunchableID]LaunchableStanza) ([]LaunchableID, error) {
+	before := make(map[LaunchableID][]LaunchableID)
+	for id, stanza := range stanzas {
+		for _, dep := range stanza.StartsAfter {
+			depStanza, ok := stanzas[dep]
+			if !ok {
+				return nil, util.Errorf("'%s': starts_after refers to unknown launchable '%s'", id, dep)
+			}
+			if depStanza.Role().rank() > stanza.Role().rank() {
+				return nil, util.Errorf("'%s': %s launchable can't start after %s launchable '%s'", id, stanza.Role(), depStanza.Role(), dep)
+			}
+			before[id] = append(before[id], dep)
+		}
+	}
+
+	return order(stanzas, before, func(a, b LaunchableStanza) bool {
+		return a.Role().rank() < b.Role().rank()
+	})
+}
+
+// StopOrder returns the IDs of the given launchables in the order they
+// should be stopped. It is the reverse of the start order, except that a
+// launchable is stopped before the ones listed in its stop_before. Init
+// launchables are omitted since they don't keep running.
+func StopOrder(stanzas map[LaunchableID]LaunchableStanza) ([]LaunchableID, error) {
+	running := make(map[LaunchableID]LaunchableStanza)
+	for id, stanza := range stanzas {
+		if stanza.Role() != RoleInit {
+			running[id] = stanza
+		}
+	}
+
+	before := make(map[LaunchableID][]LaunchableID)
+	for id, stanza := range running {
+		// a launchable that starts after another is stopped before it
+		for _, dep := range stanza.StartsAfter {
+			if _, ok := running[dep]; ok {
+				before[dep] = append(before[dep], id)
+			}
+		}
+		for _, next := range stanza.StopBefore {
+			if _, ok := running[next]; !ok {
+				return nil, util.Errorf("'%s': stop_before refers to unknown or init launchable '%s'", id, next)
+			}
+			before[next] = append(before[next], id)
+		}
+	}
+
+	return order(running, before, func(a, b LaunchableStanza) bool {
+		return a.Role().rank() > b.Role().rank()
+	})
+}
+
+// order sorts the launchables topologically so that every launchable comes
+// after the ones listed for it in before. Among launchables that are ready at
+// the same time, those for which first returns true come first, then the
+// rest by ID.
+func order(
+	stanzas map[LaunchableID]LaunchableStanza,
+	before map[LaunchableID][]LaunchableID,
+	first func(a, b LaunchableStanza) bool,
+) ([]LaunchableID, error) {
+	ids := make(launchableIDs, 0, len(stanzas))
+	for id := range stanzas {
+		ids = append(ids, id)
+	}
+	sort.Sort(ids)
+
+	done := make(map[LaunchableID]bool)
+	ret := make([]LaunchableID, 0, len(ids))
+	for len(ret) < len(ids) {
+		var next LaunchableID
+		found := false
+		for _, id := range ids {
+			if done[id] || !allDone(before[id], done) {
+				continue
+			}
+			if !found || first(stanzas[id], stanzas[next]) {
+				next = id
+				found = true
+			}
+		}
+		if !found {
+			var remaining []LaunchableID
+			for _, id := range ids {
+				if !done[id] {
+					remaining = append(remaining, id)
+				}
+			}
+			return nil, util.Errorf("launchables %v can't be ordered: their starts_after and stop_before form a cycle", remaining)
+		}
+		done[next] = true
+		ret = append(ret, next)
+	}
+	return ret, nil
+}
+
+func allDone(ids []LaunchableID, done map[LaunchableID]bool) bool {
+	for _, id := range ids {
+		if !done[id] {
+			return false
+		}
+	}
+	return true
+}
+
+type launchableIDs []LaunchableID
+
+func (l launchableIDs) Len() int           { return len(l) }
+func (l launchableIDs) Less(i, j int) bool { return l[i] < l[j] }
+func (l launchableIDs) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
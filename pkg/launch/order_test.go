@@ -0,0 +1,82 @@
+package launch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStartOrder(t *testing.T) {
+	stanzas := map[LaunchableID]LaunchableStanza{
+		"web":       {},
+		"api":       {StartsAfter: []LaunchableID{"web"}},
+		"proxy":     {Role_: RoleSidecar},
+		"migrate":   {Role_: RoleInit, StartsAfter: []LaunchableID{"bootstrap"}},
+		"bootstrap": {Role_: RoleInit},
+		"cache":     {},
+	}
+
+	order, err := StartOrder(stanzas)
+	if err != nil {
+		t.Fatalf("Unexpected error ordering launchables: %s", err)
+	}
+	expected := []LaunchableID{"bootstrap", "migrate", "proxy", "cache", "web", "api"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected start order %v, got %v", expected, order)
+	}
+
+	order, err = StopOrder(stanzas)
+	if err != nil {
+		t.Fatalf("Unexpected error ordering launchables: %s", err)
+	}
+	expected = []LaunchableID{"api", "cache", "web", "proxy"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected stop order %v, got %v", expected, order)
+	}
+
+	stanzas["web"] = LaunchableStanza{StopBefore: []LaunchableID{"cache"}}
+	order, err = StopOrder(stanzas)
+	if err != nil {
+		t.Fatalf("Unexpected error ordering launchables: %s", err)
+	}
+	expected = []LaunchableID{"api", "web", "cache", "proxy"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected stop order %v, got %v", expected, order)
+	}
+}
+
+func TestOrderErrors(t *testing.T) {
+	for _, stanzas := range []map[LaunchableID]LaunchableStanza{
+		{
+			"a": {StartsAfter: []LaunchableID{"b"}},
+			"b": {StartsAfter: []LaunchableID{"a"}},
+		},
+		{
+			"a": {StartsAfter: []LaunchableID{"missing"}},
+		},
+		{
+			"a": {Role_: RoleInit, StartsAfter: []LaunchableID{"b"}},
+			"b": {},
+		},
+	} {
+		_, err := StartOrder(stanzas)
+		if err == nil {
+			t.Errorf("Expected an error ordering %+v", stanzas)
+		}
+	}
+
+	for _, stanzas := range []map[LaunchableID]LaunchableStanza{
+		{
+			"a": {StartsAfter: []LaunchableID{"b"}},
+			"b": {StopBefore: []LaunchableID{"a"}},
+		},
+		{
+			"a":    {StopBefore: []LaunchableID{"init"}},
+			"init": {Role_: RoleInit},
+		},
+	} {
+		_, err := StopOrder(stanzas)
+		if err == nil {
+			t.Errorf("Expected an error ordering %+v", stanzas)
+		}
+	}
+}
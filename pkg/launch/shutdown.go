@@ -0,0 +1,136 @@
+package launch
+
+import (
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultStopSignal is sent to a launchable's processes to stop them, unless
+// the launchable's shutdown stanza specifies a different signal.
+const DefaultStopSignal = "TERM"
+
+const DefaultPreStopTimeout = 30 * time.Second
+
+// The signals a launchable may ask to be stopped or reloaded with
+var signals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"HUP":  syscall.SIGHUP,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"ALRM": syscall.SIGALRM,
+}
+
+// signalName normalizes a signal name to the form without the "SIG" prefix
+func signalName(name string) string {
+	return strings.TrimPrefix(strings.ToUpper(name), "SIG")
+}
+
+// ShutdownStanza describes how a launchable is shut down when its pod is
+// halted. When a pod is halted, the pre-stop hooks of all of its launchables
+// are run, then p2 waits for the pod's status check to stop passing, then the
+// launchables are disabled and finally their processes are sent the stop
+// signal and killed if they haven't exited after the grace period.
+//
+// Durations must be parseable by time.ParseDuration().
+type ShutdownStanza struct {
+	// The signal that asks the launchable's processes to exit, e.g. "INT"
+	// or "SIGINT". Defaults to TERM
+	Signal string `yaml:"signal,omitempty"`
+
+	// How long the processes have to exit after receiving the stop signal
+	// before they are killed. Overrides restart_timeout
+	GracePeriod string `yaml:"grace_period,omitempty"`
+
+	PreStop PreStopStanza `yaml:"pre_stop,omitempty"`
+
+	// The longest time to wait after the pre-stop hooks for the pod's
+	// status check to stop passing, so that load balancers can drain it.
+	// Pods without a status port don't wait.
+	DrainTimeout string `yaml:"drain_timeout,omitempty"`
+}
+
+// PreStopStanza tells the launchable that it is about to be stopped. Either
+// or both of Exec and HTTP may be specified.
+type PreStopStanza struct {
+	// A command to run as the pod's user. A relative path to the executable
+	// is resolved within the launchable's install directory.
+	Exec []string `yaml:"exec,omitempty"`
+
+	// A URL to send a POST request to
+	HTTP string `yaml:"http,omitempty"`
+
+	// How long the hooks may take. Defaults to 30s
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+// Shutdown is the parsed form of a ShutdownStanza.
+type Shutdown struct {
+	// The stop signal without the "SIG" prefix
+	Signal string
+	// Zero if the launchable didn't specify a grace period
+	GracePeriod    time.Duration
+	PreStopExec    []string
+	PreStopHTTP    string
+	PreStopTimeout time.Duration
+	DrainTimeout   time.Duration
+}
+
+// GetShutdown parses and validates the launchable's shutdown stanza.
+func (l LaunchableStanza) GetShutdown() (Shutdown, error) {
+	stanza := l.Shutdown
+	ret := Shutdown{
+		Signal:         DefaultStopSignal,
+		PreStopExec:    stanza.PreStop.Exec,
+		PreStopHTTP:    stanza.PreStop.HTTP,
+		PreStopTimeout: DefaultPreStopTimeout,
+	}
+
+	if stanza.Signal != "" {
+		ret.Signal = signalName(stanza.Signal)
+		if _, ok := signals[ret.Signal]; !ok {
+			return Shutdown{}, util.Errorf("unsupported shutdown signal %q", stanza.Signal)
+		}
+	}
+
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"grace_period", stanza.GracePeriod, &ret.GracePeriod},
+		{"pre_stop timeout", stanza.PreStop.Timeout, &ret.PreStopTimeout},
+		{"drain_timeout", stanza.DrainTimeout, &ret.DrainTimeout},
+	} {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil {
+			return Shutdown{}, util.Errorf("invalid shutdown %s %q: %s", field.name, field.value, err)
+		}
+		if d < 0 {
+			return Shutdown{}, util.Errorf("shutdown %s must not be negative, was %s", field.name, field.value)
+		}
+		*field.dest = d
+	}
+
+	return ret, nil
+}
+
+// GetReloadSignal returns the signal that asks the launchable's processes to
+// reload the pod's config, or 0 if the launchable doesn't specify one.
+func (l LaunchableStanza) GetReloadSignal() (syscall.Signal, error) {
+	if l.ReloadSignal == "" {
+		return 0, nil
+	}
+	signal, ok := signals[signalName(l.ReloadSignal)]
+	if !ok {
+		return 0, util.Errorf("unsupported reload signal %q", l.ReloadSignal)
+	}
+	return signal, nil
+}
@@ -0,0 +1,174 @@
+package logbridge
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+
+	"github.com/square/p2/pkg/util"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats that a pod's log lines can be parsed as
+const (
+	// FormatAuto parses lines that look like JSON objects as JSON and lines
+	// that consist of key=value pairs as logfmt. Other lines are shipped
+	// as plain messages. This is the default.
+	FormatAuto = "auto"
+	FormatJSON = "json"
+	// FormatLogfmt parses lines of key=value pairs, as written by e.g.
+	// logrus' text formatter
+	FormatLogfmt = "logfmt"
+	// FormatRaw ships every line as a plain message
+	FormatRaw = "raw"
+)
+
+// Types of sinks that logs can be shipped to
+const (
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+	SinkHTTP   = "http"
+)
+
+const (
+	DefaultBufferSizeMB  = 256
+	DefaultFileSizeMB    = 100
+	DefaultFileCount     = 5
+	DefaultBatchSize     = 100
+	DefaultSyslogNetwork = "udp"
+	DefaultFacility      = "user"
+)
+
+// Config describes how a pod's logs are parsed and where they are shipped.
+// It is specified in the log_shipping section of a pod manifest:
+//
+//	log_shipping:
+//	  format: json
+//	  sinks:
+//	  - type: file
+//	    path: /var/log/pods/mypod.log
+//	    compress: true
+//	  - type: syslog
+//	    network: tcp
+//	    address: logs.example.com:514
+//	  - type: http
+//	    url: https://logs.example.com/ingest
+//
+// Every sink is fed from its own buffer on disk, so a sink that is slow or
+// unavailable neither loses lines nor holds up the pod or the other sinks.
+type Config struct {
+	Format string       `yaml:"format,omitempty"`
+	Buffer BufferConfig `yaml:"buffer,omitempty"`
+	Sinks  []SinkConfig `yaml:"sinks"`
+}
+
+type BufferConfig struct {
+	// The most disk space each sink's buffer may use. When a buffer is
+	// full, its oldest lines are discarded. Defaults to 256MB
+	MaxSizeMB int `yaml:"max_size_mb,omitempty"`
+}
+
+// SinkConfig configures a single sink. Which fields apply depends on the
+// sink's type.
+type SinkConfig struct {
+	Type string `yaml:"type"`
+
+	// file: the file that records are written to as JSON lines. It is
+	// rotated when it reaches MaxSizeMB, keeping MaxFiles old files, which
+	// are gzipped if Compress is set
+	Path      string `yaml:"path,omitempty"`
+	MaxSizeMB int    `yaml:"max_size_mb,omitempty"`
+	MaxFiles  int    `yaml:"max_files,omitempty"`
+	Compress  bool   `yaml:"compress,omitempty"`
+
+	// syslog: records are sent as RFC 5424 messages over "udp" (the
+	// default) or "tcp" to the host:port in Address. Facility is one of
+	// the names in syslogFacilities, "user" by default
+	Network  string `yaml:"network,omitempty"`
+	Address  string `yaml:"address,omitempty"`
+	Facility string `yaml:"facility,omitempty"`
+
+	// http: batches of up to BatchSize records (100 by default) are POSTed
+	// to URL as a JSON array
+	URL       string `yaml:"url,omitempty"`
+	BatchSize int    `yaml:"batch_size,omitempty"`
+}
+
+// LoadConfig reads a Config from a YAML file.
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, util.Errorf("Could not read log shipping config: %s", err)
+	}
+	var config Config
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return Config{}, util.Errorf("Could not parse log shipping config %s: %s", path, err)
+	}
+	return config, config.Validate()
+}
+
+// Validate returns an error if the config can't be used to ship logs.
+func (c Config) Validate() error {
+	switch c.Format {
+	case "", FormatAuto, FormatJSON, FormatLogfmt, FormatRaw:
+	default:
+		return util.Errorf("unknown log format %q", c.Format)
+	}
+	if c.Buffer.MaxSizeMB < 0 {
+		return util.Errorf("log buffer size must not be negative, was %d", c.Buffer.MaxSizeMB)
+	}
+	if len(c.Sinks) == 0 {
+		return util.Errorf("log shipping requires at least one sink")
+	}
+
+	for i, sink := range c.Sinks {
+		err := sink.validate()
+		if err != nil {
+			return util.Errorf("log sink %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func (s SinkConfig) validate() error {
+	switch s.Type {
+	case SinkFile:
+		if s.Path == "" {
+			return util.Errorf("file sink requires a path")
+		}
+		if s.MaxSizeMB < 0 || s.MaxFiles < 0 {
+			return util.Errorf("file sink max_size_mb and max_files must not be negative")
+		}
+	case SinkSyslog:
+		if s.Network != "" && s.Network != "udp" && s.Network != "tcp" {
+			return util.Errorf("syslog sink network must be udp or tcp, was %q", s.Network)
+		}
+		if _, _, err := net.SplitHostPort(s.Address); err != nil {
+			return util.Errorf("syslog sink address %q is not host:port: %s", s.Address, err)
+		}
+		if _, ok := syslogFacilities[s.Facility]; !ok && s.Facility != "" {
+			return util.Errorf("unknown syslog facility %q", s.Facility)
+		}
+	case SinkHTTP:
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			return util.Errorf("invalid http sink url %q: %s", s.URL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return util.Errorf("http sink url must be http or https, was %q", s.URL)
+		}
+		if s.BatchSize < 0 {
+			return util.Errorf("http sink batch_size must not be negative")
+		}
+	default:
+		return util.Errorf("unknown sink type %q", s.Type)
+	}
+	return nil
+}
+
+// bufferName identifies the buffer of the i-th sink on disk.
+func (s SinkConfig) bufferName(i int) string {
+	return fmt.Sprintf("%d-%s", i, s.Type)
+}
@@ -7,5 +7,11 @@ to the logging end of an executable
 
 A typical use for this package is to attach it to stdout of an executable
 and passing the results into your system's proprietary logging backend.
+
+Pods can also ship their logs with a Shipper. It parses each line as JSON or
+logfmt, attaches the pod's metadata and delivers the resulting records to
+built-in sinks: rotating local files, syslog servers and HTTP endpoints.
+Shipped lines are never dropped when a sink can't keep up; they are buffered
+on disk until they have been delivered.
 */
 package logbridge
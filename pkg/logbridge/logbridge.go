@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"io/ioutil"
 	"time"
 
 	"github.com/rcrowley/go-metrics"
@@ -185,6 +186,31 @@ func (lb *LogBridge) Tee() {
 	lb.LossyCopy(tr, 1<<10)
 }
 
+// Ship copies to DurableWriter like Tee, and writes every line to the
+// shipper. Unlike LossyWriter, the shipper is never skipped: it buffers lines
+// on disk when its sinks can't keep up.
+func (lb *LogBridge) Ship(shipper *Shipper) {
+	tr := io.TeeReader(lb.Reader, lb.DurableWriter)
+
+	scanner := bufio.NewScanner(tr)
+	scanner.Split(scanFullLines)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		err := shipper.Write(line)
+		if err != nil {
+			lb.logger.WithError(err).Errorln("Could not ship log line. Proceeding.")
+			continue
+		}
+		lb.logLinesCount.Inc(1)
+		lb.logBytes.Inc(int64(len(line)))
+	}
+	if err := scanner.Err(); err != nil {
+		lb.logger.WithError(err).Errorln("Encountered error while reading from src. No further lines will be shipped.")
+		// keep feeding the durable writer so that the pod doesn't block
+		_, _ = io.Copy(ioutil.Discard, tr)
+	}
+}
+
 // This is an error wrapper type that may be used to denote an error is retriable
 // RetriableError is exported so clients of this package can express their
 // error semantics to this package
@@ -0,0 +1,331 @@
+package logbridge
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	segmentSuffix  = ".seg"
+	cursorFileName = "cursor"
+
+	maxSegmentBytes = 8 << 20
+	minSegmentBytes = 4 << 10
+)
+
+// position is a location in a diskQueue: an offset in a segment file.
+type position struct {
+	segment uint64
+	offset  int64
+}
+
+func (p position) before(other position) bool {
+	return p.segment < other.segment || (p.segment == other.segment && p.offset < other.offset)
+}
+
+// diskQueue is a queue of encoded records, one per line, that is stored in
+// segment files in a directory so that records survive both outages of the
+// sink that consumes them and restarts of the log bridge. Records are
+// appended to the newest segment, and a segment is deleted once every
+// record in it has been consumed. The position of the consumer is saved in
+// a cursor file.
+//
+// The queue's size is bounded: when it grows past maxBytes, its oldest
+// segments are discarded whether or not they have been consumed.
+type diskQueue struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	// notified whenever a record is appended
+	notify chan struct{}
+
+	mu        sync.Mutex
+	segments  []uint64
+	sizes     map[uint64]int64
+	total     int64
+	writer    *os.File
+	writeSeg  uint64
+	read      position
+	discarded int64
+}
+
+// openDiskQueue opens the queue in dir, creating it if necessary. Records
+// are always appended to a new segment, since the newest segment of a
+// previous process may end with a partially written record.
+func openDiskQueue(dir string, maxBytes int64) (*diskQueue, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, util.Errorf("Could not create log buffer %s: %s", dir, err)
+	}
+
+	segmentBytes := maxBytes / 8
+	if segmentBytes > maxSegmentBytes {
+		segmentBytes = maxSegmentBytes
+	}
+	if segmentBytes < minSegmentBytes {
+		segmentBytes = minSegmentBytes
+	}
+	q := &diskQueue{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: segmentBytes,
+		notify:       make(chan struct{}, 1),
+		sizes:        make(map[uint64]int64),
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, util.Errorf("Could not read log buffer %s: %s", dir, err)
+	}
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(info.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.segments = append(q.segments, id)
+		q.sizes[id] = info.Size()
+		q.total += info.Size()
+	}
+	sort.Sort(segmentIDs(q.segments))
+
+	next := uint64(1)
+	if len(q.segments) > 0 {
+		next = q.segments[len(q.segments)-1] + 1
+	}
+	err = q.startSegment(next)
+	if err != nil {
+		return nil, err
+	}
+
+	q.read, err = q.readCursor()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := q.sizes[q.read.segment]; !ok {
+		// the cursor is missing or refers to a segment that was removed
+		q.read = position{segment: q.nextSegment(q.read.segment)}
+	}
+	return q, nil
+}
+
+func (q *diskQueue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%016d%s", id, segmentSuffix))
+}
+
+func (q *diskQueue) startSegment(id uint64) error {
+	if q.writer != nil {
+		err := q.writer.Close()
+		if err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(q.segmentPath(id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return util.Errorf("Could not create log buffer segment: %s", err)
+	}
+	q.writer = f
+	q.writeSeg = id
+	q.segments = append(q.segments, id)
+	q.sizes[id] = 0
+	return nil
+}
+
+// append adds an encoded record, which must end in a newline, to the queue.
+func (q *diskQueue) append(record []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.sizes[q.writeSeg] >= q.segmentBytes {
+		err := q.startSegment(q.writeSeg + 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := q.writer.Write(record)
+	q.sizes[q.writeSeg] += int64(n)
+	q.total += int64(n)
+	if err != nil {
+		return util.Errorf("Could not write to log buffer: %s", err)
+	}
+
+	for q.total > q.maxBytes && len(q.segments) > 1 {
+		q.discardOldest()
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// discardOldest removes the oldest segment, even if it hasn't been
+// consumed. It must be called with the lock held and never removes the
+// segment being written.
+func (q *diskQueue) discardOldest() {
+	oldest := q.segments[0]
+	if oldest == q.writeSeg {
+		return
+	}
+	_ = os.Remove(q.segmentPath(oldest))
+	if q.read.segment <= oldest {
+		q.discarded += q.sizes[oldest]
+		q.read = position{segment: q.segments[1]}
+	}
+	q.total -= q.sizes[oldest]
+	delete(q.sizes, oldest)
+	q.segments = q.segments[1:]
+}
+
+// takeDiscarded returns the number of unconsumed bytes that were discarded
+// since it was last called.
+func (q *diskQueue) takeDiscarded() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	discarded := q.discarded
+	q.discarded = 0
+	return discarded
+}
+
+// peek returns up to max encoded records following the consumer's position
+// without consuming them, along with the position after the last of them.
+// Pass that position to commit() once the records have been handled.
+func (q *diskQueue) peek(max int) ([][]byte, position, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pos := q.read
+	var records [][]byte
+	for len(records) < max {
+		f, err := os.Open(q.segmentPath(pos.segment))
+		if err != nil {
+			return nil, q.read, util.Errorf("Could not read log buffer segment: %s", err)
+		}
+		_, err = f.Seek(pos.offset, io.SeekStart)
+		if err != nil {
+			_ = f.Close()
+			return nil, q.read, err
+		}
+
+		reader := bufio.NewReader(f)
+		for len(records) < max {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				// a partial line can only be the remnant of a crash,
+				// unless it's still being written to the newest
+				// segment
+				if pos.segment != q.writeSeg {
+					pos.offset += int64(len(line))
+				}
+				break
+			}
+			pos.offset += int64(len(line))
+			records = append(records, line)
+		}
+		_ = f.Close()
+
+		if len(records) >= max || pos.segment == q.writeSeg {
+			break
+		}
+		pos = position{segment: q.nextSegment(pos.segment)}
+	}
+	return records, pos, nil
+}
+
+func (q *diskQueue) nextSegment(id uint64) uint64 {
+	for _, segment := range q.segments {
+		if segment > id {
+			return segment
+		}
+	}
+	return q.writeSeg
+}
+
+// commit marks the records before pos as consumed, deleting the segments
+// that were fully consumed.
+func (q *diskQueue) commit(pos position) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// the records may have been discarded while they were being handled
+	if !q.read.before(pos) {
+		return nil
+	}
+	q.read = pos
+
+	for len(q.segments) > 0 && q.segments[0] < q.read.segment {
+		oldest := q.segments[0]
+		err := os.Remove(q.segmentPath(oldest))
+		if err != nil && !os.IsNotExist(err) {
+			return util.Errorf("Could not remove log buffer segment: %s", err)
+		}
+		q.total -= q.sizes[oldest]
+		delete(q.sizes, oldest)
+		q.segments = q.segments[1:]
+	}
+	return q.writeCursor()
+}
+
+// wait blocks until a record may have been appended, the timeout passes or
+// done is closed.
+func (q *diskQueue) wait(timeout time.Duration, done <-chan struct{}) {
+	select {
+	case <-q.notify:
+	case <-time.After(timeout):
+	case <-done:
+	}
+}
+
+func (q *diskQueue) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.writer.Close()
+}
+
+func (q *diskQueue) readCursor() (position, error) {
+	data, err := ioutil.ReadFile(filepath.Join(q.dir, cursorFileName))
+	if os.IsNotExist(err) {
+		return position{}, nil
+	} else if err != nil {
+		return position{}, util.Errorf("Could not read log buffer cursor: %s", err)
+	}
+
+	var pos position
+	_, err = fmt.Sscanf(string(data), "%d %d", &pos.segment, &pos.offset)
+	if err != nil {
+		// start over rather than refusing to ship logs
+		return position{}, nil
+	}
+	return pos, nil
+}
+
+func (q *diskQueue) writeCursor() error {
+	path := filepath.Join(q.dir, cursorFileName)
+	err := ioutil.WriteFile(path+".tmp", []byte(fmt.Sprintf("%d %d\n", q.read.segment, q.read.offset)), 0644)
+	if err != nil {
+		return util.Errorf("Could not write log buffer cursor: %s", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+type segmentIDs []uint64
+
+func (s segmentIDs) Len() int           { return len(s) }
+func (s segmentIDs) Less(i, j int) bool { return s[i] < s[j] }
+func (s segmentIDs) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,105 @@
+package logbridge
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDiskQueueSurvivesRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk_queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := openDiskQueue(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Could not open queue: %s", err)
+	}
+	for i := 0; i < 5; i++ {
+		err = q.append([]byte(fmt.Sprintf("record %d\n", i)))
+		if err != nil {
+			t.Fatalf("Could not append: %s", err)
+		}
+	}
+
+	records, pos, err := q.peek(2)
+	if err != nil || len(records) != 2 || string(records[0]) != "record 0\n" {
+		t.Fatalf("Expected the first two records, got %q, %v", records, err)
+	}
+	err = q.commit(pos)
+	if err != nil {
+		t.Fatalf("Could not commit: %s", err)
+	}
+	// the third record was read but not committed
+	_, _, err = q.peek(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = q.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = openDiskQueue(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Could not reopen queue: %s", err)
+	}
+	defer q.close()
+	err = q.append([]byte("record 5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, _, err = q.peek(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || string(records[0]) != "record 2\n" || string(records[3]) != "record 5\n" {
+		t.Errorf("Expected uncommitted records to be read after reopening the queue, got %q", records)
+	}
+}
+
+func TestDiskQueueDiscardsOldestWhenFull(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk_queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// segments are at least minSegmentBytes, so this allows ~4 segments
+	q, err := openDiskQueue(dir, 4*minSegmentBytes)
+	if err != nil {
+		t.Fatalf("Could not open queue: %s", err)
+	}
+	defer q.close()
+
+	record := make([]byte, 1024)
+	for i := range record {
+		record[i] = 'x'
+	}
+	record[len(record)-1] = '\n'
+	for i := 0; i < 40; i++ {
+		err = q.append(record)
+		if err != nil {
+			t.Fatalf("Could not append: %s", err)
+		}
+	}
+
+	if q.total > q.maxBytes {
+		t.Errorf("Expected queue to stay within %d bytes, was %d", q.maxBytes, q.total)
+	}
+	if q.takeDiscarded() == 0 {
+		t.Errorf("Expected discarded records to be reported")
+	}
+
+	records, _, err := q.peek(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || len(records) >= 40 {
+		t.Errorf("Expected only the newest records to be left, got %d", len(records))
+	}
+}
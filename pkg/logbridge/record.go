@@ -0,0 +1,200 @@
+package logbridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Metadata identifies where a log line came from. It is attached to every
+// record that is shipped.
+type Metadata struct {
+	Node         string `json:"node,omitempty"`
+	PodID        string `json:"pod_id,omitempty"`
+	PodUniqueKey string `json:"pod_unique_key,omitempty"`
+	LaunchableID string `json:"launchable_id,omitempty"`
+}
+
+// Record is a parsed log line.
+type Record struct {
+	Metadata
+
+	// When the line was read by the log bridge, or the time parsed from
+	// the line if it contained one
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level,omitempty"`
+	Message string    `json:"message"`
+	// Any other fields parsed from a structured line
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Keys of structured lines that are lifted out of Fields into the record
+var (
+	messageKeys = []string{"msg", "message"}
+	levelKeys   = []string{"level", "severity"}
+	timeKeys    = []string{"time", "ts", "timestamp"}
+)
+
+// ParseLine converts a log line into a record according to format, which is
+// one of the Format constants. Lines that can't be parsed in the requested
+// format are shipped as plain messages rather than being dropped.
+func ParseLine(line []byte, format string, metadata Metadata, now time.Time) Record {
+	line = bytes.TrimRight(line, "\r\n")
+	record := Record{
+		Metadata: metadata,
+		Time:     now,
+	}
+
+	var fields map[string]interface{}
+	switch format {
+	case FormatJSON:
+		fields = parseJSON(line)
+	case FormatLogfmt:
+		fields = parseLogfmt(line)
+	case FormatRaw:
+	default:
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 && trimmed[0] == '{' {
+			fields = parseJSON(trimmed)
+		} else {
+			fields = parseLogfmt(line)
+		}
+	}
+
+	if fields == nil {
+		record.Message = toValidUTF8(line)
+		return record
+	}
+
+	record.Message = liftString(fields, messageKeys)
+	record.Level = liftString(fields, levelKeys)
+	for _, key := range timeKeys {
+		s, ok := fields[key].(string)
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err == nil {
+			record.Time = t
+			delete(fields, key)
+			break
+		}
+	}
+	if len(fields) > 0 {
+		record.Fields = fields
+	}
+	return record
+}
+
+// liftString removes the first of keys that has a string value from fields
+// and returns its value.
+func liftString(fields map[string]interface{}, keys []string) string {
+	for _, key := range keys {
+		if s, ok := fields[key].(string); ok {
+			delete(fields, key)
+			return s
+		}
+	}
+	return ""
+}
+
+func parseJSON(line []byte) map[string]interface{} {
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	err := decoder.Decode(&fields)
+	if err != nil || decoder.More() {
+		return nil
+	}
+	return fields
+}
+
+// parseLogfmt parses a line of space separated key=value pairs, where values
+// may be double quoted. It returns nil if any part of the line is not a
+// key=value pair, so that free-form lines that happen to contain an "=" are
+// shipped as they are.
+func parseLogfmt(line []byte) map[string]interface{} {
+	s := toValidUTF8(line)
+	fields := make(map[string]interface{})
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || strings.ContainsAny(s[:eq], " \t\"") {
+			return nil
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := closingQuote(s)
+			if end < 0 {
+				return nil
+			}
+			var err error
+			value, err = unquote(s[:end+1])
+			if err != nil {
+				return nil
+			}
+			s = s[end+1:]
+			if s != "" && s[0] != ' ' && s[0] != '\t' {
+				return nil
+			}
+		} else {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			value = s[:end]
+			if strings.ContainsAny(value, `="`) {
+				return nil
+			}
+			s = s[end:]
+		}
+		fields[key] = value
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// closingQuote returns the index of the quote that closes the quoted string
+// at the start of s, or -1 if it isn't closed.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unquote(quoted string) (string, error) {
+	var s string
+	err := json.Unmarshal([]byte(quoted), &s)
+	return s, err
+}
+
+func toValidUTF8(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	var buf bytes.Buffer
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		buf.WriteRune(r)
+		b = b[size:]
+	}
+	return buf.String()
+}
@@ -0,0 +1,83 @@
+package logbridge
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	metadata := Metadata{Node: "node1", PodID: "web", LaunchableID: "app"}
+
+	type testCase struct {
+		line    string
+		format  string
+		message string
+		level   string
+		time    time.Time
+		fields  map[string]interface{}
+	}
+	for _, testCase := range []testCase{
+		{
+			line:    `{"msg":"started","level":"info","port":8080,"time":"2017-01-01T00:00:00Z"}` + "\n",
+			format:  FormatAuto,
+			message: "started",
+			level:   "info",
+			time:    time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+			fields:  map[string]interface{}{"port": json.Number("8080")},
+		},
+		{
+			line:    `time="not a time" level=warning msg="disk \"data\" is full" disk=data` + "\n",
+			format:  FormatAuto,
+			message: `disk "data" is full`,
+			level:   "warning",
+			time:    now,
+			fields:  map[string]interface{}{"time": "not a time", "disk": "data"},
+		},
+		{
+			line:    "GET /index.html took 5ms, status=200\n",
+			format:  FormatAuto,
+			message: "GET /index.html took 5ms, status=200",
+			time:    now,
+		},
+		{
+			line:    `{"msg":"started"}`,
+			format:  FormatRaw,
+			message: `{"msg":"started"}`,
+			time:    now,
+		},
+		{
+			line:    `level=info msg=started`,
+			format:  FormatJSON,
+			message: `level=info msg=started`,
+			time:    now,
+		},
+		{
+			line:    `msg="unterminated`,
+			format:  FormatLogfmt,
+			message: `msg="unterminated`,
+			time:    now,
+		},
+	} {
+		record := ParseLine([]byte(testCase.line), testCase.format, metadata, now)
+		if record.Metadata != metadata {
+			t.Errorf("%q: expected metadata %+v, got %+v", testCase.line, metadata, record.Metadata)
+		}
+		if record.Message != testCase.message || record.Level != testCase.level {
+			t.Errorf("%q: expected message %q and level %q, got %q and %q", testCase.line, testCase.message, testCase.level, record.Message, record.Level)
+		}
+		if !record.Time.Equal(testCase.time) {
+			t.Errorf("%q: expected time %s, got %s", testCase.line, testCase.time, record.Time)
+		}
+		if len(record.Fields) != len(testCase.fields) {
+			t.Errorf("%q: expected fields %v, got %v", testCase.line, testCase.fields, record.Fields)
+			continue
+		}
+		for key, value := range testCase.fields {
+			if record.Fields[key] != value {
+				t.Errorf("%q: expected field %s to be %v, got %v", testCase.line, key, value, record.Fields[key])
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package logbridge
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// How long a sink whose buffer is empty waits before checking it
+	// again, in case it missed the notification of a new record
+	pollInterval = 1 * time.Second
+
+	minRetryDelay = 1 * time.Second
+	maxRetryDelay = 1 * time.Minute
+)
+
+// Shipper parses log lines into records and delivers them to the sinks in a
+// Config. Each sink has its own buffer on disk that records are appended to
+// when they are written, and that a goroutine drains into the sink,
+// retrying failed sends until they succeed.
+type Shipper struct {
+	format   string
+	metadata Metadata
+	logger   logging.Logger
+
+	sinks []*shipperSink
+
+	// closed to make the sinks return once their buffers are empty
+	draining chan struct{}
+	// closed to make the sinks return immediately
+	stopped chan struct{}
+	wg      sync.WaitGroup
+}
+
+type shipperSink struct {
+	Sink
+	queue     *diskQueue
+	batchSize int
+	logger    logging.Logger
+}
+
+// NewShipper starts shipping the records written to it to the sinks in the
+// config. The sinks' buffers are kept in bufferDir, and records left in them
+// by a previous shipper are shipped first.
+func NewShipper(config Config, metadata Metadata, bufferDir string, logger logging.Logger) (*Shipper, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	format := config.Format
+	if format == "" {
+		format = FormatAuto
+	}
+	bufferBytes := int64(config.Buffer.MaxSizeMB) << 20
+	if bufferBytes == 0 {
+		bufferBytes = DefaultBufferSizeMB << 20
+	}
+
+	s := &Shipper{
+		format:   format,
+		metadata: metadata,
+		logger:   logger,
+		draining: make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	for i, sinkConfig := range config.Sinks {
+		queue, err := openDiskQueue(filepath.Join(bufferDir, sinkConfig.bufferName(i)), bufferBytes)
+		if err != nil {
+			s.closeSinks()
+			return nil, err
+		}
+		sink, err := newSink(sinkConfig)
+		if err != nil {
+			_ = queue.close()
+			s.closeSinks()
+			return nil, util.Errorf("Could not create %s log sink: %s", sinkConfig.Type, err)
+		}
+		s.sinks = append(s.sinks, &shipperSink{
+			Sink:      sink,
+			queue:     queue,
+			batchSize: sinkConfig.batchSize(),
+			logger: logger.SubLogger(logrus.Fields{
+				"sink": sinkConfig.bufferName(i),
+			}),
+		})
+	}
+
+	for _, sink := range s.sinks {
+		s.wg.Add(1)
+		go s.forward(sink)
+	}
+	return s, nil
+}
+
+// Write parses a log line and buffers the resulting record for every sink.
+func (s *Shipper) Write(line []byte) error {
+	record := ParseLine(line, s.format, s.metadata, time.Now())
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	encoded = append(encoded, '\n')
+
+	var errs []error
+	for _, sink := range s.sinks {
+		err = sink.queue.append(encoded)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return util.Errorf("Could not buffer log line for %d sinks: %s", len(errs), errs[0])
+	}
+	return nil
+}
+
+// Close waits up to timeout for the sinks to ship their buffered records,
+// then stops them. Records that weren't shipped stay buffered on disk and are
+// shipped by the next shipper that uses the same buffer directory.
+func (s *Shipper) Close(timeout time.Duration) {
+	close(s.draining)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		close(s.stopped)
+		<-done
+	}
+
+	s.closeSinks()
+}
+
+func (s *Shipper) closeSinks() {
+	for _, sink := range s.sinks {
+		err := sink.Close()
+		if err != nil {
+			sink.logger.WithError(err).Warnln("Could not close log sink")
+		}
+		err = sink.queue.close()
+		if err != nil {
+			sink.logger.WithError(err).Warnln("Could not close log buffer")
+		}
+	}
+}
+
+// forward sends the records in a sink's buffer to the sink until the shipper
+// is closed.
+func (s *Shipper) forward(sink *shipperSink) {
+	defer s.wg.Done()
+
+	retryDelay := minRetryDelay
+	for {
+		if discarded := sink.queue.takeDiscarded(); discarded > 0 {
+			sink.logger.WithField("bytes", discarded).Errorln("Log buffer is full, discarded its oldest records. Consider increasing its size.")
+		}
+
+		encoded, pos, err := sink.queue.peek(sink.batchSize)
+		if err != nil {
+			sink.logger.WithError(err).Errorln("Could not read log buffer")
+			if !s.sleep(retryDelay) {
+				return
+			}
+			continue
+		}
+
+		records := make([]Record, 0, len(encoded))
+		for _, line := range encoded {
+			var record Record
+			err = json.Unmarshal(line, &record)
+			if err != nil {
+				sink.logger.WithError(err).Warnln("Skipping corrupt record in log buffer")
+				continue
+			}
+			records = append(records, record)
+		}
+
+		if len(records) > 0 {
+			err = sink.Send(records)
+			if err != nil {
+				sink.logger.WithError(err).Warnf("Could not ship %d log records, retrying in %s", len(records), retryDelay)
+				if !s.sleep(retryDelay) {
+					return
+				}
+				retryDelay *= 2
+				if retryDelay > maxRetryDelay {
+					retryDelay = maxRetryDelay
+				}
+				continue
+			}
+			retryDelay = minRetryDelay
+		}
+
+		err = sink.queue.commit(pos)
+		if err != nil {
+			sink.logger.WithError(err).Errorln("Could not update log buffer")
+		}
+
+		if len(encoded) < sink.batchSize {
+			select {
+			case <-s.draining:
+				if len(encoded) == 0 {
+					return
+				}
+				continue
+			default:
+			}
+			sink.queue.wait(pollInterval, s.stopped)
+		}
+		select {
+		case <-s.stopped:
+			return
+		default:
+		}
+	}
+}
+
+// sleep waits for d, returning false if the shipper was stopped meanwhile.
+func (s *Shipper) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.stopped:
+		return false
+	}
+}
@@ -0,0 +1,186 @@
+package logbridge
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+func TestShipToHTTPRetriesUntilAccepted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	var received []Record
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		// the first request fails, the records must be sent again
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var records []Record
+		err := json.NewDecoder(r.Body).Decode(&records)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, records...)
+	}))
+	defer server.Close()
+
+	config := Config{Sinks: []SinkConfig{{Type: SinkHTTP, URL: server.URL}}}
+	metadata := Metadata{Node: "node1", PodID: "web", LaunchableID: "app"}
+	shipper, err := NewShipper(config, metadata, dir, logging.TestLogger())
+	if err != nil {
+		t.Fatalf("Could not create shipper: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		err = shipper.Write([]byte(fmt.Sprintf(`{"msg":"line %d"}`+"\n", i)))
+		if err != nil {
+			t.Fatalf("Could not write: %s", err)
+		}
+	}
+	shipper.Close(10 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 records to be shipped, got %d", len(received))
+	}
+	if received[2].Message != "line 2" || received[2].Metadata != metadata {
+		t.Errorf("Unexpected record %+v", received[2])
+	}
+}
+
+func TestShipToRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "pod.log")
+	sink, err := newFileSink(SinkConfig{Type: SinkFile, Path: logPath, MaxFiles: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("Could not create file sink: %s", err)
+	}
+	defer sink.Close()
+	// rotate after every record
+	sink.maxBytes = 1
+
+	for i := 0; i < 4; i++ {
+		err = sink.Send([]Record{{Message: fmt.Sprintf("line %d", i)}})
+		if err != nil {
+			t.Fatalf("Could not send: %s", err)
+		}
+	}
+
+	current, err := ioutil.ReadFile(logPath)
+	if err != nil || !strings.Contains(string(current), "line 3") {
+		t.Errorf("Expected the newest record in %s, got %q, %v", logPath, current, err)
+	}
+	f, err := os.Open(logPath + ".1.gz")
+	if err != nil {
+		t.Fatalf("Expected rotated file to be compressed: %s", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Rotated file was not gzipped: %s", err)
+	}
+	rotated, err := ioutil.ReadAll(gz)
+	if err != nil || !strings.Contains(string(rotated), "line 2") {
+		t.Errorf("Expected the previous record in the newest rotated file, got %q, %v", rotated, err)
+	}
+	if _, err = os.Stat(logPath + ".3.gz"); !os.IsNotExist(err) {
+		t.Errorf("Expected no more than 2 rotated files to be kept")
+	}
+}
+
+func TestShipToSyslogOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var length int
+		_, err = fmt.Fscanf(reader, "%d ", &length)
+		if err != nil {
+			return
+		}
+		message := make([]byte, length)
+		_, err = reader.Read(message)
+		if err != nil {
+			return
+		}
+		messages <- string(message)
+	}()
+
+	sink := newSyslogSink(SinkConfig{Type: SinkSyslog, Network: "tcp", Address: listener.Addr().String(), Facility: "local0"})
+	defer sink.Close()
+	err = sink.Send([]Record{{
+		Metadata: Metadata{Node: "node1", PodID: "web", LaunchableID: "app"},
+		Time:     time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+		Level:    "error",
+		Message:  "it broke",
+		Fields:   map[string]interface{}{"path": `C:\a "b"`},
+	}})
+	if err != nil {
+		t.Fatalf("Could not send: %s", err)
+	}
+
+	select {
+	case message := <-messages:
+		expected := `<131>1 2017-01-02T03:04:05Z node1 web - app [p2@32473 launchable_id="app" node="node1" pod_id="web"][fields@32473 path="C:\\a \"b\""] it broke`
+		if message != expected {
+			t.Errorf("Unexpected syslog message:\n%s\nexpected:\n%s", message, expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Syslog message was not received")
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	for _, invalid := range []Config{
+		{},
+		{Format: "xml", Sinks: []SinkConfig{{Type: SinkFile, Path: "/tmp/log"}}},
+		{Sinks: []SinkConfig{{Type: "kafka"}}},
+		{Sinks: []SinkConfig{{Type: SinkFile}}},
+		{Sinks: []SinkConfig{{Type: SinkSyslog, Address: "logs"}}},
+		{Sinks: []SinkConfig{{Type: SinkSyslog, Address: "logs:514", Facility: "local9"}}},
+		{Sinks: []SinkConfig{{Type: SinkHTTP, URL: "ftp://logs"}}},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Expected an error for invalid config %+v", invalid)
+		}
+	}
+}
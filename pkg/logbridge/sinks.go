@@ -0,0 +1,431 @@
+package logbridge
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	sinkTimeout = 30 * time.Second
+
+	// The structured data IDs of RFC 5424 messages. 32473 is the
+	// enterprise number reserved for documentation by RFC 5612.
+	syslogMetadataID = "p2@32473"
+	syslogFieldsID   = "fields@32473"
+
+	// RFC 5424 allows at most microseconds
+	syslogTimeFormat = "2006-01-02T15:04:05.999999Z07:00"
+)
+
+// A Sink delivers records to their destination. Sends are retried until
+// they succeed, so a sink may deliver some records more than once.
+type Sink interface {
+	Send(records []Record) error
+	Close() error
+}
+
+func newSink(config SinkConfig) (Sink, error) {
+	switch config.Type {
+	case SinkFile:
+		return newFileSink(config)
+	case SinkSyslog:
+		return newSyslogSink(config), nil
+	case SinkHTTP:
+		return newHTTPSink(config), nil
+	}
+	return nil, util.Errorf("unknown sink type %q", config.Type)
+}
+
+// batchSize returns the largest number of records that are sent to the sink
+// at once.
+func (s SinkConfig) batchSize() int {
+	if s.Type == SinkHTTP && s.BatchSize > 0 {
+		return s.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+// fileSink writes records as JSON lines to a file that is rotated when it
+// gets too large. Rotated files are numbered, with the newest being
+// <path>.1, and optionally gzipped.
+type fileSink struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+	compress bool
+
+	file *os.File
+	size int64
+}
+
+func newFileSink(config SinkConfig) (*fileSink, error) {
+	s := &fileSink{
+		path:     config.Path,
+		maxBytes: int64(config.MaxSizeMB) << 20,
+		maxFiles: config.MaxFiles,
+		compress: config.Compress,
+	}
+	if s.maxBytes == 0 {
+		s.maxBytes = DefaultFileSizeMB << 20
+	}
+	if s.maxFiles == 0 {
+		s.maxFiles = DefaultFileCount
+	}
+	return s, s.open()
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return util.Errorf("Could not open log file: %s", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *fileSink) Send(records []Record) error {
+	if s.file == nil {
+		err := s.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+		if s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+			err = s.rotate()
+			if err != nil {
+				return err
+			}
+		}
+		n, err := s.file.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return util.Errorf("Could not write to log file: %s", err)
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) rotatedPath(i int) string {
+	path := fmt.Sprintf("%s.%d", s.path, i)
+	if s.compress {
+		path += ".gz"
+	}
+	return path
+}
+
+func (s *fileSink) rotate() error {
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(s.rotatedPath(s.maxFiles))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		err = os.Rename(s.rotatedPath(i), s.rotatedPath(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if s.compress {
+		err = gzipFile(s.path, s.rotatedPath(1))
+	} else {
+		err = os.Rename(s.path, s.rotatedPath(1))
+	}
+	if err != nil {
+		return util.Errorf("Could not rotate log file: %s", err)
+	}
+	return s.open()
+}
+
+// gzipFile compresses src into dst and removes src.
+func gzipFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	err = os.Rename(tmp, dst)
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func (s *fileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// Facility names of RFC 5424
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// Severities of RFC 5424 by the level names used by common loggers
+var syslogSeverities = map[string]int{
+	"panic":    0,
+	"emerg":    0,
+	"alert":    1,
+	"fatal":    2,
+	"crit":     2,
+	"critical": 2,
+	"error":    3,
+	"err":      3,
+	"warn":     4,
+	"warning":  4,
+	"notice":   5,
+	"info":     6,
+	"debug":    7,
+	"trace":    7,
+}
+
+// syslogSink sends records as RFC 5424 messages. Over TCP, messages are
+// framed with octet counting as described in RFC 6587.
+type syslogSink struct {
+	network  string
+	address  string
+	facility int
+
+	conn net.Conn
+}
+
+func newSyslogSink(config SinkConfig) *syslogSink {
+	network := config.Network
+	if network == "" {
+		network = DefaultSyslogNetwork
+	}
+	facility := config.Facility
+	if facility == "" {
+		facility = DefaultFacility
+	}
+	return &syslogSink{
+		network:  network,
+		address:  config.Address,
+		facility: syslogFacilities[facility],
+	}
+}
+
+func (s *syslogSink) Send(records []Record) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, sinkTimeout)
+		if err != nil {
+			return util.Errorf("Could not connect to syslog server %s: %s", s.address, err)
+		}
+		s.conn = conn
+	}
+
+	for _, record := range records {
+		message := formatSyslog(record, s.facility)
+		if s.network == "tcp" {
+			message = fmt.Sprintf("%d %s", len(message), message)
+		}
+
+		_ = s.conn.SetWriteDeadline(time.Now().Add(sinkTimeout))
+		_, err := io.WriteString(s.conn, message)
+		if err != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+			return util.Errorf("Could not send to syslog server %s: %s", s.address, err)
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// formatSyslog formats a record as an RFC 5424 message. The pod is the
+// APP-NAME and the launchable the MSGID, and all of the record's metadata
+// and fields are included as structured data.
+func formatSyslog(record Record, facility int) string {
+	severity, ok := syslogSeverities[strings.ToLower(record.Level)]
+	if !ok {
+		severity = syslogSeverities["info"]
+	}
+
+	var sd bytes.Buffer
+	writeSDElement(&sd, syslogMetadataID, map[string]interface{}{
+		"node":           record.Node,
+		"pod_id":         record.PodID,
+		"pod_unique_key": record.PodUniqueKey,
+		"launchable_id":  record.LaunchableID,
+	})
+	writeSDElement(&sd, syslogFieldsID, record.Fields)
+	if sd.Len() == 0 {
+		sd.WriteString("-")
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s - %s %s %s",
+		facility*8+severity,
+		record.Time.UTC().Format(syslogTimeFormat),
+		syslogHeaderField(record.Node, 255),
+		syslogHeaderField(record.PodID, 48),
+		syslogHeaderField(record.LaunchableID, 32),
+		sd.String(),
+		record.Message,
+	)
+}
+
+// writeSDElement writes an SD-ELEMENT with the non-empty params. Param names
+// that aren't allowed by RFC 5424 are skipped.
+func writeSDElement(buf *bytes.Buffer, id string, params map[string]interface{}) {
+	names := make([]string, 0, len(params))
+	for name, value := range params {
+		if fmt.Sprint(value) != "" && validSDName(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	buf.WriteString("[" + id)
+	for _, name := range names {
+		value := fmt.Sprint(params[name])
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+		fmt.Fprintf(buf, ` %s="%s"`, name, value)
+	}
+	buf.WriteString("]")
+}
+
+func validSDName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			return false
+		}
+	}
+	return true
+}
+
+// syslogHeaderField returns the value as it may appear in a header field:
+// printable ASCII without spaces, at most max characters, or "-" if empty.
+func syslogHeaderField(value string, max int) string {
+	value = strings.Map(func(c rune) rune {
+		if c <= ' ' || c > '~' {
+			return '_'
+		}
+		return c
+	}, value)
+	if len(value) > max {
+		value = value[:max]
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// httpSink POSTs batches of records as JSON arrays.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPSink(config SinkConfig) *httpSink {
+	return &httpSink{
+		url:    config.URL,
+		client: &http.Client{Timeout: sinkTimeout},
+	}
+}
+
+func (s *httpSink) Send(records []Record) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return util.Errorf("Could not send logs to %s: %s", s.url, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return util.Errorf("Could not send logs to %s: %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
@@ -0,0 +1,184 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/square/p2/pkg/launch"
+)
+
+// FieldChange is one difference between two manifests found by Diff. Old is
+// empty for fields that were added and New is empty for fields that were
+// removed.
+type FieldChange struct {
+	// The dotted path of the field, e.g. "launchables.app.version" or
+	// "config.database.host"
+	Field string
+	Old   string
+	New   string
+}
+
+func (c FieldChange) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("+ %s: %s", c.Field, c.New)
+	case c.New == "":
+		return fmt.Sprintf("- %s: %s", c.Field, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Field, c.Old, c.New)
+}
+
+// Diff returns the differences between two manifests in the fields that matter
+// when reviewing an update: the launchables with their versions, cgroups and
+// env, the config, the config maps and the user the pod runs as. Other
+// differences are reported as a single change to the "manifest" field holding
+// the SHAs. Either manifest may be nil, e.g. when a pod is first scheduled.
+func Diff(old Manifest, new Manifest) []FieldChange {
+	if old == nil {
+		old = NewBuilder().GetManifest()
+	}
+	if new == nil {
+		new = NewBuilder().GetManifest()
+	}
+
+	var changes []FieldChange
+	add := func(field string, oldValue string, newValue string) {
+		if oldValue != newValue {
+			changes = append(changes, FieldChange{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+
+	if old.ID() != new.ID() {
+		add("id", old.ID().String(), new.ID().String())
+	}
+	add("run_as", old.RunAsUser(), new.RunAsUser())
+
+	oldLaunchables := old.GetLaunchableStanzas()
+	newLaunchables := new.GetLaunchableStanzas()
+	for _, id := range launchableIDs(oldLaunchables, newLaunchables) {
+		field := "launchables." + id.String()
+		oldStanza, inOld := oldLaunchables[id]
+		newStanza, inNew := newLaunchables[id]
+		switch {
+		case !inOld:
+			add(field, "", stanzaVersion(newStanza))
+			continue
+		case !inNew:
+			add(field, stanzaVersion(oldStanza), "")
+			continue
+		}
+		add(field+".version", stanzaVersion(oldStanza), stanzaVersion(newStanza))
+		add(field+".cgroup.cpus", cpus(oldStanza), cpus(newStanza))
+		add(field+".cgroup.memory", memory(oldStanza), memory(newStanza))
+		oldEnv := make(map[interface{}]interface{}, len(oldStanza.Env))
+		for key, value := range oldStanza.Env {
+			oldEnv[key] = value
+		}
+		newEnv := make(map[interface{}]interface{}, len(newStanza.Env))
+		for key, value := range newStanza.Env {
+			newEnv[key] = value
+		}
+		changes = append(changes, diffValues(field+".env", oldEnv, newEnv)...)
+	}
+
+	changes = append(changes, diffValues("config", old.GetConfig(), new.GetConfig())...)
+	add("config_maps", configMapsString(old.GetConfigMaps()), configMapsString(new.GetConfigMaps()))
+
+	if len(changes) == 0 {
+		oldSHA, _ := old.SHA()
+		newSHA, _ := new.SHA()
+		add("manifest", oldSHA, newSHA)
+	}
+	return changes
+}
+
+func launchableIDs(a, b map[launch.LaunchableID]launch.LaunchableStanza) []launch.LaunchableID {
+	seen := make(map[launch.LaunchableID]bool)
+	var names []string
+	for _, stanzas := range []map[launch.LaunchableID]launch.LaunchableStanza{a, b} {
+		for id := range stanzas {
+			if !seen[id] {
+				seen[id] = true
+				names = append(names, id.String())
+			}
+		}
+	}
+	sort.Strings(names)
+	ids := make([]launch.LaunchableID, len(names))
+	for i, name := range names {
+		ids[i] = launch.LaunchableID(name)
+	}
+	return ids
+}
+
+// stanzaVersion returns the launchable's version, or its location if a version
+// can't be determined from it
+func stanzaVersion(stanza launch.LaunchableStanza) string {
+	version, err := stanza.LaunchableVersion()
+	if err != nil || version == "" {
+		return stanza.Location
+	}
+	return version.String()
+}
+
+func cpus(stanza launch.LaunchableStanza) string {
+	if stanza.CgroupConfig.CPUs == 0 {
+		return ""
+	}
+	return fmt.Sprint(stanza.CgroupConfig.CPUs)
+}
+
+func memory(stanza launch.LaunchableStanza) string {
+	if stanza.CgroupConfig.Memory == 0 {
+		return ""
+	}
+	return stanza.CgroupConfig.Memory.String()
+}
+
+func configMapsString(refs []ConfigMapRef) string {
+	if len(refs) == 0 {
+		return ""
+	}
+	return fmt.Sprint(refs)
+}
+
+// diffValues compares two YAML values, descending into maps so that changes
+// are reported per key
+func diffValues(field string, old interface{}, new interface{}) []FieldChange {
+	oldMap, oldIsMap := old.(map[interface{}]interface{})
+	newMap, newIsMap := new.(map[interface{}]interface{})
+	if oldIsMap && newIsMap || (old == nil && newIsMap) || (oldIsMap && new == nil) {
+		keys := make([]string, 0, len(oldMap)+len(newMap))
+		byName := make(map[string]interface{})
+		for _, m := range []map[interface{}]interface{}{oldMap, newMap} {
+			for key := range m {
+				name := fmt.Sprint(key)
+				if _, ok := byName[name]; !ok {
+					byName[name] = key
+					keys = append(keys, name)
+				}
+			}
+		}
+		sort.Strings(keys)
+		var changes []FieldChange
+		for _, name := range keys {
+			key := byName[name]
+			changes = append(changes, diffValues(field+"."+name, oldMap[key], newMap[key])...)
+		}
+		return changes
+	}
+
+	oldString := valueString(old)
+	newString := valueString(new)
+	if oldString == newString {
+		return nil
+	}
+	return []FieldChange{{Field: field, Old: oldString, New: newString}}
+}
+
+func valueString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
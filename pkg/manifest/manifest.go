@@ -13,8 +13,10 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"regexp"
 
 	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logbridge"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
@@ -29,6 +31,70 @@ type StatusStanza struct {
 	LocalhostOnly bool   `yaml:"localhost_only,omitempty"`
 }
 
+// SecretStanza references a secret that the preparer fetches from its secret
+// provider and writes into the pod's secrets directory, whose path is in the
+// pod's SECRETS_PATH environment variable. Manifests only name secrets, their
+// values are never part of a manifest.
+type SecretStanza struct {
+	// The name of the secret at the provider, e.g. "db/password"
+	Name string `yaml:"name"`
+
+	// The name of the file holding the secret in the secrets directory.
+	// Defaults to the last element of Name
+	File string `yaml:"file,omitempty"`
+}
+
+// FileName returns the name of the file the secret is written to
+func (s SecretStanza) FileName() string {
+	if s.File != "" {
+		return s.File
+	}
+	return path.Base(s.Name)
+}
+
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*(/[A-Za-z0-9_-][A-Za-z0-9_.-]*)*$`)
+var secretFilePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// ValidSecretName returns whether a manifest may reference a secret by name.
+// Names are slash-separated elements that don't start with a dot, so they can
+// safely be used as paths
+func ValidSecretName(name string) bool {
+	return secretNamePattern.MatchString(name)
+}
+
+// ConfigMapRef references a config map, a named and versioned piece of config
+// stored in consul that many manifests can share. The preparer merges the
+// config maps a manifest references into the config file at CONFIG_PATH when
+// it installs the pod.
+type ConfigMapRef struct {
+	// The name of the config map, e.g. "db-endpoints"
+	Name string `yaml:"name"`
+
+	// The SHA of the version to use. If empty, the version that is current
+	// when the pod is installed is used
+	SHA string `yaml:"sha,omitempty"`
+
+	// The config key to nest the config map's contents under. If empty, the
+	// config map's top level keys are merged into the config. Either way,
+	// the manifest's own config takes precedence
+	Key string `yaml:"key,omitempty"`
+
+	// If set, replication controllers and daemon sets whose manifests
+	// reference the config map are updated to its current SHA whenever it
+	// changes, replication controllers through a rolling update. Signed
+	// manifests are never updated, since that would discard their
+	// signature (see configmap.Follower)
+	Follow bool `yaml:"follow,omitempty"`
+}
+
+var configMapNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// ValidConfigMapName returns whether a config map may be stored and
+// referenced under a name
+func ValidConfigMapName(name string) bool {
+	return configMapNamePattern.MatchString(name)
+}
+
 type Builder interface {
 	GetManifest() Manifest
 	SetID(types.PodID)
@@ -38,6 +104,8 @@ type Builder interface {
 	SetStatusPath(statusPath string)
 	SetStatusPort(port int)
 	SetLaunchables(launchableStanzas map[launch.LaunchableID]launch.LaunchableStanza)
+	SetSecrets(secrets []SecretStanza)
+	SetConfigMaps(configMaps []ConfigMapRef)
 }
 
 var _ Builder = builder{}
@@ -71,6 +139,9 @@ type Manifest interface {
 	GetStatusPath() string
 	GetStatusPort() int
 	GetStatusLocalhostOnly() bool
+	GetLogShipping() *logbridge.Config
+	GetSecrets() []SecretStanza
+	GetConfigMaps() []ConfigMapRef
 	Marshal() ([]byte, error)
 	SignatureData() (plaintext, signature []byte)
 
@@ -88,6 +159,9 @@ type manifest struct {
 	StatusPort        int                                             `yaml:"status_port,omitempty"`
 	StatusHTTP        bool                                            `yaml:"status_http,omitempty"`
 	Status            StatusStanza                                    `yaml:"status,omitempty"`
+	LogShipping       *logbridge.Config                               `yaml:"log_shipping,omitempty"`
+	Secrets           []SecretStanza                                  `yaml:"secrets,omitempty"`
+	ConfigMaps        []ConfigMapRef                                  `yaml:"config_maps,omitempty"`
 
 	// Used to track the original bytes so that we don't reorder them when
 	// doing a yaml.Unmarshal and a yaml.Marshal in succession
@@ -210,6 +284,31 @@ func (manifest *manifest) SetStatusLocalhostOnly(localhostOnly bool) {
 	manifest.Status.LocalhostOnly = localhostOnly
 }
 
+// GetLogShipping returns how the pod's logs are shipped by the log bridge,
+// or nil if they aren't.
+func (manifest *manifest) GetLogShipping() *logbridge.Config {
+	return manifest.LogShipping
+}
+
+// GetSecrets returns the secrets the pod references
+func (manifest *manifest) GetSecrets() []SecretStanza {
+	return manifest.Secrets
+}
+
+func (manifest *manifest) SetSecrets(secrets []SecretStanza) {
+	manifest.Secrets = secrets
+}
+
+// GetConfigMaps returns the config maps the pod references, in the order
+// they are merged into its config
+func (manifest *manifest) GetConfigMaps() []ConfigMapRef {
+	return manifest.ConfigMaps
+}
+
+func (manifest *manifest) SetConfigMaps(configMaps []ConfigMapRef) {
+	manifest.ConfigMaps = configMaps
+}
+
 func (manifest *manifest) RunAsUser() string {
 	if manifest.RunAs != "" {
 		return manifest.RunAs
@@ -406,7 +505,103 @@ func ValidManifest(m Manifest) error {
 			return fmt.Errorf("'%s': launchable must contain a 'location' or 'version'", launchableID)
 		case stanza.Location != "" && stanza.Version.ID != "":
 			return fmt.Errorf("'%s': launchable must not contain both 'location' and 'version'", launchableID)
+		case !stanza.Role().Valid():
+			return fmt.Errorf("'%s': unknown role '%s'", launchableID, stanza.Role())
+		case !stanza.RestartPolicy().Valid():
+			return fmt.Errorf("'%s': unknown restart_policy '%s'", launchableID, stanza.RestartPolicy())
+		}
+		if _, err := stanza.GetShutdown(); err != nil {
+			return fmt.Errorf("'%s': %s", launchableID, err)
+		}
+		if _, err := stanza.GetReloadSignal(); err != nil {
+			return fmt.Errorf("'%s': %s", launchableID, err)
+		}
+		if _, err := stanza.RestartBackoff(); err != nil {
+			return fmt.Errorf("'%s': %s", launchableID, err)
+		}
+		if stanza.Role() == launch.RoleInit {
+			if _, err := stanza.GetInitTimeout(); err != nil {
+				return fmt.Errorf("'%s': %s", launchableID, err)
+			}
+		}
+	}
+	if _, err := launch.StartOrder(m.GetLaunchableStanzas()); err != nil {
+		return err
+	}
+	if _, err := launch.StopOrder(m.GetLaunchableStanzas()); err != nil {
+		return err
+	}
+	if logShipping := m.GetLogShipping(); logShipping != nil {
+		if err := logShipping.Validate(); err != nil {
+			return fmt.Errorf("invalid log_shipping: %s", err)
 		}
 	}
+	secretFiles := make(map[string]bool)
+	for _, secret := range m.GetSecrets() {
+		switch {
+		case !ValidSecretName(secret.Name):
+			return fmt.Errorf("invalid secret name '%s'", secret.Name)
+		case !secretFilePattern.MatchString(secret.FileName()):
+			return fmt.Errorf("secret '%s': invalid file name '%s'", secret.Name, secret.FileName())
+		case secretFiles[secret.FileName()]:
+			return fmt.Errorf("secret '%s': file '%s' is used by more than one secret", secret.Name, secret.FileName())
+		}
+		secretFiles[secret.FileName()] = true
+	}
+	configMaps := make(map[string]bool)
+	for _, ref := range m.GetConfigMaps() {
+		switch {
+		case !ValidConfigMapName(ref.Name):
+			return fmt.Errorf("invalid config map name '%s'", ref.Name)
+		case configMaps[ref.Name]:
+			return fmt.Errorf("config map '%s' is referenced more than once", ref.Name)
+		}
+		configMaps[ref.Name] = true
+	}
 	return nil
 }
+
+// OnlyConfigChanged returns true if the two manifests are for the same pod and
+// differ in their config, the config maps they reference or the env of their
+// launchables but nothing else, so that the pod's launchables don't need to
+// change to go from one to the other.
+func OnlyConfigChanged(old Manifest, new Manifest) bool {
+	if old == nil || new == nil || old.ID() != new.ID() {
+		return false
+	}
+	oldSHA, err := old.SHA()
+	if err != nil {
+		return false
+	}
+	newSHA, err := new.SHA()
+	if err != nil || oldSHA == newSHA {
+		return false
+	}
+
+	oldSHA, err = shaWithoutConfig(old)
+	if err != nil {
+		return false
+	}
+	newSHA, err = shaWithoutConfig(new)
+	return err == nil && oldSHA == newSHA
+}
+
+// shaWithoutConfig returns the SHA of the manifest with its config, config
+// maps and the env of its launchables removed
+func shaWithoutConfig(m Manifest) (string, error) {
+	builder := m.GetBuilder()
+	err := builder.SetConfig(nil)
+	if err != nil {
+		return "", err
+	}
+	builder.SetConfigMaps(nil)
+	// the builder shares the stanzas with m, so they are copied rather
+	// than modified
+	stanzas := make(map[launch.LaunchableID]launch.LaunchableStanza)
+	for launchableID, stanza := range m.GetLaunchableStanzas() {
+		stanza.Env = nil
+		stanzas[launchableID] = stanza
+	}
+	builder.SetLaunchables(stanzas)
+	return builder.GetManifest().SHA()
+}
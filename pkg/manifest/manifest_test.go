@@ -5,10 +5,13 @@ import (
 	"errors"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/square/p2/pkg/cgroups"
 	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logbridge"
+	"github.com/square/p2/pkg/runit"
 	"github.com/square/p2/pkg/util/size"
 
 	. "github.com/anthonybishopric/gotcha"
@@ -131,6 +134,137 @@ func TestPodManifestCanWriteItsConfigStanzaSeparately(t *testing.T) {
 	Assert(t).AreEqual(buff.String(), expected, "config should have been written")
 }
 
+func TestLaunchableOrderingIsValidated(t *testing.T) {
+	config := `id: ordered
+launchables:
+  migrate:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/migrate_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+    role: init
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/app_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+    starts_after: [migrate]
+`
+	manifest, err := FromBytes([]byte(config))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(launch.RoleInit, manifest.GetLaunchableStanzas()["migrate"].Role(), "should have parsed the launchable's role")
+
+	_, err = FromBytes([]byte(config + "    stop_before: [migrate]\n"))
+	Assert(t).IsNotNil(err, "should have rejected stopping before an init launchable")
+
+	_, err = FromBytes([]byte(strings.Replace(config, "role: init", "role: janitor", 1)))
+	Assert(t).IsNotNil(err, "should have rejected an unknown role")
+}
+
+func TestRestartPolicyIsValidated(t *testing.T) {
+	config := `id: restarted
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/app_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+    restart_policy: on-failure
+`
+	manifest, err := FromBytes([]byte(config))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(runit.RestartPolicyOnFailure, manifest.GetLaunchableStanzas()["app"].RestartPolicy(), "should have parsed the restart policy")
+
+	_, err = FromBytes([]byte(strings.Replace(config, "on-failure", "onfailure", 1)))
+	Assert(t).IsNotNil(err, "should have rejected a misspelled restart policy")
+}
+
+func TestRestartBackoffIsValidated(t *testing.T) {
+	config := `id: backed_off
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/app_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+    restart_backoff:
+      initial: 2s
+      max: 1m
+`
+	_, err := FromBytes([]byte(config))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+
+	_, err = FromBytes([]byte(strings.Replace(config, "initial: 2s", "initial: soon", 1)))
+	Assert(t).IsNotNil(err, "should have rejected an unparseable duration")
+
+	_, err = FromBytes([]byte(strings.Replace(config, "initial: 2s", "initial: 2m", 1)))
+	Assert(t).IsNotNil(err, "should have rejected a max shorter than the initial delay")
+}
+
+func TestLogShippingIsValidated(t *testing.T) {
+	config := `id: shipped
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/app_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+log_shipping:
+  format: json
+  sinks:
+  - type: http
+    url: https://logs.example.com/ingest
+`
+	manifest, err := FromBytes([]byte(config))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(logbridge.FormatJSON, manifest.GetLogShipping().Format, "should have parsed the log shipping config")
+
+	_, err = FromBytes([]byte(strings.Replace(config, "type: http", "type: kafka", 1)))
+	Assert(t).IsNotNil(err, "should have rejected an unknown sink type")
+}
+
+func TestSecretsAreValidated(t *testing.T) {
+	config := `id: secretive
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/app_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+secrets:
+- name: db/password
+- name: api_key
+  file: key.txt
+`
+	manifest, err := FromBytes([]byte(config))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	secrets := manifest.GetSecrets()
+	Assert(t).AreEqual(len(secrets), 2, "should have parsed the secrets")
+	Assert(t).AreEqual(secrets[0].FileName(), "password", "should have defaulted the file name to the last element of the secret name")
+	Assert(t).AreEqual(secrets[1].FileName(), "key.txt", "should have used the given file name")
+
+	_, err = FromBytes([]byte(strings.Replace(config, "file: key.txt", "file: ../key.txt", 1)))
+	Assert(t).IsNotNil(err, "should have rejected a file outside the secrets directory")
+	_, err = FromBytes([]byte(strings.Replace(config, "file: key.txt", "file: password", 1)))
+	Assert(t).IsNotNil(err, "should have rejected two secrets sharing a file")
+	_, err = FromBytes([]byte(strings.Replace(config, "name: db/password", "name: ../password", 1)))
+	Assert(t).IsNotNil(err, "should have rejected an invalid secret name")
+}
+
+func TestConfigMapsAreValidated(t *testing.T) {
+	config := `id: configured
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/app_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+config_maps:
+- name: db-endpoints
+  sha: abc123
+  follow: true
+- name: flags
+  key: feature_flags
+`
+	manifest, err := FromBytes([]byte(config))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	refs := manifest.GetConfigMaps()
+	Assert(t).AreEqual(len(refs), 2, "should have parsed the config map references")
+	Assert(t).AreEqual(refs[0], ConfigMapRef{Name: "db-endpoints", SHA: "abc123", Follow: true}, "wrong config map reference")
+	Assert(t).AreEqual(refs[1].Key, "feature_flags", "should have parsed the key")
+
+	_, err = FromBytes([]byte(strings.Replace(config, "name: flags", "name: db-endpoints", 1)))
+	Assert(t).IsNotNil(err, "should have rejected a config map referenced twice")
+	_, err = FromBytes([]byte(strings.Replace(config, "name: flags", "name: ../flags", 1)))
+	Assert(t).IsNotNil(err, "should have rejected an invalid config map name")
+}
+
 func TestPodManifestCanReportItsSHA(t *testing.T) {
 	config := testPodOldStatus()
 	manifest, err := FromBytes([]byte(config))
@@ -339,3 +473,77 @@ func TestSetConfigCopies(t *testing.T) {
 	config["foo"] = "baz"
 	Assert(t).AreEqual(manifestConfig["foo"], "bar", "Config values shouldn't have changed when mutating the original input due to deep copy")
 }
+
+func TestOnlyConfigChanged(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("web")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {LaunchableType: "hoist", Location: "https://localhost/app_abc.tar.gz"},
+	})
+	err := builder.SetConfig(map[interface{}]interface{}{"port": 8080})
+	Assert(t).IsNil(err, "Should not have errored setting config")
+	old := builder.GetManifest()
+
+	Assert(t).IsFalse(OnlyConfigChanged(old, old), "Identical manifests shouldn't be a config change")
+
+	builder = old.GetBuilder()
+	err = builder.SetConfig(map[interface{}]interface{}{"port": 8081})
+	Assert(t).IsNil(err, "Should not have errored setting config")
+	Assert(t).IsTrue(OnlyConfigChanged(old, builder.GetManifest()), "Expected a config change")
+
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {LaunchableType: "hoist", Location: "https://localhost/app_def.tar.gz"},
+	})
+	Assert(t).IsFalse(OnlyConfigChanged(old, builder.GetManifest()), "A changed launchable isn't only a config change")
+
+	builder = old.GetBuilder()
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {LaunchableType: "hoist", Location: "https://localhost/app_abc.tar.gz", Env: map[string]string{"DEBUG": "1"}},
+	})
+	Assert(t).IsTrue(OnlyConfigChanged(old, builder.GetManifest()), "Expected a changed env to be a config change")
+	Assert(t).AreEqual(len(old.GetLaunchableStanzas()["app"].Env), 0, "Comparing manifests should not modify them")
+
+	builder = old.GetBuilder()
+	builder.SetConfigMaps([]ConfigMapRef{{Name: "db-endpoints", SHA: "abc123"}})
+	Assert(t).IsTrue(OnlyConfigChanged(old, builder.GetManifest()), "Expected a changed config map reference to be a config change")
+
+	builder = old.GetBuilder()
+	builder.SetID("api")
+	err = builder.SetConfig(map[interface{}]interface{}{"port": 8081})
+	Assert(t).IsNil(err, "Should not have errored setting config")
+	Assert(t).IsFalse(OnlyConfigChanged(old, builder.GetManifest()), "Manifests of different pods aren't a config change")
+}
+
+func TestDiff(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("web")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {LaunchableType: "hoist", Location: "https://localhost/app_abc123.tar.gz", Version: launch.LaunchableVersion{ID: "abc123"}},
+		"old": {LaunchableType: "hoist", Location: "https://localhost/old_abc123.tar.gz", Version: launch.LaunchableVersion{ID: "abc123"}},
+	})
+	err := builder.SetConfig(map[interface{}]interface{}{"port": 8080, "db": map[interface{}]interface{}{"host": "a"}})
+	Assert(t).IsNil(err, "Should not have errored setting config")
+	old := builder.GetManifest()
+
+	Assert(t).AreEqual(len(Diff(old, old)), 0, "Identical manifests shouldn't differ")
+
+	builder = old.GetBuilder()
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {LaunchableType: "hoist", Location: "https://localhost/app_def456.tar.gz", Version: launch.LaunchableVersion{ID: "def456"}, CgroupConfig: cgroups.Config{CPUs: 2}},
+	})
+	err = builder.SetConfig(map[interface{}]interface{}{"port": 8080, "db": map[interface{}]interface{}{"host": "b"}})
+	Assert(t).IsNil(err, "Should not have errored setting config")
+	changes := Diff(old, builder.GetManifest())
+
+	var printed []string
+	for _, change := range changes {
+		printed = append(printed, change.String())
+	}
+	expected := []string{
+		"~ launchables.app.version: abc123 -> def456",
+		"+ launchables.app.cgroup.cpus: 2",
+		"- launchables.old: abc123",
+		"~ config.db.host: a -> b",
+	}
+	Assert(t).AreEqual(strings.Join(printed, "\n"), strings.Join(expected, "\n"), "Wrong changes")
+}
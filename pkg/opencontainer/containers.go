@@ -19,6 +19,7 @@ import (
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/p2exec"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/supervisor"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/user"
 	"github.com/square/p2/pkg/util"
@@ -45,6 +46,7 @@ type Launchable struct {
 	P2Exec          string              // The path to p2-exec
 	RestartTimeout  time.Duration       // How long to wait when restarting the services in this launchable.
 	RestartPolicy_  runit.RestartPolicy // Dictates whether the container should be automatically restarted upon exit.
+	RestartBackoff_ *runit.Backoff      // If set, delays and limits restarts after failures.
 	CgroupConfig    cgroups.Config      // Cgroup parameters to use with p2-exec
 	SuppliedEnvVars map[string]string   // User-supplied env variables
 
@@ -109,8 +111,8 @@ func (l *Launchable) InstallDir() string {
 	return filepath.Join(l.RootDir, "installs", launchableName)
 }
 
-// Executables gets a list of the runit services that will be built for this launchable.
-func (l *Launchable) Executables(serviceBuilder *runit.ServiceBuilder) ([]launch.Executable, error) {
+// Executables gets a list of the services that will be built for this launchable.
+func (l *Launchable) Executables(supervisor supervisor.Supervisor) ([]launch.Executable, error) {
 	if !l.Installed() {
 		return []launch.Executable{}, util.Errorf("%s is not installed", l.ServiceID_)
 	}
@@ -146,10 +148,7 @@ func (l *Launchable) Executables(serviceBuilder *runit.ServiceBuilder) ([]launch
 
 	serviceName := l.ServiceID_ + "__container"
 	return []launch.Executable{{
-		Service: runit.Service{
-			Path: filepath.Join(serviceBuilder.RunitRoot, serviceName),
-			Name: serviceName,
-		},
+		Service: supervisor.Service(serviceName),
 		Exec: append(
 			[]string{l.P2Exec},
 			p2exec.P2ExecArgs{ // TODO: support environment variables
@@ -230,8 +229,8 @@ func (l *Launchable) makeLast() error {
 }
 
 // Launch allows the launchable to begin execution.
-func (l *Launchable) Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
-	err := l.start(serviceBuilder, sv)
+func (l *Launchable) Launch(supervisor supervisor.Supervisor) error {
+	err := l.start(supervisor)
 	if err != nil {
 		return launch.StartError{Inner: err}
 	}
@@ -239,18 +238,18 @@ func (l *Launchable) Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) e
 	return nil
 }
 
-func (l *Launchable) start(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
-	executables, err := l.Executables(serviceBuilder)
+func (l *Launchable) start(supervisor supervisor.Supervisor) error {
+	executables, err := l.Executables(supervisor)
 	if err != nil {
 		return err
 	}
 
 	for _, executable := range executables {
 		var err error
-		if l.RestartPolicy_ == runit.RestartPolicyAlways {
-			_, err = sv.Restart(&executable.Service, l.RestartTimeout)
+		if l.RestartPolicy_.Restarts() {
+			_, err = supervisor.Restart(&executable.Service, l.RestartTimeout)
 		} else {
-			_, err = sv.Once(&executable.Service)
+			_, err = supervisor.Once(&executable.Service)
 		}
 		if err != nil && err != runit.SuperviseOkMissing {
 			return err
@@ -260,14 +259,14 @@ func (l *Launchable) start(serviceBuilder *runit.ServiceBuilder, sv runit.SV) er
 	return nil
 }
 
-func (l *Launchable) stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
-	executables, err := l.Executables(serviceBuilder)
+func (l *Launchable) stop(supervisor supervisor.Supervisor) error {
+	executables, err := l.Executables(supervisor)
 	if err != nil {
 		return err
 	}
 
 	for _, executable := range executables {
-		_, err := sv.Stop(&executable.Service, l.RestartTimeout)
+		_, err := supervisor.Stop(&executable.Service, l.RestartTimeout)
 		if err != nil {
 			cmd := exec.Command(
 				l.P2Exec,
@@ -291,8 +290,8 @@ func (l *Launchable) Disable() error {
 }
 
 // Halt causes the launchable to halt execution if it is running.
-func (l *Launchable) Stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
-	err := l.stop(serviceBuilder, sv)
+func (l *Launchable) Stop(supervisor supervisor.Supervisor) error {
+	err := l.stop(supervisor)
 	if err != nil {
 		return launch.StopError{Inner: err}
 	}
@@ -313,6 +312,10 @@ func (l *Launchable) RestartPolicy() runit.RestartPolicy {
 	return l.RestartPolicy_
 }
 
+func (l *Launchable) RestartBackoff() *runit.Backoff {
+	return l.RestartBackoff_
+}
+
 func (l *Launchable) GetRestartTimeout() time.Duration {
 	return l.RestartTimeout
 }
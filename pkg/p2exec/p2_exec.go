@@ -2,6 +2,7 @@ package p2exec
 
 import (
 	"fmt"
+	"sort"
 )
 
 // DefaultP2Exec is the path to the default p2-exec binary. Specified as a var so you
@@ -36,8 +37,14 @@ func (args P2ExecArgs) CommandLine() []string {
 		cmd = append(cmd, "-e", envDir)
 	}
 
-	for envVarKey, envVarValue := range args.ExtraEnv {
-		cmd = append(cmd, "--extra-env", fmt.Sprintf("%s=%s", envVarKey, envVarValue))
+	// sorted so that the command line is the same every time it's built
+	envVarKeys := make([]string, 0, len(args.ExtraEnv))
+	for envVarKey := range args.ExtraEnv {
+		envVarKeys = append(envVarKeys, envVarKey)
+	}
+	sort.Strings(envVarKeys)
+	for _, envVarKey := range envVarKeys {
+		cmd = append(cmd, "--extra-env", fmt.Sprintf("%s=%s", envVarKey, args.ExtraEnv[envVarKey]))
 	}
 
 	if args.CgroupConfigName != "" {
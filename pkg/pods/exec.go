@@ -0,0 +1,52 @@
+package pods
+
+import (
+	"github.com/square/p2/pkg/hoist"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/p2exec"
+	"github.com/square/p2/pkg/util"
+)
+
+// ExecCommand returns the command that runs an arbitrary command in the
+// context of one of the pod's launchables: as the pod's user, with the pod's
+// and launchable's env dirs (which include CONFIG_PATH), in the launchable's
+// install directory and cgroup. If launchableID is empty, the pod must have
+// exactly one launchable.
+func (pod *Pod) ExecCommand(manifest manifest.Manifest, launchableID launch.LaunchableID, command []string) ([]string, error) {
+	if len(command) == 0 {
+		return nil, util.Errorf("No command to run")
+	}
+
+	launchables, err := pod.Launchables(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var launchable launch.Launchable
+	for _, l := range launchables {
+		if l.ID() == launchableID || (launchableID == "" && len(launchables) == 1) {
+			launchable = l
+			break
+		}
+	}
+	if launchable == nil {
+		if launchableID == "" {
+			return nil, util.Errorf("Pod %s has %d launchables, one must be chosen", pod.Id, len(launchables))
+		}
+		return nil, util.Errorf("Pod %s has no launchable %s", pod.Id, launchableID)
+	}
+
+	p2ExecArgs := p2exec.P2ExecArgs{
+		Command: command,
+		User:    manifest.RunAsUser(),
+		EnvDirs: []string{pod.EnvDir(), launchable.EnvDir()},
+		WorkDir: launchable.InstallDir(),
+	}
+	// join the cgroup the launchable's executables run in
+	if hl, ok := launchable.(hoist.LaunchAdapter); ok && hl.CgroupConfigName != "" {
+		p2ExecArgs.NoLimits = hl.ExecNoLimit
+		p2ExecArgs.CgroupConfigName = hl.CgroupConfigName
+		p2ExecArgs.CgroupName = hl.CgroupName
+	}
+	return append([]string{pod.P2Exec}, p2ExecArgs.CommandLine()...), nil
+}
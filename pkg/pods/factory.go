@@ -9,6 +9,7 @@ import (
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/p2exec"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/supervisor"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
@@ -123,8 +124,7 @@ func newPodWithHome(id types.PodID, uniqueKey types.PodUniqueKey, podHome string
 		home:           podHome,
 		node:           node,
 		logger:         logger,
-		SV:             runit.DefaultSV,
-		ServiceBuilder: runit.DefaultBuilder,
+		Supervisor:     supervisor.DefaultRunit,
 		P2Exec:         p2exec.DefaultP2Exec,
 		DefaultTimeout: 60 * time.Second,
 		LogExec:        runit.DefaultLogExec(),
@@ -0,0 +1,93 @@
+package pods
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logbridge"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/p2exec"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// LogShippingConfigPathEnvVar is set for the log bridge of a pod whose
+	// manifest has a log_shipping section, to the path of a file that
+	// contains that section.
+	LogShippingConfigPathEnvVar = "LOG_SHIPPING_CONFIG_PATH"
+
+	// NodeEnvVar is set for the log bridge of a pod that ships its logs,
+	// so that the shipped logs identify the node they came from.
+	NodeEnvVar = "NODE"
+)
+
+// logShippingConfigPath returns where the log shipping config is written.
+// The file name contains a hash of the config so that changing the config
+// changes the log agent's command, which makes the supervisor restart it.
+func (pod *Pod) logShippingConfigPath(config *logbridge.Config) (string, []byte, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", nil, util.Errorf("Could not marshal log shipping config: %s", err)
+	}
+	sum := sha256.Sum256(data)
+	name := fmt.Sprintf("%s_%s.log_shipping.yaml", pod.Id, hex.EncodeToString(sum[:]))
+	return filepath.Join(pod.ConfigDir(), name), data, nil
+}
+
+// writeLogShippingConfig writes the manifest's log shipping config, if it
+// has one, to the pod's config directory.
+func (pod *Pod) writeLogShippingConfig(manifest manifest.Manifest, uid int, gid int) error {
+	config := manifest.GetLogShipping()
+	if config == nil {
+		return nil
+	}
+
+	path, data, err := pod.logShippingConfigPath(config)
+	if err != nil {
+		return err
+	}
+	err = writeFileChown(path, data, uid, gid)
+	if err != nil {
+		return util.Errorf("Error writing log shipping config for pod %s: %s", manifest.ID(), err)
+	}
+	return nil
+}
+
+// logExecForLaunchable returns the log agent command for the launchable's
+// services. If the pod ships its logs, the log bridge set with
+// SetLogBridgeExec is given the launchable's environment and the log
+// shipping config, so that it can ship the logs with their metadata.
+// Otherwise all of the pod's services use LogExec.
+func (pod *Pod) logExecForLaunchable(manifest manifest.Manifest, launchable launch.Launchable) runit.Exec {
+	config := manifest.GetLogShipping()
+	if config == nil {
+		return pod.LogExec
+	}
+	if len(pod.logBridgeExec) == 0 {
+		pod.logger.WithField("launchable", launchable.ServiceID()).Warnln("Pod has a log_shipping config but no log bridge is configured, logs will not be shipped")
+		return pod.LogExec
+	}
+
+	path, _, err := pod.logShippingConfigPath(config)
+	if err != nil {
+		pod.logLaunchableError(launchable.ServiceID(), err, "Logs will not be shipped")
+		return pod.LogExec
+	}
+
+	p2ExecArgs := p2exec.P2ExecArgs{
+		Command: pod.logBridgeExec,
+		User:    "nobody",
+		EnvDirs: []string{pod.EnvDir(), launchable.EnvDir()},
+		ExtraEnv: map[string]string{
+			LogShippingConfigPathEnvVar: path,
+			NodeEnvVar:                  pod.node.String(),
+		},
+	}
+	return append([]string{pod.P2Exec}, p2ExecArgs.CommandLine()...)
+}
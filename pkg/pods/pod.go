@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/square/p2/pkg/artifact"
@@ -21,6 +24,7 @@ import (
 	"github.com/square/p2/pkg/opencontainer"
 	"github.com/square/p2/pkg/p2exec"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/supervisor"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/user"
@@ -29,6 +33,7 @@ import (
 	"github.com/square/p2/pkg/util/size"
 
 	"github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -50,8 +55,27 @@ const (
 	PodUniqueKeyEnvVar             = "POD_UNIQUE_KEY"
 	PlatformConfigPathEnvVar       = "PLATFORM_CONFIG_PATH"
 	LaunchableRestartTimeoutEnvVar = "RESTART_TIMEOUT"
+	SecretsPathEnvVar              = "SECRETS_PATH"
 )
 
+// InitError is returned by Launch when an init launchable fails. None of the
+// pod's other launchables are started.
+type InitError struct {
+	LaunchableID launch.LaunchableID
+	EntryPoint   string
+	// -1 if the executable didn't exit by itself
+	ExitCode int
+	Output   string
+	Inner    error
+}
+
+func (e InitError) Error() string {
+	if e.EntryPoint == "" {
+		return fmt.Sprintf("init launchable %s failed: %s", e.LaunchableID, e.Inner)
+	}
+	return fmt.Sprintf("init launchable %s failed running %s: %s", e.LaunchableID, e.EntryPoint, e.Inner)
+}
+
 type Pod struct {
 	// ID of the pod, i.e. result of ID() called on the manifest defining the pod
 	Id   types.PodID
@@ -66,8 +90,7 @@ type Pod struct {
 	// /data/pods/<pod_id> or /data/pods/<pod_id>-<uuid>
 	home           string
 	logger         logging.Logger
-	SV             runit.SV
-	ServiceBuilder *runit.ServiceBuilder
+	Supervisor     supervisor.Supervisor
 	P2Exec         string
 	DefaultTimeout time.Duration // this is the default timeout for stopping and restarting services in this pod
 	LogExec        runit.Exec
@@ -76,6 +99,30 @@ type Pod struct {
 
 	// Pod will not start if file is not present
 	RequireFile string
+
+	// The log bridge command given to SetLogBridgeExec, which ships the
+	// logs of pods that have a log_shipping config
+	logBridgeExec []string
+
+	// Used to query the pod's status check and pre-stop URLs while it is
+	// shut down. If nil, a client without a client certificate is used.
+	StatusClient *http.Client
+
+	// The directory the preparer writes the secrets the pod's manifest
+	// references into. Exported to pods that reference secrets as
+	// SECRETS_PATH
+	SecretsDir string
+
+	// Merges the config maps the pod's manifest references into its
+	// config. Pods that reference config maps can't be installed without
+	// one
+	ConfigMaps ConfigMapResolver
+}
+
+// ConfigMapResolver merges the config maps a manifest references into its
+// config, see configmap.Resolver
+type ConfigMapResolver interface {
+	Resolve(podManifest manifest.Manifest) (map[interface{}]interface{}, error)
 }
 
 var NoCurrentManifest error = fmt.Errorf("No current manifest for this pod")
@@ -111,11 +158,13 @@ func (pod *Pod) CurrentManifest() (manifest.Manifest, error) {
 }
 
 func (pod *Pod) Halt(manifest manifest.Manifest) (bool, error) {
-	launchables, err := pod.Launchables(manifest)
+	launchables, err := pod.supervisedLaunchables(manifest)
 	if err != nil {
 		return false, err
 	}
 
+	pod.prepareShutdown(manifest, launchables)
+
 	success := true
 	for _, launchable := range launchables {
 		var err error
@@ -129,7 +178,7 @@ func (pod *Pod) Halt(manifest manifest.Manifest) (bool, error) {
 		}
 	}
 	for _, launchable := range launchables {
-		err = launchable.Stop(runit.DefaultBuilder, runit.DefaultSV) // TODO: make these configurable
+		err = launchable.Stop(pod.Supervisor)
 		if err != nil {
 			pod.logLaunchableError(launchable.ServiceID(), err, "Could not stop launchable")
 			success = false
@@ -168,6 +217,11 @@ func (pod *Pod) Launch(manifest manifest.Manifest) (bool, error) {
 			return false, err
 		}
 
+		err = clearShutdownStarted(launchable)
+		if err != nil {
+			pod.logLaunchableWarning(launchable.ServiceID(), err, "Could not clear the record of the last shutdown")
+		}
+
 		var out string
 		postActivateFunc := func() {
 			out, err = launchable.PostActivate()
@@ -184,15 +238,39 @@ func (pod *Pod) Launch(manifest manifest.Manifest) (bool, error) {
 		}
 	}
 
-	err = pod.buildRunitServices(launchables, manifest)
+	// init launchables have to succeed before any service is started.
+	// Building the services doesn't start new ones, so they are started
+	// below in the order given by starts_after
+	stanzas := manifest.GetLaunchableStanzas()
+	var supervised []launch.Launchable
+	for _, launchable := range launchables {
+		stanza := stanzas[launchable.ID()]
+		if stanza.Role() != launch.RoleInit {
+			supervised = append(supervised, launchable)
+			continue
+		}
+
+		timeout, err := stanza.GetInitTimeout()
+		if err != nil {
+			return false, err
+		}
+		err = pod.runInit(launchable, timeout)
+		if err != nil {
+			pod.logLaunchableError(launchable.ServiceID(), err, "Init launchable failed, not starting the pod")
+			return false, err
+		}
+		pod.logger.WithField("launchable", launchable.ID()).Infoln("Init launchable completed")
+	}
+
+	err = pod.buildServices(supervised, manifest)
 	if err != nil {
-		pod.logger.WithError(err).Errorln("unable to write servicebuilder files for pod")
+		pod.logger.WithError(err).Errorln("unable to write services for pod")
 		return false, err
 	}
 
 	success := true
-	for _, launchable := range launchables {
-		err = launchable.Launch(pod.ServiceBuilder, pod.SV) // TODO: make these configurable
+	for _, launchable := range supervised {
+		err = launchable.Launch(pod.Supervisor)
 		switch err.(type) {
 		case nil:
 			// noop
@@ -231,12 +309,12 @@ func (pod *Pod) Prune(max size.ByteCount, manifest manifest.Manifest) {
 
 func (pod *Pod) Services(manifest manifest.Manifest) ([]runit.Service, error) {
 	allServices := []runit.Service{}
-	launchables, err := pod.Launchables(manifest)
+	launchables, err := pod.supervisedLaunchables(manifest)
 	if err != nil {
 		return nil, err
 	}
 	for _, l := range launchables {
-		es, err := l.Executables(pod.ServiceBuilder)
+		es, err := l.Executables(pod.Supervisor)
 		if err != nil {
 			return nil, err
 		}
@@ -249,13 +327,18 @@ func (pod *Pod) Services(manifest manifest.Manifest) ([]runit.Service, error) {
 	return allServices, nil
 }
 
-// Write servicebuilder *.yaml file and run servicebuilder, which will register runit services for this
-// pod.
-func (pod *Pod) buildRunitServices(launchables []launch.Launchable, newManifest manifest.Manifest) error {
-	// if the service is new, building the runit services also starts them
+// Register this pod's services with the supervisor. Under runit this writes a
+// servicebuilder *.yaml file and stages the runit services.
+func (pod *Pod) buildServices(launchables []launch.Launchable, newManifest manifest.Manifest) error {
 	sbTemplate := make(map[string]runit.ServiceTemplate)
+	stanzas := newManifest.GetLaunchableStanzas()
 	for _, launchable := range launchables {
-		executables, err := launchable.Executables(pod.ServiceBuilder)
+		shutdown, err := stanzas[launchable.ID()].GetShutdown()
+		if err != nil {
+			pod.logLaunchableError(launchable.ServiceID(), err, "Invalid shutdown stanza, using the default stop signal")
+			shutdown.Signal = launch.DefaultStopSignal
+		}
+		executables, err := launchable.Executables(pod.Supervisor)
 		if err != nil {
 			pod.logLaunchableError(launchable.ServiceID(), err, "Unable to list executables")
 			continue
@@ -265,21 +348,23 @@ func (pod *Pod) buildRunitServices(launchables []launch.Launchable, newManifest
 				return util.Errorf("Duplicate executable %q for launchable %q", executable.Service.Name, launchable.ServiceID())
 			}
 			sbTemplate[executable.Service.Name] = runit.ServiceTemplate{
-				Log:           pod.LogExec,
+				Log:           pod.logExecForLaunchable(newManifest, launchable),
 				Run:           executable.Exec,
 				Finish:        pod.FinishExecForExecutable(launchable, executable),
 				RestartPolicy: launchable.RestartPolicy(),
+				Backoff:       launchable.RestartBackoff(),
+				StopSignal:    shutdown.Signal,
 			}
 		}
 	}
-	err := pod.ServiceBuilder.Activate(pod.UniqueName(), sbTemplate)
+	err := pod.Supervisor.Activate(pod.UniqueName(), sbTemplate)
 	if err != nil {
 		return err
 	}
 
 	// as with the original servicebuilder, prune after creating
 	// new services
-	return pod.ServiceBuilder.Prune()
+	return pod.Supervisor.Prune()
 }
 
 func (pod *Pod) WriteCurrentManifest(manifest manifest.Manifest) (string, error) {
@@ -375,11 +460,11 @@ func (pod *Pod) Uninstall() error {
 
 	// remove services for this pod, then prune the old
 	// service dirs away
-	err = os.Remove(filepath.Join(pod.ServiceBuilder.ConfigRoot, pod.UniqueName()+".yaml"))
-	if err != nil && !os.IsNotExist(err) {
+	err = pod.Supervisor.Remove(pod.UniqueName())
+	if err != nil {
 		return err
 	}
-	err = pod.ServiceBuilder.Prune()
+	err = pod.Supervisor.Prune()
 	if err != nil {
 		return err
 	}
@@ -510,7 +595,8 @@ func (pod *Pod) Verify(manifest manifest.Manifest, authPolicy auth.Policy) error
 // 1) creates a directory in the pod's home directory called "config" which
 // contains YAML configuration files (named with pod's ID and the SHA of its
 // manifest's content) the path to which will be exported to a pods launchables
-// via the CONFIG_PATH environment variable
+// via the CONFIG_PATH environment variable. The config maps the manifest
+// references are merged into its config
 //
 // 2) writes an "env" directory in the pod's home directory called "env" which
 // contains environment variables written as files that will be exported to all
@@ -522,6 +608,9 @@ func (pod *Pod) Verify(manifest manifest.Manifest, authPolicy auth.Policy) error
 // contains environment files specific to a launchable (such as
 // LAUNCHABLE_ROOT)
 //
+// 4) writes the manifest's log_shipping section, if it has one, to the
+// "config" directory, for the log bridge
+//
 // We may wish to provide a "config" directory per launchable at some point as
 // well, so that launchables can have different config namespaces
 func (pod *Pod) setupConfig(manifest manifest.Manifest, launchables []launch.Launchable) error {
@@ -529,8 +618,7 @@ func (pod *Pod) setupConfig(manifest manifest.Manifest, launchables []launch.Lau
 	if err != nil {
 		return util.Errorf("Could not determine pod UID/GID: %s", err)
 	}
-	var configData bytes.Buffer
-	err = manifest.WriteConfig(&configData)
+	configData, err := pod.config(manifest)
 	if err != nil {
 		return err
 	}
@@ -549,7 +637,7 @@ func (pod *Pod) setupConfig(manifest manifest.Manifest, launchables []launch.Lau
 		return err
 	}
 	configPath := filepath.Join(pod.ConfigDir(), configFileName)
-	err = writeFileChown(configPath, configData.Bytes(), uid, gid)
+	err = writeFileChown(configPath, configData, uid, gid)
 	if err != nil {
 		return util.Errorf("Error writing config file for pod %s: %s", manifest.ID(), err)
 	}
@@ -587,6 +675,21 @@ func (pod *Pod) setupConfig(manifest manifest.Manifest, launchables []launch.Lau
 	if err != nil {
 		return err
 	}
+	if len(manifest.GetSecrets()) > 0 && pod.SecretsDir != "" {
+		err = writeEnvFile(pod.EnvDir(), SecretsPathEnvVar, pod.SecretsDir, uid, gid)
+	} else {
+		err = os.Remove(filepath.Join(pod.EnvDir(), SecretsPathEnvVar))
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	err = pod.writeLogShippingConfig(manifest, uid, gid)
+	if err != nil {
+		return err
+	}
 
 	for _, launchable := range launchables {
 		// we need to remove any unset env vars from a previous pod
@@ -623,6 +726,29 @@ func (pod *Pod) setupConfig(manifest manifest.Manifest, launchables []launch.Lau
 	return nil
 }
 
+// config returns the contents of the pod's config file: the manifest's config
+// with the config maps it references merged in
+func (pod *Pod) config(manifest manifest.Manifest) ([]byte, error) {
+	if len(manifest.GetConfigMaps()) == 0 {
+		var configData bytes.Buffer
+		err := manifest.WriteConfig(&configData)
+		return configData.Bytes(), err
+	}
+
+	if pod.ConfigMaps == nil {
+		return nil, util.Errorf("%s references config maps but they can't be resolved", manifest.ID())
+	}
+	config, err := pod.ConfigMaps.Resolve(manifest)
+	if err != nil {
+		return nil, err
+	}
+	configData, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, util.Errorf("Could not write config for %s: %s", manifest.ID(), err)
+	}
+	return configData, nil
+}
+
 // writeEnvFile takes an environment directory (as described in http://smarden.org/runit/chpst.8.html, with the -e option)
 // and writes a new file with the given value.
 func writeEnvFile(envDir, name, value string, uid, gid int) error {
@@ -648,12 +774,33 @@ func writeFileChown(filename string, data []byte, uid, gid int) error {
 	return file.Close()
 }
 
+// Launchables returns the manifest's launchables in the order they should be
+// started.
 func (pod *Pod) Launchables(manifest manifest.Manifest) ([]launch.Launchable, error) {
+	order, err := launch.StartOrder(manifest.GetLaunchableStanzas())
+	if err != nil {
+		return nil, err
+	}
+	return pod.launchablesInOrder(manifest, order)
+}
+
+// supervisedLaunchables returns the launchables whose executables are run by
+// the supervisor, which is all but the init launchables, in the order they
+// should be stopped.
+func (pod *Pod) supervisedLaunchables(manifest manifest.Manifest) ([]launch.Launchable, error) {
+	order, err := launch.StopOrder(manifest.GetLaunchableStanzas())
+	if err != nil {
+		return nil, err
+	}
+	return pod.launchablesInOrder(manifest, order)
+}
+
+func (pod *Pod) launchablesInOrder(manifest manifest.Manifest, order []launch.LaunchableID) ([]launch.Launchable, error) {
 	launchableStanzas := manifest.GetLaunchableStanzas()
-	launchables := make([]launch.Launchable, 0, len(launchableStanzas))
+	launchables := make([]launch.Launchable, 0, len(order))
 
-	for launchableID, launchableStanza := range launchableStanzas {
-		launchable, err := pod.getLaunchable(launchableID, launchableStanza, manifest.RunAsUser())
+	for _, launchableID := range order {
+		launchable, err := pod.getLaunchable(launchableID, launchableStanzas[launchableID], manifest.RunAsUser())
 		if err != nil {
 			return nil, err
 		}
@@ -663,6 +810,114 @@ func (pod *Pod) Launchables(manifest manifest.Manifest) ([]launch.Launchable, er
 	return launchables, nil
 }
 
+// runInit runs the executables of an init launchable one after the other,
+// waiting for each to exit. It returns an InitError for the first one that
+// fails or doesn't finish within the timeout.
+func (pod *Pod) runInit(launchable launch.Launchable, timeout time.Duration) error {
+	executables, err := launchable.Executables(pod.Supervisor)
+	if err != nil {
+		return InitError{LaunchableID: launchable.ID(), ExitCode: -1, Inner: err}
+	}
+
+	for _, executable := range executables {
+		var out []byte
+		var timedOut bool
+		pod.withTimeWarnings("init", executable.Service.Name, func() {
+			out, timedOut, err = runInitExecutable(executable.Exec, timeout)
+		})
+
+		if len(out) > 0 {
+			pod.logger.WithFields(logrus.Fields{
+				"launchable":  launchable.ID(),
+				"entry_point": executable.RelativePath,
+				"output":      string(out),
+			}).Infoln("Init output")
+		}
+		if err == nil {
+			continue
+		}
+
+		initErr := InitError{
+			LaunchableID: launchable.ID(),
+			EntryPoint:   executable.RelativePath,
+			ExitCode:     -1,
+			Output:       string(out),
+			Inner:        err,
+		}
+		if timedOut {
+			initErr.Inner = util.Errorf("did not finish within %s", timeout)
+		} else if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Exited() {
+				initErr.ExitCode = status.ExitStatus()
+			}
+		}
+		return initErr
+	}
+	return nil
+}
+
+// runInitExecutable runs an init executable in its own process group and
+// returns its combined output. If it doesn't finish within the timeout the
+// whole group is killed, so that processes it started don't outlive it.
+func runInitExecutable(execArgs []string, timeout time.Duration) ([]byte, bool, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(execArgs[0], execArgs[1:]...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err := cmd.Start()
+	if err != nil {
+		return nil, false, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+		return out.Bytes(), false, err
+	case <-timer.C:
+		// the process group ID is the PID of its leader
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		err = <-done
+		return out.Bytes(), true, err
+	}
+}
+
+// FailedServices returns the names of the pod's services that exhausted their
+// restart backoff and are no longer restarted by the supervisor.
+func (pod *Pod) FailedServices(manifest manifest.Manifest) ([]string, error) {
+	launchables, err := pod.supervisedLaunchables(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []string
+	for _, launchable := range launchables {
+		if launchable.RestartBackoff() == nil {
+			continue
+		}
+		executables, err := launchable.Executables(pod.Supervisor)
+		if err != nil {
+			return nil, err
+		}
+		for _, executable := range executables {
+			isFailed, err := pod.Supervisor.Failed(executable.Service.Name)
+			if err != nil {
+				return nil, err
+			}
+			if isFailed {
+				failed = append(failed, executable.Service.Name)
+			}
+		}
+	}
+	return failed, nil
+}
+
 func (pod *Pod) SetFinishExec(finishExec []string) {
 	pod.FinishExec = finishExec
 }
@@ -679,6 +934,7 @@ func (pod *Pod) FinishExecForExecutable(launchable launch.Launchable, executable
 }
 
 func (pod *Pod) SetLogBridgeExec(logExec []string) {
+	pod.logBridgeExec = logExec
 	p2ExecArgs := p2exec.P2ExecArgs{
 		Command: logExec,
 		User:    "nobody",
@@ -708,6 +964,20 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 		}
 	}
 
+	// the grace period is how long stopping may take, which is what the
+	// restart timeout is used for
+	shutdown, err := launchableStanza.GetShutdown()
+	if err != nil {
+		pod.logger.WithError(err).Errorf("Ignoring the shutdown stanza of launchable %s", launchableID)
+	} else if shutdown.GracePeriod > 0 {
+		restartTimeout = shutdown.GracePeriod
+	}
+
+	restartBackoff, err := launchableStanza.RestartBackoff()
+	if err != nil {
+		pod.logger.WithError(err).Errorf("Ignoring the restart backoff of launchable %s", launchableID)
+	}
+
 	version, err := launchableStanza.LaunchableVersion()
 	if err != nil {
 		pod.logger.WithError(err).Warnf("Could not parse version from launchable %s.", launchableID)
@@ -746,6 +1016,7 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 			ExecNoLimit:      true,
 			RestartTimeout:   restartTimeout,
 			RestartPolicy_:   launchableStanza.RestartPolicy(),
+			RestartBackoff_:  restartBackoff,
 			CgroupConfig:     launchableStanza.CgroupConfig,
 			CgroupConfigName: launchableID.String(),
 			CgroupName:       cgroupName,
@@ -765,6 +1036,7 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 			P2Exec:          pod.P2Exec,
 			RestartTimeout:  restartTimeout,
 			RestartPolicy_:  launchableStanza.RestartPolicy(),
+			RestartBackoff_: restartBackoff,
 			CgroupConfig:    launchableStanza.CgroupConfig,
 			SuppliedEnvVars: launchableStanza.Env,
 		}
@@ -778,11 +1050,13 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 }
 
 func (pod *Pod) disableAndHaltLaunchables(currentManifest manifest.Manifest) error {
-	launchables, err := pod.Launchables(currentManifest)
+	launchables, err := pod.supervisedLaunchables(currentManifest)
 	if err != nil {
 		return err
 	}
 
+	pod.prepareShutdown(currentManifest, launchables)
+
 	// halt launchables
 	for _, launchable := range launchables {
 		disableFunc := func() {
@@ -796,7 +1070,7 @@ func (pod *Pod) disableAndHaltLaunchables(currentManifest manifest.Manifest) err
 
 	// halt launchables
 	for _, launchable := range launchables {
-		err = launchable.Stop(runit.DefaultBuilder, runit.DefaultSV) // TODO: make these configurable
+		err = launchable.Stop(pod.Supervisor)
 		if err != nil {
 			pod.logLaunchableWarning(launchable.ServiceID(), err, "Could not stop launchable during uninstallation")
 		}
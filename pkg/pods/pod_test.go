@@ -4,13 +4,20 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"os/exec"
 	"os/user"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/auth"
@@ -20,6 +27,7 @@ import (
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/osversion"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/supervisor"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
 	"gopkg.in/yaml.v2"
@@ -296,19 +304,20 @@ func TestBuildRunitServices(t *testing.T) {
 	fakeSB := runit.FakeServiceBuilder()
 	defer fakeSB.Cleanup()
 	serviceBuilder := &fakeSB.ServiceBuilder
+	podSupervisor := supervisor.NewRunit(serviceBuilder, runit.FakeSV())
 
 	pod := Pod{
-		P2Exec:         "/usr/bin/p2-exec",
-		Id:             "testPod",
-		home:           "/data/pods/testPod",
-		ServiceBuilder: serviceBuilder,
-		LogExec:        runit.DefaultLogExec(),
-		FinishExec:     NopFinishExec,
+		P2Exec:     "/usr/bin/p2-exec",
+		Id:         "testPod",
+		home:       "/data/pods/testPod",
+		Supervisor: podSupervisor,
+		LogExec:    runit.DefaultLogExec(),
+		FinishExec: NopFinishExec,
 	}
 	hl, sb := hoist.FakeHoistLaunchableForDirLegacyPod("multiple_script_test_hoist_launchable")
 	defer hoist.CleanupFakeLaunchable(hl, sb)
 	hl.RunAs = "testPod"
-	executables, err := hl.Executables(serviceBuilder)
+	executables, err := hl.Executables(podSupervisor)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -316,7 +325,7 @@ func TestBuildRunitServices(t *testing.T) {
 
 	testManifest := manifest.NewBuilder()
 	testLaunchable := hl.If()
-	pod.buildRunitServices([]launch.Launchable{testLaunchable}, testManifest.GetManifest())
+	pod.buildServices([]launch.Launchable{testLaunchable}, testManifest.GetManifest())
 
 	bytes, err := ioutil.ReadFile(outFilePath)
 	if err != nil {
@@ -401,10 +410,10 @@ func TestUninstall(t *testing.T) {
 	testPodDir, err := ioutil.TempDir("", "testPodDir")
 	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
 	pod := Pod{
-		Id:             "testPod",
-		home:           testPodDir,
-		ServiceBuilder: serviceBuilder,
-		logger:         logging.DefaultLogger,
+		Id:         "testPod",
+		home:       testPodDir,
+		Supervisor: supervisor.NewRunit(serviceBuilder, runit.FakeSV()),
+		logger:     logging.DefaultLogger,
 	}
 	manifest := getTestPodManifest(t)
 	manifestContent, err := manifest.Marshal()
@@ -445,3 +454,305 @@ func ContainsString(test string) func(interface{}) bool {
 		}
 	}
 }
+
+func TestWaitForDrain(t *testing.T) {
+	// the pod starts draining once it has been asked for its status, unless
+	// it is told to keep passing
+	var keepPassing, draining int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if atomic.LoadInt32(&keepPassing) == 0 && !atomic.CompareAndSwapInt32(&draining, 0, 1) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	Assert(t).IsNil(err, "couldn't parse test server URL")
+	port, err := strconv.Atoi(serverURL.Port())
+	Assert(t).IsNil(err, "couldn't parse test server port")
+
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	builder.SetStatusHTTP(true)
+	builder.SetStatusPort(port)
+	podManifest := builder.GetManifest()
+
+	pod := getTestPod()
+	Assert(t).IsTrue(pod.waitForDrain(podManifest, time.Minute), "pod should have drained once its status check failed")
+
+	atomic.StoreInt32(&keepPassing, 1)
+	Assert(t).IsFalse(pod.waitForDrain(podManifest, 10*time.Millisecond), "pod should not have drained while its status check passed")
+
+	builder.SetStatusPath("/healthy")
+	Assert(t).IsTrue(pod.waitForDrain(builder.GetManifest(), time.Minute), "a missing status check should count as drained")
+
+	// an error other than a refused connection, such as a failed TLS
+	// handshake, doesn't mean the pod stopped serving
+	builder.SetStatusHTTP(false)
+	Assert(t).IsFalse(pod.waitForDrain(builder.GetManifest(), 10*time.Millisecond), "a TLS error should not count as drained")
+
+	server.Close()
+	builder.SetStatusHTTP(true)
+	Assert(t).IsTrue(pod.waitForDrain(builder.GetManifest(), time.Minute), "a pod that stopped listening should count as drained")
+}
+
+func TestLogExecForShippingPod(t *testing.T) {
+	pod := getTestPod()
+	pod.SetLogBridgeExec([]string{"/usr/bin/p2-log-bridge", "svlogd"})
+	hl, sb := hoist.FakeHoistLaunchableForDirLegacyPod("multiple_script_test_hoist_launchable")
+	defer hoist.CleanupFakeLaunchable(hl, sb)
+
+	logExec := pod.logExecForLaunchable(getTestPodManifest(t), hl.If())
+	Assert(t).AreEqual(strings.Join(pod.LogExec, " "), strings.Join(logExec, " "), "pods that don't ship their logs should all use the same log exec")
+
+	shipping, err := manifest.FromBytes([]byte(`id: hello
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/app_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+log_shipping:
+  sinks:
+  - type: http
+    url: https://logs.example.com/ingest
+`))
+	Assert(t).IsNil(err, "couldn't parse manifest")
+	configPath, _, err := pod.logShippingConfigPath(shipping.GetLogShipping())
+	Assert(t).IsNil(err, "couldn't determine config path")
+	Assert(t).AreEqual(pod.ConfigDir(), filepath.Dir(configPath), "log shipping config should be in the pod's config dir")
+
+	logExec = pod.logExecForLaunchable(shipping, hl.If())
+	commandLine := strings.Join(logExec, " ")
+	for _, expected := range []string{
+		"-e " + hl.EnvDir(),
+		"--extra-env " + LogShippingConfigPathEnvVar + "=" + configPath,
+		"--extra-env " + NodeEnvVar + "=testNode",
+		"-- /usr/bin/p2-log-bridge svlogd",
+	} {
+		Assert(t).IsTrue(strings.Contains(commandLine, expected), fmt.Sprintf("expected log exec %q to contain %q", commandLine, expected))
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	pod := getTestPod()
+	podManifest, err := manifest.FromBytes([]byte(`id: hello
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/app_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+  worker:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/worker_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+`))
+	Assert(t).IsNil(err, "couldn't parse manifest")
+
+	_, err = pod.ExecCommand(podManifest, "", []string{"ls"})
+	Assert(t).IsNotNil(err, "expected an error when a pod with many launchables has none chosen")
+	_, err = pod.ExecCommand(podManifest, "db", []string{"ls"})
+	Assert(t).IsNotNil(err, "expected an error for a launchable the pod doesn't have")
+
+	command, err := pod.ExecCommand(podManifest, "worker", []string{"ls", "-l"})
+	Assert(t).IsNil(err, "couldn't build exec command")
+	Assert(t).AreEqual(command[0], pod.P2Exec, "expected the command to be run by p2-exec")
+	commandLine := strings.Join(command, " ")
+	launchableDir := filepath.Join(pod.Home(), "worker")
+	for _, expected := range []string{
+		"-u hello",
+		"-e " + pod.EnvDir(),
+		"-e " + filepath.Join(launchableDir, "env"),
+		"-l worker",
+		"-c hello__worker",
+		"-- ls -l",
+	} {
+		Assert(t).IsTrue(strings.Contains(commandLine, expected), fmt.Sprintf("expected exec command %q to contain %q", commandLine, expected))
+	}
+}
+
+// pidSV reports a service to be running as the given process
+type pidSV struct {
+	*runit.RecordingSV
+	pid int
+}
+
+func (s pidSV) Stat(*runit.Service) (*runit.StatResult, error) {
+	return &runit.StatResult{ChildStatus: runit.STATUS_RUN, ChildPID: uint64(s.pid)}, nil
+}
+
+func TestReloadSignalsLaunchables(t *testing.T) {
+	currUser, err := user.Current()
+	Assert(t).IsNil(err, "Could not get the current user")
+	manifestStr := fmt.Sprintf(`id: thepod
+run_as: %s
+launchables:
+  my-app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/baz_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+config:
+  ENVIRONMENT: staging
+`, currUser.Username)
+	unreloadable, err := manifest.FromBytes([]byte(manifestStr))
+	Assert(t).IsNil(err, "should not have erred reading the manifest")
+	reloadable, err := manifest.FromBytes([]byte(strings.Replace(manifestStr, "launchable_type: hoist", "launchable_type: hoist\n    reload_signal: HUP", 1)))
+	Assert(t).IsNil(err, "should not have erred reading the manifest")
+
+	podTemp, err := ioutil.TempDir("", "pod")
+	Assert(t).IsNil(err, "test setup: could not create pod home")
+	defer os.RemoveAll(podTemp)
+	pod := NewFactory(podTemp, "testNode", uri.DefaultFetcher, "").NewLegacyPod(reloadable.ID())
+	fakeSB := runit.FakeServiceBuilder()
+	defer fakeSB.Cleanup()
+
+	process := exec.Command("sleep", "60")
+	Assert(t).IsNil(process.Start(), "test setup: could not start process")
+	defer process.Process.Kill()
+	pod.Supervisor = supervisor.NewRunit(&fakeSB.ServiceBuilder, pidSV{&runit.RecordingSV{}, process.Process.Pid})
+
+	launchable, err := pod.getLaunchable("my-app", reloadable.GetLaunchableStanzas()["my-app"], currUser.Username)
+	Assert(t).IsNil(err, "test setup: could not get launchable")
+	Assert(t).IsNil(os.MkdirAll(filepath.Join(launchable.InstallDir(), "bin"), 0755), "test setup: could not install launchable")
+	err = ioutil.WriteFile(filepath.Join(launchable.InstallDir(), "bin", "launch"), []byte("#!/bin/sh\n"), 0755)
+	Assert(t).IsNil(err, "test setup: could not install launchable")
+
+	_, err = pod.Reload(unreloadable)
+	Assert(t).AreEqual(err, ReloadUnsupported, "expected a launchable without a reload signal or script not to be reloaded")
+	_, err = pod.CurrentManifest()
+	Assert(t).AreEqual(err, NoCurrentManifest, "expected nothing to change when the pod can't be reloaded")
+
+	ok, err := pod.Reload(reloadable)
+	Assert(t).IsNil(err, "should have reloaded the pod")
+	Assert(t).IsTrue(ok, "should have signaled the launchable")
+
+	err = process.Wait()
+	Assert(t).IsNotNil(err, "expected the process to be signaled")
+	status, _ := process.ProcessState.Sys().(syscall.WaitStatus)
+	Assert(t).AreEqual(status.Signal(), syscall.SIGHUP, "expected the process to be sent the reload signal")
+
+	configFileName, err := reloadable.ConfigFileName()
+	Assert(t).IsNil(err, "Couldn't generate config filename")
+	config, err := ioutil.ReadFile(filepath.Join(pod.ConfigDir(), configFileName))
+	Assert(t).IsNil(err, "should have written the config")
+	Assert(t).AreEqual(string(config), "ENVIRONMENT: staging\n", "the config didn't match")
+	current, err := pod.CurrentManifest()
+	Assert(t).IsNil(err, "should have written the current manifest")
+	manifestMustEqual(reloadable, current, t)
+
+	// a signal can't change the env of a running process
+	newEnv, err := manifest.FromBytes([]byte(strings.Replace(manifestStr, "launchable_type: hoist", "launchable_type: hoist\n    reload_signal: HUP\n    env:\n      FOO: bar", 1)))
+	Assert(t).IsNil(err, "should not have erred reading the manifest")
+	_, err = pod.Reload(newEnv)
+	Assert(t).AreEqual(err, ReloadUnsupported, "expected a signaled launchable whose env changed not to be reloaded")
+	current, err = pod.CurrentManifest()
+	Assert(t).IsNil(err, "should have kept the current manifest")
+	manifestMustEqual(reloadable, current, t)
+}
+
+// startOrderSV records the services it is asked to start and whether each
+// of them was still held down by its down file at the time.
+type startOrderSV struct {
+	*runit.RecordingSV
+	started  []string
+	heldDown []bool
+}
+
+func (s *startOrderSV) Restart(service *runit.Service, timeout time.Duration) (string, error) {
+	if strings.HasSuffix(service.Name, "logAgent") {
+		return "success", nil
+	}
+	_, err := os.Stat(filepath.Join(service.Path, runit.DOWN_FILE_NAME))
+	s.started = append(s.started, service.Name)
+	s.heldDown = append(s.heldDown, err == nil)
+	return "success", nil
+}
+
+func TestLaunchStartsNewServicesInOrder(t *testing.T) {
+	currUser, err := user.Current()
+	Assert(t).IsNil(err, "Could not get the current user")
+	podManifest, err := manifest.FromBytes([]byte(fmt.Sprintf(`id: thepod
+run_as: %s
+launchables:
+  api:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/api_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+    starts_after: [db]
+  db:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/db_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+`, currUser.Username)))
+	Assert(t).IsNil(err, "should not have erred reading the manifest")
+
+	podTemp, err := ioutil.TempDir("", "pod")
+	Assert(t).IsNil(err, "test setup: could not create pod home")
+	defer os.RemoveAll(podTemp)
+	pod := NewFactory(podTemp, "testNode", uri.DefaultFetcher, "").NewLegacyPod(podManifest.ID())
+	fakeSB := runit.FakeServiceBuilder()
+	defer fakeSB.Cleanup()
+	sv := &startOrderSV{RecordingSV: &runit.RecordingSV{}}
+	pod.Supervisor = supervisor.NewRunit(&fakeSB.ServiceBuilder, sv)
+
+	for launchableID, stanza := range podManifest.GetLaunchableStanzas() {
+		launchable, err := pod.getLaunchable(launchableID, stanza, currUser.Username)
+		Assert(t).IsNil(err, "test setup: could not get launchable")
+		Assert(t).IsNil(os.MkdirAll(filepath.Join(launchable.InstallDir(), "bin"), 0755), "test setup: could not install launchable")
+		err = ioutil.WriteFile(filepath.Join(launchable.InstallDir(), "bin", "launch"), []byte("#!/bin/sh\n"), 0755)
+		Assert(t).IsNil(err, "test setup: could not install launchable")
+	}
+
+	ok, err := pod.Launch(podManifest)
+	Assert(t).IsNil(err, "should have launched the pod")
+	Assert(t).IsTrue(ok, "expected every service to start")
+
+	Assert(t).AreEqual(len(sv.started), 2, "expected both services to be started")
+	Assert(t).AreEqual(sv.started[0], "thepod__db__launch", "expected db to start first")
+	Assert(t).AreEqual(sv.started[1], "thepod__api__launch", "expected api to start after db")
+	for i, heldDown := range sv.heldDown {
+		Assert(t).IsTrue(heldDown, "expected "+sv.started[i]+" to be held down until it was started")
+	}
+
+	for _, name := range sv.started {
+		_, err = os.Stat(filepath.Join(fakeSB.StagingRoot, name, runit.DOWN_FILE_NAME))
+		Assert(t).IsTrue(os.IsNotExist(err), "expected "+name+" to be restarted by runsv once started")
+	}
+}
+
+func TestRunInitExecutableKillsItsProcessGroup(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "init_test")
+	Assert(t).IsNil(err, "Could not create temp dir")
+	defer os.RemoveAll(tempDir)
+	pidFile := filepath.Join(tempDir, "pid")
+
+	out, timedOut, err := runInitExecutable([]string{"/bin/sh", "-c", "echo started; sleep 30 & echo $! > " + pidFile + "; wait"}, 200*time.Millisecond)
+	Assert(t).IsNotNil(err, "expected an error for an init executable that timed out")
+	Assert(t).IsTrue(timedOut, "expected the init executable to time out")
+	Assert(t).AreEqual(string(out), "started\n", "expected the output before the timeout")
+
+	pidBytes, err := ioutil.ReadFile(pidFile)
+	Assert(t).IsNil(err, "Could not read the pid of the background process")
+	statPath := filepath.Join("/proc", strings.TrimSpace(string(pidBytes)), "stat")
+
+	// a killed process that hasn't been reaped yet is a zombie. The kill
+	// may not have been delivered yet, so give it a moment
+	state := ""
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		stat, err := ioutil.ReadFile(statPath)
+		if err != nil {
+			// the process is gone entirely
+			state = ""
+			break
+		}
+		state = strings.Fields(string(stat))[2]
+		if state == "Z" {
+			break
+		}
+	}
+	if state != "" {
+		Assert(t).AreEqual(state, "Z", "expected the background process to have been killed")
+	}
+
+	out, timedOut, err = runInitExecutable([]string{"/bin/sh", "-c", "echo done"}, time.Second)
+	Assert(t).IsNil(err, "unexpected error running init executable")
+	Assert(t).IsFalse(timedOut, "a quick init executable should not time out")
+	Assert(t).AreEqual(string(out), "done\n", "wrong output")
+}
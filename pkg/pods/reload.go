@@ -0,0 +1,160 @@
+package pods
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// ReloadUnsupported is returned by Reload if one of the pod's launchables can
+// neither be sent a reload signal nor run a reload script. Such pods have to
+// be relaunched to pick up a new config.
+var ReloadUnsupported = errors.New("One or more launchables can't reload their config")
+
+// reloader is implemented by launchables that can provide a reload script,
+// i.e. hoist launchables
+type reloader interface {
+	CanReload() bool
+	Reload() (string, error)
+}
+
+// Reload applies a manifest that differs from the pod's current manifest only
+// in its config or the env of its launchables (see
+// manifest.OnlyConfigChanged) without restarting the pod: the config files,
+// env directories and current manifest are rewritten in place, then each
+// launchable's reload script is run or, if it doesn't have one, its processes
+// are sent its reload signal. Since processes read their env when they start,
+// a signal can't apply env changes, so launchables without a reload script
+// can't be reloaded if their env changed.
+//
+// Nothing is changed if a launchable can't be reloaded, in which case
+// ReloadUnsupported is returned. Otherwise, failures to reload a launchable are
+// logged and the first return value is false.
+func (pod *Pod) Reload(manifest manifest.Manifest) (bool, error) {
+	launchables, err := pod.Launchables(manifest)
+	if err != nil {
+		return false, err
+	}
+	supervised, err := pod.supervisedLaunchables(manifest)
+	if err != nil {
+		return false, err
+	}
+
+	currentManifest, err := pod.CurrentManifest()
+	if err != nil && err != NoCurrentManifest {
+		return false, err
+	}
+
+	stanzas := manifest.GetLaunchableStanzas()
+	signals := make(map[launch.LaunchableID]syscall.Signal)
+	for _, launchable := range supervised {
+		if r, ok := launchable.(reloader); ok && r.CanReload() {
+			continue
+		}
+		signal, err := stanzas[launchable.ID()].GetReloadSignal()
+		if err != nil {
+			return false, err
+		}
+		if signal == 0 {
+			return false, ReloadUnsupported
+		}
+		if currentManifest != nil && envChanged(currentManifest.GetLaunchableStanzas()[launchable.ID()].Env, stanzas[launchable.ID()].Env) {
+			return false, ReloadUnsupported
+		}
+		signals[launchable.ID()] = signal
+	}
+
+	err = pod.setupConfig(manifest, launchables)
+	if err != nil {
+		pod.logError(err, "Could not setup config")
+		return false, util.Errorf("Could not setup config: %s", err)
+	}
+	oldManifestTemp, err := pod.WriteCurrentManifest(manifest)
+	defer os.RemoveAll(oldManifestTemp)
+	if err != nil {
+		return false, err
+	}
+
+	success := true
+	for _, launchable := range supervised {
+		signal, ok := signals[launchable.ID()]
+		if !ok {
+			var out string
+			reloadFunc := func() {
+				out, err = launchable.(reloader).Reload()
+			}
+			pod.withTimeWarnings("reload", launchable.ServiceID(), reloadFunc)
+			if err != nil {
+				pod.logLaunchableError(launchable.ServiceID(), err, out)
+				success = false
+			} else if out != "" {
+				pod.logger.WithField("output", out).Infoln("Successfully reloaded")
+			}
+			continue
+		}
+
+		err = pod.signalLaunchable(launchable, signal)
+		if err != nil {
+			pod.logLaunchableError(launchable.ServiceID(), err, "Could not signal launchable to reload")
+			success = false
+		}
+	}
+
+	if success {
+		pod.logInfo("Successfully reloaded")
+	} else {
+		pod.logInfo("Reloaded pod but one or more launchables failed to reload")
+	}
+	return success, nil
+}
+
+func envChanged(old map[string]string, new map[string]string) bool {
+	if len(old) != len(new) {
+		return true
+	}
+	for key, value := range old {
+		if newValue, ok := new[key]; !ok || newValue != value {
+			return true
+		}
+	}
+	return false
+}
+
+// signalLaunchable sends signal to the running processes of the launchable.
+// Processes that aren't running read the new config when they are started.
+func (pod *Pod) signalLaunchable(launchable launch.Launchable, signal syscall.Signal) error {
+	executables, err := launchable.Executables(pod.Supervisor)
+	if err != nil {
+		return err
+	}
+	for _, executable := range executables {
+		stat, err := pod.Supervisor.Stat(&executable.Service)
+		if err != nil {
+			return util.Errorf("Could not determine the process of %s: %s", executable.Service.Name, err)
+		}
+		if stat.ChildStatus != runit.STATUS_RUN || stat.ChildPID == 0 {
+			continue
+		}
+		err = syscall.Kill(int(stat.ChildPID), signal)
+		if err == syscall.ESRCH {
+			// exited in the meantime
+			continue
+		}
+		if err != nil {
+			return util.Errorf("Could not send %s to %s: %s", signal, executable.Service.Name, err)
+		}
+		pod.logger.WithFields(logrus.Fields{
+			"service": executable.Service.Name,
+			"pid":     stat.ChildPID,
+			"signal":  signal.String(),
+		}).Infoln("Signaled process to reload")
+	}
+	return nil
+}
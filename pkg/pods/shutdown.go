@@ -0,0 +1,221 @@
+package pods
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/p2exec"
+	"github.com/square/p2/pkg/util"
+	netutil "github.com/square/p2/pkg/util/net"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// ShutdownStartedEnvVar is set in a launchable's environment while it is
+// being shut down, to the time the shutdown started (in RFC 3339 format).
+// The finish script uses it to report how long the shutdown took.
+const ShutdownStartedEnvVar = "SHUTDOWN_STARTED_AT"
+
+const (
+	// How often the pod's status check is polled while waiting for it to
+	// drain
+	drainPollInterval = 1 * time.Second
+
+	statusCheckTimeout = 5 * time.Second
+)
+
+// prepareShutdown runs the steps of the shutdown contract that come before a
+// pod's launchables are disabled and stopped: it records when the shutdown
+// started, runs each launchable's pre-stop hooks and waits for the pod's
+// status check to stop passing. Failures are logged but don't stop the pod
+// from being halted.
+func (pod *Pod) prepareShutdown(manifest manifest.Manifest, launchables []launch.Launchable) {
+	stanzas := manifest.GetLaunchableStanzas()
+	started := time.Now()
+
+	var drainTimeout time.Duration
+	for _, launchable := range launchables {
+		err := ioutil.WriteFile(
+			filepath.Join(launchable.EnvDir(), ShutdownStartedEnvVar),
+			[]byte(started.Format(time.RFC3339Nano)),
+			0644,
+		)
+		if err != nil {
+			pod.logLaunchableWarning(launchable.ServiceID(), err, "Could not record shutdown start")
+		}
+
+		shutdown, err := stanzas[launchable.ID()].GetShutdown()
+		if err != nil {
+			pod.logLaunchableWarning(launchable.ServiceID(), err, "Invalid shutdown stanza, skipping pre-stop hooks")
+			continue
+		}
+		pod.preStop(launchable, shutdown, manifest.RunAsUser())
+		if shutdown.DrainTimeout > drainTimeout {
+			drainTimeout = shutdown.DrainTimeout
+		}
+	}
+
+	if drainTimeout > 0 && manifest.GetStatusPort() != 0 {
+		start := time.Now()
+		drained := pod.waitForDrain(manifest, drainTimeout)
+		pod.logger.WithFields(logrus.Fields{
+			"drained":  drained,
+			"duration": time.Since(start),
+		}).Infoln("Finished waiting for the pod to drain")
+	}
+}
+
+func (pod *Pod) preStop(launchable launch.Launchable, shutdown launch.Shutdown, runAs string) {
+	if len(shutdown.PreStopExec) > 0 {
+		command := append([]string{}, shutdown.PreStopExec...)
+		if !filepath.IsAbs(command[0]) {
+			command[0] = filepath.Join(launchable.InstallDir(), command[0])
+		}
+		args := p2exec.P2ExecArgs{
+			Command: command,
+			User:    runAs,
+			EnvDirs: []string{pod.EnvDir(), launchable.EnvDir()},
+			WorkDir: launchable.InstallDir(),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdown.PreStopTimeout)
+		cmd := exec.CommandContext(ctx, pod.P2Exec, args.CommandLine()...)
+		var out []byte
+		var err error
+		pod.withTimeWarnings("pre-stop", launchable.ServiceID(), func() {
+			out, err = cmd.CombinedOutput()
+		})
+		if ctx.Err() == context.DeadlineExceeded {
+			err = util.Errorf("did not finish within %s", shutdown.PreStopTimeout)
+		}
+		cancel()
+		if err != nil {
+			pod.logger.WithErrorAndFields(err, logrus.Fields{
+				"launchable": launchable.ServiceID(),
+				"output":     string(out),
+			}).Warnln("Pre-stop command failed")
+		} else if len(out) > 0 {
+			pod.logger.WithFields(logrus.Fields{
+				"launchable": launchable.ServiceID(),
+				"output":     string(out),
+			}).Infoln("Ran pre-stop command")
+		}
+	}
+
+	if shutdown.PreStopHTTP != "" {
+		client := &http.Client{Timeout: shutdown.PreStopTimeout}
+		if pod.StatusClient != nil {
+			// copy the client so that its timeout isn't modified
+			c := *pod.StatusClient
+			c.Timeout = shutdown.PreStopTimeout
+			client = &c
+		}
+		resp, err := client.Post(shutdown.PreStopHTTP, "text/plain", nil)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				err = util.Errorf("%s responded with %s", shutdown.PreStopHTTP, resp.Status)
+			}
+		}
+		if err != nil {
+			pod.logLaunchableWarning(launchable.ServiceID(), err, "Pre-stop request failed")
+		}
+	}
+}
+
+// NewStatusClient returns a client for querying the status checks and
+// pre-stop URLs of pods on this host, presenting the given certificate to
+// those that require one. The status checks are queried on localhost, so the
+// pods' certificates are not verified, like the health checks of
+// localhost-only pods.
+func NewStatusClient(certFile, keyFile, caFile string) (*http.Client, error) {
+	tlsConfig, err := netutil.GetTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.InsecureSkipVerify = true
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		Timeout:   statusCheckTimeout,
+	}, nil
+}
+
+// waitForDrain polls the pod's status check until it stops passing, which
+// tells load balancers to stop sending traffic to the pod, or the timeout
+// passes. It returns whether the pod drained. A refused connection means the
+// pod stopped listening, which counts as drained; any other error is logged
+// and the status check is polled again.
+func (pod *Pod) waitForDrain(manifest manifest.Manifest, timeout time.Duration) bool {
+	scheme := "https"
+	if manifest.GetStatusHTTP() {
+		scheme = "http"
+	}
+	uri := fmt.Sprintf("%s://localhost:%d%s", scheme, manifest.GetStatusPort(), manifest.GetStatusPath())
+
+	client := pod.StatusClient
+	if client == nil {
+		var err error
+		client, err = NewStatusClient("", "", "")
+		if err != nil {
+			pod.logger.WithError(err).Warnln("Could not build a status client, not waiting for the pod to drain")
+			return false
+		}
+	}
+
+	deadline := time.After(timeout)
+	for {
+		resp, err := client.Head(uri)
+		if err != nil {
+			if isConnectionRefused(err) {
+				return true
+			}
+			pod.logger.WithErrorAndFields(err, logrus.Fields{"uri": uri}).
+				Warnln("Could not query the status check while waiting for the pod to drain")
+		} else {
+			_ = resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				return true
+			}
+		}
+
+		select {
+		case <-deadline:
+			return false
+		case <-time.After(drainPollInterval):
+		}
+	}
+}
+
+func isConnectionRefused(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if syscallErr, ok := err.(*os.SyscallError); ok {
+		err = syscallErr.Err
+	}
+	return err == syscall.ECONNREFUSED
+}
+
+// clearShutdownStarted removes the record of a previous shutdown before the
+// launchable is started again.
+func clearShutdownStarted(launchable launch.Launchable) error {
+	err := os.Remove(filepath.Join(launchable.EnvDir(), ShutdownStartedEnvVar))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,445 @@
+package preparer
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/secrets"
+	"github.com/square/p2/pkg/supervisor"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+	"github.com/square/p2/pkg/util/size"
+)
+
+// How often WatchConfig checks the config file for changes
+const configPollInterval = 5 * time.Second
+
+// The keys of the preparer config that Reload() applies without a restart.
+// Changes to any other key are logged and ignored until the preparer restarts.
+// Of the secrets settings, Reload() only applies the policy, see
+// restartRequiredKeys
+var reloadableKeys = map[string]bool{
+	"log_level":            true,
+	"hooks_directory":      true,
+	"auth":                 true,
+	"log_bridge_blacklist": true,
+	"params":               true,
+}
+
+// ConfigError lists every problem found in a preparer config, each prefixed
+// with the path of the offending key, so that they can all be fixed at once.
+type ConfigError []string
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("invalid preparer config: %s", strings.Join(e, "; "))
+}
+
+// Validate checks the values in the config that can be checked without
+// touching the filesystem or the network. Settings that New() requires but
+// that are unset are left for New() to report.
+func (c *PreparerConfig) Validate() error {
+	var problems ConfigError
+
+	switch c.Auth.Type {
+	case "", auth.Null:
+	case auth.Keyring:
+		if c.Auth.KeyringPath == "" {
+			problems = append(problems, "preparer.auth.keyring: required by keyring auth")
+		}
+	case auth.User:
+		if c.Auth.KeyringPath == "" {
+			problems = append(problems, "preparer.auth.keyring: required by user auth")
+		}
+		if c.Auth.DeployPolicyPath == "" {
+			problems = append(problems, "preparer.auth.deploy_policy: required by user auth")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("preparer.auth.type: unrecognized auth type %q", c.Auth.Type))
+	}
+
+	switch c.ArtifactAuth.Type {
+	case "", auth.VerifyNone:
+	case auth.VerifyManifest, auth.VerifyBuild, auth.VerifyEither:
+		if c.ArtifactAuth.KeyringPath == "" {
+			problems = append(problems, fmt.Sprintf("preparer.artifact_auth.keyring: required by %s verification", c.ArtifactAuth.Type))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("preparer.artifact_auth.type: unrecognized artifact verification type %q", c.ArtifactAuth.Type))
+	}
+
+	if c.LogLevel != "" {
+		if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+			problems = append(problems, fmt.Sprintf("preparer.log_level: %s", err))
+		}
+	}
+	if c.MaxLaunchableDiskUsage != "" {
+		if _, err := size.Parse(c.MaxLaunchableDiskUsage); err != nil {
+			problems = append(problems, fmt.Sprintf("preparer.max_launchable_disk_usage: %s", err))
+		}
+	}
+	if c.StatusPort < 0 || c.StatusPort > 65535 {
+		problems = append(problems, fmt.Sprintf("preparer.status_port: %d is not a valid port", c.StatusPort))
+	}
+	if c.StatusTLSPort < 0 || c.StatusTLSPort > 65535 {
+		problems = append(problems, fmt.Sprintf("preparer.status_tls_port: %d is not a valid port", c.StatusTLSPort))
+	}
+	if c.StatusTLSPort != 0 && (c.CertFile == "" || c.KeyFile == "" || c.CAFile == "") {
+		problems = append(problems, "preparer.status_tls_port: requires cert_file, key_file and ca_file")
+	}
+	if c.LogsTokenFile != "" && c.StatusTLSPort == 0 {
+		problems = append(problems, "preparer.logs_token_file: logs are only served on status_tls_port")
+	}
+	if len(c.ExecUsers) > 0 && c.StatusTLSPort == 0 {
+		problems = append(problems, "preparer.exec_users: exec is only served on status_tls_port")
+	}
+	if c.ArtifactRegistryURL != "" {
+		if _, err := url.Parse(c.ArtifactRegistryURL); err != nil {
+			problems = append(problems, fmt.Sprintf("preparer.artifact_registry_url: %s", err))
+		}
+	}
+	switch c.Supervisor.Type {
+	case "", supervisor.RunitType, supervisor.SystemdType:
+	default:
+		problems = append(problems, fmt.Sprintf("preparer.supervisor.type: unrecognized supervisor %q", c.Supervisor.Type))
+	}
+	switch c.Secrets.Provider {
+	case "":
+	case secrets.FileProviderType:
+		if c.Secrets.Directory == "" {
+			problems = append(problems, "preparer.secrets.directory: required by the file secrets provider")
+		}
+		if c.Secrets.KeyringPath == "" {
+			problems = append(problems, "preparer.secrets.keyring: required by the file secrets provider")
+		}
+	case secrets.HTTPProviderType:
+		if u, err := url.Parse(c.Secrets.URL); err != nil || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("preparer.secrets.url: %q is not a valid secret service URL", c.Secrets.URL))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("preparer.secrets.provider: unrecognized secrets provider %q", c.Secrets.Provider))
+	}
+	if c.Secrets.Provider != "" && c.Secrets.PolicyPath == "" {
+		problems = append(problems, "preparer.secrets.policy: required by every secrets provider")
+	}
+	if c.Secrets.RefreshInterval < 0 {
+		problems = append(problems, "preparer.secrets.refresh_interval: must not be negative")
+	}
+	if c.HooksManifest != "" && c.HooksManifest != NoHooksSentinelValue {
+		if _, err := manifest.FromBytes([]byte(c.HooksManifest)); err != nil {
+			problems = append(problems, fmt.Sprintf("preparer.hooks_manifest: %s", err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// checkUnknownKeys returns a ConfigError naming every key under "preparer"
+// that doesn't correspond to a field of PreparerConfig, so that typos don't
+// silently fall back to defaults. Other top level keys belong to other
+// programs sharing the config and are ignored.
+func checkUnknownKeys(config []byte) error {
+	var raw map[string]interface{}
+	err := yaml.Unmarshal(config, &raw)
+	if err != nil {
+		return util.Errorf("The config file %s was malformatted - %s", config, err)
+	}
+	preparerSection, ok := raw["preparer"]
+	if !ok {
+		return nil
+	}
+
+	var problems ConfigError
+	findUnknownKeys("preparer", preparerSection, reflect.TypeOf(&PreparerConfig{}), &problems)
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return problems
+	}
+	return nil
+}
+
+func findUnknownKeys(path string, value interface{}, t reflect.Type, problems *ConfigError) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		// values of the wrong type are reported by yaml.Unmarshal
+		m, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		fields := yamlFields(t)
+		for k, v := range m {
+			key := fmt.Sprint(k)
+			field, ok := fields[key]
+			if !ok {
+				*problems = append(*problems, fmt.Sprintf("%s.%s: unknown key", path, key))
+				continue
+			}
+			findUnknownKeys(path+"."+key, v, field.Type, problems)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			findUnknownKeys(fmt.Sprintf("%s[%d]", path, i), item, t.Elem(), problems)
+		}
+	}
+}
+
+// yamlFields maps the keys yaml.v2 decodes into a struct type to its fields
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, inline := yamlName(field)
+		if inline {
+			for key, inlined := range yamlFields(field.Type) {
+				fields[key] = inlined
+			}
+		} else if name != "" {
+			fields[name] = field
+		}
+	}
+	return fields
+}
+
+// yamlName returns the key of a struct field as yaml.v2 names it, which is
+// empty if the field is skipped
+func yamlName(field reflect.StructField) (string, bool) {
+	tag := strings.Split(field.Tag.Get("yaml"), ",")
+	for _, flag := range tag[1:] {
+		if flag == "inline" {
+			return "", true
+		}
+	}
+	switch tag[0] {
+	case "-":
+		return "", false
+	case "":
+		return strings.ToLower(field.Name), false
+	}
+	return tag[0], false
+}
+
+// restartRequiredKeys returns the keys whose values differ between the two
+// configs and that Reload() can't apply
+func restartRequiredKeys(running *PreparerConfig, loaded *PreparerConfig) []string {
+	var keys []string
+	t := reflect.TypeOf(running).Elem()
+	runningValue := reflect.ValueOf(running).Elem()
+	loadedValue := reflect.ValueOf(loaded).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, _ := yamlName(field)
+		if name == "" || reloadableKeys[name] {
+			continue
+		}
+		runningField, loadedField := runningValue.Field(i).Interface(), loadedValue.Field(i).Interface()
+		if name == "secrets" {
+			// the secrets policy is reloaded, but changes to the other
+			// secrets settings still require a restart
+			runningSecrets, loadedSecrets := running.Secrets, loaded.Secrets
+			runningSecrets.PolicyPath, loadedSecrets.PolicyPath = "", ""
+			runningField, loadedField = runningSecrets, loadedSecrets
+		}
+		if !reflect.DeepEqual(runningField, loadedField) {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+func (p *Preparer) currentHooks() Hooks {
+	p.configMux.RLock()
+	defer p.configMux.RUnlock()
+	return p.hooks
+}
+
+func (p *Preparer) currentHooksExecDir() string {
+	p.configMux.RLock()
+	defer p.configMux.RUnlock()
+	return p.hooksExecDir
+}
+
+// acquireAuthPolicy returns the current deployer auth policy and a function
+// to call once done with it. A policy replaced by Reload is only closed once
+// everything that acquired it has released it.
+func (p *Preparer) acquireAuthPolicy() (auth.Policy, func()) {
+	p.configMux.RLock()
+	defer p.configMux.RUnlock()
+	users := p.authPolicyUsers
+	if users == nil {
+		return p.authPolicy, func() {}
+	}
+	users.Add(1)
+	return p.authPolicy, users.Done
+}
+
+func (p *Preparer) currentSecretsPolicy() secrets.Policy {
+	p.configMux.RLock()
+	defer p.configMux.RUnlock()
+	return p.secretsPolicy
+}
+
+func (p *Preparer) currentLogBridgeBlacklist() []string {
+	p.configMux.RLock()
+	defer p.configMux.RUnlock()
+	return p.logBridgeBlacklist
+}
+
+// Reload applies the settings of newConfig that are safe to change while pods
+// are running: the log level, the hooks directory, the deployer auth policy
+// (whose keyrings are re-read even if the settings are unchanged), the log
+// bridge blacklist, the secrets policy (which is likewise re-read) and the
+// params. Running pods are not touched; the
+// blacklist applies from the next launch. Params that were removed from the
+// config keep their current values.
+//
+// The returned keys differ from the config the preparer was started with but
+// only take effect after a restart. If an error is returned, nothing was
+// applied, except possibly some of the params.
+func (p *Preparer) Reload(newConfig *PreparerConfig) ([]string, error) {
+	err := newConfig.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	level := p.Logger.Logger.Level
+	if newConfig.LogLevel != "" {
+		level, err = logrus.ParseLevel(newConfig.LogLevel)
+		if err != nil {
+			return nil, util.Errorf("Received invalid log level %q", newConfig.LogLevel)
+		}
+	}
+	authPolicy, err := getDeployerAuth(newConfig)
+	if err != nil {
+		return nil, err
+	}
+	secretsPolicy, err := getSecretsPolicy(newConfig)
+	if err != nil {
+		authPolicy.Close()
+		return nil, err
+	}
+	err = param.Parse(newConfig.Params)
+	if err != nil {
+		authPolicy.Close()
+		return nil, util.Errorf("invalid parameter: %s", err)
+	}
+
+	p.configMux.Lock()
+	oldAuthPolicy, oldAuthPolicyUsers := p.authPolicy, p.authPolicyUsers
+	p.authPolicy = authPolicy
+	p.authPolicyUsers = new(sync.WaitGroup)
+	p.logBridgeBlacklist = newConfig.LogBridgeBlacklist
+	p.secretsPolicy = secretsPolicy
+	hooksDirChanged := newConfig.HooksDirectory != p.hooksExecDir
+	if hooksDirChanged {
+		// the audit logger is shared with the old context, which is
+		// dropped without being closed
+		p.hooks = hooks.NewContext(newConfig.HooksDirectory, p.podRoot, &p.Logger, p.hooksAuditLogger, p.hooksPodLabeler)
+		p.hooksExecDir = newConfig.HooksDirectory
+	}
+	p.Logger.Logger.Level = level
+	p.configMux.Unlock()
+
+	if oldAuthPolicy != nil {
+		// nothing can acquire the old policy anymore, but it may still
+		// be in use
+		go func() {
+			if oldAuthPolicyUsers != nil {
+				oldAuthPolicyUsers.Wait()
+			}
+			oldAuthPolicy.Close()
+		}()
+	}
+	if hooksDirChanged {
+		// link the hook scripts into the new directory. A failure is logged
+		// by InstallHooks and retried by the next reload or restart
+		_ = p.InstallHooks()
+	}
+
+	if p.config == nil {
+		return nil, nil
+	}
+	return restartRequiredKeys(p.config, newConfig), nil
+}
+
+// WatchConfig reloads the config file at configPath whenever the preparer
+// receives SIGHUP or the file's modification time changes, until quit is
+// closed. A config that can't be loaded or applied is logged and the
+// preparer keeps running with its current settings.
+func (p *Preparer) WatchConfig(configPath string, quit <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	logger := p.Logger.SubLogger(logrus.Fields{"config_path": configPath})
+	lastModified := modTime(configPath)
+	for {
+		select {
+		case <-quit:
+			return
+		case <-hup:
+			logger.NoFields().Infoln("Received SIGHUP, reloading config")
+		case <-ticker.C:
+			modified := modTime(configPath)
+			if modified.Equal(lastModified) {
+				continue
+			}
+			logger.NoFields().Infoln("Config file changed, reloading config")
+		}
+		lastModified = modTime(configPath)
+
+		newConfig, err := LoadConfig(configPath)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not load config, keeping the current one")
+			continue
+		}
+		restartKeys, err := p.Reload(newConfig)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not apply config, keeping the current one")
+			continue
+		}
+		if len(restartKeys) > 0 {
+			logger.WithField("keys", restartKeys).Warnln("Some config changes will only take effect after a restart")
+		}
+		logger.NoFields().Infoln("Reloaded config")
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
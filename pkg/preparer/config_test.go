@@ -0,0 +1,190 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/secrets"
+)
+
+func TestUnmarshalConfigRejectsUnknownKeys(t *testing.T) {
+	config := `
+preparer:
+  auth:
+    type: keyring
+    keyring: /etc/p2.keyring
+    keyrnig_path: /etc/other.keyring
+  hooks_dir: /etc/p2/hooks
+  node_registry:
+    heartbeat_interval: 30s
+    labels:
+      anything: goes
+  extra_log_destinations:
+  - type: socket
+    path: /var/log/p2-socket.out
+    pth: /var/log/typo
+  params:
+    whatever: 1
+other_program:
+  not_checked: true
+`
+	_, err := UnmarshalConfig([]byte(config))
+	Assert(t).IsNotNil(err, "expected unknown keys to be rejected")
+	configErr, ok := err.(ConfigError)
+	Assert(t).IsTrue(ok, "expected a ConfigError")
+	Assert(t).AreEqual(len(configErr), 3, "expected one problem per unknown key")
+	Assert(t).AreEqual(configErr[0], "preparer.auth.keyrnig_path: unknown key", "wrong problem")
+	Assert(t).AreEqual(configErr[1], "preparer.extra_log_destinations[0].pth: unknown key", "wrong problem")
+	Assert(t).AreEqual(configErr[2], "preparer.hooks_dir: unknown key", "wrong problem")
+}
+
+func TestUnmarshalConfigValidates(t *testing.T) {
+	config := `
+preparer:
+  auth:
+    type: user
+    keyring: /etc/p2.keyring
+  artifact_auth:
+    type: signed
+  log_level: loud
+  max_launchable_disk_usage: lots
+  supervisor:
+    type: upstart
+`
+	_, err := UnmarshalConfig([]byte(config))
+	Assert(t).IsNotNil(err, "expected an invalid config to be rejected")
+	configErr, ok := err.(ConfigError)
+	Assert(t).IsTrue(ok, "expected a ConfigError")
+	Assert(t).AreEqual(len(configErr), 5, "expected every problem to be reported")
+	for i, prefix := range []string{
+		"preparer.auth.deploy_policy:",
+		"preparer.artifact_auth.type:",
+		"preparer.log_level:",
+		"preparer.max_launchable_disk_usage:",
+		"preparer.supervisor.type:",
+	} {
+		Assert(t).IsTrue(strings.HasPrefix(configErr[i], prefix), "expected "+prefix+" but got "+configErr[i])
+	}
+}
+
+func TestUnmarshalConfigInventoryIsIndependentOfNodeRegistry(t *testing.T) {
+	config := `
+preparer:
+  node_registry:
+    disable: true
+  inventory:
+    interval: 5m
+`
+	preparerConfig, err := UnmarshalConfig([]byte(config))
+	Assert(t).IsNil(err, "expected the config to be valid")
+	Assert(t).IsTrue(preparerConfig.NodeRegistryConfig.Disable, "expected node registration to be disabled")
+	Assert(t).IsFalse(preparerConfig.Inventory.Disable, "expected inventory reporting to stay enabled")
+	Assert(t).AreEqual(preparerConfig.Inventory.Interval, 5*time.Minute, "wrong inventory interval")
+}
+
+func TestRestartRequiredKeysIgnoresSecretsPolicy(t *testing.T) {
+	running := &PreparerConfig{
+		Secrets: SecretsConfig{Provider: secrets.FileProviderType, Directory: "/secrets", PolicyPath: "/etc/policy.yaml"},
+	}
+	loaded := &PreparerConfig{
+		Secrets: SecretsConfig{Provider: secrets.FileProviderType, Directory: "/secrets", PolicyPath: "/etc/other_policy.yaml"},
+	}
+	Assert(t).AreEqual(len(restartRequiredKeys(running, loaded)), 0, "expected the secrets policy to be reloaded")
+
+	loaded.Secrets.Directory = "/other_secrets"
+	keys := restartRequiredKeys(running, loaded)
+	Assert(t).AreEqual(len(keys), 1, "expected the secrets directory to require a restart")
+	Assert(t).AreEqual(keys[0], "secrets", "wrong key requiring a restart")
+}
+
+func TestReloadAppliesSafeSubset(t *testing.T) {
+	p, _, podRoot := testPreparer(t, &FakeStore{})
+	defer os.RemoveAll(podRoot)
+	level := p.Logger.Logger.Level
+	defer func() { p.Logger.Logger.Level = level }()
+	p.authPolicy = auth.FixedKeyringPolicy{}
+
+	hooksDir, err := ioutil.TempDir("", "hooks")
+	Assert(t).IsNil(err, "test setup: could not create hooks dir")
+	defer os.RemoveAll(hooksDir)
+
+	newConfig := &PreparerConfig{
+		NodeName:           "hostname",
+		ConsulAddress:      "10.0.0.1",
+		HooksDirectory:     hooksDir,
+		PodRoot:            podRoot,
+		Auth:               AuthConfig{Type: auth.Null},
+		LogLevel:           "debug",
+		LogBridgeBlacklist: []string{"noisy"},
+		HooksManifest:      NoHooksSentinelValue,
+	}
+	restartKeys, err := p.Reload(newConfig)
+	Assert(t).IsNil(err, "reload should have succeeded")
+	Assert(t).AreEqual(len(restartKeys), 1, "expected only the consul address to require a restart")
+	Assert(t).AreEqual(restartKeys[0], "consul_address", "wrong key requiring a restart")
+
+	authPolicy, release := p.acquireAuthPolicy()
+	release()
+	_, ok := authPolicy.(auth.NullPolicy)
+	Assert(t).IsTrue(ok, "expected the auth policy to be replaced")
+	Assert(t).AreEqual(p.currentHooksExecDir(), hooksDir, "expected the hooks directory to be replaced")
+	Assert(t).AreEqual(len(p.currentLogBridgeBlacklist()), 1, "expected the blacklist to be replaced")
+	Assert(t).AreEqual(p.Logger.Logger.Level, logrus.DebugLevel, "expected the log level to be replaced")
+
+	newConfig.Auth = AuthConfig{Type: auth.Keyring}
+	_, err = p.Reload(newConfig)
+	Assert(t).IsNotNil(err, "expected an invalid config not to be applied")
+	authPolicy, release = p.acquireAuthPolicy()
+	release()
+	_, ok = authPolicy.(auth.NullPolicy)
+	Assert(t).IsTrue(ok, "expected the auth policy to be kept")
+}
+
+// closeRecordingPolicy records when it is closed
+type closeRecordingPolicy struct {
+	auth.NullPolicy
+	closed chan struct{}
+}
+
+func (p closeRecordingPolicy) Close() {
+	close(p.closed)
+}
+
+func TestReloadClosesReplacedAuthPolicyOnceReleased(t *testing.T) {
+	p, _, podRoot := testPreparer(t, &FakeStore{})
+	defer os.RemoveAll(podRoot)
+	oldPolicy := closeRecordingPolicy{closed: make(chan struct{})}
+	p.authPolicy = oldPolicy
+
+	inUse, release := p.acquireAuthPolicy()
+	Assert(t).AreEqual(inUse, auth.Policy(oldPolicy), "expected the current policy")
+
+	_, err := p.Reload(&PreparerConfig{
+		NodeName:       "hostname",
+		ConsulAddress:  "0.0.0.0",
+		HooksDirectory: p.currentHooksExecDir(),
+		PodRoot:        podRoot,
+		Auth:           AuthConfig{Type: auth.Null},
+		HooksManifest:  NoHooksSentinelValue,
+	})
+	Assert(t).IsNil(err, "reload should have succeeded")
+
+	select {
+	case <-oldPolicy.closed:
+		t.Fatal("the replaced policy was closed while still in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case <-oldPolicy.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the replaced policy was not closed once released")
+	}
+}
@@ -0,0 +1,117 @@
+package preparer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/statusstore/podevents"
+	"github.com/square/p2/pkg/types"
+)
+
+const (
+	// Events waiting to be written to the status store. If consul is
+	// unavailable for long enough to fill this, new events are dropped
+	// rather than blocking pod deploys.
+	eventPublishBuffer = 1000
+
+	// Events buffered for each streaming client. Slow clients miss events
+	// rather than blocking pod deploys.
+	eventSubscriberBuffer = 100
+)
+
+type PodEventStore interface {
+	Append(event podevents.Event) error
+	Delete(node types.NodeName, podID types.PodID, uniqueKey types.PodUniqueKey) error
+}
+
+// EventStream distributes preparer lifecycle events to the status store and
+// to any clients streaming them from the status server. Emitting an event
+// never blocks.
+type EventStream struct {
+	store   PodEventStore
+	logger  logging.Logger
+	publish chan podevents.Event
+
+	subscribersMu sync.Mutex
+	subscribers   map[chan podevents.Event]struct{}
+}
+
+func NewEventStream(store PodEventStore, logger logging.Logger) *EventStream {
+	return &EventStream{
+		store:       store,
+		logger:      logger,
+		publish:     make(chan podevents.Event, eventPublishBuffer),
+		subscribers: make(map[chan podevents.Event]struct{}),
+	}
+}
+
+// Emit records an event. The event's Time is set to now if it is empty.
+// Emitting to a nil EventStream does nothing.
+func (s *EventStream) Emit(event podevents.Event) {
+	if s == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	select {
+	case s.publish <- event:
+	default:
+		s.logger.WithField("event", event.Type).Warnln("Event publish buffer is full, dropping event")
+	}
+
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives every event emitted from now on,
+// and a function that must be called to stop receiving them.
+func (s *EventStream) Subscribe() (<-chan podevents.Event, func()) {
+	ch := make(chan podevents.Event, eventSubscriberBuffer)
+
+	s.subscribersMu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.subscribersMu.Unlock()
+
+	return ch, func() {
+		s.subscribersMu.Lock()
+		delete(s.subscribers, ch)
+		s.subscribersMu.Unlock()
+	}
+}
+
+// Run writes emitted events to the status store until quit is closed. A
+// successful uninstall deletes the pod's events instead, so that records of
+// pods that no longer exist don't accumulate. Streaming clients still see
+// the Uninstalled event.
+func (s *EventStream) Run(quit <-chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+		case event := <-s.publish:
+			var err error
+			if event.Type == podevents.Uninstalled && event.Error == "" {
+				err = s.store.Delete(event.Node, event.PodID, event.PodUniqueKey)
+			} else {
+				err = s.store.Append(event)
+			}
+			if err != nil {
+				s.logger.WithErrorAndFields(err, logrus.Fields{
+					"pod":   event.PodID,
+					"event": event.Type,
+				}).Warnln("Could not publish pod event")
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package preparer
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/statusstore/podevents"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeEventStore struct {
+	events  chan podevents.Event
+	deleted chan types.PodID
+}
+
+func (f fakeEventStore) Append(event podevents.Event) error {
+	f.events <- event
+	return nil
+}
+
+func (f fakeEventStore) Delete(node types.NodeName, podID types.PodID, uniqueKey types.PodUniqueKey) error {
+	f.deleted <- podID
+	return nil
+}
+
+func TestEventStreamPublishesAndBroadcasts(t *testing.T) {
+	store := fakeEventStore{events: make(chan podevents.Event, 1)}
+	stream := NewEventStream(store, logging.DefaultLogger)
+	quit := make(chan struct{})
+	defer close(quit)
+	go stream.Run(quit)
+
+	subscription, unsubscribe := stream.Subscribe()
+	stream.Emit(podevents.Event{Type: podevents.PodReceived, PodID: "app"})
+
+	select {
+	case event := <-subscription:
+		Assert(t).AreEqual(event.Type, podevents.PodReceived, "subscriber got the wrong event")
+		Assert(t).IsFalse(event.Time.IsZero(), "expected the event time to be set")
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber did not receive event")
+	}
+
+	select {
+	case event := <-store.events:
+		Assert(t).AreEqual(event.PodID.String(), "app", "store got the wrong event")
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not published to the store")
+	}
+
+	unsubscribe()
+	stream.Emit(podevents.Event{Type: podevents.Launched, PodID: "app"})
+	select {
+	case event := <-subscription:
+		t.Errorf("did not expect to receive events after unsubscribing, got %s", event.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEventStreamDeletesEventsOfUninstalledPods(t *testing.T) {
+	store := fakeEventStore{
+		events:  make(chan podevents.Event, 2),
+		deleted: make(chan types.PodID, 2),
+	}
+	stream := NewEventStream(store, logging.DefaultLogger)
+	quit := make(chan struct{})
+	defer close(quit)
+	go stream.Run(quit)
+
+	// a failed uninstall leaves the pod in place, so its events are kept
+	stream.Emit(podevents.Event{Type: podevents.Uninstalled, PodID: "failed", Error: "busy"})
+	stream.Emit(podevents.Event{Type: podevents.Uninstalled, PodID: "app"})
+
+	select {
+	case event := <-store.events:
+		Assert(t).AreEqual(event.PodID.String(), "failed", "expected the failed uninstall to be appended")
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed uninstall was not published to the store")
+	}
+
+	select {
+	case podID := <-store.deleted:
+		Assert(t).AreEqual(podID.String(), "app", "deleted the wrong pod's events")
+	case <-time.After(5 * time.Second):
+		t.Fatal("events of the uninstalled pod were not deleted")
+	}
+
+	select {
+	case event := <-store.events:
+		t.Errorf("did not expect the successful uninstall to be appended, got %s", event.PodID)
+	default:
+	}
+}
+
+func TestStatusServerStreamsEvents(t *testing.T) {
+	stream := NewEventStream(fakeEventStore{events: make(chan podevents.Event, 10)}, logging.DefaultLogger)
+	statusServer := &StatusServer{mux: http.NewServeMux()}
+	statusServer.HandleEvents(stream)
+	server := httptest.NewServer(statusServer.mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/_events?pod=app")
+	Assert(t).IsNil(err, "could not connect to event stream")
+	defer resp.Body.Close()
+
+	// the other pod's event should be filtered out
+	stream.Emit(podevents.Event{Type: podevents.PodReceived, PodID: "other"})
+	stream.Emit(podevents.Event{Type: podevents.Launched, PodID: "app"})
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	select {
+	case line := <-lines:
+		var event podevents.Event
+		err = json.Unmarshal([]byte(line), &event)
+		Assert(t).IsNil(err, "could not unmarshal streamed event")
+		Assert(t).AreEqual(event.Type, podevents.Launched, "streamed the wrong event")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event was streamed")
+	}
+}
+
+func TestResolvePairEmitsLifecycleEvents(t *testing.T) {
+	testPod := &TestPod{
+		launchSuccess: true,
+	}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	subscription, unsubscribe := p.Events.Subscribe()
+	defer unsubscribe()
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "should have succeeded")
+
+	var types []podevents.EventType
+	for len(subscription) > 0 {
+		types = append(types, (<-subscription).Type)
+	}
+	expected := []podevents.EventType{
+		podevents.HookRan, // before_install
+		podevents.DownloadStarted,
+		podevents.DownloadFinished,
+		podevents.HookRan, // after_install
+		podevents.HookRan, // before_launch
+		podevents.Launched,
+		podevents.HookRan, // after_launch
+	}
+	Assert(t).AreEqual(len(types), len(expected), "unexpected number of events")
+	for i := range expected {
+		if i < len(types) && types[i] != expected[i] {
+			t.Errorf("expected event %d to be %s, was %s", i, expected[i], types[i])
+		}
+	}
+}
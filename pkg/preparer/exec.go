@@ -0,0 +1,396 @@
+package preparer
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// Connections to /_exec are upgraded to this protocol, over which the
+// command's streams are sent as frames. A frame is a one byte stream ID, a
+// four byte big endian payload length and the payload.
+const ExecProtocol = "p2-exec"
+
+// The streams of the exec protocol. An empty stdin frame closes the
+// command's stdin. The payload of the exit frame, which is the last frame
+// sent, is the command's exit code as a four byte big endian integer.
+const (
+	ExecStdin  byte = 0
+	ExecStdout byte = 1
+	ExecStderr byte = 2
+	ExecExit   byte = 3
+)
+
+const (
+	maxExecFrameSize = 1 << 20
+
+	// the exit code of a command that could not be started, as in shells
+	execNotStartedExitCode = 127
+)
+
+// WriteExecFrame writes a frame of the exec protocol.
+func WriteExecFrame(w io.Writer, stream byte, payload []byte) error {
+	header := make([]byte, 5)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+// ReadExecFrame reads a frame of the exec protocol.
+func ReadExecFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxExecFrameSize {
+		return 0, nil, util.Errorf("exec frame of %d bytes is too large", size)
+	}
+	payload := make([]byte, size)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// execStreamWriter writes to one of the streams of a connection that is
+// shared with other streams.
+type execStreamWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	stream byte
+}
+
+func (e execStreamWriter) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	err := WriteExecFrame(e.w, e.stream, p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Executor builds the commands that /_exec sessions run. It returns
+// pods.NoCurrentManifest if the pod isn't installed.
+type Executor interface {
+	ExecCommand(podID types.PodID, uniqueKey types.PodUniqueKey, launchableID launch.LaunchableID, command []string) ([]string, error)
+}
+
+// ExecAuditor records /_exec sessions in the audit log.
+type ExecAuditor interface {
+	AuditExec(eventType audit.EventType, details audit.ExecDetails) error
+}
+
+// ExecCommand returns the command that runs a command in one of the
+// launchables of a pod installed on this node, as the pod's user and in the
+// launchable's environment and cgroup.
+func (p *Preparer) ExecCommand(podID types.PodID, uniqueKey types.PodUniqueKey, launchableID launch.LaunchableID, command []string) ([]string, error) {
+	var pod *pods.Pod
+	var err error
+	if uniqueKey == "" {
+		pod = p.podFactory.NewLegacyPod(podID)
+	} else {
+		pod, err = p.podFactory.NewUUIDPod(podID, uniqueKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pod.Supervisor = p.supervisor
+
+	manifest, err := pod.CurrentManifest()
+	if err != nil {
+		return nil, err
+	}
+	return pod.ExecCommand(manifest, launchableID, command)
+}
+
+// AuditExec writes an exec session event for this node to the audit log.
+func (p *Preparer) AuditExec(eventType audit.EventType, details audit.ExecDetails) error {
+	details.Node = p.node
+	eventDetails, err := audit.NewExecDetails(details)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err = auditlogstore.NewConsulStore(p.client.KV()).Create(ctx, eventType, eventDetails)
+	if err != nil {
+		return err
+	}
+	return transaction.MustCommit(ctx, p.client.KV())
+}
+
+// HandleExec runs commands in pods at /_exec. It must only be installed on a
+// status server from NewTLSStatusServer. Requests must be made with a client
+// certificate whose common name is one of users, and must be POSTs that ask
+// to upgrade the connection to ExecProtocol. The common name is recorded as
+// the user in the audit log. The query parameters are:
+//
+//	pod            - the pod ID (required)
+//	pod_unique_key - the pod's unique key, for pods that have one
+//	launchable     - the launchable to run the command in, required if the
+//	                 pod has more than one
+//	command        - the command and its arguments, one parameter each
+//	                 (required)
+//
+// A session is only started once it has been written to the audit log. The
+// command and every process it started are killed if the client
+// disconnects. It may be called after Serve().
+func (s *StatusServer) HandleExec(executor Executor, auditor ExecAuditor, users []string) {
+	allowed := make(map[string]bool)
+	for _, user := range users {
+		allowed[user] = true
+	}
+	s.mux.HandleFunc("/_exec", func(w http.ResponseWriter, r *http.Request) {
+		user, ok := callerName(r)
+		if !ok {
+			http.Error(w, "a client certificate is required", http.StatusUnauthorized)
+			return
+		}
+		if !allowed[user] {
+			http.Error(w, fmt.Sprintf("%s may not run commands", user), http.StatusForbidden)
+			return
+		}
+		if r.Method != "POST" || r.Header.Get("Upgrade") != ExecProtocol {
+			http.Error(w, fmt.Sprintf("expected a POST upgrading to %s", ExecProtocol), http.StatusBadRequest)
+			return
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "connection upgrades are not supported", http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		details := audit.ExecDetails{
+			PodID:        types.PodID(query.Get("pod")),
+			PodUniqueKey: types.PodUniqueKey(query.Get("pod_unique_key")),
+			LaunchableID: launch.LaunchableID(query.Get("launchable")),
+			Command:      query["command"],
+			User:         user,
+			RemoteAddr:   r.RemoteAddr,
+		}
+		if details.PodID == "" || len(details.Command) == 0 {
+			http.Error(w, "the pod and command parameters are required", http.StatusBadRequest)
+			return
+		}
+
+		command, err := executor.ExecCommand(details.PodID, details.PodUniqueKey, details.LaunchableID, details.Command)
+		if err == pods.NoCurrentManifest {
+			http.Error(w, "pod is not installed", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger := s.logger.SubLogger(logrus.Fields{
+			"pod":        details.PodID,
+			"launchable": details.LaunchableID,
+			"command":    strings.Join(details.Command, " "),
+			"user":       details.User,
+			"remote":     details.RemoteAddr,
+		})
+		err = auditor.AuditExec(audit.ExecStartedEvent, details)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not write exec session to the audit log, refusing it")
+			http.Error(w, "could not write the session to the audit log", http.StatusServiceUnavailable)
+			return
+		}
+
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			logger.WithError(err).Errorln("Could not upgrade exec connection")
+			return
+		}
+		defer conn.Close()
+		_, err = fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", ExecProtocol)
+		if err == nil {
+			err = buf.Flush()
+		}
+		if err != nil {
+			logger.WithError(err).Errorln("Could not upgrade exec connection")
+			return
+		}
+
+		logger.NoFields().Infoln("Starting exec session")
+		start := time.Now()
+		exitCode := runExec(command, conn, buf.Reader)
+		details.ExitCode = &exitCode
+		details.Duration = time.Since(start)
+		logger.WithFields(logrus.Fields{
+			"exit_code": exitCode,
+			"duration":  details.Duration,
+		}).Infoln("Finished exec session")
+
+		err = auditor.AuditExec(audit.ExecFinishedEvent, details)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not write the end of an exec session to the audit log")
+		}
+	})
+}
+
+// runExec runs a command in its own process group, connecting its streams
+// to an exec protocol connection, and returns its exit code.
+func runExec(command []string, conn net.Conn, reader *bufio.Reader) int {
+	var mu sync.Mutex
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdout = execStreamWriter{mu: &mu, w: conn, stream: ExecStdout}
+	cmd.Stderr = execStreamWriter{mu: &mu, w: conn, stream: ExecStderr}
+	stdin, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		_, _ = cmd.Stderr.Write([]byte(fmt.Sprintf("Could not start command: %s\n", err)))
+		writeExit(&mu, conn, execNotStartedExitCode)
+		return execNotStartedExitCode
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			stream, payload, err := ReadExecFrame(reader)
+			if err != nil {
+				select {
+				case <-done:
+				default:
+					// the client went away. The process group ID is
+					// the PID of its leader
+					_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+				}
+				return
+			}
+			if stream != ExecStdin {
+				continue
+			}
+			if len(payload) == 0 {
+				_ = stdin.Close()
+				continue
+			}
+			// the command may have closed its stdin
+			_, _ = stdin.Write(payload)
+		}
+	}()
+
+	exitCode := 0
+	err = cmd.Wait()
+	close(done)
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = -1
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Exited() {
+			exitCode = status.ExitStatus()
+		}
+	} else if err != nil {
+		exitCode = -1
+	}
+	writeExit(&mu, conn, exitCode)
+	return exitCode
+}
+
+func writeExit(mu *sync.Mutex, w io.Writer, exitCode int) {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(int32(exitCode)))
+	mu.Lock()
+	defer mu.Unlock()
+	_ = WriteExecFrame(w, ExecExit, payload)
+}
+
+// RemoteExec runs a command through the /_exec endpoint of the preparer
+// serving TLS at address, connecting it to the given streams, and returns its
+// exit code. tlsConfig must hold the client certificate to authenticate
+// with. The query holds the parameters documented on HandleExec.
+func RemoteExec(address string, query url.Values, tlsConfig *tls.Config, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
+	conn, err := tls.Dial("tcp", address, tlsConfig)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	execURL := url.URL{Scheme: "https", Host: address, Path: "/_exec", RawQuery: query.Encode()}
+	req, err := http.NewRequest("POST", execURL.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", ExecProtocol)
+	err = req.Write(conn)
+	if err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return 0, util.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := stdin.Read(buf)
+			if n > 0 && WriteExecFrame(conn, ExecStdin, buf[:n]) != nil {
+				return
+			}
+			if err != nil {
+				// tell the command there's no more input
+				_ = WriteExecFrame(conn, ExecStdin, nil)
+				return
+			}
+		}
+	}()
+
+	for {
+		stream, payload, err := ReadExecFrame(reader)
+		if err != nil {
+			return 0, util.Errorf("Connection closed before the command exited: %s", err)
+		}
+		switch stream {
+		case ExecStdout:
+			_, err = stdout.Write(payload)
+		case ExecStderr:
+			_, err = stderr.Write(payload)
+		case ExecExit:
+			if len(payload) != 4 {
+				return 0, util.Errorf("Malformed exit frame")
+			}
+			return int(int32(binary.BigEndian.Uint32(payload))), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
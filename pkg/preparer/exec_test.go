@@ -0,0 +1,222 @@
+package preparer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// fakeExecutor runs the requested command with sh instead of p2-exec
+type fakeExecutor struct{}
+
+func (fakeExecutor) ExecCommand(podID types.PodID, uniqueKey types.PodUniqueKey, launchableID launch.LaunchableID, command []string) ([]string, error) {
+	if podID != "web" {
+		return nil, pods.NoCurrentManifest
+	}
+	return append([]string{"sh", "-c"}, command...), nil
+}
+
+type fakeExecAuditor struct {
+	mu     sync.Mutex
+	events []audit.EventType
+	last   audit.ExecDetails
+	fail   bool
+}
+
+func (f *fakeExecAuditor) AuditExec(eventType audit.EventType, details audit.ExecDetails) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return util.Errorf("audit log is unavailable")
+	}
+	f.events = append(f.events, eventType)
+	f.last = details
+	return nil
+}
+
+// testCA signs client certificates for exec tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Assert(t).IsNil(err, "Could not generate CA key")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Assert(t).IsNil(err, "Could not create CA certificate")
+	cert, err := x509.ParseCertificate(der)
+	Assert(t).IsNil(err, "Could not parse CA certificate")
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca testCA) clientCert(t *testing.T, name string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Assert(t).IsNil(err, "Could not generate client key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	Assert(t).IsNil(err, "Could not create client certificate")
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func execServer(auditor ExecAuditor, ca testCA) *httptest.Server {
+	statusServer := &StatusServer{mux: http.NewServeMux(), logger: &logging.DefaultLogger}
+	statusServer.HandleExec(fakeExecutor{}, auditor, []string{"alice"})
+	server := httptest.NewUnstartedServer(statusServer.mux)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  ca.pool,
+	}
+	server.StartTLS()
+	return server
+}
+
+// clientTLSConfig trusts the server and presents the given certificates
+func clientTLSConfig(server *httptest.Server, certs ...tls.Certificate) *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return &tls.Config{RootCAs: roots, Certificates: certs}
+}
+
+func execQuery(pod string, command string) url.Values {
+	return url.Values{
+		"pod":     {pod},
+		"command": {command},
+	}
+}
+
+func TestRemoteExecStreamsAndAudits(t *testing.T) {
+	auditor := &fakeExecAuditor{}
+	ca := newTestCA(t)
+	server := execServer(auditor, ca)
+	defer server.Close()
+	address := server.Listener.Addr().String()
+	alice := clientTLSConfig(server, ca.clientCert(t, "alice"))
+
+	var stdout, stderr bytes.Buffer
+	exitCode, err := RemoteExec(address, execQuery("web", "tr a-z A-Z; echo oops >&2; exit 3"), alice, strings.NewReader("hello\n"), &stdout, &stderr)
+	Assert(t).IsNil(err, "remote exec failed")
+	Assert(t).AreEqual(exitCode, 3, "wrong exit code")
+	Assert(t).AreEqual(stdout.String(), "HELLO\n", "wrong stdout")
+	Assert(t).AreEqual(stderr.String(), "oops\n", "wrong stderr")
+
+	auditor.mu.Lock()
+	Assert(t).AreEqual(len(auditor.events), 2, "expected the start and end of the session to be audited")
+	Assert(t).AreEqual(auditor.events[0], audit.ExecStartedEvent, "wrong first event")
+	Assert(t).AreEqual(auditor.events[1], audit.ExecFinishedEvent, "wrong second event")
+	Assert(t).AreEqual(auditor.last.User, "alice", "wrong user")
+	Assert(t).IsTrue(auditor.last.ExitCode != nil && *auditor.last.ExitCode == 3, "expected the exit code to be audited")
+	auditor.mu.Unlock()
+
+	_, err = RemoteExec(address, execQuery("web", "true"), clientTLSConfig(server), strings.NewReader(""), &stdout, &stderr)
+	Assert(t).IsNotNil(err, "expected a client without a certificate to be rejected")
+	_, err = RemoteExec(address, execQuery("web", "true"), clientTLSConfig(server, ca.clientCert(t, "mallory")), strings.NewReader(""), &stdout, &stderr)
+	Assert(t).IsNotNil(err, "expected a user who may not run commands to be rejected")
+	_, err = RemoteExec(address, execQuery("web", "true"), clientTLSConfig(server, newTestCA(t).clientCert(t, "alice")), strings.NewReader(""), &stdout, &stderr)
+	Assert(t).IsNotNil(err, "expected a certificate from another CA to be rejected")
+	_, err = RemoteExec(address, execQuery("other", "true"), alice, strings.NewReader(""), &stdout, &stderr)
+	Assert(t).IsNotNil(err, "expected a pod that isn't installed to be rejected")
+}
+
+func TestRemoteExecRefusedWithoutAudit(t *testing.T) {
+	ca := newTestCA(t)
+	server := execServer(&fakeExecAuditor{fail: true}, ca)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	_, err := RemoteExec(server.Listener.Addr().String(), execQuery("web", "echo ran"), clientTLSConfig(server, ca.clientCert(t, "alice")), strings.NewReader(""), &stdout, &stderr)
+	Assert(t).IsNotNil(err, "expected the session to be refused when it can't be audited")
+	Assert(t).AreEqual(stdout.String(), "", "expected the command not to run")
+}
+
+func TestExecKillsProcessGroupOnDisconnect(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "exec_test")
+	Assert(t).IsNil(err, "Could not create temp dir")
+	defer os.RemoveAll(tempDir)
+	pidFile := filepath.Join(tempDir, "pid")
+
+	serverConn, clientConn := net.Pipe()
+	exited := make(chan int)
+	go func() {
+		exited <- runExec([]string{"/bin/sh", "-c", "sleep 30 & echo $! > " + pidFile + "; echo started; wait"}, serverConn, bufio.NewReader(serverConn))
+	}()
+
+	stream, payload, err := ReadExecFrame(clientConn)
+	Assert(t).IsNil(err, "Could not read output")
+	Assert(t).AreEqual(stream, ExecStdout, "expected output")
+	Assert(t).AreEqual(string(payload), "started\n", "wrong output")
+	_ = clientConn.Close()
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was not killed when the client disconnected")
+	}
+
+	pidBytes, err := ioutil.ReadFile(pidFile)
+	Assert(t).IsNil(err, "Could not read the pid of the background process")
+	statPath := filepath.Join("/proc", strings.TrimSpace(string(pidBytes)), "stat")
+
+	// a killed process that hasn't been reaped yet is a zombie. The kill
+	// may not have been delivered yet, so give it a moment
+	state := ""
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		stat, err := ioutil.ReadFile(statPath)
+		if err != nil {
+			// the process is gone entirely
+			state = ""
+			break
+		}
+		state = strings.Fields(string(stat))[2]
+		if state == "Z" {
+			break
+		}
+	}
+	if state != "" {
+		Assert(t).AreEqual(state, "Z", "expected the background process to have been killed")
+	}
+}
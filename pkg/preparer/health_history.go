@@ -0,0 +1,60 @@
+package preparer
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/square/p2/pkg/health/history"
+	"github.com/square/p2/pkg/types"
+)
+
+// HealthHistory returns the recorded changes in health of a pod's services,
+// see history.Recorder
+type HealthHistory interface {
+	Transitions(podID types.PodID, since time.Time) ([]history.Transition, error)
+}
+
+// HandleHealthHistory serves the recorded changes in health of a pod's
+// services at /_health_history as a JSON list of history.Transition, oldest
+// first. The query parameters are:
+//
+//	pod   - the pod ID (required)
+//	since - an RFC3339 time; older transitions are not served
+//
+// It may be called after Serve().
+func (s *StatusServer) HandleHealthHistory(healthHistory HealthHistory) {
+	s.mux.HandleFunc("/_health_history", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		podID := types.PodID(query.Get("pod"))
+		if podID == "" {
+			http.Error(w, "the pod parameter is required", http.StatusBadRequest)
+			return
+		}
+		var since time.Time
+		if query.Get("since") != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339Nano, query.Get("since"))
+			if err != nil {
+				http.Error(w, "since must be an RFC3339 time", http.StatusBadRequest)
+				return
+			}
+		}
+
+		transitions, err := healthHistory.Transitions(podID, since)
+		if err != nil {
+			s.logger.WithError(err).Errorln("Could not read health history")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if transitions == nil {
+			transitions = []history.Transition{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(transitions)
+		if err != nil {
+			s.logger.WithError(err).Errorln("Could not write health history")
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package preparer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/health/history"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeHealthHistory []history.Transition
+
+func (f fakeHealthHistory) Transitions(podID types.PodID, since time.Time) ([]history.Transition, error) {
+	var transitions []history.Transition
+	for _, transition := range f {
+		if transition.PodID == podID && !transition.Time.Before(since) {
+			transitions = append(transitions, transition)
+		}
+	}
+	return transitions, nil
+}
+
+func TestStatusServerServesHealthHistory(t *testing.T) {
+	start := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	healthHistory := fakeHealthHistory{
+		{PodID: "web", Service: "web", Status: health.Passing, Time: start},
+		{PodID: "web", Service: "web", Previous: health.Passing, Status: health.Critical, Output: "503 Service Unavailable", Time: start.Add(time.Minute)},
+		{PodID: "db", Service: "db", Status: health.Passing, Time: start},
+	}
+	statusServer := &StatusServer{mux: http.NewServeMux(), logger: &logging.DefaultLogger}
+	statusServer.HandleHealthHistory(healthHistory)
+	server := httptest.NewServer(statusServer.mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/_health_history?pod=web&since=" + start.Add(time.Second).Format(time.RFC3339))
+	Assert(t).IsNil(err, "could not request health history")
+	defer resp.Body.Close()
+	Assert(t).AreEqual(resp.StatusCode, http.StatusOK, "unexpected status")
+
+	var transitions []history.Transition
+	err = json.NewDecoder(resp.Body).Decode(&transitions)
+	Assert(t).IsNil(err, "could not decode health history")
+	Assert(t).AreEqual(len(transitions), 1, "expected only the web transition since the passed time")
+	Assert(t).AreEqual(transitions[0].Status, health.Critical, "wrong status")
+	Assert(t).AreEqual(transitions[0].Output, "503 Service Unavailable", "wrong output")
+
+	resp, err = http.Get(server.URL + "/_health_history")
+	Assert(t).IsNil(err, "could not request health history")
+	resp.Body.Close()
+	Assert(t).AreEqual(resp.StatusCode, http.StatusBadRequest, "the pod should be required")
+}
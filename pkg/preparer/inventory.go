@@ -0,0 +1,171 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+	"github.com/square/p2/pkg/supervisor"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/size"
+	"github.com/square/p2/pkg/version"
+)
+
+const DefaultInventoryInterval = 1 * time.Minute
+
+// InventoryConfig configures how the preparer publishes this node's
+// inventory. It is independent of registration in the node registry.
+type InventoryConfig struct {
+	// Disable turns off inventory reporting entirely.
+	Disable bool `yaml:"disable,omitempty"`
+
+	// Interval is how often the node's inventory (installed hooks, pods,
+	// free disk etc.) is published to the status store.
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+type NodeStatusStore interface {
+	Set(node types.NodeName, status nodestatus.Status) error
+}
+
+// inventoryReporter periodically publishes what is installed on this node
+// (preparer version and config, hooks, pods, free disk) to the status store
+// so that operators don't have to log into a host to find out.
+type inventoryReporter struct {
+	node     types.NodeName
+	store    NodeStatusStore
+	podRoot  string
+	hooksDir string
+	config   nodestatus.ConfigSummary
+	interval time.Duration
+	logger   logging.Logger
+}
+
+func newConfigSummary(preparerConfig *PreparerConfig) nodestatus.ConfigSummary {
+	supervisorType := preparerConfig.Supervisor.Type
+	if supervisorType == "" {
+		supervisorType = supervisor.DefaultType
+	}
+	return nodestatus.ConfigSummary{
+		ConsulAddress:          preparerConfig.ConsulAddress,
+		PodRoot:                preparerConfig.PodRoot,
+		HooksDirectory:         preparerConfig.HooksDirectory,
+		LogLevel:               preparerConfig.LogLevel,
+		AuthType:               preparerConfig.Auth.Type,
+		ArtifactAuthType:       preparerConfig.ArtifactAuth.Type,
+		StatusPort:             preparerConfig.StatusPort,
+		MaxLaunchableDiskUsage: preparerConfig.MaxLaunchableDiskUsage,
+		Supervisor:             supervisorType,
+	}
+}
+
+// Run publishes the inventory immediately and then once per interval until
+// quit is closed.
+func (r inventoryReporter) Run(quit <-chan struct{}) {
+	interval := r.interval
+	if interval <= 0 {
+		interval = DefaultInventoryInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := r.store.Set(r.node, r.collect())
+		if err != nil {
+			r.logger.WithError(err).Warnln("Could not publish node inventory")
+		}
+
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r inventoryReporter) collect() nodestatus.Status {
+	return nodestatus.Status{
+		Version:   version.VERSION,
+		Config:    r.config,
+		Hooks:     r.hooks(),
+		Pods:      r.pods(),
+		FreeDisk:  r.freeDisk(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+// hooks returns the names of the hook scripts in the hooks directory
+func (r inventoryReporter) hooks() []string {
+	infos, err := ioutil.ReadDir(r.hooksDir)
+	if err != nil {
+		r.logger.WithError(err).Debugln("Could not read hooks directory")
+		return []string{}
+	}
+
+	hooks := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		hooks = append(hooks, info.Name())
+	}
+	sort.Strings(hooks)
+	return hooks
+}
+
+// pods returns every pod under the pod root that has a current manifest.
+// The hooks pod is excluded since it is reported via hooks()
+func (r inventoryReporter) pods() []nodestatus.Pod {
+	infos, err := ioutil.ReadDir(r.podRoot)
+	if err != nil {
+		r.logger.WithError(err).Warnln("Could not read pod root")
+		return []nodestatus.Pod{}
+	}
+
+	result := make([]nodestatus.Pod, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() || info.Name() == "hooks" {
+			continue
+		}
+		home := filepath.Join(r.podRoot, info.Name())
+		pod, err := pods.PodFromPodHome(r.node, home)
+		if err != nil {
+			// not every directory in the pod root is a pod
+			continue
+		}
+		podManifest, err := pod.CurrentManifest()
+		if err != nil {
+			continue
+		}
+		sha, err := podManifest.SHA()
+		if err != nil {
+			r.logger.WithErrorAndFields(err, logrus.Fields{"pod_home": home}).Warnln("Could not compute manifest SHA")
+			continue
+		}
+		result = append(result, nodestatus.Pod{
+			ID:          podManifest.ID(),
+			UniqueKey:   pod.UniqueKey(),
+			ManifestSHA: sha,
+		})
+	}
+	return result
+}
+
+// freeDisk returns the space available to unprivileged users on the
+// filesystem containing the pod root, or 0 if it can't be determined
+func (r inventoryReporter) freeDisk() size.ByteCount {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(r.podRoot, &st)
+	if err != nil {
+		r.logger.WithError(err).Warnln("Could not stat pod root filesystem")
+		return 0
+	}
+	return size.ByteCount(uint64(st.Bavail) * uint64(st.Bsize))
+}
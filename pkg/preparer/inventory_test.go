@@ -0,0 +1,59 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestInventoryReporterCollect(t *testing.T) {
+	podRoot, err := ioutil.TempDir("", "pod_root")
+	Assert(t).IsNil(err, "could not create pod root")
+	defer os.RemoveAll(podRoot)
+	hooksDir, err := ioutil.TempDir("", "hooks")
+	Assert(t).IsNil(err, "could not create hooks dir")
+	defer os.RemoveAll(hooksDir)
+
+	for _, hook := range []string{"hookpod__b", "hookpod__a"} {
+		err = ioutil.WriteFile(filepath.Join(hooksDir, hook), []byte("#!/bin/sh\n"), 0744)
+		Assert(t).IsNil(err, "could not write hook script")
+	}
+
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "could not get current user")
+	builder := testManifest(t).GetBuilder()
+	builder.SetRunAsUser(currentUser.Username)
+	testManifest := builder.GetManifest()
+	pod := pods.NewFactory(podRoot, "hostname", nil, "").NewLegacyPod(testManifest.ID())
+	err = os.MkdirAll(pod.Home(), 0755)
+	Assert(t).IsNil(err, "could not create pod home")
+	_, err = pod.WriteCurrentManifest(testManifest)
+	Assert(t).IsNil(err, "could not write current manifest")
+
+	// directories without a current manifest aren't pods
+	err = os.Mkdir(filepath.Join(podRoot, "not_a_pod"), 0755)
+	Assert(t).IsNil(err, "could not create extra directory")
+
+	reporter := inventoryReporter{
+		node:     types.NodeName("hostname"),
+		podRoot:  podRoot,
+		hooksDir: hooksDir,
+		logger:   logging.DefaultLogger,
+	}
+	status := reporter.collect()
+
+	Assert(t).AreEqual(len(status.Hooks), 2, "expected two hooks")
+	Assert(t).AreEqual(status.Hooks[0], "hookpod__a", "expected hooks to be sorted")
+	Assert(t).AreEqual(len(status.Pods), 1, "expected one pod")
+	Assert(t).AreEqual(status.Pods[0].ID, testManifest.ID(), "unexpected pod ID")
+	expectedSHA, _ := testManifest.SHA()
+	Assert(t).AreEqual(status.Pods[0].ManifestSHA, expectedSHA, "unexpected manifest SHA")
+	Assert(t).IsTrue(status.FreeDisk > 0, "expected free disk to be reported")
+}
@@ -0,0 +1,443 @@
+package preparer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/types"
+)
+
+const (
+	// The number of lines served when a request doesn't specify "tail"
+	DefaultLogTail = 100
+
+	// How often followed logs are checked for new lines
+	logFollowInterval = 500 * time.Millisecond
+
+	// svlogd -tt prefixes each line with a UTC timestamp in this format,
+	// followed by a space
+	svlogdTimeFormat = "2006-01-02_15:04:05.999999999"
+
+	// The file svlogd writes to. Older logs are rotated into files named
+	// after the TAI64N time they were rotated at, so they sort by age.
+	svlogdCurrent = "current"
+)
+
+// LogLine is a line logged by one of a pod's executables, as served by the
+// status server at /_logs.
+type LogLine struct {
+	LaunchableID launch.LaunchableID `json:"launchable_id"`
+	EntryPoint   string              `json:"entry_point"`
+	Time         time.Time           `json:"time"`
+	Line         string              `json:"line"`
+}
+
+// LogSource is the directory svlogd writes the output of one of a pod's
+// executables to.
+type LogSource struct {
+	LaunchableID launch.LaunchableID
+	EntryPoint   string
+	Dir          string
+}
+
+// LogFinder finds the log directories of the executables of an installed
+// pod. It returns pods.NoCurrentManifest if the pod isn't installed.
+type LogFinder interface {
+	FindLogs(podID types.PodID, uniqueKey types.PodUniqueKey) ([]LogSource, error)
+}
+
+// FindLogs returns the log directories of the executables of a pod installed
+// on this node.
+func (p *Preparer) FindLogs(podID types.PodID, uniqueKey types.PodUniqueKey) ([]LogSource, error) {
+	var pod *pods.Pod
+	var err error
+	if uniqueKey == "" {
+		pod = p.podFactory.NewLegacyPod(podID)
+	} else {
+		pod, err = p.podFactory.NewUUIDPod(podID, uniqueKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pod.Supervisor = p.supervisor
+
+	manifest, err := pod.CurrentManifest()
+	if err != nil {
+		return nil, err
+	}
+	launchables, err := pod.Launchables(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []LogSource
+	for _, launchable := range launchables {
+		executables, err := launchable.Executables(p.supervisor)
+		if err != nil {
+			return nil, err
+		}
+		for _, executable := range executables {
+			sources = append(sources, LogSource{
+				LaunchableID: launchable.ID(),
+				EntryPoint:   executable.RelativePath,
+				Dir:          p.supervisor.LogDir(executable.Service.Name),
+			})
+		}
+	}
+	return sources, nil
+}
+
+// HandleLogs serves the logs of a pod's executables at /_logs, one JSON
+// LogLine per line. It must only be installed on a status server from
+// NewTLSStatusServer, so that the token isn't sent in the clear. Requests
+// must carry the token as a bearer token in their Authorization header. The
+// query parameters are:
+//
+//	pod            - the pod ID (required)
+//	pod_unique_key - the pod's unique key, for pods that have one
+//	launchable     - restricts the logs to one launchable
+//	entry_point    - restricts the logs to one entry point, e.g. "bin/launch"
+//	tail           - the number of lines to serve, or -1 for all of them.
+//	                 Defaults to DefaultLogTail
+//	since          - an RFC3339 time; older lines are not served
+//	follow         - if "true", new lines are streamed until the client
+//	                 disconnects
+//
+// It may be called after Serve().
+func (s *StatusServer) HandleLogs(finder LogFinder, token string) {
+	s.mux.HandleFunc("/_logs", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		podID := types.PodID(query.Get("pod"))
+		if podID == "" {
+			http.Error(w, "the pod parameter is required", http.StatusBadRequest)
+			return
+		}
+		tail := DefaultLogTail
+		if query.Get("tail") != "" {
+			var err error
+			tail, err = strconv.Atoi(query.Get("tail"))
+			if err != nil {
+				http.Error(w, "tail must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+		var since time.Time
+		if query.Get("since") != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339Nano, query.Get("since"))
+			if err != nil {
+				http.Error(w, "since must be an RFC3339 time", http.StatusBadRequest)
+				return
+			}
+		}
+		follow := query.Get("follow") == "true"
+
+		sources, err := finder.FindLogs(podID, types.PodUniqueKey(query.Get("pod_unique_key")))
+		if err == pods.NoCurrentManifest {
+			http.Error(w, "pod is not installed", http.StatusNotFound)
+			return
+		} else if err != nil {
+			s.logger.WithError(err).Errorln("Could not find pod logs")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sources = filterLogSources(sources, launch.LaunchableID(query.Get("launchable")), query.Get("entry_point"))
+		if len(sources) == 0 {
+			http.Error(w, "no matching launchables", http.StatusNotFound)
+			return
+		}
+
+		var lines []LogLine
+		followers := make([]logFollower, len(sources))
+		for i, source := range sources {
+			sourceLines, follower, err := readLogs(source, since, tail)
+			if err != nil {
+				s.logger.WithError(err).Errorln("Could not read pod logs")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			lines = append(lines, sourceLines...)
+			followers[i] = follower
+		}
+		sort.Stable(logLinesByTime(lines))
+		if tail >= 0 && len(lines) > tail {
+			lines = lines[len(lines)-tail:]
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		for _, line := range lines {
+			err = encoder.Encode(line)
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+		if !follow {
+			return
+		}
+
+		lineCh := make(chan LogLine)
+		for _, follower := range followers {
+			go follower.follow(r.Context(), lineCh)
+		}
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case line := <-lineCh:
+				err = encoder.Encode(line)
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+func filterLogSources(sources []LogSource, launchableID launch.LaunchableID, entryPoint string) []LogSource {
+	var filtered []LogSource
+	for _, source := range sources {
+		if launchableID != "" && source.LaunchableID != launchableID {
+			continue
+		}
+		if entryPoint != "" && source.EntryPoint != entryPoint {
+			continue
+		}
+		filtered = append(filtered, source)
+	}
+	return filtered
+}
+
+type logLinesByTime []LogLine
+
+func (l logLinesByTime) Len() int           { return len(l) }
+func (l logLinesByTime) Less(i, j int) bool { return l[i].Time.Before(l[j].Time) }
+func (l logLinesByTime) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// svlogdFiles returns the log files in an svlogd directory from oldest to
+// newest.
+func svlogdFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	hasCurrent := false
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == svlogdCurrent {
+			hasCurrent = true
+		} else if strings.HasPrefix(name, "@") && (strings.HasSuffix(name, ".s") || strings.HasSuffix(name, ".u")) {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+	if hasCurrent {
+		files = append(files, svlogdCurrent)
+	}
+	return files, nil
+}
+
+// parseSvlogdLine splits the timestamp svlogd prefixed a line with from the
+// line. Lines without a timestamp are returned with the zero time.
+func parseSvlogdLine(line string) (time.Time, string) {
+	line = strings.TrimSuffix(line, "\n")
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return time.Time{}, line
+	}
+	t, err := time.Parse(svlogdTimeFormat, line[:i])
+	if err != nil {
+		return time.Time{}, line
+	}
+	return t, line[i+1:]
+}
+
+// logFollower reads the lines that are added to a source's current log file
+// after a given offset.
+type logFollower struct {
+	source LogSource
+	// the current file when the offset was taken, nil if there was none
+	info   os.FileInfo
+	offset int64
+}
+
+// readLogs returns the last tail lines of a source that were logged no
+// earlier than since, and a follower for the lines logged after them. A
+// negative tail returns all lines.
+func readLogs(source LogSource, since time.Time, tail int) ([]LogLine, logFollower, error) {
+	follower := logFollower{source: source}
+	files, err := svlogdFiles(source.Dir)
+	if err != nil {
+		return nil, follower, err
+	}
+
+	var lines []LogLine
+	var last time.Time
+	for _, name := range files {
+		f, err := os.Open(filepath.Join(source.Dir, name))
+		if os.IsNotExist(err) {
+			// rotated away since the directory was read
+			continue
+		} else if err != nil {
+			return nil, follower, err
+		}
+
+		var offset int64
+		reader := bufio.NewReader(f)
+		for {
+			text, err := reader.ReadString('\n')
+			if err == io.EOF {
+				// an incomplete line is read by the follower once it's
+				// been completed
+				break
+			} else if err != nil {
+				_ = f.Close()
+				return nil, follower, err
+			}
+			offset += int64(len(text))
+
+			line := source.line(text)
+			// lines without a timestamp belong to the previous line
+			if line.Time.IsZero() {
+				line.Time = last
+			}
+			last = line.Time
+			if line.Time.Before(since) {
+				continue
+			}
+			lines = append(lines, line)
+			if tail >= 0 && len(lines) > tail {
+				lines = lines[1:]
+			}
+		}
+
+		if name == svlogdCurrent {
+			follower.info, err = f.Stat()
+			follower.offset = offset
+		}
+		_ = f.Close()
+		if err != nil {
+			return nil, follower, err
+		}
+	}
+	return lines, follower, nil
+}
+
+func (s LogSource) line(text string) LogLine {
+	t, line := parseSvlogdLine(text)
+	return LogLine{
+		LaunchableID: s.LaunchableID,
+		EntryPoint:   s.EntryPoint,
+		Time:         t,
+		Line:         line,
+	}
+}
+
+// follow sends the lines added to the source's current log file to lineCh
+// until the context is done. When svlogd rotates the file, the rest of the
+// old file is read before moving on to the new one.
+func (l logFollower) follow(ctx context.Context, lineCh chan<- LogLine) {
+	path := filepath.Join(l.source.Dir, svlogdCurrent)
+	info, offset := l.info, l.offset
+	var last time.Time
+	for {
+		var opened os.FileInfo
+		f, err := os.Open(path)
+		if err == nil {
+			opened, err = f.Stat()
+			if err == nil && info != nil && os.SameFile(info, opened) {
+				_, err = f.Seek(offset, io.SeekStart)
+			}
+		}
+		if err != nil {
+			if f != nil {
+				_ = f.Close()
+			}
+			// the file doesn't exist until svlogd first writes to it
+			if !sleepContext(ctx, logFollowInterval) {
+				return
+			}
+			continue
+		}
+
+		rotated := false
+		partial := ""
+		reader := bufio.NewReader(f)
+		for {
+			text, err := reader.ReadString('\n')
+			partial += text
+			if err == nil {
+				line := l.source.line(partial)
+				partial = ""
+				if line.Time.IsZero() {
+					line.Time = last
+				}
+				last = line.Time
+				select {
+				case lineCh <- line:
+				case <-ctx.Done():
+					_ = f.Close()
+					return
+				}
+				continue
+			}
+			if err != io.EOF || rotated {
+				break
+			}
+
+			current, statErr := os.Stat(path)
+			if statErr == nil && !os.SameFile(current, opened) {
+				// read what was written before the rotation, then
+				// move on to the new file
+				rotated = true
+				continue
+			}
+			if !sleepContext(ctx, logFollowInterval) {
+				_ = f.Close()
+				return
+			}
+		}
+		_ = f.Close()
+		info, offset = nil, 0
+	}
+}
+
+// sleepContext waits for d, returning false if the context was done
+// meanwhile.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
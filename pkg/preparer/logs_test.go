@@ -0,0 +1,161 @@
+package preparer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeLogFinder map[types.PodID][]LogSource
+
+func (f fakeLogFinder) FindLogs(podID types.PodID, uniqueKey types.PodUniqueKey) ([]LogSource, error) {
+	sources, ok := f[podID]
+	if !ok {
+		return nil, pods.NoCurrentManifest
+	}
+	return sources, nil
+}
+
+func logsServer(finder LogFinder) *httptest.Server {
+	statusServer := &StatusServer{mux: http.NewServeMux(), logger: &logging.DefaultLogger}
+	statusServer.HandleLogs(finder, "secret")
+	return httptest.NewServer(statusServer.mux)
+}
+
+func getLogs(t *testing.T, url string) *http.Response {
+	req, err := http.NewRequest("GET", url, nil)
+	Assert(t).IsNil(err, "could not create request")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	Assert(t).IsNil(err, "could not request logs")
+	return resp
+}
+
+func TestParseSvlogdLine(t *testing.T) {
+	lineTime, line := parseSvlogdLine("2017-01-02_03:04:05.12345 hello world\n")
+	Assert(t).IsTrue(lineTime.Equal(time.Date(2017, 1, 2, 3, 4, 5, 123450000, time.UTC)), "wrong time: "+lineTime.String())
+	Assert(t).AreEqual(line, "hello world", "wrong line")
+
+	lineTime, line = parseSvlogdLine("no timestamp here")
+	Assert(t).IsTrue(lineTime.IsZero(), "expected no time for a line without a timestamp")
+	Assert(t).AreEqual(line, "no timestamp here", "wrong line")
+}
+
+func TestStatusServerServesLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	Assert(t).IsNil(err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+
+	appDir := filepath.Join(dir, "app")
+	sidecarDir := filepath.Join(dir, "sidecar")
+	Assert(t).IsNil(os.MkdirAll(appDir, 0755), "could not create log dir")
+	Assert(t).IsNil(os.MkdirAll(sidecarDir, 0755), "could not create log dir")
+	// rotated files come before the current one
+	Assert(t).IsNil(ioutil.WriteFile(filepath.Join(appDir, "@400000005869c2d70000000a.s"), []byte(
+		"2017-01-02_03:00:00.00000 old\n"+
+			"2017-01-02_03:01:00.00000 started\n"), 0644), "could not write log")
+	Assert(t).IsNil(ioutil.WriteFile(filepath.Join(appDir, "current"), []byte(
+		"2017-01-02_03:03:00.00000 serving\n"+
+			"  continued\n"), 0644), "could not write log")
+	Assert(t).IsNil(ioutil.WriteFile(filepath.Join(sidecarDir, "current"), []byte(
+		"2017-01-02_03:02:00.00000 proxying\n"), 0644), "could not write log")
+
+	server := logsServer(fakeLogFinder{"web": {
+		{LaunchableID: "app", EntryPoint: "bin/launch", Dir: appDir},
+		{LaunchableID: "sidecar", EntryPoint: "bin/launch", Dir: sidecarDir},
+	}})
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/_logs?pod=web")
+	Assert(t).IsNil(err, "could not request logs")
+	resp.Body.Close()
+	Assert(t).AreEqual(resp.StatusCode, http.StatusUnauthorized, "expected a request without a token to be rejected")
+
+	resp = getLogs(t, server.URL+"/_logs?pod=other")
+	resp.Body.Close()
+	Assert(t).AreEqual(resp.StatusCode, http.StatusNotFound, "expected a pod that isn't installed to be not found")
+
+	resp = getLogs(t, server.URL+"/_logs?pod=web&tail=4&since=2017-01-02T03:00:30Z")
+	defer resp.Body.Close()
+	Assert(t).AreEqual(resp.StatusCode, http.StatusOK, "unexpected status")
+	var lines []LogLine
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var line LogLine
+		Assert(t).IsNil(decoder.Decode(&line), "could not decode line")
+		lines = append(lines, line)
+	}
+
+	// the lines of both launchables are merged by time, and the line
+	// without a timestamp keeps its place after the one before it
+	expected := []string{"started", "proxying", "serving", "  continued"}
+	Assert(t).AreEqual(len(lines), len(expected), "wrong number of lines")
+	for i, line := range lines {
+		Assert(t).AreEqual(line.Line, expected[i], "wrong line")
+	}
+	Assert(t).AreEqual(lines[1].LaunchableID.String(), "sidecar", "wrong launchable")
+}
+
+func TestStatusServerFollowsLogsAcrossRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	Assert(t).IsNil(err, "could not create temp dir")
+	defer os.RemoveAll(dir)
+
+	current := filepath.Join(dir, "current")
+	Assert(t).IsNil(ioutil.WriteFile(current, []byte("2017-01-02_03:00:00.00000 before\n"), 0644), "could not write log")
+
+	server := logsServer(fakeLogFinder{"web": {{LaunchableID: "app", EntryPoint: "bin/launch", Dir: dir}}})
+	defer server.Close()
+
+	resp := getLogs(t, server.URL+"/_logs?pod=web&follow=true&launchable=app")
+	defer resp.Body.Close()
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var line LogLine
+			if json.Unmarshal(scanner.Bytes(), &line) == nil {
+				lines <- line.Line
+			}
+		}
+	}()
+
+	appendLog := func(path string, line string) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		Assert(t).IsNil(err, "could not open log")
+		_, err = f.WriteString(line)
+		Assert(t).IsNil(err, "could not write log")
+		f.Close()
+	}
+
+	expectLine := func(expected string) {
+		select {
+		case line := <-lines:
+			Assert(t).AreEqual(line, expected, "wrong line")
+		case <-time.After(5 * time.Second):
+			t.Fatalf("did not receive %q", expected)
+		}
+	}
+
+	expectLine("before")
+	appendLog(current, "2017-01-02_03:01:00.00000 after\n")
+	expectLine("after")
+
+	// the same way svlogd rotates
+	appendLog(current, "2017-01-02_03:02:00.00000 rotated\n")
+	Assert(t).IsNil(os.Rename(current, filepath.Join(dir, "@400000005869c2d70000000a.s")), "could not rotate log")
+	appendLog(current, "2017-01-02_03:03:00.00000 new file\n")
+	expectLine("rotated")
+	expectLine("new file")
+}
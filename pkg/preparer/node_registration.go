@@ -0,0 +1,177 @@
+package preparer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/osversion"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/nodestore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/size"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	DefaultHeartbeatInterval = 10 * time.Second
+
+	// consul refuses session TTLs lower than 10s
+	minHeartbeatTTL = 10 * time.Second
+)
+
+// NodeRegistryConfig configures how the preparer registers its node in the
+// node registry and keeps it marked alive.
+type NodeRegistryConfig struct {
+	// Disable turns off registration and heartbeating entirely.
+	Disable bool `yaml:"disable,omitempty"`
+
+	// HeartbeatInterval is how often the node record is refreshed. The
+	// node is considered dead once three intervals pass without a
+	// heartbeat.
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval,omitempty"`
+
+	// Labels are published as part of the node record.
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+type NodeRegistry interface {
+	Heartbeat(session string, node nodestore.Node) error
+	Holder(nodeName types.NodeName) (string, error)
+}
+
+// nodeHeartbeater keeps this node's record in the node registry locked by a
+// consul session, which expires if the preparer stops renewing it.
+type nodeHeartbeater struct {
+	node     types.NodeName
+	registry NodeRegistry
+	client   consulutil.ConsulClient
+	config   NodeRegistryConfig
+	logger   logging.Logger
+}
+
+func (h nodeHeartbeater) sessionName() string {
+	return fmt.Sprintf("p2-preparer-heartbeat:%s", h.node)
+}
+
+func (h nodeHeartbeater) interval() time.Duration {
+	if h.config.HeartbeatInterval <= 0 {
+		return DefaultHeartbeatInterval
+	}
+	return h.config.HeartbeatInterval
+}
+
+// Run registers the node and heartbeats until quit is closed. The session
+// is deliberately not destroyed on quit: a restarting preparer takes over
+// its predecessor's record instead of marking the node dead in between.
+func (h nodeHeartbeater) Run(quit <-chan struct{}) {
+	ttl := 3 * h.interval()
+	if ttl < minHeartbeatTTL {
+		ttl = minHeartbeatTTL
+	}
+
+	sessions := make(chan string)
+	done := make(chan struct{})
+	go consulutil.SessionManager(api.SessionEntry{
+		Name:      h.sessionName(),
+		LockDelay: 1 * time.Millisecond,
+		Behavior:  api.SessionBehaviorRelease,
+		TTL:       ttl.String(),
+	}, h.client, sessions, done, h.logger)
+
+	go func() {
+		<-quit
+		close(done)
+	}()
+
+	consulutil.WithSession(quit, sessions, func(sessionQuit <-chan struct{}, session string) {
+		logger := h.logger.SubLogger(logrus.Fields{"session": session})
+		ticker := time.NewTicker(h.interval())
+		defer ticker.Stop()
+		for {
+			h.heartbeat(session, logger)
+			select {
+			case <-sessionQuit:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+func (h nodeHeartbeater) heartbeat(session string, logger logging.Logger) {
+	err := h.registry.Heartbeat(session, h.nodeRecord())
+	if err == nil {
+		return
+	}
+	logger.WithError(err).Warnln("Could not heartbeat node record")
+
+	// A previous preparer on this node may have left its session behind.
+	// Sessions carry the node name, so it's safe to destroy one of ours.
+	holder, err := h.registry.Holder(h.node)
+	if err != nil || holder == "" || holder == session {
+		return
+	}
+	entry, _, err := h.client.Session().Info(holder, nil)
+	if err != nil || entry == nil || entry.Name != h.sessionName() {
+		return
+	}
+	logger.WithField("stale_session", holder).Infoln("Destroying stale heartbeat session")
+	_, err = h.client.Session().Destroy(holder, nil)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not destroy stale heartbeat session")
+	}
+}
+
+func (h nodeHeartbeater) nodeRecord() nodestore.Node {
+	node := nodestore.Node{
+		Name:    h.node,
+		Version: version.VERSION,
+		Capacity: nodestore.Capacity{
+			CPUs:   runtime.NumCPU(),
+			Memory: totalMemory(),
+		},
+		Labels: h.config.Labels,
+	}
+
+	// OS detection is best-effort: it only succeeds on supported distributions
+	osName, osVersion, err := osversion.DefaultDetector.Version()
+	if err == nil {
+		node.OS = osName
+		node.OSVersion = osVersion
+	}
+	return node
+}
+
+// totalMemory reads the amount of physical memory from /proc/meminfo,
+// returning 0 if it can't be determined.
+func totalMemory() size.ByteCount {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// e.g. "MemTotal:       16314388 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return 0
+		}
+		return size.ByteCount(kb) * size.Kibibyte
+	}
+	return 0
+}
@@ -9,12 +9,14 @@ import (
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/hooks"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podevents"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
@@ -38,11 +40,13 @@ type Pod interface {
 	Uninstall() error
 	Verify(manifest.Manifest, auth.Policy) error
 	Halt(manifest.Manifest) (bool, error)
+	Reload(manifest.Manifest) (bool, error)
 	Prune(size.ByteCount, manifest.Manifest)
 }
 
 type Hooks interface {
-	RunHookType(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest) error
+	RunHookType(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest) ([]hooks.Result, error)
+	RunHookTypeWithDetails(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest, details hooks.EventDetails) ([]hooks.Result, error)
 	Close() error
 }
 
@@ -150,12 +154,56 @@ func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 	}
 }
 
-func (p *Preparer) tryRunHooks(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest, logger logging.Logger) {
-	err := p.hooks.RunHookType(hookType, pod, manifest)
+// tryRunHooks runs the hooks of the given type for the pod and returns the
+// failure policy the caller must apply, which is hooks.IgnoreFailure unless
+// hooks with a stricter policy failed
+func (p *Preparer) tryRunHooks(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest, logger logging.Logger) hooks.FailurePolicy {
+	return p.tryRunHooksWithDetails(hookType, pod, manifest, hooks.EventDetails{}, logger)
+}
+
+// tryRunHooksWithDetails is tryRunHooks for events that expose what changed
+// to the hooks
+func (p *Preparer) tryRunHooksWithDetails(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest, details hooks.EventDetails, logger logging.Logger) hooks.FailurePolicy {
+	start := time.Now()
+	results, err := p.currentHooks().RunHookTypeWithDetails(hookType, pod, manifest, details)
 	if err != nil {
 		logger.WithErrorAndFields(err, logrus.Fields{
 			"hooks": hookType}).Warnln("Could not run hooks")
 	}
+	if len(results) > 0 && pod.UniqueKey() != "" {
+		p.writeHookResults(pod.UniqueKey(), results, logger)
+	}
+
+	event := p.podEvent(podevents.HookRan, manifest, pod.UniqueKey())
+	event.Hook = string(hookType)
+	p.emit(event, start, err)
+	return hooks.FailurePolicyOf(err)
+}
+
+// podEvent returns a lifecycle event for the pod defined by podManifest
+func (p *Preparer) podEvent(eventType podevents.EventType, podManifest manifest.Manifest, uniqueKey types.PodUniqueKey) podevents.Event {
+	event := podevents.Event{
+		Type:         eventType,
+		Node:         p.node,
+		PodUniqueKey: uniqueKey,
+	}
+	if podManifest != nil {
+		event.PodID = podManifest.ID()
+		event.ManifestSHA, _ = podManifest.SHA()
+	}
+	return event
+}
+
+// emit publishes an event, recording how long the step took if start is
+// set and its error if there was one
+func (p *Preparer) emit(event podevents.Event, start time.Time, err error) {
+	if !start.IsZero() {
+		event.Duration = time.Since(start)
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	p.Events.Emit(event)
 }
 
 // no return value, no output channels. This should do everything it needs to do
@@ -194,6 +242,9 @@ func (p *Preparer) handlePods(podChan <-chan ManifestPair, quit <-chan struct{})
 				"pod_unique_key": nextLaunch.PodUniqueKey,
 			})
 			manifestLogger.NoFields().Debugln("New manifest received")
+			if nextLaunch.Intent != nil {
+				p.emit(p.podEvent(podevents.PodReceived, nextLaunch.Intent, nextLaunch.PodUniqueKey), time.Time{}, nil)
+			}
 
 			working = true
 		case <-time.After(backoffTime):
@@ -218,7 +269,7 @@ func (p *Preparer) handlePods(podChan <-chan ManifestPair, quit <-chan struct{})
 				effectiveLogBridgeExec := p.logExec
 				// pods that are in the blacklist for this preparer shall not use the
 				// preparer's log exec. Instead, they will use the default svlogd logexec.
-				for _, podID := range p.logBridgeBlacklist {
+				for _, podID := range p.currentLogBridgeBlacklist() {
 					if pod.Id.String() == podID {
 						effectiveLogBridgeExec = svlogdExec
 						break
@@ -228,6 +279,13 @@ func (p *Preparer) handlePods(podChan <-chan ManifestPair, quit <-chan struct{})
 
 				pod.SetFinishExec(p.finishExec)
 
+				pod.Supervisor = p.supervisor
+				pod.StatusClient = p.statusClient
+				if p.secretMaterializer != nil {
+					pod.SecretsDir = p.secretMaterializer.Dir(pod.Home())
+				}
+				pod.ConfigMaps = p.configMaps
+
 				// podChan is being fed values gathered from a consul.Watch() in
 				// WatchForPodManifestsForNode(). If the watch returns a new pair of
 				// intent/reality values before the previous change has finished
@@ -303,16 +361,23 @@ func (p *Preparer) handlePods(podChan <-chan ManifestPair, quit <-chan struct{})
 
 // check if a manifest satisfies the authorization requirement of this preparer
 func (p *Preparer) authorize(manifest manifest.Manifest, logger logging.Logger) bool {
-	err := p.authPolicy.AuthorizeApp(manifest, logger)
+	return p.authorizationError(manifest, logger) == nil
+}
+
+// authorizationError is like authorize but returns the reason the manifest
+// was rejected
+func (p *Preparer) authorizationError(manifest manifest.Manifest, logger logging.Logger) error {
+	authPolicy, release := p.acquireAuthPolicy()
+	defer release()
+	err := authPolicy.AuthorizeApp(manifest, logger)
 	if err != nil {
 		if err, ok := err.(auth.Error); ok {
 			logger.WithFields(err.Fields).Errorln(err)
 		} else {
 			logger.NoFields().Errorln(err)
 		}
-		return false
 	}
-	return true
+	return err
 }
 
 func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger) bool {
@@ -327,8 +392,9 @@ func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger
 
 	if oldSHA == "" && newSHA != "" {
 		logger.NoFields().Infoln("manifest is new, will update")
-		authorized := p.authorize(pair.Intent, logger)
-		if !authorized {
+		err := p.authorizationError(pair.Intent, logger)
+		if err != nil {
+			p.emit(p.podEvent(podevents.AuthFailed, pair.Intent, pair.PodUniqueKey), time.Time{}, err)
 			p.tryRunHooks(
 				hooks.AfterAuthFail,
 				pod,
@@ -351,8 +417,9 @@ func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger
 		return true
 	}
 
-	authorized := p.authorize(pair.Intent, logger)
-	if !authorized {
+	err := p.authorizationError(pair.Intent, logger)
+	if err != nil {
+		p.emit(p.podEvent(podevents.AuthFailed, pair.Intent, pair.PodUniqueKey), time.Time{}, err)
 		p.tryRunHooks(
 			hooks.AfterAuthFail,
 			pod,
@@ -363,79 +430,165 @@ func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger
 		return true
 	}
 
+	if manifest.OnlyConfigChanged(pair.Reality, pair.Intent) {
+		logger.WithField("old_sha", oldSHA).Infoln("only the manifest's config has changed, will reload")
+		success, reloaded := p.reloadPod(pair, pod, logger)
+		if reloaded {
+			return success
+		}
+	}
+
 	logger.WithField("old_sha", oldSHA).Infoln("manifest SHA has changed, will update")
 	return p.installAndLaunchPod(pair, pod, logger)
 
 }
 
 func (p *Preparer) installAndLaunchPod(pair ManifestPair, pod Pod, logger logging.Logger) bool {
-	p.tryRunHooks(hooks.BeforeInstall, pod, pair.Intent, logger)
+	policy := p.tryRunHooks(hooks.BeforeInstall, pod, pair.Intent, logger)
+	if policy == hooks.BlockInstall {
+		logger.NoFields().Errorln("Not installing pod because a before_install hook failed")
+		return false
+	}
+	// the pod is still installed, but must not be launched
+	abortLaunch := policy == hooks.AbortLaunch
 
 	logger.NoFields().Infoln("Installing pod and launchables")
 
+	start := time.Now()
+	p.emit(p.podEvent(podevents.DownloadStarted, pair.Intent, pair.PodUniqueKey), time.Time{}, nil)
 	err := pod.Install(pair.Intent, p.artifactVerifier, p.artifactRegistry)
+	p.emit(p.podEvent(podevents.DownloadFinished, pair.Intent, pair.PodUniqueKey), start, err)
 	if err != nil {
 		// install failed, abort and retry
 		logger.WithError(err).Errorln("Install failed")
 		return false
 	}
 
-	err = pod.Verify(pair.Intent, p.authPolicy)
+	authPolicy, release := p.acquireAuthPolicy()
+	err = pod.Verify(pair.Intent, authPolicy)
+	release()
 	if err != nil {
 		logger.WithError(err).
 			Errorln("Pod digest verification failed")
+		p.emit(p.podEvent(podevents.AuthFailed, pair.Intent, pair.PodUniqueKey), time.Time{}, err)
 		p.tryRunHooks(hooks.AfterAuthFail, pod, pair.Intent, logger)
 		return false
 	}
 
-	p.tryRunHooks(hooks.AfterInstall, pod, pair.Intent, logger)
+	err = p.writeSecrets(pair.Intent, pod, logger)
+	if err != nil {
+		// retried with the install
+		logger.WithError(err).Errorln("Could not write secrets")
+		return false
+	}
+
+	if p.tryRunHooks(hooks.AfterInstall, pod, pair.Intent, logger) != hooks.IgnoreFailure {
+		abortLaunch = true
+	}
+	if abortLaunch {
+		logger.NoFields().Errorln("Not launching pod because a hook failed")
+		return false
+	}
 
 	if pair.Reality != nil {
 		logger.NoFields().Infoln("Invoking the disable hook and halting runit services")
-		success, err := pod.Halt(pair.Reality)
-		if err != nil {
-			logger.WithError(err).
-				Errorln("Pod halt failed")
-		} else if !success {
-			logger.NoFields().Warnln("One or more launchables did not halt successfully")
-		}
+		p.haltPod(pair, pod, logger)
 	}
 
-	p.tryRunHooks(hooks.BeforeLaunch, pod, pair.Intent, logger)
+	if p.tryRunHooks(hooks.BeforeLaunch, pod, pair.Intent, logger) != hooks.IgnoreFailure {
+		logger.NoFields().Errorln("Not launching pod because a before_launch hook failed")
+		if pair.Reality != nil {
+			p.relaunchReality(pair, pod, logger)
+		}
+		return false
+	}
 
 	logger.NoFields().Infoln("Setting up new runit services and running the enable hook")
 
+	start = time.Now()
 	ok, err := pod.Launch(pair.Intent)
+	launchErr := err
+	if launchErr == nil && !ok {
+		launchErr = util.Errorf("one or more launchables did not launch successfully")
+	}
+	p.emit(p.podEvent(podevents.Launched, pair.Intent, pair.PodUniqueKey), start, launchErr)
 	if err != nil {
 		logger.WithError(err).
 			Errorln("Launch failed")
-	} else {
-		if pair.PodUniqueKey == "" {
-			// legacy pod, write the manifest back to reality tree
-			duration, err := p.store.SetPod(consul.REALITY_TREE, p.node, pair.Intent)
-			if err != nil {
-				logger.WithErrorAndFields(err, logrus.Fields{
-					"duration": duration}).
-					Errorln("Could not set pod in reality store")
-			}
-		} else {
-			backoff := 100 * time.Millisecond
-			for err := p.writeStatusRecord(pair, logger); err != nil; err = p.writeStatusRecord(pair, logger) {
-				time.Sleep(backoff)
-				backoff = 2 * backoff
-				if backoff > time.Minute {
-					backoff = time.Minute
-				}
+		if initErr, ok := err.(pods.InitError); ok {
+			p.emitInitFailure(pair, initErr)
+			if pair.PodUniqueKey != "" {
+				p.writeInitFailure(pair, initErr, logger)
 			}
 		}
+	} else {
+		p.writeReality(pair, logger)
 
 		p.tryRunHooks(hooks.AfterLaunch, pod, pair.Intent, logger)
+		if manifest.OnlyConfigChanged(pair.Reality, pair.Intent) {
+			p.tryRunHooksWithDetails(hooks.AfterManifestUpdate, pod, pair.Intent, hooks.EventDetails{PreviousManifest: pair.Reality}, logger)
+		}
 
 		pod.Prune(p.maxLaunchableDiskUsage, pair.Intent) // errors are logged internally
 	}
 	return err == nil && ok
 }
 
+// reloadPod applies an intent manifest that only differs from reality in its
+// config without reinstalling or restarting the pod, see Pod.Reload. The second
+// return value is false if the pod can't be reloaded and has to be installed
+// and launched instead.
+func (p *Preparer) reloadPod(pair ManifestPair, pod Pod, logger logging.Logger) (bool, bool) {
+	start := time.Now()
+	ok, err := pod.Reload(pair.Intent)
+	if err == pods.ReloadUnsupported {
+		logger.NoFields().Infoln("Pod can't reload its config, relaunching it instead")
+		return false, false
+	}
+	reloadErr := err
+	if reloadErr == nil && !ok {
+		reloadErr = util.Errorf("one or more launchables did not reload successfully")
+	}
+	p.emit(p.podEvent(podevents.Reloaded, pair.Intent, pair.PodUniqueKey), start, reloadErr)
+	if err != nil {
+		// nothing was reloaded if the config couldn't be written, which
+		// is retried
+		logger.WithError(err).Errorln("Reload failed")
+		return false, true
+	}
+
+	// the new config is in place even if a launchable failed to reload, so
+	// the pod isn't reloaded again
+	p.writeReality(pair, logger)
+	p.tryRunHooksWithDetails(hooks.AfterManifestUpdate, pod, pair.Intent, hooks.EventDetails{PreviousManifest: pair.Reality}, logger)
+	return ok, true
+}
+
+// writeReality records that the intent manifest was applied: legacy pods'
+// manifests are written to the reality tree and UUID pods get a status
+// record, which is retried until it succeeds.
+func (p *Preparer) writeReality(pair ManifestPair, logger logging.Logger) {
+	if pair.PodUniqueKey == "" {
+		// legacy pod, write the manifest back to reality tree
+		duration, err := p.store.SetPod(consul.REALITY_TREE, p.node, pair.Intent)
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{
+				"duration": duration}).
+				Errorln("Could not set pod in reality store")
+		}
+		return
+	}
+
+	backoff := 100 * time.Millisecond
+	for err := p.writeStatusRecord(pair, logger); err != nil; err = p.writeStatusRecord(pair, logger) {
+		time.Sleep(backoff)
+		backoff = 2 * backoff
+		if backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
 func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) error {
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
@@ -455,6 +608,7 @@ func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) e
 
 		ps.PodStatus = podstatus.PodLaunched
 		ps.Manifest = string(manifestBytes)
+		ps.InitFailure = nil
 		return ps, nil
 	}
 	err = p.podStatusStore.MutateStatus(ctx, pair.PodUniqueKey, mutator)
@@ -479,22 +633,164 @@ func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) e
 	return nil
 }
 
-func (p *Preparer) stopAndUninstallPod(pair ManifestPair, pod Pod, logger logging.Logger) bool {
+// emitInitFailure publishes the details of an init failure as a pod event,
+// which unlike the pod status is also kept for legacy pods
+func (p *Preparer) emitInitFailure(pair ManifestPair, initErr pods.InitError) {
+	event := p.podEvent(podevents.InitFailed, pair.Intent, pair.PodUniqueKey)
+	event.InitFailure = &podevents.InitFailure{
+		LaunchableID: initErr.LaunchableID.String(),
+		EntryPoint:   initErr.EntryPoint,
+		ExitCode:     initErr.ExitCode,
+		Output:       truncateInitOutput(initErr.Output),
+	}
+	p.emit(event, time.Time{}, initErr.Inner)
+}
+
+// maxInitOutput bounds the output of a failed init executable kept in its
+// event, since events are stored in consul
+const maxInitOutput = 1024
+
+func truncateInitOutput(output string) string {
+	if len(output) <= maxInitOutput {
+		return output
+	}
+	return output[len(output)-maxInitOutput:]
+}
+
+// writeInitFailure records in the pod's status that an init launchable kept
+// it from launching. Launches are retried, so errors are only logged.
+func (p *Preparer) writeInitFailure(pair ManifestPair, initErr pods.InitError, logger logging.Logger) {
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err := p.podStatusStore.MutateStatus(ctx, pair.PodUniqueKey, func(ps podstatus.PodStatus) (podstatus.PodStatus, error) {
+		ps.InitFailure = &podstatus.InitFailure{
+			LaunchableID: initErr.LaunchableID,
+			EntryPoint:   initErr.EntryPoint,
+			Time:         time.Now(),
+			ExitCode:     initErr.ExitCode,
+			Error:        initErr.Inner.Error(),
+		}
+		return ps, nil
+	})
+	if err != nil {
+		logger.WithError(err).Errorln("Could not add 'record init failure' to transaction")
+		return
+	}
+	ok, resp, err := transaction.Commit(ctx, p.client.KV())
+	switch {
+	case err != nil:
+		logger.WithError(err).Errorln("Could not record init failure in pod status")
+	case !ok:
+		logger.WithError(util.Errorf("%s", transaction.TxnErrorsToString(resp.Errors))).Errorln("Could not record init failure in pod status due to transaction violation")
+	}
+}
+
+// writeHookResults records the results of hooks that ran for a pod in its
+// status. Hooks run again on the next deploy, so errors are only logged.
+func (p *Preparer) writeHookResults(uniqueKey types.PodUniqueKey, results []hooks.Result, logger logging.Logger) {
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err := p.podStatusStore.MutateStatus(ctx, uniqueKey, func(ps podstatus.PodStatus) (podstatus.PodStatus, error) {
+		for _, result := range results {
+			hookResult := podstatus.HookResult{
+				Name:          result.Name,
+				Event:         result.Event.String(),
+				FailurePolicy: result.FailurePolicy.String(),
+				Time:          result.Start,
+				Duration:      result.Duration,
+				Success:       result.Err == nil,
+			}
+			if result.Err != nil {
+				hookResult.Error = result.Err.Error()
+			}
+			ps.SetHookResult(hookResult)
+		}
+		return ps, nil
+	})
+	if err != nil {
+		logger.WithError(err).Errorln("Could not add 'record hook results' to transaction")
+		return
+	}
+	ok, resp, err := transaction.Commit(ctx, p.client.KV())
+	switch {
+	case err != nil:
+		logger.WithError(err).Errorln("Could not record hook results in pod status")
+	case !ok:
+		logger.WithError(util.Errorf("%s", transaction.TxnErrorsToString(resp.Errors))).Errorln("Could not record hook results in pod status due to transaction violation")
+	}
+}
+
+// haltPod halts the launchables of the reality manifest. Failures are
+// logged but otherwise ignored, including those of the halt hooks, which
+// can't keep a pod from halting.
+func (p *Preparer) haltPod(pair ManifestPair, pod Pod, logger logging.Logger) {
+	p.tryRunHooks(hooks.BeforeHalt, pod, pair.Reality, logger)
+	defer p.tryRunHooks(hooks.AfterHalt, pod, pair.Reality, logger)
+
+	start := time.Now()
 	success, err := pod.Halt(pair.Reality)
+	haltErr := err
 	if err != nil {
 		logger.WithError(err).Errorln("Pod halt failed")
 	} else if !success {
 		logger.NoFields().Warnln("One or more launchables did not halt successfully")
+		haltErr = util.Errorf("one or more launchables did not halt successfully")
+	}
+	p.emit(p.podEvent(podevents.Halted, pair.Reality, pair.PodUniqueKey), start, haltErr)
+}
+
+// relaunchReality brings the reality manifest's launchables back up after
+// they were halted for a launch that didn't happen, so that an aborted deploy
+// doesn't leave the pod down. The pod's reality isn't changed.
+func (p *Preparer) relaunchReality(pair ManifestPair, pod Pod, logger logging.Logger) {
+	logger.NoFields().Infoln("Relaunching the previous version of the pod")
+	start := time.Now()
+	ok, err := pod.Launch(pair.Reality)
+	launchErr := err
+	if launchErr == nil && !ok {
+		launchErr = util.Errorf("one or more launchables did not launch successfully")
 	}
+	p.emit(p.podEvent(podevents.Launched, pair.Reality, pair.PodUniqueKey), start, launchErr)
+	if launchErr != nil {
+		logger.WithError(launchErr).Errorln("Could not relaunch the previous version of the pod")
+	}
+}
+
+// RunHealthChangeHooks runs the on_health_change hooks of a pod whose health
+// went from previous to current. The health monitor only checks legacy pods,
+// so podManifest is that of a legacy pod. The hooks are given the manifest the
+// pod is installed with, if it has one, since the one the health monitor
+// started with may be outdated.
+func (p *Preparer) RunHealthChangeHooks(podManifest manifest.Manifest, previous health.HealthState, current health.HealthState) {
+	pod := p.podFactory.NewLegacyPod(podManifest.ID())
+	if installed, err := pod.CurrentManifest(); err == nil {
+		podManifest = installed
+	}
+	logger := p.Logger.SubLogger(logrus.Fields{
+		"pod":             podManifest.ID(),
+		"health":          current,
+		"previous_health": previous,
+	})
+	p.tryRunHooksWithDetails(hooks.OnHealthChange, pod, podManifest, hooks.EventDetails{
+		HealthState:         current,
+		PreviousHealthState: previous,
+	}, logger)
+}
+
+func (p *Preparer) stopAndUninstallPod(pair ManifestPair, pod Pod, logger logging.Logger) bool {
+	p.haltPod(pair, pod, logger)
 
 	p.tryRunHooks(hooks.BeforeUninstall, pod, pair.Reality, logger)
 
-	err = pod.Uninstall()
+	start := time.Now()
+	err := pod.Uninstall()
+	p.emit(p.podEvent(podevents.Uninstalled, pair.Reality, pair.PodUniqueKey), start, err)
 	if err != nil {
 		logger.WithError(err).Errorln("Uninstall failed")
 		return false
 	}
 	logger.NoFields().Infoln("Successfully uninstalled")
+	p.removeSecrets(pod, logger)
 
 	if pair.PodUniqueKey == "" {
 		dur, err := p.store.DeletePod(consul.REALITY_TREE, p.node, pair.ID)
@@ -557,10 +853,21 @@ func (p *Preparer) markUninstalled(pair ManifestPair, pod Pod, logger logging.Lo
 
 // Close() releases any resources held by a Preparer.
 func (p *Preparer) Close() {
+	p.configMux.Lock()
+	defer p.configMux.Unlock()
 	err := p.hooks.Close()
 	if err != nil {
 		p.Logger.WithError(err).Errorln("Unable to close audit logger. Proceeding.")
 	}
+	if p.authPolicyUsers != nil {
+		p.authPolicyUsers.Wait()
+	}
 	p.authPolicy.Close()
 	p.authPolicy = nil
+	if p.HealthHistory != nil {
+		err = p.HealthHistory.Close()
+		if err != nil {
+			p.Logger.WithError(err).Errorln("Unable to close health history. Proceeding.")
+		}
+	}
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/square/p2/pkg/hooks"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
@@ -30,6 +31,8 @@ type TestPod struct {
 	installed, uninstalled, launched, launchSuccess, halted, haltSuccess bool
 	installErr, uninstallErr, launchErr, haltError, currentManifestError error
 	configDir, envDir                                                    string
+	// pods can't reload unless reloadable is set
+	reloadable, reloaded bool
 }
 
 func (t *TestPod) Prune(_ size.ByteCount, _ manifest.Manifest) {
@@ -49,6 +52,15 @@ func (t *TestPod) Launch(manifest manifest.Manifest) (bool, error) {
 	return t.launchSuccess, nil
 }
 
+func (t *TestPod) Reload(manifest manifest.Manifest) (bool, error) {
+	if !t.reloadable {
+		return false, pods.ReloadUnsupported
+	}
+	t.currentManifest = manifest
+	t.reloaded = true
+	return true, nil
+}
+
 func (t *TestPod) Install(manifest manifest.Manifest, _ auth.ArtifactVerifier, _ artifact.Registry) error {
 	t.installed = true
 	return t.installErr
@@ -97,30 +109,49 @@ func (t *TestPod) UniqueKey() types.PodUniqueKey {
 type fakeHooks struct {
 	beforeInstallErr, beforeUninstallErr, afterInstallErr, afterLaunchErr, afterAuthFailErr, beforeLaunchErr error
 	ranBeforeInstall, ranBeforeUninstall, ranAfterLaunch, ranAfterInstall, ranAfterAuthFail, ranBeforeLaunch bool
+	ranBeforeHalt, ranAfterHalt, ranOnHealthChange, ranAfterManifestUpdate                                   bool
+	lastDetails                                                                                              hooks.EventDetails
 }
 
-func (f *fakeHooks) RunHookType(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest) error {
+func (f *fakeHooks) RunHookType(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest) ([]hooks.Result, error) {
+	return f.RunHookTypeWithDetails(hookType, pod, manifest, hooks.EventDetails{})
+}
+
+func (f *fakeHooks) RunHookTypeWithDetails(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest, details hooks.EventDetails) ([]hooks.Result, error) {
+	f.lastDetails = details
 	switch hookType {
 	case hooks.BeforeInstall:
 		f.ranBeforeInstall = true
-		return f.beforeInstallErr
+		return nil, f.beforeInstallErr
 	case hooks.AfterInstall:
 		f.ranAfterInstall = true
-		return f.afterInstallErr
+		return nil, f.afterInstallErr
 	case hooks.BeforeUninstall:
 		f.ranBeforeUninstall = true
-		return f.beforeUninstallErr
+		return nil, f.beforeUninstallErr
 	case hooks.BeforeLaunch:
 		f.ranBeforeLaunch = true
-		return f.beforeLaunchErr
+		return nil, f.beforeLaunchErr
 	case hooks.AfterLaunch:
 		f.ranAfterLaunch = true
-		return f.afterLaunchErr
+		return nil, f.afterLaunchErr
 	case hooks.AfterAuthFail:
 		f.ranAfterAuthFail = true
-		return f.afterAuthFailErr
+		return nil, f.afterAuthFailErr
+	case hooks.BeforeHalt:
+		f.ranBeforeHalt = true
+		return nil, nil
+	case hooks.AfterHalt:
+		f.ranAfterHalt = true
+		return nil, nil
+	case hooks.OnHealthChange:
+		f.ranOnHealthChange = true
+		return nil, nil
+	case hooks.AfterManifestUpdate:
+		f.ranAfterManifestUpdate = true
+		return nil, nil
 	}
-	return util.Errorf("Invalid hook type configured in test: %s", hookType)
+	return nil, util.Errorf("Invalid hook type configured in test: %s", hookType)
 }
 func (f *fakeHooks) Close() error { return nil }
 
@@ -205,7 +236,7 @@ func testPreparer(t *testing.T, f *FakeStore) (*Preparer, *fakeHooks, string) {
 		ConsulAddress:  "0.0.0.0",
 		HooksDirectory: util.From(runtime.Caller(0)).ExpandPath("test_hooks"),
 		PodRoot:        podRoot,
-		Auth:           map[string]interface{}{"type": "none"},
+		Auth:           AuthConfig{Type: "none"},
 		HooksManifest:  "no_hooks",
 	}
 	p, err := New(cfg, logging.DefaultLogger)
@@ -290,6 +321,130 @@ func TestPreparerFailsIfInstallFails(t *testing.T) {
 	Assert(t).IsFalse(hooks.ranAfterLaunch, "should not have run after_launch hooks")
 }
 
+func TestPreparerFollowsHookFailurePolicies(t *testing.T) {
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, fakeHooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	testPod := &TestPod{launchSuccess: true}
+	fakeHooks.beforeInstallErr = hooks.FailureError{Policy: hooks.BlockInstall}
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "The deploy should have failed")
+	Assert(t).IsFalse(testPod.installed, "Install should have been blocked")
+
+	testPod = &TestPod{launchSuccess: true}
+	fakeHooks.beforeInstallErr = hooks.FailureError{Policy: hooks.AbortLaunch}
+	success = p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "The deploy should have failed")
+	Assert(t).IsTrue(testPod.installed, "Install should have happened")
+	Assert(t).IsFalse(testPod.launched, "Launch should have been aborted")
+
+	testPod = &TestPod{launchSuccess: true}
+	fakeHooks.beforeInstallErr = util.Errorf("a hook that ignores failures failed")
+	success = p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "The deploy should have succeeded")
+	Assert(t).IsTrue(testPod.launched, "Launch should have happened")
+}
+
+func TestPreparerRelaunchesOldPodIfBeforeLaunchHookFails(t *testing.T) {
+	oldManifest := testManifest(t)
+	builder := oldManifest.GetBuilder()
+	builder.SetRunAsUser("someone-else")
+	newManifest := builder.GetManifest()
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Intent:  newManifest,
+		Reality: oldManifest,
+	}
+
+	p, fakeHooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	testPod := &TestPod{launchSuccess: true, haltSuccess: true}
+	fakeHooks.beforeLaunchErr = hooks.FailureError{Policy: hooks.AbortLaunch}
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "The deploy should have failed")
+	Assert(t).IsTrue(fakeHooks.ranBeforeLaunch, "Should have run before_launch hooks")
+	Assert(t).IsTrue(testPod.halted, "Should have halted the old pod before the before_launch hooks")
+	Assert(t).IsTrue(testPod.launched, "Should have relaunched the old pod")
+	Assert(t).AreEqual(testPod.currentManifest, oldManifest, "Should have left the old pod running")
+	Assert(t).IsFalse(fakeHooks.ranAfterLaunch, "should not have run after_launch hooks")
+}
+
+func TestPreparerRunsHaltAndManifestUpdateHooks(t *testing.T) {
+	oldManifest := testManifest(t)
+	builder := oldManifest.GetBuilder()
+	err := builder.SetConfig(map[interface{}]interface{}{"updated": true})
+	Assert(t).IsNil(err, "test setup: could not set config")
+	newManifest := builder.GetManifest()
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Intent:  newManifest,
+		Reality: oldManifest,
+	}
+
+	p, fakeHooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	testPod := &TestPod{launchSuccess: true, haltSuccess: true}
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "The deploy should have succeeded")
+	Assert(t).IsTrue(fakeHooks.ranBeforeHalt, "Should have run before_halt hooks")
+	Assert(t).IsTrue(fakeHooks.ranAfterHalt, "Should have run after_halt hooks")
+	Assert(t).IsTrue(fakeHooks.ranAfterManifestUpdate, "Should have run after_manifest_update hooks")
+	Assert(t).AreEqual(fakeHooks.lastDetails.PreviousManifest, oldManifest, "Should have passed the previous manifest")
+
+	fakeHooks.ranAfterManifestUpdate = false
+	builder.SetRunAsUser("someone-else")
+	newPair.Intent = builder.GetManifest()
+	success = p.resolvePair(newPair, &TestPod{launchSuccess: true, haltSuccess: true}, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "The deploy should have succeeded")
+	Assert(t).IsFalse(fakeHooks.ranAfterManifestUpdate, "Should not have run after_manifest_update hooks for a change beyond the config")
+}
+
+func TestPreparerReloadsPodsWhoseConfigChanged(t *testing.T) {
+	oldManifest := testManifest(t)
+	builder := oldManifest.GetBuilder()
+	err := builder.SetConfig(map[interface{}]interface{}{"updated": true})
+	Assert(t).IsNil(err, "test setup: could not set config")
+	newManifest := builder.GetManifest()
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Intent:  newManifest,
+		Reality: oldManifest,
+	}
+
+	p, fakeHooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	testPod := &TestPod{launchSuccess: true, haltSuccess: true, reloadable: true}
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "The reload should have succeeded")
+	Assert(t).IsTrue(testPod.reloaded, "Should have reloaded the pod")
+	Assert(t).IsFalse(testPod.installed, "Should not have reinstalled the pod")
+	Assert(t).IsFalse(testPod.halted, "Should not have halted the pod")
+	Assert(t).IsFalse(testPod.launched, "Should not have relaunched the pod")
+	Assert(t).IsTrue(fakeHooks.ranAfterManifestUpdate, "Should have run after_manifest_update hooks")
+	Assert(t).IsFalse(fakeHooks.ranAfterLaunch, "Should not have run after_launch hooks")
+	Assert(t).AreEqual(testPod.currentManifest, newManifest, "Should have reloaded the new manifest")
+
+	// pods that can't reload are relaunched instead
+	testPod = &TestPod{launchSuccess: true, haltSuccess: true}
+	success = p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "The deploy should have succeeded")
+	Assert(t).IsTrue(testPod.halted, "Should have halted the pod")
+	Assert(t).IsTrue(testPod.launched, "Should have relaunched the pod")
+}
+
 func TestPreparerWillLaunchPreparerAsRoot(t *testing.T) {
 	builder := manifest.NewBuilder()
 	builder.SetID(constants.PreparerPodID)
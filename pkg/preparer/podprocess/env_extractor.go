@@ -2,10 +2,12 @@ package podprocess
 
 import (
 	"os"
+	"time"
 
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/runit"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 
@@ -76,6 +78,17 @@ func (e EnvironmentExtractor) constructFinishFromEnvironment(exitCode int, exitS
 	// It's okay if this one is missing, most pods are "legacy" pods that have a blank unique key
 	podUniqueKey := os.Getenv(pods.PodUniqueKeyEnvVar)
 
+	// Only set if the process exited because its pod was being shut down
+	var shutdownDuration time.Duration
+	if shutdownStarted := os.Getenv(pods.ShutdownStartedEnvVar); shutdownStarted != "" {
+		started, err := time.Parse(time.RFC3339Nano, shutdownStarted)
+		if err != nil {
+			e.Logger.WithError(err).Warnf("Could not parse %s env var", pods.ShutdownStartedEnvVar)
+		} else {
+			shutdownDuration = time.Since(started)
+		}
+	}
+
 	return FinishOutput{
 		PodID:        types.PodID(podID),
 		LaunchableID: launch.LaunchableID(launchableID),
@@ -83,5 +96,9 @@ func (e EnvironmentExtractor) constructFinishFromEnvironment(exitCode int, exitS
 		PodUniqueKey: types.PodUniqueKey(podUniqueKey),
 		ExitCode:     exitCode,
 		ExitStatus:   exitStatus,
+
+		// set by the finish script when this exit marked the process failed
+		RestartsExhausted: os.Getenv(runit.RestartsExhaustedEnvVar) == "true",
+		ShutdownDuration:  shutdownDuration,
 	}, nil
 }
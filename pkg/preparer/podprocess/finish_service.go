@@ -60,6 +60,14 @@ type FinishOutput struct {
 	ExitCode   int `json:"exit_code"`
 	ExitStatus int `json:"exit_status"`
 
+	// Set if the process failed more often than its restart backoff allows
+	// and will not be restarted by runit
+	RestartsExhausted bool `json:"restarts_exhausted"`
+
+	// How long after the pod started shutting down the process exited, or
+	// zero if the process didn't exit because its pod was shut down
+	ShutdownDuration time.Duration `json:"shutdown_duration"`
+
 	// This is never written explicitly and is determined automatically by
 	// sqlite (via AUTOINCREMENT)
 	ID int64
@@ -76,8 +84,10 @@ func (s sqliteFinishService) Insert(finish FinishOutput) error {
 		    launchable_id,
 		    entry_point,
 		    exit_code,
-		    exit_status
-		  ) VALUES(?, ?, ?, ?, ?, ?)`
+		    exit_status,
+		    restarts_exhausted,
+		    shutdown_duration
+		  ) VALUES(?, ?, ?, ?, ?, ?, ?, ?)`
 	_, err := s.db.Exec(stmt,
 		finish.PodID.String(),
 		finish.PodUniqueKey.String(),
@@ -85,6 +95,8 @@ func (s sqliteFinishService) Insert(finish FinishOutput) error {
 		finish.EntryPoint,
 		finish.ExitCode,
 		finish.ExitStatus,
+		finish.RestartsExhausted,
+		int64(finish.ShutdownDuration),
 	)
 	if err != nil {
 		return util.Errorf("Couldn't insert finish line into sqlite database: %s", err)
@@ -120,6 +132,8 @@ var (
 	    exit_status integer
 	);`,
 		"create index finish_date on finishes(date);",
+		"alter table finishes add column restarts_exhausted boolean not null default 0;",
+		"alter table finishes add column shutdown_duration integer not null default 0;",
 		// FUTURE MIGRATIONS GO HERE
 	}
 )
@@ -195,7 +209,7 @@ func (s sqliteFinishService) Close() error {
 
 func (f sqliteFinishService) GetLatestFinishes(lastID int64) ([]FinishOutput, error) {
 	rows, err := f.db.Query(`
-	    SELECT id, date, pod_id, pod_unique_key, launchable_id, entry_point, exit_code, exit_status
+	    SELECT id, date, pod_id, pod_unique_key, launchable_id, entry_point, exit_code, exit_status, restarts_exhausted, shutdown_duration
 	    FROM finishes
 	    WHERE id > ?
 	    `, lastID)
@@ -220,7 +234,7 @@ func (f sqliteFinishService) GetLatestFinishes(lastID int64) ([]FinishOutput, er
 
 func (f sqliteFinishService) LastFinishForPodUniqueKey(podUniqueKey types.PodUniqueKey) (FinishOutput, error) {
 	row := f.db.QueryRow(`
-  SELECT id, date, pod_id, pod_unique_key, launchable_id, entry_point, exit_code, exit_status
+  SELECT id, date, pod_id, pod_unique_key, launchable_id, entry_point, exit_code, exit_status, restarts_exhausted, shutdown_duration
   FROM finishes
   WHERE pod_unique_key = ?
   `, podUniqueKey.String())
@@ -251,8 +265,10 @@ func scanRow(scanner Scanner) (FinishOutput, error) {
 	var date time.Time
 	var podID, podUniqueKey, launchableID, entryPoint string
 	var exitCode, exitStatus int
+	var restartsExhausted bool
+	var shutdownDuration int64
 
-	err := scanner.Scan(&id, &date, &podID, &podUniqueKey, &launchableID, &entryPoint, &exitCode, &exitStatus)
+	err := scanner.Scan(&id, &date, &podID, &podUniqueKey, &launchableID, &entryPoint, &exitCode, &exitStatus, &restartsExhausted, &shutdownDuration)
 	if err != nil {
 		return FinishOutput{}, err
 	}
@@ -266,5 +282,8 @@ func scanRow(scanner Scanner) (FinishOutput, error) {
 		ExitCode:     exitCode,
 		ExitStatus:   exitStatus,
 		ExitTime:     date,
+
+		RestartsExhausted: restartsExhausted,
+		ShutdownDuration:  time.Duration(shutdownDuration),
 	}, nil
 }
@@ -361,16 +361,21 @@ func (r *Reporter) reportLatestExits() {
 
 	for _, finish := range finishes {
 		subLogger := r.logger.SubLogger(logrus.Fields{
-			"pod_id":         finish.PodID,
-			"launchable_id":  finish.LaunchableID,
-			"entry_point":    finish.EntryPoint,
-			"pod_unique_key": finish.PodUniqueKey,
-			"exit_code":      finish.ExitCode,
-			"exit_status":    finish.ExitStatus,
-			"finish_id":      finish.ID,
-			"exit_time":      finish.ExitTime,
+			"pod_id":             finish.PodID,
+			"launchable_id":      finish.LaunchableID,
+			"entry_point":        finish.EntryPoint,
+			"pod_unique_key":     finish.PodUniqueKey,
+			"exit_code":          finish.ExitCode,
+			"exit_status":        finish.ExitStatus,
+			"restarts_exhausted": finish.RestartsExhausted,
+			"shutdown_duration":  finish.ShutdownDuration,
+			"finish_id":          finish.ID,
+			"exit_time":          finish.ExitTime,
 		})
 		subLogger.Debugln("Received process exit information")
+		if finish.RestartsExhausted {
+			subLogger.Warnln("Process exhausted its restarts and will not be restarted")
+		}
 
 		if finish.PodUniqueKey == "" {
 			// Status is only written to consul for uuid pods
@@ -383,6 +388,9 @@ func (r *Reporter) reportLatestExits() {
 			ExitTime:   finish.ExitTime,
 			ExitCode:   finish.ExitCode,
 			ExitStatus: finish.ExitStatus,
+
+			RestartsExhausted: finish.RestartsExhausted,
+			ShutdownDuration:  finish.ShutdownDuration,
 		})
 		if err != nil {
 			subLogger.WithError(err).Errorln("Failed to add 'record status' to transaction'")
@@ -140,6 +140,9 @@ func TestRun(t *testing.T) {
 		PodUniqueKey: types.NewPodUUID(),
 		ExitCode:     3,
 		ExitStatus:   67,
+
+		RestartsExhausted: true,
+		ShutdownDuration:  3 * time.Second,
 	}
 	err = finishService.Insert(finishOutput2)
 	if err != nil {
@@ -214,6 +217,9 @@ func TestRepairCorruptWorkspaceFile(t *testing.T) {
 		PodUniqueKey: types.NewPodUUID(),
 		ExitCode:     3,
 		ExitStatus:   67,
+
+		RestartsExhausted: true,
+		ShutdownDuration:  3 * time.Second,
 	}
 	err = finishService.Insert(finishOutput2)
 	if err != nil {
@@ -267,6 +273,28 @@ func assertStatusUpdated(t *testing.T, finish FinishOutput, podStatusStore testP
 					finish.EntryPoint,
 				)
 			}
+
+			if processStatus.LastExit.RestartsExhausted != finish.RestartsExhausted {
+				t.Errorf(
+					"Expected restarts exhausted to be %t but got %t for pod %s__%s__%s",
+					finish.RestartsExhausted,
+					processStatus.LastExit.RestartsExhausted,
+					finish.PodID,
+					finish.LaunchableID,
+					finish.EntryPoint,
+				)
+			}
+
+			if processStatus.LastExit.ShutdownDuration != finish.ShutdownDuration {
+				t.Errorf(
+					"Expected shutdown duration to be %s but got %s for pod %s__%s__%s",
+					finish.ShutdownDuration,
+					processStatus.LastExit.ShutdownDuration,
+					finish.PodID,
+					finish.LaunchableID,
+					finish.EntryPoint,
+				)
+			}
 		}
 	}
 
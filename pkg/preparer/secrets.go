@@ -0,0 +1,230 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/secrets"
+	"github.com/square/p2/pkg/store/consul/statusstore/podevents"
+	"github.com/square/p2/pkg/user"
+	"github.com/square/p2/pkg/util"
+)
+
+// How often the secrets of installed pods are fetched again unless
+// configured otherwise
+const DefaultSecretsRefreshInterval = time.Minute
+
+// SecretsConfig configures where the preparer fetches the secrets that pod
+// manifests reference from. Pods that reference secrets are not installed
+// unless a provider is configured.
+type SecretsConfig struct {
+	// One of the secrets.*ProviderType constants. Secrets are disabled if
+	// empty
+	Provider string `yaml:"provider,omitempty"`
+
+	// The directory of encrypted secrets and the keyring holding the key to
+	// decrypt them, for the file provider
+	Directory   string `yaml:"directory,omitempty"`
+	KeyringPath string `yaml:"keyring,omitempty"`
+
+	// The secret service and a file containing the token to authenticate to
+	// it with, for the http provider. Requests use the preparer's
+	// cert_file, key_file and ca_file
+	URL       string `yaml:"url,omitempty"`
+	TokenFile string `yaml:"token_file,omitempty"`
+
+	// A file listing the secrets the pods of each user may reference, in
+	// the format described on secrets.Policy. Required by every provider.
+	// It is read again whenever the config is reloaded
+	PolicyPath string `yaml:"policy,omitempty"`
+
+	// The directory in which each pod gets a directory of secrets. It must
+	// be on a tmpfs. Defaults to secrets.DefaultRoot
+	Root string `yaml:"root,omitempty"`
+
+	// How often the secrets of installed pods are fetched again, so that
+	// rotated secrets reach the pods. Defaults to
+	// DefaultSecretsRefreshInterval
+	RefreshInterval time.Duration `yaml:"refresh_interval,omitempty"`
+}
+
+// getSecretsMaterializer returns the materializer for the configured secrets
+// provider, or nil if secrets are disabled
+func getSecretsMaterializer(preparerConfig *PreparerConfig) (*secrets.Materializer, error) {
+	secretsConfig := preparerConfig.Secrets
+	var provider secrets.Provider
+	switch secretsConfig.Provider {
+	case "":
+		return nil, nil
+	case secrets.FileProviderType:
+		fileProvider, err := secrets.NewFileProvider(secretsConfig.Directory, secretsConfig.KeyringPath)
+		if err != nil {
+			return nil, err
+		}
+		provider = fileProvider
+	case secrets.HTTPProviderType:
+		var token string
+		if secretsConfig.TokenFile != "" {
+			tokenBytes, err := ioutil.ReadFile(secretsConfig.TokenFile)
+			if err != nil {
+				return nil, util.Errorf("Could not read secrets token file: %s", err)
+			}
+			token = strings.TrimSpace(string(tokenBytes))
+		}
+		client, err := preparerConfig.GetClient(30 * time.Second)
+		if err != nil {
+			return nil, err
+		}
+		provider = secrets.NewHTTPProvider(secretsConfig.URL, token, client)
+	default:
+		return nil, util.Errorf("unrecognized secrets provider: %s", secretsConfig.Provider)
+	}
+	return secrets.NewMaterializer(provider, secretsConfig.Root), nil
+}
+
+// getSecretsPolicy returns the policy restricting which secrets pods may
+// reference, which is empty if secrets are disabled
+func getSecretsPolicy(preparerConfig *PreparerConfig) (secrets.Policy, error) {
+	if preparerConfig.Secrets.Provider == "" {
+		return secrets.Policy{}, nil
+	}
+	return secrets.LoadPolicy(preparerConfig.Secrets.PolicyPath)
+}
+
+// writeSecrets writes the secrets the manifest references into the pod's
+// secrets directory, or removes the directory if it references none. The
+// pod must be allowed to reference them by the secrets policy
+func (p *Preparer) writeSecrets(podManifest manifest.Manifest, pod Pod, logger logging.Logger) error {
+	stanzas := podManifest.GetSecrets()
+	if p.secretMaterializer == nil {
+		if len(stanzas) > 0 {
+			return util.Errorf("%s references secrets but no secrets provider is configured", podManifest.ID())
+		}
+		return nil
+	}
+
+	p.secretsMux.Lock()
+	defer p.secretsMux.Unlock()
+	dir := p.secretMaterializer.Dir(pod.Home())
+	if len(stanzas) == 0 {
+		return p.secretMaterializer.Remove(dir)
+	}
+	err := p.currentSecretsPolicy().Authorize(podManifest.RunAsUser(), stanzas)
+	if err != nil {
+		return err
+	}
+	uid, gid, err := user.IDs(podManifest.RunAsUser())
+	if err != nil {
+		return util.Errorf("Could not determine pod UID/GID: %s", err)
+	}
+	changed, err := p.secretMaterializer.Materialize(dir, stanzas, uid, gid)
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		logger.WithField("files", changed).Infoln("Wrote secrets")
+	}
+	return nil
+}
+
+// removeSecrets removes the secrets directory of an uninstalled pod
+func (p *Preparer) removeSecrets(pod Pod, logger logging.Logger) {
+	if p.secretMaterializer == nil {
+		return
+	}
+	p.secretsMux.Lock()
+	defer p.secretsMux.Unlock()
+	err := p.secretMaterializer.Remove(p.secretMaterializer.Dir(pod.Home()))
+	if err != nil {
+		logger.WithError(err).Errorln("Could not remove secrets")
+	}
+}
+
+// RotateSecrets periodically fetches the secrets of every installed pod
+// again and replaces the files of those that changed, until quit is closed.
+// This also restores the secrets of pods after the tmpfs was cleared by a
+// reboot. It returns immediately if secrets are disabled.
+func (p *Preparer) RotateSecrets(quit <-chan struct{}) {
+	if p.secretMaterializer == nil {
+		p.Logger.NoFields().Infoln("No secrets provider configured, not rotating secrets")
+		return
+	}
+	interval := p.secretsRefreshInterval
+	if interval <= 0 {
+		interval = DefaultSecretsRefreshInterval
+	}
+
+	p.refreshSecrets()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			p.refreshSecrets()
+		}
+	}
+}
+
+// refreshSecrets refreshes the secrets of every pod installed in the pod
+// root. Failures are logged and retried at the next refresh.
+func (p *Preparer) refreshSecrets() {
+	entries, err := ioutil.ReadDir(p.podRoot)
+	if err != nil {
+		p.Logger.WithError(err).Errorln("Could not list pods to refresh their secrets")
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pod, err := pods.PodFromPodHome(p.node, filepath.Join(p.podRoot, entry.Name()))
+		if err != nil {
+			// not a pod, e.g. the hooks directory, or not installed yet
+			continue
+		}
+		podManifest, err := pod.CurrentManifest()
+		if err != nil || len(podManifest.GetSecrets()) == 0 {
+			continue
+		}
+
+		logger := p.Logger.SubLogger(logrus.Fields{
+			"pod":            podManifest.ID(),
+			"pod_unique_key": pod.UniqueKey(),
+		})
+		changed, err := p.refreshPodSecrets(podManifest, pod)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not refresh secrets")
+			continue
+		}
+		if len(changed) > 0 {
+			logger.WithField("files", changed).Infoln("Rotated secrets")
+			p.emit(p.podEvent(podevents.SecretsRotated, podManifest, pod.UniqueKey()), time.Time{}, nil)
+		}
+	}
+}
+
+func (p *Preparer) refreshPodSecrets(podManifest manifest.Manifest, pod *pods.Pod) ([]string, error) {
+	// the policy may have been reloaded since the pod was installed
+	err := p.currentSecretsPolicy().Authorize(podManifest.RunAsUser(), podManifest.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	uid, gid, err := user.IDs(podManifest.RunAsUser())
+	if err != nil {
+		return nil, util.Errorf("Could not determine pod UID/GID: %s", err)
+	}
+	p.secretsMux.Lock()
+	defer p.secretsMux.Unlock()
+	// the pod may be in the middle of being replaced, so secrets only its
+	// new manifest references must not be removed
+	return p.secretMaterializer.Refresh(p.secretMaterializer.Dir(pod.Home()), podManifest.GetSecrets(), uid, gid)
+}
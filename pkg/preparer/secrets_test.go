@@ -0,0 +1,78 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/secrets"
+)
+
+type fakeSecretProvider map[string]string
+
+func (f fakeSecretProvider) Get(name string) ([]byte, error) {
+	value, ok := f[name]
+	if !ok {
+		return nil, secrets.NotFoundError{Name: name}
+	}
+	return []byte(value), nil
+}
+
+func TestPreparerWritesAndRemovesSecrets(t *testing.T) {
+	// secrets are only written to a tmpfs
+	root, err := ioutil.TempDir("/dev/shm", "p2-secrets")
+	if err != nil {
+		t.Skipf("no tmpfs to write secrets to: %s", err)
+	}
+	defer os.RemoveAll(root)
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "test setup: could not determine current user")
+
+	builder := testManifest(t).GetBuilder()
+	builder.SetRunAsUser(currentUser.Username)
+	builder.SetSecrets([]manifest.SecretStanza{{Name: "db/password"}})
+	secretManifest := builder.GetManifest()
+	newPair := ManifestPair{
+		ID:     secretManifest.ID(),
+		Intent: secretManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	testPod := &TestPod{launchSuccess: true}
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "A pod referencing secrets should not deploy without a secrets provider")
+	Assert(t).IsFalse(testPod.launched, "Should not have launched")
+
+	p.secretMaterializer = secrets.NewMaterializer(fakeSecretProvider{"db/password": "hunter2"}, root)
+	testPod = &TestPod{launchSuccess: true}
+	success = p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "A pod should not get secrets the secrets policy doesn't allow it")
+	Assert(t).IsFalse(testPod.launched, "Should not have launched")
+
+	p.secretsPolicy = secrets.Policy{Users: map[string][]string{currentUser.Username: {"db/*"}}}
+	testPod = &TestPod{launchSuccess: true}
+	success = p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "The deploy should have succeeded")
+	secretsDir := p.secretMaterializer.Dir(testPod.Home())
+	value, err := ioutil.ReadFile(filepath.Join(secretsDir, "password"))
+	Assert(t).IsNil(err, "Should have written the secret")
+	Assert(t).AreEqual(string(value), "hunter2", "Wrong secret value")
+
+	removePair := ManifestPair{
+		ID:      secretManifest.ID(),
+		Reality: secretManifest,
+	}
+	success = p.resolvePair(removePair, &TestPod{currentManifest: secretManifest}, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "Should have removed the pod")
+	_, err = os.Stat(secretsDir)
+	Assert(t).IsTrue(os.IsNotExist(err), "Should have removed the pod's secrets")
+}
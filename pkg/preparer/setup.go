@@ -22,8 +22,11 @@ import (
 
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/configmap"
 	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/health/history"
 	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
@@ -31,11 +34,17 @@ import (
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/preparer/podprocess"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/secrets"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/configmapstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/nodestore"
 	"github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/podevents"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/supervisor"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
@@ -78,17 +87,28 @@ type Preparer struct {
 	Logger                 logging.Logger
 	podFactory             pods.Factory
 	authPolicy             auth.Policy
+	authPolicyUsers        *sync.WaitGroup // counts the users of authPolicy, see acquireAuthPolicy
 	maxLaunchableDiskUsage size.ByteCount
 	finishExec             []string
 	logExec                []string
 	logBridgeBlacklist     []string
 	artifactVerifier       auth.ArtifactVerifier
 	artifactRegistry       artifact.Registry
+	supervisor             supervisor.Supervisor
+	statusClient           *http.Client
 
 	// Exported so it can be checked for nil (it only runs if configured)
 	// and quit channel conditially created
 	PodProcessReporter *podprocess.Reporter
 
+	// Exported so that the status server can stream events to clients
+	Events *EventStream
+
+	// Records the changes in health of the node's pods. Exported so that
+	// the health monitor can record and the status server can serve them.
+	// nil if no health history is configured
+	HealthHistory *history.Recorder
+
 	// The pod manifest to use for hooks
 	hooksManifest manifest.Manifest
 
@@ -97,6 +117,39 @@ type Preparer struct {
 
 	// The directory that will actually be executed by the HookDir
 	hooksExecDir string
+
+	// Keeps this node's record in the node registry alive. nil if node
+	// registration is disabled
+	nodeHeartbeater *nodeHeartbeater
+
+	// Publishes this node's inventory to the status store. nil if node
+	// registration is disabled
+	inventoryReporter *inventoryReporter
+
+	// Guards the fields that Reload() can change: hooks, hooksExecDir,
+	// authPolicy, authPolicyUsers, logBridgeBlacklist and secretsPolicy
+	configMux sync.RWMutex
+
+	// The configuration the preparer was started with
+	config *PreparerConfig
+
+	// Kept so that the hooks can be recreated when the hooks directory is
+	// reloaded
+	podRoot          string
+	hooksAuditLogger hooks.AuditLogger
+	hooksPodLabeler  hooks.PodLabeler
+
+	// Writes the secrets pods reference into their secrets directories. nil
+	// if no secrets provider is configured
+	secretMaterializer     *secrets.Materializer
+	secretsRefreshInterval time.Duration
+	// Restricts which secrets pods may reference
+	secretsPolicy secrets.Policy
+	// Serializes writes to the secrets directories
+	secretsMux sync.Mutex
+
+	// Merges the config maps pods reference into their config
+	configMaps pods.ConfigMapResolver
 }
 
 type store interface {
@@ -124,28 +177,31 @@ type ConsulConfig struct {
 }
 
 type PreparerConfig struct {
-	NodeName               types.NodeName         `yaml:"node_name"`
-	ConsulAddress          string                 `yaml:"consul_address"`
-	ConsulHttps            bool                   `yaml:"consul_https,omitempty"`
-	ConsulTokenPath        string                 `yaml:"consul_token_path,omitempty"`
-	HTTP2                  bool                   `yaml:"http2,omitempty"`
-	HooksDirectory         string                 `yaml:"hooks_directory"`
-	CAFile                 string                 `yaml:"ca_file,omitempty"`
-	CertFile               string                 `yaml:"cert_file,omitempty"`
-	KeyFile                string                 `yaml:"key_file,omitempty"`
-	PodRoot                string                 `yaml:"pod_root,omitempty"`
-	RequireFile            string                 `yaml:"require_file,omitempty"`
-	StatusPort             int                    `yaml:"status_port"`
-	StatusSocket           string                 `yaml:"status_socket"`
-	Auth                   map[string]interface{} `yaml:"auth,omitempty"`
-	ArtifactAuth           map[string]interface{} `yaml:"artifact_auth,omitempty"`
-	ExtraLogDestinations   []LogDestination       `yaml:"extra_log_destinations,omitempty"`
-	LogLevel               string                 `yaml:"log_level,omitempty"`
-	MaxLaunchableDiskUsage string                 `yaml:"max_launchable_disk_usage"`
-	LogExec                []string               `yaml:"log_exec,omitempty"`
-	LogBridgeBlacklist     []string               `yaml:"log_bridge_blacklist,omitempty"`
-	ArtifactRegistryURL    string                 `yaml:"artifact_registry_url,omitempty"`
-	ConsulConfig           ConsulConfig           `yaml:"consul_config,omitempty"`
+	NodeName               types.NodeName       `yaml:"node_name"`
+	ConsulAddress          string               `yaml:"consul_address"`
+	ConsulHttps            bool                 `yaml:"consul_https,omitempty"`
+	ConsulTokenPath        string               `yaml:"consul_token_path,omitempty"`
+	HTTP2                  bool                 `yaml:"http2,omitempty"`
+	HooksDirectory         string               `yaml:"hooks_directory"`
+	CAFile                 string               `yaml:"ca_file,omitempty"`
+	CertFile               string               `yaml:"cert_file,omitempty"`
+	KeyFile                string               `yaml:"key_file,omitempty"`
+	PodRoot                string               `yaml:"pod_root,omitempty"`
+	RequireFile            string               `yaml:"require_file,omitempty"`
+	StatusPort             int                  `yaml:"status_port"`
+	StatusSocket           string               `yaml:"status_socket"`
+	LogsTokenFile          string               `yaml:"logs_token_file,omitempty"`
+	StatusTLSPort          int                  `yaml:"status_tls_port,omitempty"`
+	ExecUsers              []string             `yaml:"exec_users,omitempty"`
+	Auth                   AuthConfig           `yaml:"auth,omitempty"`
+	ArtifactAuth           ManifestVerification `yaml:"artifact_auth,omitempty"`
+	ExtraLogDestinations   []LogDestination     `yaml:"extra_log_destinations,omitempty"`
+	LogLevel               string               `yaml:"log_level,omitempty"`
+	MaxLaunchableDiskUsage string               `yaml:"max_launchable_disk_usage"`
+	LogExec                []string             `yaml:"log_exec,omitempty"`
+	LogBridgeBlacklist     []string             `yaml:"log_bridge_blacklist,omitempty"`
+	ArtifactRegistryURL    string               `yaml:"artifact_registry_url,omitempty"`
+	ConsulConfig           ConsulConfig         `yaml:"consul_config,omitempty"`
 
 	// The pod manifest to use for hooks. If no hooks are desired, use the
 	// NoHooksSentinelValue constant to indicate that there aren't any
@@ -154,6 +210,23 @@ type PreparerConfig struct {
 	// Configures reporting the exit status of processes started by a pod to Consul
 	PodProcessReporterConfig podprocess.ReporterConfig `yaml:"process_result_reporter_config"`
 
+	// Configures registration of this node and its heartbeat in the node registry
+	NodeRegistryConfig NodeRegistryConfig `yaml:"node_registry,omitempty"`
+
+	// Configures publishing this node's inventory to the status store
+	Inventory InventoryConfig `yaml:"inventory,omitempty"`
+
+	// Selects the process supervisor that pods are run under. Defaults to
+	// runit
+	Supervisor supervisor.Config `yaml:"supervisor,omitempty"`
+
+	// Configures where the secrets that manifests reference are fetched from
+	Secrets SecretsConfig `yaml:"secrets,omitempty"`
+
+	// Configures the local history of the health of this node's pods, which
+	// is served by the status server
+	HealthHistory history.Config `yaml:"health_history,omitempty"`
+
 	// Params defines a collection of miscellaneous runtime parameters defined throughout the
 	// source files.
 	Params param.Values `yaml:"params"`
@@ -168,18 +241,20 @@ type PreparerConfig struct {
 
 // --- Deployer ACL strategies ---
 
-// Configuration fields for the "keyring" auth type
-type KeyringAuth struct {
-	Type                string
+// AuthConfig selects the policy deciding which pods the preparer will
+// launch. Type matches one of the auth.Null, auth.Keyring or auth.User
+// constants.
+//
+// "type: none"    - every pod is launched
+// "type: keyring" - manifests must be signed by a key in the keyring, and only
+//                   the authorized deployers may deploy the preparer itself
+// "type: user"    - manifests must be signed by a key in the keyring whose
+//                   owner may deploy the pod according to the deploy policy
+type AuthConfig struct {
+	Type                string   `yaml:"type"`
 	KeyringPath         string   `yaml:"keyring,omitempty"`
 	AuthorizedDeployers []string `yaml:"authorized_deployers,omitempty"`
-}
-
-// Configuration fields for the "user" auth type
-type UserAuth struct {
-	Type             string
-	KeyringPath      string `yaml:"keyring"`
-	DeployPolicyPath string `yaml:"deploy_policy"`
+	DeployPolicyPath    string   `yaml:"deploy_policy,omitempty"`
 }
 
 // --- Artifact verification strategies ---
@@ -193,7 +268,7 @@ type UserAuth struct {
 // "type: either"   - checks that one of "build" or "manifest" strategies pass.
 //
 type ManifestVerification struct {
-	Type           string
+	Type           string   `yaml:"type"`
 	KeyringPath    string   `yaml:"keyring,omitempty"`
 	AllowedSigners []string `yaml:"allowed_signers"`
 }
@@ -215,6 +290,10 @@ func UnmarshalConfig(config []byte) (*PreparerConfig, error) {
 	if err != nil {
 		return nil, util.Errorf("The config file %s was malformatted - %s", config, err)
 	}
+	err = checkUnknownKeys(config)
+	if err != nil {
+		return nil, err
+	}
 
 	if preparerConfig.NodeName == "" {
 		hostname, err := os.Hostname()
@@ -233,6 +312,10 @@ func UnmarshalConfig(config []byte) (*PreparerConfig, error) {
 	if preparerConfig.PodRoot == "" {
 		preparerConfig.PodRoot = pods.DefaultPath
 	}
+	err = preparerConfig.Validate()
+	if err != nil {
+		return nil, err
+	}
 	return preparerConfig, nil
 }
 
@@ -358,16 +441,6 @@ func addHooks(preparerConfig *PreparerConfig, logger logging.Logger) {
 	}
 }
 
-// castYaml() allows a YAML block to be reparsed into a struct type by
-// re-encoding it into YAML and re-parsing it.
-func castYaml(in map[string]interface{}, out interface{}) error {
-	encoded, err := yaml.Marshal(in)
-	if err != nil {
-		return err
-	}
-	return yaml.Unmarshal(encoded, out)
-}
-
 func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, error) {
 	addHooks(preparerConfig, logger)
 
@@ -456,6 +529,16 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		logExec = runit.DefaultLogExec()
 	}
 
+	podSupervisor, err := preparerConfig.Supervisor.Supervisor()
+	if err != nil {
+		return nil, err
+	}
+
+	statusClient, err := pods.NewStatusClient(preparerConfig.CertFile, preparerConfig.KeyFile, preparerConfig.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
 	finishExec := pods.NopFinishExec
 	var podProcessReporter *podprocess.Reporter
 	if preparerConfig.PodProcessReporterConfig.FullyConfigured() {
@@ -494,6 +577,7 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		}
 		hooksPodFactory := pods.NewHookFactory(filepath.Join(preparerConfig.PodRoot, "hooks"), preparerConfig.NodeName, fetcher)
 		hooksPod = hooksPodFactory.NewHookPod(hooksManifest.ID())
+		hooksPod.Supervisor = podSupervisor
 		hooksSqlite, ok := hooksManifest.GetConfig()["sqlite_path"]
 		if ok {
 			sqlitePath := hooksSqlite.(string)
@@ -515,42 +599,125 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		}
 	}
 
+	var heartbeater *nodeHeartbeater
+	if !preparerConfig.NodeRegistryConfig.Disable {
+		heartbeater = &nodeHeartbeater{
+			node:     preparerConfig.NodeName,
+			registry: nodestore.NewConsul(client.KV()),
+			client:   client,
+			config:   preparerConfig.NodeRegistryConfig,
+			logger: logger.SubLogger(logrus.Fields{
+				"component": "NodeHeartbeater",
+			}),
+		}
+	}
+
+	var reporter *inventoryReporter
+	if !preparerConfig.Inventory.Disable {
+		reporter = &inventoryReporter{
+			node:     preparerConfig.NodeName,
+			store:    nodestatus.NewConsul(statusStore, consul.PreparerPodStatusNamespace),
+			podRoot:  preparerConfig.PodRoot,
+			hooksDir: preparerConfig.HooksDirectory,
+			config:   newConfigSummary(preparerConfig),
+			interval: preparerConfig.Inventory.Interval,
+			logger: logger.SubLogger(logrus.Fields{
+				"component": "InventoryReporter",
+			}),
+		}
+	}
+
+	// hook pod selectors can match the labels of the pod being deployed
+	podLabeler := labels.NewConsulApplicator(client, 0, 0)
+
+	secretMaterializer, err := getSecretsMaterializer(preparerConfig)
+	if err != nil {
+		return nil, err
+	}
+	secretsPolicy, err := getSecretsPolicy(preparerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var healthHistory *history.Recorder
+	if preparerConfig.HealthHistory.SQLitePath != "" {
+		healthHistory, err = getHealthHistory(preparerConfig.HealthHistory, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	events := NewEventStream(
+		podevents.NewConsul(statusStore, consul.PreparerPodStatusNamespace),
+		logger.SubLogger(logrus.Fields{
+			"component": "EventStream",
+		}),
+	)
+
 	return &Preparer{
 		node:                   preparerConfig.NodeName,
 		store:                  store,
-		hooks:                  hooks.NewContext(preparerConfig.HooksDirectory, preparerConfig.PodRoot, &logger, auditLogger),
+		hooks:                  hooks.NewContext(preparerConfig.HooksDirectory, preparerConfig.PodRoot, &logger, auditLogger, podLabeler),
 		podStatusStore:         podStatusStore,
 		podStore:               podStore,
 		client:                 client,
 		Logger:                 logger,
 		podFactory:             pods.NewFactory(preparerConfig.PodRoot, preparerConfig.NodeName, fetcher, preparerConfig.RequireFile),
 		authPolicy:             authPolicy,
+		authPolicyUsers:        new(sync.WaitGroup),
 		maxLaunchableDiskUsage: maxLaunchableDiskUsage,
 		finishExec:             finishExec,
 		logExec:                logExec,
 		logBridgeBlacklist:     preparerConfig.LogBridgeBlacklist,
 		artifactVerifier:       artifactVerifier,
 		artifactRegistry:       artifactRegistry,
+		supervisor:             podSupervisor,
+		statusClient:           statusClient,
 		PodProcessReporter:     podProcessReporter,
+		Events:                 events,
+		HealthHistory:          healthHistory,
 		hooksManifest:          hooksManifest,
 		hooksPod:               hooksPod,
 		hooksExecDir:           preparerConfig.HooksDirectory,
+		nodeHeartbeater:        heartbeater,
+		inventoryReporter:      reporter,
+		config:                 preparerConfig,
+		podRoot:                preparerConfig.PodRoot,
+		hooksAuditLogger:       auditLogger,
+		hooksPodLabeler:        podLabeler,
+		secretMaterializer:     secretMaterializer,
+		secretsRefreshInterval: preparerConfig.Secrets.RefreshInterval,
+		secretsPolicy:          secretsPolicy,
+		configMaps:             configmap.NewResolver(configmapstore.NewConsul(client.KV())),
 	}, nil
 }
 
+func getHealthHistory(config history.Config, logger logging.Logger) (*history.Recorder, error) {
+	historyLogger := logger.SubLogger(logrus.Fields{
+		"component": "HealthHistory",
+	})
+	store, err := history.NewSQLiteStore(config.SQLitePath, historyLogger)
+	if err != nil {
+		return nil, err
+	}
+	err = store.Migrate()
+	if err != nil {
+		_ = store.Close()
+		return nil, util.Errorf("could not migrate health history database: %s", err)
+	}
+	return history.NewRecorder(store, config.MaxTransitions, historyLogger), nil
+}
+
 func getDeployerAuth(preparerConfig *PreparerConfig) (auth.Policy, error) {
 	var authPolicy auth.Policy
-	switch t, _ := preparerConfig.Auth["type"].(string); t {
+	var err error
+	authConfig := preparerConfig.Auth
+	switch authConfig.Type {
 	case "":
 		return nil, util.Errorf("must specify authorization policy type")
 	case auth.Null:
 		authPolicy = auth.NullPolicy{}
 	case auth.Keyring:
-		var authConfig KeyringAuth
-		err := castYaml(preparerConfig.Auth, &authConfig)
-		if err != nil {
-			return nil, util.Errorf("error configuring keyring auth: %s", err)
-		}
 		if authConfig.KeyringPath == "" {
 			return nil, util.Errorf("keyring auth must contain a path to the keyring")
 		}
@@ -562,20 +729,15 @@ func getDeployerAuth(preparerConfig *PreparerConfig) (auth.Policy, error) {
 			return nil, util.Errorf("error configuring keyring auth: %s", err)
 		}
 	case auth.User:
-		var userConfig UserAuth
-		err := castYaml(preparerConfig.Auth, &userConfig)
-		if err != nil {
-			return nil, util.Errorf("error configuring user auth: %s", err)
-		}
-		if userConfig.KeyringPath == "" {
+		if authConfig.KeyringPath == "" {
 			return nil, util.Errorf("user auth must contain a path to the keyring")
 		}
-		if userConfig.DeployPolicyPath == "" {
+		if authConfig.DeployPolicyPath == "" {
 			return nil, util.Errorf("user auth must contain a path to the deploy policy")
 		}
 		authPolicy, err = auth.NewUserPolicy(
-			userConfig.KeyringPath,
-			userConfig.DeployPolicyPath,
+			authConfig.KeyringPath,
+			authConfig.DeployPolicyPath,
 			constants.PreparerPodID,
 			constants.PreparerPodID.String(),
 		)
@@ -583,10 +745,7 @@ func getDeployerAuth(preparerConfig *PreparerConfig) (auth.Policy, error) {
 			return nil, util.Errorf("error configuring user auth: %s", err)
 		}
 	default:
-		if t, ok := preparerConfig.Auth["type"].(string); ok {
-			return nil, util.Errorf("unrecognized auth type: %s", t)
-		}
-		return nil, util.Errorf("unrecognized auth type")
+		return nil, util.Errorf("unrecognized auth type: %s", authConfig.Type)
 	}
 	return authPolicy, nil
 }
@@ -600,30 +759,18 @@ func getArtifactVerifier(preparerConfig *PreparerConfig, logger *logging.Logger)
 	fetcher := uri.BasicFetcher{
 		Client: httpClient,
 	}
-	var verif ManifestVerification
-	switch t, _ := preparerConfig.ArtifactAuth["type"].(string); t {
+	verif := preparerConfig.ArtifactAuth
+	switch verif.Type {
 	case "", auth.VerifyNone:
 		return auth.NopVerifier(), nil
 	case auth.VerifyManifest:
-		err = castYaml(preparerConfig.ArtifactAuth, &verif)
-		if err != nil {
-			return nil, util.Errorf("error configuring artifact verification: %v", err)
-		}
 		return auth.NewBuildManifestVerifier(verif.KeyringPath, fetcher, logger)
 	case auth.VerifyBuild:
-		err = castYaml(preparerConfig.ArtifactAuth, &verif)
-		if err != nil {
-			return nil, util.Errorf("error configuring artifact verification: %v", err)
-		}
 		return auth.NewBuildVerifier(verif.KeyringPath, fetcher, logger)
 	case auth.VerifyEither:
-		err = castYaml(preparerConfig.ArtifactAuth, &verif)
-		if err != nil {
-			return nil, util.Errorf("error configuring artifact verification: %v", err)
-		}
 		return auth.NewCompositeVerifier(verif.KeyringPath, fetcher, logger)
 	default:
-		return nil, util.Errorf("Unrecognized artifact verification type: %v", t)
+		return nil, util.Errorf("Unrecognized artifact verification type: %v", verif.Type)
 	}
 }
 
@@ -650,6 +797,28 @@ func getArtifactRegistry(preparerConfig *PreparerConfig) (artifact.Registry, err
 	return artifact.NewRegistry(url, fetcher, osversion.DefaultDetector), nil
 }
 
+// HeartbeatNode registers this node in the node registry and keeps it marked
+// alive until quit is closed. It returns immediately if node registration is
+// disabled.
+func (p *Preparer) HeartbeatNode(quit <-chan struct{}) {
+	if p.nodeHeartbeater == nil {
+		p.Logger.NoFields().Infoln("Node registration is disabled, not heartbeating")
+		return
+	}
+	p.nodeHeartbeater.Run(quit)
+}
+
+// ReportInventory periodically publishes this node's inventory to the status
+// store until quit is closed. It returns immediately if inventory reporting is
+// disabled.
+func (p *Preparer) ReportInventory(quit <-chan struct{}) {
+	if p.inventoryReporter == nil {
+		p.Logger.NoFields().Infoln("Inventory reporting is disabled, not reporting inventory")
+		return
+	}
+	p.inventoryReporter.Run(quit)
+}
+
 func (p *Preparer) InstallHooks() error {
 	if p.hooksManifest == nil {
 		p.Logger.Infoln("No hooks configured, skipping hook installation")
@@ -674,7 +843,7 @@ func (p *Preparer) InstallHooks() error {
 	}
 
 	// Now that the pod is installed, link it up to the exec dir.
-	err = hooks.InstallHookScripts(p.hooksExecDir, p.hooksPod, p.hooksManifest, sub)
+	err = hooks.InstallHookScripts(p.currentHooksExecDir(), p.hooksPod, p.hooksManifest, sub)
 	if err != nil {
 		sub.WithError(err).Errorln("Could not write hook link")
 		return err
@@ -1,12 +1,17 @@
 package preparer
 
 import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
 )
 
 // StatusServer exposes a unix socket server that can be queried for the health
@@ -15,6 +20,7 @@ import (
 type StatusServer struct {
 	listener net.Listener
 	server   *http.Server
+	mux      *http.ServeMux
 	logger   *logging.Logger
 	Exit     chan error
 }
@@ -29,6 +35,7 @@ func NewStatusServer(statusPort int, statusSocket string, logger *logging.Logger
 	server := http.Server{}
 	statusServer := &StatusServer{
 		server: &server,
+		mux:    http.NewServeMux(),
 		logger: logger,
 		Exit:   make(chan error),
 	}
@@ -54,20 +61,104 @@ func NewStatusServer(statusPort int, statusSocket string, logger *logging.Logger
 	return statusServer, nil
 }
 
+// NewTLSStatusServer returns a status server that serves TLS on a TCP port.
+// Clients may present a certificate signed by one of tlsConfig's ClientCAs,
+// which identifies them to handlers that need to know who is calling, such
+// as HandleExec.
+func NewTLSStatusServer(port int, tlsConfig *tls.Config, logger *logging.Logger) (*StatusServer, error) {
+	statusServer := &StatusServer{
+		server: &http.Server{},
+		mux:    http.NewServeMux(),
+		logger: logger,
+		Exit:   make(chan error),
+	}
+
+	config := tlsConfig.Clone()
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	listener, err := statusServer.listenOnPort(port)
+	if err != nil {
+		return nil, err
+	}
+	statusServer.listener = tls.NewListener(listener, config)
+	return statusServer, nil
+}
+
 func (s *StatusServer) Serve() {
 	defer s.Close()
-	mux := http.NewServeMux()
-	mux.HandleFunc("/_status", func(w http.ResponseWriter, r *http.Request) {
+	s.mux.HandleFunc("/_status", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "p2-preparer OK")
 	})
 
-	s.server.Handler = mux
+	s.server.Handler = s.mux
 	err := s.server.Serve(s.listener)
 	s.logger.WithError(err).Warnln("Status server exited!")
 	s.Exit <- err
 	close(s.Exit)
 }
 
+// HandleEvents serves the preparer's lifecycle events at /_events. Clients
+// receive one JSON event per line as they happen until they disconnect. The
+// "pod" and "pod_unique_key" query parameters restrict the stream to a
+// single pod. It may be called after Serve().
+func (s *StatusServer) HandleEvents(events *EventStream) {
+	s.mux.HandleFunc("/_events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		podID := types.PodID(r.URL.Query().Get("pod"))
+		uniqueKey := types.PodUniqueKey(r.URL.Query().Get("pod_unique_key"))
+
+		eventCh, unsubscribe := events.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		encoder := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-eventCh:
+				if podID != "" && event.PodID != podID {
+					continue
+				}
+				if uniqueKey != "" && event.PodUniqueKey != uniqueKey {
+					continue
+				}
+				err := encoder.Encode(event)
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// authorized returns whether a request carries the token as a bearer token
+// in its Authorization header.
+func authorized(r *http.Request, token string) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1
+}
+
+// callerName returns the common name of the verified client certificate a
+// request was made with, if any.
+func callerName(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", false
+	}
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	return name, name != ""
+}
+
 func (s *StatusServer) listenOnPort(statusPort int) (net.Listener, error) {
 	s.logger.WithField("port", statusPort).Infof("Reporting status on port %d", statusPort)
 	return net.Listen("tcp", fmt.Sprintf(":%d", statusPort))
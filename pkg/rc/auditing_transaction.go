@@ -5,6 +5,7 @@ import (
 
 	"github.com/square/p2/pkg/audit"
 	pc_fields "github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
@@ -16,6 +17,7 @@ type auditingTransaction struct {
 	ctx           context.Context
 	nodes         map[types.NodeName]struct{}
 	auditLogStore AuditLogStore
+	rcID          fields.ID
 	podID         types.PodID
 	az            pc_fields.AvailabilityZone
 	cn            pc_fields.ClusterName
@@ -36,6 +38,7 @@ func (rc *replicationController) newAuditingTransaction(
 	}
 
 	rc.mu.Lock()
+	rcID := rc.RC.ID
 	manifest := rc.Manifest
 	podLabels := rc.PodLabels
 	rc.mu.Unlock()
@@ -43,6 +46,7 @@ func (rc *replicationController) newAuditingTransaction(
 		ctx:           ctx,
 		nodes:         startingNodeMap,
 		auditLogStore: rc.auditLogStore,
+		rcID:          rcID,
 		podID:         manifest.ID(),
 		az:            pc_fields.AvailabilityZone(podLabels[types.AvailabilityZoneLabel]),
 		cn:            pc_fields.ClusterName(podLabels[types.ClusterNameLabel]),
@@ -95,6 +99,7 @@ func (a *auditingTransaction) CommitWithRetries(txner transaction.Txner) (bool,
 
 func (a *auditingTransaction) commitCommon(txner transaction.Txner) error {
 	details, err := audit.NewRCRetargetingEventDetails(
+		a.rcID,
 		a.podID,
 		a.az,
 		a.cn,
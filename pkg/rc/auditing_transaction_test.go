@@ -27,6 +27,7 @@ func TestAuditingTransaction(t *testing.T) {
 	auditLogStore := auditlogstore.NewConsulStore(fixture.Client.KV())
 	rc := &replicationController{
 		RC: rc_fields.RC{
+			ID:       "some_rc",
 			Manifest: testManifest(),
 			PodLabels: klabels.Set{
 				pc_fields.AvailabilityZoneLabel: "some_az",
@@ -73,6 +74,9 @@ func testSuccessfulCommit(auditLogStore auditlogstore.ConsulStore, t *testing.T)
 			t.Fatal(err)
 		}
 
+		if details.RCID != "some_rc" {
+			t.Errorf("expected audit log details to have RC ID %q but was %q", "some_rc", details.RCID)
+		}
 		if details.PodID != testManifest().ID() {
 			t.Errorf("expected audit log details to have pod ID %q but was %q", testManifest().ID(), details.PodID)
 		}
@@ -197,6 +201,7 @@ func testCommitWithRetries(fixture consulutil.Fixture, t *testing.T, shouldErr b
 	auditLogStore := auditlogstore.NewConsulStore(fixture.Client.KV())
 	rc := &replicationController{
 		RC: rc_fields.RC{
+			ID:       "some_rc",
 			Manifest: testManifest(),
 			PodLabels: klabels.Set{
 				pc_fields.AvailabilityZoneLabel: "some_az",
@@ -360,6 +360,7 @@ func (rcf *Farm) initialFailsafe() {
 		if err := rcf.alerter.Alert(alerting.AlertInfo{
 			Description: "No RCs have been scheduled",
 			IncidentKey: "no_rcs_found",
+			Labels:      farmAlertLabels(),
 		}, alerting.HighUrgency); err != nil {
 			rcf.logger.WithError(err).Errorln("Unable to deliver alert!")
 		}
@@ -376,6 +377,7 @@ func (rcf *Farm) initialFailsafe() {
 	if err := rcf.alerter.Alert(alerting.AlertInfo{
 		Description: "All RCs have zero replicas requested",
 		IncidentKey: "zero_replicas_found",
+		Labels:      farmAlertLabels(),
 	}, alerting.HighUrgency); err != nil {
 		rcf.logger.WithError(err).Errorln("Unable to deliver alert!")
 	}
@@ -390,6 +392,7 @@ func (rcf *Farm) failsafe(rcs []rcstore.RCLockResult) {
 		if err := rcf.alerter.Alert(alerting.AlertInfo{
 			Description: "No RCs have been scheduled",
 			IncidentKey: "no_rcs_found",
+			Labels:      farmAlertLabels(),
 		}, alerting.HighUrgency); err != nil {
 			rcf.logger.WithError(err).Errorln("Unable to deliver alert!")
 		}
@@ -397,6 +400,12 @@ func (rcf *Farm) failsafe(rcs []rcstore.RCLockResult) {
 	}
 }
 
+// farmAlertLabels returns the labels of alerts about the farm as a whole
+// rather than a single RC
+func farmAlertLabels() map[string]string {
+	return map[string]string{alerting.ComponentLabel: "rc_farm"}
+}
+
 func (rcf *Farm) releaseDeletedChildren(foundChildren map[fields.ID]struct{}) {
 	rcf.childMu.Lock()
 	defer rcf.childMu.Unlock()
@@ -392,9 +392,22 @@ func (rc *replicationController) alertInfo(msg string) alerting.AlertInfo {
 	manifest := rc.Manifest
 	nodeSelector := rc.NodeSelector
 	rc.mu.Unlock()
+
+	// route alerts by the RC's labels, which include those of its pod
+	// cluster
+	alertLabels := map[string]string{alerting.PodIDLabel: manifest.ID().String()}
+	rcLabels, err := rc.podApplicator.GetLabels(labels.RC, rcID.String())
+	if err != nil {
+		rc.logger.WithError(err).Warnln("Could not read the RC's labels to route an alert")
+	}
+	for key, value := range rcLabels.Labels {
+		alertLabels[key] = value
+	}
+
 	return alerting.AlertInfo{
 		Description: msg,
 		IncidentKey: rcID.String(),
+		Labels:      alertLabels,
 		Details: struct {
 			RCID         string `json:"rc_id"`
 			Hostname     string `json:"hostname"`
@@ -0,0 +1,240 @@
+// Package render builds pod manifests out of a base manifest and overlays, so
+// that one manifest can be maintained for an app and specialized per cluster or
+// availability zone.
+//
+// The base manifest and the overlays are Go templates (see text/template)
+// executed with the variables passed to Render, e.g. {{.az}}. Each overlay is
+// then merged into the result of the previous ones:
+//
+//   - maps, such as launchables, env and config, are merged key by key, so an
+//     overlay only needs to name what it changes
+//   - a key set to null in an overlay is removed
+//   - lists whose items all have a name, such as secrets and config_maps, are
+//     merged item by item by name
+//   - any other value, including other lists, is replaced
+package render
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"text/template"
+
+	"golang.org/x/crypto/openpgp/clearsign"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+// Options controls how a manifest is rendered from a base manifest.
+type Options struct {
+	// Paths of the overlays to merge into the base manifest, in order
+	Overlays []string
+	// Variables the base manifest and the overlays are executed with
+	Vars map[string]string
+	// Whether to clearsign the rendered manifest with gpg
+	Sign bool
+	// The gpg key to sign with. gpg's default key is used if empty
+	GPGKey string
+}
+
+// Flags are the command line flags that set Options. CLIs that accept a
+// manifest add them to the command that accepts it.
+type Flags struct {
+	overlays *[]string
+	vars     *map[string]string
+	sign     *bool
+	gpgKey   *string
+}
+
+// FlagAdder is implemented by both kingpin commands and applications.
+type FlagAdder interface {
+	Flag(name, help string) *kingpin.FlagClause
+}
+
+func AddFlags(cmd FlagAdder) Flags {
+	return Flags{
+		overlays: cmd.Flag("overlay", "An overlay to merge into the manifest, e.g. for a cluster or availability zone. Can be specified multiple times, later overlays take precedence").Strings(),
+		vars:     cmd.Flag("var", "A variable, in NAME=VALUE form, the manifest and overlays are rendered with. Can be specified multiple times").StringMap(),
+		sign:     cmd.Flag("sign", "Clearsign the rendered manifest with gpg").Bool(),
+		gpgKey:   cmd.Flag("gpg-key", "The gpg key to sign the rendered manifest with. Defaults to gpg's default key").String(),
+	}
+}
+
+func (f Flags) Options() Options {
+	return Options{
+		Overlays: *f.overlays,
+		Vars:     *f.vars,
+		Sign:     *f.sign,
+		GPGKey:   *f.gpgKey,
+	}
+}
+
+// Load reads the manifest at basePath and renders it with opts. If opts asks
+// for no overlays, variables or signature, the manifest is returned exactly as
+// read, so that its signature, if any, stays valid.
+func Load(basePath string, opts Options) (manifest.Manifest, error) {
+	if len(opts.Overlays) == 0 && len(opts.Vars) == 0 && !opts.Sign {
+		return manifest.FromPath(basePath)
+	}
+	rendered, err := Render(basePath, opts.Overlays, opts.Vars)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Sign {
+		return Sign(rendered, opts.GPGKey)
+	}
+	return rendered, nil
+}
+
+// Render renders the manifest at basePath with the overlays at overlayPaths,
+// in order. A signed base manifest or overlay is rendered from its plaintext,
+// so the result is unsigned.
+func Render(basePath string, overlayPaths []string, vars map[string]string) (manifest.Manifest, error) {
+	merged, err := readTemplate(basePath, vars)
+	if err != nil {
+		return nil, err
+	}
+	for _, overlayPath := range overlayPaths {
+		overlay, err := readTemplate(overlayPath, vars)
+		if err != nil {
+			return nil, err
+		}
+		merged = Merge(merged, overlay)
+	}
+
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, util.Errorf("Could not marshal rendered manifest: %s", err)
+	}
+	rendered, err := manifest.FromBytes(out)
+	if err != nil {
+		return nil, util.Errorf("Rendered manifest is invalid: %s", err)
+	}
+	return rendered, nil
+}
+
+func readTemplate(path string, vars map[string]string) (map[interface{}]interface{}, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.Errorf("Could not read %s: %s", path, err)
+	}
+	if signed, _ := clearsign.Decode(contents); signed != nil {
+		contents = signed.Plaintext
+	}
+
+	tmpl, err := template.New(path).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, util.Errorf("Could not parse %s as a template: %s", path, err)
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	var executed bytes.Buffer
+	err = tmpl.Execute(&executed, vars)
+	if err != nil {
+		return nil, util.Errorf("Could not render %s: %s", path, err)
+	}
+
+	parsed := make(map[interface{}]interface{})
+	err = yaml.Unmarshal(executed.Bytes(), &parsed)
+	if err != nil {
+		return nil, util.Errorf("Could not parse %s: %s", path, err)
+	}
+	return parsed, nil
+}
+
+// Merge returns base with overlay merged into it, as described in the package
+// documentation. Neither argument is modified.
+func Merge(base, overlay map[interface{}]interface{}) map[interface{}]interface{} {
+	merged := make(map[interface{}]interface{}, len(base))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overlay {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = mergeValue(merged[key], value)
+	}
+	return merged
+}
+
+func mergeValue(base, overlay interface{}) interface{} {
+	switch overlay := overlay.(type) {
+	case map[interface{}]interface{}:
+		if base, ok := base.(map[interface{}]interface{}); ok {
+			return Merge(base, overlay)
+		}
+	case []interface{}:
+		if base, ok := base.([]interface{}); ok && namedItems(base) && namedItems(overlay) {
+			return mergeNamed(base, overlay)
+		}
+	}
+	return overlay
+}
+
+func namedItems(list []interface{}) bool {
+	for _, item := range list {
+		if itemName(item) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func itemName(item interface{}) interface{} {
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil
+	}
+	return m["name"]
+}
+
+// mergeNamed merges overlay items into the base items with the same name,
+// keeping the base's order, and appends the rest
+func mergeNamed(base, overlay []interface{}) []interface{} {
+	merged := make([]interface{}, len(base))
+	copy(merged, base)
+	index := make(map[interface{}]int, len(base))
+	for i, item := range merged {
+		index[itemName(item)] = i
+	}
+	for _, item := range overlay {
+		name := itemName(item)
+		if i, ok := index[name]; ok {
+			merged[i] = Merge(merged[i].(map[interface{}]interface{}), item.(map[interface{}]interface{}))
+			continue
+		}
+		index[name] = len(merged)
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+// Sign clearsigns the manifest with gpg, the same way manifests are usually
+// signed by hand.
+func Sign(m manifest.Manifest, gpgKey string) (manifest.Manifest, error) {
+	plaintext, err := m.Marshal()
+	if err != nil {
+		return nil, util.Errorf("Could not marshal manifest: %s", err)
+	}
+	args := []string{"--batch", "--clearsign"}
+	if gpgKey != "" {
+		args = append(args, "--local-user", gpgKey)
+	}
+	var signed bytes.Buffer
+	cmd := exec.Command("gpg", args...)
+	cmd.Stdin = bytes.NewReader(plaintext)
+	cmd.Stdout = &signed
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, util.Errorf("Could not sign manifest with gpg: %s", err)
+	}
+	return manifest.FromBytes(signed.Bytes())
+}
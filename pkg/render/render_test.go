@@ -0,0 +1,96 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+const baseManifest = `id: web
+launchables:
+  app:
+    launchable_type: hoist
+    launchable_id: app
+    location: https://example.com/web_{{.version}}.tar.gz
+    env:
+      LOG_LEVEL: info
+      DEBUG: "true"
+config:
+  port: 8080
+  database:
+    host: db.local
+    pool: 10
+  features: [a, b]
+secrets:
+- name: db-password
+  file: password
+- name: api-key
+`
+
+const clusterOverlay = `launchables:
+  app:
+    env:
+      LOG_LEVEL: warn
+      DEBUG: null
+config:
+  database:
+    host: db.{{.cluster}}
+  features: [c]
+secrets:
+- name: db-password
+  file: db_password
+- name: tls-cert
+`
+
+func writeFile(t *testing.T, dir string, name string, contents string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRenderMergesOverlays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "render")
+	Assert(t).IsNil(err, "unexpected error creating temp dir")
+	defer os.RemoveAll(dir)
+	base := writeFile(t, dir, "base.yaml", baseManifest)
+	overlay := writeFile(t, dir, "prod.yaml", clusterOverlay)
+
+	rendered, err := Render(base, []string{overlay}, map[string]string{"version": "1.2", "cluster": "prod"})
+	Assert(t).IsNil(err, "unexpected error rendering manifest")
+
+	app := rendered.GetLaunchableStanzas()["app"]
+	Assert(t).AreEqual(app.Location, "https://example.com/web_1.2.tar.gz", "template variable was not rendered")
+	Assert(t).AreEqual(app.LaunchableType, "hoist", "unchanged launchable field was lost")
+	Assert(t).AreEqual(app.Env["LOG_LEVEL"], "warn", "env was not overridden")
+	_, ok := app.Env["DEBUG"]
+	Assert(t).IsFalse(ok, "env set to null should be removed")
+
+	config := rendered.GetConfig()
+	Assert(t).AreEqual(config["port"], 8080, "unchanged config was lost")
+	database := config["database"].(map[interface{}]interface{})
+	Assert(t).AreEqual(database["host"], "db.prod", "nested config was not overridden")
+	Assert(t).AreEqual(database["pool"], 10, "unchanged nested config was lost")
+	Assert(t).AreEqual(len(config["features"].([]interface{})), 1, "list without names should be replaced")
+
+	secrets := rendered.GetSecrets()
+	Assert(t).AreEqual(len(secrets), 3, "secrets should be merged by name")
+	Assert(t).AreEqual(secrets[0].Name, "db-password", "secrets should keep the base order")
+	Assert(t).AreEqual(secrets[0].File, "db_password", "secret was not overridden")
+	Assert(t).AreEqual(secrets[2].Name, "tls-cert", "new secret should be appended")
+}
+
+func TestRenderRequiresVariables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "render")
+	Assert(t).IsNil(err, "unexpected error creating temp dir")
+	defer os.RemoveAll(dir)
+	base := writeFile(t, dir, "base.yaml", baseManifest)
+
+	_, err = Render(base, nil, nil)
+	Assert(t).IsNotNil(err, "expected an error rendering a manifest with a missing variable")
+}
@@ -451,11 +451,14 @@ func (rlf *Farm) mustDeleteRU(id roll_fields.ID, logger logging.Logger) {
 	// the transaction was rolled back which shouldn't happen because it
 	// doesn't contain any conditional operations, just deleting the RU and
 	// creating an audit log record. something really weird is going on if
-	// we get here so send an alert for manual intervention
+	// we get here so send an alert for manual intervention. An RU's ID is
+	// that of its new RC
+	alertLabels := rcAlertLabels(rlf.labeler, fields.ID(id.String()), logger)
 	f2 := func() error {
 		return rlf.alerter.Alert(alerting.AlertInfo{
 			Description: "could not commit RU deletion transaction",
 			IncidentKey: "roll-deletion-" + id.String(),
+			Labels:      alertLabels,
 			Details: struct {
 				Errors api.TxnErrors `json:"error"`
 			}{
@@ -469,3 +472,17 @@ func (rlf *Farm) mustDeleteRU(id roll_fields.ID, logger logging.Logger) {
 		time.Sleep(1 * time.Second)
 	}
 }
+
+// rcAlertLabels returns the labels of an RC, which include its pod ID, to
+// route alerts about it
+func rcAlertLabels(labeler labeler, rcID fields.ID, logger logging.Logger) map[string]string {
+	alertLabels := make(map[string]string)
+	rcLabels, err := labeler.GetLabels(labels.RC, rcID.String())
+	if err != nil {
+		logger.WithError(err).Warnln("Could not read the RC's labels to route an alert")
+	}
+	for key, value := range rcLabels.Labels {
+		alertLabels[key] = value
+	}
+	return alertLabels
+}
@@ -147,6 +147,7 @@ func TestCleanupOldRCTooManyReplicas(t *testing.T) {
 		Update:  fields.Update{OldRC: rc.ID},
 		logger:  logging.TestLogger(),
 		rcStore: rcStore,
+		labeler: applicator,
 		alerter: errorOnceChannelAlerter{out: alertOut},
 	}
 
@@ -49,7 +49,7 @@ type update struct {
 	rcStore  ReplicationControllerStore
 	rcLocker ReplicationControllerLocker
 	hcheck   checker.ConsulHealthChecker
-	labeler  rc.LabelMatcher
+	labeler  labeler
 
 	logger logging.Logger
 
@@ -79,7 +79,7 @@ func NewUpdate(
 	rcLocker ReplicationControllerLocker,
 	rcStore ReplicationControllerStore,
 	hcheck checker.ConsulHealthChecker,
-	labeler rc.LabelMatcher,
+	labeler labeler,
 	logger logging.Logger,
 	session consul.Session,
 	watchDelay time.Duration,
@@ -210,9 +210,12 @@ func (u *update) cleanupOldRC(quit <-chan struct{}) {
 			// the remaining nodes off of this RC and then
 			// deleting it
 			u.logger.Errorln("could not delete old RC because its replica count is nonzero")
+			alertLabels := rcAlertLabels(u.labeler, u.OldRC, u.logger)
+			alertLabels[alerting.PodIDLabel] = oldRC.Manifest.ID().String()
 			err = u.alerter.Alert(alerting.AlertInfo{
 				Description: "old RC did not have 0 replicas and could not be deleted.",
 				IncidentKey: "roll-" + u.ID().String(),
+				Labels:      alertLabels,
 				Details: struct {
 					OldRCID     string `json:"old_rc_id"`
 					RUID        string `json:"ru_id"`
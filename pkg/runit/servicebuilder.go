@@ -25,6 +25,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/square/p2/pkg/p2exec"
 	"github.com/square/p2/pkg/util"
@@ -39,12 +40,53 @@ type Exec []string
 const (
 	RestartPolicyAlways RestartPolicy = "always"
 	RestartPolicyNever  RestartPolicy = "never"
+	// Restart the service only if it exits with a nonzero exit code or is
+	// killed by a signal
+	RestartPolicyOnFailure RestartPolicy = "on-failure"
 
 	DefaultRestartPolicy = RestartPolicyAlways
 
 	DOWN_FILE_NAME = "down"
+
+	// Written to the service directory by the finish script, these record
+	// the times of recent failures and whether the service has exhausted its
+	// restarts.
+	RESTARTS_FILE_NAME = "restarts"
+	FAILED_FILE_NAME   = "failed"
+
+	// Set to "true" in the environment of the finish command when the exit
+	// it reports caused the service to be marked failed.
+	RestartsExhaustedEnvVar = "RESTARTS_EXHAUSTED"
 )
 
+// Valid returns whether the restart policy is one that p2 knows how to
+// implement.
+func (r RestartPolicy) Valid() bool {
+	switch r {
+	case RestartPolicyAlways, RestartPolicyNever, RestartPolicyOnFailure:
+		return true
+	}
+	return false
+}
+
+// Restarts returns whether a service with this restart policy is restarted
+// by its supervisor at all.
+func (r RestartPolicy) Restarts() bool {
+	return r == RestartPolicyAlways || r == RestartPolicyOnFailure
+}
+
+// Backoff describes how a service that keeps failing is restarted. Each
+// consecutive failure within Window doubles the delay before the next start,
+// starting at Initial and capped at Max. If the service fails more than
+// MaxRestarts times within Window it is marked failed and is not restarted
+// again until it is started explicitly. A MaxRestarts of 0 never gives up.
+type Backoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	MaxRestarts int
+	Window      time.Duration
+}
+
 // To maintain compatibility with Ruby1.8's YAML serializer, a document separator with a
 // trailing space must be used.
 const yamlSeparator = "--- "
@@ -71,6 +113,15 @@ type ServiceTemplate struct {
 	// TODO: write this to the servicebuilder file and use it to determine
 	// how the service should be started
 	RestartPolicy RestartPolicy `yaml:"-"`
+
+	// If set, restarts after failures are delayed and limited as described
+	// by Backoff. Like RestartPolicy, this is only reflected in the staged
+	// scripts.
+	Backoff *Backoff `yaml:"-"`
+
+	// The signal, e.g. "INT", that runsv sends instead of TERM to stop the
+	// service. Also only reflected in the staged scripts.
+	StopSignal string `yaml:"-"`
 }
 
 func (s ServiceTemplate) runScript() ([]byte, error) {
@@ -89,6 +140,10 @@ func (s ServiceTemplate) runScript() ([]byte, error) {
 		sleep = *s.Sleep
 	}
 
+	if s.Backoff != nil {
+		return s.backoffRunScript(sleep, args), nil
+	}
+
 	ret := fmt.Sprintf(`#!/usr/bin/ruby
 $stderr.reopen(STDOUT)
 require 'yaml'
@@ -102,6 +157,46 @@ __END__
 	return []byte(ret), nil
 }
 
+// backoffRunScript is the run script for services with a Backoff. It waits
+// longer the more often the service failed recently, as recorded by the
+// finish script.
+func (s ServiceTemplate) backoffRunScript(sleep int, args []byte) []byte {
+	ret := fmt.Sprintf(`#!/usr/bin/ruby
+$stderr.reopen(STDOUT)
+require 'yaml'
+# runsv only runs a failed service when it is started explicitly, so the
+# failures that led to it are forgotten
+if File.exist?('%[1]s')
+  File.delete('%[1]s')
+  File.delete('%[2]s') if File.exist?('%[2]s')
+end
+failures = 0
+if File.exist?('%[2]s')
+  failures = File.readlines('%[2]s').select { |t| t.to_i > Time.now.to_i - %[3]s }.size
+end
+sleep(failures == 0 ? %[4]d : [%[5]s * 2 ** (failures - 1), %[6]s].min)
+exec *YAML.load(DATA.read)
+sleep 2
+__END__
+%[7]s
+%[8]s
+`,
+		FAILED_FILE_NAME,
+		RESTARTS_FILE_NAME,
+		seconds(s.Backoff.Window),
+		sleep,
+		seconds(s.Backoff.Initial),
+		seconds(s.Backoff.Max),
+		yamlSeparator,
+		args,
+	)
+	return []byte(ret)
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
 func (s ServiceTemplate) logScript() ([]byte, error) {
 	sleep := 2
 	if s.LogSleep != nil && *s.LogSleep >= 0 {
@@ -133,18 +228,65 @@ __END__
 	return []byte(ret), nil
 }
 
+// stopScript returns the control/t script that runsv runs instead of sending
+// TERM, or nil if the service is stopped with TERM. runsv only sends TERM
+// itself if the script fails, e.g. because the service isn't running.
+func (s ServiceTemplate) stopScript() []byte {
+	if s.StopSignal == "" || s.StopSignal == "TERM" {
+		return nil
+	}
+	return []byte(fmt.Sprintf(`#!/bin/sh
+exec kill -%s "$(cat supervise/pid)"
+`, s.StopSignal))
+}
+
 func (s ServiceTemplate) finishScript() ([]byte, error) {
 	finish_exec := s.Finish
 	if len(finish_exec) == 0 {
 		finish_exec = []string{"/bin/true", "# finish not implemented"}
 	}
 	finishScript := fmt.Sprintf(`#!/bin/bash
-%s
-`, strings.Join(finish_exec, " "))
+%s%s
+`, s.restartScript(), strings.Join(finish_exec, " "))
 
 	return []byte(finishScript), nil
 }
 
+// restartScript returns the part of the finish script that decides whether
+// runsv may restart the service. It runs in the service directory with the
+// exit code in $1. Writing "d" to supervise/control tells runsv to leave the
+// service down once the finish script is done.
+func (s ServiceTemplate) restartScript() string {
+	var success, failure string
+	if s.RestartPolicy == RestartPolicyOnFailure {
+		success = "\tprintf d > supervise/control\n"
+	}
+	if s.Backoff != nil {
+		success = fmt.Sprintf("\trm -f %s\n", RESTARTS_FILE_NAME) + success
+		failure = fmt.Sprintf(`	now=$(date +%%s)
+	{ awk -v since=$((now - %[1]d)) '$1 > since' %[2]s 2>/dev/null; echo $now; } > %[2]s.new
+	mv %[2]s.new %[2]s
+`, int64(s.Backoff.Window.Seconds()), RESTARTS_FILE_NAME)
+		if s.Backoff.MaxRestarts > 0 {
+			failure += fmt.Sprintf(`	if [ $(wc -l < %s) -gt %d ]; then
+		printf d > supervise/control
+		touch %s
+		export %s=true
+	fi
+`, RESTARTS_FILE_NAME, s.Backoff.MaxRestarts, FAILED_FILE_NAME, RestartsExhaustedEnvVar)
+		}
+	}
+
+	if success == "" && failure == "" {
+		return ""
+	}
+	ret := "if [ \"$1\" = 0 ]; then\n" + success
+	if failure != "" {
+		ret += "else\n" + failure
+	}
+	return ret + "fi\n"
+}
+
 type ServiceBuilder struct {
 	ConfigRoot  string // directory to generate YAML files
 	StagingRoot string // directory to place staged runit services
@@ -253,11 +395,40 @@ func (s *ServiceBuilder) stage(templates map[string]ServiceTemplate) error {
 			return err
 		}
 
+		stopScriptPath := filepath.Join(stageDir, "control", "t")
+		if stopScript := template.stopScript(); stopScript != nil {
+			err = os.MkdirAll(filepath.Dir(stopScriptPath), 0755)
+			if err != nil {
+				return err
+			}
+			if _, err := util.WriteIfChanged(stopScriptPath, stopScript, 0755); err != nil {
+				return err
+			}
+		} else {
+			// remove any stop script from a previous installation with
+			// a different stop signal
+			err = os.Remove(stopScriptPath)
+			if err != nil && !os.IsNotExist(err) {
+				return util.Errorf("Unable to remove stop script: %s", err)
+			}
+		}
+
 		// If a "down" file is not present, runit will restart the process
 		// whenever it finishes. Prevent that if the requested restart policy
-		// is not RestartAlways
+		// never restarts. The finish script keeps on-failure services
+		// from being restarted after they succeed.
+		//
+		// runsvdir also starts a new service as soon as it is activated
+		// unless it has a down file, so new services are held down until
+		// they are started explicitly, in the order their pod starts them.
+		// Starting them through a runit supervisor removes the down file.
+		_, err = os.Lstat(filepath.Join(s.RunitRoot, serviceName))
+		isNew := os.IsNotExist(err)
+		if err != nil && !isNew {
+			return err
+		}
 		downPath := filepath.Join(stageDir, DOWN_FILE_NAME)
-		if template.RestartPolicy != RestartPolicyAlways {
+		if isNew || !template.RestartPolicy.Restarts() {
 			file, err := os.Create(downPath)
 			if err != nil {
 				return err
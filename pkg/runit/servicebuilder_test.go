@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/anthonybishopric/gotcha"
 	"gopkg.in/yaml.v2"
@@ -92,7 +93,16 @@ func TestStagedContents(t *testing.T) {
 	Assert(t).IsNil(err, "should have statted staging finish")
 	Assert(t).IsTrue(info.Mode()&0100 == 0100, "finish script should have been executable")
 
-	// There should be no 'down' file if the restart policy is 'always'
+	// A new service is held down by a 'down' file until it is started
+	_, err = os.Stat(filepath.Join(sb.StagingRoot, "foo", "down"))
+	Assert(t).IsNil(err, "down file should have existed for a new service")
+
+	// There should be no 'down' file for an activated service if the
+	// restart policy is 'always'
+	err = sb.activate(fakeTemplate(RestartPolicyAlways))
+	Assert(t).IsNil(err, "should have activated")
+	err = sb.stage(fakeTemplate(RestartPolicyAlways))
+	Assert(t).IsNil(err, "should have staged")
 	_, err = os.Stat(filepath.Join(sb.StagingRoot, "foo", "down"))
 	Assert(t).IsNotNil(err, "down file should not have existed when restart policy is 'always'")
 	Assert(t).IsTrue(os.IsNotExist(err), "down file should not have existed when restart policy is 'always'")
@@ -110,8 +120,10 @@ func TestDownFile(t *testing.T) {
 	_, err = os.Stat(filepath.Join(sb.StagingRoot, "foo", "down"))
 	Assert(t).IsNil(err, "down file should have existed when restart policy is 'always'")
 
-	// Now stage it again as RestartPolicyAlways and make sure 'down' file
-	// is removed
+	// Now stage the activated service again as RestartPolicyAlways and
+	// make sure 'down' file is removed
+	err = sb.activate(fakeTemplate(RestartPolicyNever))
+	Assert(t).IsNil(err, "should have activated")
 	err = sb.stage(fakeTemplate(RestartPolicyAlways))
 	Assert(t).IsNil(err, "should have staged")
 
@@ -122,6 +134,80 @@ func TestDownFile(t *testing.T) {
 	Assert(t).IsTrue(os.IsNotExist(err), "down file should not have existed when restart policy is 'always'")
 }
 
+func TestStopScript(t *testing.T) {
+	sb := FakeServiceBuilder()
+	defer sb.Cleanup()
+
+	templates := fakeTemplate(RestartPolicyAlways)
+	template := templates["foo"]
+	template.StopSignal = "INT"
+	templates["foo"] = template
+	err := sb.stage(templates)
+	Assert(t).IsNil(err, "should have staged")
+
+	stopScript, err := ioutil.ReadFile(filepath.Join(sb.StagingRoot, "foo", "control", "t"))
+	Assert(t).IsNil(err, "stop script should have been written for a signal other than TERM")
+	Assert(t).IsTrue(strings.Contains(string(stopScript), `kill -INT "$(cat supervise/pid)"`), "stop script should have sent the stop signal")
+
+	// runsv should send TERM itself once the signal is changed back
+	err = sb.stage(fakeTemplate(RestartPolicyAlways))
+	Assert(t).IsNil(err, "should have staged")
+	_, err = os.Stat(filepath.Join(sb.StagingRoot, "foo", "control", "t"))
+	Assert(t).IsTrue(os.IsNotExist(err), "stop script should have been removed")
+}
+
+func TestOnFailureWithBackoff(t *testing.T) {
+	sb := FakeServiceBuilder()
+	defer sb.Cleanup()
+
+	templates := fakeTemplate(RestartPolicyOnFailure)
+	template := templates["foo"]
+	template.Finish = []string{"/usr/bin/finish", "$1", "$2"}
+	template.Backoff = &Backoff{
+		Initial:     time.Second,
+		Max:         time.Minute,
+		MaxRestarts: 3,
+		Window:      10 * time.Minute,
+	}
+	templates["foo"] = template
+
+	err := sb.activate(templates)
+	Assert(t).IsNil(err, "should have activated")
+	err = sb.stage(templates)
+	Assert(t).IsNil(err, "should have staged")
+
+	// runit has to restart the service after failures, so there must not be
+	// a down file once it has been activated
+	_, err = os.Stat(filepath.Join(sb.StagingRoot, "foo", "down"))
+	Assert(t).IsTrue(os.IsNotExist(err), "down file should not have existed when restart policy is 'on-failure'")
+
+	runScript, err := ioutil.ReadFile(filepath.Join(sb.StagingRoot, "foo", "run"))
+	Assert(t).IsNil(err, "should have read run script")
+	Assert(t).IsTrue(strings.Contains(string(runScript), "[1 * 2 ** (failures - 1), 60].min"), "run script should have backed off exponentially")
+	verifyRuby18(t, filepath.Join(sb.StagingRoot, "foo", "run"), "run script")
+
+	finishScript, err := ioutil.ReadFile(filepath.Join(sb.StagingRoot, "foo", "finish"))
+	Assert(t).IsNil(err, "should have read finish script")
+	for _, expected := range []string{
+		"since=$((now - 600))",
+		"-gt 3 ]",
+		"export RESTARTS_EXHAUSTED=true",
+		"printf d > supervise/control",
+		"/usr/bin/finish $1 $2",
+	} {
+		if !strings.Contains(string(finishScript), expected) {
+			t.Errorf("Expected finish script to contain %q:\n%s", expected, finishScript)
+		}
+	}
+}
+
+func TestFinishScriptWithoutBackoff(t *testing.T) {
+	template := fakeTemplate(RestartPolicyAlways)["foo"]
+	finishScript, err := template.finishScript()
+	Assert(t).IsNil(err, "should have built finish script")
+	Assert(t).AreEqual("#!/bin/bash\n/bin/true # finish not implemented\n", string(finishScript), "finish script should not have changed without a backoff")
+}
+
 func verifyRuby18(t *testing.T, filename, displayName string) {
 	binData, err := ioutil.ReadFile(filename)
 	Assert(t).IsNil(err, fmt.Sprintf("should have been able to read %s", displayName))
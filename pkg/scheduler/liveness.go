@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// Scheduler is the full set of operations controllers perform against a
+// scheduler.
+type Scheduler interface {
+	EligibleNodes(manifest.Manifest, klabels.Selector) ([]types.NodeName, error)
+	AllocateNodes(manifest manifest.Manifest, nodeSelector klabels.Selector, allocationCount int) ([]types.NodeName, error)
+	DeallocateNodes(nodeSelector klabels.Selector, nodes []types.NodeName) error
+}
+
+// NodeRegistry reports which nodes have stopped heartbeating. See
+// nodestore.ConsulStore.
+type NodeRegistry interface {
+	DeadNodes() (types.NodeSet, error)
+}
+
+// LivenessScheduler wraps another scheduler and removes nodes with expired
+// heartbeats from the set of eligible nodes. This causes controllers to
+// treat dead nodes exactly like nodes that no longer match their selector.
+type LivenessScheduler struct {
+	Scheduler
+	registry NodeRegistry
+}
+
+var _ Scheduler = &LivenessScheduler{}
+
+func NewLivenessScheduler(inner Scheduler, registry NodeRegistry) *LivenessScheduler {
+	return &LivenessScheduler{
+		Scheduler: inner,
+		registry:  registry,
+	}
+}
+
+func (l *LivenessScheduler) EligibleNodes(m manifest.Manifest, selector klabels.Selector) ([]types.NodeName, error) {
+	nodes, err := l.Scheduler.EligibleNodes(m, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	dead, err := l.registry.DeadNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]types.NodeName, 0, len(nodes))
+	for _, node := range nodes {
+		if !dead.Has(node.String()) {
+			result = append(result, node)
+		}
+	}
+	return result, nil
+}
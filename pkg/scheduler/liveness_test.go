@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"testing"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeRegistry struct {
+	dead types.NodeSet
+}
+
+func (f fakeRegistry) DeadNodes() (types.NodeSet, error) {
+	return f.dead, nil
+}
+
+func TestLivenessSchedulerFiltersDeadNodes(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	for _, node := range []string{"node1", "node2", "node3"} {
+		err := applicator.SetLabel(labels.NODE, node, "color", "red")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// node4 is dead but doesn't match the selector, it should not show up
+	registry := fakeRegistry{dead: types.NewNodeSet("node2", "node4")}
+	sched := NewLivenessScheduler(NewApplicatorScheduler(applicator), registry)
+
+	selector := klabels.Everything().Add("color", klabels.EqualsOperator, []string{"red"})
+	eligible, err := sched.EligibleNodes(nil, selector)
+	if err != nil {
+		t.Fatalf("unexpected error getting eligible nodes: %s", err)
+	}
+
+	expected := types.NewNodeSet("node1", "node3")
+	if !types.NewNodeSet(eligible...).Equal(expected) {
+		t.Errorf("expected eligible nodes to be %s, got %s", expected.ListNodes(), eligible)
+	}
+}
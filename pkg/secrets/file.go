@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+// The extension of the files in a FileProvider's directory
+const encryptedFileExtension = ".gpg"
+
+// FileProvider reads secrets from a local directory in which the secret
+// "db/password" is stored in the file "db/password.gpg". Each file is an
+// OpenPGP message, binary or ASCII-armored, encrypted to a key whose private
+// half is in the provider's keyring, e.g. with
+//
+//	gpg --encrypt --recipient preparer@example.com --output db/password.gpg
+//
+// The keyring is read once, when the provider is created.
+type FileProvider struct {
+	directory string
+	keyring   openpgp.EntityList
+}
+
+var _ Provider = &FileProvider{}
+
+func NewFileProvider(directory string, keyringPath string) (*FileProvider, error) {
+	keyring, err := auth.LoadKeyring(keyringPath)
+	if err != nil {
+		return nil, util.Errorf("Could not load secrets keyring %s: %s", keyringPath, err)
+	}
+	return &FileProvider{
+		directory: directory,
+		keyring:   keyring,
+	}, nil
+}
+
+func (p *FileProvider) Get(name string) ([]byte, error) {
+	if !manifest.ValidSecretName(name) {
+		return nil, util.Errorf("%q is not a valid secret name", name)
+	}
+	path := filepath.Join(p.directory, filepath.FromSlash(name)+encryptedFileExtension)
+	encrypted, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, NotFoundError{Name: name}
+	} else if err != nil {
+		return nil, util.Errorf("Could not read secret %s: %s", name, err)
+	}
+
+	var message io.Reader = bytes.NewReader(encrypted)
+	if block, err := armor.Decode(bytes.NewReader(encrypted)); err == nil {
+		message = block.Body
+	}
+	details, err := openpgp.ReadMessage(message, p.keyring, nil, nil)
+	if err != nil {
+		return nil, util.Errorf("Could not decrypt secret %s: %s", name, err)
+	}
+	value, err := ioutil.ReadAll(details.UnverifiedBody)
+	if err != nil {
+		return nil, util.Errorf("Could not decrypt secret %s: %s", name, err)
+	}
+	return value, nil
+}
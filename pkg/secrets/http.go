@@ -0,0 +1,115 @@
+package secrets
+
+import (
+	"crypto/subtle"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+// The path under which secret services serve secrets, followed by the
+// secret's name
+const secretsPath = "/secrets/"
+
+// Secrets are small; larger responses are rejected rather than written into
+// a tmpfs
+const maxSecretSize = 1 << 20
+
+// HTTPProvider fetches secrets from a secret service that serves the value of
+// the secret "db/password" at <url>/secrets/db/password, with status 404 if it
+// doesn't know the secret. If the provider has a token, it is sent as a bearer
+// token in the Authorization header. Handler serves this protocol and can
+// stand in for a secret service.
+type HTTPProvider struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+var _ Provider = &HTTPProvider{}
+
+// NewHTTPProvider returns a provider for the secret service at url. The
+// client should be configured with the TLS settings the service requires
+func NewHTTPProvider(url string, token string, client *http.Client) *HTTPProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPProvider{
+		url:    strings.TrimSuffix(url, "/"),
+		token:  token,
+		client: client,
+	}
+}
+
+func (p *HTTPProvider) Get(name string) ([]byte, error) {
+	if !manifest.ValidSecretName(name) {
+		return nil, util.Errorf("%q is not a valid secret name", name)
+	}
+	req, err := http.NewRequest("GET", p.url+secretsPath+name, nil)
+	if err != nil {
+		return nil, util.Errorf("Could not fetch secret %s: %s", name, err)
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, util.Errorf("Could not fetch secret %s: %s", name, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, NotFoundError{Name: name}
+	case resp.StatusCode != http.StatusOK:
+		return nil, util.Errorf("Could not fetch secret %s: secret service responded with %s", name, resp.Status)
+	}
+	value, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSecretSize+1))
+	if err != nil {
+		return nil, util.Errorf("Could not fetch secret %s: %s", name, err)
+	}
+	if len(value) > maxSecretSize {
+		return nil, util.Errorf("Could not fetch secret %s: it is larger than %d bytes", name, maxSecretSize)
+	}
+	return value, nil
+}
+
+// Handler serves the secrets of provider the way HTTPProvider expects a
+// secret service to. Requests must carry token as a bearer token unless it is
+// empty. It lets a provider, such as a FileProvider on a development machine,
+// stand in for a secret service.
+func Handler(provider Provider, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || !strings.HasPrefix(r.URL.Path, secretsPath) {
+			http.NotFound(w, r)
+			return
+		}
+		if token != "" {
+			auth := r.Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+				http.Error(w, "a valid token is required", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, secretsPath)
+		if !manifest.ValidSecretName(name) {
+			http.Error(w, "invalid secret name", http.StatusBadRequest)
+			return
+		}
+		value, err := provider.Get(name)
+		if _, ok := err.(NotFoundError); ok {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(value)
+	})
+}
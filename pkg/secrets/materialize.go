@@ -0,0 +1,199 @@
+package secrets
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultRoot is where the secrets directories of pods are created unless
+// configured otherwise. /dev/shm is a tmpfs on Linux
+const DefaultRoot = "/dev/shm/p2-secrets"
+
+// The filesystem types that secrets may be written to, so that they never
+// reach a disk
+const (
+	tmpfsMagic = 0x01021994
+	ramfsMagic = 0x858458f6
+)
+
+// memoryBacked returns whether path is on a filesystem that is kept in
+// memory. A variable so that tests can write to other filesystems
+var memoryBacked = func(path string) (bool, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return false, err
+	}
+	return int64(st.Type) == tmpfsMagic || int64(st.Type) == ramfsMagic, nil
+}
+
+// Materializer writes the secrets that pods reference into a directory per
+// pod under its root, which must be on a tmpfs.
+type Materializer struct {
+	provider Provider
+	root     string
+}
+
+func NewMaterializer(provider Provider, root string) *Materializer {
+	if root == "" {
+		root = DefaultRoot
+	}
+	return &Materializer{
+		provider: provider,
+		root:     root,
+	}
+}
+
+// Dir returns the secrets directory of the pod whose home is podHome. It is
+// named after the pod's home, so that pods with a unique key get their own.
+func (m *Materializer) Dir(podHome string) string {
+	return filepath.Join(m.root, filepath.Base(podHome))
+}
+
+// Materialize fetches the secrets and writes them into dir, which is created
+// if necessary. The directory and files belong to uid and gid and can only be
+// read by them. Only files whose contents changed are written, each replaced
+// atomically, and files of secrets the pod no longer references are removed.
+// It returns the names of the files that were written or removed. If a secret
+// can't be fetched, nothing is changed.
+func (m *Materializer) Materialize(dir string, stanzas []manifest.SecretStanza, uid int, gid int) ([]string, error) {
+	return m.materialize(dir, stanzas, uid, gid, true)
+}
+
+// Refresh is Materialize without removing files, for rotating the secrets of
+// a pod whose manifest may be about to change: the files of secrets that only
+// the new manifest references may already have been written.
+func (m *Materializer) Refresh(dir string, stanzas []manifest.SecretStanza, uid int, gid int) ([]string, error) {
+	return m.materialize(dir, stanzas, uid, gid, false)
+}
+
+func (m *Materializer) materialize(dir string, stanzas []manifest.SecretStanza, uid int, gid int, prune bool) ([]string, error) {
+	values := make(map[string][]byte, len(stanzas))
+	for _, stanza := range stanzas {
+		value, err := m.provider.Get(stanza.Name)
+		if err != nil {
+			return nil, err
+		}
+		values[stanza.FileName()] = value
+	}
+
+	err := os.MkdirAll(m.root, 0711)
+	if err != nil {
+		return nil, util.Errorf("Could not create secrets root %s: %s", m.root, err)
+	}
+	inMemory, err := memoryBacked(m.root)
+	if err != nil {
+		return nil, util.Errorf("Could not determine the filesystem of secrets root %s: %s", m.root, err)
+	}
+	if !inMemory {
+		return nil, util.Errorf("Refusing to write secrets to %s, which is not on a tmpfs", m.root)
+	}
+	err = os.Mkdir(dir, 0700)
+	if err != nil && !os.IsExist(err) {
+		return nil, util.Errorf("Could not create secrets directory %s: %s", dir, err)
+	}
+	// fix up the owner in case the pod's run_as changed
+	err = os.Chown(dir, uid, gid)
+	if err != nil {
+		return nil, util.Errorf("Could not chown secrets directory %s: %s", dir, err)
+	}
+
+	var changed []string
+	for file, value := range values {
+		path := filepath.Join(dir, file)
+		current, err := ioutil.ReadFile(path)
+		if err == nil && bytes.Equal(current, value) {
+			if err = chownIfNeeded(path, uid, gid); err != nil {
+				return changed, err
+			}
+			continue
+		}
+		err = writeSecret(path, value, uid, gid)
+		if err != nil {
+			return changed, err
+		}
+		changed = append(changed, file)
+	}
+	if !prune {
+		sort.Strings(changed)
+		return changed, nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return changed, util.Errorf("Could not list secrets directory %s: %s", dir, err)
+	}
+	for _, entry := range entries {
+		if _, ok := values[entry.Name()]; ok {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return changed, util.Errorf("Could not remove stale secret %s: %s", entry.Name(), err)
+		}
+		changed = append(changed, entry.Name())
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// Remove deletes a pod's secrets directory
+func (m *Materializer) Remove(dir string) error {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return util.Errorf("Could not remove secrets directory %s: %s", dir, err)
+	}
+	return nil
+}
+
+// writeSecret atomically replaces the file at path with one that contains
+// value and can only be read by uid
+func writeSecret(path string, value []byte, uid int, gid int) error {
+	// temporary files start with a dot, which secret file names can't
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return util.Errorf("Could not write secret %s: %s", path, err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(value)
+	if err == nil {
+		err = file.Chmod(0400)
+	}
+	if err == nil {
+		err = file.Chown(uid, gid)
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		return util.Errorf("Could not write secret %s: %s", path, err)
+	}
+	return nil
+}
+
+func chownIfNeeded(path string, uid int, gid int) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return util.Errorf("Could not stat secret %s: %s", path, err)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) == uid && int(st.Gid) == gid {
+		return nil
+	}
+	err = os.Chown(path, uid, gid)
+	if err != nil {
+		return util.Errorf("Could not chown secret %s: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+// Policy lists the secrets that pods may reference, by the user the pods run
+// as. Pods are identified by their user rather than their ID because the
+// user is what the deploy policy authorizes deployers for, while anyone who
+// may deploy a pod can choose its ID.
+//
+// The policy file is YAML. Each entry of "users" maps a user to the secrets
+// its pods may reference. An entry is either the name of a secret or a
+// prefix ending in "/*", which allows every secret under it. Users that
+// aren't listed may not reference any secrets.
+//
+// Example policy file:
+//
+//	---
+//	users:
+//	  web:
+//	  - web/*
+//	  - shared/tls-ca
+//	  db:
+//	  - db/password
+type Policy struct {
+	Users map[string][]string `yaml:"users"`
+}
+
+// LoadPolicy reads a Policy from a file
+func LoadPolicy(path string) (Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Policy{}, util.Errorf("Could not read secrets policy: %s", err)
+	}
+	var policy Policy
+	err = yaml.Unmarshal(data, &policy)
+	if err != nil {
+		return Policy{}, util.Errorf("Could not parse secrets policy %s: %s", path, err)
+	}
+	return policy, nil
+}
+
+// Authorize returns an error naming the first of the secrets that pods
+// running as podUser may not reference, if any.
+func (p Policy) Authorize(podUser string, stanzas []manifest.SecretStanza) error {
+	for _, stanza := range stanzas {
+		if !p.allows(podUser, stanza.Name) {
+			return util.Errorf("pods running as %s may not reference secret %q", podUser, stanza.Name)
+		}
+	}
+	return nil
+}
+
+func (p Policy) allows(podUser string, name string) bool {
+	for _, allowed := range p.Users[podUser] {
+		if allowed == name {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(name, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
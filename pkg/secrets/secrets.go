@@ -0,0 +1,35 @@
+// Package secrets delivers the secrets that pod manifests reference to the
+// pods. A Provider looks up the value of a secret by name, and a Materializer
+// writes the values into a directory per pod on a tmpfs, so that they never
+// reach a disk or Consul.
+package secrets
+
+import (
+	"fmt"
+)
+
+// Types of providers that the preparer can fetch secrets from
+const (
+	// FileProviderType reads secrets from a directory of files that are
+	// encrypted to a key in the preparer's secrets keyring
+	FileProviderType = "file"
+
+	// HTTPProviderType fetches secrets from an HTTP secret service
+	HTTPProviderType = "http"
+)
+
+// Provider looks up the values of secrets
+type Provider interface {
+	// Get returns the current value of the named secret. The error is
+	// NotFoundError if the provider doesn't know the secret.
+	Get(name string) ([]byte, error)
+}
+
+// NotFoundError is returned by providers that don't know a secret
+type NotFoundError struct {
+	Name string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("secret %q was not found", e.Name)
+}
@@ -0,0 +1,166 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/square/p2/pkg/manifest"
+)
+
+// testFileProvider returns a FileProvider for a directory containing the
+// given secrets, encrypted to a freshly generated key
+func testFileProvider(t *testing.T, secrets map[string]string) (*FileProvider, string) {
+	dir, err := ioutil.TempDir("", "secrets")
+	Assert(t).IsNil(err, "test setup: could not create secrets dir")
+
+	entity, err := openpgp.NewEntity("p2", "test", "p2@example.com", nil)
+	Assert(t).IsNil(err, "test setup: could not generate key")
+	for _, identity := range entity.Identities {
+		// the default RIPEMD160 isn't vendored
+		identity.SelfSignature.PreferredHash = []uint8{8} // SHA256
+	}
+	keyringPath := filepath.Join(dir, "keyring")
+	keyringFile, err := os.Create(keyringPath)
+	Assert(t).IsNil(err, "test setup: could not create keyring")
+	Assert(t).IsNil(entity.SerializePrivate(keyringFile, nil), "test setup: could not write keyring")
+	keyringFile.Close()
+
+	storeDir := filepath.Join(dir, "store")
+	for name, value := range secrets {
+		path := filepath.Join(storeDir, filepath.FromSlash(name)+encryptedFileExtension)
+		Assert(t).IsNil(os.MkdirAll(filepath.Dir(path), 0700), "test setup: could not create secret dir")
+		file, err := os.Create(path)
+		Assert(t).IsNil(err, "test setup: could not create secret")
+		plaintext, err := openpgp.Encrypt(file, openpgp.EntityList{entity}, nil, nil, nil)
+		Assert(t).IsNil(err, "test setup: could not encrypt secret")
+		_, err = plaintext.Write([]byte(value))
+		Assert(t).IsNil(err, "test setup: could not encrypt secret")
+		plaintext.Close()
+		file.Close()
+	}
+
+	provider, err := NewFileProvider(storeDir, keyringPath)
+	Assert(t).IsNil(err, "could not create file provider")
+	return provider, dir
+}
+
+func TestFileProviderDecryptsSecrets(t *testing.T) {
+	provider, dir := testFileProvider(t, map[string]string{"db/password": "hunter2"})
+	defer os.RemoveAll(dir)
+
+	value, err := provider.Get("db/password")
+	Assert(t).IsNil(err, "should have decrypted the secret")
+	Assert(t).AreEqual(string(value), "hunter2", "wrong secret value")
+
+	_, err = provider.Get("db/username")
+	_, ok := err.(NotFoundError)
+	Assert(t).IsTrue(ok, "expected a missing secret to be reported as not found")
+
+	_, err = provider.Get("../store/db/password")
+	Assert(t).IsNotNil(err, "expected a name outside the store to be rejected")
+}
+
+func TestHTTPProviderFetchesFromStandIn(t *testing.T) {
+	fileProvider, dir := testFileProvider(t, map[string]string{"api_key": "abc123"})
+	defer os.RemoveAll(dir)
+	server := httptest.NewServer(Handler(fileProvider, "token"))
+	defer server.Close()
+
+	provider := NewHTTPProvider(server.URL, "token", nil)
+	value, err := provider.Get("api_key")
+	Assert(t).IsNil(err, "should have fetched the secret")
+	Assert(t).AreEqual(string(value), "abc123", "wrong secret value")
+
+	_, err = provider.Get("other_key")
+	_, ok := err.(NotFoundError)
+	Assert(t).IsTrue(ok, "expected a missing secret to be reported as not found")
+
+	_, err = NewHTTPProvider(server.URL, "wrong", nil).Get("api_key")
+	Assert(t).IsNotNil(err, "expected a wrong token to be rejected")
+}
+
+type fakeProvider map[string]string
+
+func (f fakeProvider) Get(name string) ([]byte, error) {
+	value, ok := f[name]
+	if !ok {
+		return nil, NotFoundError{Name: name}
+	}
+	return []byte(value), nil
+}
+
+func TestMaterializeWritesChangedSecrets(t *testing.T) {
+	root, err := ioutil.TempDir("", "secrets-root")
+	Assert(t).IsNil(err, "test setup: could not create secrets root")
+	defer os.RemoveAll(root)
+	defer func(f func(string) (bool, error)) { memoryBacked = f }(memoryBacked)
+	inMemory := false
+	memoryBacked = func(string) (bool, error) { return inMemory, nil }
+
+	provider := fakeProvider{"db/password": "hunter2", "api_key": "abc123"}
+	materializer := NewMaterializer(provider, root)
+	dir := materializer.Dir("/data/pods/web")
+	Assert(t).AreEqual(dir, filepath.Join(root, "web"), "wrong secrets dir")
+	stanzas := []manifest.SecretStanza{{Name: "db/password"}, {Name: "api_key", File: "key"}}
+	uid, gid := os.Getuid(), os.Getgid()
+
+	_, err = materializer.Materialize(dir, stanzas, uid, gid)
+	Assert(t).IsNotNil(err, "expected secrets not to be written to a disk")
+
+	inMemory = true
+	changed, err := materializer.Materialize(dir, stanzas, uid, gid)
+	Assert(t).IsNil(err, "should have written secrets")
+	Assert(t).AreEqual(len(changed), 2, "expected both secrets to be written")
+	value, err := ioutil.ReadFile(filepath.Join(dir, "password"))
+	Assert(t).IsNil(err, "should have written the password")
+	Assert(t).AreEqual(string(value), "hunter2", "wrong secret value")
+	info, err := os.Stat(filepath.Join(dir, "key"))
+	Assert(t).IsNil(err, "should have written the key")
+	Assert(t).AreEqual(info.Mode().Perm(), os.FileMode(0400), "secrets should only be readable by their owner")
+
+	changed, err = materializer.Materialize(dir, stanzas, uid, gid)
+	Assert(t).IsNil(err, "should have checked secrets")
+	Assert(t).AreEqual(len(changed), 0, "expected unchanged secrets not to be rewritten")
+
+	provider["api_key"] = "def456"
+	changed, err = materializer.Materialize(dir, stanzas[1:], uid, gid)
+	Assert(t).IsNil(err, "should have rotated secrets")
+	Assert(t).AreEqual(len(changed), 2, "expected the rotated secret to be written and the dropped one removed")
+	value, err = ioutil.ReadFile(filepath.Join(dir, "key"))
+	Assert(t).IsNil(err, "should have rotated the key")
+	Assert(t).AreEqual(string(value), "def456", "wrong rotated value")
+	_, err = os.Stat(filepath.Join(dir, "password"))
+	Assert(t).IsTrue(os.IsNotExist(err), "expected the dropped secret to be removed")
+
+	_, err = materializer.Materialize(dir, []manifest.SecretStanza{{Name: "missing"}}, uid, gid)
+	Assert(t).IsNotNil(err, "expected a missing secret to fail")
+	_, err = os.Stat(filepath.Join(dir, "key"))
+	Assert(t).IsNil(err, "expected nothing to change when a secret can't be fetched")
+}
+
+func TestPolicyAuthorizesSecretsByPodUser(t *testing.T) {
+	policyFile, err := ioutil.TempFile("", "secrets-policy")
+	Assert(t).IsNil(err, "test setup: could not create policy file")
+	defer os.Remove(policyFile.Name())
+	_, err = policyFile.WriteString("users:\n  web:\n  - web/*\n  - shared/tls-ca\n")
+	Assert(t).IsNil(err, "test setup: could not write policy file")
+	policyFile.Close()
+
+	policy, err := LoadPolicy(policyFile.Name())
+	Assert(t).IsNil(err, "should have loaded the policy")
+
+	err = policy.Authorize("web", []manifest.SecretStanza{{Name: "web/db/password"}, {Name: "shared/tls-ca"}})
+	Assert(t).IsNil(err, "expected secrets the policy lists to be allowed")
+	err = policy.Authorize("web", []manifest.SecretStanza{{Name: "web/api_key"}, {Name: "shared/other"}})
+	Assert(t).IsNotNil(err, "expected a secret the policy doesn't list to be refused")
+	err = policy.Authorize("web", []manifest.SecretStanza{{Name: "webhooks/token"}})
+	Assert(t).IsNotNil(err, "expected a prefix to only match whole path elements")
+	err = policy.Authorize("db", []manifest.SecretStanza{{Name: "web/db/password"}})
+	Assert(t).IsNotNil(err, "expected a user the policy doesn't list to be refused")
+}
@@ -0,0 +1,195 @@
+// Package statusapi exposes p2's status records and rolling updates over
+// HTTP for tooling that can't use the Go stores or the gRPC pod store.
+//
+// Every endpoint supports consul-style blocking queries. Responses carry the
+// current index in the X-P2-Index header; passing it back as the "index"
+// query parameter makes the request block until the record changes or the
+// "wait" duration (e.g. "30s", at most 10m) elapses:
+//
+//	GET /api/pods/<pod unique key>/status
+//	GET /api/replication_controllers/<rc id>/status
+//	GET /api/daemon_sets/<ds id>/status
+//	GET /api/rolling_updates/<new rc id>
+//
+// Status bodies are the JSON documents written by the owning subsystem. A 404
+// response still carries an index, so clients can block until a record is
+// created.
+package statusapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/ds"
+	"github.com/square/p2/pkg/logging"
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+)
+
+const (
+	IndexHeader = "X-P2-Index"
+
+	// consul caps blocking queries at 10 minutes
+	MaxWait = 10 * time.Minute
+
+	pathPrefix = "/api/"
+)
+
+type RollingUpdateStore interface {
+	BlockingGet(id roll_fields.ID, waitIndex uint64, waitTime time.Duration) (roll_fields.Update, *api.QueryMeta, error)
+}
+
+// Each status endpoint serves one namespace of a resource type: the view of
+// the subsystem that owns the resource.
+var statusNamespaces = map[statusstore.ResourceType]statusstore.Namespace{
+	statusstore.POD: consul.PreparerPodStatusNamespace,
+	statusstore.RC:  consul.RCStatusNamespace,
+	statusstore.DS:  ds.DaemonSetStatusNamespace,
+}
+
+const rollingUpdates = "rolling_updates"
+
+type Server struct {
+	statusStore statusstore.Store
+	rollStore   RollingUpdateStore
+	logger      logging.Logger
+}
+
+func NewServer(statusStore statusstore.Store, rollStore RollingUpdateStore, logger logging.Logger) Server {
+	return Server{
+		statusStore: statusStore,
+		rollStore:   rollStore,
+		logger:      logger,
+	}
+}
+
+// Handler returns an http.Handler serving every endpoint under /api/.
+func (s Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pathPrefix, s.serve)
+	return mux
+}
+
+func (s Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+
+	waitIndex, waitTime, err := blockingParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// e.g. "pods/<key>/status" or "rolling_updates/<id>"
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, pathPrefix), "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == rollingUpdates && parts[1] != "":
+		s.serveRollingUpdate(w, roll_fields.ID(parts[1]), waitIndex, waitTime)
+	case len(parts) == 3 && parts[1] != "" && parts[2] == "status":
+		resourceType := statusstore.ResourceType(parts[0])
+		namespace, ok := statusNamespaces[resourceType]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("unknown resource type %q", parts[0]))
+			return
+		}
+		s.serveStatus(w, resourceType, statusstore.ResourceID(parts[1]), namespace, waitIndex, waitTime)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no such endpoint %s", r.URL.Path))
+	}
+}
+
+func (s Server) serveStatus(
+	w http.ResponseWriter,
+	resourceType statusstore.ResourceType,
+	id statusstore.ResourceID,
+	namespace statusstore.Namespace,
+	waitIndex uint64,
+	waitTime time.Duration,
+) {
+	status, queryMeta, err := s.statusStore.WatchStatus(resourceType, id, namespace, waitIndex, waitTime)
+	setIndex(w, queryMeta)
+	switch {
+	case statusstore.IsNoStatus(err):
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no status for %s %s", resourceType, id))
+	case err != nil:
+		s.logger.WithErrorAndFields(err, logrus.Fields{
+			"resource_type": resourceType,
+			"id":            id,
+		}).Errorln("Could not get status")
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(status.Bytes())
+	}
+}
+
+func (s Server) serveRollingUpdate(w http.ResponseWriter, id roll_fields.ID, waitIndex uint64, waitTime time.Duration) {
+	update, queryMeta, err := s.rollStore.BlockingGet(id, waitIndex, waitTime)
+	setIndex(w, queryMeta)
+	switch {
+	case err != nil:
+		s.logger.WithErrorAndFields(err, logrus.Fields{"id": id}).Errorln("Could not get rolling update")
+		writeError(w, http.StatusInternalServerError, err.Error())
+	case update.ID() == "":
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no rolling update %s", id))
+	default:
+		writeJSON(w, http.StatusOK, update)
+	}
+}
+
+// blockingParams parses the "index" and "wait" query parameters. Both are
+// optional; without an index the request returns immediately.
+func blockingParams(r *http.Request) (uint64, time.Duration, error) {
+	var waitIndex uint64
+	var waitTime time.Duration
+	var err error
+
+	if index := r.URL.Query().Get("index"); index != "" {
+		waitIndex, err = strconv.ParseUint(index, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid index %q: %s", index, err)
+		}
+	}
+	if wait := r.URL.Query().Get("wait"); wait != "" {
+		waitTime, err = time.ParseDuration(wait)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid wait %q: %s", wait, err)
+		}
+		if waitTime < 0 || waitTime > MaxWait {
+			return 0, 0, fmt.Errorf("wait must be between 0 and %s", MaxWait)
+		}
+	}
+	return waitIndex, waitTime, nil
+}
+
+func setIndex(w http.ResponseWriter, queryMeta *api.QueryMeta) {
+	if queryMeta != nil {
+		w.Header().Set(IndexHeader, strconv.FormatUint(queryMeta.LastIndex, 10))
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	bytes, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(bytes)
+}
@@ -0,0 +1,127 @@
+package statusapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+)
+
+type fakeRollStore map[roll_fields.ID]roll_fields.Update
+
+func (f fakeRollStore) BlockingGet(id roll_fields.ID, waitIndex uint64, waitTime time.Duration) (roll_fields.Update, *api.QueryMeta, error) {
+	return f[id], &api.QueryMeta{LastIndex: 42}, nil
+}
+
+func get(t *testing.T, server *httptest.Server, path string) (*http.Response, []byte) {
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatalf("Could not GET %s: %s", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Could not read response for %s: %s", path, err)
+	}
+	return resp, body
+}
+
+func respIndex(t *testing.T, resp *http.Response) uint64 {
+	index, err := strconv.ParseUint(resp.Header.Get(IndexHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("Response had an invalid %s header: %s", IndexHeader, err)
+	}
+	return index
+}
+
+func TestStatusEndpoints(t *testing.T) {
+	statusStore := statusstoretest.NewFake()
+	server := httptest.NewServer(NewServer(statusStore, fakeRollStore{}, logging.DefaultLogger).Handler())
+	defer server.Close()
+
+	resp, _ := get(t, server, "/api/replication_controllers/abc/status")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a missing status, got %d", resp.StatusCode)
+	}
+	index := respIndex(t, resp)
+
+	// A blocking query for a missing status returns once the status is
+	// written
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = statusStore.SetStatus(statusstore.RC, "abc", consul.RCStatusNamespace, statusstore.Status(`{"node_transfer":{}}`))
+	}()
+	resp, body := get(t, server, "/api/replication_controllers/abc/status?index="+strconv.FormatUint(index+1, 10)+"&wait=5s")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 after the status was written, got %d: %s", resp.StatusCode, body)
+	}
+	if string(body) != `{"node_transfer":{}}` {
+		t.Errorf("Unexpected status body: %s", body)
+	}
+	if respIndex(t, resp) <= index {
+		t.Errorf("Expected the index to advance past %d", index)
+	}
+
+	// Statuses from other namespaces are not served
+	_ = statusStore.SetStatus(statusstore.POD, "some-key", "not-the-preparer", statusstore.Status(`{}`))
+	resp, _ = get(t, server, "/api/pods/some-key/status")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a status in another namespace, got %d", resp.StatusCode)
+	}
+}
+
+func TestRollingUpdateEndpoint(t *testing.T) {
+	rolls := fakeRollStore{"new-rc": roll_fields.Update{NewRC: "new-rc", OldRC: "old-rc"}}
+	server := httptest.NewServer(NewServer(statusstoretest.NewFake(), rolls, logging.DefaultLogger).Handler())
+	defer server.Close()
+
+	resp, body := get(t, server, "/api/rolling_updates/new-rc")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if respIndex(t, resp) != 42 {
+		t.Errorf("Expected the store's index to be returned")
+	}
+	var update roll_fields.Update
+	err := json.Unmarshal(body, &update)
+	if err != nil {
+		t.Fatalf("Could not unmarshal rolling update: %s", err)
+	}
+	if update.OldRC != "old-rc" {
+		t.Errorf("Unexpected rolling update: %+v", update)
+	}
+
+	resp, _ = get(t, server, "/api/rolling_updates/missing")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing rolling update, got %d", resp.StatusCode)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	server := httptest.NewServer(NewServer(statusstoretest.NewFake(), fakeRollStore{}, logging.DefaultLogger).Handler())
+	defer server.Close()
+
+	for path, code := range map[string]int{
+		"/api/pods/key/status?index=abc": http.StatusBadRequest,
+		"/api/pods/key/status?wait=1h":   http.StatusBadRequest,
+		"/api/pods/key/status?wait=soon": http.StatusBadRequest,
+		"/api/widgets/key/status":        http.StatusNotFound,
+		"/api/pods/key":                  http.StatusNotFound,
+	} {
+		resp, _ := get(t, server, path)
+		if resp.StatusCode != code {
+			t.Errorf("Expected %d for %s, got %d", code, path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Package configmapstore stores config maps, named pieces of config that pod
+// manifests can reference instead of embedding them (see
+// manifest.ConfigMapRef). Every version of a config map is kept under the SHA
+// of its contents, so that manifests can pin a version, and a separate key
+// records which version is current.
+package configmapstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// config_maps/<name>/<sha> holds the contents of each version
+	configMapTree string = "config_maps"
+
+	// config_map_current/<name> holds the SHA of the current version. It is
+	// kept apart from the versions so it can be listed cheaply
+	currentTree string = "config_map_current"
+)
+
+// ConfigMap is one version of a config map.
+type ConfigMap struct {
+	Name string
+	SHA  string
+	Data map[interface{}]interface{}
+}
+
+type ConsulKV interface {
+	Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+	Put(p *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error)
+	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
+	DeleteTree(prefix string, w *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+type ConsulStore struct {
+	kv ConsulKV
+}
+
+func NewConsul(kv ConsulKV) ConsulStore {
+	return ConsulStore{
+		kv: kv,
+	}
+}
+
+// NotFoundError is returned by Get() when the config map or the requested
+// version of it doesn't exist.
+type NotFoundError struct {
+	Name string
+	SHA  string
+}
+
+func (e NotFoundError) Error() string {
+	if e.SHA == "" {
+		return "config map " + e.Name + " does not exist"
+	}
+	return "config map " + e.Name + " has no version " + e.SHA
+}
+
+func IsNotFound(err error) bool {
+	_, ok := err.(NotFoundError)
+	return ok
+}
+
+// Set stores data as a new version of the named config map and makes it the
+// current version. Setting the contents of an existing version makes that
+// version current again.
+func (s ConsulStore) Set(name string, data map[interface{}]interface{}) (ConfigMap, error) {
+	if !manifest.ValidConfigMapName(name) {
+		return ConfigMap{}, util.Errorf("invalid config map name %q", name)
+	}
+	dataBytes, err := yaml.Marshal(data)
+	if err != nil {
+		return ConfigMap{}, util.Errorf("could not marshal config map %s: %s", name, err)
+	}
+	hash := sha256.Sum256(dataBytes)
+	sha := hex.EncodeToString(hash[:])
+
+	// versions are never modified, so the version is written before it is
+	// made current
+	key := versionPath(name, sha)
+	_, err = s.kv.Put(&api.KVPair{Key: key, Value: dataBytes}, nil)
+	if err != nil {
+		return ConfigMap{}, consulutil.NewKVError("put", key, err)
+	}
+	key = currentPath(name)
+	_, err = s.kv.Put(&api.KVPair{Key: key, Value: []byte(sha)}, nil)
+	if err != nil {
+		return ConfigMap{}, consulutil.NewKVError("put", key, err)
+	}
+	return ConfigMap{Name: name, SHA: sha, Data: data}, nil
+}
+
+// Get returns a version of the named config map, or its current version if sha
+// is empty.
+func (s ConsulStore) Get(name string, sha string) (ConfigMap, error) {
+	if !manifest.ValidConfigMapName(name) {
+		return ConfigMap{}, util.Errorf("invalid config map name %q", name)
+	}
+	if sha == "" {
+		current, err := s.Current(name)
+		if err != nil {
+			return ConfigMap{}, err
+		}
+		sha = current
+	}
+
+	if _, err := hex.DecodeString(sha); err != nil {
+		return ConfigMap{}, util.Errorf("invalid config map SHA %q", sha)
+	}
+	key := versionPath(name, sha)
+	pair, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return ConfigMap{}, consulutil.NewKVError("get", key, err)
+	}
+	if pair == nil {
+		return ConfigMap{}, NotFoundError{Name: name, SHA: sha}
+	}
+	// a version is only ever written under the SHA of its contents, so any
+	// other contents were not written by Set
+	hash := sha256.Sum256(pair.Value)
+	if hex.EncodeToString(hash[:]) != sha {
+		return ConfigMap{}, util.Errorf("contents of config map at %s do not match its SHA", key)
+	}
+	data := make(map[interface{}]interface{})
+	err = yaml.Unmarshal(pair.Value, &data)
+	if err != nil {
+		return ConfigMap{}, util.Errorf("could not unmarshal config map at %s: %s", key, err)
+	}
+	return ConfigMap{Name: name, SHA: sha, Data: data}, nil
+}
+
+// Current returns the SHA of the current version of the named config map.
+func (s ConsulStore) Current(name string) (string, error) {
+	if !manifest.ValidConfigMapName(name) {
+		return "", util.Errorf("invalid config map name %q", name)
+	}
+	key := currentPath(name)
+	pair, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return "", consulutil.NewKVError("get", key, err)
+	}
+	if pair == nil {
+		return "", NotFoundError{Name: name}
+	}
+	return string(pair.Value), nil
+}
+
+// CurrentSHAs returns the SHA of the current version of every config map,
+// keyed by name.
+func (s ConsulStore) CurrentSHAs() (map[string]string, error) {
+	pairs, _, err := s.kv.List(currentTree+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", currentTree, err)
+	}
+	shas := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		shas[strings.TrimPrefix(pair.Key, currentTree+"/")] = string(pair.Value)
+	}
+	return shas, nil
+}
+
+// Versions returns the SHAs of every stored version of the named config map.
+func (s ConsulStore) Versions(name string) ([]string, error) {
+	if !manifest.ValidConfigMapName(name) {
+		return nil, util.Errorf("invalid config map name %q", name)
+	}
+	prefix := path.Join(configMapTree, name) + "/"
+	pairs, _, err := s.kv.List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+	shas := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		shas = append(shas, strings.TrimPrefix(pair.Key, prefix))
+	}
+	return shas, nil
+}
+
+// Delete removes the named config map and all of its versions. Pods that
+// reference it fail to install until it is set again.
+func (s ConsulStore) Delete(name string) error {
+	if !manifest.ValidConfigMapName(name) {
+		return util.Errorf("invalid config map name %q", name)
+	}
+	key := currentPath(name)
+	_, err := s.kv.Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	prefix := path.Join(configMapTree, name) + "/"
+	_, err = s.kv.DeleteTree(prefix, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", prefix, err)
+	}
+	return nil
+}
+
+func versionPath(name string, sha string) string {
+	return path.Join(configMapTree, name, sha)
+}
+
+func currentPath(name string) string {
+	return path.Join(currentTree, name)
+}
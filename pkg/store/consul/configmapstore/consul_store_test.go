@@ -0,0 +1,105 @@
+package configmapstore
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(consulutil.NewFakeClient().KV())
+
+	_, err := store.Get("db", "")
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	first, err := store.Set("db", map[interface{}]interface{}{"host": "db1.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error setting config map: %s", err)
+	}
+	second, err := store.Set("db", map[interface{}]interface{}{"host": "db2.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error setting config map: %s", err)
+	}
+	if first.SHA == second.SHA {
+		t.Fatal("expected versions with different contents to have different SHAs")
+	}
+
+	current, err := store.Get("db", "")
+	if err != nil {
+		t.Fatalf("unexpected error getting config map: %s", err)
+	}
+	if current.SHA != second.SHA || current.Data["host"] != "db2.example.com" {
+		t.Errorf("expected the latest version to be current, got %+v", current)
+	}
+
+	pinned, err := store.Get("db", first.SHA)
+	if err != nil {
+		t.Fatalf("unexpected error getting pinned config map: %s", err)
+	}
+	if pinned.Data["host"] != "db1.example.com" {
+		t.Errorf("expected the pinned version's contents, got %+v", pinned)
+	}
+
+	versions, err := store.Versions("db")
+	if err != nil {
+		t.Fatalf("unexpected error listing versions: %s", err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("expected 2 versions, got %v", versions)
+	}
+	shas, err := store.CurrentSHAs()
+	if err != nil {
+		t.Fatalf("unexpected error listing current SHAs: %s", err)
+	}
+	if len(shas) != 1 || shas["db"] != second.SHA {
+		t.Errorf("unexpected current SHAs %v", shas)
+	}
+
+	_, err = store.Get("db", "0123")
+	if !IsNotFound(err) {
+		t.Errorf("expected a not found error for a missing version, got %v", err)
+	}
+	_, err = store.Get("../db", "")
+	if err == nil {
+		t.Error("expected an invalid name to be rejected")
+	}
+
+	err = store.Delete("db")
+	if err != nil {
+		t.Fatalf("unexpected error deleting config map: %s", err)
+	}
+	_, err = store.Get("db", first.SHA)
+	if !IsNotFound(err) {
+		t.Errorf("expected deleted versions to be gone, got %v", err)
+	}
+}
+
+func TestGetChecksContentsAgainstSHA(t *testing.T) {
+	kv := consulutil.NewFakeClient().KV()
+	store := NewConsul(kv)
+
+	configMap, err := store.Set("db", map[interface{}]interface{}{"host": "db1.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error setting config map: %s", err)
+	}
+	_, err = kv.Put(&api.KVPair{
+		Key:   versionPath("db", configMap.SHA),
+		Value: []byte("host: evil.example.com\n"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error overwriting config map: %s", err)
+	}
+
+	_, err = store.Get("db", configMap.SHA)
+	if err == nil {
+		t.Error("expected contents that don't match the SHA to be rejected")
+	}
+	_, err = store.Get("db", "")
+	if err == nil {
+		t.Error("expected the current version to be checked too")
+	}
+}
@@ -201,27 +201,9 @@ func (s *ConsulStore) MutateDS(
 	id fields.ID,
 	mutator func(fields.DaemonSet) (fields.DaemonSet, error),
 ) (fields.DaemonSet, error) {
-	ds, metadata, err := s.Get(id)
-	if err != nil {
-		if err == NoDaemonSet {
-			// we need to pass this through so callers can distinguish this from other errors
-			return fields.DaemonSet{}, err
-		}
-
-		return fields.DaemonSet{}, util.Errorf("Error getting daemon set: %v", err)
-	}
-
-	ds, err = mutator(ds)
+	_, ds, metadata, err := s.mutate(id, mutator)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error mutating daemon set: %v", err)
-	}
-	if ds.ID != id {
-		// If the user wants a new uuid, they should delete it and create it
-		return fields.DaemonSet{},
-			util.Errorf("Explicitly changing daemon set ID is not permitted: Wanted '%s' got '%s'", id, ds.ID)
-	}
-	if err := checkManifestPodID(ds.PodID, ds.Manifest); err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error verifying manifest pod id: %v", err)
+		return fields.DaemonSet{}, err
 	}
 
 	rawDS, err := json.Marshal(ds)
@@ -250,35 +232,62 @@ func (s *ConsulStore) MutateDS(
 	return ds, nil
 }
 
-// MutateDSTxn adds a check-and-set operation to the passed transaction to
-// perform the mutation requested via the mutator function.
-// TODO: replace all calls of MutateDS with this
-func (s *ConsulStore) MutateDSTxn(
-	ctx context.Context,
+// MutateDSDryRun returns the daemon set with the given id before and after
+// applying the passed mutator function to it, without writing the result. The
+// mutated daemon set is checked the same way MutateDS checks it, so an error is
+// returned for a mutation that MutateDS would refuse.
+func (s *ConsulStore) MutateDSDryRun(
 	id fields.ID,
 	mutator func(fields.DaemonSet) (fields.DaemonSet, error),
-) (fields.DaemonSet, error) {
+) (fields.DaemonSet, fields.DaemonSet, error) {
+	ds, newDS, _, err := s.mutate(id, mutator)
+	return ds, newDS, err
+}
+
+// mutate returns the daemon set with the given id before and after applying
+// the mutator to it, along with the query metadata to check-and-set the
+// result with. Mutations that change the daemon set's ID or give it a
+// manifest for another pod are refused.
+func (s *ConsulStore) mutate(
+	id fields.ID,
+	mutator func(fields.DaemonSet) (fields.DaemonSet, error),
+) (fields.DaemonSet, fields.DaemonSet, *api.QueryMeta, error) {
 	ds, metadata, err := s.Get(id)
 	if err != nil {
 		if err == NoDaemonSet {
 			// we need to pass this through so callers can distinguish this from other errors
-			return fields.DaemonSet{}, err
+			return fields.DaemonSet{}, fields.DaemonSet{}, nil, err
 		}
 
-		return fields.DaemonSet{}, util.Errorf("Error getting daemon set: %v", err)
+		return fields.DaemonSet{}, fields.DaemonSet{}, nil, util.Errorf("Error getting daemon set: %v", err)
 	}
 
-	ds, err = mutator(ds)
+	newDS, err := mutator(ds)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error mutating daemon set: %v", err)
+		return fields.DaemonSet{}, fields.DaemonSet{}, nil, util.Errorf("Error mutating daemon set: %v", err)
 	}
-	if ds.ID != id {
+	if newDS.ID != id {
 		// If the user wants a new uuid, they should delete it and create it
-		return fields.DaemonSet{},
-			util.Errorf("Explicitly changing daemon set ID is not permitted: Wanted '%s' got '%s'", id, ds.ID)
+		return fields.DaemonSet{}, fields.DaemonSet{}, nil,
+			util.Errorf("Explicitly changing daemon set ID is not permitted: Wanted '%s' got '%s'", id, newDS.ID)
 	}
-	if err := checkManifestPodID(ds.PodID, ds.Manifest); err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error verifying manifest pod id: %v", err)
+	if err := checkManifestPodID(newDS.PodID, newDS.Manifest); err != nil {
+		return fields.DaemonSet{}, fields.DaemonSet{}, nil, util.Errorf("Error verifying manifest pod id: %v", err)
+	}
+	return ds, newDS, metadata, nil
+}
+
+// MutateDSTxn adds a check-and-set operation to the passed transaction to
+// perform the mutation requested via the mutator function.
+// TODO: replace all calls of MutateDS with this
+func (s *ConsulStore) MutateDSTxn(
+	ctx context.Context,
+	id fields.ID,
+	mutator func(fields.DaemonSet) (fields.DaemonSet, error),
+) (fields.DaemonSet, error) {
+	_, ds, metadata, err := s.mutate(id, mutator)
+	if err != nil {
+		return fields.DaemonSet{}, err
 	}
 
 	rawDS, err := json.Marshal(ds)
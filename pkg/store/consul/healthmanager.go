@@ -42,6 +42,10 @@ var (
 	// health status to "unknown" with an error message, and further updates will be
 	// throttled until enough tokens have been accumulated.
 	HealthResumeLimit = param.Int64("health_resume_limit", 4)
+
+	// HealthMaxOutputBytes limits how much of a health check's output and
+	// error is written to Consul with its status.
+	HealthMaxOutputBytes = param.Int("health_max_output_bytes", 1024)
 )
 
 // consulHealthManager maintains a Consul session for all the local node's health checks,
@@ -398,6 +402,7 @@ func toThrottled(wr *WatchResult) *WatchResult {
 
 // Helper to processHealthUpdater()
 func healthToKV(wr WatchResult, session string) (*api.KVPair, error) {
+	wr = wr.truncated(*HealthMaxOutputBytes)
 	now := time.Now()
 	wr.Time = now
 	// This health check only expires when the key is removed
@@ -5,6 +5,7 @@ package consul
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -484,3 +485,32 @@ func TestHealthUpdatesTolerantToConsulFailures(t *testing.T) {
 		}
 	}
 }
+
+func TestHealthToKVLimitsOutput(t *testing.T) {
+	wr := WatchResult{
+		Id:         "svc",
+		Node:       "node",
+		Service:    "svc",
+		Status:     "critical",
+		Output:     strings.Repeat("x", *HealthMaxOutputBytes+1),
+		HTTPStatus: 503,
+		Latency:    10 * time.Millisecond,
+		Error:      strings.Repeat("y", *HealthMaxOutputBytes+1),
+	}
+	kv, err := healthToKV(wr, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var written WatchResult
+	err = json.Unmarshal(kv.Value, &written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written.Output) != *HealthMaxOutputBytes || len(written.Error) != *HealthMaxOutputBytes {
+		t.Errorf("expected output and error to be limited to %d bytes, were %d and %d", *HealthMaxOutputBytes, len(written.Output), len(written.Error))
+	}
+	if written.HTTPStatus != 503 || written.Latency != 10*time.Millisecond {
+		t.Errorf("expected the check's details to be written, got %#v", written)
+	}
+}
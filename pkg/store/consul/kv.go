@@ -70,10 +70,32 @@ type WatchResult struct {
 	Status  string
 	Time    time.Time
 	Expires time.Time `json:"Expires,omitempty"`
+
+	// The details of the check that produced the status. Output and Error
+	// are truncated to HealthMaxOutputBytes when written
+	Output     string        `json:"Output,omitempty"`
+	HTTPStatus int           `json:"HTTPStatus,omitempty"`
+	Latency    time.Duration `json:"Latency,omitempty"`
+	Error      string        `json:"Error,omitempty"`
+}
+
+// truncated returns the result with its Output and Error cut to at most
+// maxBytes each.
+func (r WatchResult) truncated(maxBytes int) WatchResult {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	if len(r.Output) > maxBytes {
+		r.Output = r.Output[:maxBytes]
+	}
+	if len(r.Error) > maxBytes {
+		r.Error = r.Error[:maxBytes]
+	}
+	return r
 }
 
 // ValueEquiv returns true if the value of the WatchResult--everything except the
-// timestamps--is equivalent to another WatchResult.
+// timestamps and check details--is equivalent to another WatchResult.
 func (r WatchResult) ValueEquiv(s WatchResult) bool {
 	return r.Id == s.Id &&
 		r.Node == s.Node &&
@@ -122,6 +144,7 @@ func NewConsulStore(client consulutil.ConsulClient) *consulStore {
 func (c consulStore) PutHealth(res WatchResult) (time.Time, time.Duration, error) {
 	key := HealthPath(res.Service, res.Node)
 
+	res = res.truncated(*HealthMaxOutputBytes)
 	now := time.Now()
 	res.Time = now
 	res.Expires = now.Add(TTL)
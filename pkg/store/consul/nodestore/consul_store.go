@@ -0,0 +1,201 @@
+// Package nodestore tracks the nodes participating in a p2 cluster. Each
+// preparer registers a record for the node it runs on and keeps it locked
+// with a consul session that it continually renews. If the preparer (or the
+// whole host) dies, the session expires, the lock is released and the node
+// is considered dead until a preparer re-registers it.
+package nodestore
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/osversion"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const nodeTree string = "nodes"
+
+// Node is the record published by a preparer for the host it runs on.
+type Node struct {
+	Name      types.NodeName      `json:"name"`
+	Version   string              `json:"version"`
+	OS        osversion.OS        `json:"os,omitempty"`
+	OSVersion osversion.OSVersion `json:"os_version,omitempty"`
+	Capacity  Capacity            `json:"capacity"`
+	Labels    map[string]string   `json:"labels,omitempty"`
+
+	// LastHeartbeat is the last time the preparer refreshed the record.
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+
+	// Alive is computed when the record is read: it is true if the
+	// heartbeat session that registered the node still holds the record.
+	// It is never written to consul.
+	Alive bool `json:"-"`
+}
+
+// Capacity describes the resources available on a node.
+type Capacity struct {
+	CPUs   int            `json:"cpus"`
+	Memory size.ByteCount `json:"memory"`
+}
+
+type ConsulKV interface {
+	Acquire(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error)
+	Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+type ConsulStore struct {
+	kv ConsulKV
+}
+
+func NewConsul(kv ConsulKV) ConsulStore {
+	return ConsulStore{
+		kv: kv,
+	}
+}
+
+// NotRegisteredError is returned by Get() when no preparer has ever
+// registered the requested node.
+type NotRegisteredError struct {
+	Node types.NodeName
+}
+
+func (e NotRegisteredError) Error() string {
+	return "node " + e.Node.String() + " is not registered"
+}
+
+func IsNotRegistered(err error) bool {
+	_, ok := err.(NotRegisteredError)
+	return ok
+}
+
+// Heartbeat writes the node record while holding the lock of the passed
+// session. The first call acquires the lock; subsequent calls with the same
+// session refresh the record. An error is returned if another session holds
+// the record.
+func (s ConsulStore) Heartbeat(session string, node Node) error {
+	if node.Name == "" {
+		return util.Errorf("node name cannot be blank")
+	}
+
+	node.LastHeartbeat = time.Now()
+	nodeBytes, err := json.Marshal(node)
+	if err != nil {
+		return util.Errorf("could not marshal node record: %s", err)
+	}
+
+	key := nodePath(node.Name)
+	acquired, _, err := s.kv.Acquire(&api.KVPair{
+		Key:     key,
+		Value:   nodeBytes,
+		Session: session,
+	}, nil)
+	if err != nil {
+		return consulutil.NewKVError("acquire", key, err)
+	}
+	if !acquired {
+		return util.Errorf("node record %s is held by another session", key)
+	}
+	return nil
+}
+
+// Holder returns the session currently holding the node's record, or "" if
+// the node is dead or unregistered.
+func (s ConsulStore) Holder(nodeName types.NodeName) (string, error) {
+	key := nodePath(nodeName)
+	pair, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return "", consulutil.NewKVError("get", key, err)
+	}
+	if pair == nil {
+		return "", nil
+	}
+	return pair.Session, nil
+}
+
+// Get returns the record for a node.
+func (s ConsulStore) Get(nodeName types.NodeName) (Node, error) {
+	key := nodePath(nodeName)
+	pair, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return Node{}, consulutil.NewKVError("get", key, err)
+	}
+	if pair == nil {
+		return Node{}, NotRegisteredError{Node: nodeName}
+	}
+	return nodeFromPair(pair)
+}
+
+// List returns every registered node, dead or alive.
+func (s ConsulStore) List() ([]Node, error) {
+	pairs, _, err := s.kv.List(nodeTree+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", nodeTree, err)
+	}
+
+	nodes := make([]Node, 0, len(pairs))
+	for _, pair := range pairs {
+		node, err := nodeFromPair(pair)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// DeadNodes returns the set of nodes that have registered but whose
+// heartbeat session has since expired. Nodes that have never registered are
+// not included, so that controllers keep working while preparers without
+// heartbeat support are still deployed.
+func (s ConsulStore) DeadNodes() (types.NodeSet, error) {
+	nodes, err := s.List()
+	if err != nil {
+		return types.NodeSet{}, err
+	}
+
+	dead := types.NewNodeSet()
+	for _, node := range nodes {
+		if !node.Alive {
+			dead.InsertNode(node.Name)
+		}
+	}
+	return dead, nil
+}
+
+// Delete removes a node's record entirely, e.g. when a host is
+// decommissioned.
+func (s ConsulStore) Delete(nodeName types.NodeName) error {
+	key := nodePath(nodeName)
+	_, err := s.kv.Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
+
+func nodeFromPair(pair *api.KVPair) (Node, error) {
+	var node Node
+	err := json.Unmarshal(pair.Value, &node)
+	if err != nil {
+		return Node{}, util.Errorf("could not unmarshal node record at %s: %s", pair.Key, err)
+	}
+
+	// the record is keyed by node name, so trust the key over the contents
+	node.Name = types.NodeName(strings.TrimPrefix(pair.Key, nodeTree+"/"))
+	node.Alive = pair.Session != ""
+	return node, nil
+}
+
+func nodePath(nodeName types.NodeName) string {
+	return path.Join(nodeTree, nodeName.String())
+}
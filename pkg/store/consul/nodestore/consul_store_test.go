@@ -0,0 +1,120 @@
+package nodestore
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func newSession(t *testing.T, fixture consulutil.Fixture) string {
+	session, _, err := fixture.Client.Session().CreateNoChecks(&api.SessionEntry{
+		Name:     "test-heartbeat",
+		Behavior: api.SessionBehaviorRelease,
+		TTL:      "10s",
+	}, nil)
+	if err != nil {
+		t.Fatalf("could not create session: %s", err)
+	}
+	return session
+}
+
+func TestHeartbeatAndGet(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	store := NewConsul(fixture.Client.KV())
+	nodeName := types.NodeName("node1.example.com")
+
+	_, err := store.Get(nodeName)
+	if !IsNotRegistered(err) {
+		t.Fatalf("expected a not registered error, got %v", err)
+	}
+
+	session := newSession(t, fixture)
+	err = store.Heartbeat(session, Node{
+		Name:     nodeName,
+		Version:  "1.2.3",
+		Capacity: Capacity{CPUs: 4},
+		Labels:   map[string]string{"az": "1a"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error heartbeating: %s", err)
+	}
+
+	node, err := store.Get(nodeName)
+	if err != nil {
+		t.Fatalf("unexpected error getting node: %s", err)
+	}
+	if !node.Alive {
+		t.Error("expected node to be alive after heartbeat")
+	}
+	if node.Version != "1.2.3" {
+		t.Errorf("expected version to be 1.2.3, was %s", node.Version)
+	}
+	if node.Capacity.CPUs != 4 {
+		t.Errorf("expected 4 cpus, was %d", node.Capacity.CPUs)
+	}
+	if node.Labels["az"] != "1a" {
+		t.Errorf("expected az label to be 1a, was %s", node.Labels["az"])
+	}
+	if node.LastHeartbeat.IsZero() {
+		t.Error("expected last heartbeat time to be set")
+	}
+
+	holder, err := store.Holder(nodeName)
+	if err != nil {
+		t.Fatalf("unexpected error getting holder: %s", err)
+	}
+	if holder != session {
+		t.Errorf("expected holder to be %s, was %s", session, holder)
+	}
+
+	otherSession := newSession(t, fixture)
+	err = store.Heartbeat(otherSession, Node{Name: nodeName})
+	if err == nil {
+		t.Error("expected an error heartbeating with a second session")
+	}
+}
+
+func TestDeadNodes(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	store := NewConsul(fixture.Client.KV())
+	alive := types.NodeName("alive.example.com")
+	dead := types.NodeName("dead.example.com")
+
+	aliveSession := newSession(t, fixture)
+	deadSession := newSession(t, fixture)
+	for node, session := range map[types.NodeName]string{alive: aliveSession, dead: deadSession} {
+		err := store.Heartbeat(session, Node{Name: node})
+		if err != nil {
+			t.Fatalf("unexpected error heartbeating %s: %s", node, err)
+		}
+	}
+
+	// Destroying the session mimics the TTL expiring
+	_, err := fixture.Client.Session().Destroy(deadSession, nil)
+	if err != nil {
+		t.Fatalf("could not destroy session: %s", err)
+	}
+
+	deadNodes, err := store.DeadNodes()
+	if err != nil {
+		t.Fatalf("unexpected error listing dead nodes: %s", err)
+	}
+	if deadNodes.Len() != 1 || !deadNodes.Has(dead.String()) {
+		t.Errorf("expected only %s to be dead, got %s", dead, deadNodes.ListNodes())
+	}
+
+	nodes, err := store.List()
+	if err != nil {
+		t.Fatalf("unexpected error listing nodes: %s", err)
+	}
+	if len(nodes) != 2 {
+		t.Errorf("expected 2 registered nodes, got %d", len(nodes))
+	}
+}
@@ -664,6 +664,15 @@ func (s *ConsulStore) UpdateManifest(id fields.ID, man manifest.Manifest) error
 	return s.retryMutate(id, manifestUpdater)
 }
 
+// UpdateManifestDryRun returns the RC at the given ID as it is and as it would
+// be after UpdateManifest, without changing it.
+func (s *ConsulStore) UpdateManifestDryRun(id fields.ID, man manifest.Manifest) (fields.RC, fields.RC, error) {
+	return s.MutateRCDryRun(id, func(rc fields.RC) (fields.RC, error) {
+		rc.Manifest = man
+		return rc, nil
+	})
+}
+
 func (s *ConsulStore) UpdateStrategy(id fields.ID, strategy fields.Strategy) error {
 	if strategy != fields.DynamicStrategy && strategy != fields.StaticStrategy {
 		return util.Errorf("Ineligible strategy - %s - passed.", strategy)
@@ -757,6 +766,29 @@ func (s *ConsulStore) MutateRC(id fields.ID, mutator func(fields.RC) (fields.RC,
 	return nil
 }
 
+// MutateRCDryRun returns the RC with the given id before and after applying
+// the given mutator to it, without writing the result. Errors returned by the
+// mutator are propagated out as they are by MutateRC
+func (s *ConsulStore) MutateRCDryRun(id fields.ID, mutator func(fields.RC) (fields.RC, error)) (fields.RC, fields.RC, error) {
+	rc, err := s.Get(id)
+	if err != nil {
+		return fields.RC{}, fields.RC{}, err
+	}
+
+	// give the mutator its own pod labels so that changing them doesn't
+	// change the RC that is returned as the current one
+	mutated := rc
+	mutated.PodLabels = make(klabels.Set, len(rc.PodLabels))
+	for k, v := range rc.PodLabels {
+		mutated.PodLabels[k] = v
+	}
+	newRC, err := mutator(mutated)
+	if err != nil {
+		return fields.RC{}, fields.RC{}, err
+	}
+	return rc, newRC, nil
+}
+
 // Watch watches for any changes to the replication controller `rc`.
 // This returns two output channels.
 // A `struct{}` is sent on the first output channel whenever a change has occurred.
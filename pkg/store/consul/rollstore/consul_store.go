@@ -73,6 +73,7 @@ type ReplicationControllerStore interface {
 		allocationStrategy rc_fields.Strategy,
 	) (rc_fields.RC, error)
 	Delete(id rc_fields.ID, force bool) error
+	Get(id rc_fields.ID) (rc_fields.RC, error)
 	UpdateCreationLockPath(rcID rc_fields.ID) (string, error)
 
 	// TODO: delete this. the tests are still using it but the real code isn't
@@ -136,6 +137,31 @@ func (s ConsulStore) Get(id roll_fields.ID) (roll_fields.Update, error) {
 	return kvpToRU(kvp)
 }
 
+// BlockingGet is like Get but performs a consul blocking query: it does not
+// return until the update's modify index exceeds waitIndex or waitTime has
+// elapsed. The returned QueryMeta's LastIndex should be passed as waitIndex
+// to the next call. An empty update is returned if it does not exist.
+func (s ConsulStore) BlockingGet(id roll_fields.ID, waitIndex uint64, waitTime time.Duration) (roll_fields.Update, *api.QueryMeta, error) {
+	key, err := RollPath(id)
+	if err != nil {
+		return roll_fields.Update{}, nil, err
+	}
+
+	kvp, queryMeta, err := s.kv.Get(key, &api.QueryOptions{
+		WaitIndex: waitIndex,
+		WaitTime:  waitTime,
+	})
+	if err != nil {
+		return roll_fields.Update{}, nil, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return roll_fields.Update{}, queryMeta, nil
+	}
+
+	update, err := kvpToRU(kvp)
+	return update, queryMeta, err
+}
+
 // List returns all rolling update records.
 func (s ConsulStore) List() ([]roll_fields.Update, error) {
 	listed, _, err := s.kv.List(rollTree+"/", nil)
@@ -303,6 +329,29 @@ func (s ConsulStore) CreateRollingUpdateFromExistingRCs(
 	return u, s.createRU(ctx, u, rollLabels, session.Session())
 }
 
+// CreateRollingUpdateFromExistingRCsDryRun checks whether
+// CreateRollingUpdateFromExistingRCs would admit the passed update without
+// locking anything or writing the update, returning the old and new
+// replication controllers it refers to. An error is returned if either
+// replication controller doesn't exist or another rolling update already
+// refers to one of them.
+func (s ConsulStore) CreateRollingUpdateFromExistingRCsDryRun(u roll_fields.Update) (rc_fields.RC, rc_fields.RC, error) {
+	oldRC, err := s.rcstore.Get(u.OldRC)
+	if err != nil {
+		return rc_fields.RC{}, rc_fields.RC{}, util.Errorf("could not get old replication controller %s: %s", u.OldRC, err)
+	}
+	newRC, err := s.rcstore.Get(u.NewRC)
+	if err != nil {
+		return rc_fields.RC{}, rc_fields.RC{}, util.Errorf("could not get new replication controller %s: %s", u.NewRC, err)
+	}
+
+	err = s.checkForConflictingUpdates(rc_fields.IDs{u.NewRC, u.OldRC})
+	if err != nil {
+		return rc_fields.RC{}, rc_fields.RC{}, err
+	}
+	return oldRC, newRC, nil
+}
+
 // CreateRollingUpdateFromOneExistingWithRCID is like
 // CreateRollingUpdateFromExistingRCs except will create the new RC based on
 // passed parameters, using oldRCID for the old RC. The new RC and new RU will
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/transaction"
@@ -117,9 +118,10 @@ func (s *consulStore) GetStatus(t ResourceType, id ResourceID, namespace Namespa
 	return s.getStatus(t, id, namespace, nil)
 }
 
-func (s *consulStore) WatchStatus(t ResourceType, id ResourceID, namespace Namespace, waitIndex uint64) (Status, *api.QueryMeta, error) {
+func (s *consulStore) WatchStatus(t ResourceType, id ResourceID, namespace Namespace, waitIndex uint64, waitTime time.Duration) (Status, *api.QueryMeta, error) {
 	return s.getStatus(t, id, namespace, &api.QueryOptions{
 		WaitIndex: waitIndex,
+		WaitTime:  waitTime,
 	})
 }
 
@@ -0,0 +1,73 @@
+package nodestatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+)
+
+// Status is the inventory a preparer publishes about the node it runs on.
+type Status struct {
+	// Version is the p2 version of the preparer.
+	Version string `json:"version"`
+
+	// Config summarizes the parts of the preparer's configuration that
+	// are useful to look at across the fleet.
+	Config ConfigSummary `json:"config"`
+
+	// Hooks are the hook scripts installed in the preparer's hooks
+	// directory.
+	Hooks []string `json:"hooks"`
+
+	// Pods are the pods installed under the preparer's pod root.
+	Pods []Pod `json:"pods"`
+
+	// FreeDisk is the space available to unprivileged users on the
+	// filesystem holding the pod root.
+	FreeDisk size.ByteCount `json:"free_disk"`
+
+	// UpdatedAt is the time the inventory was collected.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ConfigSummary struct {
+	ConsulAddress          string `json:"consul_address"`
+	PodRoot                string `json:"pod_root"`
+	HooksDirectory         string `json:"hooks_directory"`
+	LogLevel               string `json:"log_level,omitempty"`
+	AuthType               string `json:"auth_type"`
+	ArtifactAuthType       string `json:"artifact_auth_type,omitempty"`
+	StatusPort             int    `json:"status_port,omitempty"`
+	MaxLaunchableDiskUsage string `json:"max_launchable_disk_usage,omitempty"`
+	Supervisor             string `json:"supervisor"`
+}
+
+type Pod struct {
+	ID          types.PodID        `json:"id"`
+	UniqueKey   types.PodUniqueKey `json:"unique_key,omitempty"`
+	ManifestSHA string             `json:"manifest_sha"`
+}
+
+func rawStatusToStatus(rawStatus statusstore.Status) (Status, error) {
+	var status Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &status)
+	if err != nil {
+		return Status{}, util.Errorf("Could not unmarshal raw status as node status: %s", err)
+	}
+
+	return status, nil
+}
+
+func statusToRawStatus(status Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(status)
+	if err != nil {
+		return statusstore.Status{}, util.Errorf("Could not marshal node status as json bytes: %s", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
@@ -0,0 +1,90 @@
+package nodestatus
+
+import (
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type ConsulStore struct {
+	statusStore statusstore.Store
+
+	// The consul implementation statusstore.Store formats keys like
+	// /status/<resource-type>/<resource-id>/<namespace>. The namespace
+	// portion is useful if multiple subsystems need to record their
+	// own view of a resource.
+	namespace statusstore.Namespace
+}
+
+func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) ConsulStore {
+	return ConsulStore{
+		statusStore: statusStore,
+		namespace:   namespace,
+	}
+}
+
+func (c ConsulStore) Get(node types.NodeName) (Status, *api.QueryMeta, error) {
+	if node == "" {
+		return Status{}, nil, util.Errorf("Provided node name was empty")
+	}
+
+	rawStatus, queryMeta, err := c.statusStore.GetStatus(statusstore.NODE, statusstore.ResourceID(node), c.namespace)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	status, err := rawStatusToStatus(rawStatus)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	return status, queryMeta, nil
+}
+
+func (c ConsulStore) Set(node types.NodeName, status Status) error {
+	if node == "" {
+		return util.Errorf("Provided node name was empty")
+	}
+
+	rawStatus, err := statusToRawStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.SetStatus(statusstore.NODE, statusstore.ResourceID(node), c.namespace, rawStatus)
+}
+
+// List returns the status of every node that has published one in this
+// store's namespace.
+func (c ConsulStore) List() (map[types.NodeName]Status, error) {
+	allStatus, err := c.statusStore.GetAllStatusForResourceType(statusstore.NODE)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[types.NodeName]Status)
+	for id, statusByNamespace := range allStatus {
+		rawStatus, ok := statusByNamespace[c.namespace]
+		if !ok {
+			continue
+		}
+
+		status, err := rawStatusToStatus(rawStatus)
+		if err != nil {
+			return nil, err
+		}
+		ret[types.NodeName(id)] = status
+	}
+
+	return ret, nil
+}
+
+func (c ConsulStore) Delete(node types.NodeName) error {
+	if node == "" {
+		return util.Errorf("Provided node name was empty")
+	}
+
+	return c.statusStore.DeleteStatus(statusstore.NODE, statusstore.ResourceID(node), c.namespace)
+}
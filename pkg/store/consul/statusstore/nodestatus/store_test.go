@@ -0,0 +1,55 @@
+package nodestatus
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSetGetAndList(t *testing.T) {
+	statusStore := statusstoretest.NewFake()
+	store := NewConsul(statusStore, "test")
+	otherStore := NewConsul(statusStore, "other")
+
+	node := types.NodeName("node1.example.com")
+	_, _, err := store.Get(node)
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("Expected no status error, got: %s", err)
+	}
+
+	status := Status{
+		Version: "1.2.3",
+		Config:  ConfigSummary{PodRoot: "/data/pods"},
+		Hooks:   []string{"hookpod__a"},
+		Pods:    []Pod{{ID: "app", ManifestSHA: "abc"}},
+	}
+	err = store.Set(node, status)
+	if err != nil {
+		t.Fatalf("Unexpected error setting status: %s", err)
+	}
+	err = otherStore.Set("node2.example.com", Status{Version: "4.5.6"})
+	if err != nil {
+		t.Fatalf("Unexpected error setting status: %s", err)
+	}
+
+	fetched, _, err := store.Get(node)
+	if err != nil {
+		t.Fatalf("Unexpected error getting status: %s", err)
+	}
+	if fetched.Config.PodRoot != "/data/pods" || len(fetched.Pods) != 1 || fetched.Pods[0].ID != "app" {
+		t.Errorf("Status did not round trip, got %+v", fetched)
+	}
+
+	all, err := store.List()
+	if err != nil {
+		t.Fatalf("Unexpected error listing statuses: %s", err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("Expected only the status in this namespace to be listed, got %d", len(all))
+	}
+	if all[node].Version != "1.2.3" {
+		t.Errorf("Expected version 1.2.3, got %s", all[node].Version)
+	}
+}
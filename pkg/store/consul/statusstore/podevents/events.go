@@ -0,0 +1,121 @@
+// Package podevents records the lifecycle transitions a preparer goes
+// through while deploying a pod (manifest received, artifacts downloaded,
+// hooks run, launched, halted...). The most recent events for each pod on
+// each node are kept in the status store until the pod is uninstalled, so
+// that deploy tooling can show where a rollout is stuck.
+package podevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type EventType string
+
+const (
+	// The preparer received a new intent manifest for the pod
+	PodReceived EventType = "pod_received"
+
+	// The manifest was rejected by the preparer's auth policy or its
+	// artifacts failed digest verification
+	AuthFailed EventType = "auth_failed"
+
+	// Installing the pod's launchables, which downloads their artifacts
+	DownloadStarted  EventType = "download_started"
+	DownloadFinished EventType = "download_finished"
+
+	// A set of hooks was run. Event.Hook holds the hook type
+	HookRan EventType = "hook_ran"
+
+	Launched    EventType = "launched"
+	Halted      EventType = "halted"
+	Uninstalled EventType = "uninstalled"
+
+	// Only the pod's config changed, which was applied without restarting
+	// the pod
+	Reloaded EventType = "reloaded"
+
+	// The values of some of the secrets the pod references changed and
+	// their files were replaced
+	SecretsRotated EventType = "secrets_rotated"
+
+	// An init launchable failed, which kept the pod from launching.
+	// Event.InitFailure describes the failure. This is the only record of
+	// init failures for legacy pods, which have no pod status
+	InitFailed EventType = "init_failed"
+)
+
+// MaxEvents is the number of events retained per pod per node. Older events
+// are discarded as new ones are appended.
+const MaxEvents = 50
+
+type Event struct {
+	Type         EventType          `json:"type"`
+	Node         types.NodeName     `json:"node"`
+	PodID        types.PodID        `json:"pod_id"`
+	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key,omitempty"`
+	ManifestSHA  string             `json:"manifest_sha,omitempty"`
+	Time         time.Time          `json:"time"`
+
+	// Hook is the hook type for HookRan events
+	Hook string `json:"hook,omitempty"`
+
+	// Duration is how long the step took, for events that mark the end
+	// of a step
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// Error is set if the step failed
+	Error string `json:"error,omitempty"`
+
+	// InitFailure is set for InitFailed events
+	InitFailure *InitFailure `json:"init_failure,omitempty"`
+}
+
+// InitFailure describes the init launchable that kept a pod from launching
+type InitFailure struct {
+	LaunchableID string `json:"launchable_id"`
+	EntryPoint   string `json:"entry_point,omitempty"`
+	// -1 if the process didn't exit by itself
+	ExitCode int    `json:"exit_code"`
+	Output   string `json:"output,omitempty"`
+}
+
+// Status is the list of events recorded for a pod on a node, oldest first.
+type Status struct {
+	Events []Event `json:"events"`
+}
+
+// ResourceID returns the status store ID under which events for a pod are
+// recorded. UUID pods are identified by their unique key alone, just like
+// their pod status. Legacy pods are only unique per node.
+func ResourceID(node types.NodeName, podID types.PodID, uniqueKey types.PodUniqueKey) statusstore.ResourceID {
+	if uniqueKey != "" {
+		return statusstore.ResourceID(uniqueKey)
+	}
+	return statusstore.ResourceID(fmt.Sprintf("%s:%s", node, podID))
+}
+
+func rawStatusToStatus(rawStatus statusstore.Status) (Status, error) {
+	var status Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &status)
+	if err != nil {
+		return Status{}, util.Errorf("Could not unmarshal raw status as pod events: %s", err)
+	}
+
+	return status, nil
+}
+
+func statusToRawStatus(status Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(status)
+	if err != nil {
+		return statusstore.Status{}, util.Errorf("Could not marshal pod events as json bytes: %s", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
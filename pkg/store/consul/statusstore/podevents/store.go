@@ -0,0 +1,74 @@
+package podevents
+
+import (
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type ConsulStore struct {
+	statusStore statusstore.Store
+
+	// The consul implementation statusstore.Store formats keys like
+	// /status/<resource-type>/<resource-id>/<namespace>. The namespace
+	// portion is useful if multiple subsystems need to record their
+	// own view of a resource.
+	namespace statusstore.Namespace
+}
+
+func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) ConsulStore {
+	return ConsulStore{
+		statusStore: statusStore,
+		namespace:   namespace,
+	}
+}
+
+func (c ConsulStore) Get(node types.NodeName, podID types.PodID, uniqueKey types.PodUniqueKey) (Status, *api.QueryMeta, error) {
+	if podID == "" {
+		return Status{}, nil, util.Errorf("Provided pod ID was empty")
+	}
+
+	rawStatus, queryMeta, err := c.statusStore.GetStatus(statusstore.POD_EVENTS, ResourceID(node, podID, uniqueKey), c.namespace)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	status, err := rawStatusToStatus(rawStatus)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	return status, queryMeta, nil
+}
+
+// Append adds an event to the pod's event list, discarding the oldest events
+// beyond MaxEvents. It is not safe to call concurrently for the same pod;
+// the preparer is expected to be the only writer for the pods on its node.
+func (c ConsulStore) Append(event Event) error {
+	status, _, err := c.Get(event.Node, event.PodID, event.PodUniqueKey)
+	if err != nil && !statusstore.IsNoStatus(err) {
+		return err
+	}
+
+	status.Events = append(status.Events, event)
+	if len(status.Events) > MaxEvents {
+		status.Events = status.Events[len(status.Events)-MaxEvents:]
+	}
+
+	rawStatus, err := statusToRawStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.SetStatus(statusstore.POD_EVENTS, ResourceID(event.Node, event.PodID, event.PodUniqueKey), c.namespace, rawStatus)
+}
+
+func (c ConsulStore) Delete(node types.NodeName, podID types.PodID, uniqueKey types.PodUniqueKey) error {
+	if podID == "" {
+		return util.Errorf("Provided pod ID was empty")
+	}
+
+	return c.statusStore.DeleteStatus(statusstore.POD_EVENTS, ResourceID(node, podID, uniqueKey), c.namespace)
+}
@@ -0,0 +1,71 @@
+package podevents
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestAppendAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "test")
+	node := types.NodeName("node1.example.com")
+	podID := types.PodID("app")
+
+	_, _, err := store.Get(node, podID, "")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("Expected no status error, got: %s", err)
+	}
+
+	for _, eventType := range []EventType{PodReceived, DownloadStarted, DownloadFinished} {
+		err = store.Append(Event{Type: eventType, Node: node, PodID: podID})
+		if err != nil {
+			t.Fatalf("Unexpected error appending event: %s", err)
+		}
+	}
+
+	status, _, err := store.Get(node, podID, "")
+	if err != nil {
+		t.Fatalf("Unexpected error getting events: %s", err)
+	}
+	if len(status.Events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(status.Events))
+	}
+	if status.Events[0].Type != PodReceived || status.Events[2].Type != DownloadFinished {
+		t.Errorf("Events were not returned in order: %+v", status.Events)
+	}
+
+	// events for the same pod ID on another node are kept separately
+	_, _, err = store.Get("node2.example.com", podID, "")
+	if !statusstore.IsNoStatus(err) {
+		t.Errorf("Expected no events for node2, got: %v", err)
+	}
+}
+
+func TestAppendDiscardsOldEvents(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "test")
+	uniqueKey := types.PodUniqueKey("3f1a4b5c-0000-4000-8000-000000000000")
+
+	for i := 0; i < MaxEvents+5; i++ {
+		eventType := HookRan
+		if i == MaxEvents+4 {
+			eventType = Launched
+		}
+		err := store.Append(Event{Type: eventType, Node: "node1", PodID: "app", PodUniqueKey: uniqueKey})
+		if err != nil {
+			t.Fatalf("Unexpected error appending event: %s", err)
+		}
+	}
+
+	status, _, err := store.Get("node1", "app", uniqueKey)
+	if err != nil {
+		t.Fatalf("Unexpected error getting events: %s", err)
+	}
+	if len(status.Events) != MaxEvents {
+		t.Errorf("Expected %d events, got %d", MaxEvents, len(status.Events))
+	}
+	if status.Events[len(status.Events)-1].Type != Launched {
+		t.Errorf("Expected the newest event to be retained")
+	}
+}
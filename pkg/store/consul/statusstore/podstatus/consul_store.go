@@ -57,7 +57,7 @@ func (c ConsulStore) WaitForStatus(key types.PodUniqueKey, waitIndex uint64) (Po
 		return PodStatus{}, nil, util.Errorf("Cannot retrieve status for a pod with an empty uuid")
 	}
 
-	status, queryMeta, err := c.statusStore.WatchStatus(statusstore.POD, statusstore.ResourceID(key), c.namespace, waitIndex)
+	status, queryMeta, err := c.statusStore.WatchStatus(statusstore.POD, statusstore.ResourceID(key), c.namespace, waitIndex, 0)
 	if err != nil {
 		return PodStatus{}, queryMeta, err
 	}
@@ -34,6 +34,14 @@ type ExitStatus struct {
 	ExitTime   time.Time `json:"time"`
 	ExitCode   int       `json:"exit_code"`
 	ExitStatus int       `json:"exit_status"`
+
+	// Set if the process failed more often than its restart backoff allows
+	// and is no longer restarted
+	RestartsExhausted bool `json:"restarts_exhausted,omitempty"`
+
+	// How long the process took to exit after its pod started shutting
+	// down, if it exited because the pod was shut down
+	ShutdownDuration time.Duration `json:"shutdown_duration,omitempty"`
 }
 
 // Encapsulates information regarding the state of a process. Currently only
@@ -44,16 +52,57 @@ type ProcessStatus struct {
 	LastExit     *ExitStatus         `json:"last_exit"`
 }
 
+// Describes an init launchable that failed, which keeps the rest of the pod
+// from being started.
+type InitFailure struct {
+	LaunchableID launch.LaunchableID `json:"launchable_id"`
+	EntryPoint   string              `json:"entry_point"`
+	Time         time.Time           `json:"time"`
+	// -1 if the process didn't exit by itself
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error"`
+}
+
+// Describes the last run of a hook for one event.
+type HookResult struct {
+	Name          string        `json:"name"`
+	Event         string        `json:"event"`
+	FailurePolicy string        `json:"failure_policy"`
+	Time          time.Time     `json:"time"`
+	Duration      time.Duration `json:"duration"`
+	Success       bool          `json:"success"`
+	Error         string        `json:"error,omitempty"`
+}
+
 // Encapsulates the state of all processes running in a pod.
 type PodStatus struct {
 	ProcessStatuses []ProcessStatus `json:"process_status"`
 	PodStatus       PodState        `json:"status"`
 
+	// Set while the pod's last launch was stopped by a failing init
+	// launchable
+	InitFailure *InitFailure `json:"init_failure,omitempty"`
+
+	// The last result of each hook that ran for the pod, per event
+	HookResults []HookResult `json:"hook_results,omitempty"`
+
 	// String representing the pod manifest for the running pod. Will be
 	// empty if it hasn't yet been launched
 	Manifest string `json:"manifest"`
 }
 
+// SetHookResult records a hook result, replacing the previous result of the
+// same hook for the same event
+func (p *PodStatus) SetHookResult(result HookResult) {
+	for i, existing := range p.HookResults {
+		if existing.Name == result.Name && existing.Event == result.Event {
+			p.HookResults[i] = result
+			return
+		}
+	}
+	p.HookResults = append(p.HookResults, result)
+}
+
 func statusToPodStatus(rawStatus statusstore.Status) (PodStatus, error) {
 	var podStatus PodStatus
 
@@ -104,9 +104,14 @@ func (s *FakeStatusStore) WatchStatus(
 	id statusstore.ResourceID,
 	namespace statusstore.Namespace,
 	waitIndex uint64,
+	waitTime time.Duration,
 ) (statusstore.Status, *api.QueryMeta, error) {
-	// This should be used in tests that enforce timeouts, so don't worry about
-	// infinite looping here
+	// Without a waitTime this should be used in tests that enforce
+	// timeouts, so don't worry about infinite looping here
+	var deadline <-chan time.Time
+	if waitTime > 0 {
+		deadline = time.After(waitTime)
+	}
 	for {
 		s.mu.Lock()
 		if waitIndex <= s.LastIndex {
@@ -115,6 +120,12 @@ func (s *FakeStatusStore) WatchStatus(
 		}
 		s.mu.Unlock()
 
+		select {
+		case <-deadline:
+			return s.GetStatus(t, id, namespace)
+		default:
+		}
+
 		time.Sleep(1 * time.Millisecond)
 	}
 }
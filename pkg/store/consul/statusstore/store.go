@@ -2,6 +2,7 @@ package statusstore
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/consul/api"
 )
@@ -17,10 +18,12 @@ func (t ResourceType) String() string { return string(t) }
 // Should this be collapsed with label types and "tree" names? this stuff is
 // all over the place but sometimes has subtle differences
 const (
-	PC  = ResourceType("pod_clusters")
-	POD = ResourceType("pods")
-	DS  = ResourceType("daemon_sets")
-	RC  = ResourceType("replication_controllers")
+	PC         = ResourceType("pod_clusters")
+	POD        = ResourceType("pods")
+	DS         = ResourceType("daemon_sets")
+	RC         = ResourceType("replication_controllers")
+	NODE       = ResourceType("nodes")
+	POD_EVENTS = ResourceType("pod_events")
 )
 
 // Unfortunately each ResourceType will carry along with it a different "ID"
@@ -59,8 +62,10 @@ type Store interface {
 	// namespaced by a Namespace string
 	GetStatus(t ResourceType, id ResourceID, namespace Namespace) (Status, *api.QueryMeta, error)
 
-	// Like GetStatus(), but doesn't return status until waitIndex has been surpassed in consul
-	WatchStatus(t ResourceType, id ResourceID, namespace Namespace, waitIndex uint64) (Status, *api.QueryMeta, error)
+	// Like GetStatus(), but doesn't return status until waitIndex has been
+	// surpassed in consul or waitTime has elapsed. A waitTime of 0 uses
+	// consul's default
+	WatchStatus(t ResourceType, id ResourceID, namespace Namespace, waitIndex uint64, waitTime time.Duration) (Status, *api.QueryMeta, error)
 
 	// Delete the status entry for a resource that has been deleted once the
 	// deletion has been processed
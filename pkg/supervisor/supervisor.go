@@ -0,0 +1,183 @@
+// Package supervisor abstracts the process supervisor that keeps the
+// executables of launched pods running. runit is the default; systemd can be
+// selected for hosts that don't ship runit.
+//
+// Supervisors speak in terms of the runit package's service types, which are
+// shared by every implementation.
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/systemd"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	RunitType   = "runit"
+	SystemdType = "systemd"
+
+	DefaultType = RunitType
+)
+
+// Supervisor installs and controls the services that run a pod's
+// executables.
+type Supervisor interface {
+	runit.SV
+
+	// Type returns the name of the supervisor, e.g. "runit"
+	Type() string
+
+	// Service returns the service that runs the named executable.
+	Service(name string) runit.Service
+
+	// LogAgent returns the service that collects the named executable's
+	// output.
+	LogAgent(name string) runit.Service
+
+	// LogDir returns the directory the default log agent writes the named
+	// executable's output to.
+	LogDir(name string) string
+
+	// Activate records the complete set of services for the named pod,
+	// installing any that are new or changed. It does not start any
+	// services: new ones stay down until they are started, so that a pod
+	// can start them in order.
+	Activate(podName string, templates map[string]runit.ServiceTemplate) error
+
+	// Remove forgets all of the named pod's services. They are cleaned up
+	// by the next Prune().
+	Remove(podName string) error
+
+	// Prune removes any installed services that no longer belong to a pod.
+	Prune() error
+
+	// Failed returns whether the named service failed more often than its
+	// restart backoff allows and will not be restarted until it is started
+	// explicitly.
+	Failed(name string) (bool, error)
+}
+
+// runitSupervisor runs services under runsvdir, using servicebuilder files
+// to track which pod each service belongs to.
+type runitSupervisor struct {
+	*runit.ServiceBuilder
+	runit.SV
+}
+
+var DefaultRunit Supervisor = NewRunit(runit.DefaultBuilder, runit.DefaultSV)
+
+func NewRunit(serviceBuilder *runit.ServiceBuilder, sv runit.SV) Supervisor {
+	return runitSupervisor{
+		ServiceBuilder: serviceBuilder,
+		SV:             sv,
+	}
+}
+
+// Start starts the service and removes the down file that holds newly
+// activated services down, so that runsv starts the service again whenever
+// runsv itself is restarted.
+func (r runitSupervisor) Start(service *runit.Service) (string, error) {
+	out, err := r.SV.Start(service)
+	return out, r.clearDown(service, err)
+}
+
+// Restart restarts the service and removes its down file, like Start.
+func (r runitSupervisor) Restart(service *runit.Service, timeout time.Duration) (string, error) {
+	out, err := r.SV.Restart(service, timeout)
+	return out, r.clearDown(service, err)
+}
+
+// clearDown removes the service's down file unless starting it failed.
+func (runitSupervisor) clearDown(service *runit.Service, startErr error) error {
+	if startErr != nil && startErr != runit.Killed {
+		return startErr
+	}
+	err := os.Remove(filepath.Join(service.Path, runit.DOWN_FILE_NAME))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return startErr
+}
+
+func (runitSupervisor) Type() string {
+	return RunitType
+}
+
+func (r runitSupervisor) Service(name string) runit.Service {
+	return runit.Service{
+		Path: filepath.Join(r.RunitRoot, name),
+		Name: name,
+	}
+}
+
+func (r runitSupervisor) LogAgent(name string) runit.Service {
+	return runit.Service{
+		Path: filepath.Join(r.RunitRoot, name, "log"),
+		Name: name + " logAgent",
+	}
+}
+
+func (r runitSupervisor) LogDir(name string) string {
+	return filepath.Join(r.StagingRoot, name, "log", "main")
+}
+
+func (r runitSupervisor) Remove(podName string) error {
+	err := os.Remove(filepath.Join(r.ConfigRoot, podName+".yaml"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (r runitSupervisor) Failed(name string) (bool, error) {
+	_, err := os.Stat(filepath.Join(r.StagingRoot, name, runit.FAILED_FILE_NAME))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Config selects and configures the supervisor. It is embedded in the
+// preparer's configuration.
+type Config struct {
+	// Type is either "runit" (the default) or "systemd". Restart backoff
+	// under systemd requires systemd 254 or later
+	Type string `yaml:"type,omitempty"`
+
+	// The remaining fields only apply to systemd. Unset fields use the
+	// defaults in systemd.DefaultSystemd.
+	UnitRoot    string `yaml:"unit_root,omitempty"`
+	StagingRoot string `yaml:"staging_root,omitempty"`
+	ConfigRoot  string `yaml:"config_root,omitempty"`
+	Slice       string `yaml:"slice,omitempty"`
+}
+
+func (c Config) Supervisor() (Supervisor, error) {
+	switch c.Type {
+	case "", RunitType:
+		return DefaultRunit, nil
+	case SystemdType:
+		s := *systemd.DefaultSystemd
+		if c.UnitRoot != "" {
+			s.UnitRoot = c.UnitRoot
+		}
+		if c.StagingRoot != "" {
+			s.StagingRoot = c.StagingRoot
+		}
+		if c.ConfigRoot != "" {
+			s.ConfigRoot = c.ConfigRoot
+		}
+		if c.Slice != "" {
+			s.Slice = c.Slice
+		}
+		return &s, nil
+	default:
+		return nil, util.Errorf("unknown supervisor type %q, expected %q or %q", c.Type, RunitType, SystemdType)
+	}
+}
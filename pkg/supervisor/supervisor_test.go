@@ -0,0 +1,34 @@
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/systemd"
+)
+
+func TestConfigSelectsSupervisor(t *testing.T) {
+	sup, err := Config{}.Supervisor()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if sup.Type() != RunitType {
+		t.Errorf("Expected runit to be the default supervisor, got %s", sup.Type())
+	}
+
+	sup, err = Config{Type: SystemdType, Slice: "pods.slice"}.Supervisor()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	s, ok := sup.(*systemd.Systemd)
+	if !ok {
+		t.Fatalf("Expected a systemd supervisor, got %T", sup)
+	}
+	if s.Slice != "pods.slice" || s.UnitRoot != systemd.DefaultSystemd.UnitRoot {
+		t.Errorf("Expected configured fields to override the defaults: %+v", s)
+	}
+
+	_, err = Config{Type: "upstart"}.Supervisor()
+	if err == nil {
+		t.Errorf("Expected an error for an unknown supervisor type")
+	}
+}
@@ -0,0 +1,193 @@
+package systemd
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	activeStateRunning = "active"
+	loadStateNotFound  = "not-found"
+	resultStartLimit   = "start-limit-hit"
+
+	stopPollInterval = 150 * time.Millisecond
+)
+
+// The methods below implement runit.SV, so that launchables control systemd
+// units the same way they control runit services. Services are identified by
+// the unit file in their Path.
+
+func (s *Systemd) Start(service *runit.Service) (string, error) {
+	return s.systemctl("start", unitForService(service))
+}
+
+// Stop stops the service. If timeout is positive and the service has not
+// stopped within it, the service is killed and runit.Killed is returned, like
+// runit's force-stop.
+func (s *Systemd) Stop(service *runit.Service, timeout time.Duration) (string, error) {
+	unit := unitForService(service)
+	if timeout <= 0 {
+		return s.systemctl("stop", unit)
+	}
+
+	out, err := s.systemctl("stop", "--no-block", unit)
+	if err != nil {
+		return out, err
+	}
+
+	deadline := time.After(timeout)
+	for {
+		props, err := s.show(unit, "ActiveState")
+		if err != nil {
+			return "", err
+		}
+		if props["ActiveState"] != "deactivating" && props["ActiveState"] != activeStateRunning {
+			return out, nil
+		}
+
+		select {
+		case <-deadline:
+			out, err = s.systemctl("kill", "--signal=SIGKILL", unit)
+			if err != nil {
+				return out, err
+			}
+			return out, runit.Killed
+		case <-time.After(stopPollInterval):
+		}
+	}
+}
+
+func (s *Systemd) Restart(service *runit.Service, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return s.systemctl("restart", unitForService(service))
+	}
+
+	out, stopErr := s.Stop(service, timeout)
+	if stopErr != nil && stopErr != runit.Killed {
+		return out, stopErr
+	}
+	out, err := s.Start(service)
+	if err != nil {
+		return out, err
+	}
+	// report a forced kill the same way runit's force-restart does
+	return out, stopErr
+}
+
+// Once starts the service. Whether it is restarted when it exits is
+// determined by the Restart= setting of its unit.
+func (s *Systemd) Once(service *runit.Service) (string, error) {
+	return s.Start(service)
+}
+
+func (s *Systemd) Stat(service *runit.Service) (*runit.StatResult, error) {
+	unit := unitForService(service)
+	childStatus, childPID, childTime, err := s.stat(unit)
+	if err != nil {
+		return nil, err
+	}
+
+	logUnit := unit
+	if !strings.HasSuffix(unit, logUnitSuffix) {
+		logUnit = strings.TrimSuffix(unit, unitSuffix) + logUnitSuffix
+	}
+	logStatus, logPID, logTime, err := s.stat(logUnit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runit.StatResult{
+		ChildStatus: childStatus,
+		ChildPID:    childPID,
+		ChildTime:   childTime,
+		LogStatus:   logStatus,
+		LogPID:      logPID,
+		LogTime:     logTime,
+	}, nil
+}
+
+// Failed returns whether the service's unit hit its start limit, which is how
+// systemd gives up on a service that keeps failing.
+func (s *Systemd) Failed(name string) (bool, error) {
+	props, err := s.show(s.unitName(name), "Result")
+	if err != nil {
+		return false, err
+	}
+	return props["Result"] == resultStartLimit, nil
+}
+
+func (s *Systemd) stat(unit string) (string, uint64, time.Duration, error) {
+	props, err := s.show(unit, "LoadState", "ActiveState", "MainPID", "ActiveEnterTimestampMonotonic")
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if props["LoadState"] == loadStateNotFound {
+		return "", 0, 0, util.Errorf("Unit %s does not exist", unit)
+	}
+	if props["ActiveState"] != activeStateRunning {
+		return runit.STATUS_DOWN, 0, 0, nil
+	}
+
+	pid, err := strconv.ParseUint(props["MainPID"], 10, 32)
+	if err != nil {
+		return "", 0, 0, util.Errorf("Could not parse main PID of %s from %q: %s", unit, props["MainPID"], err)
+	}
+	activeSince, err := strconv.ParseInt(props["ActiveEnterTimestampMonotonic"], 10, 64)
+	if err != nil {
+		return "", 0, 0, util.Errorf("Could not parse active timestamp of %s from %q: %s", unit, props["ActiveEnterTimestampMonotonic"], err)
+	}
+	var now unix.Timespec
+	err = unix.ClockGettime(unix.CLOCK_MONOTONIC, &now)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	uptime := time.Duration(now.Nano()) - time.Duration(activeSince)*time.Microsecond
+	// runit reports whole seconds
+	return runit.STATUS_RUN, pid, uptime - uptime%time.Second, nil
+}
+
+// show returns the requested properties of a unit.
+func (s *Systemd) show(unit string, properties ...string) (map[string]string, error) {
+	args := []string{"show"}
+	for _, property := range properties {
+		args = append(args, "--property="+property)
+	}
+	out, err := s.systemctl(append(args, unit)...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			ret[parts[0]] = parts[1]
+		}
+	}
+	return ret, nil
+}
+
+func (s *Systemd) systemctl(args ...string) (string, error) {
+	cmd := exec.Command(s.Bin, args...)
+	buffer := bytes.Buffer{}
+	cmd.Stdout = &buffer
+	cmd.Stderr = &buffer
+	err := cmd.Run()
+	if err != nil {
+		return buffer.String(), util.Errorf("Could not run %v - Error: %s, Output: %s", cmd.Args, err, buffer.String())
+	}
+	return buffer.String(), nil
+}
+
+func unitForService(service *runit.Service) string {
+	return filepath.Base(service.Path)
+}
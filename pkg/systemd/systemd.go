@@ -0,0 +1,508 @@
+// Package systemd runs p2 services as systemd units, as an alternative to
+// runit for hosts that don't ship it.
+//
+// Each service template becomes two units: p2-<service>.service runs the
+// executable and p2-<service>.log.service runs its log agent. The two are
+// connected by a named pipe in the service's staging directory, which both
+// ends open read-write so that neither sees EOF or EPIPE while the other
+// restarts, matching the pipe runsv holds open between a service and its log
+// service. Finish commands run as ExecStopPost, with systemd's exit
+// information translated into the arguments runit passes to ./finish.
+//
+// Restart backoff requires systemd 254 or later, which added RestartSteps=
+// and RestartMaxDelaySec=. Older versions ignore those settings with a
+// warning, so a failing service is restarted after the initial delay every
+// time instead of backing off.
+//
+// Like servicebuilder, the complete set of services for each pod is recorded
+// as YAML under ConfigRoot, which Prune() uses to find units that no longer
+// belong to any pod.
+package systemd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	unitPrefix     = "p2-"
+	unitSuffix     = ".service"
+	logUnitSuffix  = ".log" + unitSuffix
+	logPipeName    = "pipe"
+	generatedMark  = "# Generated by p2."
+	defaultSleep   = 2
+	installTarget  = "multi-user.target"
+	unitFileMode   = 0644
+	scriptFileMode = 0755
+)
+
+// DefaultSystemctlPath is the path to the default systemctl binary. Specified
+// as a var so you can override at build time.
+var DefaultSystemctlPath = "/bin/systemctl"
+
+type Systemd struct {
+	ConfigRoot  string // directory recording the services of each pod
+	StagingRoot string // directory holding each service's scripts, log pipe and log directory
+	UnitRoot    string // directory unit files are written to
+	Slice       string // slice that every unit is placed in
+	Bin         string // path to systemctl
+
+	// testingNoChown should be set during unit tests to prevent the chown()
+	// of log directories, which fails when not running as root.
+	testingNoChown bool
+}
+
+var DefaultSystemd = &Systemd{
+	ConfigRoot:  "/etc/p2/systemd.d",
+	StagingRoot: "/var/lib/p2/systemd",
+	UnitRoot:    "/etc/systemd/system",
+	Slice:       "p2.slice",
+	Bin:         DefaultSystemctlPath,
+}
+
+func (s *Systemd) Type() string {
+	return "systemd"
+}
+
+func (s *Systemd) Service(name string) runit.Service {
+	return runit.Service{
+		Path: filepath.Join(s.UnitRoot, unitPrefix+name+unitSuffix),
+		Name: name,
+	}
+}
+
+func (s *Systemd) LogAgent(name string) runit.Service {
+	return runit.Service{
+		Path: filepath.Join(s.UnitRoot, unitPrefix+name+logUnitSuffix),
+		Name: name + " logAgent",
+	}
+}
+
+func (s *Systemd) LogDir(name string) string {
+	return filepath.Join(s.StagingRoot, name, "log", "main")
+}
+
+// Activate records the services of a pod and writes their units. Services
+// with the "always" restart policy are enabled so that they start on boot;
+// launchables start services explicitly.
+func (s *Systemd) Activate(podName string, templates map[string]runit.ServiceTemplate) error {
+	err := s.write(filepath.Join(s.ConfigRoot, podName+".yaml"), templates)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for serviceName, template := range templates {
+		serviceChanged, err := s.stage(podName, serviceName, template)
+		if err != nil {
+			return util.Errorf("Could not write units for %s: %s", serviceName, err)
+		}
+		changed = changed || serviceChanged
+	}
+
+	if changed {
+		_, err = s.systemctl("daemon-reload")
+		if err != nil {
+			return err
+		}
+	}
+
+	for serviceName, template := range templates {
+		verb := "disable"
+		if template.RestartPolicy.Restarts() {
+			verb = "enable"
+		}
+		_, err = s.systemctl(verb, s.unitName(serviceName))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Systemd) Remove(podName string) error {
+	err := os.Remove(filepath.Join(s.ConfigRoot, podName+".yaml"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Prune stops and removes the units of services that are not recorded for
+// any pod. Unit files that weren't generated by p2 are left alone.
+func (s *Systemd) Prune() error {
+	configs, err := s.loadConfigDir()
+	if err != nil {
+		return err
+	}
+
+	units, err := ioutil.ReadDir(s.UnitRoot)
+	if err != nil {
+		return err
+	}
+	removed := false
+	for _, unit := range units {
+		serviceName, ok := s.serviceNameForUnit(unit.Name())
+		if !ok {
+			continue
+		}
+		if _, exists := configs[serviceName]; exists {
+			continue
+		}
+		if !s.generated(filepath.Join(s.UnitRoot, unit.Name())) {
+			continue
+		}
+
+		// the unit is being removed, so a failure to stop it will be
+		// noticed by whoever inspects the host
+		_, _ = s.systemctl("disable", "--now", unit.Name())
+		err = os.Remove(filepath.Join(s.UnitRoot, unit.Name()))
+		if err != nil {
+			return err
+		}
+		removed = true
+	}
+
+	stages, err := ioutil.ReadDir(s.StagingRoot)
+	if err != nil {
+		return err
+	}
+	for _, stage := range stages {
+		if _, exists := configs[stage.Name()]; !exists {
+			err = os.RemoveAll(filepath.Join(s.StagingRoot, stage.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if removed {
+		_, err = s.systemctl("daemon-reload")
+		return err
+	}
+	return nil
+}
+
+func (s *Systemd) unitName(serviceName string) string {
+	return unitPrefix + serviceName + unitSuffix
+}
+
+func (s *Systemd) logUnitName(serviceName string) string {
+	return unitPrefix + serviceName + logUnitSuffix
+}
+
+// serviceNameForUnit returns the name of the service a unit file belongs to,
+// if it is named like a p2 unit.
+func (s *Systemd) serviceNameForUnit(unitName string) (string, bool) {
+	if !strings.HasPrefix(unitName, unitPrefix) || !strings.HasSuffix(unitName, unitSuffix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(unitName, unitPrefix)
+	if strings.HasSuffix(name, logUnitSuffix) {
+		return strings.TrimSuffix(name, logUnitSuffix), true
+	}
+	return strings.TrimSuffix(name, unitSuffix), true
+}
+
+func (s *Systemd) generated(unitPath string) bool {
+	content, err := ioutil.ReadFile(unitPath)
+	return err == nil && bytes.HasPrefix(content, []byte(generatedMark))
+}
+
+// write records a pod's services in the same format as a servicebuilder
+// file. Pods without services have no file.
+func (s *Systemd) write(path string, templates map[string]runit.ServiceTemplate) error {
+	if len(templates) == 0 {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return util.Errorf("Could not remove old service config when new path should have no services: %s", err)
+		}
+		return nil
+	}
+
+	text, err := yaml.Marshal(templates)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, text, 0644)
+}
+
+func (s *Systemd) loadConfigDir() (map[string]runit.ServiceTemplate, error) {
+	ret := make(map[string]runit.ServiceTemplate)
+
+	entries, err := ioutil.ReadDir(s.ConfigRoot)
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		entryContents, err := ioutil.ReadFile(filepath.Join(s.ConfigRoot, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		entryTemplate := make(map[string]runit.ServiceTemplate)
+		err = yaml.Unmarshal(entryContents, entryTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, template := range entryTemplate {
+			if _, exists := ret[name]; exists {
+				return nil, util.Errorf("service with name %s was defined twice (from %s)", name, entry.Name())
+			}
+			ret[name] = template
+		}
+	}
+
+	return ret, nil
+}
+
+// stage writes the scripts and units for a service, returning whether any
+// unit file changed.
+func (s *Systemd) stage(podName string, serviceName string, template runit.ServiceTemplate) (bool, error) {
+	stageDir := filepath.Join(s.StagingRoot, serviceName)
+	logDir := filepath.Join(stageDir, "log")
+	err := os.MkdirAll(logDir, 0755)
+	if err != nil {
+		return false, err
+	}
+
+	// svlogd, the default log agent, writes to ./main
+	logMainDir := filepath.Join(logDir, "main")
+	err = os.Mkdir(logMainDir, 0755)
+	if err == nil {
+		if !s.testingNoChown {
+			err = chownNobody(logMainDir)
+			if err != nil {
+				return false, err
+			}
+		}
+	} else if !os.IsExist(err) {
+		return false, err
+	}
+
+	pipePath := filepath.Join(stageDir, logPipeName)
+	err = unix.Mkfifo(pipePath, 0600)
+	if err != nil && err != unix.EEXIST {
+		return false, util.Errorf("Could not create log pipe %s: %s", pipePath, err)
+	}
+
+	if len(template.Run) == 0 {
+		return false, util.Errorf("empty run script")
+	}
+	runScript := fmt.Sprintf(`#!/bin/sh
+exec 1<>%s 2>&1
+exec %s
+`, shellQuote(pipePath), shellJoin(template.Run))
+	_, err = util.WriteIfChanged(filepath.Join(stageDir, "run"), []byte(runScript), scriptFileMode)
+	if err != nil {
+		return false, err
+	}
+
+	logExec := template.Log
+	if len(logExec) == 0 {
+		logExec = runit.DefaultLogExec()
+	}
+	logScript := fmt.Sprintf(`#!/bin/sh
+exec 0<>%s
+exec %s
+`, shellQuote(pipePath), shellJoin(logExec))
+	_, err = util.WriteIfChanged(filepath.Join(logDir, "run"), []byte(logScript), scriptFileMode)
+	if err != nil {
+		return false, err
+	}
+
+	finishExec := template.Finish
+	if len(finishExec) == 0 {
+		finishExec = []string{"/bin/true", "# finish not implemented"}
+	}
+	// finish commands refer to runit's arguments as "$1" and "$2"
+	finishScript := fmt.Sprintf(`#!/bin/bash
+if [ "$EXIT_CODE" = "exited" ]; then
+	set -- "$EXIT_STATUS" 0
+else
+	set -- -1 "$(kill -l "$EXIT_STATUS" 2>/dev/null || echo 0)"
+fi
+%s
+`, strings.Join(finishExec, " "))
+	_, err = util.WriteIfChanged(filepath.Join(stageDir, "finish"), []byte(finishScript), scriptFileMode)
+	if err != nil {
+		return false, err
+	}
+
+	unitChanged, err := util.WriteIfChanged(
+		filepath.Join(s.UnitRoot, s.unitName(serviceName)),
+		s.serviceUnit(podName, serviceName, stageDir, template),
+		unitFileMode,
+	)
+	if err != nil {
+		return false, err
+	}
+	logUnitChanged, err := util.WriteIfChanged(
+		filepath.Join(s.UnitRoot, s.logUnitName(serviceName)),
+		s.logUnit(podName, serviceName, logDir, template),
+		unitFileMode,
+	)
+	if err != nil {
+		return false, err
+	}
+	return unitChanged || logUnitChanged, nil
+}
+
+func (s *Systemd) serviceUnit(podName string, serviceName string, stageDir string, template runit.ServiceTemplate) []byte {
+	restart := "no"
+	switch template.RestartPolicy {
+	case runit.RestartPolicyAlways:
+		restart = "always"
+	case runit.RestartPolicyOnFailure:
+		restart = "on-failure"
+	}
+
+	// systemd implements backoff natively: the delay grows from RestartSec
+	// to RestartMaxDelaySec (systemd 254+), and a unit that hits its start
+	// limit enters the failed state
+	var startLimit, restartDelay string
+	restartSec := strconv.Itoa(sleepSeconds(template.Sleep))
+	if template.Backoff != nil {
+		restartSec = backoffSeconds(template.Backoff.Initial)
+		restartDelay = fmt.Sprintf("RestartSteps=%d\nRestartMaxDelaySec=%s\n", backoffSteps(template.Backoff), backoffSeconds(template.Backoff.Max))
+		if template.Backoff.MaxRestarts > 0 {
+			startLimit = fmt.Sprintf("StartLimitIntervalSec=%s\nStartLimitBurst=%d\n", backoffSeconds(template.Backoff.Window), template.Backoff.MaxRestarts+1)
+		}
+	}
+
+	killSignal := "SIGTERM"
+	if template.StopSignal != "" {
+		killSignal = "SIG" + template.StopSignal
+	}
+
+	return []byte(fmt.Sprintf(`%s Pod: %s
+[Unit]
+Description=p2 service %s
+Wants=%s
+After=%s
+%s
+[Service]
+Type=simple
+ExecStart=%s
+ExecStopPost=%s
+KillSignal=%s
+Restart=%s
+RestartSec=%s
+%sSlice=%s
+WorkingDirectory=%s
+
+[Install]
+WantedBy=%s
+`,
+		generatedMark, podName,
+		serviceName,
+		s.logUnitName(serviceName),
+		s.logUnitName(serviceName),
+		startLimit,
+		filepath.Join(stageDir, "run"),
+		filepath.Join(stageDir, "finish"),
+		killSignal,
+		restart,
+		restartSec,
+		restartDelay,
+		s.Slice,
+		stageDir,
+		installTarget,
+	))
+}
+
+func (s *Systemd) logUnit(podName string, serviceName string, logDir string, template runit.ServiceTemplate) []byte {
+	return []byte(fmt.Sprintf(`%s Pod: %s
+[Unit]
+Description=p2 log agent for %s
+
+[Service]
+Type=simple
+ExecStart=%s
+Restart=always
+RestartSec=%d
+Slice=%s
+WorkingDirectory=%s
+`,
+		generatedMark, podName,
+		serviceName,
+		filepath.Join(logDir, "run"),
+		sleepSeconds(template.LogSleep),
+		s.Slice,
+		logDir,
+	))
+}
+
+// the default sleep reduces spinning on a broken run script, as it does
+// under runit
+func sleepSeconds(sleep *int) int {
+	if sleep != nil && *sleep >= 0 {
+		return *sleep
+	}
+	return defaultSleep
+}
+
+func backoffSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// backoffSteps returns how many restarts it takes for a delay that doubles
+// with every restart to grow from the backoff's initial delay to its maximum.
+// systemd spreads the growth from RestartSec to RestartMaxDelaySec
+// exponentially over RestartSteps restarts.
+func backoffSteps(backoff *runit.Backoff) int {
+	steps := 0
+	for delay := backoff.Initial; delay > 0 && delay < backoff.Max; delay *= 2 {
+		steps++
+	}
+	return steps
+}
+
+func chownNobody(path string) error {
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(nobody.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(nobody.Gid)
+	if err != nil {
+		return err
+	}
+	return os.Chown(path, uid, gid)
+}
+
+func shellQuote(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,195 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/runit"
+)
+
+func fakeSystemd(t *testing.T) (*Systemd, func()) {
+	root, err := ioutil.TempDir("", "systemd_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Systemd{
+		ConfigRoot:     filepath.Join(root, "config"),
+		StagingRoot:    filepath.Join(root, "staging"),
+		UnitRoot:       filepath.Join(root, "units"),
+		Slice:          "p2.slice",
+		Bin:            "/bin/true",
+		testingNoChown: true,
+	}
+	for _, dir := range []string{s.ConfigRoot, s.StagingRoot, s.UnitRoot} {
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, func() { _ = os.RemoveAll(root) }
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read %s: %s", path, err)
+	}
+	return string(content)
+}
+
+func TestActivateWritesUnits(t *testing.T) {
+	s, cleanup := fakeSystemd(t)
+	defer cleanup()
+
+	err := s.Activate("app", map[string]runit.ServiceTemplate{
+		"app__web__launch": {
+			Run:           []string{"/usr/bin/p2-exec", "--", "it's running"},
+			Log:           []string{"/usr/bin/p2-log-bridge"},
+			Finish:        []string{"/usr/bin/finish", "$1", "$2"},
+			RestartPolicy: runit.RestartPolicyAlways,
+			StopSignal:    "INT",
+		},
+		"app__web__once": {
+			Run:           []string{"/bin/echo"},
+			RestartPolicy: runit.RestartPolicyNever,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error activating services: %s", err)
+	}
+
+	service := s.Service("app__web__launch")
+	if service.Name != "app__web__launch" || filepath.Base(service.Path) != "p2-app__web__launch.service" {
+		t.Errorf("Unexpected service: %+v", service)
+	}
+	unit := readFile(t, service.Path)
+	for _, expected := range []string{
+		"Restart=always",
+		"Slice=p2.slice",
+		"Wants=p2-app__web__launch.log.service",
+		"ExecStart=" + filepath.Join(s.StagingRoot, "app__web__launch", "run"),
+		"ExecStopPost=" + filepath.Join(s.StagingRoot, "app__web__launch", "finish"),
+	} {
+		if !strings.Contains(unit, expected) {
+			t.Errorf("Expected unit to contain %q:\n%s", expected, unit)
+		}
+	}
+	if !strings.Contains(readFile(t, s.Service("app__web__once").Path), "Restart=no") {
+		t.Errorf("Expected a service with restart policy never not to be restarted")
+	}
+
+	logUnit := readFile(t, s.LogAgent("app__web__launch").Path)
+	if !strings.Contains(logUnit, "ExecStart="+filepath.Join(s.StagingRoot, "app__web__launch", "log", "run")) {
+		t.Errorf("Unexpected log unit:\n%s", logUnit)
+	}
+
+	runScript := readFile(t, filepath.Join(s.StagingRoot, "app__web__launch", "run"))
+	if !strings.Contains(runScript, `exec '/usr/bin/p2-exec' '--' 'it'\''s running'`) {
+		t.Errorf("Run script did not quote arguments:\n%s", runScript)
+	}
+	finishScript := readFile(t, filepath.Join(s.StagingRoot, "app__web__launch", "finish"))
+	if !strings.Contains(finishScript, "/usr/bin/finish $1 $2") {
+		t.Errorf("Unexpected finish script:\n%s", finishScript)
+	}
+
+	info, err := os.Stat(filepath.Join(s.StagingRoot, "app__web__launch", logPipeName))
+	if err != nil {
+		t.Fatalf("Expected log pipe to exist: %s", err)
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		t.Errorf("Expected log pipe to be a named pipe, was %s", info.Mode())
+	}
+}
+
+func TestOnFailureBackoffUnit(t *testing.T) {
+	s, cleanup := fakeSystemd(t)
+	defer cleanup()
+
+	err := s.Activate("app", map[string]runit.ServiceTemplate{
+		"app__web__launch": {
+			Run:           []string{"/bin/true"},
+			RestartPolicy: runit.RestartPolicyOnFailure,
+			Backoff: &runit.Backoff{
+				Initial:     time.Second,
+				Max:         time.Minute,
+				MaxRestarts: 3,
+				Window:      10 * time.Minute,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error activating services: %s", err)
+	}
+
+	unit := readFile(t, s.Service("app__web__launch").Path)
+	for _, expected := range []string{
+		"Restart=on-failure",
+		"RestartSec=1\n",
+		"RestartSteps=6",
+		"RestartMaxDelaySec=60",
+		"StartLimitIntervalSec=600",
+		"StartLimitBurst=4",
+	} {
+		if !strings.Contains(unit, expected) {
+			t.Errorf("Expected unit to contain %q:\n%s", expected, unit)
+		}
+	}
+}
+
+func TestPruneRemovesUnitsOfRemovedPods(t *testing.T) {
+	s, cleanup := fakeSystemd(t)
+	defer cleanup()
+
+	templates := map[string]runit.ServiceTemplate{
+		"app__web__launch": {Run: []string{"/bin/true"}},
+	}
+	err := s.Activate("app", templates)
+	if err != nil {
+		t.Fatalf("Unexpected error activating services: %s", err)
+	}
+	err = s.Activate("other", map[string]runit.ServiceTemplate{
+		"other__web__launch": {Run: []string{"/bin/true"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error activating services: %s", err)
+	}
+
+	// units that p2 didn't write must survive, even if they look like ours
+	preparerUnit := filepath.Join(s.UnitRoot, "p2-preparer.service")
+	err = ioutil.WriteFile(preparerUnit, []byte("[Service]\nExecStart=/usr/bin/p2-preparer\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Remove("other")
+	if err != nil {
+		t.Fatalf("Unexpected error removing pod: %s", err)
+	}
+	err = s.Prune()
+	if err != nil {
+		t.Fatalf("Unexpected error pruning: %s", err)
+	}
+
+	for _, path := range []string{
+		s.Service("other__web__launch").Path,
+		s.LogAgent("other__web__launch").Path,
+		filepath.Join(s.StagingRoot, "other__web__launch"),
+	} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be pruned", path)
+		}
+	}
+	for _, path := range []string{
+		s.Service("app__web__launch").Path,
+		s.LogAgent("app__web__launch").Path,
+		preparerUnit,
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to survive pruning: %s", path, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package sqlite holds helpers for the sqlite databases p2 keeps.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// Migrate brings the schema of db up to date. migrations are the statements
+// that build the schema, in order; new statements must only ever be appended.
+// The number of statements already applied is kept in versionTable, and the
+// outstanding ones are applied in a single transaction.
+func Migrate(db *sql.DB, versionTable string, migrations []string) (err error) {
+	// idempotent
+	_, err = db.Exec(fmt.Sprintf("create table if not exists %s ( version integer );", versionTable))
+	if err != nil {
+		return util.Errorf("Could not set up %s table: %s", versionTable, err)
+	}
+
+	var lastSchemaVersion int64
+	err = db.QueryRow(fmt.Sprintf("select version from %s;", versionTable)).Scan(&lastSchemaVersion)
+	switch {
+	case err == sql.ErrNoRows:
+		// We just created the table, insert a row with 0
+		_, err = db.Exec(fmt.Sprintf("insert into %s(version) values ( 0 );", versionTable))
+		if err != nil {
+			return util.Errorf("Could not initialize %s table: %s", versionTable, err)
+		}
+	case err != nil:
+		return util.Errorf("Error checking schema version: %s", err)
+	}
+
+	if lastSchemaVersion == int64(len(migrations)) {
+		// we're caught up
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return util.Errorf("Could not start transaction for migrations: %s", err)
+	}
+
+	defer func() {
+		if err == nil {
+			// return the commit error by assigning to return variable
+			err = tx.Commit()
+		} else {
+			// return the original error not the rollback error
+			_ = tx.Rollback()
+		}
+	}()
+
+	for i := lastSchemaVersion; i < int64(len(migrations)); i++ {
+		_, err = tx.Exec(migrations[i])
+		if err != nil {
+			return util.Errorf("Could not apply migration %d: %s", i+1, err)
+		}
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("update %s set version = ?;", versionTable), int64(len(migrations)))
+	if err != nil {
+		return util.Errorf("Could not update %s table: %s", versionTable, err)
+	}
+	return nil
+}
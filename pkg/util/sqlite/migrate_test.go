@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMigrateAppliesOnlyNewMigrations(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "migrate_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir for migration test: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("Could not open database: %s", err)
+	}
+	defer db.Close()
+
+	migrations := []string{
+		"create table things ( name text );",
+		"insert into things(name) values ( 'first' );",
+	}
+	err = Migrate(db, "schema_version", migrations)
+	if err != nil {
+		t.Fatalf("Unexpected error running migrations: %s", err)
+	}
+	// running the same migrations again must not apply them twice
+	err = Migrate(db, "schema_version", migrations)
+	if err != nil {
+		t.Fatalf("Unexpected error rerunning migrations: %s", err)
+	}
+
+	migrations = append(migrations, "insert into things(name) values ( 'second' );")
+	err = Migrate(db, "schema_version", migrations)
+	if err != nil {
+		t.Fatalf("Unexpected error running a new migration: %s", err)
+	}
+
+	var count int
+	err = db.QueryRow("select count(*) from things;").Scan(&count)
+	if err != nil {
+		t.Fatalf("Could not count rows: %s", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected each migration to be applied once, but there were %d rows", count)
+	}
+
+	var version int64
+	err = db.QueryRow("select version from schema_version;").Scan(&version)
+	if err != nil {
+		t.Fatalf("Could not read schema version: %s", err)
+	}
+	if version != 3 {
+		t.Errorf("Expected schema version 3 but was %d", version)
+	}
+
+	err = Migrate(db, "schema_version", append(migrations, "not sql"))
+	if err == nil {
+		t.Fatal("Expected an error applying a bad migration")
+	}
+	err = db.QueryRow("select version from schema_version;").Scan(&version)
+	if err != nil {
+		t.Fatalf("Could not read schema version: %s", err)
+	}
+	if version != 3 {
+		t.Errorf("Expected a failed migration to leave the schema version at 3, but it was %d", version)
+	}
+}
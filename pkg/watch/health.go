@@ -2,12 +2,16 @@ package watch
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/preparer"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/types"
@@ -23,6 +27,15 @@ const HEALTHCHECK_INTERVAL = 1 * time.Second
 // Maximum allowed time for a single check, in seconds
 var HEALTHCHECK_TIMEOUT = param.Int64("healthcheck_timeout", 5)
 
+// How many health changes of a pod may wait for the previous one to be
+// handled before further changes are dropped
+const healthChangeBacklog = 10
+
+// How much of a status check's body past the kept output is read and
+// discarded so the connection can be reused. The connection is closed
+// instead if the body is larger
+const maxDiscardedBodyBytes = 1024 * 1024
+
 // Contains method for watching the consul reality store to
 // track services running on a node. A manager method:
 // MonitorPodHealth tracks the reality store and manages
@@ -42,9 +55,32 @@ type PodWatch struct {
 	// on the pod associated with this PodWatch
 	shutdownCh chan bool
 
+	// If set, called with each change of the pod's health between passing
+	// and critical, in order, without holding up the health checks
+	onHealthChange HealthChangeFunc
+	lastStatus     health.HealthState // the last passing or critical health
+	healthChanges  chan healthChange
+
+	// If set, records the changes of the pod's health in the node's
+	// health history
+	recorder HealthRecorder
+
 	logger *logging.Logger
 }
 
+// HealthRecorder records the results of health checks, see history.Recorder
+type HealthRecorder interface {
+	Record(result health.Result, now time.Time) error
+}
+
+// HealthChangeFunc is called when the health of a pod changes between passing
+// and critical
+type HealthChangeFunc func(podManifest manifest.Manifest, previous health.HealthState, current health.HealthState)
+
+type healthChange struct {
+	previous, current health.HealthState
+}
+
 // StatusChecker holds all the data required to perform
 // a status check on a particular service
 type StatusChecker struct {
@@ -52,15 +88,23 @@ type StatusChecker struct {
 	Node   types.NodeName
 	URI    string
 	Client *http.Client
+
+	// If set, returns the services of the pod that exhausted their restart
+	// backoff. The pod is critical while there are any.
+	FailedServices func() ([]string, error)
 }
 
+// FailedServicesFunc returns the services of a pod that exhausted their
+// restart backoff.
+type FailedServicesFunc func(manifest.Manifest) ([]string, error)
+
 // MonitorPodHealth is meant to be a long running go routine.
 // MonitorPodHealth reads from a consul store to determine which
 // services should be running on the host. MonitorPodHealth
 // runs a CheckHealth routine to monitor the health of each
 // service and kills routines for services that should no
-// longer be running.
-func MonitorPodHealth(config *preparer.PreparerConfig, logger *logging.Logger, shutdownCh chan struct{}) {
+// longer be running. onHealthChange and recorder may be nil.
+func MonitorPodHealth(config *preparer.PreparerConfig, logger *logging.Logger, shutdownCh chan struct{}, onHealthChange HealthChangeFunc, recorder HealthRecorder) {
 	client, err := config.GetConsulClient()
 	if err != nil {
 		// A bad config should have already produced a nice, user-friendly error message.
@@ -70,7 +114,7 @@ func MonitorPodHealth(config *preparer.PreparerConfig, logger *logging.Logger, s
 	healthManager := store.NewHealthManager(config.NodeName, *logger)
 
 	node := config.NodeName
-	pods := []PodWatch{}
+	podWatches := []PodWatch{}
 
 	watchQuitCh := make(chan struct{})
 	watchErrCh := make(chan error)
@@ -90,6 +134,17 @@ func MonitorPodHealth(config *preparer.PreparerConfig, logger *logging.Logger, s
 		logger.WithError(err).Fatalln("failed to get http client for this preparer")
 	}
 
+	sup, err := config.Supervisor.Supervisor()
+	if err != nil {
+		logger.WithError(err).Fatalln("invalid supervisor configuration")
+	}
+	podFactory := pods.NewFactory(config.PodRoot, node, nil, config.RequireFile)
+	failedServices := func(man manifest.Manifest) ([]string, error) {
+		pod := podFactory.NewLegacyPod(man.ID())
+		pod.Supervisor = sup
+		return pod.FailedServices(man)
+	}
+
 	insecureClient, err := config.GetInsecureClient(time.Duration(*HEALTHCHECK_TIMEOUT) * time.Second)
 	if err != nil {
 		logger.WithError(err).Fatalln("failed to get http client for this preparer")
@@ -101,11 +156,11 @@ func MonitorPodHealth(config *preparer.PreparerConfig, logger *logging.Logger, s
 			// check if pods have been added or removed
 			// starts monitor routine for new pods
 			// kills monitor routine for removed pods
-			pods = updatePods(healthManager, secureClient, insecureClient, pods, results, node, logger)
+			podWatches = updatePods(healthManager, secureClient, insecureClient, failedServices, onHealthChange, recorder, podWatches, results, node, logger)
 		case err := <-watchErrCh:
 			logger.WithError(err).Errorln("there was an error reading reality manifests for health monitor")
 		case <-shutdownCh:
-			for _, pod := range pods {
+			for _, pod := range podWatches {
 				pod.shutdownCh <- true
 			}
 			close(watchQuitCh)
@@ -121,6 +176,9 @@ func updatePods(
 	healthManager consul.HealthManager,
 	secureClient *http.Client,
 	insecureClient *http.Client,
+	failedServices FailedServicesFunc,
+	onHealthChange HealthChangeFunc,
+	recorder HealthRecorder,
 	current []PodWatch,
 	reality []consul.ManifestResult,
 	node types.NodeName,
@@ -187,6 +245,12 @@ func updatePods(
 				Node:   node,
 				Client: client,
 			}
+			if failedServices != nil {
+				podManifest := man.Manifest
+				sc.FailedServices = func() ([]string, error) {
+					return failedServices(podManifest)
+				}
+			}
 			if man.Manifest.GetStatusPort() == 0 {
 				sc.URI = ""
 			} else if man.Manifest.GetStatusHTTP() {
@@ -195,11 +259,13 @@ func updatePods(
 				sc.URI = fmt.Sprintf("https://%s:%d%s", statusHost, man.Manifest.GetStatusPort(), man.Manifest.GetStatusPath())
 			}
 			newPod := PodWatch{
-				manifest:      man.Manifest,
-				updater:       healthManager.NewUpdater(man.Manifest.ID(), string(man.Manifest.ID())),
-				statusChecker: sc,
-				shutdownCh:    make(chan bool, 1),
-				logger:        logger,
+				manifest:       man.Manifest,
+				updater:        healthManager.NewUpdater(man.Manifest.ID(), string(man.Manifest.ID())),
+				statusChecker:  sc,
+				shutdownCh:     make(chan bool, 1),
+				onHealthChange: onHealthChange,
+				recorder:       recorder,
+				logger:         logger,
 			}
 
 			// Each health monitor will have its own statusChecker
@@ -215,6 +281,11 @@ func updatePods(
 // performs a health check and writes that information to
 // consul
 func (p *PodWatch) MonitorHealth() {
+	if p.onHealthChange != nil {
+		p.healthChanges = make(chan healthChange, healthChangeBacklog)
+		defer close(p.healthChanges)
+		go p.notifyHealthChanges(p.healthChanges)
+	}
 	for {
 		select {
 		case <-time.After(HEALTHCHECK_INTERVAL):
@@ -227,22 +298,85 @@ func (p *PodWatch) MonitorHealth() {
 }
 
 func (p *PodWatch) checkHealth() {
-	health, err := p.statusChecker.Check()
+	result, err := p.statusChecker.Check()
 	if err != nil {
 		p.logger.WithError(err).Warningln("health check failed")
 		return
 	}
 
-	if err = p.updater.PutHealth(resToConsulRes(health)); err != nil {
+	if err = p.updater.PutHealth(resToConsulRes(result)); err != nil {
 		p.logger.WithError(err).Warningln("failed to write health")
 	}
+
+	if p.recorder != nil {
+		if err = p.recorder.Record(result, time.Now()); err != nil {
+			p.logger.WithError(err).Warningln("failed to record health history")
+		}
+	}
+
+	previous, changed := p.recordStatus(result.Status)
+	if changed && p.healthChanges != nil {
+		select {
+		case p.healthChanges <- healthChange{previous: previous, current: result.Status}:
+		default:
+			p.logger.WithField("pod", p.manifest.ID()).Warningln("too many health changes are waiting to be handled, dropping one")
+		}
+	}
+}
+
+// recordStatus remembers the pod's latest passing or critical health and
+// returns its previous one and whether the pod went from passing to critical
+// or back. Other healths in between, like warning or unknown, don't reset
+// what the pod last was, so passing, warning then critical is a change. The
+// first health of a pod isn't a change.
+func (p *PodWatch) recordStatus(status health.HealthState) (health.HealthState, bool) {
+	if status != health.Passing && status != health.Critical {
+		return p.lastStatus, false
+	}
+	previous := p.lastStatus
+	p.lastStatus = status
+	switch {
+	case previous == health.Passing && status == health.Critical:
+		return previous, true
+	case previous == health.Critical && status == health.Passing:
+		return previous, true
+	}
+	return previous, false
+}
+
+// notifyHealthChanges calls onHealthChange for each change until changes is
+// closed
+func (p *PodWatch) notifyHealthChanges(changes <-chan healthChange) {
+	for change := range changes {
+		p.onHealthChange(p.manifest, change.previous, change.current)
+	}
 }
 
 // Given the result of a status check this method
 // creates a health.Result for that node/service/result
 func (sc *StatusChecker) Check() (health.Result, error) {
+	if sc.FailedServices != nil {
+		// if the services can't be determined (e.g. because the pod is
+		// being installed), fall back to the status check
+		failed, err := sc.FailedServices()
+		if err == nil && len(failed) > 0 {
+			// the app is not going to recover by itself, regardless of
+			// what its status check says
+			return health.Result{
+				ID:      sc.ID,
+				Node:    sc.Node,
+				Service: string(sc.ID),
+				Status:  health.Critical,
+				Error:   "restarts exhausted: " + strings.Join(failed, ", "),
+			}, nil
+		}
+	}
+
 	if sc.URI != "" {
-		return sc.resultFromCheck(sc.StatusCheck())
+		start := time.Now()
+		res, err := sc.resultFromCheck(sc.StatusCheck())
+		res.Latency = time.Since(start)
+		return res, err
 	} else {
 		// "unknown" is probably more accurate, but automated tools can't handle an app that is
 		// always non-"passing". For instance, p2-replicate by default waits for a node to
@@ -269,20 +403,35 @@ func (sc *StatusChecker) resultFromCheck(resp *http.Response, err error) (health
 	}
 	if err != nil || resp == nil {
 		res.Status = health.Critical
+		if err != nil {
+			res.Error = err.Error()
+		}
 		return res, nil
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		res.Status = health.Passing
 	} else {
 		res.Status = health.Critical
 	}
+	res.HTTPStatus = resp.StatusCode
+
+	// Only as much of the body as can be written to Consul is kept
+	body, readErr := ioutil.ReadAll(io.LimitReader(resp.Body, int64(*consul.HealthMaxOutputBytes)))
+	res.Output = string(body)
+	if readErr != nil {
+		res.Error = readErr.Error()
+	}
+	// see maxDiscardedBodyBytes
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDiscardedBodyBytes))
 	return res, err
 }
 
-// Go version of http status check
+// Go version of http status check. The caller must close the response's
+// body.
 func (sc *StatusChecker) StatusCheck() (*http.Response, error) {
-	return sc.Client.Head(sc.URI)
+	return sc.Client.Get(sc.URI)
 }
 
 func resToConsulRes(res health.Result) consul.WatchResult {
@@ -291,5 +440,10 @@ func resToConsulRes(res health.Result) consul.WatchResult {
 		Node:    res.Node,
 		Id:      res.ID,
 		Status:  string(res.Status),
+
+		Output:     res.Output,
+		HTTPStatus: res.HTTPStatus,
+		Latency:    res.Latency,
+		Error:      res.Error,
 	}
 }
@@ -4,8 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/Sirupsen/logrus"
@@ -61,7 +65,7 @@ func TestUpdatePods(t *testing.T) {
 	// ids for pods: 1, 2, test
 	// 0, 3 should have values in their shutdownCh
 	logger := logging.NewLogger(logrus.Fields{})
-	pods := updatePods(&MockHealthManager{}, nil, nil, current, reality, "", &logger)
+	pods := updatePods(&MockHealthManager{}, nil, nil, nil, nil, nil, current, reality, "", &logger)
 	Assert(t).AreEqual(true, <-current[0].shutdownCh, "this PodWatch should have been shutdown")
 	Assert(t).AreEqual(true, <-current[3].shutdownCh, "this PodWatch should have been shutdown")
 
@@ -75,7 +79,7 @@ func TestUpdateStatus(t *testing.T) {
 	healthManager := &MockHealthManager{}
 
 	reality := []consul.ManifestResult{newManifestResult("foo"), newManifestResult("bar")}
-	pods1 := updatePods(healthManager, nil, nil, []PodWatch{}, reality, "", &logger)
+	pods1 := updatePods(healthManager, nil, nil, nil, nil, nil, []PodWatch{}, reality, "", &logger)
 	Assert(t).AreEqual(2, len(pods1), "new pods were not added")
 	Assert(t).AreEqual(2, healthManager.UpdaterCreated, "new pods did not create an updaters")
 
@@ -84,7 +88,7 @@ func TestUpdateStatus(t *testing.T) {
 	builder := reality[0].Manifest.GetBuilder()
 	builder.SetStatusPort(2)
 	reality[0].Manifest = builder.GetManifest()
-	pods2 := updatePods(healthManager, nil, nil, pods1, reality, "", &logger)
+	pods2 := updatePods(healthManager, nil, nil, nil, nil, nil, pods1, reality, "", &logger)
 	Assert(t).AreEqual(2, len(pods2), "updatePods() changed the number of pods")
 	Assert(t).AreEqual(1, healthManager.UpdaterCreated, "one pod should have been refreshed")
 }
@@ -94,7 +98,7 @@ func TestUpdatePath(t *testing.T) {
 	healthManager := &MockHealthManager{}
 
 	reality := []consul.ManifestResult{newManifestResult("foo"), newManifestResult("bar")}
-	pods1 := updatePods(healthManager, nil, nil, []PodWatch{}, reality, "bobnode", &logger)
+	pods1 := updatePods(healthManager, nil, nil, nil, nil, nil, []PodWatch{}, reality, "bobnode", &logger)
 	Assert(t).AreEqual(2, len(pods1), "new pods were not added")
 	Assert(t).AreEqual(2, healthManager.UpdaterCreated, "new pods did not create an updaters")
 
@@ -103,7 +107,7 @@ func TestUpdatePath(t *testing.T) {
 	builder := reality[0].Manifest.GetBuilder()
 	builder.SetStatusPath("/_foobar")
 	reality[0].Manifest = builder.GetManifest()
-	pods2 := updatePods(healthManager, nil, nil, pods1, reality, "bobnode", &logger)
+	pods2 := updatePods(healthManager, nil, nil, nil, nil, nil, pods1, reality, "bobnode", &logger)
 	Assert(t).AreEqual(2, len(pods2), "updatePods() changed the number of pods")
 	Assert(t).AreEqual(1, healthManager.UpdaterCreated, "one pod should have been refreshed")
 	Assert(t).AreEqual("https://bobnode:1/_status", pods2[0].statusChecker.URI, "pod should be checking correct path")
@@ -122,6 +126,8 @@ output`))), nil)
 
 	val, _ := sc.resultFromCheck(resp, nil)
 	Assert(t).AreEqual(health.Passing, val.Status, "200 should correspond to health.Passing")
+	Assert(t).AreEqual(200, val.HTTPStatus, "wrong HTTP status")
+	Assert(t).AreEqual("output", val.Output, "the body should be the check's output")
 
 	resp.StatusCode = 282
 	val, _ = sc.resultFromCheck(resp, nil)
@@ -136,6 +142,115 @@ output`))), nil)
 
 	val, _ = sc.resultFromCheck(nil, fmt.Errorf("an error"))
 	Assert(t).AreEqual(health.Critical, val.Status, "err != nil should correspond to health.Critical")
+	Assert(t).AreEqual("an error", val.Error, "wrong error")
+}
+
+func TestResultFromCheckLimitsOutput(t *testing.T) {
+	sc := StatusChecker{}
+	body := strings.Repeat("x", *consul.HealthMaxOutputBytes+1)
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(fmt.Sprintf(`HTTP/1.1 503 Service Unavailable
+Content-Length: %d
+
+%s`, len(body), body))), nil)
+	Assert(t).IsNil(err, "should have had no error reading from bytes buffer")
+
+	val, _ := sc.resultFromCheck(resp, nil)
+	Assert(t).AreEqual(health.Critical, val.Status, "503 should correspond to health.Critical")
+	Assert(t).AreEqual(503, val.HTTPStatus, "wrong HTTP status")
+	Assert(t).AreEqual(*consul.HealthMaxOutputBytes, len(val.Output), "the output should have been limited")
+}
+
+func TestStatusCheckReusesConnections(t *testing.T) {
+	body := strings.Repeat("x", maxDiscardedBodyBytes/2)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	var connections int32
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	sc := StatusChecker{ID: "foo", URI: server.URL, Client: server.Client()}
+	for i := 0; i < 3; i++ {
+		val, err := sc.Check()
+		Assert(t).IsNil(err, "should not have erred checking health")
+		Assert(t).AreEqual(health.Passing, val.Status, "200 should correspond to health.Passing")
+	}
+	Assert(t).AreEqual(int32(1), atomic.LoadInt32(&connections), "expected the checks to share a connection")
+}
+
+func TestCheckFailedServices(t *testing.T) {
+	var failed []string
+	var failedErr error
+	sc := StatusChecker{
+		ID: "foo",
+		FailedServices: func() ([]string, error) {
+			return failed, failedErr
+		},
+	}
+
+	val, err := sc.Check()
+	Assert(t).IsNil(err, "should not have erred checking health")
+	Assert(t).AreEqual(health.Passing, val.Status, "pod without a status port or failed services should be passing")
+
+	failed = []string{"foo__foo__launch"}
+	val, err = sc.Check()
+	Assert(t).IsNil(err, "should not have erred checking health")
+	Assert(t).AreEqual(health.Critical, val.Status, "pod with failed services should be critical")
+
+	failed, failedErr = nil, fmt.Errorf("not installed")
+	val, err = sc.Check()
+	Assert(t).IsNil(err, "should have fallen back to the status check")
+	Assert(t).AreEqual(health.Passing, val.Status, "pod should have used its status check")
+}
+
+func TestHealthChangesArePassedOn(t *testing.T) {
+	type change struct {
+		previous, current health.HealthState
+	}
+	var changes []change
+	p := newWatch("foo")
+	p.onHealthChange = func(_ manifest.Manifest, previous health.HealthState, current health.HealthState) {
+		changes = append(changes, change{previous, current})
+	}
+
+	statusChanges := make(chan healthChange, healthChangeBacklog)
+	for _, status := range []health.HealthState{health.Passing, health.Passing, health.Critical, health.Critical, health.Passing} {
+		previous, changed := p.recordStatus(status)
+		if changed {
+			statusChanges <- healthChange{previous: previous, current: status}
+		}
+	}
+	close(statusChanges)
+	p.notifyHealthChanges(statusChanges)
+
+	Assert(t).AreEqual(len(changes), 2, "expected only the changes between passing and critical to be passed on")
+	Assert(t).AreEqual(changes[0], change{health.Passing, health.Critical}, "wrong first change")
+	Assert(t).AreEqual(changes[1], change{health.Critical, health.Passing}, "wrong second change")
+}
+
+func TestHealthChangesSkipOtherHealths(t *testing.T) {
+	p := newWatch("foo")
+
+	var changes []healthChange
+	statuses := []health.HealthState{
+		health.Passing, health.Warning, health.Critical,
+		health.Unknown, health.Unknown, health.Critical, health.Unknown, health.Passing,
+	}
+	for _, status := range statuses {
+		previous, changed := p.recordStatus(status)
+		if changed {
+			changes = append(changes, healthChange{previous: previous, current: status})
+		}
+	}
+
+	Assert(t).AreEqual(len(changes), 2, "expected the healths between passing and critical to be skipped")
+	Assert(t).AreEqual(changes[0], healthChange{health.Passing, health.Critical}, "wrong first change")
+	Assert(t).AreEqual(changes[1], healthChange{health.Critical, health.Passing}, "wrong second change")
 }
 
 func newWatch(id types.PodID) *PodWatch {